@@ -0,0 +1,320 @@
+//go:build chaos
+
+package chaos
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"taskflow/internal/queue"
+	"taskflow/internal/storage"
+	"taskflow/internal/testutil"
+	"taskflow/internal/types"
+	"testing"
+	"time"
+)
+
+var (
+	soak          = flag.Duration("soak", 2*time.Minute, "how long jobs are submitted and faults injected")
+	workerCount   = flag.Int("workers", 3, "worker processes")
+	rate          = flag.Int("rate", 20, "jobs submitted per second")
+	faultInterval = flag.Duration("fault-interval", 5*time.Second, "time between faults; each lasts half of it")
+)
+
+const (
+	// claimIdle is how long a killed worker's jobs wait to be reclaimed
+	claimIdle = 5 * time.Second
+
+	// settleTimeout bounds how long jobs may take to finish once the
+	// faults stop
+	settleTimeout = 3 * time.Minute
+)
+
+// jobTypes gives jobs enough attempts, retried quickly, to outlast the
+// faults
+const jobTypes = `{
+  "default": {"max_attempts": 20, "retry": {"base_delay": "1s", "max_delay": "5s"}},
+  "types": {"webhook": {"timeout": "10s"}}
+}`
+
+func TestMain(m *testing.M) {
+	os.Exit(testutil.Run(m))
+}
+
+// TestSoak submits webhook jobs while workers are killed and their Redis
+// and PostgreSQL connections fail, then checks that every job finished,
+// that none succeeded twice, and that PostgreSQL and Redis agree on them
+func TestSoak(t *testing.T) {
+	redisAddr := testutil.Redis(t).Options().Addr
+	databaseURL := testutil.Postgres(t)
+
+	redisProxy := newProxy(t, redisAddr)
+	database, err := url.Parse(databaseURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	postgresProxy := newProxy(t, database.Host)
+	proxied := *database
+	proxied.Host = postgresProxy.addr()
+
+	jobTypesFile := filepath.Join(t.TempDir(), "job_types.json")
+	if err := os.WriteFile(jobTypesFile, []byte(jobTypes), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	shared := []string{
+		"QUEUE_ENGINE=stream",
+		"QUEUE_STREAM_CLAIM_IDLE=" + claimIdle.String(),
+		"JOB_TYPES_FILE=" + jobTypesFile,
+		"LOG_LEVEL=warn",
+	}
+	serverEnv := append([]string{
+		"REDIS_ADDR=" + redisAddr,
+		"DATABASE_URL=" + databaseURL,
+		"STATE_RECONCILE_INTERVAL=5s",
+	}, shared...)
+	workerEnv := append([]string{
+		"REDIS_ADDR=" + redisProxy.addr(),
+		"DATABASE_URL=" + proxied.String(),
+		"WORKER_CONCURRENCY=4",
+		"WORKER_POLL_INTERVAL=100ms",
+		"WORKER_DRAIN_TIMEOUT=5s",
+		"WORKER_JOB_TYPES=webhook",
+		"WEBHOOK_ALLOWED_NETWORKS=127.0.0.0/8",
+	}, shared...)
+
+	hooks := newReceiver(t)
+	c := newCluster(t, *workerCount, serverEnv, workerEnv)
+
+	ctx, cancel := context.WithTimeout(context.Background(), *soak)
+	defer cancel()
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		injectFaults(ctx, t, c, redisProxy, postgresProxy)
+	}()
+	jobs := submitJobs(ctx, t, c.url, hooks.url)
+	wg.Wait()
+
+	redisProxy.clear()
+	postgresProxy.clear()
+	t.Logf("Submitted %d jobs, waiting for them to finish", len(jobs))
+
+	store, err := storage.NewPostgresStorage(databaseURL)
+	if err != nil {
+		t.Fatalf("NewPostgresStorage: %v", err)
+	}
+	defer store.Close()
+	q := queue.NewRedisQueue(redisAddr, "", 0)
+	defer q.Close()
+
+	finished := awaitJobs(t, store, q, jobs)
+
+	// No job succeeded twice, and every job that succeeded reached its
+	// webhook. A webhook can be delivered twice if its worker died before
+	// recording the success, and an attempt's outcome is lost if
+	// PostgreSQL is unreachable when it ends, so those are only counted.
+	outcomes := make(map[string]int)
+	redelivered, unrecorded := 0, 0
+	for jobID, seq := range jobs {
+		job := finished[jobID]
+		if job == nil {
+			continue
+		}
+		outcomes[string(job.Status)+" "+string(job.ErrorCode)]++
+
+		attempts, err := store.JobAttempts(context.Background(), jobID)
+		if err != nil {
+			t.Fatalf("failed to read attempts of job %s: %v", jobID, err)
+		}
+		succeeded := 0
+		for _, attempt := range attempts {
+			if attempt.Outcome == types.AttemptSucceeded {
+				succeeded++
+			}
+		}
+
+		completed := job.Status == types.JobStatusCompleted
+		switch {
+		case succeeded > 1:
+			t.Errorf("job %s succeeded %d times", jobID, succeeded)
+		case succeeded == 1 && !completed:
+			t.Errorf("job %s is %s after succeeding", jobID, job.Status)
+		case succeeded == 0 && completed:
+			unrecorded++
+		}
+
+		deliveries := hooks.deliveries(seq)
+		if completed && deliveries == 0 {
+			t.Errorf("job %s completed without delivering its webhook", jobID)
+		}
+		if deliveries > 1 {
+			redelivered++
+		}
+	}
+	t.Logf("Outcomes: %v; %d webhooks delivered more than once; %d completed jobs without a recorded success",
+		outcomes, redelivered, unrecorded)
+}
+
+// injectFaults injects a random fault every faultInterval until ctx is
+// done. Faults other than stopping a worker last half the interval.
+func injectFaults(ctx context.Context, t *testing.T, c *cluster, redis, postgres *proxy) {
+	ticker := time.NewTicker(*faultInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		var heal func()
+		switch rand.IntN(5) {
+		case 0:
+			t.Log("Chaos: killing a worker")
+			c.replaceWorker(syscall.SIGKILL)
+		case 1:
+			t.Log("Chaos: stopping a worker")
+			c.replaceWorker(syscall.SIGTERM)
+		case 2:
+			t.Log("Chaos: slowing Redis down by 200ms")
+			redis.setLatency(200 * time.Millisecond)
+			heal = func() { redis.setLatency(0) }
+		case 3:
+			t.Log("Chaos: resetting Redis connections")
+			redis.setResetRate(0.02)
+			heal = func() { redis.setResetRate(0) }
+		case 4:
+			t.Log("Chaos: partitioning PostgreSQL")
+			postgres.partition()
+			heal = postgres.heal
+		}
+		if heal == nil {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+		case <-time.After(*faultInterval / 2):
+		}
+		heal()
+	}
+}
+
+// submitJobs submits webhook jobs to the API server at rate per second
+// until ctx is done. It returns the sequence number of each job, by ID;
+// each job's webhook goes to /hooks/<sequence number>.
+func submitJobs(ctx context.Context, t *testing.T, apiURL, hooksURL string) map[string]int {
+	jobs := make(map[string]int)
+	ticker := time.NewTicker(time.Second / time.Duration(*rate))
+	defer ticker.Stop()
+	for seq := 0; ; seq++ {
+		select {
+		case <-ctx.Done():
+			return jobs
+		case <-ticker.C:
+		}
+
+		payload := fmt.Sprintf(`{"url": "%s/hooks/%d", "method": "POST"}`, hooksURL, seq)
+		body, _ := json.Marshal(types.JobRequest{Type: types.JobTypeWebhook, Payload: json.RawMessage(payload)})
+		resp, err := http.Post(apiURL+"/api/v1/jobs", "application/json", bytes.NewReader(body))
+		if err != nil {
+			t.Errorf("POST /jobs: %v", err)
+			continue
+		}
+		var created types.JobResponse
+		err = json.NewDecoder(resp.Body).Decode(&created)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusCreated || err != nil || created.Job == nil {
+			t.Errorf("POST /jobs = %s: %v", resp.Status, err)
+			continue
+		}
+		jobs[created.Job.ID] = seq
+	}
+}
+
+// awaitJobs waits until every job is final in PostgreSQL and Redis
+// agrees, and returns them. Jobs that don't get there by settleTimeout
+// are reported as lost.
+func awaitJobs(t *testing.T, store storage.Storage, q queue.Queue, jobs map[string]int) map[string]*types.Job {
+	ctx := context.Background()
+	finished := make(map[string]*types.Job)
+	waiting := make(map[string]string) // status of unfinished jobs, by ID
+	for jobID := range jobs {
+		waiting[jobID] = "unknown"
+	}
+
+	deadline := time.Now().Add(settleTimeout)
+	for len(waiting) > 0 && time.Now().Before(deadline) {
+		for jobID := range waiting {
+			stored, err := store.GetJob(ctx, jobID)
+			if err != nil {
+				waiting[jobID] = err.Error()
+				continue
+			}
+			queued, err := q.GetJob(ctx, jobID)
+			if err != nil {
+				waiting[jobID] = err.Error()
+				continue
+			}
+			if !stored.Status.IsFinal() || queued.Status != stored.Status {
+				waiting[jobID] = fmt.Sprintf("%s in PostgreSQL, %s in Redis", stored.Status, queued.Status)
+				continue
+			}
+			finished[jobID] = stored
+			delete(waiting, jobID)
+		}
+		if len(waiting) > 0 {
+			time.Sleep(time.Second)
+		}
+	}
+
+	for jobID, status := range waiting {
+		t.Errorf("job %s is lost: %s after %v", jobID, status, settleTimeout)
+	}
+	return finished
+}
+
+// receiver is a webhook endpoint that counts deliveries to each path
+type receiver struct {
+	url string
+
+	mu    sync.Mutex
+	calls map[int]int // by sequence number
+}
+
+func newReceiver(t *testing.T) *receiver {
+	r := &receiver{calls: make(map[int]int)}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var seq int
+		if _, err := fmt.Sscanf(strings.TrimPrefix(req.URL.Path, "/hooks/"), "%d", &seq); err != nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		r.mu.Lock()
+		r.calls[seq]++
+		r.mu.Unlock()
+		w.Write([]byte(`{"ok": true}`))
+	}))
+	t.Cleanup(srv.Close)
+	r.url = srv.URL
+	return r
+}
+
+// deliveries returns how many times the webhook of job seq arrived
+func (r *receiver) deliveries(seq int) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.calls[seq]
+}
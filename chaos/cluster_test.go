@@ -0,0 +1,216 @@
+//go:build chaos
+
+package chaos
+
+import (
+	"bufio"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// cluster is an API server and workers run as processes of the taskflow
+// binary. The server talks to Redis and PostgreSQL directly, so that jobs
+// can always be submitted; the workers' environment points them at the
+// proxies that faults are injected into.
+type cluster struct {
+	t      *testing.T
+	binary string
+	logs   string // directory of the processes' output
+	url    string // of the API server
+
+	serverEnv []string
+	workerEnv []string
+
+	mu      sync.Mutex
+	workers []*process
+	started int // workers started so far, to name them
+}
+
+// process is a running taskflow command
+type process struct {
+	name string
+	cmd  *exec.Cmd
+	done chan struct{} // closed when the process exits
+}
+
+// newCluster builds the taskflow binary and starts the API server and
+// n workers, which are stopped when t finishes
+func newCluster(t *testing.T, n int, serverEnv, workerEnv []string) *cluster {
+	t.Helper()
+	dir := t.TempDir()
+	c := &cluster{
+		t:         t,
+		binary:    filepath.Join(dir, "taskflow"),
+		logs:      dir,
+		serverEnv: serverEnv,
+		workerEnv: workerEnv,
+	}
+	build := exec.Command("go", "build", "-o", c.binary, "taskflow/cmd/taskflow")
+	if out, err := build.CombinedOutput(); err != nil {
+		t.Fatalf("failed to build taskflow: %v\n%s", err, out)
+	}
+
+	addr := freeAddr(t)
+	c.url = "http://" + addr
+	server, err := c.start("server", append([]string{"SERVER_ADDR=" + addr}, serverEnv...), "server")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.stop(server, syscall.SIGKILL) })
+	c.waitHealthy(server)
+
+	t.Cleanup(func() {
+		c.mu.Lock()
+		workers := c.workers
+		c.mu.Unlock()
+		for _, w := range workers {
+			c.stop(w, syscall.SIGKILL)
+		}
+		if t.Failed() {
+			c.dumpLogs()
+		}
+	})
+	for i := 0; i < n; i++ {
+		if err := c.startWorker(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return c
+}
+
+// start runs a taskflow command, with its output written to name.log
+func (c *cluster) start(name string, env []string, args ...string) (*process, error) {
+	logFile, err := os.Create(filepath.Join(c.logs, name+".log"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create log of %s: %w", name, err)
+	}
+
+	cmd := exec.Command(c.binary, args...)
+	cmd.Env = append(os.Environ(), env...)
+	cmd.Stdout, cmd.Stderr = logFile, logFile
+	if err := cmd.Start(); err != nil {
+		logFile.Close()
+		return nil, fmt.Errorf("failed to start %s: %w", name, err)
+	}
+
+	p := &process{name: name, cmd: cmd, done: make(chan struct{})}
+	go func() {
+		cmd.Wait()
+		logFile.Close()
+		close(p.done)
+	}()
+	return p, nil
+}
+
+// waitHealthy waits for the API server to answer its health check
+func (c *cluster) waitHealthy(server *process) {
+	c.t.Helper()
+	deadline := time.Now().Add(30 * time.Second)
+	for time.Now().Before(deadline) {
+		select {
+		case <-server.done:
+			c.dumpLogs()
+			c.t.Fatal("API server exited during startup")
+		default:
+		}
+		resp, err := http.Get(c.url + "/api/v1/health")
+		if err == nil {
+			resp.Body.Close()
+			if resp.StatusCode == http.StatusOK {
+				return
+			}
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+	c.dumpLogs()
+	c.t.Fatal("API server isn't healthy after 30s")
+}
+
+// startWorker starts another worker
+func (c *cluster) startWorker() error {
+	c.mu.Lock()
+	c.started++
+	name := fmt.Sprintf("worker-%d", c.started)
+	c.mu.Unlock()
+
+	w, err := c.start(name, c.workerEnv, "worker")
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	c.workers = append(c.workers, w)
+	c.mu.Unlock()
+	return nil
+}
+
+// replaceWorker stops a random worker with sig and starts another in its
+// place, as a supervisor would
+func (c *cluster) replaceWorker(sig syscall.Signal) {
+	c.mu.Lock()
+	i := rand.IntN(len(c.workers))
+	w := c.workers[i]
+	c.workers = append(c.workers[:i], c.workers[i+1:]...)
+	c.mu.Unlock()
+
+	c.stop(w, sig)
+	if err := c.startWorker(); err != nil {
+		c.t.Errorf("failed to replace %s: %v", w.name, err)
+	}
+}
+
+// stop sends sig to p and waits for it to exit, killing it if a graceful
+// stop takes too long
+func (c *cluster) stop(p *process, sig syscall.Signal) {
+	p.cmd.Process.Signal(sig)
+	select {
+	case <-p.done:
+	case <-time.After(30 * time.Second):
+		c.t.Logf("%s is still running 30s after %v, killing it", p.name, sig)
+		p.cmd.Process.Kill()
+		<-p.done
+	}
+}
+
+// dumpLogs logs the end of every process's output
+func (c *cluster) dumpLogs() {
+	paths, _ := filepath.Glob(filepath.Join(c.logs, "*.log"))
+	for _, path := range paths {
+		f, err := os.Open(path)
+		if err != nil {
+			continue
+		}
+		var lines []string
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			if lines = append(lines, scanner.Text()); len(lines) > 20 {
+				lines = lines[1:]
+			}
+		}
+		f.Close()
+
+		c.t.Logf("last lines of %s:", filepath.Base(path))
+		for _, line := range lines {
+			c.t.Log("  " + line)
+		}
+	}
+}
+
+// freeAddr returns a local address nothing listens on
+func freeAddr(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to find a free port: %v", err)
+	}
+	defer ln.Close()
+	return ln.Addr().String()
+}
@@ -0,0 +1,9 @@
+// Package chaos holds a soak test that runs the API server and several
+// workers as separate processes of the taskflow binary while faults are
+// injected: workers are killed or stopped, their Redis connections are
+// slowed down and reset, and PostgreSQL is partitioned away from them. It
+// then checks that no job was lost or completed twice. The package has no
+// code of its own, and its tests are only built with the chaos tag:
+//
+//	go test -tags chaos -v ./chaos -soak=10m
+package chaos
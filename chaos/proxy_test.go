@@ -0,0 +1,177 @@
+//go:build chaos
+
+package chaos
+
+import (
+	"math/rand/v2"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// proxy forwards TCP connections to a server, injecting faults on the way
+type proxy struct {
+	target string
+	ln     net.Listener
+
+	mu        sync.Mutex
+	conns     map[net.Conn]struct{}
+	latency   time.Duration // added before each chunk is forwarded
+	resetRate float64       // chance that a chunk resets its connection
+	held      chan struct{} // closed when a partition heals, nil without one
+}
+
+// newProxy starts a proxy to target on a free local port, and stops it
+// when t finishes
+func newProxy(t *testing.T, target string) *proxy {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	p := &proxy{target: target, ln: ln, conns: make(map[net.Conn]struct{})}
+	go p.serve()
+	t.Cleanup(p.close)
+	return p
+}
+
+// addr is where clients connect to reach the target through the proxy
+func (p *proxy) addr() string {
+	return p.ln.Addr().String()
+}
+
+// setLatency delays every chunk forwarded either way by d
+func (p *proxy) setLatency(d time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.latency = d
+}
+
+// setResetRate resets connections at random, rate being the chance that
+// any one chunk resets its connection instead of being forwarded
+func (p *proxy) setResetRate(rate float64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.resetRate = rate
+}
+
+// partition cuts every connection. New connections are accepted but go
+// nowhere until heal, as when packets are dropped.
+func (p *proxy) partition() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.held == nil {
+		p.held = make(chan struct{})
+	}
+	for conn := range p.conns {
+		reset(conn)
+		delete(p.conns, conn)
+	}
+}
+
+// heal ends a partition, closing the connections held during it
+func (p *proxy) heal() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.held != nil {
+		close(p.held)
+		p.held = nil
+	}
+}
+
+// clear removes every fault
+func (p *proxy) clear() {
+	p.heal()
+	p.setLatency(0)
+	p.setResetRate(0)
+}
+
+func (p *proxy) close() {
+	p.ln.Close()
+	p.partition()
+	p.heal()
+}
+
+func (p *proxy) serve() {
+	for {
+		client, err := p.ln.Accept()
+		if err != nil {
+			return
+		}
+		go p.handle(client)
+	}
+}
+
+func (p *proxy) handle(client net.Conn) {
+	p.mu.Lock()
+	held := p.held
+	p.mu.Unlock()
+	if held != nil {
+		<-held
+		client.Close()
+		return
+	}
+
+	server, err := net.Dial("tcp", p.target)
+	if err != nil {
+		client.Close()
+		return
+	}
+	p.mu.Lock()
+	p.conns[client] = struct{}{}
+	p.conns[server] = struct{}{}
+	p.mu.Unlock()
+
+	go p.pipe(server, client)
+	p.pipe(client, server)
+}
+
+// pipe forwards src to dst until either fails or a fault resets them
+func (p *proxy) pipe(dst, src net.Conn) {
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := src.Read(buf)
+		if n > 0 {
+			p.mu.Lock()
+			latency, resetNow := p.latency, rand.Float64() < p.resetRate
+			p.mu.Unlock()
+			if resetNow {
+				p.drop(dst, src, true)
+				return
+			}
+			time.Sleep(latency)
+			if _, err := dst.Write(buf[:n]); err != nil {
+				break
+			}
+		}
+		if err != nil {
+			break
+		}
+	}
+	p.drop(dst, src, false)
+}
+
+// drop closes both ends of a proxied connection, resetting them rather
+// than shutting them down cleanly if asked to
+func (p *proxy) drop(a, b net.Conn, abort bool) {
+	p.mu.Lock()
+	delete(p.conns, a)
+	delete(p.conns, b)
+	p.mu.Unlock()
+	if abort {
+		reset(a)
+		reset(b)
+		return
+	}
+	a.Close()
+	b.Close()
+}
+
+// reset closes conn with a TCP RST, as a crashed peer or a middlebox would
+func reset(conn net.Conn) {
+	if tcp, ok := conn.(*net.TCPConn); ok {
+		tcp.SetLinger(0)
+	}
+	conn.Close()
+}
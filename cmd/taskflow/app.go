@@ -0,0 +1,389 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"taskflow/internal/autoscale"
+	"taskflow/internal/blobstore"
+	"taskflow/internal/breaker"
+	"taskflow/internal/config"
+	"taskflow/internal/debug"
+	"taskflow/internal/encryption"
+	"taskflow/internal/events"
+	"taskflow/internal/lock"
+	"taskflow/internal/logger"
+	"taskflow/internal/metrics"
+	"taskflow/internal/queue"
+	"taskflow/internal/ratelimit"
+	"taskflow/internal/storage"
+	"taskflow/internal/types"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// app holds the connections shared by the API server and workers, so that
+// `taskflow all` opens them once
+type app struct {
+	cfg        *config.Config
+	configPath string
+	log        *logger.Logger
+
+	cipher      *encryption.Cipher
+	storage     *storage.PostgresStorage
+	queue       queue.Queue
+	redisClient redis.UniversalClient // nil with the SQS backend
+	eventBus    *events.Bus
+	blobStore   blobstore.Store // nil unless BLOB_STORE_URL is set
+	breakers    []*breaker.Breaker
+	debug       *debug.Server // nil unless DEBUG_ADDR is set
+}
+
+// newApp connects to storage, the queue and the optional services
+// configured in cfg
+func newApp(ctx context.Context, cfg *config.Config, configPath string) (*app, error) {
+	a := &app{cfg: cfg, configPath: configPath, log: logger.GetLogger()}
+	log := a.log
+
+	// Initialize payload encryption (optional)
+	cipher, err := encryption.NewCipherFromConfig(ctx, encryptionConfig(cfg))
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize payload encryption: %w", err)
+	}
+	if cipher.Encrypts() {
+		log.Info("✓ Payload encryption enabled")
+	}
+	if cfg.Payloads.Compression != "" {
+		log.Infof("✓ Compressing payloads over %d bytes with %s", cfg.Payloads.CompressThreshold, cfg.Payloads.Compression)
+	}
+	a.cipher = cipher
+
+	// Connect to Redis first with the Redis backend, so that processes
+	// starting together can take turns migrating PostgreSQL
+	if cfg.Queue.Backend == queue.BackendRedis {
+		redisQueue, err := queue.NewRedisQueueFromConfig(queueConfig(cfg),
+			queue.WithCipher(cipher),
+			queue.WithBreaker(a.newBreaker("redis")),
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to configure Redis: %w", err)
+		}
+		a.queue, a.redisClient = redisQueue, redisQueue.Client()
+	}
+
+	// Initialize PostgreSQL storage
+	storageOpts := []storage.Option{
+		storage.WithCipher(cipher),
+		storage.WithPool(poolConfig(cfg)),
+		storage.WithBreaker(a.newBreaker("postgres")),
+	}
+	if !cfg.Database.PreparedStatements {
+		storageOpts = append(storageOpts, storage.WithoutPreparedStatements())
+	}
+	if cfg.Database.ReplicaURL != "" {
+		storageOpts = append(storageOpts, storage.WithReplica(cfg.Database.ReplicaURL))
+	}
+	if a.redisClient != nil {
+		storageOpts = append(storageOpts, storage.WithMigrationLock(lock.NewRedisLocker(a.redisClient)))
+	}
+	a.storage, err = storage.NewPostgresStorage(cfg.Database.URL, storageOpts...)
+	if err != nil {
+		a.Close()
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+	log.Info("✓ Connected to PostgreSQL")
+	if cfg.Database.ReplicaURL != "" {
+		log.Info("✓ Reading lists and stats from the PostgreSQL replica")
+	}
+
+	// Initialize the SQS queue, which keeps job data in PostgreSQL
+	if cfg.Queue.Backend == queue.BackendSQS {
+		sqsQueue, err := queue.NewSQSQueue(ctx, sqsConfig(cfg), a.storage)
+		if err != nil {
+			a.Close()
+			return nil, fmt.Errorf("failed to configure SQS: %w", err)
+		}
+		a.queue = sqsQueue
+	}
+
+	// Test queue connection
+	if err := a.queue.Ping(ctx); err != nil {
+		a.Close()
+		return nil, fmt.Errorf("failed to connect to %s: %w", cfg.Queue.Backend, err)
+	}
+	log.Infof("✓ Connected to %s", cfg.Queue.Backend)
+	a.registerPoolMetrics()
+
+	// Load payload schemas: files override built-ins, stored schemas override files
+	if cfg.Server.SchemaDir != "" {
+		if err := types.DefaultSchemas.LoadDir(cfg.Server.SchemaDir); err != nil {
+			a.Close()
+			return nil, fmt.Errorf("failed to load payload schemas: %w", err)
+		}
+	}
+	storedSchemas, err := a.storage.GetJobSchemas(ctx)
+	if err != nil {
+		a.Close()
+		return nil, fmt.Errorf("failed to load stored payload schemas: %w", err)
+	}
+	if _, err := types.DefaultSchemas.Sync(storedSchemas); err != nil {
+		log.WithError(err).Warn("Skipping invalid stored schemas")
+	}
+	log.Infof("✓ Loaded payload schemas for %v", types.DefaultSchemas.JobTypes())
+
+	// Load per-job-type settings, shared by the API server and workers
+	if err := types.DefaultJobTypes.Set(cfg.JobTypes); err != nil {
+		a.Close()
+		return nil, fmt.Errorf("failed to apply job type config: %w", err)
+	}
+
+	// Move jobs queued by older versions onto the per-type pending lists
+	moved, err := a.queue.MigrateLegacyQueue(ctx, types.DefaultSchemas.JobTypes())
+	if err != nil {
+		a.Close()
+		return nil, fmt.Errorf("failed to migrate pending queue: %w", err)
+	}
+	if moved > 0 {
+		log.Infof("✓ Migrated %d pending jobs to per-type queues", moved)
+	}
+
+	// Initialize event bus (optional)
+	eventSink, err := events.NewSink(eventsConfig(cfg), a.redisClient)
+	if err != nil {
+		a.Close()
+		return nil, fmt.Errorf("failed to create event sink: %w", err)
+	}
+	a.eventBus = events.NewBus(eventSink)
+	if cfg.Events.Sink != "" {
+		log.Infof("✓ Publishing job events to %s (%s)", cfg.Events.Sink, cfg.Events.Target)
+	}
+
+	// Initialize the blob store for large payloads and results (optional)
+	if cfg.Payloads.BlobStoreURL != "" {
+		a.blobStore, err = blobstore.Open(ctx, cfg.Payloads.BlobStoreURL)
+		if err != nil {
+			a.Close()
+			return nil, fmt.Errorf("failed to open blob store: %w", err)
+		}
+	}
+
+	// Profiling and status endpoints on an internal port (optional)
+	if cfg.Debug.Addr != "" {
+		a.debug = debug.NewServer(cfg.Debug.Addr)
+	}
+
+	return a, nil
+}
+
+// runDebug serves the debug endpoints, if enabled, until ctx is done
+func (a *app) runDebug(ctx context.Context) {
+	if a.debug == nil {
+		return
+	}
+	a.log.Infof("✓ Debug endpoints on %s", a.cfg.Debug.Addr)
+	if err := a.debug.Run(ctx); err != nil {
+		a.log.WithError(err).Error("Debug endpoints stopped")
+	}
+}
+
+// newBreaker creates the circuit breaker for a dependency, logging its
+// state changes and exporting its state as a metric
+func (a *app) newBreaker(name string) *breaker.Breaker {
+	config := breaker.Config{
+		FailureThreshold: a.cfg.Breakers.FailureThreshold,
+		OpenTimeout:      a.cfg.Breakers.OpenTimeout,
+	}
+	b := breaker.New(name, config, breaker.WithOnChange(func(name string, state breaker.State) {
+		a.log.WithFields(logger.Fields{"dependency": name, "state": state.String()}).Warn("Circuit breaker changed state")
+		metrics.SetCircuitBreakerState(name, int(state))
+	}))
+	metrics.SetCircuitBreakerState(name, int(breaker.Closed))
+	a.breakers = append(a.breakers, b)
+	return b
+}
+
+// registerPoolMetrics exports the PostgreSQL and Redis connection pool
+// stats as metrics
+func (a *app) registerPoolMetrics() {
+	metrics.RegisterPool("postgres", func() metrics.PoolStats {
+		return dbPoolStats(a.storage.Stats())
+	})
+	if _, ok := a.storage.ReplicaStats(); ok {
+		metrics.RegisterPool("postgres_replica", func() metrics.PoolStats {
+			stats, _ := a.storage.ReplicaStats()
+			return dbPoolStats(stats)
+		})
+	}
+	if a.redisClient != nil {
+		metrics.RegisterPool("redis", func() metrics.PoolStats {
+			stats := a.redisClient.PoolStats()
+			return metrics.PoolStats{
+				Open:     int(stats.TotalConns),
+				InUse:    int(stats.TotalConns) - int(stats.IdleConns),
+				Idle:     int(stats.IdleConns),
+				Timeouts: int64(stats.Timeouts),
+			}
+		})
+	}
+}
+
+// dbPoolStats converts database/sql pool stats
+func dbPoolStats(stats sql.DBStats) metrics.PoolStats {
+	return metrics.PoolStats{
+		Open:         stats.OpenConnections,
+		InUse:        stats.InUse,
+		Idle:         stats.Idle,
+		WaitCount:    stats.WaitCount,
+		WaitDuration: stats.WaitDuration,
+	}
+}
+
+// Close releases the connections opened by newApp
+func (a *app) Close() {
+	if a.eventBus != nil {
+		a.eventBus.Close()
+	}
+	if a.queue != nil {
+		a.queue.Close()
+	}
+	if a.storage != nil {
+		a.storage.Close()
+	}
+}
+
+// watchConfig applies changes to the log level, job type settings and,
+// when the API server runs, rate limits on SIGHUP, or when the config file
+// changes if CONFIG_RELOAD_INTERVAL is set
+func (a *app) watchConfig(ctx context.Context, limiter *ratelimit.Limiter) {
+	log := a.log
+	watcher := config.NewWatcher(a.configPath, a.cfg, a.cfg.ReloadInterval, func(next *config.Config, changes []config.Change) {
+		if err := log.SetLevelName(next.Logging.Level); err != nil {
+			log.WithError(err).Error("Failed to set log level")
+		}
+		if limiter != nil {
+			limiter.SetLimits(next.RateLimits)
+		}
+		if err := types.DefaultJobTypes.Set(next.JobTypes); err != nil {
+			log.WithError(err).Error("Failed to apply job type config")
+		}
+		a.auditConfigChanges(ctx, changes)
+	})
+	watcher.Run(ctx)
+}
+
+// newLocker creates the locker processors serialize work with, shared
+// through Redis when the queue uses it
+func (a *app) newLocker() *lock.Locker {
+	if a.redisClient != nil {
+		return lock.NewRedisLocker(a.redisClient)
+	}
+	return lock.NewMemoryLocker()
+}
+
+// auditConfigChanges records the changes a reload applied in the audit
+// log. Every process records the changes it applied itself, under its
+// host name.
+func (a *app) auditConfigChanges(ctx context.Context, changes []config.Change) {
+	host, _ := os.Hostname()
+	for _, change := range changes {
+		entry := &types.AuditEntry{
+			Action: types.AuditConfigChange,
+			Actor:  "config@" + host,
+			Target: change.Setting,
+			Before: auditValue(change.Old),
+			After:  auditValue(change.New),
+		}
+		if err := a.storage.RecordAudit(ctx, entry); err != nil {
+			a.log.WithError(err).Errorf("Failed to audit change of %s", change.Setting)
+		}
+	}
+}
+
+// auditValue keeps config values that are JSON, such as job type settings
+// and numbers, and quotes the others
+func auditValue(value string) json.RawMessage {
+	if value != "" && json.Valid([]byte(value)) {
+		return json.RawMessage(value)
+	}
+	data, _ := json.Marshal(value)
+	return data
+}
+
+// queueConfig returns the Redis queue settings
+func queueConfig(cfg *config.Config) queue.Config {
+	return queue.Config{
+		Mode:             cfg.Redis.Mode,
+		Addrs:            queue.ParseAddrs(cfg.Redis.Addr),
+		Password:         cfg.Redis.Password,
+		DB:               cfg.Redis.DB,
+		MasterName:       cfg.Redis.SentinelMaster,
+		SentinelPassword: cfg.Redis.SentinelPassword,
+		Engine:           cfg.Queue.Engine,
+		StreamClaimIdle:  cfg.Queue.StreamClaimIdle,
+		AffinityLeaseTTL: cfg.Queue.AffinityLeaseTTL,
+		Codec:            cfg.Queue.Codec,
+		Pool: queue.PoolConfig{
+			Size:         cfg.Redis.PoolSize,
+			MinIdle:      cfg.Redis.MinIdleConns,
+			Timeout:      cfg.Redis.PoolTimeout,
+			DialTimeout:  cfg.Redis.DialTimeout,
+			ReadTimeout:  cfg.Redis.ReadTimeout,
+			WriteTimeout: cfg.Redis.WriteTimeout,
+		},
+	}
+}
+
+// sqsConfig returns the SQS queue settings
+func sqsConfig(cfg *config.Config) queue.SQSConfig {
+	return queue.SQSConfig{
+		QueuePrefix:       cfg.Queue.SQS.QueuePrefix,
+		Region:            cfg.Queue.SQS.Region,
+		Endpoint:          cfg.Queue.SQS.Endpoint,
+		VisibilityTimeout: cfg.Queue.SQS.VisibilityTimeout,
+	}
+}
+
+// poolConfig returns the database connection pool settings
+func poolConfig(cfg *config.Config) storage.PoolConfig {
+	return storage.PoolConfig{
+		MaxOpenConns:    cfg.Database.MaxOpenConns,
+		MaxIdleConns:    cfg.Database.MaxIdleConns,
+		ConnMaxLifetime: cfg.Database.ConnMaxLifetime,
+		ConnMaxIdleTime: cfg.Database.ConnMaxIdleTime,
+	}
+}
+
+// encryptionConfig returns the payload encryption settings
+func encryptionConfig(cfg *config.Config) encryption.Config {
+	return encryption.Config{
+		Key:      cfg.Encryption.Key,
+		KeyID:    cfg.Encryption.KeyID,
+		KMSKeyID: cfg.Encryption.KMSKeyID,
+
+		Compression:       cfg.Payloads.Compression,
+		CompressThreshold: cfg.Payloads.CompressThreshold,
+	}
+}
+
+// eventsConfig returns the job event sink settings
+func eventsConfig(cfg *config.Config) events.Config {
+	return events.Config{
+		Sink:   cfg.Events.Sink,
+		Addr:   cfg.Events.Addr,
+		Target: cfg.Events.Target,
+	}
+}
+
+// autoscaleConfig returns the inputs of the worker count recommendation
+func autoscaleConfig(cfg *config.Config) autoscale.Config {
+	return autoscale.Config{
+		TargetLatency:    cfg.Autoscale.TargetLatency,
+		WorkerThroughput: cfg.Autoscale.WorkerThroughput,
+		Window:           cfg.Autoscale.Window,
+		MinWorkers:       cfg.Autoscale.MinWorkers,
+		MaxWorkers:       cfg.Autoscale.MaxWorkers,
+	}
+}
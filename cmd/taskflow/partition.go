@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"taskflow/internal/config"
+	"taskflow/internal/storage"
+)
+
+// partitionJobs converts the jobs table of an existing installation into
+// monthly partitions. Servers and workers keep running, but requests that
+// touch jobs wait while the table's primary key is rebuilt.
+func partitionJobs(ctx context.Context, cfg *config.Config) error {
+	store, err := storage.NewPostgresStorage(cfg.Database.URL,
+		storage.WithPool(poolConfig(cfg)),
+		storage.WithoutPreparedStatements(),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer store.Close()
+
+	partitioned, err := store.JobsPartitioned(ctx)
+	if err != nil {
+		return err
+	}
+	if partitioned {
+		fmt.Println("The jobs table is already partitioned")
+		return nil
+	}
+
+	start := time.Now()
+	created, err := store.PartitionJobs(ctx, start, cfg.Database.JobPartitionsAhead)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Partitioned the jobs table in %s; partitions: %s\n",
+		time.Since(start).Round(time.Millisecond), strings.Join(created, ", "))
+	return nil
+}
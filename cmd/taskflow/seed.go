@@ -0,0 +1,335 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"math/rand/v2"
+	"strings"
+	"time"
+
+	"taskflow/internal/storage"
+	"taskflow/internal/types"
+)
+
+// seedOptions are the flags of the seed command
+type seedOptions struct {
+	jobs    int
+	days    int
+	workers int
+	tenants string
+	seed    uint64
+}
+
+func (o *seedOptions) register(flags *flag.FlagSet) {
+	flags.IntVar(&o.jobs, "jobs", 10000, "jobs to create")
+	flags.IntVar(&o.days, "days", 30, "days over which the jobs were created")
+	flags.IntVar(&o.workers, "workers", 5, "workers to register")
+	flags.StringVar(&o.tenants, "tenants", types.DefaultTenantID, "comma-separated tenants owning the jobs")
+	flags.Uint64Var(&o.seed, "seed", 0, "random seed, to create the same data again (default: random)")
+}
+
+// seedBatch is how many jobs are stored at once
+const seedBatch = 1000
+
+// seed fills storage and the queue with synthetic jobs and workers, for
+// developing and demoing dashboards, retention and search without a real
+// workload. Most jobs are finished, with the statuses, error codes,
+// timings and results of real ones, and are only stored. The rest are
+// waiting, pending or scheduled, and are queued too, so a running worker
+// would process them; their payloads point at example.com. Jobs are never
+// seeded as processing, since reconciliation would settle them at once
+// without a worker running them.
+func (a *app) seed(ctx context.Context, opts seedOptions) error {
+	if opts.jobs < 0 || opts.days < 1 || opts.workers < 0 {
+		return fmt.Errorf("jobs and workers can't be negative, and days must be at least 1")
+	}
+	if opts.seed == 0 {
+		opts.seed = rand.Uint64()
+	}
+	g := &seeder{
+		rng:       rand.New(rand.NewPCG(opts.seed, opts.seed)),
+		now:       time.Now(),
+		span:      time.Duration(opts.days) * 24 * time.Hour,
+		tenants:   strings.Split(opts.tenants, ","),
+		workers:   opts.workers,
+		resultTTL: a.cfg.Results.TTL,
+	}
+	start := time.Now()
+
+	counts := make(map[types.JobStatus]int)
+	for created := 0; created < opts.jobs; {
+		n := min(seedBatch, opts.jobs-created)
+		jobs := make([]*types.Job, n)
+		var waiting []*types.Job
+		for i := range jobs {
+			jobs[i] = g.job()
+			counts[jobs[i].Status]++
+			if !jobs[i].Status.IsFinal() {
+				waiting = append(waiting, jobs[i])
+			}
+		}
+
+		if err := a.storage.CreateJobs(ctx, jobs); err != nil {
+			return err
+		}
+		if len(waiting) > 0 {
+			if err := a.queue.EnqueueJobs(ctx, waiting); err != nil {
+				return err
+			}
+		}
+		for _, job := range jobs {
+			if result := g.result(job); result != nil {
+				if err := a.storage.SaveResult(ctx, result); err != nil {
+					return err
+				}
+			}
+		}
+		created += n
+	}
+
+	for i := 1; i <= opts.workers; i++ {
+		if err := a.storage.RegisterWorker(ctx, g.worker(i)); err != nil {
+			return err
+		}
+	}
+
+	fmt.Printf("Seeded %d jobs and %d workers in %s (seed %d)\n",
+		opts.jobs, opts.workers, time.Since(start).Round(time.Millisecond), opts.seed)
+	for _, status := range []types.JobStatus{
+		types.JobStatusCompleted, types.JobStatusFailed, types.JobStatusCancelled,
+		types.JobStatusExpired, types.JobStatusPending, types.JobStatusScheduled,
+	} {
+		fmt.Printf("  %-10s %d\n", status, counts[status])
+	}
+	return nil
+}
+
+// seeder makes up jobs, results and workers
+type seeder struct {
+	rng       *rand.Rand
+	now       time.Time
+	span      time.Duration // how far back jobs were created
+	tenants   []string
+	workers   int
+	resultTTL time.Duration
+}
+
+// seedJobTypes are the job types seeded, weighted by how common they are
+var seedJobTypes = []struct {
+	jobType types.JobType
+	weight  int
+	runtime time.Duration // typical, attempts take up to 5 times as long
+}{
+	{types.JobTypeEmail, 50, 500 * time.Millisecond},
+	{types.JobTypeWebhook, 30, 300 * time.Millisecond},
+	{types.JobTypeImageResize, 12, 4 * time.Second},
+	{types.JobTypeDataExport, 8, 20 * time.Second},
+}
+
+// seedFailures are the failures of failed jobs, weighted the same way
+var seedFailures = []struct {
+	code    types.ErrorCode
+	weight  int
+	message string
+}{
+	{types.ErrorCodeDownstream5xx, 45, "downstream returned 503 Service Unavailable"},
+	{types.ErrorCodeTimeout, 25, "attempt timed out after 30s"},
+	{types.ErrorCodeRateLimited, 15, "downstream returned 429 Too Many Requests"},
+	{types.ErrorCodeValidation, 10, "payload is invalid: missing required field"},
+	{types.ErrorCodePanic, 5, "processor panicked: runtime error: index out of range"},
+}
+
+// job makes up a job. Recent jobs are more common than old ones, and only
+// jobs created in the last hour may still be waiting.
+func (g *seeder) job() *types.Job {
+	r := g.rng
+	jobType := seedJobTypes[g.pick(len(seedJobTypes), func(i int) int { return seedJobTypes[i].weight })]
+
+	job := types.NewJob(&types.JobRequest{Type: jobType.jobType, Payload: g.payload(jobType.jobType)})
+	job.TenantID = g.tenants[r.IntN(len(g.tenants))]
+	switch p := r.IntN(10); {
+	case p == 0:
+		job.Priority = types.JobPriorityHigh
+	case p == 1:
+		job.Priority = types.JobPriorityLow
+	}
+
+	u := r.Float64()
+	created := g.now.Add(-time.Duration(u * u * float64(g.span)))
+	job.CreatedAt, job.ScheduledAt, job.UpdatedAt = created, created, created
+
+	if g.now.Sub(created) < time.Hour {
+		switch r.IntN(4) {
+		case 0:
+			job.Status = types.JobStatusPending
+			return job
+		case 1:
+			job.Status = types.JobStatusScheduled
+			job.ScheduledAt = g.now.Add(time.Duration(r.Int64N(int64(24 * time.Hour))))
+			return job
+		}
+	}
+
+	switch n := r.IntN(100); {
+	case n < 3:
+		job.Status = types.JobStatusCancelled
+		job.UpdatedAt = created.Add(time.Duration(r.Int64N(int64(time.Minute))))
+		return job
+	case n < 5:
+		expires := created.Add(time.Hour)
+		job.Status, job.ExpiresAt, job.UpdatedAt = types.JobStatusExpired, &expires, expires
+		return job
+	case n < 15:
+		failure := seedFailures[g.pick(len(seedFailures), func(i int) int { return seedFailures[i].weight })]
+		job.Status, job.Error, job.ErrorCode = types.JobStatusFailed, failure.message, failure.code
+		job.Attempts = job.MaxAttempts
+		if failure.code == types.ErrorCodeValidation {
+			job.Attempts = 1
+		}
+	default:
+		job.Status = types.JobStatusCompleted
+		if r.IntN(20) == 0 {
+			job.Attempts = 1
+		}
+	}
+
+	// Finished attempts: a wait in the queue, then a run of up to five times
+	// the type's typical runtime
+	started := created.Add(time.Duration(r.ExpFloat64() * float64(time.Second)))
+	finished := started.Add(time.Duration((0.2 + 4.8*r.Float64()) * float64(jobType.runtime)))
+	if late := finished.Sub(g.now); late > 0 {
+		created, started, finished = created.Add(-late), started.Add(-late), g.now
+		job.CreatedAt, job.ScheduledAt = created, created
+	}
+	job.StartedAt, job.CompletedAt, job.UpdatedAt = &started, &finished, finished
+	job.WorkerID = fmt.Sprintf("seed-worker-%d", 1+r.IntN(max(g.workers, 1)))
+	return job
+}
+
+// pick returns one of n choices at random, in proportion to their weights
+func (g *seeder) pick(n int, weight func(int) int) int {
+	total := 0
+	for i := 0; i < n; i++ {
+		total += weight(i)
+	}
+	x := g.rng.IntN(total)
+	for i := 0; i < n; i++ {
+		if x -= weight(i); x < 0 {
+			return i
+		}
+	}
+	return n - 1
+}
+
+// payload makes up a payload of jobType aimed at example.com
+func (g *seeder) payload(jobType types.JobType) json.RawMessage {
+	r := g.rng
+	var payload interface{}
+	switch jobType {
+	case types.JobTypeEmail:
+		subjects := []string{"Welcome to TaskFlow", "Your order has shipped", "Reset your password", "Weekly report"}
+		payload = types.EmailPayload{
+			To:      fmt.Sprintf("user%d@example.com", r.IntN(5000)),
+			Subject: subjects[r.IntN(len(subjects))],
+			Body:    "This email was generated by taskflow seed.",
+		}
+	case types.JobTypeWebhook:
+		events := []string{"order.created", "order.paid", "invoice.sent", "user.signed_up"}
+		payload = types.WebhookPayload{
+			URL:    "https://hooks.example.com/taskflow",
+			Method: "POST",
+			Data:   map[string]interface{}{"event": events[r.IntN(len(events))], "id": r.IntN(100000)},
+		}
+	case types.JobTypeImageResize:
+		payload = types.ImageResizePayload{
+			ImageURL:   fmt.Sprintf("https://images.example.com/photos/%d.jpg", r.IntN(100000)),
+			Sizes:      []int{100, 300, 800},
+			Format:     "webp",
+			OutputPath: "thumbnails/",
+		}
+	case types.JobTypeDataExport:
+		payload = types.DataExportPayload{
+			ExportType: "csv",
+			Query:      "SELECT id, email, created_at FROM users WHERE created_at > $1",
+			Params:     []interface{}{g.now.AddDate(0, 0, -7).Format("2006-01-02")},
+			OutputPath: fmt.Sprintf("users-%d.csv", r.IntN(100000)),
+		}
+	}
+	data, _ := json.Marshal(payload)
+	return data
+}
+
+// result makes up the result of a completed job, expiring after the
+// configured result TTL, or returns nil for other jobs
+func (g *seeder) result(job *types.Job) *storage.JobResult {
+	if job.Status != types.JobStatusCompleted {
+		return nil
+	}
+	r := g.rng
+	finished := *job.CompletedAt
+	var result interface{}
+	switch job.Type {
+	case types.JobTypeEmail:
+		result = types.EmailResult{MessageID: fmt.Sprintf("<%s@example.com>", job.ID), SentAt: finished.Format(time.RFC3339)}
+	case types.JobTypeWebhook:
+		result = types.WebhookResult{StatusCode: 200, ResponseBody: `{"ok": true}`, Duration: finished.Sub(*job.StartedAt).Milliseconds()}
+	case types.JobTypeImageResize:
+		var payload types.ImageResizePayload
+		json.Unmarshal(job.Payload, &payload)
+		images := make([]types.ResizedImage, len(payload.Sizes))
+		for i, width := range payload.Sizes {
+			images[i] = types.ResizedImage{
+				Width:  width,
+				Height: width * 2 / 3,
+				Size:   int64(width * (20 + r.IntN(40))),
+				URL:    fmt.Sprintf("https://images.example.com/thumbnails/%s_%d.webp", job.ID, width),
+				Format: "webp",
+			}
+		}
+		result = types.ImageResizeResult{
+			OriginalURL: payload.ImageURL,
+			Images:      images,
+			Metadata:    types.ImageMetadata{OriginalWidth: 3000, OriginalHeight: 2000, OriginalSize: 2_400_000, Format: "jpeg"},
+		}
+	case types.JobTypeDataExport:
+		rows := r.IntN(50000)
+		result = types.DataExportResult{
+			FilePath:    fmt.Sprintf("file:///exports/%s.csv.gz", job.ID),
+			FileSize:    int64(rows * 12),
+			RowCount:    rows,
+			Format:      "csv",
+			Compression: "gzip",
+		}
+	}
+
+	data, _ := json.Marshal(result)
+	saved := &storage.JobResult{JobID: job.ID, Result: data, Size: len(data), CreatedAt: finished}
+	if g.resultTTL > 0 {
+		expires := finished.Add(g.resultTTL)
+		saved.ExpiresAt = &expires
+	}
+	return saved
+}
+
+// worker makes up the nth worker. The first ones are busy or idle; the
+// last is offline, last seen when it stopped an hour ago.
+func (g *seeder) worker(n int) *types.Worker {
+	w := &types.Worker{
+		ID:          fmt.Sprintf("seed-worker-%d", n),
+		Status:      types.WorkerStatusIdle,
+		LastSeen:    g.now,
+		Concurrency: 4,
+	}
+	for _, t := range seedJobTypes {
+		w.JobTypes = append(w.JobTypes, t.jobType)
+	}
+	switch {
+	case n > 1 && n == g.workers:
+		w.Status, w.LastSeen = types.WorkerStatusOffline, g.now.Add(-time.Hour)
+	case n%2 == 1:
+		w.Status = types.WorkerStatusProcessing
+	}
+	return w
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+
+	"taskflow/internal/alerting"
+	"taskflow/internal/api"
+	"taskflow/internal/blobstore"
+	"taskflow/internal/coordinator"
+	"taskflow/internal/ingest"
+	"taskflow/internal/jobstate"
+	"taskflow/internal/quota"
+	"taskflow/internal/ratelimit"
+	"taskflow/internal/signing"
+	"taskflow/internal/stats"
+	"taskflow/internal/tenant"
+
+	"github.com/google/uuid"
+)
+
+// newLimiter creates the API rate limiter, sharing counters through Redis
+// when the queue uses it
+func (a *app) newLimiter() *ratelimit.Limiter {
+	if a.redisClient != nil {
+		return ratelimit.NewLimiter(a.redisClient, a.cfg.RateLimits)
+	}
+	return ratelimit.NewMemoryLimiter(a.cfg.RateLimits)
+}
+
+// newCoordinator creates the coordinator of maintenance loops that must
+// run on one API server at a time. Without Redis there is nothing to elect
+// through, so every server runs them.
+func (a *app) newCoordinator() *coordinator.Coordinator {
+	host, _ := os.Hostname()
+	id := fmt.Sprintf("%s-%s", host, uuid.New().String()[:8])
+
+	var elector coordinator.Elector = coordinator.LocalElector{}
+	if a.redisClient != nil {
+		elector = coordinator.NewRedisElector(a.redisClient)
+	}
+	return coordinator.New(elector, id, a.cfg.Server.LeaderLeaseTTL)
+}
+
+// runServer serves the API until ctx is done, then shuts the HTTP server
+// down gracefully
+func (a *app) runServer(ctx context.Context, limiter *ratelimit.Limiter) error {
+	cfg, log := a.cfg, a.log
+
+	// Load tenants (optional)
+	tenants, err := tenant.LoadRegistry(cfg.Server.TenantsFile)
+	if err != nil {
+		return fmt.Errorf("failed to load tenants: %w", err)
+	}
+	if tenants.Enabled() {
+		log.Infof("✓ Multi-tenancy enabled (%s)", cfg.Server.TenantsFile)
+	}
+
+	backpressure := api.BackpressureConfig{
+		HighWatermark: cfg.Backpressure.HighWatermark,
+		Mode:          cfg.Backpressure.Mode,
+		RetryAfter:    cfg.Backpressure.RetryAfter,
+	}
+	if backpressure.HighWatermark > 0 {
+		log.Infof("✓ Backpressure above %d pending jobs (%s)", backpressure.HighWatermark, backpressure.Mode)
+	}
+
+	// Offload large payloads to the blob store (optional)
+	var offloader *blobstore.PayloadOffloader
+	var results *blobstore.ResultOffloader
+	if a.blobStore != nil {
+		offloader = blobstore.NewPayloadOffloader(a.blobStore, cfg.Payloads.OffloadThreshold, a.cipher)
+		results = blobstore.NewResultOffloader(a.blobStore, 0, a.cipher)
+		log.Infof("✓ Offloading payloads over %d bytes to %s", cfg.Payloads.OffloadThreshold, cfg.Payloads.BlobStoreURL)
+	}
+
+	// Run maintenance loops on one API server at a time
+	maintenance := a.newCoordinator()
+	if a.redisClient == nil {
+		log.Warn("Maintenance loops run on every API server without Redis")
+	}
+
+	// Keep stats counters in line with storage and the queues
+	statsEngine := stats.NewEngine(a.queue, a.storage)
+	if cfg.Server.StatsReconcileInterval > 0 {
+		maintenance.Add("stats", func(ctx context.Context) {
+			statsEngine.Run(ctx, cfg.Server.StatsReconcileInterval)
+		})
+	}
+
+	// Measure queue depth and active workers for Prometheus
+	if cfg.Server.MetricsInterval > 0 {
+		go statsEngine.CollectMetrics(ctx, cfg.Server.MetricsInterval)
+	}
+
+	// Repair job state that PostgreSQL and the queue disagree on
+	states := jobstate.NewManager(a.queue, a.storage)
+	if cfg.Server.StateReconcileInterval > 0 {
+		maintenance.Add("jobstate", func(ctx context.Context) {
+			states.Run(ctx, cfg.Server.StateReconcileInterval)
+		})
+	}
+
+	// Expire waiting jobs that no worker reached before their expiry
+	if cfg.Server.ExpiryInterval > 0 {
+		maintenance.Add("expiry", func(ctx context.Context) {
+			states.RunExpiry(ctx, cfg.Server.ExpiryInterval)
+		})
+	}
+
+	// Evaluate alerting rules and notify through webhook and email jobs
+	var alerts *alerting.Engine
+	if len(cfg.Alerts.Rules) > 0 && cfg.Alerts.Interval > 0 {
+		alerts = alerting.NewEngine(cfg.Alerts.Rules,
+			alerting.NewQueueSource(a.queue, a.storage),
+			alerting.NewJobNotifier(a.queue, a.storage, a.eventBus))
+		maintenance.Add("alerts", func(ctx context.Context) {
+			alerts.Run(ctx, cfg.Alerts.Interval)
+		})
+		log.Infof("✓ Evaluating %d alert rules every %v", len(cfg.Alerts.Rules), cfg.Alerts.Interval)
+	}
+
+	// Verify signed job submissions, remembering used signatures in Redis
+	// so that a request can't be replayed against another API server
+	var nonces signing.NonceStore = signing.NewMemoryNonceStore()
+	if a.redisClient != nil {
+		nonces = signing.NewRedisNonceStore(a.redisClient)
+	}
+	if cfg.Server.SigningSecret != "" {
+		log.Info("✓ Job submissions must be signed")
+	}
+
+	if len(cfg.RateLimits) > 0 {
+		log.Infof("✓ Rate limiting requests per client (%v)", cfg.RateLimits)
+	}
+
+	// Initialize API server
+	serverOpts := []api.ServerOption{
+		api.WithEventBus(a.eventBus),
+		api.WithMaxPayloadBytes(cfg.Payloads.MaxBytes),
+		api.WithMaxRequestBytes(int64(cfg.Payloads.MaxRequestBytes)),
+		api.WithPayloadOffloader(offloader),
+		api.WithResultStore(results),
+		api.WithTenants(tenants),
+		api.WithAutoscale(autoscaleConfig(cfg)),
+		api.WithBackpressure(backpressure),
+		api.WithStatsEngine(statsEngine),
+		api.WithRequestSigning(signing.NewVerifier(nonces), cfg.Server.SigningSecret),
+		api.WithRateLimiter(limiter),
+		api.WithBreakers(a.breakers...),
+		api.WithAlerts(alerts),
+		api.WithJobCache(cfg.Server.JobCacheTTL, cfg.Server.JobCacheSize),
+	}
+	if a.redisClient != nil {
+		globalQuota := quota.Limits(cfg.Quotas.Global)
+		tenantQuota := quota.Limits(cfg.Quotas.Tenant)
+		serverOpts = append(serverOpts, api.WithQuotas(quota.NewManager(a.redisClient, globalQuota, tenantQuota)))
+	} else {
+		log.Info("Quotas are disabled without Redis")
+	}
+	server := api.NewServer(a.queue, a.storage, serverOpts...)
+
+	// Drop cached jobs as workers and reconciliation change them
+	go server.WatchJobUpdates(ctx)
+
+	// Pick up payload schemas registered through other API servers
+	if cfg.Server.SchemaSyncInterval > 0 {
+		go server.SyncSchemas(ctx, cfg.Server.SchemaSyncInterval)
+	}
+
+	// Delete expired job results
+	if cfg.Results.SweepInterval > 0 {
+		maintenance.Add("results", func(ctx context.Context) {
+			server.SweepResults(ctx, cfg.Results.SweepInterval)
+		})
+	}
+
+	// Delete expired jobs and keep job partitions ready
+	if cfg.Database.MaintenanceInterval > 0 {
+		retention := api.JobRetention{
+			Keep:            cfg.Database.JobRetention,
+			PartitionsAhead: cfg.Database.JobPartitionsAhead,
+		}
+		maintenance.Add("retention", func(ctx context.Context) {
+			server.MaintainJobs(ctx, cfg.Database.MaintenanceInterval, retention)
+		})
+	}
+	go maintenance.Run(ctx)
+	log.Infof("✓ Campaigning to run maintenance loops as %s", maintenance.ID())
+
+	// Create jobs from a Kafka topic (optional)
+	if cfg.Ingest.Brokers != "" {
+		ingestConfig := ingest.Config{
+			Brokers: cfg.Ingest.Brokers,
+			Topic:   cfg.Ingest.Topic,
+			GroupID: cfg.Ingest.GroupID,
+		}
+		consumer, err := ingest.NewKafkaConsumer(ingestConfig, a.queue, a.storage,
+			ingest.WithEventBus(a.eventBus),
+			ingest.WithPayloadOffloader(offloader),
+			ingest.WithTenants(tenants),
+			ingest.WithMaxPayloadBytes(cfg.Payloads.MaxBytes),
+		)
+		if err != nil {
+			return fmt.Errorf("failed to create Kafka ingestion: %w", err)
+		}
+		defer consumer.Close()
+
+		go func() {
+			if err := consumer.Run(ctx); err != nil && err != context.Canceled {
+				log.WithError(err).Fatal("Kafka ingestion stopped")
+			}
+		}()
+		log.Infof("✓ Ingesting jobs from Kafka topic %s", cfg.Ingest.Topic)
+	}
+
+	// Create HTTP server
+	httpServer := &http.Server{
+		Addr:         cfg.Server.Addr,
+		Handler:      server,
+		ReadTimeout:  cfg.Server.ReadTimeout,
+		WriteTimeout: cfg.Server.WriteTimeout,
+		IdleTimeout:  cfg.Server.IdleTimeout,
+	}
+
+	// Start server in a goroutine
+	failed := make(chan error, 1)
+	go func() {
+		log.Infof("TaskFlow API Server listening on %s", cfg.Server.Addr)
+		log.Infof("Health check: http://%s/api/v1/health", cfg.Server.Addr)
+		log.Infof("Readiness: http://%s/readyz", cfg.Server.Addr)
+		log.Infof("API docs will be available at: http://%s/api/v1/", cfg.Server.Addr)
+
+		if err := httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			failed <- err
+		}
+	}()
+
+	select {
+	case <-ctx.Done():
+	case err := <-failed:
+		return fmt.Errorf("server failed to start: %w", err)
+	}
+
+	log.Info("Shutting down server...")
+
+	// Graceful shutdown with timeout
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+	defer cancel()
+
+	if err := httpServer.Shutdown(shutdownCtx); err != nil {
+		log.WithError(err).Warn("Server forced to shutdown")
+	}
+
+	log.Info("Server shutdown complete")
+	return nil
+}
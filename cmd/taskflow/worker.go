@@ -0,0 +1,256 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"taskflow/internal/blobstore"
+	"taskflow/internal/breaker"
+	"taskflow/internal/emailtemplate"
+	"taskflow/internal/metrics"
+	"taskflow/internal/notify"
+	"taskflow/internal/queue"
+	"taskflow/internal/redact"
+	"taskflow/internal/tenant"
+	"taskflow/internal/types"
+	"taskflow/internal/webhookauth"
+	"taskflow/internal/worker"
+)
+
+// runWorker processes jobs until ctx is done, then drains in-flight jobs.
+// It also returns once the worker stops on its own after a remote shutdown
+// command.
+func (a *app) runWorker(ctx context.Context) error {
+	cfg, log := a.cfg, a.log
+	a.logWorkerConfig()
+
+	// Restore offloaded payloads and offload large results (optional)
+	var offloader *blobstore.PayloadOffloader
+	var results *blobstore.ResultOffloader
+	if a.blobStore != nil {
+		offloader = blobstore.NewPayloadOffloader(a.blobStore, 0, a.cipher)
+		results = blobstore.NewResultOffloader(a.blobStore, cfg.Results.OffloadThreshold, a.cipher)
+	}
+
+	resultTTLs, err := worker.ParseResultTTLs(cfg.Results.TTLByType)
+	if err != nil {
+		return fmt.Errorf("invalid RESULT_TTL_BY_TYPE: %w", err)
+	}
+
+	// Redaction rules for payloads in logs and stored results (optional)
+	redactor, err := redact.Parse(cfg.Redaction.Paths)
+	if err != nil {
+		return fmt.Errorf("invalid REDACT_PATHS: %w", err)
+	}
+	resultRedactor, err := redact.Parse(cfg.Redaction.ResultPaths)
+	if err != nil {
+		return fmt.Errorf("invalid REDACT_RESULT_PATHS: %w", err)
+	}
+
+	// Run only the job types this worker is meant to, configured from the
+	// processors section
+	jobTypes, err := worker.ParseJobTypes(cfg.Worker.JobTypes)
+	if err != nil {
+		return fmt.Errorf("invalid WORKER_JOB_TYPES: %w", err)
+	}
+	processors, err := worker.NewProcessorRegistry(cfg.Processors, jobTypes...)
+	if err != nil {
+		return fmt.Errorf("invalid processor settings: %w", err)
+	}
+	processorOpts := []worker.Option{worker.WithProcessors(processors)}
+
+	if processors.Enabled(types.JobTypeEmail) {
+		templates, err := a.emailTemplates(ctx)
+		if err != nil {
+			return err
+		}
+		processorOpts = append(processorOpts, worker.WithEmailTemplates(templates))
+	}
+	if processors.Enabled(types.JobTypeDataExport) {
+		exports, err := a.exportProcessor(ctx)
+		if err != nil {
+			return err
+		}
+		processorOpts = append(processorOpts, worker.WithProcessor(exports))
+	}
+	if processors.Enabled(types.JobTypeWebhook) {
+		webhooks, err := a.webhookProcessor()
+		if err != nil {
+			return err
+		}
+		metrics.RegisterPool("webhook", webhooks.PoolStats)
+		processorOpts = append(processorOpts, worker.WithProcessor(webhooks))
+	}
+
+	// Post jobs that fail for good to the chat webhooks of their type
+	failures := notify.NewFailureNotifier(types.DefaultJobTypes, notify.WithDashboardURL(cfg.Worker.DashboardURL))
+
+	// A single worker runs a pool of executors sharing one queue consumer,
+	// heartbeat and registration
+	opts := []worker.Option{
+		worker.WithConcurrency(cfg.Worker.Count),
+		worker.WithPollInterval(cfg.Worker.PollInterval),
+		worker.WithJobTimeout(cfg.Worker.Timeout),
+		worker.WithDrainTimeout(cfg.Worker.DrainTimeout),
+		worker.WithEventBus(a.eventBus),
+		worker.WithPayloadOffloader(offloader),
+		worker.WithResultStore(results),
+		worker.WithResultTTLs(worker.ResultTTLs{Default: cfg.Results.TTL, ByType: resultTTLs}),
+		worker.WithRedactor(redactor),
+		worker.WithResultRedactor(resultRedactor),
+		worker.WithFailureNotifier(failures),
+		worker.WithLocker(a.newLocker()),
+		worker.WithTargetBreakers(breaker.Config{
+			FailureThreshold: cfg.Worker.TargetFailureThreshold,
+			OpenTimeout:      cfg.Worker.TargetOpenTimeout,
+		}),
+	}
+	w := worker.NewWorker(a.queue, a.storage, append(opts, processorOpts...)...)
+
+	// List in-flight jobs on /debug/status
+	a.debug.Publish("worker", func() interface{} { return w.DebugStatus() })
+
+	// The worker outlives ctx while it drains
+	runCtx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		if err := w.Start(runCtx); err != nil && err != context.Canceled {
+			log.WithError(err).Errorf("Worker %s stopped with error", w.ID)
+		}
+	}()
+
+	log.Infof("Started worker %s with %d executors", w.ID, cfg.Worker.Count)
+
+	// Wait for shutdown, or for the worker to stop on its own after a
+	// remote shutdown command
+	select {
+	case <-ctx.Done():
+	case <-stopped:
+		log.Info("Worker shut down")
+		return nil
+	}
+
+	log.Infof("Draining worker (timeout %v)...", cfg.Worker.DrainTimeout)
+
+	// Stop dequeueing and let in-flight jobs finish; anything still running
+	// at the deadline is aborted and requeued
+	drainCtx, drainCancel := context.WithTimeout(context.Background(), cfg.Worker.DrainTimeout)
+	defer drainCancel()
+
+	if err := w.Shutdown(drainCtx); err != nil {
+		log.WithError(err).Warnf("Worker %s did not drain cleanly", w.ID)
+	}
+
+	cancel()
+	<-stopped
+
+	log.Info("Worker shut down")
+	return nil
+}
+
+// emailTemplates renders email templates stored in PostgreSQL, or kept as
+// files
+func (a *app) emailTemplates(ctx context.Context) (*emailtemplate.Renderer, error) {
+	var templates emailtemplate.Source = a.storage
+	if url := a.cfg.Worker.EmailTemplatesURL; url != "" {
+		var err error
+		if templates, err = emailtemplate.OpenBlobSource(ctx, url); err != nil {
+			return nil, fmt.Errorf("invalid EMAIL_TEMPLATES_URL: %w", err)
+		}
+	}
+	return emailtemplate.NewRenderer(templates, 0), nil
+}
+
+// exportProcessor creates the data export processor. Exports are limited
+// to the tables their tenant may read when multi-tenancy is enabled, and
+// streamed to object storage if a store is set.
+func (a *app) exportProcessor(ctx context.Context) (*worker.DataExportProcessor, error) {
+	cfg := a.cfg
+	tenants, err := tenant.LoadRegistry(cfg.Server.TenantsFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load tenants: %w", err)
+	}
+	opts := []worker.DataExportOption{
+		worker.WithExportTables(tenants.ExportTables()),
+		worker.WithExportLimits(cfg.Worker.ExportQueryTimeout, cfg.Worker.ExportMaxRows),
+	}
+
+	if cfg.Worker.ExportStoreURL != "" {
+		store, err := blobstore.Open(ctx, cfg.Worker.ExportStoreURL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid EXPORT_STORE_URL: %w", err)
+		}
+		opts = append(opts, worker.WithExportStore(store, cfg.Worker.ExportURLTTL))
+	}
+	return worker.NewDataExportProcessor(opts...), nil
+}
+
+// webhookProcessor creates the webhook processor, which signs webhooks,
+// authenticates them with the configured credentials and keeps them, as
+// their URLs come from users, off internal networks
+func (a *app) webhookProcessor() (*worker.WebhookProcessor, error) {
+	cfg := a.cfg
+	webhookAuth, err := webhookauth.New(cfg.Webhooks.SigningSecret, cfg.Webhooks.Credentials)
+	if err != nil {
+		return nil, fmt.Errorf("invalid webhook credentials: %w", err)
+	}
+
+	allowedNetworks, err := worker.ParseNetworks(cfg.Webhooks.AllowedNetworks)
+	if err != nil {
+		return nil, fmt.Errorf("invalid WEBHOOK_ALLOWED_NETWORKS: %w", err)
+	}
+	policy := worker.WebhookPolicy{
+		MaxResponseBytes: int64(cfg.Webhooks.MaxResponseBytes),
+		MaxRedirects:     cfg.Webhooks.MaxRedirects,
+		GuardNetworks:    true,
+		AllowedNetworks:  allowedNetworks,
+
+		MaxIdleConnsPerHost: cfg.Webhooks.MaxIdleConnsPerHost,
+		IdleConnTimeout:     cfg.Webhooks.IdleConnTimeout,
+	}
+	proxy, _ := cfg.Processors.Webhook.Proxy() // checked with the config
+	return worker.NewWebhookProcessor(worker.WithAuthenticator(webhookAuth), worker.WithPolicy(policy), worker.WithProxy(proxy)), nil
+}
+
+// logWorkerConfig logs the settings the worker starts with
+func (a *app) logWorkerConfig() {
+	cfg, log := a.cfg, a.log
+	log.Info("Worker configuration:")
+	log.Infof("  Concurrency: %d", cfg.Worker.Count)
+	if cfg.Queue.Backend == queue.BackendSQS {
+		log.Infof("  SQS: %s*", cfg.Queue.SQS.QueuePrefix)
+	} else {
+		log.Infof("  Redis: %s (%s)", cfg.Redis.Addr, cfg.Redis.Mode)
+	}
+	log.Infof("  Database: %s (pool: %d)", cfg.Database.URL, cfg.Database.MaxOpenConns)
+	log.Infof("  Poll interval: %v", cfg.Worker.PollInterval)
+	if cfg.Worker.Timeout > 0 {
+		log.Infof("  Job timeout: %v", cfg.Worker.Timeout)
+	}
+	log.Infof("  Drain timeout: %v", cfg.Worker.DrainTimeout)
+	if cfg.Results.TTL > 0 || cfg.Results.TTLByType != "" {
+		log.Infof("  Result TTL: %v (%s)", cfg.Results.TTL, cfg.Results.TTLByType)
+	}
+	if cfg.Redaction.Paths != "" || cfg.Redaction.ResultPaths != "" {
+		log.Infof("  Redacting: %s (results: %s)", cfg.Redaction.Paths, cfg.Redaction.ResultPaths)
+	}
+	if cfg.Worker.ExportStoreURL != "" {
+		log.Infof("  Export store: %s", cfg.Worker.ExportStoreURL)
+	}
+	log.Infof("  Export limits: %v query, %d rows", cfg.Worker.ExportQueryTimeout, cfg.Worker.ExportMaxRows)
+	if cfg.Processors.Email.SMTPHost != "" {
+		log.Infof("  SMTP: %s:%d", cfg.Processors.Email.SMTPHost, cfg.Processors.Email.SMTPPort)
+	}
+	if cfg.Worker.JobTypes != "" {
+		log.Infof("  Job types: %s", cfg.Worker.JobTypes)
+	}
+	if proxy, _ := cfg.Processors.Webhook.Proxy(); proxy != nil {
+		log.Infof("  Webhook proxy: %s", proxy.Redacted())
+	}
+	if cfg.Webhooks.AllowedNetworks != "" {
+		log.Infof("  Webhook private networks: %s", cfg.Webhooks.AllowedNetworks)
+	}
+}
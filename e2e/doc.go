@@ -0,0 +1,5 @@
+// Package e2e holds end-to-end tests of the job flow across components:
+// jobs are submitted to the API server, processed by a worker and read
+// back, with Redis and PostgreSQL provided by testutil. The package has no
+// code of its own.
+package e2e
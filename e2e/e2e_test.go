@@ -0,0 +1,325 @@
+package e2e
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"taskflow/internal/api"
+	"taskflow/internal/queue"
+	"taskflow/internal/storage"
+	"taskflow/internal/testutil"
+	"taskflow/internal/types"
+	"taskflow/internal/worker"
+	"testing"
+	"time"
+)
+
+// jobTimeout bounds how long a submitted job may take to finish
+const jobTimeout = 30 * time.Second
+
+func TestMain(m *testing.M) {
+	os.Exit(testutil.Run(m))
+}
+
+// stack is an API server and a worker sharing a queue and storage
+type stack struct {
+	url     string
+	queue   queue.Queue
+	storage storage.Storage
+}
+
+// newStack starts an API server and a worker on the test Redis and
+// PostgreSQL, and stops them when the test finishes
+func newStack(t *testing.T) *stack {
+	t.Helper()
+	redisAddr := testutil.Redis(t).Options().Addr
+	databaseURL := testutil.Postgres(t)
+
+	store, err := storage.NewPostgresStorage(databaseURL)
+	if err != nil {
+		t.Fatalf("NewPostgresStorage: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+
+	q := queue.NewRedisQueue(redisAddr, "", 0)
+	t.Cleanup(func() { q.Close() })
+
+	srv := httptest.NewServer(api.NewServer(q, store))
+	t.Cleanup(srv.Close)
+
+	w := worker.NewWorker(q, store,
+		worker.WithConcurrency(8),
+		worker.WithPollInterval(100*time.Millisecond),
+		worker.WithDrainTimeout(5*time.Second),
+	)
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan error, 1)
+	go func() { stopped <- w.Start(ctx) }()
+	t.Cleanup(func() {
+		shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer shutdownCancel()
+		w.Shutdown(shutdownCtx)
+		cancel()
+		if err := <-stopped; err != nil && err != context.Canceled {
+			t.Errorf("worker stopped with %v", err)
+		}
+	})
+
+	return &stack{url: srv.URL, queue: q, storage: store}
+}
+
+// submit creates a job through the API and returns it
+func (s *stack) submit(t *testing.T, req types.JobRequest) *types.Job {
+	t.Helper()
+	body, err := json.Marshal(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.Post(s.url+"/api/v1/jobs", "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("POST /jobs: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("POST /jobs = %s", resp.Status)
+	}
+
+	var created types.JobResponse
+	if err := json.NewDecoder(resp.Body).Decode(&created); err != nil {
+		t.Fatalf("failed to decode created job: %v", err)
+	}
+	return created.Job
+}
+
+// await long-polls a job through the API until it finishes
+func (s *stack) await(t *testing.T, jobID string) *types.Job {
+	t.Helper()
+	deadline := time.Now().Add(jobTimeout)
+	for {
+		resp, err := http.Get(s.url + "/api/v1/jobs/" + jobID + "?wait=5s")
+		if err != nil {
+			t.Fatalf("GET /jobs/%s: %v", jobID, err)
+		}
+		var got types.JobResponse
+		err = json.NewDecoder(resp.Body).Decode(&got)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatalf("failed to decode job %s: %v", jobID, err)
+		}
+
+		if got.Job.Status.IsFinal() {
+			return got.Job
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("job %s is still %s after %v", jobID, got.Job.Status, jobTimeout)
+		}
+	}
+}
+
+// result reads a job's result through the API, or returns nil if it has
+// none
+func (s *stack) result(t *testing.T, jobID string) map[string]interface{} {
+	t.Helper()
+	resp, err := http.Get(s.url + "/api/v1/jobs/" + jobID + "/result")
+	if err != nil {
+		t.Fatalf("GET /jobs/%s/result: %v", jobID, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET /jobs/%s/result = %s", jobID, resp.Status)
+	}
+
+	var result map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Fatalf("failed to decode result of job %s: %v", jobID, err)
+	}
+	return result
+}
+
+// jobsTotal scrapes taskflow_jobs_total for a job type and final status
+// from the API server's /metrics
+func (s *stack) jobsTotal(t *testing.T, jobType types.JobType, status types.JobStatus) float64 {
+	t.Helper()
+	resp, err := http.Get(s.url + "/metrics")
+	if err != nil {
+		t.Fatalf("GET /metrics: %v", err)
+	}
+	defer resp.Body.Close()
+
+	series := fmt.Sprintf(`taskflow_jobs_total{status=%q,type=%q} `, status, jobType)
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		if value, ok := strings.CutPrefix(scanner.Text(), series); ok {
+			total, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				t.Fatalf("failed to parse %s: %v", scanner.Text(), err)
+			}
+			return total
+		}
+	}
+	return 0
+}
+
+// checkConsistent checks that PostgreSQL and Redis agree on a finished job
+func (s *stack) checkConsistent(t *testing.T, job *types.Job) {
+	t.Helper()
+	ctx := context.Background()
+	stored, err := s.storage.GetJob(ctx, job.ID)
+	if err != nil {
+		t.Fatalf("failed to read job %s from PostgreSQL: %v", job.ID, err)
+	}
+	queued, err := s.queue.GetJob(ctx, job.ID)
+	if err != nil {
+		t.Fatalf("failed to read job %s from Redis: %v", job.ID, err)
+	}
+
+	for _, c := range []struct {
+		name string
+		job  *types.Job
+	}{{"PostgreSQL", stored}, {"Redis", queued}} {
+		got := c.job
+		if got.Status != job.Status || got.Attempts != job.Attempts || got.ErrorCode != job.ErrorCode {
+			t.Errorf("%s has job %s %s after %d attempts with code %q, want %s after %d with %q", c.name,
+				job.ID, got.Status, got.Attempts, got.ErrorCode, job.Status, job.Attempts, job.ErrorCode)
+		}
+	}
+}
+
+func TestJobFlow(t *testing.T) {
+	s := newStack(t)
+
+	// The webhook receiver answers 500 to /fail
+	received := make(chan string, 10)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- r.URL.Path
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Write([]byte(`{"ok": true}`))
+	}))
+	defer receiver.Close()
+
+	exportPath := filepath.Join(t.TempDir(), "orders")
+
+	tests := []struct {
+		name     string
+		req      types.JobRequest
+		needs    string // a binary the processor needs
+		status   types.JobStatus
+		code     types.ErrorCode
+		attempts int // failed attempts
+		checkFn  func(t *testing.T, result map[string]interface{})
+	}{
+		{
+			name:   "email",
+			req:    types.JobRequest{Type: types.JobTypeEmail, Payload: json.RawMessage(`{"to": "user@example.com", "subject": "Hi", "body": "Hello"}`)},
+			status: types.JobStatusCompleted,
+			checkFn: func(t *testing.T, result map[string]interface{}) {
+				if result["message_id"] == "" || result["message_id"] == nil {
+					t.Errorf("result = %v, want a message ID", result)
+				}
+			},
+		},
+		{
+			name:   "image resize",
+			req:    types.JobRequest{Type: types.JobTypeImageResize, Payload: json.RawMessage(`{"image_url": "https://example.com/cat.jpg", "sizes": [100, 300]}`)},
+			needs:  "ffmpeg",
+			status: types.JobStatusCompleted,
+			checkFn: func(t *testing.T, result map[string]interface{}) {
+				if images, _ := result["images"].([]interface{}); len(images) == 0 {
+					t.Errorf("result = %v, want resized images", result)
+				}
+			},
+		},
+		{
+			name:   "webhook",
+			req:    types.JobRequest{Type: types.JobTypeWebhook, Payload: json.RawMessage(fmt.Sprintf(`{"url": %q, "method": "POST"}`, receiver.URL+"/ok"))},
+			status: types.JobStatusCompleted,
+			checkFn: func(t *testing.T, result map[string]interface{}) {
+				if result["status_code"] != float64(http.StatusOK) {
+					t.Errorf("result = %v, want status code 200", result)
+				}
+			},
+		},
+		{
+			name:   "data export",
+			req:    types.JobRequest{Type: types.JobTypeDataExport, Payload: json.RawMessage(fmt.Sprintf(`{"export_type": "csv", "query": "SELECT id FROM orders", "output_path": %q}`, exportPath))},
+			status: types.JobStatusCompleted,
+			checkFn: func(t *testing.T, result map[string]interface{}) {
+				path, _ := result["file_path"].(string)
+				if _, err := os.Stat(path); err != nil || result["format"] != "csv" {
+					t.Errorf("result = %v, want a csv export on disk: %v", result, err)
+				}
+			},
+		},
+		{
+			name:     "failing webhook",
+			req:      types.JobRequest{Type: types.JobTypeWebhook, MaxAttempts: 1, Payload: json.RawMessage(fmt.Sprintf(`{"url": %q}`, receiver.URL+"/fail"))},
+			status:   types.JobStatusFailed,
+			code:     types.ErrorCodeDownstream5xx,
+			attempts: 1,
+		},
+	}
+
+	t.Run("group", func(t *testing.T) {
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				if tt.needs != "" {
+					if _, err := exec.LookPath(tt.needs); err != nil {
+						t.Skipf("%s jobs need %s", tt.req.Type, tt.needs)
+					}
+				}
+				t.Parallel()
+
+				finishedBefore := s.jobsTotal(t, tt.req.Type, tt.status)
+				job := s.await(t, s.submit(t, tt.req).ID)
+
+				if job.Status != tt.status || job.ErrorCode != tt.code {
+					t.Fatalf("job finished %s with code %q (%s), want %s with %q", job.Status, job.ErrorCode, job.Error, tt.status, tt.code)
+				}
+				if job.Attempts != tt.attempts {
+					t.Errorf("job has %d failed attempts, want %d", job.Attempts, tt.attempts)
+				}
+
+				result := s.result(t, job.ID)
+				switch {
+				case tt.checkFn != nil && result == nil:
+					t.Error("Expected the job to have a result")
+				case tt.checkFn != nil:
+					tt.checkFn(t, result)
+				case result != nil:
+					t.Errorf("result = %v, want none", result)
+				}
+
+				s.checkConsistent(t, job)
+
+				if finished := s.jobsTotal(t, tt.req.Type, tt.status); finished < finishedBefore+1 {
+					t.Errorf("taskflow_jobs_total = %v, want at least %v", finished, finishedBefore+1)
+				}
+			})
+		}
+	})
+
+	// Each webhook reached the receiver once
+	close(received)
+	calls := make(map[string]int)
+	for path := range received {
+		calls[path]++
+	}
+	if calls["/ok"] != 1 || calls["/fail"] != 1 {
+		t.Errorf("webhook calls = %v, want one to each path", calls)
+	}
+}
@@ -0,0 +1,177 @@
+package alerting
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// State is the state of a rule's alert
+type State string
+
+const (
+	// StateOK means the condition doesn't hold
+	StateOK State = "ok"
+	// StatePending means the condition holds but not yet for long enough
+	StatePending State = "pending"
+	// StateFiring means the condition has held for the rule's For
+	StateFiring State = "firing"
+)
+
+// Alert is the current state of one rule
+type Alert struct {
+	Rule        Rule       `json:"rule"`
+	State       State      `json:"state"`
+	Value       float64    `json:"value"`
+	Since       *time.Time `json:"since,omitempty"` // when the condition started to hold
+	FiredAt     *time.Time `json:"fired_at,omitempty"`
+	ResolvedAt  *time.Time `json:"resolved_at,omitempty"`
+	EvaluatedAt *time.Time `json:"evaluated_at,omitempty"`
+	Error       string     `json:"error,omitempty"` // why the last evaluation failed
+}
+
+// Message describes the alert for people
+func (a *Alert) Message() string {
+	scope := "all job types"
+	if a.Rule.JobType != "" {
+		scope = string(a.Rule.JobType)
+	}
+	if a.State != StateFiring {
+		return fmt.Sprintf("[RESOLVED] %s: %s for %s is %.4g, back under %.4g",
+			a.Rule.Name, a.Rule.Condition, scope, a.Value, a.Rule.Threshold)
+	}
+	return fmt.Sprintf("[FIRING] %s: %s for %s is %.4g, above %.4g for %v",
+		a.Rule.Name, a.Rule.Condition, scope, a.Value, a.Rule.Threshold, a.Rule.For)
+}
+
+// Source measures a rule's condition
+type Source interface {
+	Measure(ctx context.Context, rule Rule) (float64, error)
+}
+
+// Notifier delivers a notification that an alert fired or resolved
+type Notifier interface {
+	Notify(ctx context.Context, alert Alert) error
+}
+
+// Engine evaluates rules periodically and keeps the state of their alerts
+// in memory
+type Engine struct {
+	source   Source
+	notifier Notifier
+	now      func() time.Time
+
+	mu     sync.Mutex
+	alerts []*Alert // in rule order
+}
+
+// NewEngine creates an engine for rules, which must be valid
+func NewEngine(rules []Rule, source Source, notifier Notifier) *Engine {
+	e := &Engine{source: source, notifier: notifier, now: time.Now}
+	for _, rule := range rules {
+		e.alerts = append(e.alerts, &Alert{Rule: rule, State: StateOK})
+	}
+	return e
+}
+
+// Run evaluates the rules every interval until ctx is done
+func (e *Engine) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		e.Evaluate(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Evaluate measures every rule once and notifies about alerts that fired
+// or resolved
+func (e *Engine) Evaluate(ctx context.Context) {
+	for i := range e.alerts {
+		rule := e.alerts[i].Rule
+		value, err := e.source.Measure(ctx, rule)
+		if err != nil && ctx.Err() != nil {
+			return
+		}
+
+		changed, alert := e.update(i, value, err)
+		if err != nil {
+			log.Printf("Failed to evaluate alert rule %s: %v", rule.Name, err)
+			continue
+		}
+		if !changed {
+			continue
+		}
+
+		log.Print(alert.Message())
+		if err := e.notifier.Notify(ctx, alert); err != nil {
+			log.Printf("Failed to notify about alert %s: %v", rule.Name, err)
+		}
+	}
+}
+
+// update applies a measurement to an alert and reports whether it fired or
+// resolved. A failed measurement leaves the state as it was.
+func (e *Engine) update(i int, value float64, err error) (bool, Alert) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	alert := e.alerts[i]
+	now := e.now()
+	alert.EvaluatedAt = &now
+	if err != nil {
+		alert.Error = err.Error()
+		return false, *alert
+	}
+	alert.Error = ""
+	alert.Value = value
+
+	if value <= alert.Rule.Threshold {
+		wasFiring := alert.State == StateFiring
+		alert.State = StateOK
+		alert.Since = nil
+		if wasFiring {
+			alert.ResolvedAt = &now
+		}
+		return wasFiring, *alert
+	}
+
+	if alert.Since == nil {
+		alert.Since = &now
+	}
+	if alert.State == StateFiring {
+		return false, *alert
+	}
+	if now.Sub(*alert.Since) < alert.Rule.For {
+		alert.State = StatePending
+		return false, *alert
+	}
+
+	alert.State = StateFiring
+	alert.FiredAt = &now
+	alert.ResolvedAt = nil
+	return true, *alert
+}
+
+// Alerts returns the state of every rule, in rule order
+func (e *Engine) Alerts() []Alert {
+	if e == nil {
+		return []Alert{}
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	alerts := make([]Alert, len(e.alerts))
+	for i, alert := range e.alerts {
+		alerts[i] = *alert
+	}
+	return alerts
+}
@@ -0,0 +1,124 @@
+package alerting
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+type fakeSource struct {
+	value float64
+	err   error
+}
+
+func (f *fakeSource) Measure(ctx context.Context, rule Rule) (float64, error) {
+	return f.value, f.err
+}
+
+type fakeNotifier struct {
+	sent []Alert
+}
+
+func (f *fakeNotifier) Notify(ctx context.Context, alert Alert) error {
+	f.sent = append(f.sent, alert)
+	return nil
+}
+
+func TestEngine(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	source := &fakeSource{}
+	notifier := &fakeNotifier{}
+	rule := Rule{Name: "backlog", Condition: PendingDepth, Threshold: 100, For: 5 * time.Minute}
+	engine := NewEngine([]Rule{rule}, source, notifier)
+	engine.now = func() time.Time { return now }
+
+	state := func() Alert {
+		return engine.Alerts()[0]
+	}
+
+	engine.Evaluate(ctx)
+	if state().State != StateOK {
+		t.Fatalf("state under the threshold = %s, want ok", state().State)
+	}
+
+	// Over the threshold, but not yet for long enough
+	source.value = 150
+	engine.Evaluate(ctx)
+	now = now.Add(4 * time.Minute)
+	engine.Evaluate(ctx)
+	if state().State != StatePending || len(notifier.sent) != 0 {
+		t.Fatalf("state after 4m = %s with %d notifications, want pending with none", state().State, len(notifier.sent))
+	}
+
+	// Fires once
+	now = now.Add(time.Minute)
+	engine.Evaluate(ctx)
+	now = now.Add(time.Minute)
+	engine.Evaluate(ctx)
+	if state().State != StateFiring || len(notifier.sent) != 1 || notifier.sent[0].State != StateFiring {
+		t.Fatalf("state after 6m = %s with %+v, want firing with one notification", state().State, notifier.sent)
+	}
+
+	// A failed measurement keeps the state
+	source.err = errors.New("redis down")
+	engine.Evaluate(ctx)
+	if state().State != StateFiring || state().Error == "" {
+		t.Fatalf("state after a failed measurement = %+v, want firing with an error", state())
+	}
+
+	// Resolves once
+	source.err = nil
+	source.value = 10
+	engine.Evaluate(ctx)
+	engine.Evaluate(ctx)
+	if state().State != StateOK || state().ResolvedAt == nil || state().Error != "" {
+		t.Fatalf("state after recovering = %+v, want resolved", state())
+	}
+	if len(notifier.sent) != 2 || notifier.sent[1].State != StateOK {
+		t.Errorf("notifications = %+v, want firing then resolved", notifier.sent)
+	}
+}
+
+func TestEngineDipResetsPending(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	source := &fakeSource{value: 1}
+	notifier := &fakeNotifier{}
+	engine := NewEngine([]Rule{{Name: "failures", Condition: FailureRate, Threshold: 0.5, For: time.Minute}}, source, notifier)
+	engine.now = func() time.Time { return now }
+
+	engine.Evaluate(ctx)
+	source.value = 0
+	now = now.Add(30 * time.Second)
+	engine.Evaluate(ctx)
+	source.value = 1
+	now = now.Add(40 * time.Second)
+	engine.Evaluate(ctx)
+
+	if alert := engine.Alerts()[0]; alert.State != StatePending || len(notifier.sent) != 0 {
+		t.Errorf("state after a dip = %s with %d notifications, want pending with none", alert.State, len(notifier.sent))
+	}
+}
+
+func TestValidate(t *testing.T) {
+	valid := Rule{Name: "backlog", Condition: PendingDepth, Threshold: 100,
+		Notify: []Channel{{Type: ChannelSlack, URL: "https://hooks.slack.com/x"}, {Type: ChannelEmail, To: "ops@example.com"}}}
+	if err := Validate([]Rule{valid}); err != nil {
+		t.Fatalf("Validate(valid) = %v", err)
+	}
+
+	tests := map[string][]Rule{
+		"duplicate name":    {valid, valid},
+		"unknown condition": {{Name: "x", Condition: "latency"}},
+		"negative":          {{Name: "x", Condition: FailureRate, Threshold: -1}},
+		"email without to":  {{Name: "x", Condition: PendingDepth, Notify: []Channel{{Type: ChannelEmail}}}},
+		"unknown channel":   {{Name: "x", Condition: PendingDepth, Notify: []Channel{{Type: "pager", URL: "x"}}}},
+	}
+	for name, rules := range tests {
+		if err := Validate(rules); err == nil {
+			t.Errorf("Validate(%s) = nil, want an error", name)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package alerting
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"taskflow/internal/events"
+	"taskflow/internal/queue"
+	"taskflow/internal/storage"
+	"taskflow/internal/types"
+)
+
+// JobNotifier sends notifications as webhook and email jobs, so that the
+// processors deliver them and retry them like any other job
+type JobNotifier struct {
+	queue   queue.Queue
+	storage storage.Storage
+	events  *events.Bus
+}
+
+// NewJobNotifier creates a notifier that queues jobs on q
+func NewJobNotifier(q queue.Queue, s storage.Storage, bus *events.Bus) *JobNotifier {
+	return &JobNotifier{queue: q, storage: s, events: bus}
+}
+
+// Notify creates a job for each of the alert rule's channels
+func (n *JobNotifier) Notify(ctx context.Context, alert Alert) error {
+	var firstErr error
+	for _, ch := range alert.Rule.Notify {
+		req, err := notification(ch, alert)
+		if err == nil {
+			err = n.enqueue(ctx, req)
+		}
+		if err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("failed to notify %s: %w", ch.Type, err)
+		}
+	}
+	return firstErr
+}
+
+func (n *JobNotifier) enqueue(ctx context.Context, req *types.JobRequest) error {
+	job := types.NewJob(req)
+	if err := n.storage.CreateJob(ctx, job); err != nil {
+		return err
+	}
+	if err := n.queue.EnqueueJob(ctx, job); err != nil {
+		return err
+	}
+	n.events.PublishJob(ctx, events.EventJobCreated, job)
+	return nil
+}
+
+// notification builds the job that notifies ch about alert
+func notification(ch Channel, alert Alert) (*types.JobRequest, error) {
+	var jobType types.JobType
+	var payload interface{}
+	switch ch.Type {
+	case ChannelWebhook:
+		jobType = types.JobTypeWebhook
+		payload = types.WebhookPayload{URL: ch.URL, Method: "POST", Data: alert}
+	case ChannelSlack:
+		jobType = types.JobTypeWebhook
+		payload = types.WebhookPayload{URL: ch.URL, Method: "POST", Data: map[string]string{"text": alert.Message()}}
+	case ChannelEmail:
+		jobType = types.JobTypeEmail
+		payload = types.EmailPayload{To: ch.To, Subject: subject(alert), Body: alert.Message()}
+	default:
+		return nil, fmt.Errorf("unknown channel type %q", ch.Type)
+	}
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	return &types.JobRequest{Type: jobType, Payload: data, Priority: types.JobPriorityHigh}, nil
+}
+
+// subject is the email subject for alert
+func subject(alert Alert) string {
+	if alert.State == StateFiring {
+		return "Alert firing: " + alert.Rule.Name
+	}
+	return "Alert resolved: " + alert.Rule.Name
+}
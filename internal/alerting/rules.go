@@ -0,0 +1,95 @@
+// Package alerting evaluates SLO rules against the queues in-process and
+// sends notifications through ordinary jobs when an alert fires or
+// resolves, so notifications get the job system's retries.
+package alerting
+
+import (
+	"fmt"
+	"taskflow/internal/types"
+	"time"
+)
+
+// Condition names what a rule measures
+type Condition string
+
+const (
+	// PendingDepth is the number of jobs waiting on the pending queues
+	PendingDepth Condition = "pending_depth"
+	// FailureRate is the percentage of jobs finished over the rule's window
+	// that failed
+	FailureRate Condition = "failure_rate"
+	// OldestPendingAge is how long, in seconds, the oldest pending job has
+	// waited
+	OldestPendingAge Condition = "oldest_pending_age"
+)
+
+// defaultWindow is how far back a failure rate is measured by default
+const defaultWindow = 15 * time.Minute
+
+// Rule fires an alert when its condition stays above Threshold for For
+type Rule struct {
+	Name      string        `yaml:"name" toml:"name" json:"name"`
+	Condition Condition     `yaml:"condition" toml:"condition" json:"condition"`
+	JobType   types.JobType `yaml:"job_type" toml:"job_type" json:"job_type,omitempty"` // all types if empty
+	Threshold float64       `yaml:"threshold" toml:"threshold" json:"threshold"`
+	For       time.Duration `yaml:"for" toml:"for" json:"-"`
+	// Window is how far back FailureRate is measured, 15m if zero
+	Window time.Duration `yaml:"window" toml:"window" json:"-"`
+	Notify []Channel     `yaml:"notify" toml:"notify" json:"-"`
+}
+
+// Channel is where a rule's notifications go
+type Channel struct {
+	Type string `yaml:"type" toml:"type"` // "webhook", "slack" or "email"
+	URL  string `yaml:"url" toml:"url"`   // webhook and slack
+	To   string `yaml:"to" toml:"to"`     // email
+}
+
+// Channel types
+const (
+	ChannelWebhook = "webhook"
+	ChannelSlack   = "slack"
+	ChannelEmail   = "email"
+)
+
+// window returns how far back the rule measures its condition
+func (r Rule) window() time.Duration {
+	if r.Window > 0 {
+		return r.Window
+	}
+	return defaultWindow
+}
+
+// Validate checks a set of rules
+func Validate(rules []Rule) error {
+	names := make(map[string]bool, len(rules))
+	for _, rule := range rules {
+		if rule.Name == "" {
+			return fmt.Errorf("alert rule name cannot be empty")
+		}
+		if names[rule.Name] {
+			return fmt.Errorf("duplicate alert rule %s", rule.Name)
+		}
+		names[rule.Name] = true
+
+		switch rule.Condition {
+		case PendingDepth, FailureRate, OldestPendingAge:
+		default:
+			return fmt.Errorf("alert rule %s: invalid condition %q (valid: %s, %s, %s)",
+				rule.Name, rule.Condition, PendingDepth, FailureRate, OldestPendingAge)
+		}
+		if rule.Threshold < 0 || rule.For < 0 || rule.Window < 0 {
+			return fmt.Errorf("alert rule %s: threshold, for and window cannot be negative", rule.Name)
+		}
+
+		for _, ch := range rule.Notify {
+			switch {
+			case (ch.Type == ChannelWebhook || ch.Type == ChannelSlack) && ch.URL != "":
+			case ch.Type == ChannelEmail && ch.To != "":
+			default:
+				return fmt.Errorf("alert rule %s: notify needs a webhook or slack channel with a url, or an email with a to address", rule.Name)
+			}
+		}
+	}
+	return nil
+}
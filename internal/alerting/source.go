@@ -0,0 +1,74 @@
+package alerting
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"taskflow/internal/queue"
+	"taskflow/internal/storage"
+	"taskflow/internal/types"
+)
+
+// QueueSource measures rules against the queues and the jobs stored in
+// PostgreSQL
+type QueueSource struct {
+	queue   queue.Queue
+	storage storage.Storage
+}
+
+// NewQueueSource creates a source reading q and s
+func NewQueueSource(q queue.Queue, s storage.Storage) *QueueSource {
+	return &QueueSource{queue: q, storage: s}
+}
+
+// Measure returns the current value of a rule's condition
+func (s *QueueSource) Measure(ctx context.Context, rule Rule) (float64, error) {
+	if rule.Condition == FailureRate {
+		return s.failureRate(ctx, rule)
+	}
+
+	jobTypes := types.DefaultSchemas.JobTypes()
+	if rule.JobType != "" {
+		jobTypes = []types.JobType{rule.JobType}
+	}
+	metrics, err := s.queue.GetQueueMetrics(ctx, jobTypes, time.Minute)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get queue metrics: %w", err)
+	}
+
+	// Depth adds up across types, age takes the oldest
+	var value float64
+	for _, m := range metrics {
+		switch rule.Condition {
+		case PendingDepth:
+			value += float64(m.Depth)
+		case OldestPendingAge:
+			value = max(value, m.OldestJobAge.Seconds())
+		}
+	}
+	return value, nil
+}
+
+// failureRate returns the percentage of jobs that finished within the
+// rule's window and failed, or zero if none finished
+func (s *QueueSource) failureRate(ctx context.Context, rule Rule) (float64, error) {
+	now := time.Now()
+	window := rule.window()
+	buckets, err := s.storage.JobTimeseries(ctx, "", string(rule.JobType), now.Add(-window), now, window)
+	if err != nil {
+		return 0, err
+	}
+
+	var completed, failed int
+	for _, b := range buckets {
+		if b.Bucket == -1 {
+			completed += b.Completed
+			failed += b.Failed
+		}
+	}
+	if completed+failed == 0 {
+		return 0, nil
+	}
+	return float64(failed) / float64(completed+failed) * 100, nil
+}
@@ -0,0 +1,31 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"taskflow/internal/alerting"
+	"taskflow/internal/apierror"
+)
+
+// AlertsResponse is the body of GET /api/v1/alerts
+type AlertsResponse struct {
+	Alerts []alerting.Alert `json:"alerts"`
+}
+
+// WithAlerts serves GET /api/v1/alerts from the given engine
+func WithAlerts(engine *alerting.Engine) ServerOption {
+	return func(s *Server) {
+		s.alerts = engine
+	}
+}
+
+// getAlerts handles GET /api/v1/alerts
+func (s *Server) getAlerts(w http.ResponseWriter, r *http.Request) {
+	if !s.isOperator(r) {
+		s.sendError(w, apierror.Forbidden, "Only operators can read alerts", "")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(AlertsResponse{Alerts: s.alerts.Alerts()})
+}
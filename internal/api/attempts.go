@@ -0,0 +1,38 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"taskflow/internal/apierror"
+	"taskflow/internal/types"
+
+	"github.com/gorilla/mux"
+)
+
+// getJobAttempts handles GET /api/v1/jobs/{id}/attempts, listing each run
+// of the job with its worker, duration, outcome and error
+func (s *Server) getJobAttempts(w http.ResponseWriter, r *http.Request) {
+	jobID := mux.Vars(r)["id"]
+
+	job, err := s.findJob(r.Context(), jobID)
+	if err != nil {
+		s.sendLookupError(w, err, "job "+jobID)
+		return
+	}
+
+	if !s.canAccessJob(r, job) {
+		s.sendError(w, apierror.JobNotFound, "Job not found", "")
+		return
+	}
+
+	attempts, err := s.storage.JobAttempts(r.Context(), jobID)
+	if err != nil {
+		log.Printf("Failed to get attempts of job %s: %v", jobID, err)
+		s.sendFailure(w, err, apierror.StorageError, "Failed to retrieve job attempts")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(types.JobAttemptsResponse{JobID: jobID, Attempts: attempts})
+}
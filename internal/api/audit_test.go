@@ -0,0 +1,36 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAuditState(t *testing.T) {
+	var missing json.RawMessage
+	tests := []struct {
+		state interface{}
+		want  string
+	}{
+		{nil, ""},
+		{missing, ""},
+		{json.RawMessage(`{"type":"object"}`), `{"type":"object"}`},
+		{map[string]string{"status": "pending"}, `{"status":"pending"}`},
+	}
+	for _, tt := range tests {
+		if got := string(auditState(tt.state)); got != tt.want {
+			t.Errorf("auditState(%v) = %s, want %s", tt.state, got, tt.want)
+		}
+	}
+}
+
+func TestAuditActorHidesAPIKey(t *testing.T) {
+	r := httptest.NewRequest("POST", "/api/v1/jobs/1/cancel", nil)
+	r.Header.Set("X-API-Key", "secret-key")
+
+	actor := auditActor(r)
+	if !strings.HasPrefix(actor, "key:") || strings.Contains(actor, "secret-key") {
+		t.Errorf("actor = %q, want a hash of the API key", actor)
+	}
+}
@@ -0,0 +1,42 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"taskflow/internal/apierror"
+	"taskflow/internal/autoscale"
+	"taskflow/internal/types"
+)
+
+// WithAutoscale sets the SLO targets used by GET /api/v1/autoscale
+func WithAutoscale(cfg autoscale.Config) ServerOption {
+	return func(s *Server) {
+		s.autoscale = cfg
+	}
+}
+
+// getAutoscale handles GET /api/v1/autoscale
+func (s *Server) getAutoscale(w http.ResponseWriter, r *http.Request) {
+	if !s.isOperator(r) {
+		s.sendError(w, apierror.Forbidden, "Only operators can read autoscaling signals", "")
+		return
+	}
+
+	metrics, err := s.queue.GetQueueMetrics(r.Context(), types.DefaultSchemas.JobTypes(), s.autoscale.Window)
+	if err != nil {
+		log.Printf("Failed to get queue metrics: %v", err)
+		s.sendFailure(w, err, apierror.AutoscaleError, "Failed to retrieve queue metrics")
+		return
+	}
+
+	workers, err := s.storage.GetWorkers(r.Context())
+	if err != nil {
+		log.Printf("Failed to get workers: %v", err)
+		s.sendFailure(w, err, apierror.WorkersError, "Failed to retrieve workers")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(autoscale.Recommend(s.autoscale, metrics, workers))
+}
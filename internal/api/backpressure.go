@@ -0,0 +1,71 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"taskflow/internal/apierror"
+	"taskflow/internal/types"
+	"time"
+)
+
+// Backpressure modes applied once the pending queue passes the high watermark
+const (
+	// BackpressureReject rejects every new job
+	BackpressureReject = "reject"
+	// BackpressureShed only accepts high-priority jobs
+	BackpressureShed = "shed"
+)
+
+// BackpressureConfig limits submissions while the queue is backed up
+type BackpressureConfig struct {
+	HighWatermark int64         // pending jobs across all types; 0 disables backpressure
+	Mode          string        // BackpressureReject or BackpressureShed
+	RetryAfter    time.Duration // suggested wait sent to rejected clients
+}
+
+// WithBackpressure limits submissions when the pending queue is too deep
+func WithBackpressure(cfg BackpressureConfig) ServerOption {
+	return func(s *Server) {
+		s.backpressure = cfg
+	}
+}
+
+// checkBackpressure reports whether a job may be accepted given the current
+// queue depth. It writes an error response and returns false when the job
+// must be rejected.
+func (s *Server) checkBackpressure(w http.ResponseWriter, r *http.Request, req *types.JobRequest) bool {
+	cfg := s.backpressure
+	if cfg.HighWatermark <= 0 {
+		return true
+	}
+
+	// High-priority jobs are the ones shedding exists to protect
+	if cfg.Mode == BackpressureShed && req.Priority == types.JobPriorityHigh {
+		return true
+	}
+
+	depth, err := s.queue.GetPendingDepth(r.Context(), types.DefaultSchemas.JobTypes())
+	if err != nil {
+		// Don't turn a metrics read failure into an outage
+		log.Printf("Failed to check queue depth: %v", err)
+		return true
+	}
+
+	if depth < cfg.HighWatermark {
+		return true
+	}
+
+	if cfg.RetryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(cfg.RetryAfter.Seconds()))))
+	}
+
+	details := fmt.Sprintf("%d jobs pending, limit is %d", depth, cfg.HighWatermark)
+	if cfg.Mode == BackpressureShed {
+		details += "; only high-priority jobs are accepted"
+	}
+	s.sendError(w, apierror.QueueBackpressure, "Queue is over capacity", details)
+	return false
+}
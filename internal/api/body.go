@@ -0,0 +1,221 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"taskflow/internal/apierror"
+)
+
+// defaultMaxRequestBytes bounds request bodies unless WithMaxRequestBytes
+// says otherwise. It leaves room for a job with follow-ups at the default
+// payload limit.
+const defaultMaxRequestBytes = 4 << 20
+
+// WithMaxRequestBytes rejects request bodies larger than maxBytes with 413
+func WithMaxRequestBytes(maxBytes int64) ServerOption {
+	return func(s *Server) {
+		s.maxRequestBytes = maxBytes
+	}
+}
+
+// limitBodyMiddleware caps how much of a request body handlers can read
+func (s *Server) limitBodyMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.maxRequestBytes > 0 && r.Body != nil {
+			r.Body = http.MaxBytesReader(w, r.Body, s.maxRequestBytes)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// readBody reads a request body, writing an error response and returning
+// false if it can't be read or is too large
+func (s *Server) readBody(w http.ResponseWriter, r *http.Request) ([]byte, bool) {
+	body, err := io.ReadAll(r.Body)
+	if apiErr := apierror.From(err); apiErr != nil {
+		s.sendAPIError(w, apiErr)
+		return nil, false
+	}
+	if err != nil {
+		s.sendError(w, apierror.InvalidBody, "Failed to read request body", err.Error())
+		return nil, false
+	}
+	return body, true
+}
+
+// decodeStrict decodes a JSON request body into v, rejecting fields that v
+// doesn't have and values of the wrong type. Every unknown field is listed
+// in the error response, not just the first.
+func (s *Server) decodeStrict(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	body, ok := s.readBody(w, r)
+	if !ok {
+		return false
+	}
+
+	if err := json.Unmarshal(body, v); err != nil {
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) && typeErr.Field != "" {
+			s.sendFieldErrors(w, []apierror.FieldError{{
+				Field:   typeErr.Field,
+				Problem: "must be " + jsonTypeName(typeErr.Type),
+			}})
+			return false
+		}
+		s.sendError(w, apierror.InvalidJSON, "Invalid JSON payload", err.Error())
+		return false
+	}
+
+	var unknown []apierror.FieldError
+	for _, field := range unknownFields(body, reflect.TypeOf(v), "") {
+		unknown = append(unknown, apierror.FieldError{Field: field, Problem: "unknown field"})
+	}
+	if len(unknown) > 0 {
+		s.sendFieldErrors(w, unknown)
+		return false
+	}
+
+	return true
+}
+
+// sendFieldErrors rejects a request body with problems in specific fields
+func (s *Server) sendFieldErrors(w http.ResponseWriter, fields []apierror.FieldError) {
+	apiErr := apierror.New(apierror.InvalidFields, "Invalid fields in request body", "")
+	apiErr.Fields = fields
+	s.sendAPIError(w, apiErr)
+}
+
+var unmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+
+// unknownFields lists the fields of a JSON document that t doesn't have,
+// as dotted paths. Field names match case-insensitively, as in
+// encoding/json.
+func unknownFields(data []byte, t reflect.Type, prefix string) []string {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	// Types that decode themselves, such as payloads and times, are
+	// checked by their own decoding
+	if reflect.PointerTo(t).Implements(unmarshalerType) {
+		return nil
+	}
+
+	switch t.Kind() {
+	case reflect.Slice, reflect.Array:
+		var items []json.RawMessage
+		if json.Unmarshal(data, &items) != nil {
+			return nil
+		}
+		var unknown []string
+		for i, item := range items {
+			unknown = append(unknown, unknownFields(item, t.Elem(), fmt.Sprintf("%s[%d]", prefix, i))...)
+		}
+		return unknown
+
+	case reflect.Map:
+		var values map[string]json.RawMessage
+		if json.Unmarshal(data, &values) != nil {
+			return nil
+		}
+		var unknown []string
+		for key, value := range values {
+			unknown = append(unknown, unknownFields(value, t.Elem(), joinField(prefix, key))...)
+		}
+		sort.Strings(unknown)
+		return unknown
+
+	case reflect.Struct:
+		var values map[string]json.RawMessage
+		if json.Unmarshal(data, &values) != nil {
+			return nil
+		}
+		fields := structFields(t)
+
+		keys := make([]string, 0, len(values))
+		for key := range values {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		var unknown []string
+		for _, key := range keys {
+			field, ok := lookupField(fields, key)
+			if !ok {
+				unknown = append(unknown, joinField(prefix, key))
+				continue
+			}
+			unknown = append(unknown, unknownFields(values[key], field, joinField(prefix, key))...)
+		}
+		return unknown
+	}
+
+	return nil
+}
+
+// structFields returns the JSON field names of a struct and their types,
+// including those of embedded structs
+func structFields(t reflect.Type) map[string]reflect.Type {
+	fields := make(map[string]reflect.Type)
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" || !field.IsExported() {
+			continue
+		}
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			for embeddedName, embeddedType := range structFields(field.Type) {
+				if _, ok := fields[embeddedName]; !ok {
+					fields[embeddedName] = embeddedType
+				}
+			}
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		fields[name] = field.Type
+	}
+	return fields
+}
+
+func lookupField(fields map[string]reflect.Type, key string) (reflect.Type, bool) {
+	if t, ok := fields[key]; ok {
+		return t, true
+	}
+	for name, t := range fields {
+		if strings.EqualFold(name, key) {
+			return t, true
+		}
+	}
+	return nil, false
+}
+
+func joinField(prefix, name string) string {
+	if prefix == "" {
+		return name
+	}
+	return prefix + "." + name
+}
+
+// jsonTypeName names the JSON type expected for a Go type
+func jsonTypeName(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.String:
+		return "a string"
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "an integer"
+	case reflect.Float32, reflect.Float64:
+		return "a number"
+	case reflect.Slice, reflect.Array:
+		return "an array"
+	}
+	return "an object"
+}
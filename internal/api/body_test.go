@@ -0,0 +1,78 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"taskflow/internal/apierror"
+	"taskflow/internal/types"
+	"testing"
+)
+
+func TestUnknownFields(t *testing.T) {
+	body := `{
+		"type": "email",
+		"Priority": "high",
+		"payload": {"anything": "goes"},
+		"retries": 3,
+		"on_success": {"type": "webhook", "payload": {}, "delay": "5s"}
+	}`
+
+	got := unknownFields([]byte(body), reflect.TypeOf(&types.JobRequest{}), "")
+	want := []string{"on_success.delay", "retries"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("unknownFields() = %v, want %v", got, want)
+	}
+
+	workflow := `{"name": "w", "steps": [{"name": "a", "type": "email", "payload": {}}, {"name": "b", "after": ["a"]}]}`
+	got = unknownFields([]byte(workflow), reflect.TypeOf(&types.WorkflowRequest{}), "")
+	want = []string{"steps[1].after"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("unknownFields() = %v, want %v", got, want)
+	}
+}
+
+func TestDecodeStrict(t *testing.T) {
+	s := &Server{maxRequestBytes: 64}
+
+	tests := []struct {
+		name   string
+		body   string
+		status int
+		fields []apierror.FieldError
+	}{
+		{"valid", `{"type":"email","payload":{}}`, http.StatusOK, nil},
+		{"unknown field", `{"type":"email","tpye":"x"}`, http.StatusUnprocessableEntity,
+			[]apierror.FieldError{{Field: "tpye", Problem: "unknown field"}}},
+		{"wrong type", `{"type":"email","max_attempts":"3"}`, http.StatusUnprocessableEntity,
+			[]apierror.FieldError{{Field: "max_attempts", Problem: "must be an integer"}}},
+		{"malformed", `{"type":`, http.StatusBadRequest, nil},
+		{"too large", `{"type":"email","payload":"` + strings.Repeat("x", 100) + `"}`, http.StatusRequestEntityTooLarge, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			handler := s.limitBodyMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var req types.JobRequest
+				if s.decodeStrict(w, r, &req) {
+					w.WriteHeader(http.StatusOK)
+				}
+			}))
+			handler.ServeHTTP(rec, httptest.NewRequest("POST", "/api/v1/jobs", strings.NewReader(tt.body)))
+
+			if rec.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.status, rec.Body)
+			}
+			if tt.fields != nil {
+				var resp ErrorResponse
+				json.Unmarshal(rec.Body.Bytes(), &resp)
+				if !reflect.DeepEqual(resp.Fields, tt.fields) {
+					t.Errorf("fields = %+v, want %+v", resp.Fields, tt.fields)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,106 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"taskflow/internal/apierror"
+	"taskflow/internal/emailtemplate"
+	"taskflow/internal/types"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// EmailTemplateRequest is the body of PUT /api/v1/email-templates/{name}
+type EmailTemplateRequest struct {
+	Source string `json:"source"`
+	HTML   bool   `json:"html,omitempty"`
+}
+
+// getEmailTemplate handles GET /api/v1/email-templates/{name}
+func (s *Server) getEmailTemplate(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+
+	tmpl, err := s.storage.GetEmailTemplate(r.Context(), name)
+	if err != nil {
+		s.sendLookupError(w, err, "email template "+name)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tmpl)
+}
+
+// putEmailTemplate handles PUT /api/v1/email-templates/{name}
+func (s *Server) putEmailTemplate(w http.ResponseWriter, r *http.Request) {
+	// Templates are shared: every tenant's emails render from them
+	if !s.isOperator(r) {
+		s.sendError(w, apierror.Forbidden, "Only operators can change email templates", "")
+		return
+	}
+
+	name := mux.Vars(r)["name"]
+	if !emailtemplate.ValidName(name) {
+		s.sendError(w, apierror.InvalidTemplate, "Invalid email template name",
+			"Names are up to 128 letters, digits, '_', '.' and '-', starting with a letter or digit")
+		return
+	}
+
+	var req EmailTemplateRequest
+	if !s.decodeStrict(w, r, &req) {
+		return
+	}
+
+	tmpl := &types.EmailTemplate{Name: name, Source: req.Source, HTML: req.HTML, UpdatedAt: time.Now()}
+	if _, err := emailtemplate.Parse(tmpl); err != nil {
+		s.sendError(w, apierror.InvalidTemplate, "Invalid email template", err.Error())
+		return
+	}
+
+	previous, _ := s.storage.GetEmailTemplate(r.Context(), name)
+
+	if err := s.storage.SaveEmailTemplate(r.Context(), tmpl); err != nil {
+		log.Printf("Failed to save email template: %v", err)
+		s.sendFailure(w, err, apierror.StorageError, "Failed to save email template")
+		return
+	}
+
+	s.audit(r, types.AuditTemplateUpdate, name, previous, tmpl)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"name":    name,
+		"message": fmt.Sprintf("Email template saved; workers pick it up within %v", emailtemplate.DefaultCacheTTL),
+	})
+}
+
+// deleteEmailTemplate handles DELETE /api/v1/email-templates/{name}
+func (s *Server) deleteEmailTemplate(w http.ResponseWriter, r *http.Request) {
+	if !s.isOperator(r) {
+		s.sendError(w, apierror.Forbidden, "Only operators can delete email templates", "")
+		return
+	}
+
+	name := mux.Vars(r)["name"]
+
+	previous, err := s.storage.GetEmailTemplate(r.Context(), name)
+	if err != nil {
+		s.sendLookupError(w, err, "email template "+name)
+		return
+	}
+
+	if err := s.storage.DeleteEmailTemplate(r.Context(), name); err != nil {
+		s.sendLookupError(w, err, "email template "+name)
+		return
+	}
+
+	s.audit(r, types.AuditTemplateDelete, name, previous, nil)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"name":    name,
+		"message": "Email template deleted",
+	})
+}
@@ -2,44 +2,131 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"math"
 	"net/http"
 	"strconv"
+	"taskflow/internal/alerting"
+	"taskflow/internal/apierror"
+	"taskflow/internal/autoscale"
+	"taskflow/internal/blobstore"
+	"taskflow/internal/breaker"
+	"taskflow/internal/events"
+	"taskflow/internal/jobstate"
+	"taskflow/internal/metrics"
 	"taskflow/internal/queue"
+	"taskflow/internal/quota"
+	"taskflow/internal/ratelimit"
+	"taskflow/internal/signing"
+	"taskflow/internal/stats"
 	"taskflow/internal/storage"
+	"taskflow/internal/tenant"
 	"taskflow/internal/types"
+	"taskflow/internal/workflow"
 
 	"github.com/gorilla/mux"
 )
 
 type Server struct {
-	queue   *queue.RedisQueue
-	storage *storage.PostgresStorage
+	queue   queue.Queue
+	storage storage.Storage
 	router  *mux.Router
+	events  *events.Bus
+	tenants *tenant.Registry
+	quotas  *quota.Manager
+
+	maxPayloadBytes int
+	maxRequestBytes int64
+	offloader       *blobstore.PayloadOffloader
+	results         *blobstore.ResultOffloader
+	autoscale       autoscale.Config
+	backpressure    BackpressureConfig
+	stats           *stats.Engine
+	workflows       *workflow.Coordinator
+	states          *jobstate.Manager
+	signer          *signing.Verifier
+	limiter         *ratelimit.Limiter
+	signingSecret   string
+	breakers        []*breaker.Breaker
+	alerts          *alerting.Engine
+	jobCache        *jobCache
 }
 
+// ServerOption configures optional Server dependencies
+type ServerOption func(*Server)
+
+// WithEventBus publishes job lifecycle events to the given bus
+func WithEventBus(bus *events.Bus) ServerOption {
+	return func(s *Server) {
+		s.events = bus
+	}
+}
+
+// WithMaxPayloadBytes rejects job payloads larger than maxBytes
+func WithMaxPayloadBytes(maxBytes int) ServerOption {
+	return func(s *Server) {
+		s.maxPayloadBytes = maxBytes
+	}
+}
+
+// WithPayloadOffloader moves large payloads to blob storage before the
+// job is stored, keeping only a reference in Redis and PostgreSQL
+func WithPayloadOffloader(offloader *blobstore.PayloadOffloader) ServerOption {
+	return func(s *Server) {
+		s.offloader = offloader
+	}
+}
+
+// WithStatsEngine serves GET /api/v1/stats from the given engine
+func WithStatsEngine(engine *stats.Engine) ServerOption {
+	return func(s *Server) {
+		s.stats = engine
+	}
+}
+
+// ErrorResponse is the body of every error response. Code is one of the
+// codes in the apierror catalog.
 type ErrorResponse struct {
-	Error   string `json:"error"`
-	Code    string `json:"code,omitempty"`
-	Details string `json:"details,omitempty"`
+	Error   string                `json:"error"`
+	Code    apierror.Code         `json:"code,omitempty"`
+	Details string                `json:"details,omitempty"`
+	Fields  []apierror.FieldError `json:"fields,omitempty"`
 }
 
+// ListJobsResponse holds a page of jobs, each with only the selected fields
 type ListJobsResponse struct {
-	Jobs       []types.Job `json:"jobs"`
-	Total      int         `json:"total"`
-	Page       int         `json:"page"`
-	PageSize   int         `json:"page_size"`
-	TotalPages int         `json:"total_pages"`
+	Jobs       []map[string]json.RawMessage `json:"jobs" openapi:"Job"`
+	Total      int                          `json:"total"`
+	Page       int                          `json:"page"`
+	PageSize   int                          `json:"page_size"`
+	TotalPages int                          `json:"total_pages"`
 }
 
-func NewServer(queue *queue.RedisQueue, storage *storage.PostgresStorage) *Server {
+func NewServer(queue queue.Queue, storage storage.Storage, opts ...ServerOption) *Server {
 	s := &Server{
-		queue:   queue,
-		storage: storage,
-		router:  mux.NewRouter(),
+		queue:     queue,
+		storage:   storage,
+		router:    mux.NewRouter(),
+		autoscale: autoscale.DefaultConfig(),
+
+		maxRequestBytes: defaultMaxRequestBytes,
 	}
 
+	for _, opt := range opts {
+		opt(s)
+	}
+	if s.stats == nil {
+		s.stats = stats.NewEngine(queue, storage)
+	}
+	s.states = jobstate.NewManager(queue, storage)
+	s.workflows = workflow.NewCoordinator(queue, storage,
+		workflow.WithEventBus(s.events),
+		workflow.WithPayloadOffloader(s.offloader),
+		workflow.WithResultStore(s.results),
+	)
+
 	s.setupRoutes()
 	return s
 }
@@ -48,20 +135,19 @@ func (s *Server) setupRoutes() {
 	// API routes
 	api := s.router.PathPrefix("/api/v1").Subrouter()
 
-	// Job management
-	api.HandleFunc("/jobs", s.createJob).Methods("POST")
-	api.HandleFunc("/jobs", s.listJobs).Methods("GET")
-	api.HandleFunc("/jobs/{id}", s.getJob).Methods("GET")
-	api.HandleFunc("/jobs/{id}/cancel", s.cancelJob).Methods("POST")
+	for _, rt := range s.routes() {
+		api.HandleFunc(rt.path, s.rateLimited(rt.group, rt.handler)).Methods(rt.method)
+	}
 
-	// Statistics and monitoring
-	api.HandleFunc("/stats", s.getStats).Methods("GET")
-	api.HandleFunc("/workers", s.getWorkers).Methods("GET")
-	api.HandleFunc("/health", s.healthCheck).Methods("GET")
+	// Readiness and Prometheus metrics
+	s.router.HandleFunc("/readyz", s.readiness).Methods("GET")
+	s.router.Handle("/metrics", metrics.Handler()).Methods("GET")
 
 	// Add CORS middleware
 	s.router.Use(corsMiddleware)
 	s.router.Use(loggingMiddleware)
+	s.router.Use(s.limitBodyMiddleware)
+	s.router.Use(s.tenantMiddleware)
 }
 
 func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -70,36 +156,79 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 // createJob handles POST /api/v1/jobs
 func (s *Server) createJob(w http.ResponseWriter, r *http.Request) {
-	var req types.JobRequest
+	if !s.verifySignature(w, r) {
+		return
+	}
 
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		s.sendError(w, http.StatusBadRequest, "INVALID_JSON", "Invalid JSON payload", err.Error())
+	var req types.JobRequest
+	if !s.decodeStrict(w, r, &req) {
 		return
 	}
 
+	for _, chained := range req.Chain() {
+		if s.maxPayloadBytes > 0 && len(chained.Payload) > s.maxPayloadBytes {
+			s.sendError(w, apierror.PayloadTooLarge, "Job payload too large",
+				fmt.Sprintf("Payload is %d bytes, maximum is %d", len(chained.Payload), s.maxPayloadBytes))
+			return
+		}
+	}
+
 	// Validate the request
 	if err := types.ValidateJobRequest(&req); err != nil {
-		s.sendError(w, http.StatusBadRequest, "VALIDATION_ERROR", "Invalid job request", err.Error())
+		s.sendValidationError(w, "Invalid job request", err)
+		return
+	}
+
+	// Enforce the job type's submission rate
+	if !s.checkJobTypeRate(w, r, req.Type) {
+		return
+	}
+
+	// Shed load before consuming quota when the queue is backed up
+	if !s.checkBackpressure(w, r, &req) {
+		return
+	}
+
+	// Enforce submission quotas
+	t := tenant.FromContext(r.Context())
+	if !s.checkExportTables(w, t, req.Chain()) {
+		return
+	}
+	reservation, ok := s.reserveQuota(w, r, t)
+	if !ok {
 		return
 	}
 
 	// Create the job
 	job := types.NewJob(&req)
+	job.TenantID = t.ID
+
+	// Offload large payloads so they don't bloat Redis
+	if _, err := s.offloader.Offload(r.Context(), job); err != nil {
+		log.Printf("Failed to offload job payload: %v", err)
+		s.releaseQuota(r, reservation)
+		s.sendError(w, apierror.OffloadError, "Failed to store job payload", "")
+		return
+	}
 
 	// Store in database
 	if err := s.storage.CreateJob(r.Context(), job); err != nil {
 		log.Printf("Failed to store job in database: %v", err)
-		s.sendError(w, http.StatusInternalServerError, "STORAGE_ERROR", "Failed to create job", "")
+		s.releaseQuota(r, reservation)
+		s.sendFailure(w, err, apierror.StorageError, "Failed to create job")
 		return
 	}
 
 	// Enqueue for processing
 	if err := s.queue.EnqueueJob(r.Context(), job); err != nil {
 		log.Printf("Failed to enqueue job: %v", err)
-		s.sendError(w, http.StatusInternalServerError, "QUEUE_ERROR", "Failed to enqueue job", "")
+		s.releaseQuota(r, reservation)
+		s.sendFailure(w, err, apierror.QueueError, "Failed to enqueue job")
 		return
 	}
 
+	s.events.PublishJob(r.Context(), events.EventJobCreated, job)
+
 	// Return success response
 	response := types.JobResponse{
 		Job:     job,
@@ -111,27 +240,56 @@ func (s *Server) createJob(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(response)
 }
 
-// getJob handles GET /api/v1/jobs/{id}
+// getJob handles GET /api/v1/jobs/{id}. Responses carry an ETag, and
+// If-None-Match returns 304 while the job is unchanged. The wait parameter
+// (e.g. wait=20s, at most 30s) holds the request until the job changes.
 func (s *Server) getJob(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	jobID := vars["id"]
 
 	if jobID == "" {
-		s.sendError(w, http.StatusBadRequest, "MISSING_ID", "Job ID is required", "")
+		s.sendError(w, apierror.MissingID, "Job ID is required", "")
 		return
 	}
 
-	// Try to get from queue first (for real-time status)
-	job, err := s.queue.GetJob(r.Context(), jobID)
-	if err != nil {
-		// If not in queue, try database (for historical jobs)
-		job, err = s.storage.GetJob(r.Context(), jobID)
-		if err != nil {
-			s.sendError(w, http.StatusNotFound, "JOB_NOT_FOUND", "Job not found", "")
+	wait, ok := parseDurationParam(r.URL.Query().Get("wait"), 0)
+	if !ok {
+		s.sendError(w, apierror.InvalidWait, "Invalid wait", "wait must be a positive duration such as 20s")
+		return
+	}
+	wait = min(wait, maxJobWait)
+
+	job, cached := s.jobCache.get(jobID)
+	if !cached {
+		var err error
+		if job, err = s.findJob(r.Context(), jobID); err != nil {
+			s.sendLookupError(w, err, "job "+jobID)
 			return
 		}
+		if job.Status.IsFinal() {
+			s.attachResult(r.Context(), job)
+			s.jobCache.add(job)
+		}
 	}
 
+	if !s.canAccessJob(r, job) {
+		s.sendError(w, apierror.JobNotFound, "Job not found", "")
+		return
+	}
+
+	if wait > 0 {
+		job = s.waitForJob(w, r, job, wait)
+	}
+
+	etag := jobETag(job)
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "no-cache")
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	s.attachResult(r.Context(), job)
+
 	response := types.JobResponse{Job: job}
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
@@ -151,20 +309,48 @@ func (s *Server) listJobs(w http.ResponseWriter, r *http.Request) {
 	}
 
 	status := r.URL.Query().Get("status")
+	if status != "" && !types.JobStatus(status).IsValid() {
+		s.sendError(w, apierror.InvalidStatus, "Invalid status", fmt.Sprintf("Unknown job status %q", status))
+		return
+	}
 	jobType := r.URL.Query().Get("type")
+	errorCode := r.URL.Query().Get("error_code")
+	if errorCode != "" && !types.ErrorCode(errorCode).IsValid() {
+		s.sendError(w, apierror.InvalidErrorCode, "Invalid error code", fmt.Sprintf("Unknown error code %q", errorCode))
+		return
+	}
+
+	// Payloads and results are left out unless selected with fields or
+	// added with include
+	fields, err := listFields(r)
+	if err != nil {
+		s.sendError(w, apierror.InvalidFieldSelection, "Invalid field selection", err.Error())
+		return
+	}
 
 	// Get jobs from database
-	jobs, total, err := s.storage.ListJobs(r.Context(), page, pageSize, status, jobType)
+	jobs, total, err := s.storage.ListJobs(r.Context(), s.tenantScope(r), page, pageSize, status, jobType, errorCode, fields)
 	if err != nil {
 		log.Printf("Failed to list jobs: %v", err)
-		s.sendError(w, http.StatusInternalServerError, "STORAGE_ERROR", "Failed to retrieve jobs", "")
+		s.sendFailure(w, err, apierror.StorageError, "Failed to retrieve jobs")
 		return
 	}
 
+	selected := make([]map[string]json.RawMessage, 0, len(jobs))
+	for i := range jobs {
+		job, err := fields.Select(&jobs[i])
+		if err != nil {
+			log.Printf("Failed to encode job %s: %v", jobs[i].ID, err)
+			s.sendError(w, apierror.InternalError, "Failed to encode jobs", "")
+			return
+		}
+		selected = append(selected, job)
+	}
+
 	totalPages := (total + pageSize - 1) / pageSize
 
 	response := ListJobsResponse{
-		Jobs:       jobs,
+		Jobs:       selected,
 		Total:      total,
 		Page:       page,
 		PageSize:   pageSize,
@@ -175,44 +361,74 @@ func (s *Server) listJobs(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(response)
 }
 
+// listFields returns the job fields selected by the fields and include
+// query parameters. fields replaces the default selection and include adds
+// to it.
+func listFields(r *http.Request) (types.JobFields, error) {
+	fields := types.DefaultListFields()
+	if spec := r.URL.Query().Get("fields"); spec != "" {
+		selected, err := types.ParseJobFields(spec)
+		if err != nil {
+			return nil, err
+		}
+		fields = selected
+	}
+
+	included, err := types.ParseJobFields(r.URL.Query().Get("include"))
+	if err != nil {
+		return nil, err
+	}
+	fields.Add(included)
+	return fields, nil
+}
+
 // cancelJob handles POST /api/v1/jobs/{id}/cancel
 func (s *Server) cancelJob(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	jobID := vars["id"]
 
 	if jobID == "" {
-		s.sendError(w, http.StatusBadRequest, "MISSING_ID", "Job ID is required", "")
+		s.sendError(w, apierror.MissingID, "Job ID is required", "")
 		return
 	}
 
 	// Get the job
-	job, err := s.queue.GetJob(r.Context(), jobID)
+	job, err := s.findJob(r.Context(), jobID)
 	if err != nil {
-		job, err = s.storage.GetJob(r.Context(), jobID)
-		if err != nil {
-			s.sendError(w, http.StatusNotFound, "JOB_NOT_FOUND", "Job not found", "")
-			return
-		}
+		s.sendLookupError(w, err, "job "+jobID)
+		return
+	}
+
+	if !s.canAccessJob(r, job) {
+		s.sendError(w, apierror.JobNotFound, "Job not found", "")
+		return
 	}
 
 	// Check if job can be cancelled
-	if job.Status == types.JobStatusCompleted || job.Status == types.JobStatusFailed {
-		s.sendError(w, http.StatusBadRequest, "CANNOT_CANCEL", "Job cannot be cancelled", fmt.Sprintf("Job is already %s", job.Status))
+	if !job.Status.CanTransition(types.JobStatusCancelled) {
+		s.sendError(w, apierror.CannotCancel, "Job cannot be cancelled", fmt.Sprintf("Job is already %s", job.Status))
 		return
 	}
 
-	// Cancel the job (mark as failed with cancellation message)
-	err = s.queue.FailJob(r.Context(), jobID, "Job cancelled by user")
+	before := job.Status
+	err = s.states.Cancel(r.Context(), job)
+	if errors.Is(err, queue.ErrJobConflict) {
+		s.sendError(w, apierror.CannotCancel, "Job cannot be cancelled", "Job finished while it was being cancelled")
+		return
+	}
 	if err != nil {
 		log.Printf("Failed to cancel job: %v", err)
-		s.sendError(w, http.StatusInternalServerError, "CANCEL_ERROR", "Failed to cancel job", "")
+		s.sendFailure(w, err, apierror.CancelError, "Failed to cancel job")
 		return
 	}
 
-	// Update in database as well
-	job.Status = types.JobStatusFailed
-	job.Error = "Job cancelled by user"
-	s.storage.UpdateJob(r.Context(), job)
+	s.events.PublishJob(r.Context(), events.EventJobCancelled, job)
+	s.audit(r, types.AuditJobCancel, job.ID, map[string]interface{}{"status": before}, map[string]interface{}{"status": job.Status})
+
+	// A cancelled step fails its workflow
+	if err := s.workflows.JobFinished(r.Context(), job); err != nil {
+		log.Printf("Failed to advance workflow %s: %v", job.WorkflowID, err)
+	}
 
 	response := types.JobResponse{
 		Job:     job,
@@ -225,10 +441,10 @@ func (s *Server) cancelJob(w http.ResponseWriter, r *http.Request) {
 
 // getStats handles GET /api/v1/stats
 func (s *Server) getStats(w http.ResponseWriter, r *http.Request) {
-	stats, err := s.queue.GetStats(r.Context())
+	stats, err := s.stats.Get(r.Context(), s.tenantScope(r))
 	if err != nil {
 		log.Printf("Failed to get stats: %v", err)
-		s.sendError(w, http.StatusInternalServerError, "STATS_ERROR", "Failed to retrieve statistics", "")
+		s.sendFailure(w, err, apierror.StatsError, "Failed to retrieve statistics")
 		return
 	}
 
@@ -238,10 +454,15 @@ func (s *Server) getStats(w http.ResponseWriter, r *http.Request) {
 
 // getWorkers handles GET /api/v1/workers
 func (s *Server) getWorkers(w http.ResponseWriter, r *http.Request) {
+	if !s.isOperator(r) {
+		s.sendError(w, apierror.Forbidden, "Only operators can list workers", "")
+		return
+	}
+
 	workers, err := s.storage.GetWorkers(r.Context())
 	if err != nil {
 		log.Printf("Failed to get workers: %v", err)
-		s.sendError(w, http.StatusInternalServerError, "WORKERS_ERROR", "Failed to retrieve workers", "")
+		s.sendFailure(w, err, apierror.WorkersError, "Failed to retrieve workers")
 		return
 	}
 
@@ -285,26 +506,69 @@ func (s *Server) healthCheck(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(health)
 }
 
-// sendError sends a structured error response
-func (s *Server) sendError(w http.ResponseWriter, statusCode int, code, message, details string) {
+// sendError sends a structured error response with the code's status
+func (s *Server) sendError(w http.ResponseWriter, code apierror.Code, message, details string) {
+	s.sendAPIError(w, apierror.New(code, message, details))
+}
+
+// sendAPIError sends a structured error response for an API error
+func (s *Server) sendAPIError(w http.ResponseWriter, apiErr *apierror.Error) {
+	if apiErr.RetryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(apiErr.RetryAfter.Seconds()))))
+	}
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(statusCode)
+	w.WriteHeader(apiErr.Status())
 
 	errorResp := ErrorResponse{
-		Error:   message,
-		Code:    code,
-		Details: details,
+		Error:   apiErr.Message,
+		Code:    apiErr.Code,
+		Details: apiErr.Details,
+		Fields:  apiErr.Fields,
 	}
 
 	json.NewEncoder(w).Encode(errorResp)
 }
 
+// sendFailure reports a failed call to storage, the queue or another
+// dependency with code, or as unavailable while the dependency's circuit
+// breaker is open
+func (s *Server) sendFailure(w http.ResponseWriter, err error, code apierror.Code, message string) {
+	if errors.Is(err, breaker.ErrOpen) {
+		s.sendAPIError(w, apierror.From(err))
+		return
+	}
+	s.sendError(w, code, message, "")
+}
+
+// sendValidationError reports an invalid request, with a specific code
+// when the error has one
+func (s *Server) sendValidationError(w http.ResponseWriter, message string, err error) {
+	if apiErr := apierror.From(err); apiErr != nil {
+		s.sendAPIError(w, apiErr)
+		return
+	}
+	s.sendError(w, apierror.ValidationError, message, err.Error())
+}
+
+// sendLookupError reports a failed read of a single record: not found
+// when the record doesn't exist, a storage error when the read failed
+func (s *Server) sendLookupError(w http.ResponseWriter, err error, what string) {
+	if apiErr := apierror.From(err); apiErr != nil {
+		s.sendAPIError(w, apiErr)
+		return
+	}
+	log.Printf("Failed to get %s: %v", what, err)
+	s.sendError(w, apierror.StorageError, "Failed to get "+what, "")
+}
+
 // corsMiddleware adds CORS headers
 func corsMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
 		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-API-Key, If-None-Match, "+
+			signing.TimestampHeader+", "+signing.NonceHeader+", "+signing.SignatureHeader)
+		w.Header().Set("Access-Control-Expose-Headers", "ETag, Retry-After, X-RateLimit-Limit, X-RateLimit-Remaining, X-RateLimit-Reset")
 
 		if r.Method == "OPTIONS" {
 			w.WriteHeader(http.StatusOK)
@@ -0,0 +1,373 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"taskflow/internal/apierror"
+	"taskflow/internal/breaker"
+	"taskflow/internal/queue"
+	"taskflow/internal/queue/queuetest"
+	"taskflow/internal/storage/storagetest"
+	"taskflow/internal/tenant"
+	"taskflow/internal/types"
+	"testing"
+	"time"
+)
+
+const testPayload = `{"to": "user@example.com", "subject": "Hi", "body": "Hello"}`
+
+var errDown = errors.New("connection refused")
+
+// handlerTest is a request to a server on fakes, and the response it
+// should get
+type handlerTest struct {
+	name   string
+	setup  func(t *testing.T, q *queuetest.Queue, st *storagetest.Storage)
+	method string
+	path   string
+	body   string
+	status int
+	code   apierror.Code // of error responses
+	check  func(t *testing.T, rec *httptest.ResponseRecorder, q *queuetest.Queue, st *storagetest.Storage)
+}
+
+func runHandlerTests(t *testing.T, tests []handlerTest) {
+	t.Helper()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, st := queuetest.New(), storagetest.New()
+			if tt.setup != nil {
+				tt.setup(t, q, st)
+			}
+			s := NewServer(q, st)
+
+			rec := httptest.NewRecorder()
+			s.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body)))
+
+			if rec.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.status, rec.Body)
+			}
+			if tt.code != "" {
+				var resp ErrorResponse
+				if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+					t.Fatalf("failed to decode error response: %v", err)
+				}
+				if resp.Code != tt.code {
+					t.Errorf("code = %s, want %s", resp.Code, tt.code)
+				}
+			}
+			if tt.check != nil {
+				tt.check(t, rec, q, st)
+			}
+		})
+	}
+}
+
+// addJob stores a job with status in storage and, unless it finished, in
+// the queue
+func addJob(t *testing.T, q *queuetest.Queue, st *storagetest.Storage, id string, status types.JobStatus) *types.Job {
+	t.Helper()
+	job := types.NewJob(&types.JobRequest{Type: types.JobTypeEmail, Payload: json.RawMessage(testPayload)})
+	job.ID, job.Status = id, status
+	if err := st.CreateJob(context.Background(), job); err != nil {
+		t.Fatal(err)
+	}
+	if !status.IsFinal() {
+		if err := q.EnqueueJob(context.Background(), job); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return job
+}
+
+func TestCreateJobHandler(t *testing.T) {
+	body := `{"type": "email", "payload": ` + testPayload + `}`
+
+	runHandlerTests(t, []handlerTest{
+		{
+			name: "created", method: "POST", path: "/api/v1/jobs", body: body,
+			status: http.StatusCreated,
+			check: func(t *testing.T, rec *httptest.ResponseRecorder, q *queuetest.Queue, st *storagetest.Storage) {
+				var resp types.JobResponse
+				if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+					t.Fatal(err)
+				}
+				if _, err := st.GetJob(context.Background(), resp.Job.ID); err != nil {
+					t.Errorf("Expected the job to be stored: %v", err)
+				}
+				if _, err := q.GetJob(context.Background(), resp.Job.ID); err != nil {
+					t.Errorf("Expected the job to be queued: %v", err)
+				}
+			},
+		},
+		{
+			name: "invalid payload", method: "POST", path: "/api/v1/jobs", body: `{"type": "email", "payload": {}}`,
+			status: http.StatusUnprocessableEntity,
+		},
+		{
+			name: "malformed body", method: "POST", path: "/api/v1/jobs", body: `{"type":`,
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "storage fails",
+			setup:  func(t *testing.T, q *queuetest.Queue, st *storagetest.Storage) { st.FailWith("CreateJob", errDown) },
+			method: "POST", path: "/api/v1/jobs", body: body,
+			status: http.StatusInternalServerError, code: apierror.StorageError,
+		},
+		{
+			name: "storage breaker open",
+			setup: func(t *testing.T, q *queuetest.Queue, st *storagetest.Storage) {
+				st.FailWith("CreateJob", &breaker.OpenError{Name: "postgres", RetryAfter: 5 * time.Second})
+			},
+			method: "POST", path: "/api/v1/jobs", body: body,
+			status: http.StatusServiceUnavailable, code: apierror.DependencyUnavailable,
+			check: func(t *testing.T, rec *httptest.ResponseRecorder, q *queuetest.Queue, st *storagetest.Storage) {
+				if got := rec.Header().Get("Retry-After"); got != "5" {
+					t.Errorf("Retry-After = %q, want 5", got)
+				}
+			},
+		},
+		{
+			name:   "queue fails",
+			setup:  func(t *testing.T, q *queuetest.Queue, st *storagetest.Storage) { q.FailWith("EnqueueJob", errDown) },
+			method: "POST", path: "/api/v1/jobs", body: body,
+			status: http.StatusInternalServerError, code: apierror.QueueError,
+		},
+	})
+}
+
+func TestGetJobHandler(t *testing.T) {
+	runHandlerTests(t, []handlerTest{
+		{
+			name: "found",
+			setup: func(t *testing.T, q *queuetest.Queue, st *storagetest.Storage) {
+				addJob(t, q, st, "job-1", types.JobStatusPending)
+			},
+			method: "GET", path: "/api/v1/jobs/job-1",
+			status: http.StatusOK,
+		},
+		{
+			name: "missing", method: "GET", path: "/api/v1/jobs/job-1",
+			status: http.StatusNotFound, code: apierror.JobNotFound,
+		},
+		{
+			name: "storage down",
+			setup: func(t *testing.T, q *queuetest.Queue, st *storagetest.Storage) {
+				addJob(t, q, st, "job-1", types.JobStatusPending)
+				st.FailWith("GetJob", errDown)
+			},
+			method: "GET", path: "/api/v1/jobs/job-1",
+			status: http.StatusOK,
+		},
+		{
+			name:   "storage down and the queue doesn't have it",
+			setup:  func(t *testing.T, q *queuetest.Queue, st *storagetest.Storage) { st.FailWith("GetJob", errDown) },
+			method: "GET", path: "/api/v1/jobs/job-1",
+			status: http.StatusInternalServerError, code: apierror.StorageError,
+		},
+		{
+			name:   "queue down and storage doesn't have it",
+			setup:  func(t *testing.T, q *queuetest.Queue, st *storagetest.Storage) { q.FailWith("GetJob", errDown) },
+			method: "GET", path: "/api/v1/jobs/job-1",
+			status: http.StatusInternalServerError, code: apierror.StorageError,
+		},
+		{
+			name: "invalid wait", method: "GET", path: "/api/v1/jobs/job-1?wait=soon",
+			status: http.StatusBadRequest, code: apierror.InvalidWait,
+		},
+	})
+}
+
+func TestListJobsHandler(t *testing.T) {
+	runHandlerTests(t, []handlerTest{
+		{
+			name: "filtered",
+			setup: func(t *testing.T, q *queuetest.Queue, st *storagetest.Storage) {
+				addJob(t, q, st, "job-1", types.JobStatusPending)
+				addJob(t, q, st, "job-2", types.JobStatusCompleted)
+			},
+			method: "GET", path: "/api/v1/jobs?status=completed",
+			status: http.StatusOK,
+			check: func(t *testing.T, rec *httptest.ResponseRecorder, q *queuetest.Queue, st *storagetest.Storage) {
+				var resp ListJobsResponse
+				if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+					t.Fatal(err)
+				}
+				if resp.Total != 1 || len(resp.Jobs) != 1 || string(resp.Jobs[0]["id"]) != `"job-2"` {
+					t.Errorf("response = %+v, want only job-2", resp)
+				}
+			},
+		},
+		{
+			name: "invalid status", method: "GET", path: "/api/v1/jobs?status=done",
+			status: http.StatusBadRequest, code: apierror.InvalidStatus,
+		},
+		{
+			name: "invalid error code", method: "GET", path: "/api/v1/jobs?error_code=OOPS",
+			status: http.StatusBadRequest, code: apierror.InvalidErrorCode,
+		},
+		{
+			name: "invalid fields", method: "GET", path: "/api/v1/jobs?fields=nope",
+			status: http.StatusBadRequest, code: apierror.InvalidFieldSelection,
+		},
+		{
+			name:   "storage fails",
+			setup:  func(t *testing.T, q *queuetest.Queue, st *storagetest.Storage) { st.FailWith("ListJobs", errDown) },
+			method: "GET", path: "/api/v1/jobs",
+			status: http.StatusInternalServerError, code: apierror.StorageError,
+		},
+	})
+}
+
+func TestCancelJobHandler(t *testing.T) {
+	runHandlerTests(t, []handlerTest{
+		{
+			name: "cancelled",
+			setup: func(t *testing.T, q *queuetest.Queue, st *storagetest.Storage) {
+				addJob(t, q, st, "job-1", types.JobStatusPending)
+			},
+			method: "POST", path: "/api/v1/jobs/job-1/cancel",
+			status: http.StatusOK,
+			check: func(t *testing.T, rec *httptest.ResponseRecorder, q *queuetest.Queue, st *storagetest.Storage) {
+				job, err := st.GetJob(context.Background(), "job-1")
+				if err != nil || job.Status != types.JobStatusCancelled {
+					t.Errorf("stored job = %v, %v; want cancelled", job, err)
+				}
+				if audit := st.Audit(); len(audit) != 1 || audit[0].Action != types.AuditJobCancel {
+					t.Errorf("audit = %+v, want the cancellation", audit)
+				}
+			},
+		},
+		{
+			name: "already finished",
+			setup: func(t *testing.T, q *queuetest.Queue, st *storagetest.Storage) {
+				addJob(t, q, st, "job-1", types.JobStatusCompleted)
+			},
+			method: "POST", path: "/api/v1/jobs/job-1/cancel",
+			status: http.StatusConflict, code: apierror.CannotCancel,
+		},
+		{
+			name: "finished meanwhile",
+			setup: func(t *testing.T, q *queuetest.Queue, st *storagetest.Storage) {
+				addJob(t, q, st, "job-1", types.JobStatusPending)
+				q.FailWith("CancelJob", fmt.Errorf("%w: job job-1 is completed", queue.ErrJobConflict))
+			},
+			method: "POST", path: "/api/v1/jobs/job-1/cancel",
+			status: http.StatusConflict, code: apierror.CannotCancel,
+		},
+		{
+			name: "queue fails",
+			setup: func(t *testing.T, q *queuetest.Queue, st *storagetest.Storage) {
+				addJob(t, q, st, "job-1", types.JobStatusPending)
+				q.FailWith("CancelJob", errDown)
+			},
+			method: "POST", path: "/api/v1/jobs/job-1/cancel",
+			status: http.StatusInternalServerError, code: apierror.CancelError,
+		},
+		{
+			name: "missing", method: "POST", path: "/api/v1/jobs/job-1/cancel",
+			status: http.StatusNotFound, code: apierror.JobNotFound,
+		},
+	})
+}
+
+func TestWorkerHandlers(t *testing.T) {
+	addWorker := func(t *testing.T, q *queuetest.Queue, st *storagetest.Storage) {
+		worker := &types.Worker{ID: "worker-1", Status: types.WorkerStatusIdle, LastSeen: time.Now()}
+		if err := st.RegisterWorker(context.Background(), worker); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	runHandlerTests(t, []handlerTest{
+		{
+			name: "list", setup: addWorker, method: "GET", path: "/api/v1/workers",
+			status: http.StatusOK,
+		},
+		{
+			name:   "list fails",
+			setup:  func(t *testing.T, q *queuetest.Queue, st *storagetest.Storage) { st.FailWith("GetWorkers", errDown) },
+			method: "GET", path: "/api/v1/workers",
+			status: http.StatusInternalServerError, code: apierror.WorkersError,
+		},
+		{
+			name: "pause", setup: addWorker, method: "POST", path: "/api/v1/workers/worker-1/pause",
+			status: http.StatusAccepted,
+			check: func(t *testing.T, rec *httptest.ResponseRecorder, q *queuetest.Queue, st *storagetest.Storage) {
+				if cmd := q.Command("worker-1"); cmd != types.WorkerCommandPause {
+					t.Errorf("command = %q, want pause", cmd)
+				}
+			},
+		},
+		{
+			name: "pause a missing worker", method: "POST", path: "/api/v1/workers/worker-1/pause",
+			status: http.StatusNotFound, code: apierror.WorkerNotFound,
+		},
+		{
+			name: "pause fails",
+			setup: func(t *testing.T, q *queuetest.Queue, st *storagetest.Storage) {
+				addWorker(t, q, st)
+				q.FailWith("SendWorkerCommand", errDown)
+			},
+			method: "POST", path: "/api/v1/workers/worker-1/pause",
+			status: http.StatusInternalServerError, code: apierror.ControlError,
+		},
+	})
+}
+
+func TestHealthHandler(t *testing.T) {
+	runHandlerTests(t, []handlerTest{
+		{name: "healthy", method: "GET", path: "/api/v1/health", status: http.StatusOK},
+		{
+			name:   "queue down",
+			setup:  func(t *testing.T, q *queuetest.Queue, st *storagetest.Storage) { q.FailWith("Ping", errDown) },
+			method: "GET", path: "/api/v1/health",
+			status: http.StatusServiceUnavailable,
+		},
+		{
+			name:   "storage down",
+			setup:  func(t *testing.T, q *queuetest.Queue, st *storagetest.Storage) { st.FailWith("Ping", errDown) },
+			method: "GET", path: "/api/v1/health",
+			status: http.StatusServiceUnavailable,
+		},
+	})
+}
+
+// TestOperatorOnly checks that with multi-tenancy enabled, settings shared
+// by every tenant can only be changed by the default tenant
+func TestOperatorOnly(t *testing.T) {
+	registry, err := tenant.NewRegistry([]*tenant.Tenant{
+		{ID: types.DefaultTenantID, APIKeys: []string{"operator-key"}},
+		{ID: "acme", APIKeys: []string{"acme-key"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	requests := []struct {
+		method, path, body string
+	}{
+		{"PUT", "/api/v1/schemas/email", `{"type": "object"}`},
+		{"PUT", "/api/v1/email-templates/welcome", `{"source": "{{define \"subject\"}}Hi{{end}}Hello"}`},
+		{"DELETE", "/api/v1/email-templates/welcome", ""},
+		{"GET", "/api/v1/workers", ""},
+	}
+	for _, req := range requests {
+		t.Run(req.method+" "+req.path, func(t *testing.T) {
+			s := NewServer(queuetest.New(), storagetest.New(), WithTenants(registry))
+			r := httptest.NewRequest(req.method, req.path, strings.NewReader(req.body))
+			r.Header.Set("X-API-Key", "acme-key")
+			rec := httptest.NewRecorder()
+			s.ServeHTTP(rec, r)
+
+			if rec.Code != http.StatusForbidden {
+				t.Errorf("status = %d, want %d: %s", rec.Code, http.StatusForbidden, rec.Body)
+			}
+		})
+	}
+}
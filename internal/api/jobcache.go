@@ -0,0 +1,124 @@
+package api
+
+import (
+	"context"
+	"sync"
+	"taskflow/internal/types"
+	"time"
+)
+
+// jobCache keeps finished jobs read by GET /api/v1/jobs/{id} for a short
+// time, so that clients polling a job that already finished don't reach
+// Redis and PostgreSQL on every request. Unfinished jobs are never cached:
+// their pollers are waiting for them to change. A nil *jobCache caches
+// nothing.
+type jobCache struct {
+	ttl     time.Duration
+	maxSize int
+
+	mu      sync.Mutex
+	entries map[string]cachedJob
+}
+
+type cachedJob struct {
+	job     types.Job
+	expires time.Time
+}
+
+// newJobCache creates a cache holding up to maxSize jobs for ttl each. It
+// returns nil when ttl or maxSize is zero.
+func newJobCache(ttl time.Duration, maxSize int) *jobCache {
+	if ttl <= 0 || maxSize <= 0 {
+		return nil
+	}
+	return &jobCache{
+		ttl:     ttl,
+		maxSize: maxSize,
+		entries: make(map[string]cachedJob),
+	}
+}
+
+// WithJobCache caches finished jobs read by GET /api/v1/jobs/{id} for
+// ttl, holding at most maxSize of them. A zero ttl disables the cache.
+func WithJobCache(ttl time.Duration, maxSize int) ServerOption {
+	return func(s *Server) {
+		s.jobCache = newJobCache(ttl, maxSize)
+	}
+}
+
+// get returns a copy of a cached job
+func (c *jobCache) get(jobID string) (*types.Job, bool) {
+	if c == nil {
+		return nil, false
+	}
+
+	c.mu.Lock()
+	entry, ok := c.entries[jobID]
+	if ok && time.Now().After(entry.expires) {
+		delete(c.entries, jobID)
+		ok = false
+	}
+	c.mu.Unlock()
+
+	if !ok {
+		return nil, false
+	}
+	job := entry.job
+	return &job, true
+}
+
+// add caches a copy of job if it has finished
+func (c *jobCache) add(job *types.Job) {
+	if c == nil || !job.Status.IsFinal() {
+		return
+	}
+
+	now := time.Now()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.entries[job.ID]; !ok && len(c.entries) >= c.maxSize {
+		c.evict(now)
+	}
+	c.entries[job.ID] = cachedJob{job: *job, expires: now.Add(c.ttl)}
+}
+
+// evict makes room for a job, dropping expired jobs or, if none have
+// expired, an arbitrary one. c.mu must be held.
+func (c *jobCache) evict(now time.Time) {
+	for id, entry := range c.entries {
+		if now.After(entry.expires) {
+			delete(c.entries, id)
+		}
+	}
+	for id := range c.entries {
+		if len(c.entries) < c.maxSize {
+			return
+		}
+		delete(c.entries, id)
+	}
+}
+
+// invalidate drops a job from the cache
+func (c *jobCache) invalidate(jobID string) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	delete(c.entries, jobID)
+	c.mu.Unlock()
+}
+
+// WatchJobUpdates drops jobs from the job cache as the queue announces
+// changes to them, until ctx is cancelled. Announcements are sent over
+// Redis pub/sub; with other queue backends cached jobs simply expire.
+func (s *Server) WatchJobUpdates(ctx context.Context) {
+	if s.jobCache == nil {
+		return
+	}
+
+	for jobID := range s.queue.SubscribeJobUpdates(ctx) {
+		s.jobCache.invalidate(jobID)
+	}
+}
@@ -0,0 +1,135 @@
+package api
+
+import (
+	"context"
+	"sync"
+	"taskflow/internal/queue"
+	"taskflow/internal/types"
+	"testing"
+	"time"
+)
+
+func TestJobCacheOnlyHoldsFinishedJobs(t *testing.T) {
+	cache := newJobCache(time.Minute, 10)
+
+	cache.add(&types.Job{ID: "running", Status: types.JobStatusProcessing})
+	if _, ok := cache.get("running"); ok {
+		t.Error("Expected unfinished job not to be cached")
+	}
+
+	cache.add(&types.Job{ID: "done", Status: types.JobStatusCompleted})
+	job, ok := cache.get("done")
+	if !ok || job.ID != "done" {
+		t.Fatalf("Expected finished job to be cached, got %v, %v", job, ok)
+	}
+
+	// Callers get a copy they can change
+	job.Status = types.JobStatusFailed
+	if cached, _ := cache.get("done"); cached.Status != types.JobStatusCompleted {
+		t.Errorf("Expected cached job to be unchanged, got status %s", cached.Status)
+	}
+
+	cache.invalidate("done")
+	if _, ok := cache.get("done"); ok {
+		t.Error("Expected invalidated job to be dropped")
+	}
+}
+
+func TestJobCacheExpiresAndEvicts(t *testing.T) {
+	cache := newJobCache(time.Millisecond, 2)
+	cache.add(&types.Job{ID: "a", Status: types.JobStatusCompleted})
+	time.Sleep(2 * time.Millisecond)
+	if _, ok := cache.get("a"); ok {
+		t.Error("Expected expired job to be dropped")
+	}
+
+	cache = newJobCache(time.Minute, 2)
+	for _, id := range []string{"a", "b", "c"} {
+		cache.add(&types.Job{ID: id, Status: types.JobStatusFailed})
+	}
+	if len(cache.entries) != 2 {
+		t.Errorf("Expected cache to hold at most 2 jobs, got %d", len(cache.entries))
+	}
+	if _, ok := cache.get("c"); !ok {
+		t.Error("Expected the latest job to be cached")
+	}
+}
+
+func TestNilJobCache(t *testing.T) {
+	cache := newJobCache(0, 10)
+	if cache != nil {
+		t.Fatal("Expected zero TTL to disable the cache")
+	}
+
+	cache.add(&types.Job{ID: "done", Status: types.JobStatusCompleted})
+	if _, ok := cache.get("done"); ok {
+		t.Error("Expected nil cache to hold nothing")
+	}
+	cache.invalidate("done")
+}
+
+// broadcastQueue delivers job updates to every subscriber, like Redis
+// pub/sub does for API servers sharing a Redis
+type broadcastQueue struct {
+	queue.Queue
+
+	mu          sync.Mutex
+	subscribers []chan string
+}
+
+func (q *broadcastQueue) SubscribeJobUpdates(ctx context.Context) <-chan string {
+	updates := make(chan string, 1)
+	q.mu.Lock()
+	q.subscribers = append(q.subscribers, updates)
+	q.mu.Unlock()
+	return updates
+}
+
+func (q *broadcastQueue) PublishJobUpdate(ctx context.Context, jobID string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, updates := range q.subscribers {
+		updates <- jobID
+	}
+	return nil
+}
+
+func (q *broadcastQueue) subscriberCount() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.subscribers)
+}
+
+func TestJobUpdatesReachEveryServer(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	q := &broadcastQueue{}
+	servers := []*Server{
+		NewServer(q, nil, WithJobCache(time.Minute, 10)),
+		NewServer(q, nil, WithJobCache(time.Minute, 10)),
+	}
+	for _, s := range servers {
+		s.jobCache.add(&types.Job{ID: "job-1", Status: types.JobStatusCompleted})
+		go s.WatchJobUpdates(ctx)
+	}
+	for q.subscriberCount() < len(servers) {
+		time.Sleep(time.Millisecond)
+	}
+
+	// Announced by a worker or another API server
+	q.PublishJobUpdate(ctx, "job-1")
+
+	deadline := time.Now().Add(time.Second)
+	for i, s := range servers {
+		for {
+			if _, ok := s.jobCache.get("job-1"); !ok {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("Expected server %d to drop the updated job", i+1)
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+}
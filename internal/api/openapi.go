@@ -0,0 +1,397 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"taskflow/internal/apierror"
+	"taskflow/internal/types"
+	"time"
+)
+
+// route is an API endpoint together with its OpenAPI description. All
+// endpoints are registered from the route table, so the spec served at
+// /api/v1/openapi.json can't drift from the router.
+type route struct {
+	method  string
+	path    string
+	handler http.HandlerFunc
+	summary string
+	group   string // Rate limit group; unlimited if empty
+	query   []queryParam
+	request interface{} // Request body, if any
+	// Success response body; nil documents an untyped JSON object
+	response interface{}
+	status   int // Success status, 200 if zero
+}
+
+// queryParam documents a query parameter
+type queryParam struct {
+	name        string
+	kind        string // JSON Schema type, string if empty
+	description string
+}
+
+var (
+	pageParams = []queryParam{
+		{name: "page", kind: "integer", description: "Page number, starting at 1"},
+		{name: "page_size", kind: "integer", description: "Items per page, at most 100"},
+	}
+	pathParamPattern = regexp.MustCompile(`\{(\w+)\}`)
+)
+
+// routes returns the API's endpoints
+func (s *Server) routes() []route {
+	return []route{
+		// Job management
+		{method: "POST", path: "/jobs", group: "submit", handler: s.createJob, summary: "Create a job",
+			request: types.JobRequest{}, response: types.JobResponse{}, status: http.StatusCreated},
+		{method: "GET", path: "/jobs", group: "read", handler: s.listJobs, summary: "List jobs",
+			query: append([]queryParam{
+				{name: "status", description: "Only jobs with this status: scheduled, pending, processing, retrying, completed, failed, cancelled or expired"},
+				{name: "type", description: "Only jobs of this type"},
+				{name: "error_code", description: "Only jobs whose last attempt failed with this code: TIMEOUT, VALIDATION, DOWNSTREAM_5XX, RATE_LIMITED, CANCELLED, PANIC or UNKNOWN"},
+				{name: "fields", description: "Comma-separated fields to return instead of the defaults"},
+				{name: "include", description: "Comma-separated fields to add to the defaults, e.g. payload,result"},
+			}, pageParams...),
+			response: ListJobsResponse{}},
+		{method: "GET", path: "/jobs/{id}", group: "read", handler: s.getJob, summary: "Get a job",
+			query: []queryParam{
+				{name: "wait", description: "Long-poll until the job changes, e.g. 20s (at most 30s)"},
+			},
+			response: types.JobResponse{}},
+		{method: "GET", path: "/jobs/{id}/result", group: "read", handler: s.getJobResult, summary: "Get a completed job's result",
+			response: json.RawMessage{}},
+		{method: "GET", path: "/jobs/{id}/attempts", group: "read", handler: s.getJobAttempts, summary: "List a job's attempts",
+			response: types.JobAttemptsResponse{}},
+		{method: "POST", path: "/jobs/{id}/cancel", group: "submit", handler: s.cancelJob, summary: "Cancel a job",
+			response: types.JobResponse{}},
+
+		// Workflows
+		{method: "POST", path: "/workflows", group: "submit", handler: s.createWorkflow, summary: "Start a workflow",
+			request: types.WorkflowRequest{}, response: types.WorkflowResponse{}, status: http.StatusCreated},
+		{method: "GET", path: "/workflows", group: "read", handler: s.listWorkflows, summary: "List workflows",
+			query: append([]queryParam{
+				{name: "status", description: "Only workflows with this status"},
+			}, pageParams...),
+			response: ListWorkflowsResponse{}},
+		{method: "GET", path: "/workflows/{id}", group: "read", handler: s.getWorkflow, summary: "Get a workflow",
+			response: types.WorkflowResponse{}},
+
+		// Payload schemas
+		{method: "GET", path: "/schemas", group: "read", handler: s.listSchemas, summary: "List payload schemas"},
+		{method: "GET", path: "/schemas/{type}", group: "read", handler: s.getSchema, summary: "Get a job type's payload schema"},
+		{method: "PUT", path: "/schemas/{type}", group: "admin", handler: s.putSchema, summary: "Register a job type's payload schema",
+			request: json.RawMessage{}},
+
+		// Email templates
+		{method: "GET", path: "/email-templates/{name}", group: "read", handler: s.getEmailTemplate, summary: "Get an email template",
+			response: types.EmailTemplate{}},
+		{method: "PUT", path: "/email-templates/{name}", group: "admin", handler: s.putEmailTemplate, summary: "Create or replace an email template",
+			request: EmailTemplateRequest{}},
+		{method: "DELETE", path: "/email-templates/{name}", group: "admin", handler: s.deleteEmailTemplate, summary: "Delete an email template"},
+
+		// Statistics and monitoring
+		{method: "GET", path: "/stats", group: "read", handler: s.getStats, summary: "Get job statistics",
+			response: types.JobStats{}},
+		{method: "GET", path: "/stats/timeseries", group: "read", handler: s.getStatsTimeseries, summary: "Get job statistics over time",
+			query: []queryParam{
+				{name: "window", description: "How far back to go, e.g. 24h"},
+				{name: "interval", description: "Bucket size, e.g. 1h"},
+				{name: "type", description: "Only jobs of this type"},
+			},
+			response: types.StatsTimeseries{}},
+		{method: "GET", path: "/workers", group: "read", handler: s.getWorkers, summary: "List active workers"},
+		{method: "POST", path: "/workers/{id}/pause", group: "admin", handler: s.pauseWorker, summary: "Pause a worker"},
+		{method: "POST", path: "/workers/{id}/resume", group: "admin", handler: s.resumeWorker, summary: "Resume a worker"},
+		{method: "POST", path: "/workers/{id}/shutdown", group: "admin", handler: s.shutdownWorker, summary: "Shut a worker down"},
+		{method: "GET", path: "/quota", group: "read", handler: s.getQuota, summary: "Get the caller's quota usage"},
+		{method: "GET", path: "/autoscale", group: "read", handler: s.getAutoscale, summary: "Get a worker count recommendation"},
+		{method: "GET", path: "/audit", group: "read", handler: s.getAuditLog, summary: "List administrative actions, newest first",
+			query: []queryParam{
+				{name: "action", description: "Only this action, e.g. job.cancel or worker.pause"},
+				{name: "actor", description: "Only actions by this actor"},
+				{name: "tenant", description: "Only actions by this tenant's callers"},
+				{name: "target", description: "Only actions on this job, worker, job type or setting"},
+				{name: "since", description: "Only actions at or after this RFC 3339 time"},
+				{name: "until", description: "Only actions before this RFC 3339 time"},
+				{name: "before", kind: "integer", description: "Only entries older than this ID, for paging"},
+				{name: "limit", kind: "integer", description: "Entries per page, at most 1000 (default 100)"},
+			},
+			response: types.AuditLogResponse{}},
+		{method: "GET", path: "/alerts", group: "read", handler: s.getAlerts, summary: "Get the state of alerting rules",
+			response: AlertsResponse{}},
+		{method: "GET", path: "/health", handler: s.healthCheck, summary: "Check API health"},
+		{method: "GET", path: "/openapi.json", handler: s.getOpenAPI, summary: "Get this OpenAPI specification"},
+	}
+}
+
+// getOpenAPI handles GET /api/v1/openapi.json. The spec is built on each
+// request so that it includes payload schemas registered at runtime.
+func (s *Server) getOpenAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(buildOpenAPI(s.routes(), types.DefaultSchemas))
+}
+
+// buildOpenAPI describes routes as an OpenAPI 3.1 document. Request and
+// response schemas are derived from the Go types' JSON tags, and job
+// requests are described per job type with its payload schema.
+func buildOpenAPI(routes []route, schemas *types.SchemaRegistry) map[string]interface{} {
+	g := &schemaGenerator{components: make(map[string]interface{}), names: make(map[string]reflect.Type)}
+	g.schema(reflect.TypeOf(ErrorResponse{}))
+	g.components["ErrorResponse"].(map[string]interface{})["properties"].(map[string]interface{})["code"] = errorCodeSchema()
+
+	paths := make(map[string]map[string]interface{})
+	for _, rt := range routes {
+		op := map[string]interface{}{
+			"summary":     rt.summary,
+			"operationId": operationID(rt),
+		}
+
+		var params []interface{}
+		for _, match := range pathParamPattern.FindAllStringSubmatch(rt.path, -1) {
+			params = append(params, map[string]interface{}{
+				"name": match[1], "in": "path", "required": true,
+				"schema": map[string]interface{}{"type": "string"},
+			})
+		}
+		for _, q := range rt.query {
+			kind := q.kind
+			if kind == "" {
+				kind = "string"
+			}
+			params = append(params, map[string]interface{}{
+				"name": q.name, "in": "query", "description": q.description,
+				"schema": map[string]interface{}{"type": kind},
+			})
+		}
+		if len(params) > 0 {
+			op["parameters"] = params
+		}
+
+		if rt.request != nil {
+			schema := g.schema(reflect.TypeOf(rt.request))
+			if _, ok := rt.request.(types.JobRequest); ok {
+				schema = jobRequestSchema(g, schemas)
+			}
+			op["requestBody"] = map[string]interface{}{
+				"required": true,
+				"content":  jsonContent(schema),
+			}
+		}
+
+		response := map[string]interface{}{"type": "object"}
+		if rt.response != nil {
+			response = g.schema(reflect.TypeOf(rt.response))
+		}
+		status := rt.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		responses := map[string]interface{}{
+			strconv.Itoa(status): map[string]interface{}{
+				"description": http.StatusText(status),
+				"content":     jsonContent(response),
+			},
+			"default": map[string]interface{}{
+				"description": "Error",
+				"content":     jsonContent(ref("ErrorResponse")),
+			},
+		}
+		if rt.group != "" {
+			responses["429"] = map[string]interface{}{
+				"description": "Rate limit of the " + rt.group + " group exceeded",
+				"content":     jsonContent(ref("ErrorResponse")),
+			}
+		}
+		op["responses"] = responses
+
+		path := "/api/v1" + rt.path
+		if paths[path] == nil {
+			paths[path] = make(map[string]interface{})
+		}
+		paths[path][strings.ToLower(rt.method)] = op
+	}
+
+	return map[string]interface{}{
+		"openapi": "3.1.0",
+		"info": map[string]interface{}{
+			"title":       "TaskFlow API",
+			"version":     "1.0.0",
+			"description": "Distributed job queue API",
+		},
+		"paths":      paths,
+		"components": map[string]interface{}{"schemas": g.components},
+	}
+}
+
+// errorCodeSchema lists every error code with its status and meaning
+func errorCodeSchema() map[string]interface{} {
+	var codes []apierror.Code
+	lines := []string{"Machine-readable error code. Each code always comes with the same status:", ""}
+	for _, entry := range apierror.Catalog() {
+		codes = append(codes, entry.Code)
+		lines = append(lines, fmt.Sprintf("- `%s` (%d): %s", entry.Code, entry.Status, entry.Description))
+	}
+
+	return map[string]interface{}{
+		"type":        "string",
+		"enum":        codes,
+		"description": strings.Join(lines, "\n"),
+	}
+}
+
+// jobRequestSchema describes a job request as one variant per registered
+// job type, each with that type's payload schema
+func jobRequestSchema(g *schemaGenerator, schemas *types.SchemaRegistry) map[string]interface{} {
+	base := g.schema(reflect.TypeOf(types.JobRequest{}))
+
+	var variants []interface{}
+	mapping := make(map[string]string)
+	for _, jobType := range schemas.JobTypes() {
+		payload, _ := schemas.Get(jobType)
+		payloadName := "Payload_" + string(jobType)
+		g.components[payloadName] = payload
+
+		name := "JobRequest_" + string(jobType)
+		g.components[name] = map[string]interface{}{
+			"allOf": []interface{}{
+				base,
+				map[string]interface{}{
+					"type":     "object",
+					"required": []string{"type", "payload"},
+					"properties": map[string]interface{}{
+						"type":    map[string]interface{}{"const": jobType},
+						"payload": ref(payloadName),
+					},
+				},
+			},
+		}
+		variants = append(variants, ref(name))
+		mapping[string(jobType)] = "#/components/schemas/" + name
+	}
+
+	return map[string]interface{}{
+		"oneOf": variants,
+		"discriminator": map[string]interface{}{
+			"propertyName": "type",
+			"mapping":      mapping,
+		},
+	}
+}
+
+// schemaGenerator derives JSON Schemas from Go types, collecting named
+// structs as components
+type schemaGenerator struct {
+	components map[string]interface{}
+	names      map[string]reflect.Type
+}
+
+var (
+	timeType = reflect.TypeOf(time.Time{})
+	rawType  = reflect.TypeOf(json.RawMessage{})
+)
+
+// openAPIRefs are the types that an openapi struct tag can name. ListJobsResponse
+// holds jobs as field maps, but they are documented as jobs.
+var openAPIRefs = map[string]reflect.Type{
+	"Job": reflect.TypeOf(types.Job{}),
+}
+
+func (g *schemaGenerator) schema(t reflect.Type) map[string]interface{} {
+	switch {
+	case t == timeType:
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case t == rawType:
+		return map[string]interface{}{}
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		return g.schema(t.Elem())
+	case reflect.Struct:
+		return g.structRef(t)
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": g.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": g.schema(t.Elem())}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	}
+	return map[string]interface{}{}
+}
+
+// structRef adds a struct's schema to the components and returns a
+// reference to it
+func (g *schemaGenerator) structRef(t reflect.Type) map[string]interface{} {
+	name := t.Name()
+	if existing, ok := g.names[name]; ok && existing != t {
+		name = strings.ReplaceAll(t.String(), ".", "_")
+	}
+	if _, ok := g.names[name]; !ok {
+		// Claim the name first so recursive types terminate
+		g.names[name] = t
+		properties := make(map[string]interface{})
+		g.addProperties(t, properties)
+		g.components[name] = map[string]interface{}{
+			"type":       "object",
+			"properties": properties,
+		}
+	}
+	return ref(name)
+}
+
+// addProperties adds the JSON fields of a struct, including those of
+// embedded structs, to properties
+func (g *schemaGenerator) addProperties(t reflect.Type, properties map[string]interface{}) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" || !field.IsExported() {
+			continue
+		}
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			g.addProperties(field.Type, properties)
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		if refName := field.Tag.Get("openapi"); refName != "" {
+			g.structRef(openAPIRefs[refName])
+			properties[name] = map[string]interface{}{"type": "array", "items": ref(refName)}
+			continue
+		}
+		properties[name] = g.schema(field.Type)
+	}
+}
+
+func ref(name string) map[string]interface{} {
+	return map[string]interface{}{"$ref": "#/components/schemas/" + name}
+}
+
+func jsonContent(schema interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"application/json": map[string]interface{}{"schema": schema},
+	}
+}
+
+// operationID names an operation after its handler's route, e.g.
+// get_jobs_id_result
+func operationID(rt route) string {
+	path := pathParamPattern.ReplaceAllString(rt.path, "$1")
+	path = strings.NewReplacer("/", "_", ".", "_").Replace(strings.Trim(path, "/"))
+	return strings.ToLower(rt.method) + "_" + path
+}
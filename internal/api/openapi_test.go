@@ -0,0 +1,55 @@
+package api
+
+import (
+	"encoding/json"
+	"strings"
+	"taskflow/internal/types"
+	"testing"
+)
+
+func TestBuildOpenAPI(t *testing.T) {
+	s := &Server{}
+	routes := s.routes()
+	data, err := json.Marshal(buildOpenAPI(routes, types.NewSchemaRegistry()))
+	if err != nil {
+		t.Fatalf("failed to encode spec: %v", err)
+	}
+
+	var spec struct {
+		Paths      map[string]map[string]json.RawMessage `json:"paths"`
+		Components struct {
+			Schemas map[string]json.RawMessage `json:"schemas"`
+		} `json:"components"`
+	}
+	if err := json.Unmarshal(data, &spec); err != nil {
+		t.Fatalf("failed to decode spec: %v", err)
+	}
+
+	for _, rt := range routes {
+		if _, ok := spec.Paths["/api/v1"+rt.path][strings.ToLower(rt.method)]; !ok {
+			t.Errorf("spec is missing %s %s", rt.method, rt.path)
+		}
+	}
+
+	for _, name := range []string{"Job", "JobResponse", "ErrorResponse", "Payload_email", "JobRequest_webhook", "WorkflowStep"} {
+		if _, ok := spec.Components.Schemas[name]; !ok {
+			t.Errorf("spec is missing schema %s", name)
+		}
+	}
+
+	// Every reference resolves
+	for _, match := range strings.Split(string(data), `"$ref":"#/components/schemas/`)[1:] {
+		name, _, _ := strings.Cut(match, `"`)
+		if _, ok := spec.Components.Schemas[name]; !ok {
+			t.Errorf("unresolved reference to %s", name)
+		}
+	}
+
+	var step struct {
+		Properties map[string]json.RawMessage `json:"properties"`
+	}
+	json.Unmarshal(spec.Components.Schemas["WorkflowStep"], &step)
+	if _, ok := step.Properties["payload"]; !ok {
+		t.Error("WorkflowStep doesn't include the fields of its embedded JobRequest")
+	}
+}
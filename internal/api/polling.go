@@ -0,0 +1,122 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"taskflow/internal/storage"
+	"taskflow/internal/types"
+	"time"
+)
+
+const (
+	// maxJobWait caps the wait parameter of GET /api/v1/jobs/{id}
+	maxJobWait = 30 * time.Second
+
+	// jobWaitInterval is how often a long poll rereads the job
+	jobWaitInterval = 500 * time.Millisecond
+)
+
+// jobETag identifies a version of a job. Every change to a job, including
+// its progress and checkpoint, moves its updated_at, so the timestamp is
+// enough.
+func jobETag(job *types.Job) string {
+	return `"` + strconv.FormatInt(job.UpdatedAt.UnixNano(), 36) + `"`
+}
+
+// etagMatches reports whether an If-None-Match header matches etag
+func etagMatches(ifNoneMatch, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// findJob reads a job for clients. The database is read first: it is the
+// record of finished jobs, which the queue may already have expired. For
+// jobs still in flight the queue has the real-time status, so it is read
+// too and the copy updated last wins. Either copy is enough on its own, so
+// reads keep working while Redis is down. A job is only reported missing
+// when neither has it.
+func (s *Server) findJob(ctx context.Context, jobID string) (*types.Job, error) {
+	stored, dbErr := s.storage.GetJob(ctx, jobID)
+	if dbErr == nil && stored.Status.IsFinal() {
+		return stored, nil
+	}
+
+	queued, err := s.queue.GetJob(ctx, jobID)
+	switch {
+	case err == nil && dbErr == nil:
+		return freshestJob(stored, queued), nil
+	case err == nil:
+		return queued, nil
+	case dbErr == nil:
+		return stored, nil
+	case errors.Is(dbErr, storage.ErrJobNotFound) && !errors.Is(err, storage.ErrJobNotFound):
+		// Without an answer from the queue the job can't be reported missing
+		return nil, err
+	}
+	return nil, dbErr
+}
+
+// freshestJob returns the copy of a job that was updated last, preferring
+// the stored one when both are equally fresh
+func freshestJob(stored, queued *types.Job) *types.Job {
+	if queued.UpdatedAt.After(stored.UpdatedAt) {
+		return queued
+	}
+	return stored
+}
+
+// waitForJob long-polls a job until it changes or wait elapses, and
+// returns its latest version. With If-None-Match, any change to the job
+// ends the wait; without it, a change of status does. Finished jobs are
+// returned at once.
+func (s *Server) waitForJob(w http.ResponseWriter, r *http.Request, job *types.Job, wait time.Duration) *types.Job {
+	ifNoneMatch := r.Header.Get("If-None-Match")
+	status := job.Status
+	changed := func(latest *types.Job) bool {
+		if latest.Status.IsFinal() {
+			return true
+		}
+		if ifNoneMatch != "" {
+			return !etagMatches(ifNoneMatch, jobETag(latest))
+		}
+		return latest.Status != status
+	}
+	if changed(job) {
+		return job
+	}
+
+	// Outlast the server's write timeout; unsupported writers are ignored
+	http.NewResponseController(w).SetWriteDeadline(time.Now().Add(wait + 10*time.Second))
+
+	timeout := time.NewTimer(wait)
+	defer timeout.Stop()
+	ticker := time.NewTicker(jobWaitInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return job
+		case <-timeout.C:
+			return job
+		case <-ticker.C:
+		}
+
+		latest, err := s.findJob(r.Context(), job.ID)
+		if err != nil {
+			continue
+		}
+		job = latest
+		if changed(job) {
+			return job
+		}
+	}
+}
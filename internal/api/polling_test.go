@@ -0,0 +1,27 @@
+package api
+
+import (
+	"taskflow/internal/types"
+	"testing"
+	"time"
+)
+
+func TestFreshestJob(t *testing.T) {
+	now := time.Now()
+	stored := &types.Job{ID: "job-1", Status: types.JobStatusPending, UpdatedAt: now}
+	queued := &types.Job{ID: "job-1", Status: types.JobStatusProcessing, UpdatedAt: now.Add(time.Second)}
+
+	if got := freshestJob(stored, queued); got != queued {
+		t.Errorf("freshestJob picked the %s copy, want the newer processing one", got.Status)
+	}
+
+	queued.UpdatedAt = now
+	if got := freshestJob(stored, queued); got != stored {
+		t.Error("freshestJob should prefer the stored copy when both are equally fresh")
+	}
+
+	stored.UpdatedAt = now.Add(2 * time.Second)
+	if got := freshestJob(stored, queued); got != stored {
+		t.Error("freshestJob picked a stale queue copy")
+	}
+}
@@ -0,0 +1,77 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"taskflow/internal/apierror"
+	"taskflow/internal/quota"
+	"taskflow/internal/tenant"
+)
+
+// WithQuotas enforces submission quotas on POST /jobs
+func WithQuotas(manager *quota.Manager) ServerOption {
+	return func(s *Server) {
+		s.quotas = manager
+	}
+}
+
+// reserveQuota consumes quota for a job submission. It writes an error
+// response and returns false when the submission must be rejected. A
+// submission that fails later gives its reservation back with releaseQuota.
+func (s *Server) reserveQuota(w http.ResponseWriter, r *http.Request, t *tenant.Tenant) (*quota.Reservation, bool) {
+	if s.quotas == nil {
+		return nil, true
+	}
+
+	reservation, err := s.quotas.Reserve(r.Context(), t.ID, tenantLimits(t))
+	if err == nil {
+		return reservation, true
+	}
+
+	var violation *quota.Violation
+	if errors.As(err, &violation) {
+		if violation.RetryAfter > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(violation.RetryAfter.Seconds()))))
+		}
+		s.sendAPIError(w, apierror.From(violation))
+		return nil, false
+	}
+
+	log.Printf("Failed to check quota: %v", err)
+	s.sendFailure(w, err, apierror.QuotaError, "Failed to check quota")
+	return nil, false
+}
+
+// releaseQuota gives back the quota of a submission that was allowed but
+// failed to be stored or queued
+func (s *Server) releaseQuota(r *http.Request, reservation *quota.Reservation) {
+	if s.quotas == nil {
+		return
+	}
+	if err := s.quotas.Release(r.Context(), reservation); err != nil {
+		log.Printf("Failed to release quota: %v", err)
+	}
+}
+
+// getQuota handles GET /api/v1/quota
+func (s *Server) getQuota(w http.ResponseWriter, r *http.Request) {
+	if s.quotas == nil {
+		s.sendError(w, apierror.QuotasDisabled, "Quotas are not enabled", "")
+		return
+	}
+
+	t := tenant.FromContext(r.Context())
+	status, err := s.quotas.Status(r.Context(), t.ID, tenantLimits(t))
+	if err != nil {
+		log.Printf("Failed to get quota status: %v", err)
+		s.sendFailure(w, err, apierror.QuotaError, "Failed to retrieve quota status")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status)
+}
@@ -0,0 +1,54 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"taskflow/internal/queue/queuetest"
+	"taskflow/internal/quota"
+	"taskflow/internal/storage/storagetest"
+	"taskflow/internal/testutil"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	os.Exit(testutil.Run(m))
+}
+
+// TestCreateJobReleasesQuota checks that a job that can't be stored or
+// queued gives back the quota it reserved
+func TestCreateJobReleasesQuota(t *testing.T) {
+	body := `{"type": "email", "payload": ` + testPayload + `}`
+	for _, method := range []string{"CreateJob", "EnqueueJob"} {
+		t.Run(method, func(t *testing.T) {
+			q, st := queuetest.New(), storagetest.New()
+			manager := quota.NewManager(testutil.Redis(t), quota.Limits{}, quota.Limits{JobsPerMinute: 1})
+			s := NewServer(q, st, WithQuotas(manager))
+
+			post := func() int {
+				rec := httptest.NewRecorder()
+				s.ServeHTTP(rec, httptest.NewRequest("POST", "/api/v1/jobs", strings.NewReader(body)))
+				return rec.Code
+			}
+
+			if method == "CreateJob" {
+				st.FailWith(method, errDown)
+			} else {
+				q.FailWith(method, errDown)
+			}
+			if status := post(); status != http.StatusInternalServerError {
+				t.Fatalf("status with %s failing = %d, want %d", method, status, http.StatusInternalServerError)
+			}
+
+			st.FailWith(method, nil)
+			q.FailWith(method, nil)
+			if status := post(); status != http.StatusCreated {
+				t.Fatalf("status once %s recovers = %d, want %d", method, status, http.StatusCreated)
+			}
+			if status := post(); status != http.StatusTooManyRequests {
+				t.Errorf("status over the quota = %d, want %d", status, http.StatusTooManyRequests)
+			}
+		})
+	}
+}
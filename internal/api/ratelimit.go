@@ -0,0 +1,90 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"taskflow/internal/apierror"
+	"taskflow/internal/ratelimit"
+	"taskflow/internal/types"
+	"time"
+)
+
+// WithRateLimiter limits how often each client may call each route group.
+// Clients are identified by API key, or by IP address without one.
+func WithRateLimiter(limiter *ratelimit.Limiter) ServerOption {
+	return func(s *Server) {
+		s.limiter = limiter
+	}
+}
+
+// rateLimited wraps a route's handler with its group's rate limit
+func (s *Server) rateLimited(group string, next http.HandlerFunc) http.HandlerFunc {
+	if s.limiter == nil || group == "" {
+		return next
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		result, err := s.limiter.Allow(r.Context(), group, rateLimitClient(r))
+		if err != nil {
+			// Fail open: a Redis outage shouldn't take the API down with it
+			log.Printf("Failed to check rate limit: %v", err)
+			next(w, r)
+			return
+		}
+
+		if result.Limit > 0 {
+			w.Header().Set("X-RateLimit-Limit", strconv.Itoa(result.Limit))
+			w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(result.Remaining))
+			w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(result.ResetAt.Unix(), 10))
+		}
+		if !result.Allowed {
+			retryAfter := int(time.Until(result.ResetAt).Seconds()) + 1
+			w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+			s.sendError(w, apierror.RateLimited, "Rate limit exceeded",
+				"Limit of "+strconv.Itoa(result.Limit)+" "+group+" requests per minute reached")
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+// checkJobTypeRate enforces the submission rate limit of a job type, which
+// is shared by all clients. It writes the error response and returns false
+// when the limit is reached.
+func (s *Server) checkJobTypeRate(w http.ResponseWriter, r *http.Request, jobType types.JobType) bool {
+	limit := types.DefaultJobTypes.For(jobType).RateLimit
+	result, err := s.limiter.AllowLimit(r.Context(), "type:"+string(jobType), "all", limit)
+	if err != nil {
+		log.Printf("Failed to check rate limit of job type %s: %v", jobType, err)
+		return true
+	}
+
+	if !result.Allowed {
+		retryAfter := int(time.Until(result.ResetAt).Seconds()) + 1
+		w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+		s.sendError(w, apierror.RateLimited, "Job type rate limit exceeded",
+			"Limit of "+strconv.Itoa(result.Limit)+" "+string(jobType)+" jobs per minute reached")
+		return false
+	}
+	return true
+}
+
+// rateLimitClient identifies the caller for rate limiting. API keys are
+// hashed so they don't appear in Redis keys.
+func rateLimitClient(r *http.Request) string {
+	if key := apiKeyFromRequest(r); key != "" {
+		sum := sha256.Sum256([]byte(key))
+		return "key:" + hex.EncodeToString(sum[:8])
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
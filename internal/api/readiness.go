@@ -0,0 +1,60 @@
+package api
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"strconv"
+	"taskflow/internal/breaker"
+	"time"
+)
+
+// WithBreakers reports the state of the given circuit breakers on /readyz
+func WithBreakers(breakers ...*breaker.Breaker) ServerOption {
+	return func(s *Server) {
+		s.breakers = append(s.breakers, breakers...)
+	}
+}
+
+// DependencyStatus is the circuit breaker state of one dependency
+type DependencyStatus struct {
+	State    string `json:"state"`
+	Failures int    `json:"failures"`
+	// RetryAfter is the number of seconds until an open breaker lets a
+	// trial call through
+	RetryAfter int `json:"retry_after,omitempty"`
+}
+
+// ReadinessResponse is the body of GET /readyz
+type ReadinessResponse struct {
+	Status       string                      `json:"status"`
+	Dependencies map[string]DependencyStatus `json:"dependencies"`
+}
+
+// readiness handles GET /readyz. It answers 503 while the circuit breaker
+// of any dependency is open, so that load balancers stop routing requests
+// that would fail anyway. Unlike /api/v1/health it doesn't call the
+// dependencies itself.
+func (s *Server) readiness(w http.ResponseWriter, r *http.Request) {
+	resp := ReadinessResponse{Status: "ready", Dependencies: make(map[string]DependencyStatus, len(s.breakers))}
+	var retryAfter time.Duration
+
+	for _, b := range s.breakers {
+		state := b.State()
+		status := DependencyStatus{State: state.String(), Failures: b.Failures()}
+		if state == breaker.Open {
+			wait := b.RetryAfter()
+			status.RetryAfter = int(math.Ceil(wait.Seconds()))
+			retryAfter = max(retryAfter, wait)
+			resp.Status = "unavailable"
+		}
+		resp.Dependencies[b.Name()] = status
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if resp.Status != "ready" {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,150 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"taskflow/internal/apierror"
+	"taskflow/internal/blobstore"
+	"taskflow/internal/storage"
+	"taskflow/internal/types"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// resultURLTTL is how long a redirect to an offloaded result stays valid
+const resultURLTTL = 15 * time.Minute
+
+// WithResultStore serves results that workers offloaded to blob storage
+func WithResultStore(results *blobstore.ResultOffloader) ServerOption {
+	return func(s *Server) {
+		s.results = results
+	}
+}
+
+// getJobResult handles GET /api/v1/jobs/{id}/result. Inline results are
+// written as the response body; offloaded ones redirect to a presigned
+// URL when the blob store supports it and are streamed otherwise.
+func (s *Server) getJobResult(w http.ResponseWriter, r *http.Request) {
+	jobID := mux.Vars(r)["id"]
+
+	job, err := s.storage.GetJob(r.Context(), jobID)
+	if errors.Is(err, storage.ErrJobNotFound) {
+		job, err = s.queue.GetJob(r.Context(), jobID)
+	}
+	if err != nil {
+		s.sendLookupError(w, err, "job "+jobID)
+		return
+	}
+
+	if !s.canAccessJob(r, job) {
+		s.sendError(w, apierror.JobNotFound, "Job not found", "")
+		return
+	}
+
+	result, err := s.storage.GetResult(r.Context(), jobID)
+	if apiErr := apierror.From(err); apiErr != nil {
+		s.sendAPIError(w, apiErr)
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to get result of job %s: %v", jobID, err)
+		s.sendFailure(w, err, apierror.StorageError, "Failed to retrieve job result")
+		return
+	}
+
+	if result.ExpiresAt != nil {
+		w.Header().Set("Expires", result.ExpiresAt.UTC().Format(http.TimeFormat))
+	}
+	if result.Checksum != "" {
+		w.Header().Set("X-Result-Checksum", result.Checksum)
+	}
+
+	if result.Ref == "" {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Length", strconv.Itoa(len(result.Result)))
+		w.Write(result.Result)
+		return
+	}
+
+	url, ok, err := s.results.DownloadURL(r.Context(), result.Ref, resultURLTTL)
+	if err != nil {
+		log.Printf("Failed to presign result of job %s: %v", jobID, err)
+	} else if ok {
+		http.Redirect(w, r, url, http.StatusTemporaryRedirect)
+		return
+	}
+
+	body, err := s.results.Open(r.Context(), result.Ref)
+	if err != nil {
+		log.Printf("Failed to open result of job %s: %v", jobID, err)
+		s.sendError(w, apierror.ResultError, "Failed to retrieve job result", "")
+		return
+	}
+	defer body.Close()
+
+	w.Header().Set("Content-Type", "application/json")
+	if _, err := io.Copy(w, body); err != nil {
+		log.Printf("Failed to stream result of job %s: %v", jobID, err)
+	}
+}
+
+// attachResult sets the result of a completed job read from the queue,
+// which doesn't hold results
+func (s *Server) attachResult(ctx context.Context, job *types.Job) {
+	if job.Status != types.JobStatusCompleted || len(job.Result) > 0 || job.ResultRef != "" {
+		return
+	}
+
+	result, err := s.storage.GetResult(ctx, job.ID)
+	if err != nil {
+		if !errors.Is(err, storage.ErrResultNotFound) {
+			log.Printf("Failed to get result of job %s: %v", job.ID, err)
+		}
+		return
+	}
+
+	job.Result = result.Result
+	job.ResultRef = result.Ref
+	job.ResultChecksum = result.Checksum
+	job.ResultExpiresAt = result.ExpiresAt
+}
+
+// sweepResults deletes expired results and their blobs
+func (s *Server) sweepResults(ctx context.Context) {
+	deleted, refs, err := s.storage.DeleteExpiredResults(ctx, time.Now())
+	if err != nil {
+		log.Printf("Failed to delete expired results: %v", err)
+		return
+	}
+
+	for _, ref := range refs {
+		if err := s.results.Delete(ctx, ref); err != nil {
+			log.Printf("Failed to delete expired result blob %s: %v", ref, err)
+		}
+	}
+	if deleted > 0 {
+		log.Printf("Deleted %d expired job results", deleted)
+	}
+}
+
+// SweepResults deletes expired job results every interval until ctx is
+// cancelled
+func (s *Server) SweepResults(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		s.sweepResults(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
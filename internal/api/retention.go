@@ -0,0 +1,56 @@
+package api
+
+import (
+	"context"
+	"log"
+	"strings"
+	"time"
+)
+
+// JobRetention is the job retention policy the API server applies
+type JobRetention struct {
+	// Keep is how long finished jobs are kept. Zero keeps them forever.
+	Keep time.Duration
+
+	// PartitionsAhead is how many future monthly partitions of a
+	// partitioned jobs table are kept ready
+	PartitionsAhead int
+}
+
+// maintainJobs applies policy once and logs what changed
+func (s *Server) maintainJobs(ctx context.Context, policy JobRetention) {
+	report, err := s.storage.MaintainJobs(ctx, time.Now(), policy.Keep, policy.PartitionsAhead)
+
+	if len(report.Created) > 0 {
+		log.Printf("Created job partitions %s", strings.Join(report.Created, ", "))
+	}
+	if len(report.Dropped) > 0 {
+		log.Printf("Dropped expired job partitions %s", strings.Join(report.Dropped, ", "))
+	}
+	if len(report.Kept) > 0 {
+		log.Printf("Kept expired job partitions %s, they still have unfinished jobs", strings.Join(report.Kept, ", "))
+	}
+	if report.Deleted > 0 {
+		log.Printf("Deleted %d expired jobs", report.Deleted)
+	}
+	if err != nil {
+		log.Printf("Failed to maintain jobs table: %v", err)
+	}
+}
+
+// MaintainJobs deletes expired jobs and creates upcoming job partitions
+// every interval until ctx is cancelled
+func (s *Server) MaintainJobs(ctx context.Context, interval time.Duration, policy JobRetention) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		s.maintainJobs(ctx, policy)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"taskflow/internal/apierror"
+	"taskflow/internal/types"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// listSchemas handles GET /api/v1/schemas
+func (s *Server) listSchemas(w http.ResponseWriter, r *http.Request) {
+	schemas := make(map[types.JobType]json.RawMessage)
+	for _, jobType := range types.DefaultSchemas.JobTypes() {
+		schemas[jobType], _ = types.DefaultSchemas.Get(jobType)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"schemas": schemas,
+		"count":   len(schemas),
+	})
+}
+
+// getSchema handles GET /api/v1/schemas/{type}
+func (s *Server) getSchema(w http.ResponseWriter, r *http.Request) {
+	jobType := types.JobType(mux.Vars(r)["type"])
+
+	schema, ok := types.DefaultSchemas.Get(jobType)
+	if !ok {
+		s.sendError(w, apierror.SchemaNotFound, "No schema registered for job type", string(jobType))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(schema)
+}
+
+// putSchema handles PUT /api/v1/schemas/{type}
+func (s *Server) putSchema(w http.ResponseWriter, r *http.Request) {
+	// Schemas are shared: every tenant's jobs are validated against them
+	if !s.isOperator(r) {
+		s.sendError(w, apierror.Forbidden, "Only operators can change job schemas", "")
+		return
+	}
+
+	jobType := types.JobType(mux.Vars(r)["type"])
+
+	schema, ok := s.readBody(w, r)
+	if !ok {
+		return
+	}
+
+	if err := types.CheckSchema(jobType, schema); err != nil {
+		s.sendError(w, apierror.InvalidSchema, "Invalid JSON Schema", err.Error())
+		return
+	}
+
+	previous, _ := types.DefaultSchemas.Get(jobType)
+
+	// Persist first so the schema survives restarts and reaches other API servers
+	if err := s.storage.SaveJobSchema(r.Context(), jobType, schema); err != nil {
+		log.Printf("Failed to save job schema: %v", err)
+		s.sendFailure(w, err, apierror.StorageError, "Failed to save schema")
+		return
+	}
+
+	if err := types.DefaultSchemas.Register(jobType, schema); err != nil {
+		s.sendError(w, apierror.InvalidSchema, "Invalid JSON Schema", err.Error())
+		return
+	}
+
+	// Other API servers reload it at once, or at their next resync
+	if err := s.queue.PublishSchemaUpdate(r.Context(), jobType); err != nil {
+		log.Printf("Failed to announce schema for %s: %v", jobType, err)
+	}
+
+	s.audit(r, types.AuditSchemaUpdate, string(jobType), previous, json.RawMessage(schema))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"job_type": jobType,
+		"message":  "Schema registered successfully",
+	})
+}
+
+// syncSchemas registers the payload schemas other API servers stored
+func (s *Server) syncSchemas(ctx context.Context) {
+	stored, err := s.storage.GetJobSchemas(ctx)
+	if err != nil {
+		log.Printf("Failed to load stored payload schemas: %v", err)
+		return
+	}
+
+	changed, err := types.DefaultSchemas.Sync(stored)
+	if err != nil {
+		log.Printf("Skipping invalid stored payload schemas: %v", err)
+	}
+	if len(changed) > 0 {
+		log.Printf("Loaded payload schemas for %v", changed)
+	}
+}
+
+// SyncSchemas keeps payload schemas in line with those registered through
+// other API servers until ctx is cancelled. Schemas are reloaded when a
+// server announces one, and every interval in case an announcement was
+// missed.
+func (s *Server) SyncSchemas(ctx context.Context, interval time.Duration) {
+	updates := s.queue.SubscribeSchemaUpdates(ctx)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case _, ok := <-updates:
+			if !ok {
+				return
+			}
+		case <-ticker.C:
+		}
+		s.syncSchemas(ctx)
+	}
+}
@@ -0,0 +1,56 @@
+package api
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"net/http"
+	"taskflow/internal/apierror"
+	"taskflow/internal/signing"
+	"taskflow/internal/tenant"
+)
+
+// WithRequestSigning requires job submissions to be HMAC-signed with the
+// caller's tenant's signing secret, or with secret for tenants that don't
+// have one. Submissions are unsigned if neither is set.
+func WithRequestSigning(verifier *signing.Verifier, secret string) ServerOption {
+	return func(s *Server) {
+		s.signer = verifier
+		s.signingSecret = secret
+	}
+}
+
+// verifySignature checks the signature of a request that must be signed,
+// writing an error response and returning false if it is invalid. The
+// request body is read and replaced, so handlers can decode it as usual.
+func (s *Server) verifySignature(w http.ResponseWriter, r *http.Request) bool {
+	if s.signer == nil {
+		return true
+	}
+
+	secret := tenant.FromContext(r.Context()).SigningSecret
+	if secret == "" {
+		secret = s.signingSecret
+	}
+	if secret == "" {
+		return true
+	}
+
+	body, ok := s.readBody(w, r)
+	if !ok {
+		return false
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	err := s.signer.Verify(r.Context(), secret, r.Header, body)
+	if err == nil {
+		return true
+	}
+	if apiErr := apierror.From(err); apiErr != nil {
+		s.sendAPIError(w, apiErr)
+		return false
+	}
+	log.Printf("Failed to verify request signature: %v", err)
+	s.sendFailure(w, err, apierror.SigningError, "Failed to verify request signature")
+	return false
+}
@@ -0,0 +1,60 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"taskflow/internal/apierror"
+	"taskflow/internal/stats"
+	"time"
+)
+
+// Defaults for GET /api/v1/stats/timeseries
+const (
+	defaultTimeseriesWindow   = 24 * time.Hour
+	defaultTimeseriesInterval = time.Hour
+)
+
+// getStatsTimeseries handles GET /api/v1/stats/timeseries
+func (s *Server) getStatsTimeseries(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	window, ok := parseDurationParam(query.Get("window"), defaultTimeseriesWindow)
+	if !ok {
+		s.sendError(w, apierror.InvalidWindow, "Invalid window", "Use a duration such as 24h or 90m")
+		return
+	}
+	interval, ok := parseDurationParam(query.Get("interval"), defaultTimeseriesInterval)
+	if !ok {
+		s.sendError(w, apierror.InvalidInterval, "Invalid interval", "Use a duration such as 1h or 5m")
+		return
+	}
+
+	from, to, err := stats.TimeseriesRange(time.Now(), window, interval)
+	if err != nil {
+		s.sendError(w, apierror.InvalidRange, "Invalid time range", err.Error())
+		return
+	}
+
+	series, err := s.stats.Timeseries(r.Context(), s.tenantScope(r), query.Get("type"), from, to, interval)
+	if err != nil {
+		log.Printf("Failed to get stats timeseries: %v", err)
+		s.sendFailure(w, err, apierror.StatsError, "Failed to retrieve statistics")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(series)
+}
+
+// parseDurationParam parses an optional duration query parameter
+func parseDurationParam(value string, defaultValue time.Duration) (time.Duration, bool) {
+	if value == "" {
+		return defaultValue, true
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		return 0, false
+	}
+	return d, true
+}
@@ -0,0 +1,104 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+	"taskflow/internal/apierror"
+	"taskflow/internal/quota"
+	"taskflow/internal/tenant"
+	"taskflow/internal/types"
+)
+
+// WithTenants enables multi-tenancy: requests must carry an API key that
+// resolves to a tenant, and job access is scoped to that tenant
+func WithTenants(registry *tenant.Registry) ServerOption {
+	return func(s *Server) {
+		s.tenants = registry
+	}
+}
+
+// publicPaths are served without an API key, for load balancers and
+// monitoring
+var publicPaths = map[string]bool{
+	"/api/v1/health": true,
+	"/readyz":        true,
+	"/metrics":       true,
+}
+
+// tenantMiddleware resolves the caller's tenant from its API key
+func (s *Server) tenantMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !s.tenants.Enabled() || r.Method == "OPTIONS" || publicPaths[r.URL.Path] {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		t, ok := s.tenants.Lookup(apiKeyFromRequest(r))
+		if !ok {
+			s.sendError(w, apierror.Unauthorized, "Missing or invalid API key", "")
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(tenant.WithTenant(r.Context(), t)))
+	})
+}
+
+// apiKeyFromRequest reads the API key from X-API-Key or a Bearer token
+func apiKeyFromRequest(r *http.Request) string {
+	if key := r.Header.Get("X-API-Key"); key != "" {
+		return key
+	}
+
+	auth := r.Header.Get("Authorization")
+	if strings.HasPrefix(auth, "Bearer ") {
+		return strings.TrimPrefix(auth, "Bearer ")
+	}
+
+	return ""
+}
+
+// tenantScope returns the tenant ID used to filter queries, or an empty
+// string when multi-tenancy is disabled and all jobs are visible
+func (s *Server) tenantScope(r *http.Request) string {
+	if !s.tenants.Enabled() {
+		return ""
+	}
+	return tenant.FromContext(r.Context()).ID
+}
+
+// isOperator reports whether the caller may see and manage shared
+// infrastructure such as workers. With multi-tenancy enabled only the
+// default tenant can.
+func (s *Server) isOperator(r *http.Request) bool {
+	scope := s.tenantScope(r)
+	return scope == "" || scope == types.DefaultTenantID
+}
+
+// canAccessJob reports whether the caller's tenant owns the job
+func (s *Server) canAccessJob(r *http.Request, job *types.Job) bool {
+	scope := s.tenantScope(r)
+	return scope == "" || job.Tenant() == scope
+}
+
+// checkExportTables rejects data exports reading tables the tenant may not
+// export. Workers check them again, for jobs queued some other way.
+func (s *Server) checkExportTables(w http.ResponseWriter, t *tenant.Tenant, reqs []*types.JobRequest) bool {
+	for _, req := range reqs {
+		if req.Type != types.JobTypeDataExport {
+			continue
+		}
+		if err := t.CheckExport(req.Payload); err != nil {
+			s.sendError(w, apierror.ExportNotAllowed, "Data export not allowed", err.Error())
+			return false
+		}
+	}
+	return true
+}
+
+// tenantLimits converts a tenant's configured limits to quota limits
+func tenantLimits(t *tenant.Tenant) quota.Limits {
+	return quota.Limits{
+		JobsPerMinute: t.RateLimitPerMinute,
+		MaxQueuedJobs: t.MaxPendingJobs,
+	}
+}
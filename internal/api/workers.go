@@ -0,0 +1,69 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"taskflow/internal/apierror"
+	"taskflow/internal/types"
+
+	"github.com/gorilla/mux"
+)
+
+// pauseWorker handles POST /api/v1/workers/{id}/pause
+func (s *Server) pauseWorker(w http.ResponseWriter, r *http.Request) {
+	s.sendWorkerCommand(w, r, types.WorkerCommandPause)
+}
+
+// resumeWorker handles POST /api/v1/workers/{id}/resume
+func (s *Server) resumeWorker(w http.ResponseWriter, r *http.Request) {
+	s.sendWorkerCommand(w, r, types.WorkerCommandResume)
+}
+
+// shutdownWorker handles POST /api/v1/workers/{id}/shutdown
+func (s *Server) shutdownWorker(w http.ResponseWriter, r *http.Request) {
+	s.sendWorkerCommand(w, r, types.WorkerCommandShutdown)
+}
+
+// workerAuditActions are the audit log actions of worker commands
+var workerAuditActions = map[types.WorkerCommand]types.AuditAction{
+	types.WorkerCommandPause:    types.AuditWorkerPause,
+	types.WorkerCommandResume:   types.AuditWorkerResume,
+	types.WorkerCommandShutdown: types.AuditWorkerShutdown,
+}
+
+// sendWorkerCommand delivers a remote control command to a registered worker.
+func (s *Server) sendWorkerCommand(w http.ResponseWriter, r *http.Request, cmd types.WorkerCommand) {
+	if !s.isOperator(r) {
+		s.sendError(w, apierror.Forbidden, "Only operators can control workers", "")
+		return
+	}
+
+	workerID := mux.Vars(r)["id"]
+
+	worker, err := s.storage.GetWorker(r.Context(), workerID)
+	if err != nil {
+		s.sendLookupError(w, err, "worker "+workerID)
+		return
+	}
+	if worker.Status == types.WorkerStatusOffline {
+		s.sendError(w, apierror.WorkerNotFound, "Worker not found", "")
+		return
+	}
+
+	if err := s.queue.SendWorkerCommand(r.Context(), workerID, cmd); err != nil {
+		log.Printf("Failed to send %s to worker %s: %v", cmd, workerID, err)
+		s.sendFailure(w, err, apierror.ControlError, "Failed to send worker command")
+		return
+	}
+
+	s.audit(r, workerAuditActions[cmd], workerID, map[string]interface{}{"status": worker.Status}, map[string]interface{}{"command": cmd})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"worker_id": workerID,
+		"command":   cmd,
+		"status":    worker.Status,
+	})
+}
@@ -0,0 +1,154 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"taskflow/internal/apierror"
+	"taskflow/internal/tenant"
+	"taskflow/internal/types"
+
+	"github.com/gorilla/mux"
+)
+
+// ListWorkflowsResponse is the response body of GET /api/v1/workflows
+type ListWorkflowsResponse struct {
+	Workflows  []types.Workflow `json:"workflows"`
+	Total      int              `json:"total"`
+	Page       int              `json:"page"`
+	PageSize   int              `json:"page_size"`
+	TotalPages int              `json:"total_pages"`
+}
+
+// createWorkflow handles POST /api/v1/workflows
+func (s *Server) createWorkflow(w http.ResponseWriter, r *http.Request) {
+	var req types.WorkflowRequest
+	if !s.decodeStrict(w, r, &req) {
+		return
+	}
+
+	for _, step := range req.Steps {
+		payloads := append([]json.RawMessage{step.Payload}, step.FanOut...)
+		if step.Compensate != nil {
+			payloads = append(payloads, step.Compensate.Payload)
+		}
+		for _, payload := range payloads {
+			if s.maxPayloadBytes > 0 && len(payload) > s.maxPayloadBytes {
+				s.sendError(w, apierror.PayloadTooLarge, "Job payload too large",
+					fmt.Sprintf("Step %s payload is %d bytes, maximum is %d", step.Name, len(payload), s.maxPayloadBytes))
+				return
+			}
+		}
+	}
+
+	if err := types.ValidateWorkflowRequest(&req); err != nil {
+		s.sendValidationError(w, "Invalid workflow request", err)
+		return
+	}
+
+	// A workflow is admitted like a single job of its first step
+	if !s.checkBackpressure(w, r, &req.Steps[0].JobRequest) {
+		return
+	}
+
+	t := tenant.FromContext(r.Context())
+	var jobs []*types.JobRequest
+	for i := range req.Steps {
+		step := &req.Steps[i]
+		if len(step.FanOut) == 0 {
+			jobs = append(jobs, &step.JobRequest)
+		}
+		for _, payload := range step.FanOut {
+			job := step.JobRequest
+			job.Payload = payload
+			jobs = append(jobs, &job)
+		}
+		if step.Compensate != nil {
+			jobs = append(jobs, step.Compensate)
+		}
+	}
+	if !s.checkExportTables(w, t, jobs) {
+		return
+	}
+	reservation, ok := s.reserveQuota(w, r, t)
+	if !ok {
+		return
+	}
+
+	wf := types.NewWorkflow(&req)
+	wf.TenantID = t.ID
+
+	if err := s.workflows.Start(r.Context(), wf); err != nil {
+		log.Printf("Failed to start workflow: %v", err)
+		s.releaseQuota(r, reservation)
+		s.sendFailure(w, err, apierror.WorkflowError, "Failed to create workflow")
+		return
+	}
+
+	response := types.NewWorkflowResponse(wf, "Workflow created successfully")
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(response)
+}
+
+// getWorkflow handles GET /api/v1/workflows/{id}
+func (s *Server) getWorkflow(w http.ResponseWriter, r *http.Request) {
+	workflowID := mux.Vars(r)["id"]
+
+	wf, err := s.storage.GetWorkflow(r.Context(), workflowID)
+	if err != nil {
+		s.sendLookupError(w, err, "workflow "+workflowID)
+		return
+	}
+	if !s.canAccessWorkflow(r, wf) {
+		s.sendError(w, apierror.WorkflowNotFound, "Workflow not found", "")
+		return
+	}
+
+	response := types.NewWorkflowResponse(wf, "")
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// listWorkflows handles GET /api/v1/workflows
+func (s *Server) listWorkflows(w http.ResponseWriter, r *http.Request) {
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	if page < 1 {
+		page = 1
+	}
+
+	pageSize, _ := strconv.Atoi(r.URL.Query().Get("page_size"))
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 20
+	}
+
+	status := r.URL.Query().Get("status")
+
+	workflows, total, err := s.storage.ListWorkflows(r.Context(), s.tenantScope(r), page, pageSize, status)
+	if err != nil {
+		log.Printf("Failed to list workflows: %v", err)
+		s.sendFailure(w, err, apierror.StorageError, "Failed to retrieve workflows")
+		return
+	}
+
+	response := ListWorkflowsResponse{
+		Workflows:  workflows,
+		Total:      total,
+		Page:       page,
+		PageSize:   pageSize,
+		TotalPages: (total + pageSize - 1) / pageSize,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// canAccessWorkflow reports whether the caller's tenant owns the workflow
+func (s *Server) canAccessWorkflow(r *http.Request, wf *types.Workflow) bool {
+	scope := s.tenantScope(r)
+	return scope == "" || wf.Tenant() == scope
+}
@@ -0,0 +1,234 @@
+// Package apierror defines the machine-readable error codes returned by
+// the HTTP API. Each code has a fixed HTTP status, so clients can branch
+// on the code alone.
+package apierror
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"taskflow/internal/breaker"
+	"taskflow/internal/queue"
+	"taskflow/internal/quota"
+	"taskflow/internal/signing"
+	"taskflow/internal/storage"
+	"taskflow/internal/types"
+	"time"
+)
+
+// Code is the code field of an error response
+type Code string
+
+// Error codes returned by the API
+const (
+	InvalidJSON           Code = "INVALID_JSON"
+	InvalidBody           Code = "INVALID_BODY"
+	MissingID             Code = "MISSING_ID"
+	InvalidFieldSelection Code = "INVALID_FIELD_SELECTION"
+	InvalidWait           Code = "INVALID_WAIT"
+	InvalidWindow         Code = "INVALID_WINDOW"
+	InvalidInterval       Code = "INVALID_INTERVAL"
+	InvalidRange          Code = "INVALID_RANGE"
+	InvalidStatus         Code = "INVALID_STATUS"
+	InvalidErrorCode      Code = "INVALID_ERROR_CODE"
+	InvalidFilter         Code = "INVALID_FILTER"
+	Unauthorized          Code = "UNAUTHORIZED"
+	InvalidSignature      Code = "INVALID_SIGNATURE"
+	Forbidden             Code = "FORBIDDEN"
+	ExportNotAllowed      Code = "EXPORT_NOT_ALLOWED"
+	JobNotFound           Code = "JOB_NOT_FOUND"
+	ResultNotFound        Code = "RESULT_NOT_FOUND"
+	WorkflowNotFound      Code = "WORKFLOW_NOT_FOUND"
+	WorkerNotFound        Code = "WORKER_NOT_FOUND"
+	SchemaNotFound        Code = "SCHEMA_NOT_FOUND"
+	TemplateNotFound      Code = "TEMPLATE_NOT_FOUND"
+	QuotasDisabled        Code = "QUOTAS_DISABLED"
+	CannotCancel          Code = "CANNOT_CANCEL"
+	JobConflict           Code = "JOB_CONFLICT"
+	RequestTooLarge       Code = "REQUEST_TOO_LARGE"
+	PayloadTooLarge       Code = "PAYLOAD_TOO_LARGE"
+	ValidationError       Code = "VALIDATION_ERROR"
+	InvalidFields         Code = "INVALID_FIELDS"
+	InvalidSchema         Code = "INVALID_SCHEMA"
+	InvalidTemplate       Code = "INVALID_TEMPLATE"
+	JobTypeDisabled       Code = "JOB_TYPE_DISABLED"
+	RateLimited           Code = "RATE_LIMITED"
+	QuotaExceeded         Code = "QUOTA_EXCEEDED"
+	QueueBackpressure     Code = "QUEUE_BACKPRESSURE"
+	StorageError          Code = "STORAGE_ERROR"
+	QueueError            Code = "QUEUE_ERROR"
+	OffloadError          Code = "OFFLOAD_ERROR"
+	ResultError           Code = "RESULT_ERROR"
+	QuotaError            Code = "QUOTA_ERROR"
+	StatsError            Code = "STATS_ERROR"
+	WorkersError          Code = "WORKERS_ERROR"
+	ControlError          Code = "CONTROL_ERROR"
+	AutoscaleError        Code = "AUTOSCALE_ERROR"
+	WorkflowError         Code = "WORKFLOW_ERROR"
+	SigningError          Code = "SIGNING_ERROR"
+	CancelError           Code = "CANCEL_ERROR"
+	InternalError         Code = "INTERNAL_ERROR"
+	DependencyUnavailable Code = "DEPENDENCY_UNAVAILABLE"
+	Timeout               Code = "TIMEOUT"
+)
+
+// Entry documents an error code
+type Entry struct {
+	Code        Code
+	Status      int
+	Description string
+}
+
+// catalog lists every code, grouped by status
+var catalog = []Entry{
+	{InvalidJSON, http.StatusBadRequest, "The request body is not valid JSON"},
+	{InvalidBody, http.StatusBadRequest, "The request body could not be read"},
+	{MissingID, http.StatusBadRequest, "The path is missing a resource ID"},
+	{InvalidFieldSelection, http.StatusBadRequest, "The fields or include query parameter names an unknown job field"},
+	{InvalidWait, http.StatusBadRequest, "The wait query parameter is not a positive duration"},
+	{InvalidWindow, http.StatusBadRequest, "The window query parameter is not a positive duration"},
+	{InvalidInterval, http.StatusBadRequest, "The interval query parameter is not a positive duration"},
+	{InvalidRange, http.StatusBadRequest, "The window and interval describe too many buckets"},
+	{InvalidStatus, http.StatusBadRequest, "The status query parameter is not a job status"},
+	{InvalidErrorCode, http.StatusBadRequest, "The error_code query parameter is not a job error code"},
+	{InvalidFilter, http.StatusBadRequest, "A since, until or before query parameter is not a valid time or entry ID"},
+	{Unauthorized, http.StatusUnauthorized, "The API key is missing or unknown"},
+	{InvalidSignature, http.StatusUnauthorized, "The request signature is missing, wrong, stale or replayed"},
+	{Forbidden, http.StatusForbidden, "Only operators may use this endpoint"},
+	{ExportNotAllowed, http.StatusForbidden, "A data export reads a table or view outside its tenant's export_tables"},
+	{JobNotFound, http.StatusNotFound, "The job does not exist or belongs to another tenant"},
+	{ResultNotFound, http.StatusNotFound, "The job has not completed, returned no result, or its result expired"},
+	{WorkflowNotFound, http.StatusNotFound, "The workflow does not exist or belongs to another tenant"},
+	{WorkerNotFound, http.StatusNotFound, "The worker is not registered or is offline"},
+	{SchemaNotFound, http.StatusNotFound, "No payload schema is registered for the job type"},
+	{TemplateNotFound, http.StatusNotFound, "No email template is stored under the name"},
+	{QuotasDisabled, http.StatusNotFound, "Quotas are not enabled on this server"},
+	{CannotCancel, http.StatusConflict, "The job already finished"},
+	{JobConflict, http.StatusConflict, "The job changed while the request was handled"},
+	{RequestTooLarge, http.StatusRequestEntityTooLarge, "The request body exceeds MAX_REQUEST_BYTES"},
+	{PayloadTooLarge, http.StatusRequestEntityTooLarge, "A job payload exceeds MAX_PAYLOAD_BYTES"},
+	{ValidationError, http.StatusUnprocessableEntity, "The request is well-formed but invalid, e.g. an unknown job type or a payload that fails its schema"},
+	{InvalidFields, http.StatusUnprocessableEntity, "The request body has unknown fields or values of the wrong type; fields lists them"},
+	{InvalidSchema, http.StatusUnprocessableEntity, "The payload schema is not a valid JSON Schema"},
+	{InvalidTemplate, http.StatusUnprocessableEntity, "The email template has an invalid name, doesn't parse, or defines no subject block"},
+	{JobTypeDisabled, http.StatusUnprocessableEntity, "The job type, or the type of a follow-up, is disabled in the job type config"},
+	{RateLimited, http.StatusTooManyRequests, "The client exceeded its request rate limit, or the job type its submission rate limit; retry after Retry-After"},
+	{QuotaExceeded, http.StatusTooManyRequests, "The tenant or global job quota is used up; retry after Retry-After"},
+	{QueueBackpressure, http.StatusTooManyRequests, "The queue is over capacity; retry after Retry-After"},
+	{StorageError, http.StatusInternalServerError, "The database could not be read or written"},
+	{QueueError, http.StatusInternalServerError, "The job queue could not be read or written"},
+	{OffloadError, http.StatusInternalServerError, "A payload could not be stored in blob storage"},
+	{ResultError, http.StatusInternalServerError, "A result could not be read from blob storage"},
+	{QuotaError, http.StatusInternalServerError, "Quota usage could not be checked"},
+	{StatsError, http.StatusInternalServerError, "Statistics could not be computed"},
+	{WorkersError, http.StatusInternalServerError, "Workers could not be listed"},
+	{ControlError, http.StatusInternalServerError, "The worker command could not be sent"},
+	{AutoscaleError, http.StatusInternalServerError, "Queue metrics could not be read"},
+	{WorkflowError, http.StatusInternalServerError, "The workflow could not be started"},
+	{SigningError, http.StatusInternalServerError, "The request signature could not be checked"},
+	{CancelError, http.StatusInternalServerError, "The job could not be cancelled"},
+	{InternalError, http.StatusInternalServerError, "An unexpected error occurred"},
+	{DependencyUnavailable, http.StatusServiceUnavailable, "Redis or PostgreSQL is down and its circuit breaker is open; retry after Retry-After"},
+	{Timeout, http.StatusGatewayTimeout, "The request took too long to handle"},
+}
+
+var statuses = func() map[Code]int {
+	statuses := make(map[Code]int, len(catalog))
+	for _, entry := range catalog {
+		statuses[entry.Code] = entry.Status
+	}
+	return statuses
+}()
+
+// Catalog returns every error code with its status and meaning
+func Catalog() []Entry {
+	return append([]Entry(nil), catalog...)
+}
+
+// Status returns the HTTP status of a code
+func (c Code) Status() int {
+	if status, ok := statuses[c]; ok {
+		return status
+	}
+	return http.StatusInternalServerError
+}
+
+// FieldError describes a problem with one field of a request body
+type FieldError struct {
+	Field   string `json:"field"`
+	Problem string `json:"problem"`
+}
+
+// Error is a failure to be reported to the client
+type Error struct {
+	Code    Code
+	Message string
+	Details string
+	Fields  []FieldError
+	// RetryAfter is sent as the Retry-After header when set
+	RetryAfter time.Duration
+}
+
+// New creates an API error
+func New(code Code, message, details string) *Error {
+	return &Error{Code: code, Message: message, Details: details}
+}
+
+func (e *Error) Error() string {
+	if e.Details != "" {
+		return string(e.Code) + ": " + e.Message + ": " + e.Details
+	}
+	return string(e.Code) + ": " + e.Message
+}
+
+// Status returns the HTTP status of the error
+func (e *Error) Status() int {
+	return e.Code.Status()
+}
+
+// From maps the well-known errors of storage, queues and request handling
+// to API errors. It returns nil for other errors, which callers log and
+// report with a code of their own.
+func From(err error) *Error {
+	var apiErr *Error
+	var tooLarge *http.MaxBytesError
+	var violation *quota.Violation
+	var open *breaker.OpenError
+
+	switch {
+	case err == nil:
+		return nil
+	case errors.As(err, &apiErr):
+		return apiErr
+	case errors.As(err, &tooLarge):
+		return New(RequestTooLarge, "Request body too large", "Maximum is "+strconv.FormatInt(tooLarge.Limit, 10)+" bytes")
+	case errors.As(err, &violation):
+		return New(QuotaExceeded, "Job submission rejected", violation.Error())
+	case errors.As(err, &open):
+		apiErr := New(DependencyUnavailable, "Service temporarily unavailable", open.Error())
+		apiErr.RetryAfter = open.RetryAfter
+		return apiErr
+	case errors.Is(err, queue.ErrJobConflict):
+		return New(JobConflict, "Job changed while the request was handled", err.Error())
+	case errors.Is(err, types.ErrJobTypeDisabled):
+		return New(JobTypeDisabled, "Job type is disabled", err.Error())
+	case errors.Is(err, storage.ErrJobNotFound):
+		return New(JobNotFound, "Job not found", "")
+	case errors.Is(err, storage.ErrWorkerNotFound):
+		return New(WorkerNotFound, "Worker not found", "")
+	case errors.Is(err, storage.ErrWorkflowNotFound):
+		return New(WorkflowNotFound, "Workflow not found", "")
+	case errors.Is(err, storage.ErrEmailTemplateNotFound):
+		return New(TemplateNotFound, "Email template not found", "")
+	case errors.Is(err, storage.ErrResultNotFound):
+		return New(ResultNotFound, "Job result not found",
+			"The job has not completed, returned no result, or its result has expired")
+	case errors.Is(err, signing.ErrMissingSignature), errors.Is(err, signing.ErrInvalidSignature),
+		errors.Is(err, signing.ErrStaleTimestamp), errors.Is(err, signing.ErrReplayed):
+		return New(InvalidSignature, "Request signature rejected", err.Error())
+	case errors.Is(err, context.DeadlineExceeded):
+		return New(Timeout, "Request timed out", "")
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package apierror
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"taskflow/internal/breaker"
+	"taskflow/internal/queue"
+	"taskflow/internal/quota"
+	"taskflow/internal/signing"
+	"taskflow/internal/storage"
+	"taskflow/internal/types"
+	"testing"
+	"time"
+)
+
+func TestCatalog(t *testing.T) {
+	seen := make(map[Code]bool)
+	for _, entry := range Catalog() {
+		if seen[entry.Code] {
+			t.Errorf("code %s is listed twice", entry.Code)
+		}
+		seen[entry.Code] = true
+		if entry.Status < 400 || entry.Description == "" {
+			t.Errorf("code %s has status %d and description %q", entry.Code, entry.Status, entry.Description)
+		}
+	}
+
+	if got := Code("NOT_A_CODE").Status(); got != http.StatusInternalServerError {
+		t.Errorf("unknown code status = %d, want 500", got)
+	}
+}
+
+func TestFrom(t *testing.T) {
+	tests := []struct {
+		err  error
+		want Code
+	}{
+		{fmt.Errorf("failed to complete: %w", queue.ErrJobConflict), JobConflict},
+		{fmt.Errorf("%w: job-1", storage.ErrJobNotFound), JobNotFound},
+		{fmt.Errorf("%w: worker-1", storage.ErrWorkerNotFound), WorkerNotFound},
+		{fmt.Errorf("%w: wf-1", storage.ErrWorkflowNotFound), WorkflowNotFound},
+		{storage.ErrResultNotFound, ResultNotFound},
+		{fmt.Errorf("%w: sms", types.ErrJobTypeDisabled), JobTypeDisabled},
+		{&quota.Violation{Scope: "tenant", Limit: "jobs_per_minute", Max: 10}, QuotaExceeded},
+		{signing.ErrReplayed, InvalidSignature},
+		{&http.MaxBytesError{Limit: 10}, RequestTooLarge},
+		{New(Forbidden, "no", ""), Forbidden},
+		{fmt.Errorf("failed to get job: %w", &breaker.OpenError{Name: "postgres"}), DependencyUnavailable},
+	}
+
+	for _, tt := range tests {
+		got := From(tt.err)
+		if got == nil || got.Code != tt.want {
+			t.Errorf("From(%v) = %v, want code %s", tt.err, got, tt.want)
+		}
+	}
+
+	open := From(&breaker.OpenError{Name: "redis", RetryAfter: 5 * time.Second})
+	if open.Status() != http.StatusServiceUnavailable || open.RetryAfter != 5*time.Second {
+		t.Errorf("From(open breaker) = status %d, retry after %v", open.Status(), open.RetryAfter)
+	}
+
+	if got := From(errors.New("connection refused")); got != nil {
+		t.Errorf("From(unknown error) = %v, want nil", got)
+	}
+}
@@ -0,0 +1,131 @@
+package autoscale
+
+import (
+	"math"
+	"taskflow/internal/queue"
+	"taskflow/internal/types"
+	"time"
+)
+
+// Config holds the SLO targets used to recommend a worker count
+type Config struct {
+	// TargetLatency is how long a job may wait before it starts. The
+	// recommendation aims to clear the current backlog within this time.
+	TargetLatency time.Duration
+	// WorkerThroughput is the expected jobs per second a single worker
+	// process handles, used until a rate can be measured
+	WorkerThroughput float64
+	// Window is how far back processing rates are measured
+	Window time.Duration
+
+	MinWorkers int
+	MaxWorkers int
+}
+
+// DefaultConfig returns conservative targets for a small deployment
+func DefaultConfig() Config {
+	return Config{
+		TargetLatency:    time.Minute,
+		WorkerThroughput: 1,
+		Window:           5 * time.Minute,
+		MinWorkers:       1,
+		MaxWorkers:       20,
+	}
+}
+
+// QueueSignal is the scaling signal for one job type's queue
+type QueueSignal struct {
+	queue.QueueMetrics
+	Workers        int     `json:"workers"`
+	DesiredWorkers float64 `json:"desired_workers"`
+}
+
+// Signal is the response consumed by external autoscalers. QueueDepth and
+// RecommendedWorkers are top-level so a KEDA metrics-api trigger can read
+// them directly.
+type Signal struct {
+	QueueDepth         int64         `json:"queue_depth"`
+	OldestJobSeconds   float64       `json:"oldest_job_age_seconds"`
+	ProcessedPerSec    float64       `json:"processed_per_second"`
+	CurrentWorkers     int           `json:"current_workers"`
+	RecommendedWorkers int           `json:"recommended_workers"`
+	TargetLatency      float64       `json:"target_latency_seconds"`
+	Queues             []QueueSignal `json:"queues"`
+}
+
+// Recommend computes the scaling signal from queue metrics and the
+// currently registered workers.
+//
+// For each queue the required rate is the arrival rate plus what it takes to
+// clear the backlog within TargetLatency, divided by the per-worker rate.
+// While a queue has a backlog its workers are assumed saturated, so their
+// measured rate is used in place of WorkerThroughput. A queue whose oldest job
+// already exceeds TargetLatency always asks for one more worker than it has.
+func Recommend(cfg Config, metrics []queue.QueueMetrics, workers []types.Worker) *Signal {
+	signal := &Signal{
+		TargetLatency: cfg.TargetLatency.Seconds(),
+		Queues:        make([]QueueSignal, 0, len(metrics)),
+	}
+
+	for _, worker := range workers {
+		if worker.Status != types.WorkerStatusOffline {
+			signal.CurrentWorkers++
+		}
+	}
+
+	var desired float64
+	for _, m := range metrics {
+		qs := QueueSignal{QueueMetrics: m, Workers: countWorkers(workers, m.JobType)}
+
+		perWorker := cfg.WorkerThroughput
+		if m.Depth > 0 && qs.Workers > 0 && m.ProcessedPerSec > 0 {
+			perWorker = m.ProcessedPerSec / float64(qs.Workers)
+		}
+
+		required := m.EnqueuedPerSec
+		if cfg.TargetLatency > 0 {
+			required += float64(m.Depth) / cfg.TargetLatency.Seconds()
+		}
+		if perWorker > 0 {
+			qs.DesiredWorkers = required / perWorker
+		}
+
+		if cfg.TargetLatency > 0 && m.OldestJobAge > cfg.TargetLatency {
+			qs.DesiredWorkers = math.Max(qs.DesiredWorkers, float64(qs.Workers+1))
+		}
+
+		signal.QueueDepth += m.Depth
+		signal.ProcessedPerSec += m.ProcessedPerSec
+		signal.OldestJobSeconds = math.Max(signal.OldestJobSeconds, m.OldestJobSeconds)
+		desired += qs.DesiredWorkers
+		signal.Queues = append(signal.Queues, qs)
+	}
+
+	recommended := int(math.Ceil(desired))
+	if recommended < cfg.MinWorkers {
+		recommended = cfg.MinWorkers
+	}
+	if cfg.MaxWorkers > 0 && recommended > cfg.MaxWorkers {
+		recommended = cfg.MaxWorkers
+	}
+	signal.RecommendedWorkers = recommended
+
+	return signal
+}
+
+// countWorkers returns how many live workers can process jobType
+func countWorkers(workers []types.Worker, jobType types.JobType) int {
+	count := 0
+	for _, worker := range workers {
+		if worker.Status == types.WorkerStatusOffline {
+			continue
+		}
+		for _, t := range worker.JobTypes {
+			if t == jobType {
+				count++
+				break
+			}
+		}
+	}
+	return count
+}
@@ -0,0 +1,89 @@
+package autoscale
+
+import (
+	"taskflow/internal/queue"
+	"taskflow/internal/types"
+	"testing"
+	"time"
+)
+
+func TestRecommendIdleQueueUsesMinimum(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.MinWorkers = 2
+
+	signal := Recommend(cfg, []queue.QueueMetrics{{JobType: types.JobTypeEmail}}, nil)
+
+	if signal.RecommendedWorkers != 2 {
+		t.Errorf("Expected minimum of 2 workers for idle queue, got %d", signal.RecommendedWorkers)
+	}
+}
+
+func TestRecommendClearsBacklogWithinTarget(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.TargetLatency = 10 * time.Second
+	cfg.WorkerThroughput = 2
+
+	// 100 jobs in 10s at 2 jobs/s per worker needs 5 workers
+	metrics := []queue.QueueMetrics{{JobType: types.JobTypeEmail, Depth: 100}}
+
+	signal := Recommend(cfg, metrics, nil)
+
+	if signal.RecommendedWorkers != 5 {
+		t.Errorf("Expected 5 workers, got %d", signal.RecommendedWorkers)
+	}
+	if signal.QueueDepth != 100 {
+		t.Errorf("Expected queue depth 100, got %d", signal.QueueDepth)
+	}
+}
+
+func TestRecommendUsesMeasuredRateWhenSaturated(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.TargetLatency = 10 * time.Second
+	cfg.WorkerThroughput = 100
+
+	workers := []types.Worker{
+		{ID: "w1", Status: types.WorkerStatusProcessing, JobTypes: []types.JobType{types.JobTypeEmail}},
+		{ID: "w2", Status: types.WorkerStatusProcessing, JobTypes: []types.JobType{types.JobTypeEmail}},
+	}
+	// Two workers manage 1 job/s together, so each handles 0.5 jobs/s
+	metrics := []queue.QueueMetrics{{JobType: types.JobTypeEmail, Depth: 20, ProcessedPerSec: 1}}
+
+	signal := Recommend(cfg, metrics, workers)
+
+	if signal.RecommendedWorkers != 4 {
+		t.Errorf("Expected 4 workers, got %d", signal.RecommendedWorkers)
+	}
+	if signal.CurrentWorkers != 2 {
+		t.Errorf("Expected 2 current workers, got %d", signal.CurrentWorkers)
+	}
+}
+
+func TestRecommendScalesUpWhenOldestJobExceedsTarget(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.TargetLatency = 30 * time.Second
+	cfg.WorkerThroughput = 1000
+
+	workers := []types.Worker{
+		{ID: "w1", Status: types.WorkerStatusIdle, JobTypes: []types.JobType{types.JobTypeWebhook}},
+	}
+	metrics := []queue.QueueMetrics{{JobType: types.JobTypeWebhook, Depth: 1, OldestJobAge: time.Minute}}
+
+	signal := Recommend(cfg, metrics, workers)
+
+	if signal.RecommendedWorkers != 2 {
+		t.Errorf("Expected 2 workers when the oldest job misses the target, got %d", signal.RecommendedWorkers)
+	}
+}
+
+func TestRecommendCapsAtMaximum(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.MaxWorkers = 3
+
+	metrics := []queue.QueueMetrics{{JobType: types.JobTypeEmail, Depth: 10000}}
+
+	signal := Recommend(cfg, metrics, nil)
+
+	if signal.RecommendedWorkers != 3 {
+		t.Errorf("Expected recommendation capped at 3, got %d", signal.RecommendedWorkers)
+	}
+}
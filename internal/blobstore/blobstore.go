@@ -0,0 +1,152 @@
+package blobstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ErrNotFound is returned when a referenced blob does not exist
+var ErrNotFound = errors.New("blob not found")
+
+// Store persists opaque blobs outside Redis and PostgreSQL.
+// Refs returned by Put are URLs that Get and Delete accept.
+type Store interface {
+	Put(ctx context.Context, key string, r io.Reader) (ref string, err error)
+	Get(ctx context.Context, ref string) (io.ReadCloser, error)
+	Delete(ctx context.Context, ref string) error
+}
+
+// Presigner is implemented by stores that can hand out temporary download
+// URLs, so clients fetch large blobs directly instead of through the API
+type Presigner interface {
+	PresignGet(ctx context.Context, ref string, ttl time.Duration) (string, error)
+}
+
+// Checker is implemented by stores that can check they are reachable
+// without writing a blob
+type Checker interface {
+	Check(ctx context.Context) error
+}
+
+// Open creates a store from a URL:
+//
+//	file:///var/lib/taskflow/blobs
+//	s3://bucket/prefix?region=eu-west-1&endpoint=http://minio:9000
+func Open(ctx context.Context, rawURL string) (Store, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid blob store URL: %w", err)
+	}
+
+	switch u.Scheme {
+	case "file":
+		return NewFileStore(u.Path)
+	case "s3":
+		return NewS3Store(ctx, u.Host, strings.TrimPrefix(u.Path, "/"), u.Query().Get("region"), u.Query().Get("endpoint"))
+	default:
+		return nil, fmt.Errorf("unsupported blob store scheme: %s", u.Scheme)
+	}
+}
+
+// FileStore keeps blobs on a local or shared filesystem
+type FileStore struct {
+	root string
+}
+
+func NewFileStore(root string) (*FileStore, error) {
+	if root == "" {
+		return nil, fmt.Errorf("file blob store requires a directory")
+	}
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create blob directory: %w", err)
+	}
+	return &FileStore{root: root}, nil
+}
+
+func (f *FileStore) Put(ctx context.Context, key string, r io.Reader) (string, error) {
+	path := filepath.Join(f.root, filepath.FromSlash(key))
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", fmt.Errorf("failed to create blob directory: %w", err)
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to create blob: %w", err)
+	}
+	defer file.Close()
+
+	if _, err := io.Copy(file, r); err != nil {
+		// Don't leave a partial blob behind
+		file.Close()
+		os.Remove(path)
+		return "", fmt.Errorf("failed to write blob: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return "", fmt.Errorf("failed to write blob: %w", err)
+	}
+
+	return (&url.URL{Scheme: "file", Path: path}).String(), nil
+}
+
+func (f *FileStore) Get(ctx context.Context, ref string) (io.ReadCloser, error) {
+	path, err := f.path(ref)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to open blob: %w", err)
+	}
+
+	return file, nil
+}
+
+func (f *FileStore) Delete(ctx context.Context, ref string) error {
+	path, err := f.path(ref)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to delete blob: %w", err)
+	}
+	return nil
+}
+
+// Check fails if the store's directory is gone or not a directory
+func (f *FileStore) Check(ctx context.Context) error {
+	info, err := os.Stat(f.root)
+	if err != nil {
+		return fmt.Errorf("failed to stat blob directory: %w", err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("blob directory %s is not a directory", f.root)
+	}
+	return nil
+}
+
+// path resolves a file:// ref, refusing paths outside the store root
+func (f *FileStore) path(ref string) (string, error) {
+	u, err := url.Parse(ref)
+	if err != nil || u.Scheme != "file" {
+		return "", fmt.Errorf("invalid file blob ref: %s", ref)
+	}
+
+	rel, err := filepath.Rel(f.root, u.Path)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return "", fmt.Errorf("blob ref outside store root: %s", ref)
+	}
+
+	return u.Path, nil
+}
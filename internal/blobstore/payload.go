@@ -0,0 +1,84 @@
+package blobstore
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"taskflow/internal/encryption"
+	"taskflow/internal/types"
+)
+
+// PayloadOffloader moves oversized job payloads into a blob store, leaving
+// only a reference on the job, and restores them before processing.
+// Offloaded blobs are not deleted automatically; use bucket lifecycle
+// rules or a cron job to expire them.
+type PayloadOffloader struct {
+	store     Store
+	threshold int
+	cipher    *encryption.Cipher
+}
+
+// NewPayloadOffloader offloads payloads larger than threshold bytes.
+// Blobs are encrypted with cipher when one is configured.
+func NewPayloadOffloader(store Store, threshold int, cipher *encryption.Cipher) *PayloadOffloader {
+	return &PayloadOffloader{
+		store:     store,
+		threshold: threshold,
+		cipher:    cipher,
+	}
+}
+
+// Offload stores the job's payload in the blob store if it exceeds the
+// threshold, replacing it with a reference. It reports whether it did so.
+func (o *PayloadOffloader) Offload(ctx context.Context, job *types.Job) (bool, error) {
+	if o == nil || o.threshold <= 0 || len(job.Payload) <= o.threshold {
+		return false, nil
+	}
+
+	data, err := o.cipher.Seal(ctx, job.Payload)
+	if err != nil {
+		return false, fmt.Errorf("failed to encrypt payload: %w", err)
+	}
+
+	key := fmt.Sprintf("payloads/%s/%s.json", job.Tenant(), job.ID)
+	ref, err := o.store.Put(ctx, key, bytes.NewReader(data))
+	if err != nil {
+		return false, err
+	}
+
+	job.PayloadRef = ref
+	job.Payload = json.RawMessage("null")
+
+	return true, nil
+}
+
+// Rehydrate loads an offloaded payload back onto the job
+func (o *PayloadOffloader) Rehydrate(ctx context.Context, job *types.Job) error {
+	if job.PayloadRef == "" {
+		return nil
+	}
+	if o == nil {
+		return fmt.Errorf("job payload is stored at %s but no blob store is configured", job.PayloadRef)
+	}
+
+	body, err := o.store.Get(ctx, job.PayloadRef)
+	if err != nil {
+		return fmt.Errorf("failed to fetch offloaded payload: %w", err)
+	}
+	defer body.Close()
+
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return fmt.Errorf("failed to read offloaded payload: %w", err)
+	}
+
+	payload, err := o.cipher.Open(ctx, data)
+	if err != nil {
+		return fmt.Errorf("failed to decrypt offloaded payload: %w", err)
+	}
+
+	job.Payload = payload
+	return nil
+}
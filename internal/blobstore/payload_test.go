@@ -0,0 +1,67 @@
+package blobstore
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"taskflow/internal/types"
+	"testing"
+)
+
+func TestPayloadOffloadRoundTrip(t *testing.T) {
+	store, err := NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create file store: %v", err)
+	}
+
+	offloader := NewPayloadOffloader(store, 64, nil)
+	ctx := context.Background()
+
+	payload := json.RawMessage(`{"body": "` + strings.Repeat("x", 128) + `"}`)
+	job := &types.Job{ID: "job-1", Payload: payload}
+
+	offloaded, err := offloader.Offload(ctx, job)
+	if err != nil {
+		t.Fatalf("Expected no error offloading payload, got %v", err)
+	}
+	if !offloaded || job.PayloadRef == "" {
+		t.Fatal("Expected large payload to be offloaded")
+	}
+	if string(job.Payload) != "null" {
+		t.Errorf("Expected offloaded job payload to be null, got %s", job.Payload)
+	}
+
+	if err := offloader.Rehydrate(ctx, job); err != nil {
+		t.Fatalf("Expected no error rehydrating payload, got %v", err)
+	}
+	if !bytes.Equal(job.Payload, payload) {
+		t.Errorf("Expected rehydrated payload %s, got %s", payload, job.Payload)
+	}
+}
+
+func TestPayloadBelowThresholdStaysInline(t *testing.T) {
+	store, err := NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create file store: %v", err)
+	}
+
+	offloader := NewPayloadOffloader(store, 1024, nil)
+	job := &types.Job{ID: "job-2", Payload: json.RawMessage(`{"to": "user@example.com"}`)}
+
+	offloaded, err := offloader.Offload(context.Background(), job)
+	if err != nil || offloaded {
+		t.Errorf("Expected small payload to stay inline, got offloaded=%v err=%v", offloaded, err)
+	}
+}
+
+func TestFileStoreRejectsRefsOutsideRoot(t *testing.T) {
+	store, err := NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create file store: %v", err)
+	}
+
+	if _, err := store.Get(context.Background(), "file:///etc/passwd"); err == nil {
+		t.Error("Expected ref outside the store root to be rejected")
+	}
+}
@@ -0,0 +1,170 @@
+package blobstore
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"taskflow/internal/encryption"
+	"taskflow/internal/types"
+	"time"
+)
+
+// ResultOffloader keeps job results larger than a threshold in a blob
+// store, so that only a reference is stored with the job. Unlike offloaded
+// payloads, result blobs are deleted when the result expires.
+type ResultOffloader struct {
+	store     Store
+	threshold int
+	cipher    *encryption.Cipher
+}
+
+// NewResultOffloader offloads results larger than threshold bytes.
+// Blobs are encrypted with cipher when one is configured.
+func NewResultOffloader(store Store, threshold int, cipher *encryption.Cipher) *ResultOffloader {
+	return &ResultOffloader{
+		store:     store,
+		threshold: threshold,
+		cipher:    cipher,
+	}
+}
+
+// Offload stores a job's result in the blob store if it exceeds the
+// threshold and returns its reference, or "" if it should be kept inline
+func (o *ResultOffloader) Offload(ctx context.Context, job *types.Job, result json.RawMessage) (string, error) {
+	if o == nil || o.threshold <= 0 || len(result) <= o.threshold {
+		return "", nil
+	}
+
+	data, err := o.cipher.Seal(ctx, result)
+	if err != nil {
+		return "", fmt.Errorf("failed to encrypt result: %w", err)
+	}
+
+	key := fmt.Sprintf("results/%s/%s.json", job.Tenant(), job.ID)
+	return o.store.Put(ctx, key, bytes.NewReader(data))
+}
+
+// StreamedResult describes a result streamed to the blob store
+type StreamedResult struct {
+	Ref      string
+	Size     int
+	Checksum string // "sha256:" and the hex digest of the result
+}
+
+// Stream copies a result from r to the blob store as it is read, so that
+// it is never held in memory. Results that are encrypted or compressed
+// are read into memory first, since the cipher seals whole values.
+func (o *ResultOffloader) Stream(ctx context.Context, job *types.Job, r io.Reader) (*StreamedResult, error) {
+	if o == nil {
+		return nil, fmt.Errorf("streamed results need a blob store")
+	}
+
+	digest := &digestWriter{hash: sha256.New()}
+	body := io.TeeReader(r, digest)
+	if o.cipher != nil {
+		data, err := io.ReadAll(body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read result: %w", err)
+		}
+		if data, err = o.cipher.Seal(ctx, data); err != nil {
+			return nil, fmt.Errorf("failed to encrypt result: %w", err)
+		}
+		body = bytes.NewReader(data)
+	}
+
+	key := fmt.Sprintf("results/%s/%s", job.Tenant(), job.ID)
+	ref, err := o.store.Put(ctx, key, body)
+	if err != nil {
+		return nil, err
+	}
+
+	return &StreamedResult{
+		Ref:      ref,
+		Size:     digest.size,
+		Checksum: "sha256:" + hex.EncodeToString(digest.hash.Sum(nil)),
+	}, nil
+}
+
+// digestWriter hashes and counts the bytes written to it
+type digestWriter struct {
+	hash hash.Hash
+	size int
+}
+
+func (d *digestWriter) Write(p []byte) (int, error) {
+	d.size += len(p)
+	return d.hash.Write(p)
+}
+
+// Load reads an offloaded result
+func (o *ResultOffloader) Load(ctx context.Context, ref string) (json.RawMessage, error) {
+	if o == nil {
+		return nil, fmt.Errorf("job result is stored at %s but no blob store is configured", ref)
+	}
+
+	body, err := o.store.Get(ctx, ref)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch offloaded result: %w", err)
+	}
+	defer body.Close()
+
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read offloaded result: %w", err)
+	}
+
+	result, err := o.cipher.Open(ctx, data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt offloaded result: %w", err)
+	}
+	return result, nil
+}
+
+// Open streams an offloaded result. Encrypted or compressed results are
+// decoded first, so they are read into memory.
+func (o *ResultOffloader) Open(ctx context.Context, ref string) (io.ReadCloser, error) {
+	if o == nil {
+		return nil, fmt.Errorf("job result is stored at %s but no blob store is configured", ref)
+	}
+	if o.cipher == nil {
+		return o.store.Get(ctx, ref)
+	}
+
+	result, err := o.Load(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+	return io.NopCloser(bytes.NewReader(result)), nil
+}
+
+// DownloadURL returns a temporary URL the client can fetch an offloaded
+// result from directly. It reports false if the store can't presign URLs
+// or the blob is encrypted or compressed and must be served through the API.
+func (o *ResultOffloader) DownloadURL(ctx context.Context, ref string, ttl time.Duration) (string, bool, error) {
+	if o == nil || o.cipher != nil {
+		return "", false, nil
+	}
+	presigner, ok := o.store.(Presigner)
+	if !ok {
+		return "", false, nil
+	}
+
+	url, err := presigner.PresignGet(ctx, ref, ttl)
+	if err != nil {
+		return "", false, err
+	}
+	return url, true, nil
+}
+
+// Delete removes an offloaded result
+func (o *ResultOffloader) Delete(ctx context.Context, ref string) error {
+	if o == nil {
+		return nil
+	}
+	return o.store.Delete(ctx, ref)
+}
@@ -0,0 +1,67 @@
+package blobstore
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+	"taskflow/internal/encryption"
+	"taskflow/internal/types"
+	"testing"
+)
+
+func TestResultStreamRoundTrip(t *testing.T) {
+	key := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{7}, 32))
+	provider, err := encryption.NewLocalKeyProvider("test", key)
+	if err != nil {
+		t.Fatalf("Failed to create key provider: %v", err)
+	}
+
+	result := []byte(strings.Repeat("id,name\n1,Record 1\n", 1000))
+	sum := sha256.Sum256(result)
+	checksum := "sha256:" + hex.EncodeToString(sum[:])
+
+	ciphers := map[string]*encryption.Cipher{
+		"plain":     nil,
+		"encrypted": encryption.NewCipher(provider),
+	}
+	for name, cipher := range ciphers {
+		t.Run(name, func(t *testing.T) {
+			store, err := NewFileStore(t.TempDir())
+			if err != nil {
+				t.Fatalf("Failed to create file store: %v", err)
+			}
+
+			offloader := NewResultOffloader(store, 0, cipher)
+			ctx := context.Background()
+
+			streamed, err := offloader.Stream(ctx, &types.Job{ID: "job-1"}, bytes.NewReader(result))
+			if err != nil {
+				t.Fatalf("Expected no error streaming result, got %v", err)
+			}
+			if streamed.Size != len(result) {
+				t.Errorf("Expected size %d, got %d", len(result), streamed.Size)
+			}
+			if streamed.Checksum != checksum {
+				t.Errorf("Expected checksum %s, got %s", checksum, streamed.Checksum)
+			}
+
+			loaded, err := offloader.Load(ctx, streamed.Ref)
+			if err != nil {
+				t.Fatalf("Expected no error loading result, got %v", err)
+			}
+			if !bytes.Equal(loaded, result) {
+				t.Errorf("Expected streamed result to round-trip, got %.40s", loaded)
+			}
+		})
+	}
+}
+
+func TestResultStreamWithoutStore(t *testing.T) {
+	var offloader *ResultOffloader
+	if _, err := offloader.Stream(context.Background(), &types.Job{ID: "job-1"}, strings.NewReader("x")); err == nil {
+		t.Error("Expected error streaming a result without a blob store")
+	}
+}
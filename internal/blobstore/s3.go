@@ -0,0 +1,146 @@
+package blobstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// S3Store keeps blobs in an S3 (or S3-compatible) bucket
+type S3Store struct {
+	client   *s3.Client
+	uploader *manager.Uploader
+	bucket   string
+	prefix   string
+}
+
+// NewS3Store creates a store using the default AWS credential chain.
+// A custom endpoint enables S3-compatible services such as MinIO.
+func NewS3Store(ctx context.Context, bucket, prefix, region, endpoint string) (*S3Store, error) {
+	if bucket == "" {
+		return nil, fmt.Errorf("s3 blob store requires a bucket")
+	}
+
+	var opts []func(*awsconfig.LoadOptions) error
+	if region != "" {
+		opts = append(opts, awsconfig.WithRegion(region))
+	}
+
+	cfg, err := awsconfig.LoadDefaultConfig(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS config: %w", err)
+	}
+
+	client := s3.NewFromConfig(cfg, func(o *s3.Options) {
+		if endpoint != "" {
+			o.BaseEndpoint = aws.String(endpoint)
+			o.UsePathStyle = true
+		}
+	})
+
+	return &S3Store{
+		client:   client,
+		uploader: manager.NewUploader(client),
+		bucket:   bucket,
+		prefix:   prefix,
+	}, nil
+}
+
+func (s *S3Store) Put(ctx context.Context, key string, r io.Reader) (string, error) {
+	objectKey := path.Join(s.prefix, key)
+
+	_, err := s.uploader.Upload(ctx, &s3.PutObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(objectKey),
+		Body:   r,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to upload blob: %w", err)
+	}
+
+	return (&url.URL{Scheme: "s3", Host: s.bucket, Path: "/" + objectKey}).String(), nil
+}
+
+func (s *S3Store) Get(ctx context.Context, ref string) (io.ReadCloser, error) {
+	bucket, key, err := parseS3Ref(ref)
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := s.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		var noSuchKey *s3types.NoSuchKey
+		if errors.As(err, &noSuchKey) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to download blob: %w", err)
+	}
+
+	return out.Body, nil
+}
+
+func (s *S3Store) Delete(ctx context.Context, ref string) error {
+	bucket, key, err := parseS3Ref(ref)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete blob: %w", err)
+	}
+	return nil
+}
+
+// Check reaches the bucket with HeadBucket, failing if it doesn't exist
+// or the credentials can't access it
+func (s *S3Store) Check(ctx context.Context) error {
+	_, err := s.client.HeadBucket(ctx, &s3.HeadBucketInput{Bucket: aws.String(s.bucket)})
+	if err != nil {
+		return fmt.Errorf("failed to reach bucket %s: %w", s.bucket, err)
+	}
+	return nil
+}
+
+// PresignGet returns a URL that downloads the blob without credentials
+// until ttl has passed
+func (s *S3Store) PresignGet(ctx context.Context, ref string, ttl time.Duration) (string, error) {
+	bucket, key, err := parseS3Ref(ref)
+	if err != nil {
+		return "", err
+	}
+
+	req, err := s3.NewPresignClient(s.client).PresignGetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	}, s3.WithPresignExpires(ttl))
+	if err != nil {
+		return "", fmt.Errorf("failed to presign blob: %w", err)
+	}
+	return req.URL, nil
+}
+
+func parseS3Ref(ref string) (string, string, error) {
+	u, err := url.Parse(ref)
+	if err != nil || u.Scheme != "s3" || u.Host == "" {
+		return "", "", fmt.Errorf("invalid s3 blob ref: %s", ref)
+	}
+	return u.Host, strings.TrimPrefix(u.Path, "/"), nil
+}
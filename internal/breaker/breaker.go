@@ -0,0 +1,228 @@
+// Package breaker implements circuit breakers for calls to Redis and
+// PostgreSQL. After repeated failures a breaker opens and rejects calls
+// immediately, instead of letting each one wait for a timeout against a
+// dependency that is down. After a cool-down it lets a single trial call
+// through and closes again if that call succeeds.
+package breaker
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// State is the state of a circuit breaker
+type State int
+
+const (
+	// Closed lets every call through
+	Closed State = iota
+	// HalfOpen lets a single trial call through
+	HalfOpen
+	// Open rejects every call
+	Open
+)
+
+func (s State) String() string {
+	switch s {
+	case Closed:
+		return "closed"
+	case HalfOpen:
+		return "half_open"
+	case Open:
+		return "open"
+	}
+	return "unknown"
+}
+
+// ErrOpen matches the errors returned for calls rejected by an open breaker
+var ErrOpen = errors.New("circuit breaker is open")
+
+// OpenError is returned for a call rejected by an open breaker
+type OpenError struct {
+	Name       string
+	RetryAfter time.Duration
+}
+
+func (e *OpenError) Error() string {
+	return fmt.Sprintf("%s is unavailable: circuit breaker is open, retry in %v", e.Name, e.RetryAfter)
+}
+
+// Is reports whether target is ErrOpen
+func (e *OpenError) Is(target error) bool {
+	return target == ErrOpen
+}
+
+// Config sets when a breaker opens and for how long
+type Config struct {
+	// FailureThreshold is the number of consecutive failures that opens
+	// the breaker. Zero disables the breaker.
+	FailureThreshold int
+	// OpenTimeout is how long the breaker stays open before it lets a
+	// trial call through
+	OpenTimeout time.Duration
+}
+
+// DefaultConfig returns the settings used when none are configured
+func DefaultConfig() Config {
+	return Config{FailureThreshold: 5, OpenTimeout: 15 * time.Second}
+}
+
+// Breaker is a circuit breaker for one dependency. A nil Breaker lets
+// every call through.
+type Breaker struct {
+	name     string
+	config   Config
+	onChange func(name string, state State)
+	now      func() time.Time
+
+	mu         sync.Mutex
+	state      State
+	failures   int
+	openedAt   time.Time
+	probeSince time.Time // when the trial call of a half-open breaker started
+}
+
+// Option configures optional Breaker behaviour
+type Option func(*Breaker)
+
+// WithOnChange calls fn after every state change, e.g. to log it or
+// update a metric
+func WithOnChange(fn func(name string, state State)) Option {
+	return func(b *Breaker) {
+		b.onChange = fn
+	}
+}
+
+// New creates a closed breaker for the named dependency
+func New(name string, config Config, opts ...Option) *Breaker {
+	b := &Breaker{name: name, config: config, now: time.Now}
+	for _, opt := range opts {
+		opt(b)
+	}
+	return b
+}
+
+// Name returns the name of the dependency
+func (b *Breaker) Name() string {
+	return b.name
+}
+
+// State returns the current state
+func (b *Breaker) State() State {
+	if b == nil {
+		return Closed
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == Open && b.now().Sub(b.openedAt) >= b.config.OpenTimeout {
+		return HalfOpen
+	}
+	return b.state
+}
+
+// Failures returns the number of consecutive failures
+func (b *Breaker) Failures() int {
+	if b == nil {
+		return 0
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.failures
+}
+
+// RetryAfter returns how long until an open breaker lets a trial call
+// through, or zero when it isn't open
+func (b *Breaker) RetryAfter() time.Duration {
+	if b == nil {
+		return 0
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.retryAfter()
+}
+
+func (b *Breaker) retryAfter() time.Duration {
+	if b.state == Closed {
+		return 0
+	}
+	remaining := b.config.OpenTimeout - b.now().Sub(b.openedAt)
+	// A half-open breaker with a trial call in flight decides soon
+	return max(remaining, time.Second).Round(time.Second)
+}
+
+// Allow reports whether a call may go ahead. It returns an *OpenError
+// when the breaker is open, or when it is half-open and already waiting
+// for its trial call. Callers that go ahead report the outcome with
+// Success or Failure.
+func (b *Breaker) Allow() error {
+	if b == nil || b.config.FailureThreshold <= 0 {
+		return nil
+	}
+
+	b.mu.Lock()
+	now := b.now()
+	switch b.state {
+	case Open:
+		if now.Sub(b.openedAt) < b.config.OpenTimeout {
+			err := &OpenError{Name: b.name, RetryAfter: b.retryAfter()}
+			b.mu.Unlock()
+			return err
+		}
+		b.probeSince = now
+		b.transition(HalfOpen)
+		return nil
+	case HalfOpen:
+		// Let another trial call through if the last one never reported
+		// back, e.g. because its caller gave up
+		if now.Sub(b.probeSince) < b.config.OpenTimeout {
+			err := &OpenError{Name: b.name, RetryAfter: b.retryAfter()}
+			b.mu.Unlock()
+			return err
+		}
+		b.probeSince = now
+	}
+	b.mu.Unlock()
+	return nil
+}
+
+// Success records a call that reached the dependency. It closes a
+// half-open breaker.
+func (b *Breaker) Success() {
+	if b == nil || b.config.FailureThreshold <= 0 {
+		return
+	}
+	b.mu.Lock()
+	b.failures = 0
+	if b.state != Closed {
+		b.transition(Closed)
+		return
+	}
+	b.mu.Unlock()
+}
+
+// Failure records a call that failed because of the dependency. It opens
+// the breaker at the failure threshold, and reopens a half-open one.
+func (b *Breaker) Failure() {
+	if b == nil || b.config.FailureThreshold <= 0 {
+		return
+	}
+	b.mu.Lock()
+	b.failures++
+	if b.state == HalfOpen || (b.state == Closed && b.failures >= b.config.FailureThreshold) {
+		b.openedAt = b.now()
+		b.transition(Open)
+		return
+	}
+	b.mu.Unlock()
+}
+
+// transition changes the state and unlocks b, then reports the change
+func (b *Breaker) transition(state State) {
+	b.state = state
+	b.mu.Unlock()
+	if b.onChange != nil {
+		b.onChange(b.name, state)
+	}
+}
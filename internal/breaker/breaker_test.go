@@ -0,0 +1,78 @@
+package breaker
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestBreaker(t *testing.T) {
+	now := time.Now()
+	b := New("redis", Config{FailureThreshold: 3, OpenTimeout: 10 * time.Second})
+	b.now = func() time.Time { return now }
+
+	for i := 0; i < 2; i++ {
+		if err := b.Allow(); err != nil {
+			t.Fatalf("Allow before the threshold = %v", err)
+		}
+		b.Failure()
+	}
+	b.Success()
+	if b.Failures() != 0 {
+		t.Errorf("failures after a success = %d, want 0", b.Failures())
+	}
+
+	for i := 0; i < 3; i++ {
+		b.Failure()
+	}
+	if b.State() != Open {
+		t.Fatalf("state after 3 failures = %v, want open", b.State())
+	}
+
+	err := b.Allow()
+	var open *OpenError
+	if !errors.As(err, &open) || !errors.Is(err, ErrOpen) {
+		t.Fatalf("Allow on an open breaker = %v, want an OpenError", err)
+	}
+	if open.RetryAfter != 10*time.Second {
+		t.Errorf("retry after = %v, want 10s", open.RetryAfter)
+	}
+
+	// After the timeout one trial call goes through
+	now = now.Add(10 * time.Second)
+	if err := b.Allow(); err != nil {
+		t.Fatalf("trial call rejected: %v", err)
+	}
+	if err := b.Allow(); !errors.Is(err, ErrOpen) {
+		t.Errorf("second call during the trial = %v, want ErrOpen", err)
+	}
+
+	// A failed trial reopens the breaker, a successful one closes it
+	b.Failure()
+	if b.State() != Open {
+		t.Fatalf("state after a failed trial = %v, want open", b.State())
+	}
+	now = now.Add(10 * time.Second)
+	if err := b.Allow(); err != nil {
+		t.Fatalf("trial call rejected: %v", err)
+	}
+	b.Success()
+	if b.State() != Closed || b.Allow() != nil {
+		t.Errorf("state after a successful trial = %v, want closed", b.State())
+	}
+}
+
+func TestBreakerDisabled(t *testing.T) {
+	b := New("postgres", Config{})
+	for i := 0; i < 100; i++ {
+		b.Failure()
+	}
+	if err := b.Allow(); err != nil {
+		t.Errorf("a disabled breaker rejected a call: %v", err)
+	}
+
+	var nilBreaker *Breaker
+	if err := nilBreaker.Allow(); err != nil || nilBreaker.State() != Closed {
+		t.Error("a nil breaker should let calls through")
+	}
+}
@@ -0,0 +1,132 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"taskflow/internal/types"
+	"testing"
+	"time"
+)
+
+func writeConfig(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadFile(t *testing.T) {
+	files := map[string]string{
+		"taskflow.yaml": `
+server:
+  addr: ":9090"
+  read_timeout: 20s
+redis:
+  addr: redis:6379
+worker:
+  count: 8
+job_types:
+  types:
+    webhook:
+      timeout: 1m
+      max_attempts: 5
+`,
+		"taskflow.toml": `
+[server]
+addr = ":9090"
+read_timeout = "20s"
+
+[redis]
+addr = "redis:6379"
+
+[worker]
+count = 8
+
+[job_types.types.webhook]
+timeout = "1m"
+max_attempts = 5
+`,
+	}
+
+	for name, content := range files {
+		t.Run(name, func(t *testing.T) {
+			config, err := Load(writeConfig(t, name, content))
+			if err != nil {
+				t.Fatalf("Load: %v", err)
+			}
+
+			if config.Server.Addr != ":9090" || config.Server.ReadTimeout != 20*time.Second {
+				t.Errorf("server = %+v", config.Server)
+			}
+			if config.Server.WriteTimeout != 15*time.Second {
+				t.Errorf("write timeout = %v, want the default", config.Server.WriteTimeout)
+			}
+			if config.Redis.Addr != "redis:6379" || config.Worker.Count != 8 {
+				t.Errorf("redis = %+v, worker = %+v", config.Redis, config.Worker)
+			}
+
+			webhook := config.JobTypes.Types[types.JobTypeWebhook]
+			if webhook.Timeout != types.Duration(time.Minute) || webhook.MaxAttempts != 5 {
+				t.Errorf("webhook job type = %+v", webhook)
+			}
+		})
+	}
+}
+
+func TestLoadEnvOverridesFile(t *testing.T) {
+	path := writeConfig(t, "taskflow.yaml", "server:\n  addr: \":9090\"\nworker:\n  count: 8\n")
+	t.Setenv("SERVER_ADDR", ":7070")
+	t.Setenv("WORKER_CONCURRENCY", "4")
+	t.Setenv("QUEUE_BACKEND", "sqs")
+	t.Setenv("AUTOSCALE_WORKER_THROUGHPUT", "2.5")
+
+	config, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if config.Server.Addr != ":7070" || config.Worker.Count != 4 {
+		t.Errorf("addr = %s, count = %d, want the environment's", config.Server.Addr, config.Worker.Count)
+	}
+	if config.Queue.Backend != "sqs" || config.Autoscale.WorkerThroughput != 2.5 {
+		t.Errorf("queue = %+v, autoscale = %+v, want the environment's", config.Queue, config.Autoscale)
+	}
+	if config.Queue.SQS.QueuePrefix != "taskflow-" {
+		t.Errorf("sqs queue prefix = %q, want the default", config.Queue.SQS.QueuePrefix)
+	}
+}
+
+func TestLoadInvalid(t *testing.T) {
+	tests := map[string]struct {
+		name, content, env, want string
+	}{
+		"unknown yaml key":    {"taskflow.yaml", "server:\n  adr: \":9090\"\n", "", "adr"},
+		"unknown toml key":    {"taskflow.toml", "[server]\nadr = \":9090\"\n", "", "server.adr"},
+		"unknown extension":   {"taskflow.ini", "", "", "unsupported"},
+		"invalid merged":      {"taskflow.yaml", "worker:\n  count: 500\n", "", "worker count"},
+		"invalid env":         {"taskflow.yaml", "", "soon", "WORKER_POLL_INTERVAL"},
+		"invalid backend":     {"taskflow.yaml", "queue:\n  backend: kafka\n", "", "queue backend"},
+		"invalid retention":   {"taskflow.yaml", "database:\n  job_retention: -1h\n", "", "job retention"},
+		"invalid compress":    {"taskflow.yaml", "payloads:\n  compression: lz4\n", "", "payload compression"},
+		"short lease":         {"taskflow.yaml", "server:\n  leader_lease_ttl: 100ms\n", "", "leader lease"},
+		"webhook creds":       {"taskflow.yaml", "webhooks:\n  credentials:\n    crm:\n      oauth2:\n        client_id: taskflow\n", "", "token_url"},
+		"long export urls":    {"taskflow.yaml", "worker:\n  export_url_ttl: 720h\n", "", "export url ttl"},
+		"negative row limit":  {"taskflow.yaml", "worker:\n  export_max_rows: -1\n", "", "export limits"},
+		"smtp without sender": {"taskflow.yaml", "processors:\n  email:\n    smtp_host: smtp.example.com\n", "", "sender address"},
+		"unknown job type":    {"taskflow.yaml", "worker:\n  job_types: email,video\n", "", "worker job types"},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if tt.env != "" {
+				t.Setenv("WORKER_POLL_INTERVAL", tt.env)
+			}
+			_, err := Load(writeConfig(t, tt.name, tt.content))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Load error = %v, want one mentioning %q", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,192 @@
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"os/signal"
+	"reflect"
+	"sort"
+	"strconv"
+	"syscall"
+	"taskflow/internal/logger"
+	"taskflow/internal/types"
+	"time"
+)
+
+// Change is a tunable setting changed by a reload
+type Change struct {
+	Setting string
+	Old     string
+	New     string
+}
+
+// diffTunables lists the settings that a reload can apply without a
+// restart, and that differ between old and next: the log level, rate
+// limits and job type settings, which include concurrency and retry
+// policies
+func diffTunables(old, next *Config) []Change {
+	var changes []Change
+	if old.Logging.Level != next.Logging.Level {
+		changes = append(changes, Change{"logging.level", old.Logging.Level, next.Logging.Level})
+	}
+
+	for _, group := range unionKeys(old.RateLimits, next.RateLimits) {
+		before, after := old.RateLimits[group], next.RateLimits[group]
+		if before != after {
+			changes = append(changes, Change{"rate_limits." + group, strconv.Itoa(before), strconv.Itoa(after)})
+		}
+	}
+
+	if before, after := describe(old.JobTypes.Default), describe(next.JobTypes.Default); before != after {
+		changes = append(changes, Change{"job_types.default", before, after})
+	}
+	for _, jobType := range unionKeys(old.JobTypes.Types, next.JobTypes.Types) {
+		before, after := describe(old.JobTypes.Types[jobType]), describe(next.JobTypes.Types[jobType])
+		if before != after {
+			changes = append(changes, Change{"job_types.types." + string(jobType), before, after})
+		}
+	}
+
+	return changes
+}
+
+// restartRequired lists the config sections that differ between old and
+// next but can't be applied by a reload: everything except the tunables
+func restartRequired(old, next *Config) []string {
+	var sections []string
+	before, after := reflect.ValueOf(*old), reflect.ValueOf(*next)
+	for i := 0; i < before.NumField(); i++ {
+		section := before.Type().Field(i).Tag.Get("yaml")
+		switch section {
+		case "rate_limits", "job_types":
+			continue
+		case "logging":
+			if old.Logging.Format != next.Logging.Format {
+				sections = append(sections, "logging.format")
+			}
+			continue
+		}
+		if !reflect.DeepEqual(before.Field(i).Interface(), after.Field(i).Interface()) {
+			sections = append(sections, section)
+		}
+	}
+	return sections
+}
+
+func describe(config types.JobTypeConfig) string {
+	data, _ := json.Marshal(config)
+	return string(data)
+}
+
+func unionKeys[K ~string, V any](a, b map[K]V) []K {
+	seen := make(map[K]bool)
+	var keys []K
+	for _, m := range []map[K]V{a, b} {
+		for key := range m {
+			if !seen[key] {
+				seen[key] = true
+				keys = append(keys, key)
+			}
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	return keys
+}
+
+// Watcher reloads the configuration on SIGHUP, and when polling is enabled,
+// whenever the config file's modification time moves. Each reload that
+// changes tunables is applied and every change is written to the audit log.
+type Watcher struct {
+	path     string
+	interval time.Duration
+	apply    func(*Config, []Change)
+	current  *Config
+	modTime  time.Time
+}
+
+// NewWatcher creates a watcher for the config loaded from path, which may
+// be empty for environment-only configuration. apply is called with the
+// new configuration and the changes after a reload changes tunables. An
+// interval of zero reloads on SIGHUP only.
+func NewWatcher(path string, current *Config, interval time.Duration, apply func(*Config, []Change)) *Watcher {
+	w := &Watcher{path: path, interval: interval, apply: apply, current: current}
+	w.modTime, _ = w.fileModTime()
+	return w
+}
+
+// Run reloads the configuration when asked until ctx is done
+func (w *Watcher) Run(ctx context.Context) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	var poll <-chan time.Time
+	if w.interval > 0 && w.path != "" {
+		ticker := time.NewTicker(w.interval)
+		defer ticker.Stop()
+		poll = ticker.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			w.Reload()
+		case <-poll:
+			if modTime, err := w.fileModTime(); err == nil && !modTime.Equal(w.modTime) {
+				w.Reload()
+			}
+		}
+	}
+}
+
+func (w *Watcher) fileModTime() (time.Time, error) {
+	if w.path == "" {
+		return time.Time{}, nil
+	}
+	info, err := os.Stat(w.path)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return info.ModTime(), nil
+}
+
+// Reload loads the configuration again and applies the tunables that
+// changed. An invalid configuration is reported and leaves the running one
+// in place.
+func (w *Watcher) Reload() []Change {
+	log := logger.GetLogger()
+	w.modTime, _ = w.fileModTime()
+
+	next, err := Load(w.path)
+	if err != nil {
+		log.WithError(err).Error("Config reload failed; keeping the running configuration")
+		return nil
+	}
+
+	if sections := restartRequired(w.current, next); len(sections) > 0 {
+		log.WithFields(logger.Fields{"sections": sections}).Warn("Config changes that need a restart were not applied")
+	}
+
+	changes := diffTunables(w.current, next)
+	if len(changes) == 0 {
+		log.Info("Config reloaded with no tunable changes")
+		return nil
+	}
+
+	// Only the tunables move, so changes needing a restart are reported
+	// again on the next reload
+	applied := *w.current
+	applied.Logging.Level = next.Logging.Level
+	applied.RateLimits = next.RateLimits
+	applied.JobTypes = next.JobTypes
+
+	w.apply(&applied, changes)
+	for _, change := range changes {
+		log.ConfigChanged(change.Setting, change.Old, change.New)
+	}
+	w.current = &applied
+	return changes
+}
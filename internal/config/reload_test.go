@@ -0,0 +1,91 @@
+package config
+
+import (
+	"os"
+	"testing"
+)
+
+func TestWatcherReload(t *testing.T) {
+	path := writeConfig(t, "taskflow.yaml", `
+server:
+  addr: ":8080"
+logging:
+  level: info
+rate_limits:
+  submit: 60
+job_types:
+  types:
+    email:
+      concurrency: 2
+`)
+	current, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+
+	var applied *Config
+	watcher := NewWatcher(path, current, 0, func(next *Config, _ []Change) { applied = next })
+
+	if changes := watcher.Reload(); len(changes) != 0 || applied != nil {
+		t.Fatalf("reloading an unchanged file applied %v", changes)
+	}
+
+	update := `
+server:
+  addr: ":9090"
+logging:
+  level: debug
+rate_limits:
+  submit: 120
+  read: 600
+job_types:
+  types:
+    email:
+      concurrency: 4
+`
+	if err := os.WriteFile(path, []byte(update), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	changes := watcher.Reload()
+	settings := make(map[string]Change)
+	for _, change := range changes {
+		settings[change.Setting] = change
+	}
+	for _, setting := range []string{"logging.level", "rate_limits.submit", "rate_limits.read", "job_types.types.email"} {
+		if _, ok := settings[setting]; !ok {
+			t.Errorf("changes %v are missing %s", changes, setting)
+		}
+	}
+	if change := settings["rate_limits.submit"]; change.Old != "60" || change.New != "120" {
+		t.Errorf("rate_limits.submit change = %+v", change)
+	}
+
+	if applied == nil {
+		t.Fatal("apply was not called")
+	}
+	if applied.Logging.Level != "debug" || applied.RateLimits["read"] != 600 || applied.JobTypes.Types["email"].Concurrency != 4 {
+		t.Errorf("applied tunables = %+v", applied)
+	}
+	if applied.Server.Addr != ":8080" {
+		t.Errorf("server addr = %s, want it kept until a restart", applied.Server.Addr)
+	}
+}
+
+func TestWatcherReloadInvalid(t *testing.T) {
+	path := writeConfig(t, "taskflow.yaml", "logging:\n  level: info\n")
+	current, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+
+	called := false
+	watcher := NewWatcher(path, current, 0, func(*Config, []Change) { called = true })
+
+	if err := os.WriteFile(path, []byte("logging:\n  level: loud\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if changes := watcher.Reload(); changes != nil || called {
+		t.Errorf("an invalid config was applied: %v", changes)
+	}
+}
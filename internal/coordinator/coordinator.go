@@ -0,0 +1,144 @@
+package coordinator
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"taskflow/internal/metrics"
+)
+
+// DefaultLeaseTTL is how long a leader's lease lasts without renewal. A
+// failed leader's loops resume on another server within about this long.
+const DefaultLeaseTTL = 15 * time.Second
+
+// Coordinator runs maintenance loops that must run exactly once across all
+// API servers, such as result sweeping and state reconciliation. Every
+// server runs a coordinator; the one holding the lease runs the loops and
+// the others stand by to take over when its lease lapses.
+type Coordinator struct {
+	elector Elector
+	id      string
+	ttl     time.Duration
+	tasks   []task
+
+	mu     sync.Mutex
+	leader bool
+}
+
+// task is a loop hosted by the coordinator. It runs until its context is
+// cancelled.
+type task struct {
+	name string
+	run  func(ctx context.Context)
+}
+
+// New creates a coordinator that campaigns as id for leases of ttl
+func New(elector Elector, id string, ttl time.Duration) *Coordinator {
+	if ttl <= 0 {
+		ttl = DefaultLeaseTTL
+	}
+	return &Coordinator{elector: elector, id: id, ttl: ttl}
+}
+
+// Add hosts a loop on the leader. Loops must be added before Run.
+func (c *Coordinator) Add(name string, run func(ctx context.Context)) {
+	c.tasks = append(c.tasks, task{name: name, run: run})
+}
+
+// ID returns the identity the coordinator campaigns as
+func (c *Coordinator) ID() string {
+	return c.id
+}
+
+// IsLeader reports whether this server currently runs the loops
+func (c *Coordinator) IsLeader() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.leader
+}
+
+// Run campaigns for the lease and renews it every third of its TTL until
+// ctx is done, starting the loops when this server is elected and stopping
+// them when it loses the lease. On shutdown the lease is released so that
+// another server takes over at once.
+func (c *Coordinator) Run(ctx context.Context) {
+	ticker := time.NewTicker(c.ttl / 3)
+	defer ticker.Stop()
+
+	var stop func()
+	var renewedAt time.Time
+	for {
+		leader, err := c.elector.Acquire(ctx, c.id, c.ttl)
+		now := time.Now()
+		switch {
+		case err != nil && ctx.Err() == nil:
+			// Keep leading while the last renewal surely holds, so that a
+			// brief Redis hiccup doesn't restart every loop
+			leader = stop != nil && now.Before(renewedAt.Add(c.ttl/2))
+			log.Printf("Failed to renew maintenance lease: %v", err)
+		case leader:
+			renewedAt = now
+		}
+
+		c.setLeader(leader)
+		switch {
+		case leader && stop == nil:
+			log.Printf("Elected maintenance leader (%s), running %d loops", c.id, len(c.tasks))
+			stop = c.start(ctx)
+		case !leader && stop != nil:
+			log.Printf("Lost maintenance leadership (%s), stopping loops", c.id)
+			stop()
+			stop = nil
+		}
+
+		select {
+		case <-ctx.Done():
+			if stop != nil {
+				stop()
+				c.release()
+			}
+			c.setLeader(false)
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// start runs the loops and returns a function that stops them and waits
+// for them to return
+func (c *Coordinator) start(ctx context.Context) func() {
+	ctx, cancel := context.WithCancel(ctx)
+
+	var wg sync.WaitGroup
+	for _, t := range c.tasks {
+		wg.Add(1)
+		go func(t task) {
+			defer wg.Done()
+			t.run(ctx)
+		}(t)
+	}
+
+	return func() {
+		cancel()
+		wg.Wait()
+	}
+}
+
+// release gives the lease up after the loops stopped
+func (c *Coordinator) release() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	if err := c.elector.Release(ctx, c.id); err != nil {
+		log.Printf("Failed to release maintenance lease: %v", err)
+	}
+}
+
+func (c *Coordinator) setLeader(leader bool) {
+	c.mu.Lock()
+	c.leader = leader
+	c.mu.Unlock()
+	metrics.SetCoordinatorLeader(leader)
+}
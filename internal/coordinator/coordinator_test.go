@@ -0,0 +1,172 @@
+package coordinator
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"taskflow/internal/metrics"
+)
+
+func TestMain(m *testing.M) {
+	// Register the metrics before coordinators set them concurrently
+	metrics.Init()
+	os.Exit(m.Run())
+}
+
+// fakeElector grants the lease to whichever ID holds it, or to the first to
+// ask when it is free
+type fakeElector struct {
+	mu      sync.Mutex
+	holder  string
+	err     error
+	release int
+}
+
+func (e *fakeElector) Acquire(ctx context.Context, id string, ttl time.Duration) (bool, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.err != nil {
+		return false, e.err
+	}
+	if e.holder == "" {
+		e.holder = id
+	}
+	return e.holder == id, nil
+}
+
+func (e *fakeElector) Release(ctx context.Context, id string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.holder == id {
+		e.holder = ""
+	}
+	e.release++
+	return nil
+}
+
+func (e *fakeElector) set(holder string, err error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.holder, e.err = holder, err
+}
+
+// loop counts the times it is running
+type loop struct {
+	mu      sync.Mutex
+	running int
+}
+
+func (l *loop) run(ctx context.Context) {
+	l.mu.Lock()
+	l.running++
+	l.mu.Unlock()
+
+	<-ctx.Done()
+
+	l.mu.Lock()
+	l.running--
+	l.mu.Unlock()
+}
+
+func (l *loop) count() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.running
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestCoordinatorRunsLoopsOnLeaderOnly(t *testing.T) {
+	elector := &fakeElector{}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var leaderLoop, followerLoop loop
+	leader := New(elector, "a", 30*time.Millisecond)
+	leader.Add("loop", leaderLoop.run)
+	follower := New(elector, "b", 30*time.Millisecond)
+	follower.Add("loop", followerLoop.run)
+
+	elector.set("a", nil)
+	go leader.Run(ctx)
+	go follower.Run(ctx)
+
+	waitFor(t, "leader loop", func() bool { return leaderLoop.count() == 1 })
+	if !leader.IsLeader() || follower.IsLeader() {
+		t.Fatalf("leader = %v, follower = %v, want only the leader elected", leader.IsLeader(), follower.IsLeader())
+	}
+	if followerLoop.count() != 0 {
+		t.Fatal("follower runs its loop")
+	}
+
+	// The lease passes to the follower, as when the leader's lapsed
+	elector.set("b", nil)
+	waitFor(t, "failover", func() bool { return leaderLoop.count() == 0 && followerLoop.count() == 1 })
+	if leader.IsLeader() || !follower.IsLeader() {
+		t.Errorf("leader = %v, follower = %v, want the follower elected", leader.IsLeader(), follower.IsLeader())
+	}
+}
+
+func TestCoordinatorStopsLoopsWhenRenewalFails(t *testing.T) {
+	elector := &fakeElector{}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var l loop
+	c := New(elector, "a", 30*time.Millisecond)
+	c.Add("loop", l.run)
+	go c.Run(ctx)
+
+	waitFor(t, "election", func() bool { return l.count() == 1 })
+
+	elector.set("a", errors.New("connection refused"))
+	waitFor(t, "loops to stop", func() bool { return l.count() == 0 })
+	if c.IsLeader() {
+		t.Error("coordinator still leads after its lease can't be renewed")
+	}
+
+	elector.set("", nil)
+	waitFor(t, "re-election", func() bool { return l.count() == 1 })
+}
+
+func TestCoordinatorReleasesOnShutdown(t *testing.T) {
+	elector := &fakeElector{}
+	ctx, cancel := context.WithCancel(context.Background())
+
+	var l loop
+	c := New(elector, "a", 30*time.Millisecond)
+	c.Add("loop", l.run)
+
+	done := make(chan struct{})
+	go func() {
+		c.Run(ctx)
+		close(done)
+	}()
+
+	waitFor(t, "election", func() bool { return l.count() == 1 })
+	cancel()
+	<-done
+
+	if l.count() != 0 {
+		t.Error("loop still running after shutdown")
+	}
+	if elector.holder != "" || elector.release != 1 {
+		t.Errorf("holder = %q, releases = %d, want the lease released once", elector.holder, elector.release)
+	}
+	if c.IsLeader() {
+		t.Error("coordinator leads after shutdown")
+	}
+}
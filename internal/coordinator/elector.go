@@ -0,0 +1,87 @@
+package coordinator
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// LeaderKey holds the ID of the API server that runs the maintenance loops
+const LeaderKey = "taskflow:coordinator:leader"
+
+// Elector grants the maintenance lease to one server at a time
+type Elector interface {
+	// Acquire takes the lease for ttl if it is free, or extends it if id
+	// already holds it, and reports whether id holds it now
+	Acquire(ctx context.Context, id string, ttl time.Duration) (bool, error)
+	// Release gives the lease up if id holds it
+	Release(ctx context.Context, id string) error
+}
+
+// renewScript extends the lease if the caller holds it
+var renewScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('PEXPIRE', KEYS[1], ARGV[2])
+end
+return 0
+`)
+
+// releaseScript deletes the lease if the caller holds it
+var releaseScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+// RedisElector leases leadership through a Redis key that expires unless
+// its holder renews it, so a leader that dies is replaced within a TTL
+type RedisElector struct {
+	client redis.UniversalClient
+}
+
+// NewRedisElector creates an elector on the given Redis client
+func NewRedisElector(client redis.UniversalClient) *RedisElector {
+	return &RedisElector{client: client}
+}
+
+// Acquire takes the lease with SET NX PX, or renews it if id holds it
+func (e *RedisElector) Acquire(ctx context.Context, id string, ttl time.Duration) (bool, error) {
+	acquired, err := e.client.SetNX(ctx, LeaderKey, id, ttl).Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to acquire maintenance lease: %w", err)
+	}
+	if acquired {
+		return true, nil
+	}
+
+	renewed, err := renewScript.Run(ctx, e.client, []string{LeaderKey}, id, ttl.Milliseconds()).Int()
+	if err != nil {
+		return false, fmt.Errorf("failed to renew maintenance lease: %w", err)
+	}
+	return renewed == 1, nil
+}
+
+// Release deletes the lease if id holds it
+func (e *RedisElector) Release(ctx context.Context, id string) error {
+	if err := releaseScript.Run(ctx, e.client, []string{LeaderKey}, id).Err(); err != nil {
+		return fmt.Errorf("failed to release maintenance lease: %w", err)
+	}
+	return nil
+}
+
+// LocalElector always grants the lease. It suits a single API server, or
+// backends without Redis, where every server then runs the loops.
+type LocalElector struct{}
+
+// Acquire always succeeds
+func (LocalElector) Acquire(ctx context.Context, id string, ttl time.Duration) (bool, error) {
+	return true, nil
+}
+
+// Release does nothing
+func (LocalElector) Release(ctx context.Context, id string) error {
+	return nil
+}
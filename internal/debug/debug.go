@@ -0,0 +1,121 @@
+// Package debug serves runtime profiling and status endpoints on a
+// separate, internal-only port: net/http/pprof under /debug/pprof/, expvar
+// at /debug/vars, a JSON status dump at /debug/status and Prometheus
+// metrics at /metrics, for workers, which serve no API. Nothing here is
+// authenticated, so the port must not be reachable from outside.
+package debug
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"expvar"
+	"log"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"sync"
+	"taskflow/internal/metrics"
+	"time"
+)
+
+// Server is the debug HTTP server. A nil *Server is disabled.
+type Server struct {
+	addr    string
+	started time.Time
+
+	mu       sync.Mutex
+	sections map[string]func() interface{}
+}
+
+// NewServer creates a debug server listening on addr
+func NewServer(addr string) *Server {
+	return &Server{addr: addr, started: time.Now(), sections: make(map[string]func() interface{})}
+}
+
+// Publish adds a section to /debug/status, filled by fn on each request
+func (s *Server) Publish(name string, fn func() interface{}) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sections[name] = fn
+}
+
+// Handler returns the debug endpoints
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.Handle("/debug/vars", expvar.Handler())
+	mux.HandleFunc("/debug/status", s.status)
+	mux.Handle("/metrics", metrics.Handler())
+	return mux
+}
+
+// RuntimeStatus describes the process on the status page
+type RuntimeStatus struct {
+	GoVersion     string  `json:"go_version"`
+	Goroutines    int     `json:"goroutines"`
+	CPUs          int     `json:"cpus"`
+	UptimeSeconds float64 `json:"uptime_seconds"`
+	HeapAlloc     uint64  `json:"heap_alloc_bytes"`
+	HeapObjects   uint64  `json:"heap_objects"`
+	NumGC         uint32  `json:"num_gc"`
+}
+
+func (s *Server) status(w http.ResponseWriter, r *http.Request) {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	status := map[string]interface{}{
+		"runtime": RuntimeStatus{
+			GoVersion:     runtime.Version(),
+			Goroutines:    runtime.NumGoroutine(),
+			CPUs:          runtime.NumCPU(),
+			UptimeSeconds: time.Since(s.started).Seconds(),
+			HeapAlloc:     mem.HeapAlloc,
+			HeapObjects:   mem.HeapObjects,
+			NumGC:         mem.NumGC,
+		},
+	}
+
+	s.mu.Lock()
+	sections := make(map[string]func() interface{}, len(s.sections))
+	for name, fn := range s.sections {
+		sections[name] = fn
+	}
+	s.mu.Unlock()
+	for name, fn := range sections {
+		status[name] = fn()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(status)
+}
+
+// Run serves the debug endpoints until ctx is done
+func (s *Server) Run(ctx context.Context) error {
+	// No write timeout: CPU profiles and traces stream for as long as the
+	// caller asks
+	server := &http.Server{Addr: s.addr, Handler: s.Handler(), ReadHeaderTimeout: 10 * time.Second}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+
+	log.Printf("Debug endpoints listening on %s", s.addr)
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,37 @@
+package debug
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestStatus(t *testing.T) {
+	s := NewServer("127.0.0.1:0")
+	s.Publish("worker", func() interface{} {
+		return map[string]int{"in_flight": 2}
+	})
+
+	rec := httptest.NewRecorder()
+	s.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/debug/status", nil))
+
+	var status map[string]map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &status); err != nil {
+		t.Fatalf("invalid status %s: %v", rec.Body, err)
+	}
+	if status["runtime"]["goroutines"] == nil {
+		t.Errorf("status has no runtime section: %s", rec.Body)
+	}
+	if status["worker"]["in_flight"] != 2.0 {
+		t.Errorf("worker section = %v, want in_flight 2", status["worker"])
+	}
+
+	for _, path := range []string{"/debug/vars", "/debug/pprof/"} {
+		rec := httptest.NewRecorder()
+		s.Handler().ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+		if rec.Code != http.StatusOK {
+			t.Errorf("GET %s = %d, want 200", path, rec.Code)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package emailtemplate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+	"taskflow/internal/blobstore"
+	"taskflow/internal/types"
+)
+
+// maxTemplateBytes bounds the size of a template file
+const maxTemplateBytes = 1 << 20
+
+// BlobSource loads templates from files in a blob store directory: an HTML
+// template from <name>.html and a plain text one from <name>.txt
+type BlobSource struct {
+	store blobstore.Store
+	base  *url.URL
+}
+
+// OpenBlobSource creates a source over the directory at rawURL, a blob
+// store URL such as file:///etc/taskflow/email or s3://bucket/email
+func OpenBlobSource(ctx context.Context, rawURL string) (*BlobSource, error) {
+	base, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid email template URL: %w", err)
+	}
+	store, err := blobstore.Open(ctx, rawURL)
+	if err != nil {
+		return nil, err
+	}
+	return &BlobSource{store: store, base: base}, nil
+}
+
+// GetEmailTemplate loads the template name, preferring its HTML file
+func (s *BlobSource) GetEmailTemplate(ctx context.Context, name string) (*types.EmailTemplate, error) {
+	for _, html := range []bool{true, false} {
+		source, err := s.read(ctx, name, html)
+		if errors.Is(err, blobstore.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return &types.EmailTemplate{Name: name, Source: source, HTML: html}, nil
+	}
+	return nil, fmt.Errorf("%w: %s", ErrNotFound, name)
+}
+
+// read reads the HTML or text file of the template name
+func (s *BlobSource) read(ctx context.Context, name string, html bool) (string, error) {
+	file := name + ".txt"
+	if html {
+		file = name + ".html"
+	}
+	ref := *s.base
+	ref.Path = path.Join(ref.Path, file)
+	ref.RawQuery = ""
+
+	r, err := s.store.Get(ctx, ref.String())
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+
+	data, err := io.ReadAll(io.LimitReader(r, maxTemplateBytes+1))
+	if err != nil {
+		return "", fmt.Errorf("failed to read email template %s: %w", file, err)
+	}
+	if len(data) > maxTemplateBytes {
+		return "", fmt.Errorf("email template %s is larger than %d bytes", file, maxTemplateBytes)
+	}
+	return string(data), nil
+}
@@ -0,0 +1,178 @@
+// Package emailtemplate renders the named templates email jobs are sent
+// from, so that callers submit variables instead of rendered messages.
+//
+// A template is a Go template whose output is the message body and which
+// defines the subject in a "subject" block:
+//
+//	{{define "subject"}}Your export of {{.report}} is ready{{end}}
+//	<p>Hello {{.name}},</p>
+//	<p>Download it <a href="{{.url}}">here</a>.</p>
+//
+// HTML templates are rendered with html/template, which escapes variables
+// in the body; the subject is always plain text. A variable the template
+// uses but the job doesn't set fails the job instead of rendering as
+// "<no value>".
+package emailtemplate
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"regexp"
+	"sync"
+	"taskflow/internal/types"
+	texttemplate "text/template"
+	"time"
+)
+
+// subjectBlock is the template that renders the subject
+const subjectBlock = "subject"
+
+// DefaultCacheTTL is how long a Renderer reuses a loaded template before
+// loading it again
+const DefaultCacheTTL = time.Minute
+
+// ErrNotFound is returned by BlobSource when no template has the requested
+// name
+var ErrNotFound = errors.New("email template not found")
+
+// validName matches template names, which also name files in a directory
+var validName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]{0,127}$`)
+
+// ValidName reports whether name can name a template
+func ValidName(name string) bool {
+	return validName.MatchString(name)
+}
+
+// Source loads templates by name, such as BlobSource or PostgreSQL storage
+type Source interface {
+	GetEmailTemplate(ctx context.Context, name string) (*types.EmailTemplate, error)
+}
+
+// Template is a parsed template
+type Template struct {
+	Name string
+	HTML bool
+
+	subject *texttemplate.Template
+	// body executes the whole template, with html/template for HTML
+	// templates
+	body func(w io.Writer, data interface{}) error
+}
+
+// Message is a rendered template
+type Message struct {
+	Subject string
+	Body    string
+	HTML    bool
+}
+
+// Parse parses the source of a template. The source must define a subject
+// block.
+func Parse(tmpl *types.EmailTemplate) (*Template, error) {
+	subject, err := texttemplate.New(tmpl.Name).Option("missingkey=error").Parse(tmpl.Source)
+	if err != nil {
+		return nil, fmt.Errorf("invalid email template %s: %w", tmpl.Name, err)
+	}
+	if subject.Lookup(subjectBlock) == nil {
+		return nil, fmt.Errorf("invalid email template %s: no %q block", tmpl.Name, subjectBlock)
+	}
+
+	parsed := &Template{Name: tmpl.Name, HTML: tmpl.HTML, subject: subject}
+	if tmpl.HTML {
+		body, err := htmltemplate.New(tmpl.Name).Option("missingkey=error").Parse(tmpl.Source)
+		if err != nil {
+			return nil, fmt.Errorf("invalid email template %s: %w", tmpl.Name, err)
+		}
+		parsed.body = body.Execute
+	} else {
+		parsed.body = subject.Execute
+	}
+	return parsed, nil
+}
+
+// Render renders the template with vars
+func (t *Template) Render(vars map[string]interface{}) (*Message, error) {
+	if vars == nil {
+		vars = map[string]interface{}{}
+	}
+
+	var subject, body bytes.Buffer
+	if err := t.subject.ExecuteTemplate(&subject, subjectBlock, vars); err != nil {
+		return nil, fmt.Errorf("failed to render subject of email template %s: %w", t.Name, err)
+	}
+	if err := t.body(&body, vars); err != nil {
+		return nil, fmt.Errorf("failed to render email template %s: %w", t.Name, err)
+	}
+
+	return &Message{
+		Subject: string(bytes.TrimSpace(subject.Bytes())),
+		Body:    string(bytes.TrimSpace(body.Bytes())),
+		HTML:    t.HTML,
+	}, nil
+}
+
+// Renderer renders templates loaded from a source, keeping parsed templates
+// for a while so that sending an email doesn't load its template each time
+type Renderer struct {
+	source Source
+	ttl    time.Duration
+
+	mu    sync.Mutex
+	cache map[string]cachedTemplate
+}
+
+type cachedTemplate struct {
+	template *Template
+	loadedAt time.Time
+}
+
+// NewRenderer creates a renderer over source that reloads templates after
+// ttl. Zero uses DefaultCacheTTL.
+func NewRenderer(source Source, ttl time.Duration) *Renderer {
+	if ttl <= 0 {
+		ttl = DefaultCacheTTL
+	}
+	return &Renderer{source: source, ttl: ttl, cache: make(map[string]cachedTemplate)}
+}
+
+// Render renders the template name with vars
+func (r *Renderer) Render(ctx context.Context, name string, vars map[string]interface{}) (*Message, error) {
+	tmpl, err := r.template(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	return tmpl.Render(vars)
+}
+
+// template returns the parsed template name, loading it if it isn't cached
+// or its cached copy is too old
+func (r *Renderer) template(ctx context.Context, name string) (*Template, error) {
+	if !ValidName(name) {
+		return nil, fmt.Errorf("invalid email template name %q", name)
+	}
+
+	r.mu.Lock()
+	cached, ok := r.cache[name]
+	r.mu.Unlock()
+	if ok && time.Since(cached.loadedAt) < r.ttl {
+		return cached.template, nil
+	}
+
+	source, err := r.source.GetEmailTemplate(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	tmpl, err := Parse(source)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	r.cache[name] = cachedTemplate{template: tmpl, loadedAt: time.Now()}
+	r.mu.Unlock()
+	return tmpl, nil
+}
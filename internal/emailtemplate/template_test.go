@@ -0,0 +1,140 @@
+package emailtemplate
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"taskflow/internal/types"
+	"testing"
+	"time"
+)
+
+const welcome = `{{define "subject"}}Welcome, {{.name}}{{end}}
+<p>Hello {{.name}}, your plan is {{.plan}}.</p>`
+
+func TestRender(t *testing.T) {
+	tmpl, err := Parse(&types.EmailTemplate{Name: "welcome", Source: welcome, HTML: true})
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+
+	msg, err := tmpl.Render(map[string]interface{}{"name": "Ada <admin>", "plan": "pro"})
+	if err != nil {
+		t.Fatalf("Render: %v", err)
+	}
+	if msg.Subject != "Welcome, Ada <admin>" {
+		t.Errorf("subject = %q, want the name unescaped", msg.Subject)
+	}
+	if msg.Body != "<p>Hello Ada &lt;admin&gt;, your plan is pro.</p>" {
+		t.Errorf("body = %q, want the name escaped", msg.Body)
+	}
+	if !msg.HTML {
+		t.Error("message of an HTML template is not HTML")
+	}
+
+	// A missing variable fails instead of rendering "<no value>"
+	if _, err := tmpl.Render(map[string]interface{}{"name": "Ada"}); err == nil {
+		t.Error("Render without plan succeeded, want an error")
+	}
+}
+
+func TestRenderText(t *testing.T) {
+	tmpl, err := Parse(&types.EmailTemplate{Name: "plain", Source: welcome})
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+
+	msg, err := tmpl.Render(map[string]interface{}{"name": "<Ada>", "plan": "pro"})
+	if err != nil {
+		t.Fatalf("Render: %v", err)
+	}
+	if !strings.Contains(msg.Body, "Hello <Ada>") || msg.HTML {
+		t.Errorf("message = %+v, want an unescaped plain text body", msg)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := map[string]string{
+		"no subject":   `<p>Hello {{.name}}</p>`,
+		"syntax error": `{{define "subject"}}Hi{{end}}{{.name`,
+	}
+	for name, source := range tests {
+		if _, err := Parse(&types.EmailTemplate{Name: "bad", Source: source, HTML: true}); err == nil {
+			t.Errorf("%s: Parse succeeded, want an error", name)
+		}
+	}
+}
+
+// countingSource serves one template and counts how often it is loaded
+type countingSource struct {
+	source string
+	loads  int
+}
+
+func (s *countingSource) GetEmailTemplate(ctx context.Context, name string) (*types.EmailTemplate, error) {
+	if name != "welcome" {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, name)
+	}
+	s.loads++
+	return &types.EmailTemplate{Name: name, Source: s.source, HTML: true}, nil
+}
+
+func TestRendererCaches(t *testing.T) {
+	ctx := context.Background()
+	source := &countingSource{source: welcome}
+	renderer := NewRenderer(source, 20*time.Millisecond)
+	vars := map[string]interface{}{"name": "Ada", "plan": "pro"}
+
+	for i := 0; i < 3; i++ {
+		if _, err := renderer.Render(ctx, "welcome", vars); err != nil {
+			t.Fatalf("Render: %v", err)
+		}
+	}
+	if source.loads != 1 {
+		t.Errorf("template loaded %d times, want once while cached", source.loads)
+	}
+
+	// Edits are picked up once the cached copy is too old
+	source.source = `{{define "subject"}}Hi {{.name}}{{end}}Updated`
+	time.Sleep(30 * time.Millisecond)
+	msg, err := renderer.Render(ctx, "welcome", vars)
+	if err != nil {
+		t.Fatalf("Render: %v", err)
+	}
+	if msg.Subject != "Hi Ada" || source.loads != 2 {
+		t.Errorf("subject = %q after %d loads, want the updated template", msg.Subject, source.loads)
+	}
+
+	if _, err := renderer.Render(ctx, "../secrets", vars); err == nil {
+		t.Error("Render of an invalid name succeeded")
+	}
+	if _, err := renderer.Render(ctx, "missing", vars); err == nil {
+		t.Error("Render of a missing template succeeded")
+	}
+}
+
+func TestBlobSource(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "welcome.html"), []byte(welcome), 0644)
+	os.WriteFile(filepath.Join(dir, "receipt.txt"), []byte(`{{define "subject"}}Receipt{{end}}Paid`), 0644)
+
+	source, err := OpenBlobSource(ctx, "file://"+dir)
+	if err != nil {
+		t.Fatalf("OpenBlobSource: %v", err)
+	}
+
+	html, err := source.GetEmailTemplate(ctx, "welcome")
+	if err != nil || !html.HTML || html.Source != welcome {
+		t.Errorf("welcome = %+v, %v; want the HTML file", html, err)
+	}
+	text, err := source.GetEmailTemplate(ctx, "receipt")
+	if err != nil || text.HTML {
+		t.Errorf("receipt = %+v, %v; want the text file", text, err)
+	}
+	if _, err := source.GetEmailTemplate(ctx, "missing"); err == nil {
+		t.Error("GetEmailTemplate of a missing template succeeded")
+	}
+}
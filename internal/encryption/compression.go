@@ -0,0 +1,202 @@
+package encryption
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compression algorithms
+const (
+	CompressionGzip = "gzip"
+	CompressionZstd = "zstd"
+)
+
+// compressedVersion marks values compressed by Cipher.Seal without encryption
+const compressedVersion = "taskflow:z1"
+
+// maxDecompressedBytes bounds the size of a decompressed value so that a
+// corrupt or hostile value can't exhaust memory
+const maxDecompressedBytes = 256 << 20
+
+// compressed is the JSON document stored in place of a value that was
+// compressed but not encrypted. Like envelope, it is valid JSON so it can
+// live in JSONB columns unchanged.
+type compressed struct {
+	Version   string `json:"zip"`
+	Algorithm string `json:"alg"`
+	Data      []byte `json:"data"`
+}
+
+// CipherOption configures a Cipher
+type CipherOption func(*Cipher)
+
+// WithCompression compresses values of at least threshold bytes with
+// algorithm before they are encrypted. A threshold of zero disables it.
+func WithCompression(algorithm string, threshold int) CipherOption {
+	return func(c *Cipher) {
+		c.compression = algorithm
+		c.compressThreshold = threshold
+	}
+}
+
+// ValidCompression reports whether algorithm names a supported compression
+// algorithm
+func ValidCompression(algorithm string) bool {
+	return algorithm == CompressionGzip || algorithm == CompressionZstd
+}
+
+// IsCompressed reports whether a value is a compressed value written
+// without encryption
+func IsCompressed(value json.RawMessage) bool {
+	_, ok := parseCompressed(value)
+	return ok
+}
+
+// compress compresses value when it is at least the threshold and
+// compression makes it smaller. It returns the algorithm used, or an empty
+// string when value was left as is.
+func (c *Cipher) compress(value []byte) ([]byte, string, error) {
+	if c.compressThreshold <= 0 || len(value) < c.compressThreshold {
+		return value, "", nil
+	}
+
+	data, err := compressBytes(c.compression, value)
+	if err != nil {
+		return nil, "", err
+	}
+	if len(data) >= len(value) {
+		return value, "", nil
+	}
+
+	return data, c.compression, nil
+}
+
+// compressValue compresses a value that won't be encrypted, wrapping it in
+// a compressed document when that is smaller than the value itself
+func (c *Cipher) compressValue(value json.RawMessage) (json.RawMessage, error) {
+	data, algorithm, err := c.compress(value)
+	if err != nil {
+		return nil, err
+	}
+	if algorithm == "" {
+		return escapeValue(value)
+	}
+
+	doc, err := json.Marshal(compressed{
+		Version:   compressedVersion,
+		Algorithm: algorithm,
+		Data:      data,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(doc) >= len(value) {
+		return escapeValue(value)
+	}
+
+	return doc, nil
+}
+
+// decompressValue unwraps a compressed document. Other values are
+// returned as is.
+func decompressValue(value json.RawMessage) (json.RawMessage, error) {
+	doc, ok := parseCompressed(value)
+	if !ok {
+		return value, nil
+	}
+	return decompressBytes(doc.Algorithm, doc.Data)
+}
+
+func parseCompressed(value json.RawMessage) (*compressed, bool) {
+	if len(value) == 0 || !bytes.Contains(value, []byte(compressedVersion)) {
+		return nil, false
+	}
+
+	var doc compressed
+	if err := json.Unmarshal(value, &doc); err != nil || doc.Version != compressedVersion {
+		return nil, false
+	}
+
+	return &doc, true
+}
+
+var (
+	zstdOnce    sync.Once
+	zstdEncoder *zstd.Encoder
+	zstdDecoder *zstd.Decoder
+	zstdErr     error
+)
+
+// zstdCodec returns the shared zstd encoder and decoder, which are safe for
+// concurrent use through EncodeAll and DecodeAll
+func zstdCodec() (*zstd.Encoder, *zstd.Decoder, error) {
+	zstdOnce.Do(func() {
+		zstdEncoder, zstdErr = zstd.NewWriter(nil)
+		if zstdErr != nil {
+			return
+		}
+		zstdDecoder, zstdErr = zstd.NewReader(nil, zstd.WithDecoderMaxMemory(maxDecompressedBytes))
+	})
+	return zstdEncoder, zstdDecoder, zstdErr
+}
+
+func compressBytes(algorithm string, value []byte) ([]byte, error) {
+	switch algorithm {
+	case CompressionGzip:
+		var buf bytes.Buffer
+		w := gzip.NewWriter(&buf)
+		if _, err := w.Write(value); err != nil {
+			return nil, fmt.Errorf("failed to compress value: %w", err)
+		}
+		if err := w.Close(); err != nil {
+			return nil, fmt.Errorf("failed to compress value: %w", err)
+		}
+		return buf.Bytes(), nil
+	case CompressionZstd:
+		encoder, _, err := zstdCodec()
+		if err != nil {
+			return nil, fmt.Errorf("failed to create zstd encoder: %w", err)
+		}
+		return encoder.EncodeAll(value, nil), nil
+	default:
+		return nil, fmt.Errorf("unknown compression algorithm: %s", algorithm)
+	}
+}
+
+func decompressBytes(algorithm string, data []byte) ([]byte, error) {
+	switch algorithm {
+	case CompressionGzip:
+		r, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress value: %w", err)
+		}
+		defer r.Close()
+
+		value, err := io.ReadAll(io.LimitReader(r, maxDecompressedBytes+1))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress value: %w", err)
+		}
+		if len(value) > maxDecompressedBytes {
+			return nil, fmt.Errorf("decompressed value exceeds %d bytes", maxDecompressedBytes)
+		}
+		return value, nil
+	case CompressionZstd:
+		_, decoder, err := zstdCodec()
+		if err != nil {
+			return nil, fmt.Errorf("failed to create zstd decoder: %w", err)
+		}
+		value, err := decoder.DecodeAll(data, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress value: %w", err)
+		}
+		return value, nil
+	default:
+		return nil, fmt.Errorf("unknown compression algorithm: %s", algorithm)
+	}
+}
@@ -0,0 +1,152 @@
+package encryption
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func largePayload() json.RawMessage {
+	return json.RawMessage(`{"body": "` + strings.Repeat("hello world ", 1000) + `"}`)
+}
+
+func TestCompressionRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	payload := largePayload()
+
+	for _, algorithm := range []string{CompressionGzip, CompressionZstd} {
+		t.Run(algorithm, func(t *testing.T) {
+			c := NewCipher(nil, WithCompression(algorithm, 1024))
+
+			sealed, err := c.Seal(ctx, payload)
+			if err != nil {
+				t.Fatalf("Expected no error sealing payload, got %v", err)
+			}
+
+			if !IsCompressed(sealed) || IsEncrypted(sealed) {
+				t.Errorf("Expected sealed payload to be compressed but not encrypted, got %.60s", sealed)
+			}
+
+			if len(sealed) >= len(payload) {
+				t.Errorf("Expected compressed payload to be smaller than %d bytes, got %d", len(payload), len(sealed))
+			}
+
+			if !json.Valid(sealed) {
+				t.Error("Expected compressed payload to be valid JSON")
+			}
+
+			// Readers decompress without compression configured
+			var reader *Cipher
+			opened, err := reader.Open(ctx, sealed)
+			if err != nil {
+				t.Fatalf("Expected no error opening payload, got %v", err)
+			}
+
+			if !bytes.Equal(opened, payload) {
+				t.Errorf("Expected payload to round-trip, got %.60s", opened)
+			}
+		})
+	}
+}
+
+func TestCompressionBelowThreshold(t *testing.T) {
+	c := NewCipher(nil, WithCompression(CompressionZstd, 1024))
+	payload := json.RawMessage(`{"to": "user@example.com"}`)
+
+	sealed, err := c.Seal(context.Background(), payload)
+	if err != nil {
+		t.Fatalf("Expected no error sealing payload, got %v", err)
+	}
+
+	if !bytes.Equal(sealed, payload) {
+		t.Errorf("Expected small payload to be stored as is, got %s", sealed)
+	}
+}
+
+func TestCompressionWithEncryption(t *testing.T) {
+	ctx := context.Background()
+	c := newTestCipher(t)
+	WithCompression(CompressionZstd, 1024)(c)
+	payload := largePayload()
+
+	sealed, err := c.Seal(ctx, payload)
+	if err != nil {
+		t.Fatalf("Expected no error sealing payload, got %v", err)
+	}
+
+	env, ok := parseEnvelope(sealed)
+	if !ok {
+		t.Fatal("Expected sealed payload to be an encryption envelope")
+	}
+	if env.Compression != CompressionZstd {
+		t.Errorf("Expected envelope to record zstd compression, got %q", env.Compression)
+	}
+	if len(sealed) >= len(payload) {
+		t.Errorf("Expected sealed payload to be smaller than %d bytes, got %d", len(payload), len(sealed))
+	}
+
+	opened, err := c.Open(ctx, sealed)
+	if err != nil {
+		t.Fatalf("Expected no error opening payload, got %v", err)
+	}
+
+	if !bytes.Equal(opened, payload) {
+		t.Errorf("Expected payload to round-trip, got %.60s", opened)
+	}
+}
+
+func TestCompressOnlyCipherRejectsEncryptedValues(t *testing.T) {
+	ctx := context.Background()
+	encrypted, err := newTestCipher(t).Seal(ctx, json.RawMessage(`{"a": 1}`))
+	if err != nil {
+		t.Fatalf("Expected no error sealing payload, got %v", err)
+	}
+
+	c := NewCipher(nil, WithCompression(CompressionGzip, 1024))
+	if _, err := c.Open(ctx, encrypted); err == nil {
+		t.Error("Expected error opening encrypted value without a key")
+	}
+}
+
+// TestSealKeepsCompressedLookalikes checks that a payload that happens to
+// look like a compressed document reads back as submitted rather than
+// being decompressed
+func TestSealKeepsCompressedLookalikes(t *testing.T) {
+	ctx := context.Background()
+	lookalike, err := NewCipher(nil, WithCompression(CompressionGzip, 1024)).Seal(ctx, largePayload())
+	if err != nil || !IsCompressed(lookalike) {
+		t.Fatalf("Expected a compressed document, got %.60s, %v", lookalike, err)
+	}
+
+	ciphers := map[string]*Cipher{
+		"nil":        nil,
+		"compressed": NewCipher(nil, WithCompression(CompressionZstd, 64)),
+		"encrypted":  newTestCipher(t),
+	}
+	payloads := []json.RawMessage{
+		lookalike,
+		json.RawMessage(`{"raw": "taskflow:r1", "value": {"a": 1}}`),
+	}
+
+	for name, c := range ciphers {
+		t.Run(name, func(t *testing.T) {
+			for _, payload := range payloads {
+				sealed, err := c.Seal(ctx, payload)
+				if err != nil {
+					t.Fatalf("Expected no error sealing payload, got %v", err)
+				}
+
+				opened, err := c.Open(ctx, sealed)
+				if err != nil {
+					t.Fatalf("Expected no error opening payload, got %v", err)
+				}
+
+				if !bytes.Equal(opened, payload) {
+					t.Errorf("Expected %.60s to round-trip unchanged, got %.60s", payload, opened)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,272 @@
+package encryption
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"sync"
+)
+
+// envelopeVersion marks values produced by Cipher.Seal
+const envelopeVersion = "taskflow:v1"
+
+// rawVersion marks a value Cipher.Seal stored as is inside a raw document,
+// because Open would otherwise take it for one of its own documents
+const rawVersion = "taskflow:r1"
+
+// maxCachedKeys bounds the number of unwrapped data keys kept in memory
+const maxCachedKeys = 1024
+
+// KeyProvider generates and unwraps per-value data keys using a master key
+// that never leaves the provider (an environment secret or a KMS key)
+type KeyProvider interface {
+	// KeyID identifies the master key, recorded in every envelope
+	KeyID() string
+	// GenerateDataKey returns a fresh 256-bit data key and its wrapped form
+	GenerateDataKey(ctx context.Context) (plaintext, wrapped []byte, err error)
+	// Decrypt unwraps a data key produced by GenerateDataKey
+	Decrypt(ctx context.Context, wrapped []byte) ([]byte, error)
+}
+
+// envelope is the JSON document stored in place of an encrypted value.
+// It is valid JSON so it can live in JSONB columns unchanged.
+type envelope struct {
+	Version    string `json:"enc"`
+	KeyID      string `json:"kid"`
+	DataKey    []byte `json:"dk"`
+	Ciphertext []byte `json:"ct"`
+
+	// Compression is the algorithm the plaintext was compressed with
+	// before encryption, if any
+	Compression string `json:"z,omitempty"`
+}
+
+// raw is the JSON document stored in place of a value that looks like a
+// document written by Seal, so that Open returns it as written instead of
+// decrypting or decompressing it
+type raw struct {
+	Version string          `json:"raw"`
+	Value   json.RawMessage `json:"value"`
+}
+
+// Cipher performs envelope encryption of JSON values with AES-256-GCM,
+// optionally compressing large values first. A nil *Cipher passes values
+// through unchanged, apart from wrapping the ones Open would mistake for
+// its own documents.
+type Cipher struct {
+	provider KeyProvider // nil when values are only compressed
+
+	compression       string
+	compressThreshold int
+
+	mu   sync.Mutex
+	keys map[string][]byte
+}
+
+// NewCipher creates a cipher backed by the given key provider. With a nil
+// provider it only compresses values, as configured by WithCompression.
+func NewCipher(provider KeyProvider, opts ...CipherOption) *Cipher {
+	c := &Cipher{
+		provider: provider,
+		keys:     make(map[string][]byte),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Encrypts reports whether the cipher encrypts values, rather than only
+// compressing them
+func (c *Cipher) Encrypts() bool {
+	return c != nil && c.provider != nil
+}
+
+// Seal compresses and encrypts a JSON value, returning an envelope document
+func (c *Cipher) Seal(ctx context.Context, value json.RawMessage) (json.RawMessage, error) {
+	if len(value) == 0 {
+		return value, nil
+	}
+	if c == nil {
+		return escapeValue(value)
+	}
+	if c.provider == nil {
+		return c.compressValue(value)
+	}
+
+	plaintext, compression, err := c.compress(value)
+	if err != nil {
+		return nil, err
+	}
+
+	dataKey, wrapped, err := c.provider.GenerateDataKey(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate data key: %w", err)
+	}
+
+	ciphertext, err := seal(dataKey, plaintext)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(envelope{
+		Version:     envelopeVersion,
+		KeyID:       c.provider.KeyID(),
+		DataKey:     wrapped,
+		Ciphertext:  ciphertext,
+		Compression: compression,
+	})
+}
+
+// Open decrypts and decompresses a value produced by Seal. Values that are
+// not envelopes, such as those written before encryption was enabled, are
+// returned as is. Compressed values are decompressed whether or not
+// compression is still configured.
+func (c *Cipher) Open(ctx context.Context, value json.RawMessage) (json.RawMessage, error) {
+	if doc, ok := parseRaw(value); ok {
+		return doc.Value, nil
+	}
+
+	env, ok := parseEnvelope(value)
+	if !ok {
+		return decompressValue(value)
+	}
+	if !c.Encrypts() {
+		return nil, fmt.Errorf("value is encrypted with key %s but encryption is not configured", env.KeyID)
+	}
+
+	dataKey, err := c.dataKey(ctx, env.DataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	plaintext, err := open(dataKey, env.Ciphertext)
+	if err != nil || env.Compression == "" {
+		return plaintext, err
+	}
+
+	return decompressBytes(env.Compression, plaintext)
+}
+
+// IsEncrypted reports whether a value is an encryption envelope
+func IsEncrypted(value json.RawMessage) bool {
+	_, ok := parseEnvelope(value)
+	return ok
+}
+
+// dataKey unwraps a data key, caching the result since KMS calls are slow
+func (c *Cipher) dataKey(ctx context.Context, wrapped []byte) ([]byte, error) {
+	cacheKey := string(wrapped)
+
+	c.mu.Lock()
+	key, ok := c.keys[cacheKey]
+	c.mu.Unlock()
+	if ok {
+		return key, nil
+	}
+
+	key, err := c.provider.Decrypt(ctx, wrapped)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unwrap data key: %w", err)
+	}
+
+	c.mu.Lock()
+	if len(c.keys) >= maxCachedKeys {
+		c.keys = make(map[string][]byte)
+	}
+	c.keys[cacheKey] = key
+	c.mu.Unlock()
+
+	return key, nil
+}
+
+// escapeValue wraps a value in a raw document if Open would otherwise take
+// it for a document written by Seal. Other values are returned as is.
+func escapeValue(value json.RawMessage) (json.RawMessage, error) {
+	if !IsEncrypted(value) && !IsCompressed(value) && !isRaw(value) {
+		return value, nil
+	}
+	// Built by hand since json.Marshal would compact the value
+	doc := make(json.RawMessage, 0, len(value)+32)
+	doc = append(doc, `{"raw":"`+rawVersion+`","value":`...)
+	doc = append(doc, value...)
+	return append(doc, '}'), nil
+}
+
+func isRaw(value json.RawMessage) bool {
+	_, ok := parseRaw(value)
+	return ok
+}
+
+func parseRaw(value json.RawMessage) (*raw, bool) {
+	if len(value) == 0 || !bytes.Contains(value, []byte(rawVersion)) {
+		return nil, false
+	}
+
+	var doc raw
+	if err := json.Unmarshal(value, &doc); err != nil || doc.Version != rawVersion {
+		return nil, false
+	}
+
+	return &doc, true
+}
+
+func parseEnvelope(value json.RawMessage) (*envelope, bool) {
+	if len(value) == 0 || !bytes.Contains(value, []byte(envelopeVersion)) {
+		return nil, false
+	}
+
+	var env envelope
+	if err := json.Unmarshal(value, &env); err != nil || env.Version != envelopeVersion {
+		return nil, false
+	}
+
+	return &env, true
+}
+
+// seal encrypts plaintext with AES-GCM, prefixing the random nonce
+func seal(key, plaintext []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	return gcm.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+// open decrypts a value produced by seal
+func open(key, ciphertext []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(ciphertext) < gcm.NonceSize() {
+		return nil, fmt.Errorf("ciphertext too short")
+	}
+
+	nonce, sealed := ciphertext[:gcm.NonceSize()], ciphertext[gcm.NonceSize():]
+	plaintext, err := gcm.Open(nil, nonce, sealed, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt value: %w", err)
+	}
+
+	return plaintext, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid encryption key: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
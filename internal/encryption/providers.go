@@ -0,0 +1,139 @@
+package encryption
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	kmstypes "github.com/aws/aws-sdk-go-v2/service/kms/types"
+)
+
+// LocalKeyProvider wraps data keys with a master key supplied via the environment
+type LocalKeyProvider struct {
+	keyID     string
+	masterKey []byte
+}
+
+// NewLocalKeyProvider creates a provider from a base64-encoded 256-bit key
+func NewLocalKeyProvider(keyID, encodedKey string) (*LocalKeyProvider, error) {
+	masterKey, err := base64.StdEncoding.DecodeString(encodedKey)
+	if err != nil {
+		return nil, fmt.Errorf("encryption key must be base64 encoded: %w", err)
+	}
+	if len(masterKey) != 32 {
+		return nil, fmt.Errorf("encryption key must be 32 bytes, got %d", len(masterKey))
+	}
+
+	return &LocalKeyProvider{keyID: keyID, masterKey: masterKey}, nil
+}
+
+func (l *LocalKeyProvider) KeyID() string {
+	return l.keyID
+}
+
+func (l *LocalKeyProvider) GenerateDataKey(ctx context.Context) ([]byte, []byte, error) {
+	dataKey := make([]byte, 32)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, nil, err
+	}
+
+	wrapped, err := seal(l.masterKey, dataKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return dataKey, wrapped, nil
+}
+
+func (l *LocalKeyProvider) Decrypt(ctx context.Context, wrapped []byte) ([]byte, error) {
+	return open(l.masterKey, wrapped)
+}
+
+// KMSKeyProvider generates and unwraps data keys with AWS KMS
+type KMSKeyProvider struct {
+	keyID  string
+	client *kms.Client
+}
+
+// NewKMSKeyProvider creates a provider for a KMS key ID or ARN using the
+// default AWS credential chain
+func NewKMSKeyProvider(ctx context.Context, keyID string) (*KMSKeyProvider, error) {
+	cfg, err := awsconfig.LoadDefaultConfig(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS config: %w", err)
+	}
+
+	return &KMSKeyProvider{keyID: keyID, client: kms.NewFromConfig(cfg)}, nil
+}
+
+func (k *KMSKeyProvider) KeyID() string {
+	return k.keyID
+}
+
+func (k *KMSKeyProvider) GenerateDataKey(ctx context.Context) ([]byte, []byte, error) {
+	out, err := k.client.GenerateDataKey(ctx, &kms.GenerateDataKeyInput{
+		KeyId:   &k.keyID,
+		KeySpec: kmstypes.DataKeySpecAes256,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return out.Plaintext, out.CiphertextBlob, nil
+}
+
+func (k *KMSKeyProvider) Decrypt(ctx context.Context, wrapped []byte) ([]byte, error) {
+	out, err := k.client.Decrypt(ctx, &kms.DecryptInput{
+		KeyId:          &k.keyID,
+		CiphertextBlob: wrapped,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return out.Plaintext, nil
+}
+
+// Config selects the master key used for payload encryption
+type Config struct {
+	Key      string // base64-encoded 256-bit key
+	KeyID    string // label recorded with values sealed by Key
+	KMSKeyID string // AWS KMS key ID or ARN; takes precedence over Key
+
+	Compression       string // gzip or zstd; empty disables compression
+	CompressThreshold int    // smallest value compressed, in bytes
+}
+
+// NewCipherFromConfig builds a cipher from cfg. It returns nil when neither
+// a key nor compression is configured, leaving payloads as they are.
+func NewCipherFromConfig(ctx context.Context, cfg Config) (*Cipher, error) {
+	var opts []CipherOption
+	if cfg.Compression != "" {
+		if !ValidCompression(cfg.Compression) {
+			return nil, fmt.Errorf("unknown compression algorithm: %s", cfg.Compression)
+		}
+		opts = append(opts, WithCompression(cfg.Compression, cfg.CompressThreshold))
+	}
+
+	switch {
+	case cfg.KMSKeyID != "":
+		provider, err := NewKMSKeyProvider(ctx, cfg.KMSKeyID)
+		if err != nil {
+			return nil, err
+		}
+		return NewCipher(provider, opts...), nil
+	case cfg.Key != "":
+		provider, err := NewLocalKeyProvider(cfg.KeyID, cfg.Key)
+		if err != nil {
+			return nil, err
+		}
+		return NewCipher(provider, opts...), nil
+	case len(opts) > 0:
+		return NewCipher(nil, opts...), nil
+	default:
+		return nil, nil
+	}
+}
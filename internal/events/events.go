@@ -0,0 +1,137 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"taskflow/internal/types"
+	"time"
+)
+
+// EventType identifies a job lifecycle transition
+type EventType string
+
+const (
+	EventJobCreated   EventType = "job.created"
+	EventJobStarted   EventType = "job.started"
+	EventJobCompleted EventType = "job.completed"
+	EventJobFailed    EventType = "job.failed"
+	EventJobRetrying  EventType = "job.retrying"
+	EventJobCancelled EventType = "job.cancelled"
+)
+
+// Event is the message published to the configured sink
+type Event struct {
+	ID        string          `json:"id"`
+	Type      EventType       `json:"type"`
+	JobID     string          `json:"job_id"`
+	JobType   types.JobType   `json:"job_type"`
+	Status    types.JobStatus `json:"status"`
+	Attempts  int             `json:"attempts"`
+	WorkerID  string          `json:"worker_id,omitempty"`
+	Error     string          `json:"error,omitempty"`
+	ErrorCode types.ErrorCode `json:"error_code,omitempty"`
+	Timestamp time.Time       `json:"timestamp"`
+}
+
+// NewJobEvent builds an event from the current state of a job
+func NewJobEvent(eventType EventType, job *types.Job) *Event {
+	return &Event{
+		ID:        types.GenerateJobID(),
+		Type:      eventType,
+		JobID:     job.ID,
+		JobType:   job.Type,
+		Status:    job.Status,
+		Attempts:  job.Attempts,
+		WorkerID:  job.WorkerID,
+		Error:     job.Error,
+		ErrorCode: job.ErrorCode,
+		Timestamp: time.Now(),
+	}
+}
+
+// Sink delivers encoded events to an external system
+type Sink interface {
+	Publish(ctx context.Context, key string, data []byte) error
+	Close() error
+}
+
+// Bus publishes job lifecycle events to a sink.
+// A nil *Bus is valid and silently drops all events.
+type Bus struct {
+	sink    Sink
+	timeout time.Duration
+}
+
+// NewBus creates an event bus backed by the given sink
+func NewBus(sink Sink) *Bus {
+	return &Bus{
+		sink:    sink,
+		timeout: 5 * time.Second,
+	}
+}
+
+// Publish sends an event to the sink. Failures are logged rather than
+// returned so that event delivery never affects job processing.
+func (b *Bus) Publish(ctx context.Context, event *Event) {
+	if b == nil || b.sink == nil {
+		return
+	}
+
+	data, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("Failed to marshal %s event for job %s: %v", event.Type, event.JobID, err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), b.timeout)
+	defer cancel()
+
+	if err := b.sink.Publish(ctx, event.JobID, data); err != nil {
+		log.Printf("Failed to publish %s event for job %s: %v", event.Type, event.JobID, err)
+	}
+}
+
+// PublishJob is a convenience wrapper around NewJobEvent and Publish
+func (b *Bus) PublishJob(ctx context.Context, eventType EventType, job *types.Job) {
+	if b == nil {
+		return
+	}
+	b.Publish(ctx, NewJobEvent(eventType, job))
+}
+
+// Close releases the underlying sink
+func (b *Bus) Close() error {
+	if b == nil || b.sink == nil {
+		return nil
+	}
+	return b.sink.Close()
+}
+
+// Config selects and configures an event sink
+type Config struct {
+	Sink   string // "redis", "kafka", "nats" or empty to disable
+	Addr   string // Kafka brokers (comma separated) or NATS URL
+	Target string // Redis channel, Kafka topic or NATS subject
+}
+
+// NewSink creates the sink described by cfg. The Redis sink publishes
+// through the supplied client so it shares the queue's connection pool.
+func NewSink(cfg Config, redisClient RedisPublisher) (Sink, error) {
+	switch cfg.Sink {
+	case "":
+		return nil, nil
+	case "redis":
+		if redisClient == nil {
+			return nil, fmt.Errorf("redis event sink requires the Redis queue backend")
+		}
+		return NewRedisSink(redisClient, cfg.Target), nil
+	case "kafka":
+		return NewKafkaSink(cfg.Addr, cfg.Target)
+	case "nats":
+		return NewNATSSink(cfg.Addr, cfg.Target)
+	default:
+		return nil, fmt.Errorf("unknown event sink: %s", cfg.Sink)
+	}
+}
@@ -0,0 +1,73 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"taskflow/internal/types"
+	"testing"
+)
+
+type recordingSink struct {
+	keys     []string
+	messages [][]byte
+}
+
+func (r *recordingSink) Publish(ctx context.Context, key string, data []byte) error {
+	r.keys = append(r.keys, key)
+	r.messages = append(r.messages, data)
+	return nil
+}
+
+func (r *recordingSink) Close() error {
+	return nil
+}
+
+func TestBusPublishJob(t *testing.T) {
+	sink := &recordingSink{}
+	bus := NewBus(sink)
+
+	job := &types.Job{
+		ID:       "job-1",
+		Type:     types.JobTypeEmail,
+		Status:   types.JobStatusProcessing,
+		WorkerID: "worker-1",
+	}
+
+	bus.PublishJob(context.Background(), EventJobStarted, job)
+
+	if len(sink.messages) != 1 {
+		t.Fatalf("Expected 1 published message, got %d", len(sink.messages))
+	}
+
+	if sink.keys[0] != job.ID {
+		t.Errorf("Expected message key %s, got %s", job.ID, sink.keys[0])
+	}
+
+	var event Event
+	if err := json.Unmarshal(sink.messages[0], &event); err != nil {
+		t.Fatalf("Failed to unmarshal event: %v", err)
+	}
+
+	if event.Type != EventJobStarted {
+		t.Errorf("Expected event type %s, got %s", EventJobStarted, event.Type)
+	}
+
+	if event.WorkerID != "worker-1" {
+		t.Errorf("Expected worker ID worker-1, got %s", event.WorkerID)
+	}
+}
+
+func TestNilBusIsNoop(t *testing.T) {
+	var bus *Bus
+	bus.PublishJob(context.Background(), EventJobCreated, &types.Job{ID: "job-1"})
+
+	if err := bus.Close(); err != nil {
+		t.Errorf("Expected nil bus Close to succeed, got %v", err)
+	}
+}
+
+func TestNewSinkUnknown(t *testing.T) {
+	if _, err := NewSink(Config{Sink: "carrier-pigeon"}, nil); err == nil {
+		t.Error("Expected error for unknown sink type")
+	}
+}
@@ -0,0 +1,95 @@
+package events
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/nats-io/nats.go"
+	"github.com/redis/go-redis/v9"
+	"github.com/segmentio/kafka-go"
+)
+
+// RedisPublisher is the subset of the Redis client used by RedisSink
+type RedisPublisher interface {
+	Publish(ctx context.Context, channel string, message interface{}) *redis.IntCmd
+}
+
+// RedisSink publishes events to a Redis pub/sub channel
+type RedisSink struct {
+	client  RedisPublisher
+	channel string
+}
+
+func NewRedisSink(client RedisPublisher, channel string) *RedisSink {
+	return &RedisSink{client: client, channel: channel}
+}
+
+func (r *RedisSink) Publish(ctx context.Context, key string, data []byte) error {
+	return r.client.Publish(ctx, r.channel, data).Err()
+}
+
+// Close is a no-op; the Redis client is owned by the queue
+func (r *RedisSink) Close() error {
+	return nil
+}
+
+// KafkaSink publishes events to a Kafka topic, keyed by job ID so that
+// all events for a job land on the same partition in order
+type KafkaSink struct {
+	writer *kafka.Writer
+}
+
+func NewKafkaSink(brokers, topic string) (*KafkaSink, error) {
+	if brokers == "" {
+		return nil, fmt.Errorf("kafka sink requires at least one broker")
+	}
+
+	writer := &kafka.Writer{
+		Addr:                   kafka.TCP(strings.Split(brokers, ",")...),
+		Topic:                  topic,
+		Balancer:               &kafka.Hash{},
+		RequiredAcks:           kafka.RequireOne,
+		AllowAutoTopicCreation: true,
+	}
+
+	return &KafkaSink{writer: writer}, nil
+}
+
+func (k *KafkaSink) Publish(ctx context.Context, key string, data []byte) error {
+	return k.writer.WriteMessages(ctx, kafka.Message{
+		Key:   []byte(key),
+		Value: data,
+	})
+}
+
+func (k *KafkaSink) Close() error {
+	return k.writer.Close()
+}
+
+// NATSSink publishes events to a NATS subject
+type NATSSink struct {
+	conn    *nats.Conn
+	subject string
+}
+
+func NewNATSSink(url, subject string) (*NATSSink, error) {
+	if url == "" {
+		url = nats.DefaultURL
+	}
+
+	conn, err := nats.Connect(url, nats.Name("taskflow"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to NATS: %w", err)
+	}
+
+	return &NATSSink{conn: conn, subject: subject}, nil
+}
+
+func (n *NATSSink) Publish(ctx context.Context, key string, data []byte) error {
+	return n.conn.Publish(n.subject, data)
+}
+
+func (n *NATSSink) Close() error {
+	return n.conn.Drain()
+}
@@ -0,0 +1,234 @@
+package ingest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"taskflow/internal/blobstore"
+	"taskflow/internal/events"
+	"taskflow/internal/queue"
+	"taskflow/internal/storage"
+	"taskflow/internal/tenant"
+	"taskflow/internal/types"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// TenantHeader names the Kafka header that assigns a job to a tenant
+const TenantHeader = "tenant_id"
+
+// Config describes the Kafka topic job requests are read from
+type Config struct {
+	Brokers string // comma separated
+	Topic   string
+	GroupID string
+}
+
+// KafkaConsumer creates jobs from requests published to a Kafka topic, so
+// event-driven pipelines can submit jobs without going through the API.
+// Each message holds a JSON JobRequest; the tenant_id header picks the
+// tenant, which otherwise defaults to the default tenant.
+//
+// Offsets are committed once a job has been stored and queued, so delivery
+// is at least once: a consumer that stops between the two can create a
+// request's job twice. Invalid requests are logged and skipped. Storage and
+// queue failures are retried until they succeed, holding up the partition
+// meanwhile.
+type KafkaConsumer struct {
+	reader          *kafka.Reader
+	queue           queue.Queue
+	storage         storage.Storage
+	events          *events.Bus
+	offloader       *blobstore.PayloadOffloader
+	tenants         *tenant.Registry
+	maxPayloadBytes int
+}
+
+// Option configures optional KafkaConsumer behaviour
+type Option func(*KafkaConsumer)
+
+// WithEventBus publishes job.created events for ingested jobs
+func WithEventBus(bus *events.Bus) Option {
+	return func(c *KafkaConsumer) {
+		c.events = bus
+	}
+}
+
+// WithPayloadOffloader moves large payloads to blob storage
+func WithPayloadOffloader(offloader *blobstore.PayloadOffloader) Option {
+	return func(c *KafkaConsumer) {
+		c.offloader = offloader
+	}
+}
+
+// WithTenants only accepts jobs for registered tenants when multi-tenancy
+// is enabled
+func WithTenants(registry *tenant.Registry) Option {
+	return func(c *KafkaConsumer) {
+		c.tenants = registry
+	}
+}
+
+// WithMaxPayloadBytes skips requests whose payload is larger than n bytes
+func WithMaxPayloadBytes(n int) Option {
+	return func(c *KafkaConsumer) {
+		c.maxPayloadBytes = n
+	}
+}
+
+// NewKafkaConsumer creates a consumer in the configured consumer group
+func NewKafkaConsumer(cfg Config, q queue.Queue, s storage.Storage, opts ...Option) (*KafkaConsumer, error) {
+	if cfg.Brokers == "" {
+		return nil, fmt.Errorf("kafka ingestion requires at least one broker")
+	}
+	if cfg.Topic == "" {
+		return nil, fmt.Errorf("kafka ingestion requires a topic")
+	}
+
+	c := &KafkaConsumer{
+		reader: kafka.NewReader(kafka.ReaderConfig{
+			Brokers: strings.Split(cfg.Brokers, ","),
+			Topic:   cfg.Topic,
+			GroupID: cfg.GroupID,
+		}),
+		queue:   q,
+		storage: s,
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c, nil
+}
+
+// Run consumes job requests until ctx is cancelled
+func (c *KafkaConsumer) Run(ctx context.Context) error {
+	for {
+		msg, err := c.reader.FetchMessage(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return fmt.Errorf("failed to read job request: %w", err)
+		}
+
+		if err := c.ingest(ctx, msg); err != nil {
+			return err
+		}
+
+		if err := c.reader.CommitMessages(ctx, msg); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return fmt.Errorf("failed to commit job request: %w", err)
+		}
+	}
+}
+
+// Close leaves the consumer group
+func (c *KafkaConsumer) Close() error {
+	return c.reader.Close()
+}
+
+// ingest creates the job requested by msg, retrying failures until ctx is
+// cancelled. Invalid requests are skipped.
+func (c *KafkaConsumer) ingest(ctx context.Context, msg kafka.Message) error {
+	job, err := c.decode(msg)
+	if err != nil {
+		log.Printf("Skipping invalid job request at %s/%d/%d: %v", msg.Topic, msg.Partition, msg.Offset, err)
+		return nil
+	}
+
+	delay := time.Second
+	for {
+		err := c.submit(ctx, job)
+		if err == nil {
+			log.Printf("Ingested job %s (%s) from %s/%d/%d", job.ID, job.Type, msg.Topic, msg.Partition, msg.Offset)
+			return nil
+		}
+		log.Printf("Failed to ingest job request at %s/%d/%d, retrying in %v: %v", msg.Topic, msg.Partition, msg.Offset, delay, err)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+		if delay < 30*time.Second {
+			delay *= 2
+		}
+	}
+}
+
+// decode validates a message and builds the job it requests
+func (c *KafkaConsumer) decode(msg kafka.Message) (*types.Job, error) {
+	var req types.JobRequest
+	if err := json.Unmarshal(msg.Value, &req); err != nil {
+		return nil, fmt.Errorf("invalid JSON: %w", err)
+	}
+
+	for _, chained := range req.Chain() {
+		if c.maxPayloadBytes > 0 && len(chained.Payload) > c.maxPayloadBytes {
+			return nil, fmt.Errorf("payload is %d bytes, maximum is %d", len(chained.Payload), c.maxPayloadBytes)
+		}
+	}
+
+	if err := types.ValidateJobRequest(&req); err != nil {
+		return nil, err
+	}
+
+	tenantID, err := c.tenantID(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	job := types.NewJob(&req)
+	job.TenantID = tenantID
+	return job, nil
+}
+
+// tenantID returns the tenant named by the message's tenant header. Without
+// multi-tenancy every job belongs to the default tenant.
+func (c *KafkaConsumer) tenantID(msg kafka.Message) (string, error) {
+	if !c.tenants.Enabled() {
+		return types.DefaultTenantID, nil
+	}
+
+	for _, h := range msg.Headers {
+		if h.Key != TenantHeader || len(h.Value) == 0 {
+			continue
+		}
+		if _, ok := c.tenants.Get(string(h.Value)); !ok {
+			return "", fmt.Errorf("unknown tenant: %s", h.Value)
+		}
+		return string(h.Value), nil
+	}
+	return types.DefaultTenantID, nil
+}
+
+// submit stores and queues a job the way the API does. On retry, a job
+// stored by an earlier attempt is only queued.
+func (c *KafkaConsumer) submit(ctx context.Context, job *types.Job) error {
+	if _, err := c.storage.GetJob(ctx, job.ID); err != nil {
+		if !errors.Is(err, storage.ErrJobNotFound) {
+			return err
+		}
+		if _, err := c.offloader.Offload(ctx, job); err != nil {
+			return fmt.Errorf("failed to offload job payload: %w", err)
+		}
+		if err := c.storage.CreateJob(ctx, job); err != nil {
+			return err
+		}
+	}
+
+	if err := c.queue.EnqueueJob(ctx, job); err != nil {
+		return err
+	}
+
+	c.events.PublishJob(ctx, events.EventJobCreated, job)
+	return nil
+}
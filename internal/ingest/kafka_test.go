@@ -0,0 +1,88 @@
+package ingest
+
+import (
+	"taskflow/internal/tenant"
+	"taskflow/internal/types"
+	"testing"
+
+	"github.com/segmentio/kafka-go"
+)
+
+func TestDecodeJobRequest(t *testing.T) {
+	c := &KafkaConsumer{maxPayloadBytes: 1024}
+
+	job, err := c.decode(kafka.Message{
+		Value:   []byte(`{"type": "webhook", "payload": {"url": "https://example.com/hook"}, "max_attempts": 5}`),
+		Headers: []kafka.Header{{Key: TenantHeader, Value: []byte("acme")}},
+	})
+	if err != nil {
+		t.Fatalf("Expected valid request, got %v", err)
+	}
+
+	if job.Type != types.JobTypeWebhook {
+		t.Errorf("Expected webhook job, got %s", job.Type)
+	}
+	if job.MaxAttempts != 5 {
+		t.Errorf("Expected 5 max attempts, got %d", job.MaxAttempts)
+	}
+	if job.TenantID != types.DefaultTenantID {
+		t.Errorf("Expected default tenant without multi-tenancy, got %s", job.TenantID)
+	}
+}
+
+func TestDecodeRejectsInvalidRequests(t *testing.T) {
+	c := &KafkaConsumer{maxPayloadBytes: 64}
+
+	tests := map[string]string{
+		"malformed JSON":  `{"type": "email"`,
+		"unknown type":    `{"type": "fax", "payload": {}}`,
+		"invalid payload": `{"type": "email", "payload": {"subject": "Hi"}}`,
+		"payload too large": `{"type": "webhook", "payload": {"url": "https://example.com/` +
+			`a-very-long-path-that-pushes-the-payload-over-the-limit"}}`,
+	}
+
+	for name, value := range tests {
+		if _, err := c.decode(kafka.Message{Value: []byte(value)}); err == nil {
+			t.Errorf("%s: expected request to be rejected", name)
+		}
+	}
+}
+
+func TestDecodeTenantHeader(t *testing.T) {
+	registry, err := tenant.NewRegistry([]*tenant.Tenant{
+		{ID: "acme", APIKeys: []string{"acme-key"}},
+	})
+	if err != nil {
+		t.Fatalf("Expected no error building registry, got %v", err)
+	}
+	c := &KafkaConsumer{tenants: registry}
+
+	value := []byte(`{"type": "webhook", "payload": {"url": "https://example.com/hook"}}`)
+
+	job, err := c.decode(kafka.Message{
+		Value:   value,
+		Headers: []kafka.Header{{Key: TenantHeader, Value: []byte("acme")}},
+	})
+	if err != nil {
+		t.Fatalf("Expected known tenant to be accepted, got %v", err)
+	}
+	if job.TenantID != "acme" {
+		t.Errorf("Expected tenant acme, got %s", job.TenantID)
+	}
+
+	job, err = c.decode(kafka.Message{Value: value})
+	if err != nil {
+		t.Fatalf("Expected request without tenant header to be accepted, got %v", err)
+	}
+	if job.TenantID != types.DefaultTenantID {
+		t.Errorf("Expected default tenant, got %s", job.TenantID)
+	}
+
+	_, err = c.decode(kafka.Message{
+		Value:   value,
+		Headers: []kafka.Header{{Key: TenantHeader, Value: []byte("globex")}},
+	})
+	if err == nil {
+		t.Error("Expected unknown tenant to be rejected")
+	}
+}
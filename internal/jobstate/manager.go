@@ -0,0 +1,423 @@
+// Package jobstate owns job state transitions. A job lives both in the
+// queue and in PostgreSQL, and each copy is the source of truth for part of
+// its life:
+//
+//   - scheduled, pending, processing and retrying jobs are decided by the
+//     queue, which claims and transitions them atomically. PostgreSQL
+//     follows it.
+//   - completed, failed, cancelled and expired jobs are recorded in
+//     PostgreSQL, which
+//     keeps them after the queue's copy expires. Final states never change.
+//
+// Every transition goes to the queue first and is then copied to
+// PostgreSQL from the queue's result. Copies that still diverge, because a
+// process died between the two writes or one of them failed, are repaired
+// by Reconcile.
+//
+// Each run of a job is also recorded as an attempt, with its worker,
+// duration, outcome and error, so a job's history survives the job's own
+// error being overwritten by its next attempt.
+package jobstate
+
+import (
+	"context"
+	"errors"
+	"log"
+	"taskflow/internal/metrics"
+	"taskflow/internal/queue"
+	"taskflow/internal/storage"
+	"taskflow/internal/types"
+	"time"
+)
+
+const (
+	// reconcileGrace leaves recently updated jobs to the transition in
+	// progress
+	reconcileGrace = time.Minute
+
+	// reconcileBatch is how many jobs Reconcile reads at a time
+	reconcileBatch = 500
+
+	// storeAttempts bounds how often a write that lost a race with another
+	// writer is retried
+	storeAttempts = 3
+)
+
+// Manager applies job state transitions to the queue and PostgreSQL
+type Manager struct {
+	queue   queue.Queue
+	storage storage.Storage
+}
+
+// NewManager creates a job state manager
+func NewManager(q queue.Queue, s storage.Storage) *Manager {
+	return &Manager{queue: q, storage: s}
+}
+
+// Claimed records a job a worker has claimed from the queue, and starts
+// its attempt
+func (m *Manager) Claimed(ctx context.Context, job *types.Job) {
+	m.store(ctx, job)
+	if err := m.storage.StartAttempt(ctx, job); err != nil {
+		log.Printf("Failed to record attempt of job %s: %v", job.ID, err)
+	}
+}
+
+// Complete marks a processing job as completed and updates job to match.
+// It returns queue.ErrJobConflict if the job is no longer processing.
+func (m *Manager) Complete(ctx context.Context, job *types.Job) error {
+	if err := m.queue.CompleteJob(ctx, job.ID, nil); err != nil {
+		return err
+	}
+	m.endAttempt(ctx, job.ID, types.AttemptSucceeded, "")
+
+	m.settle(ctx, job, func(job *types.Job) error {
+		now := time.Now()
+		job.UpdatedAt = now
+		job.CompletedAt = &now
+		return job.Transition(types.JobStatusCompleted)
+	})
+	return nil
+}
+
+// Fail records a failed attempt, which the queue retries if the job has
+// attempts left and the failure isn't permanent, and updates job to match.
+// It returns queue.ErrJobConflict if the job already finished.
+func (m *Manager) Fail(ctx context.Context, job *types.Job, failure types.Failure) error {
+	if err := m.queue.FailJob(ctx, job.ID, failure); err != nil {
+		return err
+	}
+	m.endAttempt(ctx, job.ID, types.AttemptFailed, failure.Message)
+	metrics.IncJobFailures(string(job.Type), string(failure.Code))
+
+	m.settle(ctx, job, func(job *types.Job) error {
+		now := time.Now()
+		job.Error = failure.Message
+		job.ErrorCode = failure.Code
+		job.Attempts++
+		job.UpdatedAt = now
+		if failure.Retry(job.Attempts, job.MaxAttempts) {
+			job.ScheduledAt = now.Add(failure.Delay(job.Type, job.Attempts))
+			return job.Transition(types.JobStatusRetrying)
+		}
+		job.CompletedAt = &now
+		return job.Transition(types.JobStatusFailed)
+	})
+	return nil
+}
+
+// Cancel stops a job on behalf of a user and updates job to match. It
+// returns queue.ErrJobConflict if the job already finished.
+func (m *Manager) Cancel(ctx context.Context, job *types.Job) error {
+	if err := m.queue.CancelJob(ctx, job.ID); err != nil {
+		return err
+	}
+	m.endAttempt(ctx, job.ID, types.AttemptCancelled, "")
+
+	m.settle(ctx, job, func(job *types.Job) error {
+		now := time.Now()
+		job.UpdatedAt = now
+		job.CompletedAt = &now
+		return job.Transition(types.JobStatusCancelled)
+	})
+	return nil
+}
+
+// RunExpiry expires waiting jobs past their expiry every interval until ctx
+// is done
+func (m *Manager) RunExpiry(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		expired, err := m.Expire(ctx)
+		if err != nil && ctx.Err() == nil {
+			log.Printf("Failed to expire jobs: %v", err)
+		}
+		if expired > 0 {
+			log.Printf("Expired %d jobs that waited past their expiry", expired)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Expire stops up to reconcileBatch scheduled, pending and retrying jobs
+// whose expiry passed, oldest expiry first, and returns how many it
+// expired. Workers also expire such jobs as they reach them; Expire catches
+// the ones stuck behind a backlog or on a type no worker runs.
+func (m *Manager) Expire(ctx context.Context) (int, error) {
+	jobs, err := m.storage.ExpiredJobs(ctx, time.Now(), reconcileBatch)
+	if err != nil {
+		return 0, err
+	}
+
+	expired := 0
+	for i := range jobs {
+		job := &jobs[i]
+		// A job the queue claimed, stopped or lost meanwhile is settled from
+		// what the queue has
+		err := m.queue.ExpireJob(ctx, job.ID)
+		if err != nil && !errors.Is(err, queue.ErrJobConflict) && !errors.Is(err, storage.ErrJobNotFound) {
+			return expired, err
+		}
+
+		m.settle(ctx, job, func(job *types.Job) error {
+			now := time.Now()
+			job.UpdatedAt = now
+			job.CompletedAt = &now
+			return job.Transition(types.JobStatusExpired)
+		})
+		if err == nil {
+			expired++
+		}
+	}
+	return expired, nil
+}
+
+// Requeue returns a processing job to the pending queue without counting
+// an attempt, and updates job to match
+func (m *Manager) Requeue(ctx context.Context, job *types.Job) error {
+	if err := m.queue.RequeueJob(ctx, job.ID); err != nil {
+		return err
+	}
+	m.endAttempt(ctx, job.ID, types.AttemptInterrupted, "")
+
+	m.settle(ctx, job, func(job *types.Job) error {
+		job.WorkerID = ""
+		job.StartedAt = nil
+		job.UpdatedAt = time.Now()
+		return job.Transition(types.JobStatusPending)
+	})
+	return nil
+}
+
+// Park puts off a processing job until until without counting an attempt,
+// and updates job to match
+func (m *Manager) Park(ctx context.Context, job *types.Job, until time.Time, reason string) error {
+	if err := m.queue.ParkJob(ctx, job.ID, until); err != nil {
+		return err
+	}
+	m.endAttempt(ctx, job.ID, types.AttemptParked, reason)
+
+	m.settle(ctx, job, func(job *types.Job) error {
+		job.WorkerID = ""
+		job.StartedAt = nil
+		job.ScheduledAt = until
+		job.UpdatedAt = time.Now()
+		return job.Transition(types.JobStatusScheduled)
+	})
+	return nil
+}
+
+// endAttempt records how a job's running attempt ended
+func (m *Manager) endAttempt(ctx context.Context, jobID string, outcome types.AttemptOutcome, message string) {
+	if err := m.storage.EndAttempt(ctx, jobID, outcome, message); err != nil {
+		log.Printf("Failed to record attempt of job %s: %v", jobID, err)
+	}
+}
+
+// settle copies the state the queue reached onto job, stores it, and counts
+// jobs that finished. If the queue can't be read, expect applies the
+// transition's expected outcome instead, and Reconcile corrects any
+// difference later.
+func (m *Manager) settle(ctx context.Context, job *types.Job, expect func(*types.Job) error) {
+	latest, err := m.queue.GetJob(ctx, job.ID)
+	if err == nil {
+		copyState(job, latest)
+	} else {
+		log.Printf("Failed to read job %s after its transition: %v", job.ID, err)
+		if err := expect(job); err != nil {
+			// The queue accepted the transition, so the local copy is stale
+			log.Printf("Leaving job %s to reconciliation: %v", job.ID, err)
+			return
+		}
+	}
+	m.store(ctx, job)
+	m.announce(ctx, job.ID)
+
+	if job.Status.IsFinal() {
+		metrics.IncJobsTotal(string(job.Type), string(job.Status))
+	}
+}
+
+// store writes job's state to PostgreSQL, unless the stored job already
+// finished. The write is based on the stored version it read, and is
+// retried on the new version if another writer got there first.
+func (m *Manager) store(ctx context.Context, job *types.Job) {
+	for attempt := 0; attempt < storeAttempts; attempt++ {
+		status, version, err := m.storage.JobVersion(ctx, job.ID)
+		if err != nil {
+			log.Printf("Failed to store state of job %s: %v", job.ID, err)
+			return
+		}
+		if status.IsFinal() {
+			return
+		}
+
+		job.Version = version
+		err = m.storage.UpdateJob(ctx, job)
+		if !errors.Is(err, storage.ErrJobConflict) {
+			if err != nil {
+				log.Printf("Failed to store state of job %s: %v", job.ID, err)
+			}
+			return
+		}
+	}
+	log.Printf("Failed to store state of job %s: it kept changing", job.ID)
+}
+
+// copyState copies the fields that change with a job's state
+func copyState(job, latest *types.Job) {
+	job.Status = latest.Status
+	job.Error = latest.Error
+	job.ErrorCode = latest.ErrorCode
+	job.Attempts = latest.Attempts
+	job.WorkerID = latest.WorkerID
+	job.UpdatedAt = latest.UpdatedAt
+	job.ScheduledAt = latest.ScheduledAt
+	job.StartedAt = latest.StartedAt
+	job.CompletedAt = latest.CompletedAt
+	job.Progress = latest.Progress
+	job.Checkpoint = latest.Checkpoint
+}
+
+// diverged reports whether the stored copy of a job differs from the
+// queue's in its state. PostgreSQL rounds timestamps to the microsecond
+// while Redis keeps nanoseconds, so update times within a microsecond of
+// each other are the same.
+func diverged(stored, queued *types.Job) bool {
+	skew := stored.UpdatedAt.Sub(queued.UpdatedAt)
+	return stored.Status != queued.Status ||
+		stored.Attempts != queued.Attempts ||
+		stored.WorkerID != queued.WorkerID ||
+		skew >= time.Microsecond || skew <= -time.Microsecond
+}
+
+// Run reconciles job state every interval until ctx is done
+func (m *Manager) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		repaired, err := m.Reconcile(ctx)
+		if err != nil && ctx.Err() == nil {
+			log.Printf("Failed to reconcile job state: %v", err)
+		}
+		if repaired > 0 {
+			log.Printf("Reconciled the state of %d jobs", repaired)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Reconcile repairs unfinished jobs whose stored state differs from the
+// queue's and returns how many it repaired. Jobs the queue has a different
+// state for are updated from it; jobs the queue lost are queued again.
+func (m *Manager) Reconcile(ctx context.Context) (int, error) {
+	before := time.Now().Add(-reconcileGrace)
+	repaired := 0
+
+	afterID := ""
+	for {
+		jobs, err := m.storage.UnfinishedJobs(ctx, before, afterID, reconcileBatch)
+		if err != nil {
+			return repaired, err
+		}
+
+		for i := range jobs {
+			stored := &jobs[i]
+			fixed, err := m.reconcileJob(ctx, stored)
+			if err != nil {
+				return repaired, err
+			}
+			if fixed {
+				repaired++
+			}
+		}
+
+		if len(jobs) < reconcileBatch {
+			return repaired, nil
+		}
+		afterID = jobs[len(jobs)-1].ID
+	}
+}
+
+// reconcileJob repairs one unfinished stored job and reports whether it
+// had to
+func (m *Manager) reconcileJob(ctx context.Context, stored *types.Job) (bool, error) {
+	queued, err := m.queue.GetJob(ctx, stored.ID)
+	if errors.Is(err, storage.ErrJobNotFound) {
+		return m.restore(ctx, stored)
+	}
+	if err != nil {
+		return false, err
+	}
+	if !diverged(stored, queued) {
+		return false, nil
+	}
+
+	// The queue decides in-flight jobs; only apply its state if the stored
+	// job didn't change since it was read
+	copyState(stored, queued)
+	return m.update(ctx, stored)
+}
+
+// restore queues a stored job the queue has lost, e.g. after Redis lost
+// data, so that it runs instead of staying unfinished forever
+func (m *Manager) restore(ctx context.Context, job *types.Job) (bool, error) {
+	status := job.Status
+	if status == types.JobStatusProcessing {
+		// Its claim was lost with it
+		if err := job.Transition(types.JobStatusPending); err != nil {
+			return false, err
+		}
+		m.endAttempt(ctx, job.ID, types.AttemptAbandoned, "")
+	}
+	job.WorkerID = ""
+	job.StartedAt = nil
+	job.Progress = nil
+	job.UpdatedAt = time.Now()
+
+	updated, err := m.update(ctx, job)
+	if err != nil || !updated {
+		return false, err
+	}
+	if err := m.queue.EnqueueJob(ctx, job); err != nil {
+		return false, err
+	}
+
+	log.Printf("Job %s was %s but missing from the queue, queued it again", job.ID, status)
+	return true, nil
+}
+
+// update writes a job read by Reconcile if no one changed it since. A job
+// that changed is left for the next pass.
+func (m *Manager) update(ctx context.Context, job *types.Job) (bool, error) {
+	err := m.storage.UpdateJob(ctx, job)
+	if errors.Is(err, storage.ErrJobConflict) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	m.announce(ctx, job.ID)
+	return true, nil
+}
+
+// announce tells API servers that a job's state changed, so that they drop
+// cached copies of it
+func (m *Manager) announce(ctx context.Context, jobID string) {
+	if err := m.queue.PublishJobUpdate(ctx, jobID); err != nil {
+		log.Printf("Failed to announce update of job %s: %v", jobID, err)
+	}
+}
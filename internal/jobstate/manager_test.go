@@ -0,0 +1,75 @@
+package jobstate
+
+import (
+	"context"
+	"encoding/json"
+	"taskflow/internal/queue/queuetest"
+	"taskflow/internal/storage/storagetest"
+	"taskflow/internal/types"
+	"testing"
+	"time"
+)
+
+func TestCopyState(t *testing.T) {
+	now := time.Now()
+	job := &types.Job{ID: "job-1", Status: types.JobStatusProcessing, Payload: json.RawMessage(`{"to":"a@b.c"}`), WorkerID: "worker-1"}
+	latest := &types.Job{ID: "job-1", Status: types.JobStatusRetrying, Attempts: 1, Error: "boom", UpdatedAt: now, ScheduledAt: now.Add(time.Minute)}
+
+	if !diverged(job, latest) {
+		t.Fatal("jobs with different statuses should have diverged")
+	}
+
+	copyState(job, latest)
+	if diverged(job, latest) {
+		t.Errorf("job still differs after copying its state: %+v", job)
+	}
+	if job.WorkerID != "" || job.Error != "boom" || !job.ScheduledAt.Equal(latest.ScheduledAt) {
+		t.Errorf("state not copied: %+v", job)
+	}
+	if string(job.Payload) != `{"to":"a@b.c"}` {
+		t.Errorf("payload changed to %s", job.Payload)
+	}
+}
+
+// TestReconcileTimestampPrecision checks that a stored job doesn't look
+// diverged from its queue copy only because PostgreSQL rounded its update
+// time to the microsecond
+func TestReconcileTimestampPrecision(t *testing.T) {
+	ctx := context.Background()
+	q, st := queuetest.New(), storagetest.New()
+	m := NewManager(q, st)
+
+	updated := time.Now().Add(-time.Hour).Truncate(time.Microsecond).Add(999 * time.Nanosecond)
+	job := types.NewJob(&types.JobRequest{Type: types.JobTypeEmail, Payload: json.RawMessage(`{"to":"a@b.c"}`)})
+	job.UpdatedAt = updated
+	if err := q.EnqueueJob(ctx, job); err != nil {
+		t.Fatal(err)
+	}
+	stored := *job
+	stored.UpdatedAt = updated.Round(time.Microsecond)
+	if err := st.CreateJob(ctx, &stored); err != nil {
+		t.Fatal(err)
+	}
+
+	if diverged(&stored, job) {
+		t.Errorf("job updated at %v diverged from its queue copy updated at %v", stored.UpdatedAt, job.UpdatedAt)
+	}
+	for pass := 0; pass < 2; pass++ {
+		repaired, err := m.Reconcile(ctx)
+		if err != nil {
+			t.Fatalf("Reconcile: %v", err)
+		}
+		if repaired != 0 {
+			t.Errorf("Reconcile pass %d repaired %d jobs, want none", pass+1, repaired)
+		}
+	}
+	if _, version, err := st.JobVersion(ctx, job.ID); err != nil || version != 1 {
+		t.Errorf("JobVersion = %d, %v; want the job still at version 1", version, err)
+	}
+
+	// A real difference is still repaired
+	job.UpdatedAt = updated.Add(time.Millisecond)
+	if !diverged(&stored, job) {
+		t.Error("jobs updated a millisecond apart should have diverged")
+	}
+}
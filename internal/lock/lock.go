@@ -0,0 +1,152 @@
+// Package lock provides named locks shared by every process of a cluster.
+//
+// Each acquisition comes with a fencing token that grows with every
+// acquisition of the same name. A holder that pauses past its TTL can find
+// its lock taken by another; resources that must not be written by two
+// holders should remember the highest token they have seen and reject
+// writes carrying a lower one.
+package lock
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// retryInterval is how often Lock retries a held lock
+const retryInterval = 100 * time.Millisecond
+
+var (
+	// ErrLocked is returned by TryLock when another owner holds the lock
+	ErrLocked = errors.New("lock is held by another owner")
+	// ErrLost is returned when a lock expired or was taken by another owner
+	// before it was extended or released
+	ErrLost = errors.New("lock is no longer held")
+)
+
+// store keeps the locks of a Locker
+type store interface {
+	// acquire takes name for owner if it is free and returns its fencing
+	// token, or 0 if another owner holds it
+	acquire(ctx context.Context, name, owner string, ttl time.Duration) (int64, error)
+	// extend resets the TTL of name if owner holds it
+	extend(ctx context.Context, name, owner string, ttl time.Duration) (bool, error)
+	// release frees name if owner holds it
+	release(ctx context.Context, name, owner string) (bool, error)
+}
+
+// Locker hands out named locks
+type Locker struct {
+	store store
+}
+
+// Lock is a held lock. It expires after its TTL unless extended.
+type Lock struct {
+	Name string
+	// Token is the fencing token of this acquisition
+	Token int64
+
+	owner string
+	store store
+}
+
+// TryLock takes the lock name for ttl, or returns ErrLocked if it is held
+func (l *Locker) TryLock(ctx context.Context, name string, ttl time.Duration) (*Lock, error) {
+	owner := uuid.New().String()
+	token, err := l.store.acquire(ctx, name, owner, ttl)
+	if err != nil {
+		return nil, err
+	}
+	if token == 0 {
+		return nil, ErrLocked
+	}
+	return &Lock{Name: name, Token: token, owner: owner, store: l.store}, nil
+}
+
+// Lock waits until it takes the lock name for ttl, or until ctx is done
+func (l *Locker) Lock(ctx context.Context, name string, ttl time.Duration) (*Lock, error) {
+	ticker := time.NewTicker(retryInterval)
+	defer ticker.Stop()
+
+	for {
+		lock, err := l.TryLock(ctx, name, ttl)
+		if !errors.Is(err, ErrLocked) {
+			return lock, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Do runs fn while holding the lock name, waiting for it first. The lock is
+// extended every third of ttl while fn runs, so ttl only bounds how long
+// the lock outlives a process that dies holding it. If the lock is lost,
+// the context passed to fn is cancelled.
+func (l *Locker) Do(ctx context.Context, name string, ttl time.Duration, fn func(ctx context.Context, token int64) error) error {
+	lock, err := l.Lock(ctx, name, ttl)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		// Release even if ctx was cancelled, so that others needn't wait
+		// for the lock to expire
+		releaseCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), time.Second)
+		defer cancel()
+		lock.Unlock(releaseCtx)
+	}()
+
+	fnCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		ticker := time.NewTicker(ttl / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if err := lock.Extend(fnCtx, ttl); errors.Is(err, ErrLost) {
+					cancel()
+					return
+				}
+			}
+		}
+	}()
+
+	return fn(fnCtx, lock.Token)
+}
+
+// Extend resets the lock's TTL. It returns ErrLost if the lock expired or
+// was taken by another owner.
+func (l *Lock) Extend(ctx context.Context, ttl time.Duration) error {
+	held, err := l.store.extend(ctx, l.Name, l.owner, ttl)
+	if err != nil {
+		return err
+	}
+	if !held {
+		return ErrLost
+	}
+	return nil
+}
+
+// Unlock releases the lock. It returns ErrLost if the lock had already
+// expired or been taken by another owner.
+func (l *Lock) Unlock(ctx context.Context) error {
+	held, err := l.store.release(ctx, l.Name, l.owner)
+	if err != nil {
+		return err
+	}
+	if !held {
+		return ErrLost
+	}
+	return nil
+}
@@ -0,0 +1,165 @@
+package lock
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestTryLock(t *testing.T) {
+	ctx := context.Background()
+	locker := NewMemoryLocker()
+
+	first, err := locker.TryLock(ctx, "export", time.Minute)
+	if err != nil {
+		t.Fatalf("TryLock: %v", err)
+	}
+	if _, err := locker.TryLock(ctx, "export", time.Minute); !errors.Is(err, ErrLocked) {
+		t.Fatalf("second TryLock error = %v, want ErrLocked", err)
+	}
+	if _, err := locker.TryLock(ctx, "other", time.Minute); err != nil {
+		t.Fatalf("TryLock of another name: %v", err)
+	}
+
+	if err := first.Unlock(ctx); err != nil {
+		t.Fatalf("Unlock: %v", err)
+	}
+	second, err := locker.TryLock(ctx, "export", time.Minute)
+	if err != nil {
+		t.Fatalf("TryLock after Unlock: %v", err)
+	}
+	if second.Token <= first.Token {
+		t.Errorf("token = %d after %d, want fencing tokens to grow", second.Token, first.Token)
+	}
+}
+
+func TestLockExpires(t *testing.T) {
+	ctx := context.Background()
+	locker := NewMemoryLocker()
+
+	stale, err := locker.TryLock(ctx, "export", 20*time.Millisecond)
+	if err != nil {
+		t.Fatalf("TryLock: %v", err)
+	}
+	time.Sleep(30 * time.Millisecond)
+
+	current, err := locker.TryLock(ctx, "export", time.Minute)
+	if err != nil {
+		t.Fatalf("TryLock after expiry: %v", err)
+	}
+
+	// The stale holder can neither extend nor release the new holder's lock
+	if err := stale.Extend(ctx, time.Minute); !errors.Is(err, ErrLost) {
+		t.Errorf("Extend of expired lock error = %v, want ErrLost", err)
+	}
+	if err := stale.Unlock(ctx); !errors.Is(err, ErrLost) {
+		t.Errorf("Unlock of expired lock error = %v, want ErrLost", err)
+	}
+	if err := current.Extend(ctx, time.Minute); err != nil {
+		t.Errorf("Extend of current lock: %v", err)
+	}
+}
+
+func TestLockWaits(t *testing.T) {
+	ctx := context.Background()
+	locker := NewMemoryLocker()
+
+	held, err := locker.TryLock(ctx, "export", time.Minute)
+	if err != nil {
+		t.Fatalf("TryLock: %v", err)
+	}
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		held.Unlock(ctx)
+	}()
+
+	lock, err := locker.Lock(ctx, "export", time.Minute)
+	if err != nil {
+		t.Fatalf("Lock: %v", err)
+	}
+	lock.Unlock(ctx)
+
+	// A lock that stays held makes Lock give up with its context
+	locker.TryLock(ctx, "export", time.Minute)
+	waitCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	if _, err := locker.Lock(waitCtx, "export", time.Minute); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Lock of held lock error = %v, want context.DeadlineExceeded", err)
+	}
+}
+
+func TestDoSerializes(t *testing.T) {
+	ctx := context.Background()
+	locker := NewMemoryLocker()
+
+	var mu sync.Mutex
+	running, maxRunning := 0, 0
+	var tokens []int64
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := locker.Do(ctx, "migrations", 30*time.Millisecond, func(ctx context.Context, token int64) error {
+				mu.Lock()
+				running++
+				if running > maxRunning {
+					maxRunning = running
+				}
+				tokens = append(tokens, token)
+				mu.Unlock()
+
+				// Outlive the TTL, so the lock must be extended
+				time.Sleep(40 * time.Millisecond)
+				if ctx.Err() != nil {
+					t.Error("lock lost while held")
+				}
+
+				mu.Lock()
+				running--
+				mu.Unlock()
+				return nil
+			})
+			if err != nil {
+				t.Errorf("Do: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if maxRunning != 1 {
+		t.Errorf("%d holders ran at once, want 1", maxRunning)
+	}
+	for i := 1; i < len(tokens); i++ {
+		if tokens[i] <= tokens[i-1] {
+			t.Errorf("tokens = %v, want them to grow", tokens)
+			break
+		}
+	}
+}
+
+func TestDoCancelsWhenLost(t *testing.T) {
+	ctx := context.Background()
+	locker := NewMemoryLocker()
+	store := locker.store.(*memoryStore)
+
+	err := locker.Do(ctx, "export", 30*time.Millisecond, func(ctx context.Context, token int64) error {
+		// Another owner takes the lock, as after a long pause
+		store.mu.Lock()
+		store.locks["export"] = memoryLock{owner: "other", expires: time.Now().Add(time.Minute)}
+		store.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Second):
+			return nil
+		}
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Do error = %v, want the context of fn cancelled", err)
+	}
+}
@@ -0,0 +1,75 @@
+package lock
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// memoryStore keeps locks in process memory. Use it when there is a single
+// process, or without Redis, where locks then only exclude other holders
+// in the same process.
+type memoryStore struct {
+	mu     sync.Mutex
+	locks  map[string]memoryLock
+	tokens map[string]int64
+}
+
+type memoryLock struct {
+	owner   string
+	expires time.Time
+}
+
+// NewMemoryLocker creates a locker whose locks are held in process memory
+func NewMemoryLocker() *Locker {
+	return &Locker{store: &memoryStore{
+		locks:  make(map[string]memoryLock),
+		tokens: make(map[string]int64),
+	}}
+}
+
+// held returns the live lock on name
+func (s *memoryStore) held(name string) (memoryLock, bool) {
+	lock, ok := s.locks[name]
+	if ok && !time.Now().Before(lock.expires) {
+		delete(s.locks, name)
+		return memoryLock{}, false
+	}
+	return lock, ok
+}
+
+func (s *memoryStore) acquire(ctx context.Context, name, owner string, ttl time.Duration) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.held(name); ok {
+		return 0, nil
+	}
+	s.locks[name] = memoryLock{owner: owner, expires: time.Now().Add(ttl)}
+	s.tokens[name]++
+	return s.tokens[name], nil
+}
+
+func (s *memoryStore) extend(ctx context.Context, name, owner string, ttl time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	lock, ok := s.held(name)
+	if !ok || lock.owner != owner {
+		return false, nil
+	}
+	s.locks[name] = memoryLock{owner: owner, expires: time.Now().Add(ttl)}
+	return true, nil
+}
+
+func (s *memoryStore) release(ctx context.Context, name, owner string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	lock, ok := s.held(name)
+	if !ok || lock.owner != owner {
+		return false, nil
+	}
+	delete(s.locks, name)
+	return true, nil
+}
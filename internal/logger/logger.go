@@ -66,6 +66,16 @@ func (l *Logger) SetOutput(output io.Writer) {
 	l.Logger.SetOutput(output)
 }
 
+// SetLevelName changes the log level, given by name such as "debug"
+func (l *Logger) SetLevelName(level string) error {
+	logLevel, err := logrus.ParseLevel(strings.ToLower(level))
+	if err != nil {
+		return err
+	}
+	l.Logger.SetLevel(logLevel)
+	return nil
+}
+
 // WithFields creates a new logger entry with structured fields
 func (l *Logger) WithFields(fields Fields) *logrus.Entry {
 	return l.Logger.WithFields(logrus.Fields(fields))
@@ -203,6 +213,18 @@ func (l *Logger) RedisConnected(addr string) {
 	}).Info("Redis connected successfully")
 }
 
+// ConfigChanged records a configuration change applied at runtime in the
+// audit log
+func (l *Logger) ConfigChanged(setting, oldValue, newValue string) {
+	l.WithFields(Fields{
+		"setting":   setting,
+		"old_value": oldValue,
+		"new_value": newValue,
+		"audit":     true,
+		"event":     "config_changed",
+	}).Info("Configuration changed")
+}
+
 // Convenience functions that use the default logger
 
 // Debug logs a debug message
@@ -17,6 +17,8 @@ type Metrics struct {
 	JobsInQueue        prometheus.Gauge
 	JobsProcessing     prometheus.Gauge
 	JobRetries         *prometheus.CounterVec
+	JobFailures        *prometheus.CounterVec
+	JobsParked         *prometheus.CounterVec
 
 	// Worker metrics
 	WorkersActive       prometheus.Gauge
@@ -31,6 +33,14 @@ type Metrics struct {
 	QueueDepth   *prometheus.GaugeVec
 	SystemUptime prometheus.Gauge
 	SystemErrors *prometheus.CounterVec
+
+	// Dependency metrics
+	CircuitBreakerState *prometheus.GaugeVec
+	pools               *poolCollector
+	WebhookConnections  *prometheus.CounterVec
+
+	// Coordination metrics
+	CoordinatorLeader prometheus.Gauge
 }
 
 var defaultMetrics *Metrics
@@ -42,7 +52,7 @@ func Init() *Metrics {
 		JobsTotal: prometheus.NewCounterVec(
 			prometheus.CounterOpts{
 				Name: "taskflow_jobs_total",
-				Help: "Total number of jobs processed by status",
+				Help: "Total number of jobs finished, by final status (completed, failed, cancelled or expired)",
 			},
 			[]string{"type", "status"},
 		),
@@ -73,6 +83,20 @@ func Init() *Metrics {
 			},
 			[]string{"type"},
 		),
+		JobFailures: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "taskflow_job_failures_total",
+				Help: "Total number of failed job attempts, by error code",
+			},
+			[]string{"type", "error_code"},
+		),
+		JobsParked: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "taskflow_jobs_parked_total",
+				Help: "Total number of jobs put off because their downstream target was down",
+			},
+			[]string{"type"},
+		),
 
 		// Worker metrics
 		WorkersActive: prometheus.NewGauge(
@@ -118,7 +142,7 @@ func Init() *Metrics {
 		QueueDepth: prometheus.NewGaugeVec(
 			prometheus.GaugeOpts{
 				Name: "taskflow_queue_depth",
-				Help: "Number of items in various queues",
+				Help: "Number of jobs per job type and state, e.g. email:pending",
 			},
 			[]string{"queue_name"},
 		),
@@ -135,6 +159,31 @@ func Init() *Metrics {
 			},
 			[]string{"component", "error_type"},
 		),
+
+		// Dependency metrics
+		CircuitBreakerState: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "taskflow_circuit_breaker_state",
+				Help: "Circuit breaker state by dependency (0 closed, 1 half-open, 2 open)",
+			},
+			[]string{"dependency"},
+		),
+		pools: newPoolCollector(),
+		WebhookConnections: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "taskflow_webhook_connections_total",
+				Help: "Connections webhooks were sent over, by whether they were reused or newly opened",
+			},
+			[]string{"reused"},
+		),
+
+		// Coordination metrics
+		CoordinatorLeader: prometheus.NewGauge(
+			prometheus.GaugeOpts{
+				Name: "taskflow_coordinator_leader",
+				Help: "1 while this API server is the elected maintenance leader, 0 otherwise",
+			},
+		),
 	}
 
 	// Register all metrics
@@ -144,6 +193,8 @@ func Init() *Metrics {
 		metrics.JobsInQueue,
 		metrics.JobsProcessing,
 		metrics.JobRetries,
+		metrics.JobFailures,
+		metrics.JobsParked,
 		metrics.WorkersActive,
 		metrics.WorkerJobsProcessed,
 		metrics.HTTPRequests,
@@ -152,6 +203,10 @@ func Init() *Metrics {
 		metrics.QueueDepth,
 		metrics.SystemUptime,
 		metrics.SystemErrors,
+		metrics.CircuitBreakerState,
+		metrics.pools,
+		metrics.WebhookConnections,
+		metrics.CoordinatorLeader,
 	)
 
 	defaultMetrics = metrics
@@ -193,6 +248,16 @@ func (m *Metrics) IncJobRetries(jobType string) {
 	m.JobRetries.WithLabelValues(jobType).Inc()
 }
 
+// IncJobFailures increments the failed attempts counter
+func (m *Metrics) IncJobFailures(jobType, errorCode string) {
+	m.JobFailures.WithLabelValues(jobType, errorCode).Inc()
+}
+
+// IncJobsParked increments the parked jobs counter
+func (m *Metrics) IncJobsParked(jobType string) {
+	m.JobsParked.WithLabelValues(jobType).Inc()
+}
+
 // Worker metric methods
 
 // SetWorkersActive sets the number of active workers
@@ -239,6 +304,26 @@ func (m *Metrics) IncSystemErrors(component, errorType string) {
 	m.SystemErrors.WithLabelValues(component, errorType).Inc()
 }
 
+// SetCircuitBreakerState sets the circuit breaker state of a dependency:
+// 0 closed, 1 half-open, 2 open
+func (m *Metrics) SetCircuitBreakerState(dependency string, state int) {
+	m.CircuitBreakerState.WithLabelValues(dependency).Set(float64(state))
+}
+
+// IncWebhookConnections counts a connection a webhook was sent over
+func (m *Metrics) IncWebhookConnections(reused bool) {
+	m.WebhookConnections.WithLabelValues(strconv.FormatBool(reused)).Inc()
+}
+
+// SetCoordinatorLeader records whether this server is the maintenance leader
+func (m *Metrics) SetCoordinatorLeader(leader bool) {
+	value := 0.0
+	if leader {
+		value = 1
+	}
+	m.CoordinatorLeader.Set(value)
+}
+
 // Middleware for HTTP metrics collection
 type MetricsMiddleware struct {
 	metrics *Metrics
@@ -307,6 +392,16 @@ func IncJobsTotal(jobType, status string) {
 	GetMetrics().IncJobsTotal(jobType, status)
 }
 
+// IncJobFailures increments failed attempts using default metrics
+func IncJobFailures(jobType, errorCode string) {
+	GetMetrics().IncJobFailures(jobType, errorCode)
+}
+
+// IncJobsParked increments parked jobs using default metrics
+func IncJobsParked(jobType string) {
+	GetMetrics().IncJobsParked(jobType)
+}
+
 // ObserveJobProcessingTime records job processing time using default metrics
 func ObserveJobProcessingTime(jobType string, duration time.Duration) {
 	GetMetrics().ObserveJobProcessingTime(jobType, duration)
@@ -316,3 +411,33 @@ func ObserveJobProcessingTime(jobType string, duration time.Duration) {
 func SetJobsInQueue(count int) {
 	GetMetrics().SetJobsInQueue(count)
 }
+
+// SetJobsProcessing sets jobs being processed using default metrics
+func SetJobsProcessing(count int) {
+	GetMetrics().SetJobsProcessing(count)
+}
+
+// SetWorkersActive sets active workers using default metrics
+func SetWorkersActive(count int) {
+	GetMetrics().SetWorkersActive(count)
+}
+
+// SetQueueDepth sets the depth of a named queue using default metrics
+func SetQueueDepth(queueName string, depth int) {
+	GetMetrics().SetQueueDepth(queueName, depth)
+}
+
+// SetCircuitBreakerState sets a circuit breaker state using default metrics
+func SetCircuitBreakerState(dependency string, state int) {
+	GetMetrics().SetCircuitBreakerState(dependency, state)
+}
+
+// SetCoordinatorLeader records leadership using default metrics
+func SetCoordinatorLeader(leader bool) {
+	GetMetrics().SetCoordinatorLeader(leader)
+}
+
+// IncWebhookConnections counts a webhook connection using default metrics
+func IncWebhookConnections(reused bool) {
+	GetMetrics().IncWebhookConnections(reused)
+}
@@ -0,0 +1,88 @@
+package metrics
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// PoolStats is a snapshot of a connection pool. Not every pool tracks
+// every field: PostgreSQL pools count waits, Redis pools count timeouts.
+type PoolStats struct {
+	Open         int           // connections open, in use or idle
+	InUse        int           // connections serving a call
+	Idle         int           // connections waiting for a call
+	WaitCount    int64         // calls that waited for a connection
+	WaitDuration time.Duration // total time calls waited for a connection
+	Timeouts     int64         // calls that gave up waiting for a connection
+}
+
+// poolCollector reports the registered pools' stats at scrape time, so
+// they are never older than the scrape
+type poolCollector struct {
+	mu    sync.Mutex
+	pools map[string]func() PoolStats
+
+	open         *prometheus.Desc
+	inUse        *prometheus.Desc
+	idle         *prometheus.Desc
+	waitCount    *prometheus.Desc
+	waitDuration *prometheus.Desc
+	timeouts     *prometheus.Desc
+}
+
+func newPoolCollector() *poolCollector {
+	desc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc(name, help, []string{"pool"}, nil)
+	}
+	return &poolCollector{
+		pools:        make(map[string]func() PoolStats),
+		open:         desc("taskflow_pool_open_connections", "Open connections by pool, in use or idle"),
+		inUse:        desc("taskflow_pool_in_use_connections", "Connections serving a call by pool"),
+		idle:         desc("taskflow_pool_idle_connections", "Idle connections by pool"),
+		waitCount:    desc("taskflow_pool_wait_count_total", "Calls that waited for a free connection, by pool"),
+		waitDuration: desc("taskflow_pool_wait_duration_seconds_total", "Time calls spent waiting for a free connection, by pool"),
+		timeouts:     desc("taskflow_pool_timeouts_total", "Calls that timed out waiting for a free connection, by pool"),
+	}
+}
+
+// Describe implements prometheus.Collector
+func (c *poolCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.open
+	ch <- c.inUse
+	ch <- c.idle
+	ch <- c.waitCount
+	ch <- c.waitDuration
+	ch <- c.timeouts
+}
+
+// Collect implements prometheus.Collector
+func (c *poolCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for name, stats := range c.pools {
+		s := stats()
+		ch <- prometheus.MustNewConstMetric(c.open, prometheus.GaugeValue, float64(s.Open), name)
+		ch <- prometheus.MustNewConstMetric(c.inUse, prometheus.GaugeValue, float64(s.InUse), name)
+		ch <- prometheus.MustNewConstMetric(c.idle, prometheus.GaugeValue, float64(s.Idle), name)
+		ch <- prometheus.MustNewConstMetric(c.waitCount, prometheus.CounterValue, float64(s.WaitCount), name)
+		ch <- prometheus.MustNewConstMetric(c.waitDuration, prometheus.CounterValue, s.WaitDuration.Seconds(), name)
+		ch <- prometheus.MustNewConstMetric(c.timeouts, prometheus.CounterValue, float64(s.Timeouts), name)
+	}
+}
+
+// RegisterPool reports the stats of the named connection pool, such as
+// postgres or redis. Registering a name again replaces its stats.
+func (m *Metrics) RegisterPool(name string, stats func() PoolStats) {
+	m.pools.mu.Lock()
+	defer m.pools.mu.Unlock()
+	m.pools.pools[name] = stats
+}
+
+// RegisterPool reports the stats of a connection pool using default
+// metrics
+func RegisterPool(name string, stats func() PoolStats) {
+	GetMetrics().RegisterPool(name, stats)
+}
@@ -0,0 +1,179 @@
+// Package notify posts chat messages about jobs that failed for good to the
+// Slack and Microsoft Teams incoming webhooks set for their job type.
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"taskflow/internal/types"
+	"time"
+)
+
+// maxErrorLength bounds the job error quoted in a message
+const maxErrorLength = 500
+
+// FailureNotifier reports jobs that failed for good. A nil
+// *FailureNotifier reports nothing.
+type FailureNotifier struct {
+	client       *http.Client
+	dashboardURL string
+	jobTypes     *types.JobTypeRegistry
+}
+
+// Option configures optional FailureNotifier settings
+type Option func(*FailureNotifier)
+
+// WithDashboardURL links each message to the job's page under url
+func WithDashboardURL(url string) Option {
+	return func(n *FailureNotifier) {
+		n.dashboardURL = strings.TrimRight(url, "/")
+	}
+}
+
+// WithHTTPClient sends messages with client
+func WithHTTPClient(client *http.Client) Option {
+	return func(n *FailureNotifier) {
+		n.client = client
+	}
+}
+
+// NewFailureNotifier creates a notifier that reads the webhooks of each job
+// type from jobTypes
+func NewFailureNotifier(jobTypes *types.JobTypeRegistry, opts ...Option) *FailureNotifier {
+	n := &FailureNotifier{
+		client:   &http.Client{Timeout: 10 * time.Second},
+		jobTypes: jobTypes,
+	}
+	for _, opt := range opts {
+		opt(n)
+	}
+	return n
+}
+
+// JobFailed posts a message about job to the webhooks of its type, if any.
+// Failures are logged rather than returned so that they never affect job
+// processing.
+func (n *FailureNotifier) JobFailed(ctx context.Context, job *types.Job) {
+	if n == nil {
+		return
+	}
+	webhooks := n.jobTypes.For(job.Type).NotifyFailure
+	if webhooks.IsZero() {
+		return
+	}
+
+	ctx = context.WithoutCancel(ctx)
+	if webhooks.Slack != "" {
+		if err := n.post(ctx, webhooks.Slack, n.slackMessage(job)); err != nil {
+			log.Printf("Failed to notify Slack about job %s: %v", job.ID, err)
+		}
+	}
+	if webhooks.Teams != "" {
+		if err := n.post(ctx, webhooks.Teams, n.teamsMessage(job)); err != nil {
+			log.Printf("Failed to notify Teams about job %s: %v", job.ID, err)
+		}
+	}
+}
+
+func (n *FailureNotifier) post(ctx context.Context, url string, message interface{}) error {
+	body, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned HTTP %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// link returns the job's dashboard page, or "" without a dashboard
+func (n *FailureNotifier) link(job *types.Job) string {
+	if n.dashboardURL == "" {
+		return ""
+	}
+	return n.dashboardURL + "/jobs/" + job.ID
+}
+
+// summary is the one line description of the failure
+func summary(job *types.Job) string {
+	return fmt.Sprintf("Job %s (%s) failed after %d attempts", job.ID, job.Type, job.Attempts)
+}
+
+// jobError returns the job's error, shortened to fit a message
+func jobError(job *types.Job) string {
+	message := job.Error
+	if message == "" {
+		return "unknown error"
+	}
+	if len(message) > maxErrorLength {
+		return message[:maxErrorLength] + "…"
+	}
+	return message
+}
+
+// slackMessage builds a Slack incoming webhook message using Block Kit,
+// with text as the notification fallback
+func (n *FailureNotifier) slackMessage(job *types.Job) map[string]interface{} {
+	fields := []map[string]string{
+		{"type": "mrkdwn", "text": "*Job ID*\n`" + job.ID + "`"},
+		{"type": "mrkdwn", "text": "*Type*\n" + string(job.Type)},
+		{"type": "mrkdwn", "text": fmt.Sprintf("*Attempts*\n%d", job.Attempts)},
+	}
+	blocks := []map[string]interface{}{
+		{"type": "header", "text": map[string]string{"type": "plain_text", "text": "Job failed: " + string(job.Type)}},
+		{"type": "section", "fields": fields},
+		{"type": "section", "text": map[string]string{"type": "mrkdwn", "text": "*Error*\n```" + jobError(job) + "```"}},
+	}
+	if link := n.link(job); link != "" {
+		blocks = append(blocks, map[string]interface{}{
+			"type": "section",
+			"text": map[string]string{"type": "mrkdwn", "text": "<" + link + "|Open in dashboard>"},
+		})
+	}
+	return map[string]interface{}{"text": summary(job), "blocks": blocks}
+}
+
+// teamsMessage builds a Microsoft Teams incoming webhook message card
+func (n *FailureNotifier) teamsMessage(job *types.Job) map[string]interface{} {
+	message := map[string]interface{}{
+		"@type":      "MessageCard",
+		"@context":   "https://schema.org/extensions",
+		"summary":    summary(job),
+		"themeColor": "D93F0B",
+		"title":      "Job failed: " + string(job.Type),
+		"sections": []map[string]interface{}{{
+			"facts": []map[string]string{
+				{"name": "Job ID", "value": job.ID},
+				{"name": "Type", "value": string(job.Type)},
+				{"name": "Attempts", "value": fmt.Sprint(job.Attempts)},
+				{"name": "Error", "value": jobError(job)},
+			},
+		}},
+	}
+	if link := n.link(job); link != "" {
+		message["potentialAction"] = []map[string]interface{}{{
+			"@type":   "OpenUri",
+			"name":    "Open in dashboard",
+			"targets": []map[string]string{{"os": "default", "uri": link}},
+		}}
+	}
+	return message
+}
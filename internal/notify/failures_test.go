@@ -0,0 +1,66 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"taskflow/internal/types"
+	"testing"
+)
+
+func TestJobFailed(t *testing.T) {
+	received := make(map[string]map[string]interface{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var message map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&message); err != nil {
+			t.Errorf("invalid message: %v", err)
+		}
+		received[r.URL.Path] = message
+	}))
+	defer server.Close()
+
+	registry := types.NewJobTypeRegistry()
+	err := registry.Set(types.JobTypeConfigs{Types: map[types.JobType]types.JobTypeConfig{
+		types.JobTypeEmail: {NotifyFailure: types.FailureNotify{Slack: server.URL + "/slack", Teams: server.URL + "/teams"}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := NewFailureNotifier(registry, WithDashboardURL("https://taskflow.example.com/"))
+
+	job := &types.Job{ID: "job-1", Type: types.JobTypeEmail, Attempts: 3, Error: "smtp: connection refused"}
+	n.JobFailed(context.Background(), job)
+
+	slack, _ := json.Marshal(received["/slack"])
+	for _, want := range []string{"job-1", "smtp: connection refused", "https://taskflow.example.com/jobs/job-1"} {
+		if !strings.Contains(string(slack), want) {
+			t.Errorf("Slack message %s doesn't contain %q", slack, want)
+		}
+	}
+	if received["/teams"]["@type"] != "MessageCard" {
+		t.Errorf("Teams message = %v, want a message card", received["/teams"])
+	}
+	teams, _ := json.Marshal(received["/teams"])
+	if !strings.Contains(string(teams), "https://taskflow.example.com/jobs/job-1") {
+		t.Errorf("Teams message %s doesn't link to the dashboard", teams)
+	}
+
+	// Types without webhooks are left alone
+	delete(received, "/slack")
+	n.JobFailed(context.Background(), &types.Job{ID: "job-2", Type: types.JobTypeWebhook})
+	if len(received) != 1 {
+		t.Errorf("a webhook job failure was posted: %v", received)
+	}
+
+	var nilNotifier *FailureNotifier
+	nilNotifier.JobFailed(context.Background(), job)
+}
+
+func TestNotifyFailureValidation(t *testing.T) {
+	configs := types.JobTypeConfigs{Default: types.JobTypeConfig{NotifyFailure: types.FailureNotify{Slack: "hooks.slack.com/x"}}}
+	if err := configs.Validate(); err == nil {
+		t.Error("Validate accepted a webhook URL without a scheme")
+	}
+}
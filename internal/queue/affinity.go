@@ -0,0 +1,302 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"taskflow/internal/types"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Affinity keys share the {jobs} hash tag with the engines' lists. A
+// key's lease names its waiting list, so the scripts below derive some
+// keys instead of declaring them; they all live in the {jobs} slot.
+const (
+	AffinityKeyPrefix      = "taskflow:{jobs}:affinity:"
+	AffinityReadyPrefix    = "taskflow:{jobs}:affinity-ready:"
+	AffinityLeasePrefix    = "taskflow:{jobs}:affinity-lease:"
+	AffinityOwnedPrefix    = "taskflow:{jobs}:affinity-owned:"
+	AffinityLeaseExpiryKey = "taskflow:{jobs}:affinity-leases"
+)
+
+// DefaultAffinityLeaseTTL is how long a worker keeps the affinity keys it
+// holds without claiming, finishing or heartbeating one of their jobs
+const DefaultAffinityLeaseTTL = 5 * time.Minute
+
+// Jobs with an affinity key bypass the engine. They wait in one list per
+// type and key, and only the worker holding the key's lease runs them, one
+// at a time and in order:
+//
+//   - AffinityKeyPrefix<type>:<key> lists the key's waiting jobs, claimed
+//     from the right like the list engine's pending lists
+//   - AffinityReadyPrefix<type> lists keys with waiting jobs and no lease
+//   - AffinityLeasePrefix<type>:<key> is a hash naming the worker holding
+//     the key and the job it is running, if any
+//   - AffinityOwnedPrefix<worker> is the set of leases a worker holds
+//   - AffinityLeaseExpiryKey orders leases by expiry, so that the keys of a
+//     worker that disappeared are handed on
+//
+// A lease outlives a job while the key has more waiting, so that the
+// worker that ran it runs the next one too. It ends once the key has no
+// jobs left, or expires if the worker stops renewing it.
+
+func affinityListKey(jobType types.JobType, key string) string {
+	return AffinityKeyPrefix + string(jobType) + ":" + key
+}
+
+func affinityLeaseKey(jobType types.JobType, key string) string {
+	return AffinityLeasePrefix + string(jobType) + ":" + key
+}
+
+// affinityPushScript queues job ARGV[1] on its key's list KEYS[1], at the
+// claiming end if ARGV[3] is set, and lists the key ARGV[2] as ready in
+// KEYS[2] if it had no jobs and no lease KEYS[3]
+var affinityPushScript = redis.NewScript(`
+if ARGV[3] == '1' then
+	redis.call('RPUSH', KEYS[1], ARGV[1])
+else
+	redis.call('LPUSH', KEYS[1], ARGV[1])
+end
+if redis.call('LLEN', KEYS[1]) == 1 and redis.call('EXISTS', KEYS[3]) == 0 then
+	redis.call('LPUSH', KEYS[2], ARGV[2])
+end
+return 1
+`)
+
+// affinityClaimScript hands worker ARGV[1] its next affinity job. It first
+// hands on the keys of expired leases, putting their running jobs back at
+// the head of their lists. Then it takes the next job of a key the worker
+// holds and isn't running, or else a key that nobody holds, in both cases
+// of one of the types in ARGV[7..]. It returns the job's ID, type and key, or false.
+var affinityClaimScript = redis.NewScript(`
+local expiry, owned = KEYS[1], KEYS[2]
+local worker, ttl = ARGV[1], tonumber(ARGV[2])
+local listPrefix, readyPrefix, leasePrefix, ownedPrefix = ARGV[3], ARGV[4], ARGV[5], ARGV[6]
+local time = redis.call('TIME')
+local now = tonumber(time[1]) * 1000 + math.floor(tonumber(time[2]) / 1000)
+local wanted = {}
+for i = 7, #ARGV do
+	wanted[ARGV[i]] = true
+end
+
+for _, lease in ipairs(redis.call('ZRANGEBYSCORE', expiry, '-inf', now, 'LIMIT', 0, 10)) do
+	local fields = redis.call('HMGET', lease, 'owner', 'job', 'type', 'key')
+	redis.call('ZREM', expiry, lease)
+	redis.call('DEL', lease)
+	if fields[1] then
+		redis.call('SREM', ownedPrefix .. fields[1], lease)
+	end
+	if fields[3] then
+		local list = listPrefix .. fields[3] .. ':' .. fields[4]
+		if fields[2] then
+			redis.call('RPUSH', list, fields[2])
+		end
+		if redis.call('LLEN', list) > 0 then
+			redis.call('LPUSH', readyPrefix .. fields[3], fields[4])
+		end
+	end
+end
+
+for _, lease in ipairs(redis.call('SMEMBERS', owned)) do
+	local fields = redis.call('HMGET', lease, 'owner', 'job', 'type', 'key')
+	if fields[1] ~= worker then
+		redis.call('SREM', owned, lease)
+	elseif not fields[2] and wanted[fields[3]] then
+		local id = redis.call('RPOP', listPrefix .. fields[3] .. ':' .. fields[4])
+		if id then
+			redis.call('HSET', lease, 'job', id)
+			redis.call('ZADD', expiry, now + ttl, lease)
+			return {id, fields[3], fields[4]}
+		end
+		redis.call('DEL', lease)
+		redis.call('ZREM', expiry, lease)
+		redis.call('SREM', owned, lease)
+	end
+end
+
+for i = 7, #ARGV do
+	local jobType = ARGV[i]
+	while true do
+		local key = redis.call('RPOP', readyPrefix .. jobType)
+		if not key then
+			break
+		end
+		local lease = leasePrefix .. jobType .. ':' .. key
+		if redis.call('EXISTS', lease) == 0 then
+			local id = redis.call('RPOP', listPrefix .. jobType .. ':' .. key)
+			if id then
+				redis.call('HSET', lease, 'owner', worker, 'job', id, 'type', jobType, 'key', key)
+				redis.call('ZADD', expiry, now + ttl, lease)
+				redis.call('SADD', owned, lease)
+				return {id, jobType, key}
+			end
+		end
+	end
+end
+return false
+`)
+
+// affinityAckScript records that job ARGV[1] of the lease KEYS[1] is no
+// longer running. The lease is kept for the key's next job, or ended if the
+// key has none or ARGV[4] is set, in which case the key is listed as ready
+// again. Acks of jobs the lease isn't running, such as after it expired,
+// are ignored.
+var affinityAckScript = redis.NewScript(`
+local lease, expiry, list, ready = KEYS[1], KEYS[2], KEYS[3], KEYS[4]
+local fields = redis.call('HMGET', lease, 'owner', 'job', 'key')
+if fields[2] ~= ARGV[1] then
+	return 0
+end
+
+local waiting = redis.call('LLEN', list)
+if waiting == 0 or ARGV[4] == '1' then
+	redis.call('DEL', lease)
+	redis.call('ZREM', expiry, lease)
+	redis.call('SREM', ARGV[3] .. fields[1], lease)
+	if waiting > 0 then
+		redis.call('LPUSH', ready, fields[3])
+	end
+	return 1
+end
+
+local time = redis.call('TIME')
+local now = tonumber(time[1]) * 1000 + math.floor(tonumber(time[2]) / 1000)
+redis.call('HDEL', lease, 'job')
+redis.call('ZADD', expiry, now + tonumber(ARGV[2]), lease)
+return 1
+`)
+
+// affinityRenewScript extends the leases in the owned set KEYS[2] whose
+// jobs are running
+var affinityRenewScript = redis.NewScript(`
+local time = redis.call('TIME')
+local now = tonumber(time[1]) * 1000 + math.floor(tonumber(time[2]) / 1000)
+for _, lease in ipairs(redis.call('SMEMBERS', KEYS[2])) do
+	if redis.call('HEXISTS', lease, 'job') == 1 then
+		redis.call('ZADD', KEYS[1], 'XX', now + tonumber(ARGV[1]), lease)
+	end
+end
+return 1
+`)
+
+// affinityReleaseScript ends the leases in the owned set KEYS[2] whose
+// jobs aren't running, listing their keys as ready if they have jobs
+// waiting. ARGV[1] and ARGV[2] prefix waiting and ready lists.
+var affinityReleaseScript = redis.NewScript(`
+for _, lease in ipairs(redis.call('SMEMBERS', KEYS[2])) do
+	local fields = redis.call('HMGET', lease, 'job', 'type', 'key')
+	if not fields[1] then
+		redis.call('DEL', lease)
+		redis.call('ZREM', KEYS[1], lease)
+		redis.call('SREM', KEYS[2], lease)
+		if fields[2] and redis.call('LLEN', ARGV[1] .. fields[2] .. ':' .. fields[3]) > 0 then
+			redis.call('LPUSH', ARGV[2] .. fields[2], fields[3])
+		end
+	end
+end
+return 1
+`)
+
+// pushAffinity adds the commands that queue an affinity job to pipe
+func (r *RedisQueue) pushAffinity(ctx context.Context, pipe redis.Pipeliner, job *types.Job, front bool) {
+	keys := []string{
+		affinityListKey(job.Type, job.AffinityKey),
+		AffinityReadyPrefix + string(job.Type),
+		affinityLeaseKey(job.Type, job.AffinityKey),
+	}
+	affinityPushScript.Eval(ctx, pipe, keys, job.ID, job.AffinityKey, flag(front))
+}
+
+// claimAffinity takes workerID's next affinity job of one of jobTypes. It
+// returns the job's ID, type and key, which are enough to ack it, or nil if
+// the worker has no affinity job to run.
+func (r *RedisQueue) claimAffinity(ctx context.Context, workerID string, jobTypes []types.JobType) (*types.Job, error) {
+	keys := []string{AffinityLeaseExpiryKey, AffinityOwnedPrefix + workerID}
+	args := []interface{}{
+		workerID, r.leaseTTL().Milliseconds(),
+		AffinityKeyPrefix, AffinityReadyPrefix, AffinityLeasePrefix, AffinityOwnedPrefix,
+	}
+	for _, jobType := range jobTypes {
+		args = append(args, string(jobType))
+	}
+
+	claimed, err := affinityClaimScript.Run(ctx, r.client, keys, args...).StringSlice()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to dequeue affinity job: %w", err)
+	}
+	if len(claimed) != 3 {
+		return nil, fmt.Errorf("failed to dequeue affinity job: unexpected reply %v", claimed)
+	}
+	return &types.Job{ID: claimed[0], Type: types.JobType(claimed[1]), AffinityKey: claimed[2]}, nil
+}
+
+// ackAffinity adds the commands that mark an affinity job as no longer
+// running to pipe. release hands the key to any worker instead of keeping
+// it for the job's worker.
+func (r *RedisQueue) ackAffinity(ctx context.Context, pipe redis.Pipeliner, job *types.Job, release bool) {
+	keys := []string{
+		affinityLeaseKey(job.Type, job.AffinityKey),
+		AffinityLeaseExpiryKey,
+		affinityListKey(job.Type, job.AffinityKey),
+		AffinityReadyPrefix + string(job.Type),
+	}
+	affinityAckScript.Eval(ctx, pipe, keys, job.ID, r.leaseTTL().Milliseconds(), AffinityOwnedPrefix, flag(release))
+}
+
+// renewAffinity extends the leases of keys whose jobs workerID is running
+func (r *RedisQueue) renewAffinity(ctx context.Context, workerID string) error {
+	keys := []string{AffinityLeaseExpiryKey, AffinityOwnedPrefix + workerID}
+	if err := affinityRenewScript.Run(ctx, r.client, keys, r.leaseTTL().Milliseconds()).Err(); err != nil {
+		return fmt.Errorf("failed to renew affinity leases: %w", err)
+	}
+	return nil
+}
+
+// ReleaseAffinity hands the affinity keys workerID holds, but isn't running
+// a job of, to other workers. Workers call it once they stop claiming jobs,
+// so that their keys don't wait for the leases to expire.
+func (r *RedisQueue) ReleaseAffinity(ctx context.Context, workerID string) error {
+	keys := []string{AffinityLeaseExpiryKey, AffinityOwnedPrefix + workerID}
+	if err := affinityReleaseScript.Run(ctx, r.client, keys, AffinityKeyPrefix, AffinityReadyPrefix).Err(); err != nil {
+		return fmt.Errorf("failed to release affinity keys: %w", err)
+	}
+	return nil
+}
+
+// push queues job with the engine, or on its key's list if it has an
+// affinity key
+func (r *RedisQueue) push(ctx context.Context, pipe redis.Pipeliner, job *types.Job, front bool) {
+	if job.AffinityKey != "" {
+		r.pushAffinity(ctx, pipe, job, front)
+		return
+	}
+	r.engine.push(ctx, pipe, job, front)
+}
+
+// ack removes an in-flight job from the engine, or ends its run on its
+// affinity key
+func (r *RedisQueue) ack(ctx context.Context, pipe redis.Pipeliner, job *types.Job, release bool) error {
+	if job.AffinityKey != "" {
+		r.ackAffinity(ctx, pipe, job, release)
+		return nil
+	}
+	return r.engine.ack(ctx, pipe, job.ID)
+}
+
+func (r *RedisQueue) leaseTTL() time.Duration {
+	if r.affinityTTL <= 0 {
+		return DefaultAffinityLeaseTTL
+	}
+	return r.affinityTTL
+}
+
+func flag(set bool) string {
+	if set {
+		return "1"
+	}
+	return "0"
+}
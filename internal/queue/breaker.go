@@ -0,0 +1,89 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"taskflow/internal/breaker"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// WithBreaker sends every Redis command through b, so that calls fail
+// fast with a *breaker.OpenError while Redis is down
+func WithBreaker(b *breaker.Breaker) Option {
+	return func(r *RedisQueue) {
+		r.client.AddHook(breakerHook{breaker: b})
+	}
+}
+
+// breakerHook is a go-redis hook that reports the outcome of each command
+// and pipeline to a circuit breaker
+type breakerHook struct {
+	breaker *breaker.Breaker
+}
+
+func (h breakerHook) DialHook(next redis.DialHook) redis.DialHook {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return next(ctx, network, addr)
+	}
+}
+
+func (h breakerHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		if err := h.breaker.Allow(); err != nil {
+			cmd.SetErr(err)
+			return err
+		}
+		err := next(ctx, cmd)
+		h.report(ctx, err)
+		return err
+	}
+}
+
+func (h breakerHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		if err := h.breaker.Allow(); err != nil {
+			for _, cmd := range cmds {
+				cmd.SetErr(err)
+			}
+			return err
+		}
+		err := next(ctx, cmds)
+		h.report(ctx, err)
+		return err
+	}
+}
+
+// report records a command's outcome. Replies from Redis, including
+// errors such as redis.Nil or WRONGTYPE, show that it is up; only
+// connection failures and replies saying it can't serve count against it.
+// Calls abandoned by their caller don't count either way.
+func (h breakerHook) report(ctx context.Context, err error) {
+	var reply redis.Error
+	switch {
+	case err == nil:
+		h.breaker.Success()
+	case ctx.Err() != nil:
+	case errors.As(err, &reply):
+		if unavailableReply(reply.Error()) {
+			h.breaker.Failure()
+		} else {
+			h.breaker.Success()
+		}
+	default:
+		h.breaker.Failure()
+	}
+}
+
+// unavailableReply reports whether a Redis error reply means the server
+// can't serve commands right now
+func unavailableReply(reply string) bool {
+	for _, prefix := range []string{"LOADING", "MASTERDOWN", "CLUSTERDOWN", "TRYAGAIN"} {
+		if strings.HasPrefix(reply, prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,160 @@
+package queue
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Redis deployment modes
+const (
+	ModeStandalone = "standalone"
+	ModeSentinel   = "sentinel"
+	ModeCluster    = "cluster"
+)
+
+// Config describes how to reach Redis.
+//
+// In cluster mode keys that are used together in one command, script or
+// transaction share a hash tag so that they land in the same slot: the
+// pending and processing lists use {jobs}, and quota counters are tagged
+// with their minute. Job data and stats spread across the cluster.
+type Config struct {
+	Mode     string   // standalone (default), sentinel or cluster
+	Addrs    []string // node addresses, or sentinel addresses in sentinel mode
+	Password string
+	DB       int // ignored in cluster mode
+
+	MasterName       string // sentinel master name
+	SentinelPassword string
+
+	// Engine selects how pending and in-flight jobs are tracked: list
+	// (default) or stream. StreamClaimIdle is how long a stream message may
+	// stay unacknowledged before another worker reclaims it.
+	Engine          string
+	StreamClaimIdle time.Duration
+
+	// AffinityLeaseTTL is how long a worker keeps an affinity key without
+	// claiming, finishing or heartbeating one of its jobs
+	AffinityLeaseTTL time.Duration
+
+	// Codec encodes structured job fields: json (default) or msgpack
+	Codec string
+
+	// Pool sizes the connection pool and bounds its network calls. Zero
+	// fields keep the go-redis defaults.
+	Pool PoolConfig
+}
+
+// PoolConfig sizes the Redis connection pool. In cluster mode it applies
+// to each node's pool.
+type PoolConfig struct {
+	Size         int           // most connections; go-redis defaults to 10 per CPU
+	MinIdle      int           // idle connections kept open
+	Timeout      time.Duration // longest a call waits for a free connection
+	DialTimeout  time.Duration
+	ReadTimeout  time.Duration // blocking commands extend it by their own timeout
+	WriteTimeout time.Duration
+}
+
+// ParseAddrs splits a comma-separated address list
+func ParseAddrs(addrs string) []string {
+	var out []string
+	for _, addr := range strings.Split(addrs, ",") {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			out = append(out, addr)
+		}
+	}
+	return out
+}
+
+// NewClient creates a Redis client for the configured deployment mode
+func NewClient(cfg Config) (redis.UniversalClient, error) {
+	if len(cfg.Addrs) == 0 {
+		return nil, fmt.Errorf("at least one Redis address is required")
+	}
+
+	switch cfg.Mode {
+	case "", ModeStandalone:
+		return redis.NewClient(&redis.Options{
+			Addr:         cfg.Addrs[0],
+			Password:     cfg.Password,
+			DB:           cfg.DB,
+			PoolSize:     cfg.Pool.Size,
+			MinIdleConns: cfg.Pool.MinIdle,
+			PoolTimeout:  cfg.Pool.Timeout,
+			DialTimeout:  cfg.Pool.DialTimeout,
+			ReadTimeout:  cfg.Pool.ReadTimeout,
+			WriteTimeout: cfg.Pool.WriteTimeout,
+		}), nil
+	case ModeSentinel:
+		if cfg.MasterName == "" {
+			return nil, fmt.Errorf("sentinel mode requires a master name")
+		}
+		return redis.NewFailoverClient(&redis.FailoverOptions{
+			MasterName:       cfg.MasterName,
+			SentinelAddrs:    cfg.Addrs,
+			SentinelPassword: cfg.SentinelPassword,
+			Password:         cfg.Password,
+			DB:               cfg.DB,
+			PoolSize:         cfg.Pool.Size,
+			MinIdleConns:     cfg.Pool.MinIdle,
+			PoolTimeout:      cfg.Pool.Timeout,
+			DialTimeout:      cfg.Pool.DialTimeout,
+			ReadTimeout:      cfg.Pool.ReadTimeout,
+			WriteTimeout:     cfg.Pool.WriteTimeout,
+		}), nil
+	case ModeCluster:
+		return redis.NewClusterClient(&redis.ClusterOptions{
+			Addrs:        cfg.Addrs,
+			Password:     cfg.Password,
+			PoolSize:     cfg.Pool.Size,
+			MinIdleConns: cfg.Pool.MinIdle,
+			PoolTimeout:  cfg.Pool.Timeout,
+			DialTimeout:  cfg.Pool.DialTimeout,
+			ReadTimeout:  cfg.Pool.ReadTimeout,
+			WriteTimeout: cfg.Pool.WriteTimeout,
+		}), nil
+	default:
+		return nil, fmt.Errorf("unsupported Redis mode: %s", cfg.Mode)
+	}
+}
+
+// NewRedisQueueFromConfig creates a queue for a standalone, Sentinel or
+// Cluster deployment
+func NewRedisQueueFromConfig(cfg Config, opts ...Option) (*RedisQueue, error) {
+	client, err := NewClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	codec, err := NewCodec(cfg.Codec)
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+
+	r := &RedisQueue{
+		client:      client,
+		codec:       codec,
+		affinityTTL: cfg.AffinityLeaseTTL,
+	}
+
+	switch cfg.Engine {
+	case "", EngineList:
+		r.engine = &listEngine{client: client}
+	case EngineStream:
+		r.engine = newStreamEngine(client, cfg.StreamClaimIdle)
+	default:
+		client.Close()
+		return nil, fmt.Errorf("unsupported queue engine: %s", cfg.Engine)
+	}
+
+	for _, opt := range opts {
+		opt(r)
+	}
+
+	return r, nil
+}
@@ -0,0 +1,77 @@
+package queue
+
+import (
+	"encoding/json"
+	"reflect"
+	"taskflow/internal/types"
+	"testing"
+	"time"
+)
+
+func TestCodecRoundTrip(t *testing.T) {
+	progress := &types.JobProgress{Percent: 40, Message: "Exported 4000 rows", UpdatedAt: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)}
+	follow := &types.JobRequest{
+		Type:        types.JobTypeEmail,
+		Payload:     json.RawMessage(`{"to":"ops@example.com"}`),
+		AffinityKey: "customer-42",
+		OnFailure:   &types.JobRequest{Type: types.JobTypeWebhook, Payload: json.RawMessage(`{"url":"https://example.com"}`)},
+	}
+
+	for _, name := range []string{CodecJSON, CodecMsgpack} {
+		t.Run(name, func(t *testing.T) {
+			codec, err := NewCodec(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			r := &RedisQueue{codec: codec}
+
+			data, err := r.encodeValue(progress)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var gotProgress *types.JobProgress
+			if err := decodeValue(data, &gotProgress); err != nil {
+				t.Fatalf("decode progress: %v", err)
+			}
+			if gotProgress.Percent != progress.Percent || gotProgress.Message != progress.Message || !gotProgress.UpdatedAt.Equal(progress.UpdatedAt) {
+				t.Errorf("progress = %+v, want %+v", gotProgress, progress)
+			}
+
+			data, err = r.encodeValue(follow)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var gotFollow *types.JobRequest
+			if err := decodeValue(data, &gotFollow); err != nil {
+				t.Fatalf("decode follow-up: %v", err)
+			}
+			if !reflect.DeepEqual(gotFollow, follow) {
+				t.Errorf("follow-up = %+v, want %+v", gotFollow, follow)
+			}
+		})
+	}
+}
+
+func TestCodecVersionByte(t *testing.T) {
+	msgpack, _ := NewCodec(CodecMsgpack)
+	data, err := (&RedisQueue{codec: msgpack}).encodeValue(&types.JobProgress{Percent: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data[0] != codecMsgpackVersion {
+		t.Errorf("msgpack value starts with %#x, want the version byte", data[0])
+	}
+
+	// JSON values stay unprefixed, so older versions can read them
+	data, err = (&RedisQueue{}).encodeValue(&types.JobProgress{Percent: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data[0] != '{' {
+		t.Errorf("json value = %s, want a plain JSON object", data)
+	}
+
+	if _, err := NewCodec("proto"); err == nil {
+		t.Error("NewCodec(proto) succeeded, want an error")
+	}
+}
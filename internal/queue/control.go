@@ -0,0 +1,90 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"taskflow/internal/types"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// A pending control command is stored under the worker's control key so
+// that workers pick it up on their next heartbeat even if they missed the
+// pub/sub notification sent on the same key.
+
+// WorkerControlKey returns the key and channel used to control a worker
+func WorkerControlKey(workerID string) string {
+	return WorkerKeyPrefix + workerID + ":control"
+}
+
+// SendWorkerCommand records a command for a worker and notifies it.
+// Resume clears a previous pause rather than being stored itself.
+func (r *RedisQueue) SendWorkerCommand(ctx context.Context, workerID string, cmd types.WorkerCommand) error {
+	if !cmd.IsValid() {
+		return fmt.Errorf("invalid worker command: %s", cmd)
+	}
+
+	key := WorkerControlKey(workerID)
+
+	pipe := r.client.TxPipeline()
+	if cmd == types.WorkerCommandResume {
+		pipe.Del(ctx, key)
+	} else {
+		pipe.Set(ctx, key, string(cmd), 0)
+	}
+	pipe.Publish(ctx, key, string(cmd))
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to send worker command: %w", err)
+	}
+	return nil
+}
+
+// GetWorkerCommand returns the pending command for a worker, or resume if
+// there is none
+func (r *RedisQueue) GetWorkerCommand(ctx context.Context, workerID string) (types.WorkerCommand, error) {
+	cmd, err := r.client.Get(ctx, WorkerControlKey(workerID)).Result()
+	if err == redis.Nil {
+		return types.WorkerCommandResume, nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get worker command: %w", err)
+	}
+	return types.WorkerCommand(cmd), nil
+}
+
+// ClearWorkerCommand removes any pending command for a worker
+func (r *RedisQueue) ClearWorkerCommand(ctx context.Context, workerID string) error {
+	return r.client.Del(ctx, WorkerControlKey(workerID)).Err()
+}
+
+// SubscribeWorkerCommands delivers commands sent to a worker until ctx is
+// cancelled
+func (r *RedisQueue) SubscribeWorkerCommands(ctx context.Context, workerID string) <-chan types.WorkerCommand {
+	pubsub := r.client.Subscribe(ctx, WorkerControlKey(workerID))
+	commands := make(chan types.WorkerCommand)
+
+	go func() {
+		defer close(commands)
+		defer pubsub.Close()
+
+		messages := pubsub.Channel()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case msg, ok := <-messages:
+				if !ok {
+					return
+				}
+				select {
+				case commands <- types.WorkerCommand(msg.Payload):
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	return commands
+}
@@ -0,0 +1,197 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"taskflow/internal/types"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Queue engines
+const (
+	EngineList   = "list"
+	EngineStream = "stream"
+)
+
+// engine tracks which jobs are waiting and which are in flight. Job data,
+// stats and throughput counters are stored the same way for every engine.
+type engine interface {
+	// push queues a job. front asks for the job to be claimed next, which
+	// engines may ignore.
+	push(ctx context.Context, pipe redis.Pipeliner, job *types.Job, front bool)
+	// claim takes the next job of one of jobTypes for consumer, waiting up
+	// to timeout. It returns "" if no job became available. reclaimed is
+	// true when the job was abandoned by another consumer rather than new.
+	claim(ctx context.Context, consumer string, jobTypes []types.JobType, timeout time.Duration) (jobID string, reclaimed bool, err error)
+	// ack removes an in-flight job
+	ack(ctx context.Context, pipe redis.Pipeliner, jobID string) error
+	// touch tells the engine that consumer is still working on an
+	// in-flight job, postponing any reclaim
+	touch(ctx context.Context, consumer, jobID string) error
+	// inspect reports the queue state for each job type
+	inspect(ctx context.Context, jobTypes []types.JobType) ([]queueState, error)
+}
+
+// queueState describes the jobs of one type as seen by the engine
+type queueState struct {
+	name        string // key holding the type's pending jobs
+	pending     int64
+	processing  int64
+	oldestJobID string
+}
+
+// listEngine keeps pending job IDs in one list per type and in-flight IDs
+// in a shared processing list
+type listEngine struct {
+	client redis.UniversalClient
+}
+
+func (e *listEngine) push(ctx context.Context, pipe redis.Pipeliner, job *types.Job, front bool) {
+	// Jobs are claimed from the right
+	if front {
+		pipe.RPush(ctx, PendingQueueKey(job.Type), job.ID)
+	} else {
+		pipe.LPush(ctx, PendingQueueKey(job.Type), job.ID)
+	}
+}
+
+// claimScript atomically moves the oldest job from the first non-empty
+// pending list in KEYS[2..n] to the processing list KEYS[1]
+var claimScript = redis.NewScript(`
+for i = 2, #KEYS do
+	local id = redis.call('LMOVE', KEYS[i], KEYS[1], 'RIGHT', 'LEFT')
+	if id then
+		return id
+	end
+end
+return false
+`)
+
+// Poll bounds used when a worker supports several job types and there is
+// no single list to block on
+const (
+	minClaimPollInterval = 50 * time.Millisecond
+	maxClaimPollInterval = time.Second
+)
+
+func (e *listEngine) claim(ctx context.Context, consumer string, jobTypes []types.JobType, timeout time.Duration) (string, bool, error) {
+	// A single type can use BLMOVE for a blocking atomic move
+	if len(jobTypes) == 1 {
+		jobID, err := e.client.BLMove(ctx, PendingQueueKey(jobTypes[0]), ProcessingQueueKey, "RIGHT", "LEFT", timeout).Result()
+		if err == redis.Nil {
+			return "", false, nil
+		}
+		if err != nil {
+			return "", false, fmt.Errorf("failed to dequeue job: %w", err)
+		}
+		return jobID, false, nil
+	}
+
+	// Rotate the starting type so that a busy type can't starve the others
+	keys := make([]string, 0, len(jobTypes)+1)
+	keys = append(keys, ProcessingQueueKey)
+	start := rand.Intn(len(jobTypes))
+	for i := range jobTypes {
+		keys = append(keys, PendingQueueKey(jobTypes[(start+i)%len(jobTypes)]))
+	}
+
+	deadline := time.Now().Add(timeout)
+	interval := minClaimPollInterval
+	for {
+		jobID, err := claimScript.Run(ctx, e.client, keys).Text()
+		if err == nil {
+			return jobID, false, nil
+		}
+		if err != redis.Nil {
+			return "", false, fmt.Errorf("failed to dequeue job: %w", err)
+		}
+
+		wait := time.Until(deadline)
+		if wait <= 0 {
+			return "", false, nil
+		}
+		if wait > interval {
+			wait = interval
+		}
+
+		select {
+		case <-ctx.Done():
+			return "", false, ctx.Err()
+		case <-time.After(wait):
+		}
+
+		if interval *= 2; interval > maxClaimPollInterval {
+			interval = maxClaimPollInterval
+		}
+	}
+}
+
+func (e *listEngine) ack(ctx context.Context, pipe redis.Pipeliner, jobID string) error {
+	pipe.LRem(ctx, ProcessingQueueKey, 1, jobID)
+	return nil
+}
+
+// touch does nothing: the list engine never reclaims in-flight jobs
+func (e *listEngine) touch(ctx context.Context, consumer, jobID string) error {
+	return nil
+}
+
+func (e *listEngine) inspect(ctx context.Context, jobTypes []types.JobType) ([]queueState, error) {
+	pipe := e.client.Pipeline()
+	depthCmds := make([]*redis.IntCmd, len(jobTypes))
+	oldestCmds := make([]*redis.StringCmd, len(jobTypes))
+	for i, jobType := range jobTypes {
+		depthCmds[i] = pipe.LLen(ctx, PendingQueueKey(jobType))
+		oldestCmds[i] = pipe.LIndex(ctx, PendingQueueKey(jobType), -1)
+	}
+	processingCmd := pipe.LRange(ctx, ProcessingQueueKey, 0, -1)
+
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, fmt.Errorf("failed to read queue depth: %w", err)
+	}
+
+	// The processing list is shared, so in-flight jobs are counted by type
+	// from their job data. It holds at most one entry per busy executor.
+	processing, err := e.countByType(ctx, processingCmd.Val())
+	if err != nil {
+		return nil, err
+	}
+
+	queues := make([]queueState, len(jobTypes))
+	for i, jobType := range jobTypes {
+		queues[i] = queueState{
+			name:        PendingQueueKey(jobType),
+			pending:     depthCmds[i].Val(),
+			processing:  processing[jobType],
+			oldestJobID: oldestCmds[i].Val(),
+		}
+	}
+	return queues, nil
+}
+
+// countByType counts job IDs by the type recorded in their job data
+func (e *listEngine) countByType(ctx context.Context, jobIDs []string) (map[types.JobType]int64, error) {
+	counts := make(map[types.JobType]int64)
+	if len(jobIDs) == 0 {
+		return counts, nil
+	}
+
+	pipe := e.client.Pipeline()
+	cmds := make([]*redis.StringCmd, len(jobIDs))
+	for i, jobID := range jobIDs {
+		cmds[i] = pipe.HGet(ctx, JobKeyPrefix+jobID, "type")
+	}
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, fmt.Errorf("failed to read processing jobs: %w", err)
+	}
+
+	for _, cmd := range cmds {
+		if jobType := cmd.Val(); jobType != "" {
+			counts[types.JobType(jobType)]++
+		}
+	}
+	return counts, nil
+}
@@ -0,0 +1,381 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"taskflow/internal/storage"
+	"taskflow/internal/types"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// jobTTL is how long job data stays in Redis after its last full write
+const jobTTL = 24 * time.Hour
+
+// ErrJobConflict is returned when a job changed state before an update
+// could be applied, for example when a job is cancelled while a worker is
+// completing it. It is the same error storage returns for stale writes.
+var ErrJobConflict = storage.ErrJobConflict
+
+// Jobs are stored as hashes with one field per job attribute, named after
+// the job's JSON fields. Updates touch only the fields they change and are
+// applied by updateJobScript only if the job is still in an expected status,
+// so concurrent writers can't overwrite each other's changes with stale
+// copies of the whole job. Empty attributes are left out of the hash.
+//
+// Jobs written by older versions are JSON strings; they're converted to
+// hashes the first time they're updated.
+
+// updateJobScript sets the field/value pairs in ARGV[2..] on the job hash
+// KEYS[1], deleting fields whose value is empty, provided the job's status
+// is one of the space-separated statuses in ARGV[1] (any status if empty).
+// It returns the updated hash.
+var updateJobScript = redis.NewScript(`
+local kind = redis.call('TYPE', KEYS[1]).ok
+if kind == 'none' then
+	return false
+end
+if kind ~= 'hash' then
+	return redis.error_reply('LEGACY job is not a hash')
+end
+if ARGV[1] ~= '' then
+	local status = redis.call('HGET', KEYS[1], 'status')
+	local allowed = false
+	for s in string.gmatch(ARGV[1], '%S+') do
+		if s == status then
+			allowed = true
+		end
+	end
+	if not allowed then
+		return redis.error_reply('CONFLICT job is ' .. tostring(status))
+	end
+end
+for i = 2, #ARGV, 2 do
+	if ARGV[i + 1] == '' then
+		redis.call('HDEL', KEYS[1], ARGV[i])
+	else
+		redis.call('HSET', KEYS[1], ARGV[i], ARGV[i + 1])
+	end
+end
+return redis.call('HGETALL', KEYS[1])
+`)
+
+// jobUpdate is a set of job fields to write, in the order given
+type jobUpdate []string
+
+// set adds a field; an empty value removes it
+func (u jobUpdate) set(field, value string) jobUpdate {
+	return append(u, field, value)
+}
+
+// setTime adds a timestamp field; nil removes it
+func (u jobUpdate) setTime(field string, t *time.Time) jobUpdate {
+	if t == nil {
+		return u.set(field, "")
+	}
+	return u.set(field, formatTime(*t))
+}
+
+// updateJobFields applies update to a job that is in one of the given
+// statuses (any status when none are given) and returns the updated job. It
+// returns ErrJobConflict if the job is in another status.
+func (r *RedisQueue) updateJobFields(ctx context.Context, jobID string, statuses []types.JobStatus, update jobUpdate) (*types.Job, error) {
+	allowed := make([]string, len(statuses))
+	for i, status := range statuses {
+		allowed[i] = string(status)
+	}
+
+	args := make([]interface{}, 0, len(update)+1)
+	args = append(args, strings.Join(allowed, " "))
+	for _, v := range update {
+		args = append(args, v)
+	}
+
+	keys := []string{JobKeyPrefix + jobID}
+	for converted := false; ; converted = true {
+		res, err := updateJobScript.Run(ctx, r.client, keys, args...).StringSlice()
+		switch {
+		case err == redis.Nil:
+			return nil, fmt.Errorf("%w: %s", storage.ErrJobNotFound, jobID)
+		case err != nil && strings.HasPrefix(err.Error(), "CONFLICT"):
+			return nil, fmt.Errorf("%w: %s", ErrJobConflict, err)
+		case err != nil && strings.HasPrefix(err.Error(), "LEGACY") && !converted:
+			if err := r.convertLegacyJob(ctx, jobID); err != nil {
+				return nil, err
+			}
+			continue
+		case err != nil:
+			return nil, fmt.Errorf("failed to update job: %w", err)
+		}
+
+		fields := make(map[string]string, len(res)/2)
+		for i := 0; i+1 < len(res); i += 2 {
+			fields[res[i]] = res[i+1]
+		}
+		return r.decodeJob(ctx, fields)
+	}
+}
+
+// setJob writes all of a job's fields and refreshes its expiry. It doesn't
+// remove fields the job no longer has; see UpdateJob.
+func (r *RedisQueue) setJob(ctx context.Context, pipe redis.Pipeliner, job *types.Job) error {
+	fields, err := r.encodeJob(ctx, job)
+	if err != nil {
+		return fmt.Errorf("failed to marshal job: %w", err)
+	}
+
+	key := JobKeyPrefix + job.ID
+	pipe.HSet(ctx, key, fields)
+	pipe.Expire(ctx, key, jobTTL)
+	return nil
+}
+
+// convertLegacyJob rewrites a job stored as a JSON string as a hash
+func (r *RedisQueue) convertLegacyJob(ctx context.Context, jobID string) error {
+	data, err := r.client.Get(ctx, JobKeyPrefix+jobID).Bytes()
+	if err == redis.Nil {
+		return fmt.Errorf("%w: %s", storage.ErrJobNotFound, jobID)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get job: %w", err)
+	}
+
+	job, err := unmarshalLegacyJob(data)
+	if err != nil {
+		return err
+	}
+	return r.UpdateJob(ctx, job)
+}
+
+// encodeJob converts a job to hash fields, encrypting its payload, result,
+// checkpoint and follow-up payloads
+func (r *RedisQueue) encodeJob(ctx context.Context, job *types.Job) (map[string]interface{}, error) {
+	payload, err := r.cipher.Seal(ctx, job.Payload)
+	if err != nil {
+		return nil, err
+	}
+	result, err := r.cipher.Seal(ctx, job.Result)
+	if err != nil {
+		return nil, err
+	}
+	checkpoint, err := r.cipher.Seal(ctx, job.Checkpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := map[string]interface{}{
+		"id":           job.ID,
+		"type":         string(job.Type),
+		"status":       string(job.Status),
+		"attempts":     job.Attempts,
+		"max_attempts": job.MaxAttempts,
+		"created_at":   formatTime(job.CreatedAt),
+		"updated_at":   formatTime(job.UpdatedAt),
+		"scheduled_at": formatTime(job.ScheduledAt),
+	}
+	optional := map[string]string{
+		"tenant_id":   job.TenantID,
+		"priority":    string(job.Priority),
+		"payload":     string(payload),
+		"payload_ref": job.PayloadRef,
+		"result":      string(result),
+		"error":       job.Error,
+		"error_code":  string(job.ErrorCode),
+		"worker_id":   job.WorkerID,
+		"checkpoint":  string(checkpoint),
+		"parent_id":   job.ParentID,
+
+		"workflow_id":   job.WorkflowID,
+		"workflow_step": job.WorkflowStep,
+		"affinity_key":  job.AffinityKey,
+	}
+	for field, value := range optional {
+		if value != "" {
+			fields[field] = value
+		}
+	}
+	if job.StartedAt != nil {
+		fields["started_at"] = formatTime(*job.StartedAt)
+	}
+	if job.CompletedAt != nil {
+		fields["completed_at"] = formatTime(*job.CompletedAt)
+	}
+	if job.ExpiresAt != nil {
+		fields["expires_at"] = formatTime(*job.ExpiresAt)
+	}
+	if job.Progress != nil {
+		progress, err := r.encodeValue(job.Progress)
+		if err != nil {
+			return nil, err
+		}
+		fields["progress"] = progress
+	}
+	follows := map[string]*types.JobRequest{"on_success": job.OnSuccess, "on_failure": job.OnFailure}
+	for field, follow := range follows {
+		if follow == nil {
+			continue
+		}
+		sealed, err := follow.MapPayloads(func(value json.RawMessage) (json.RawMessage, error) {
+			return r.cipher.Seal(ctx, value)
+		})
+		if err != nil {
+			return nil, err
+		}
+		data, err := r.encodeValue(sealed)
+		if err != nil {
+			return nil, err
+		}
+		fields[field] = data
+	}
+
+	return fields, nil
+}
+
+// decodeJob converts hash fields to a job, decrypting its payload, result,
+// checkpoint and follow-up payloads
+func (r *RedisQueue) decodeJob(ctx context.Context, fields map[string]string) (*types.Job, error) {
+	job := &types.Job{
+		ID:         fields["id"],
+		TenantID:   fields["tenant_id"],
+		Type:       types.JobType(fields["type"]),
+		Priority:   types.JobPriority(fields["priority"]),
+		PayloadRef: fields["payload_ref"],
+		Status:     types.JobStatus(fields["status"]),
+		Error:      fields["error"],
+		ErrorCode:  types.ErrorCode(fields["error_code"]),
+		WorkerID:   fields["worker_id"],
+		Payload:    rawJSON(fields["payload"]),
+		Result:     rawJSON(fields["result"]),
+		Checkpoint: rawJSON(fields["checkpoint"]),
+		ParentID:   fields["parent_id"],
+
+		WorkflowID:   fields["workflow_id"],
+		WorkflowStep: fields["workflow_step"],
+		AffinityKey:  fields["affinity_key"],
+	}
+
+	var err error
+	if job.Attempts, err = parseInt(fields, "attempts"); err != nil {
+		return nil, err
+	}
+	if job.MaxAttempts, err = parseInt(fields, "max_attempts"); err != nil {
+		return nil, err
+	}
+
+	times := map[string]*time.Time{
+		"created_at":   &job.CreatedAt,
+		"updated_at":   &job.UpdatedAt,
+		"scheduled_at": &job.ScheduledAt,
+	}
+	for field, t := range times {
+		if *t, err = parseTime(fields, field); err != nil {
+			return nil, err
+		}
+	}
+	if _, ok := fields["started_at"]; ok {
+		t, err := parseTime(fields, "started_at")
+		if err != nil {
+			return nil, err
+		}
+		job.StartedAt = &t
+	}
+	if _, ok := fields["completed_at"]; ok {
+		t, err := parseTime(fields, "completed_at")
+		if err != nil {
+			return nil, err
+		}
+		job.CompletedAt = &t
+	}
+	if _, ok := fields["expires_at"]; ok {
+		t, err := parseTime(fields, "expires_at")
+		if err != nil {
+			return nil, err
+		}
+		job.ExpiresAt = &t
+	}
+	if progress, ok := fields["progress"]; ok {
+		if err := decodeValue(progress, &job.Progress); err != nil {
+			return nil, fmt.Errorf("invalid job field progress: %w", err)
+		}
+	}
+	follows := map[string]**types.JobRequest{"on_success": &job.OnSuccess, "on_failure": &job.OnFailure}
+	for field, follow := range follows {
+		value, ok := fields[field]
+		if !ok {
+			continue
+		}
+		if err := decodeValue(value, follow); err != nil {
+			return nil, fmt.Errorf("invalid job field %s: %w", field, err)
+		}
+		opened, err := (*follow).MapPayloads(func(value json.RawMessage) (json.RawMessage, error) {
+			return r.cipher.Open(ctx, value)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt follow-up payload: %w", err)
+		}
+		*follow = opened
+	}
+
+	if job.Payload, err = r.cipher.Open(ctx, job.Payload); err != nil {
+		return nil, fmt.Errorf("failed to decrypt job payload: %w", err)
+	}
+	if job.Result, err = r.cipher.Open(ctx, job.Result); err != nil {
+		return nil, fmt.Errorf("failed to decrypt job result: %w", err)
+	}
+	if job.Checkpoint, err = r.cipher.Open(ctx, job.Checkpoint); err != nil {
+		return nil, fmt.Errorf("failed to decrypt job checkpoint: %w", err)
+	}
+
+	return job, nil
+}
+
+// unmarshalLegacyJob decodes a job stored as a JSON string, as jobs were
+// before they became hashes. Those jobs were never encrypted.
+func unmarshalLegacyJob(data []byte) (*types.Job, error) {
+	var job types.Job
+	if err := json.Unmarshal(data, &job); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal job: %w", err)
+	}
+	return &job, nil
+}
+
+// rawJSON converts a stored JSON string back to a raw value, keeping empty
+// values nil
+func rawJSON(s string) json.RawMessage {
+	if s == "" {
+		return nil
+	}
+	return json.RawMessage(s)
+}
+
+func formatTime(t time.Time) string {
+	return t.Format(time.RFC3339Nano)
+}
+
+func parseTime(fields map[string]string, field string) (time.Time, error) {
+	value, ok := fields[field]
+	if !ok {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid job field %s: %w", field, err)
+	}
+	return t, nil
+}
+
+func parseInt(fields map[string]string, field string) (int, error) {
+	value, ok := fields[field]
+	if !ok {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid job field %s: %w", field, err)
+	}
+	return n, nil
+}
@@ -0,0 +1,62 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"taskflow/internal/types"
+	"time"
+)
+
+// Queue backends
+const (
+	BackendRedis = "redis"
+	BackendSQS   = "sqs"
+)
+
+// Queue hands jobs from the API to workers and tracks them until they
+// finish. RedisQueue is the default backend; SQSQueue runs on AWS SQS with
+// job state kept in PostgreSQL.
+type Queue interface {
+	Ping(ctx context.Context) error
+	Close() error
+
+	// MigrateLegacyQueue moves jobs queued by older versions onto the
+	// current queues and returns how many were moved
+	MigrateLegacyQueue(ctx context.Context, jobTypes []types.JobType) (int, error)
+
+	EnqueueJob(ctx context.Context, job *types.Job) error
+	EnqueueJobs(ctx context.Context, jobs []*types.Job) error
+	DequeueJob(ctx context.Context, workerID string, jobTypes []types.JobType, timeout time.Duration) (*types.Job, error)
+	GetJob(ctx context.Context, jobID string) (*types.Job, error)
+	CompleteJob(ctx context.Context, jobID string, result json.RawMessage) error
+	FailJob(ctx context.Context, jobID string, failure types.Failure) error
+	RequeueJob(ctx context.Context, jobID string) error
+	ParkJob(ctx context.Context, jobID string, until time.Time) error
+	CancelJob(ctx context.Context, jobID string) error
+	ExpireJob(ctx context.Context, jobID string) error
+	UpdateProgress(ctx context.Context, jobID string, progress *types.JobProgress) error
+	SaveCheckpoint(ctx context.Context, jobID string, checkpoint json.RawMessage) error
+	Heartbeat(ctx context.Context, workerID, jobID string) error
+	ReleaseAffinity(ctx context.Context, workerID string) error
+
+	GetStats(ctx context.Context, tenantID string) (*types.JobStats, error)
+	SetStats(ctx context.Context, tenantID string, stats *types.JobStats) error
+	InspectQueues(ctx context.Context, jobTypes []types.JobType) ([]types.QueueStats, error)
+	GetQueueMetrics(ctx context.Context, jobTypes []types.JobType, window time.Duration) ([]QueueMetrics, error)
+	GetPendingDepth(ctx context.Context, jobTypes []types.JobType) (int64, error)
+
+	SendWorkerCommand(ctx context.Context, workerID string, cmd types.WorkerCommand) error
+	GetWorkerCommand(ctx context.Context, workerID string) (types.WorkerCommand, error)
+	ClearWorkerCommand(ctx context.Context, workerID string) error
+	SubscribeWorkerCommands(ctx context.Context, workerID string) <-chan types.WorkerCommand
+
+	PublishJobUpdate(ctx context.Context, jobID string) error
+	SubscribeJobUpdates(ctx context.Context) <-chan string
+	PublishSchemaUpdate(ctx context.Context, jobType types.JobType) error
+	SubscribeSchemaUpdates(ctx context.Context) <-chan string
+}
+
+var (
+	_ Queue = (*RedisQueue)(nil)
+	_ Queue = (*SQSQueue)(nil)
+)
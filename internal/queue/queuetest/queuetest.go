@@ -0,0 +1,234 @@
+// Package queuetest provides an in-memory queue.Queue for tests of the
+// packages built on the queue, such as the API handlers.
+package queuetest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sync"
+	"taskflow/internal/queue"
+	"taskflow/internal/storage"
+	"taskflow/internal/types"
+	"time"
+)
+
+// Queue is an in-memory queue.Queue. It keeps jobs and a single FIFO of
+// waiting ones, and implements the job lifecycle the API and workers use.
+// Other methods panic through the embedded nil Queue, so a test that
+// reaches one fails loudly rather than passing by accident.
+type Queue struct {
+	queue.Queue
+
+	mu       sync.Mutex
+	jobs     map[string]*types.Job
+	pending  []string
+	commands map[string]types.WorkerCommand
+	errs     map[string]error
+}
+
+// New returns an empty queue
+func New() *Queue {
+	return &Queue{
+		jobs:     make(map[string]*types.Job),
+		commands: make(map[string]types.WorkerCommand),
+		errs:     make(map[string]error),
+	}
+}
+
+// FailWith makes the named method, such as "EnqueueJob", return err until
+// it is called again with a nil err
+func (q *Queue) FailWith(method string, err error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if err == nil {
+		delete(q.errs, method)
+		return
+	}
+	q.errs[method] = err
+}
+
+// Command returns the last command sent to a worker
+func (q *Queue) Command(workerID string) types.WorkerCommand {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.commands[workerID]
+}
+
+func (q *Queue) Ping(ctx context.Context) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.errs["Ping"]
+}
+
+func (q *Queue) Close() error {
+	return nil
+}
+
+func (q *Queue) EnqueueJob(ctx context.Context, job *types.Job) error {
+	return q.EnqueueJobs(ctx, []*types.Job{job})
+}
+
+func (q *Queue) EnqueueJobs(ctx context.Context, jobs []*types.Job) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if err := q.fail("EnqueueJob", "EnqueueJobs"); err != nil {
+		return err
+	}
+	for _, job := range jobs {
+		stored := *job
+		q.jobs[job.ID] = &stored
+		if job.Status == types.JobStatusPending {
+			q.pending = append(q.pending, job.ID)
+		}
+	}
+	return nil
+}
+
+// DequeueJob claims the oldest pending job of jobTypes. It doesn't wait
+// for one: with none pending it returns nil at once.
+func (q *Queue) DequeueJob(ctx context.Context, workerID string, jobTypes []types.JobType, timeout time.Duration) (*types.Job, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if err := q.fail("DequeueJob"); err != nil {
+		return nil, err
+	}
+	for i, jobID := range q.pending {
+		job := q.jobs[jobID]
+		if !slices.Contains(jobTypes, job.Type) {
+			continue
+		}
+		q.pending = append(q.pending[:i:i], q.pending[i+1:]...)
+
+		now := time.Now()
+		job.Status = types.JobStatusProcessing
+		job.WorkerID = workerID
+		job.StartedAt = &now
+		job.UpdatedAt = now
+		claimed := *job
+		return &claimed, nil
+	}
+	return nil, nil
+}
+
+func (q *Queue) GetJob(ctx context.Context, jobID string) (*types.Job, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if err := q.fail("GetJob"); err != nil {
+		return nil, err
+	}
+	job, ok := q.jobs[jobID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", storage.ErrJobNotFound, jobID)
+	}
+	found := *job
+	return &found, nil
+}
+
+func (q *Queue) CompleteJob(ctx context.Context, jobID string, result json.RawMessage) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	_, err := q.transition("CompleteJob", jobID, types.JobStatusCompleted, types.JobStatusProcessing)
+	return err
+}
+
+// FailJob fails a processing job for good; it doesn't retry jobs
+func (q *Queue) FailJob(ctx context.Context, jobID string, failure types.Failure) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	job, err := q.transition("FailJob", jobID, types.JobStatusFailed, types.JobStatusProcessing)
+	if err != nil {
+		return err
+	}
+	job.Error = failure.Message
+	job.ErrorCode = failure.Code
+	job.Attempts++
+	return nil
+}
+
+func (q *Queue) CancelJob(ctx context.Context, jobID string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	_, err := q.transition("CancelJob", jobID, types.JobStatusCancelled,
+		types.JobStatusScheduled, types.JobStatusPending, types.JobStatusProcessing, types.JobStatusRetrying)
+	return err
+}
+
+func (q *Queue) GetPendingDepth(ctx context.Context, jobTypes []types.JobType) (int64, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if err := q.fail("GetPendingDepth"); err != nil {
+		return 0, err
+	}
+	var depth int64
+	for _, jobID := range q.pending {
+		if slices.Contains(jobTypes, q.jobs[jobID].Type) {
+			depth++
+		}
+	}
+	return depth, nil
+}
+
+func (q *Queue) SendWorkerCommand(ctx context.Context, workerID string, cmd types.WorkerCommand) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if err := q.fail("SendWorkerCommand"); err != nil {
+		return err
+	}
+	q.commands[workerID] = cmd
+	return nil
+}
+
+// PublishJobUpdate announces nothing: the queue has no subscribers
+func (q *Queue) PublishJobUpdate(ctx context.Context, jobID string) error {
+	return nil
+}
+
+// SubscribeJobUpdates returns a channel that is closed when ctx is done
+func (q *Queue) SubscribeJobUpdates(ctx context.Context) <-chan string {
+	updates := make(chan string)
+	go func() {
+		<-ctx.Done()
+		close(updates)
+	}()
+	return updates
+}
+
+// transition moves a job in one of statuses to the final status, or
+// returns queue.ErrJobConflict. The caller holds q.mu.
+func (q *Queue) transition(method, jobID string, status types.JobStatus, statuses ...types.JobStatus) (*types.Job, error) {
+	if err := q.fail(method); err != nil {
+		return nil, err
+	}
+	job, ok := q.jobs[jobID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", storage.ErrJobNotFound, jobID)
+	}
+	if !slices.Contains(statuses, job.Status) {
+		return nil, fmt.Errorf("%w: job %s is %s", queue.ErrJobConflict, jobID, job.Status)
+	}
+
+	now := time.Now()
+	job.Status = status
+	job.UpdatedAt = now
+	job.CompletedAt = &now
+	for i, pendingID := range q.pending {
+		if pendingID == jobID {
+			q.pending = append(q.pending[:i:i], q.pending[i+1:]...)
+			break
+		}
+	}
+	return job, nil
+}
+
+// fail returns the error set for the first of methods that has one. The
+// caller holds q.mu.
+func (q *Queue) fail(methods ...string) error {
+	for _, method := range methods {
+		if err := q.errs[method]; err != nil {
+			return err
+		}
+	}
+	return nil
+}
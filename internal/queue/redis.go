@@ -3,7 +3,12 @@ package queue
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"strconv"
+	"strings"
+	"taskflow/internal/encryption"
+	"taskflow/internal/storage"
 	"taskflow/internal/types"
 	"time"
 
@@ -11,27 +16,76 @@ import (
 )
 
 const (
-	JobQueueKey        = "taskflow:jobs:pending"
-	ProcessingQueueKey = "taskflow:jobs:processing"
+	JobQueueKey        = "taskflow:{jobs}:pending"
+	ProcessingQueueKey = "taskflow:{jobs}:processing"
+	ParkedQueueKey     = "taskflow:{jobs}:parked"
 	JobKeyPrefix       = "taskflow:job:"
 	WorkerKeyPrefix    = "taskflow:worker:"
 	StatsKey           = "taskflow:stats"
+	TenantKeyPrefix    = "taskflow:tenant:"
+
+	// Pending list used before the {jobs} hash tag was introduced
+	legacyJobQueueKey = "taskflow:jobs:pending"
 )
 
+// Job IDs are globally unique, so job data and the shared work queues stay
+// keyed by ID. Per-tenant counters live under TenantKeyPrefix.
+//
+// Pending jobs are kept in one list per job type so that a worker only
+// claims jobs it declared support for. The pending and processing lists share
+// the {jobs} hash tag so that claims stay atomic on Redis Cluster. Parked
+// jobs wait in a sorted set, scored by when they may run, until a dequeue
+// queues them again.
+
+// unparkBatch bounds how many parked jobs a dequeue queues again
+const unparkBatch = 100
+
+// PendingQueueKey returns the pending list for a job type
+func PendingQueueKey(jobType types.JobType) string {
+	return JobQueueKey + ":" + string(jobType)
+}
+
+// TenantStatsKey returns the stats hash for a tenant
+func TenantStatsKey(tenantID string) string {
+	return TenantKeyPrefix + tenantID + ":stats"
+}
+
 type RedisQueue struct {
-	client *redis.Client
+	client redis.UniversalClient
+	cipher *encryption.Cipher
+	engine engine
+	codec  Codec // JSON if nil
+
+	affinityTTL time.Duration // DefaultAffinityLeaseTTL if zero
 }
 
-func NewRedisQueue(addr, password string, db int) *RedisQueue {
+// Option configures optional RedisQueue behaviour
+type Option func(*RedisQueue)
+
+// WithCipher encrypts job payloads and results before they are written to Redis
+func WithCipher(c *encryption.Cipher) Option {
+	return func(r *RedisQueue) {
+		r.cipher = c
+	}
+}
+
+func NewRedisQueue(addr, password string, db int, opts ...Option) *RedisQueue {
 	rdb := redis.NewClient(&redis.Options{
 		Addr:     addr,
 		Password: password,
 		DB:       db,
 	})
 
-	return &RedisQueue{
+	r := &RedisQueue{
 		client: rdb,
+		engine: &listEngine{client: rdb},
 	}
+
+	for _, opt := range opts {
+		opt(r)
+	}
+
+	return r
 }
 
 // Close closes the Redis connection
@@ -39,6 +93,12 @@ func (r *RedisQueue) Close() error {
 	return r.client.Close()
 }
 
+// Client returns the underlying Redis client so other components
+// (event sinks, counters) can share the connection pool
+func (r *RedisQueue) Client() redis.UniversalClient {
+	return r.client
+}
+
 // Ping checks if Redis is available
 func (r *RedisQueue) Ping(ctx context.Context) error {
 	return r.client.Ping(ctx).Err()
@@ -46,252 +106,630 @@ func (r *RedisQueue) Ping(ctx context.Context) error {
 
 // EnqueueJob adds a job to the pending queue
 func (r *RedisQueue) EnqueueJob(ctx context.Context, job *types.Job) error {
-	// Store job details
-	jobData, err := json.Marshal(job)
-	if err != nil {
-		return fmt.Errorf("failed to marshal job: %w", err)
-	}
-
-	jobKey := JobKeyPrefix + job.ID
-
 	// Use a pipeline for atomic operations
 	pipe := r.client.Pipeline()
+	if err := r.queueJob(ctx, pipe, job); err != nil {
+		return err
+	}
 
-	// Store job data
-	pipe.Set(ctx, jobKey, jobData, 24*time.Hour) // Jobs expire after 24 hours
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to enqueue job: %w", err)
+	}
 
-	// Add job ID to pending queue
-	pipe.LPush(ctx, JobQueueKey, job.ID)
+	return nil
+}
 
-	// Update stats
-	pipe.HIncrBy(ctx, StatsKey, "total", 1)
-	pipe.HIncrBy(ctx, StatsKey, "pending", 1)
+// enqueueBatch bounds the jobs sent in one pipeline, so a large batch
+// doesn't hold a connection or Redis itself for long
+const enqueueBatch = 500
+
+// EnqueueJobs adds jobs to their pending queues, enqueueBatch jobs per
+// round trip. If it fails, jobs of earlier round trips stay queued.
+func (r *RedisQueue) EnqueueJobs(ctx context.Context, jobs []*types.Job) error {
+	for start := 0; start < len(jobs); start += enqueueBatch {
+		end := min(start+enqueueBatch, len(jobs))
+
+		pipe := r.client.Pipeline()
+		for _, job := range jobs[start:end] {
+			if err := r.queueJob(ctx, pipe, job); err != nil {
+				return err
+			}
+		}
+		if _, err := pipe.Exec(ctx); err != nil {
+			return fmt.Errorf("failed to enqueue jobs: %w", err)
+		}
+	}
+	return nil
+}
 
-	_, err = pipe.Exec(ctx)
-	if err != nil {
-		return fmt.Errorf("failed to enqueue job: %w", err)
+// queueJob adds the commands that store and queue job to pipe
+func (r *RedisQueue) queueJob(ctx context.Context, pipe redis.Pipeliner, job *types.Job) error {
+	// Store job data; jobs expire after 24 hours
+	if err := r.setJob(ctx, pipe, job); err != nil {
+		return err
+	}
+
+	// A job scheduled for later waits in the parked set until it is due,
+	// like a delayed retry. Affinity jobs are queued on their key right
+	// away so that they keep their place, and wait there (see
+	// deferAffinity).
+	if job.AffinityKey == "" && job.ScheduledAt.After(time.Now()) {
+		pipe.ZAdd(ctx, ParkedQueueKey, redis.Z{Score: float64(job.ScheduledAt.UnixMilli()), Member: job.ID})
+	} else {
+		// Add job ID to its type's pending queue. High-priority jobs jump
+		// ahead of everything already queued where the engine supports it,
+		// except on an affinity key, whose jobs run in the order they were
+		// queued.
+		r.push(ctx, pipe, job, job.AffinityKey == "" && job.EffectivePriority() == types.JobPriorityHigh)
 	}
 
+	// Update stats
+	incrStats(ctx, pipe, job, "total", 1)
+	incrStats(ctx, pipe, job, statsField(job.Status), 1)
+	recordThroughput(ctx, pipe, job, "enqueued")
 	return nil
 }
 
-// DequeueJob removes and returns a job from the pending queue
-// This is a blocking operation that waits for jobs to be available
-func (r *RedisQueue) DequeueJob(ctx context.Context, workerID string, timeout time.Duration) (*types.Job, error) {
-	// Use BRPOPLPUSH for atomic move from pending to processing
-	result := r.client.BRPopLPush(ctx, JobQueueKey, ProcessingQueueKey, timeout)
-	if result.Err() != nil {
-		if result.Err() == redis.Nil {
+// DequeueJob removes and returns a job of one of the given types from the
+// pending queues. This is a blocking operation that waits up to timeout for
+// a job to be available.
+func (r *RedisQueue) DequeueJob(ctx context.Context, workerID string, jobTypes []types.JobType, timeout time.Duration) (*types.Job, error) {
+	if len(jobTypes) == 0 {
+		return nil, fmt.Errorf("no job types to dequeue")
+	}
+
+	if err := r.unpark(ctx); err != nil {
+		return nil, err
+	}
+
+	// Jobs of the affinity keys this worker holds come first. A job on an
+	// expired lease may come back while still processing, so it is claimed
+	// like a reclaimed one.
+	claimed, err := r.claimAffinity(ctx, workerID, jobTypes)
+	if err != nil {
+		return nil, err
+	}
+	if claimed != nil {
+		if claimed, err = r.deferAffinity(ctx, claimed); err != nil {
+			return nil, err
+		}
+	}
+	reclaimed := claimed != nil
+	if claimed == nil {
+		jobID, engineReclaimed, err := r.engine.claim(ctx, workerID, jobTypes, timeout)
+		if err != nil {
+			return nil, err
+		}
+		if jobID == "" {
 			return nil, nil // No job available (timeout)
 		}
-		return nil, fmt.Errorf("failed to dequeue job: %w", result.Err())
+		claimed, reclaimed = &types.Job{ID: jobID}, engineReclaimed
+	}
+
+	job, from, err := r.stampClaim(ctx, claimed.ID, workerID, reclaimed)
+	if err != nil || job == nil {
+		// The job is gone or no longer waiting (a stale or duplicate ID);
+		// drop it from the in-flight jobs
+		pipe := r.client.Pipeline()
+		if ackErr := r.ack(ctx, pipe, claimed, false); ackErr == nil {
+			pipe.Exec(ctx)
+		}
+		return nil, err
+	}
+
+	// A reclaimed job was already counted as processing when its previous
+	// worker claimed it. Stats hashes live in other cluster slots than the
+	// job, so they're updated after the claim.
+	if from != types.JobStatusProcessing {
+		pipe := r.client.Pipeline()
+		incrStats(ctx, pipe, job, statsField(from), -1)
+		incrStats(ctx, pipe, job, "processing", 1)
+		pipe.Exec(ctx)
+	}
+
+	return job, nil
+}
+
+// deferAffinity hands a claimed affinity job back to the head of its key
+// if it is a retry or a scheduled job that isn't due yet, and returns nil
+// for it; otherwise it returns claimed. The worker keeps the key, so later
+// jobs of the key wait behind it while the worker runs other jobs.
+func (r *RedisQueue) deferAffinity(ctx context.Context, claimed *types.Job) (*types.Job, error) {
+	job, err := r.GetJob(ctx, claimed.ID)
+	waiting := err == nil && (job.Status == types.JobStatusRetrying || job.Status == types.JobStatusScheduled)
+	if !waiting || !job.ScheduledAt.After(time.Now()) {
+		return claimed, nil // stampClaim deals with jobs that are gone
 	}
 
-	jobID := result.Val()
+	pipe := r.client.Pipeline()
+	r.push(ctx, pipe, job, true)
+	if err := r.ack(ctx, pipe, job, false); err != nil {
+		return nil, err
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, fmt.Errorf("failed to defer job %s: %w", job.ID, err)
+	}
+	return nil, nil
+}
 
-	// Get job details
+// stampClaim assigns a claimed job ID to workerID in a single atomic step,
+// so the job is never seen as claimed but still waiting. It returns the
+// claimed job and the status it was claimed from, or a nil job if the job
+// is no longer waiting to run.
+func (r *RedisQueue) stampClaim(ctx context.Context, jobID, workerID string, reclaimed bool) (*types.Job, types.JobStatus, error) {
 	job, err := r.GetJob(ctx, jobID)
 	if err != nil {
-		// If we can't get the job, remove it from processing queue
-		r.client.LRem(ctx, ProcessingQueueKey, 1, jobID)
-		return nil, err
+		return nil, "", err
+	}
+
+	// A job that waited past its expiry expires instead of running late
+	from := job.Status
+	if from != types.JobStatusProcessing && job.Expired(time.Now()) {
+		if err := r.ExpireJob(ctx, jobID); err != nil && !errors.Is(err, ErrJobConflict) {
+			return nil, from, err
+		}
+		return nil, from, nil
+	}
+
+	// A reclaimed job is claimed again without changing status
+	if !reclaimed || from != types.JobStatusProcessing {
+		if err := job.Transition(types.JobStatusProcessing); err != nil {
+			return nil, from, nil
+		}
 	}
 
-	// Update job status and worker assignment
-	job.Status = types.JobStatusProcessing
-	job.WorkerID = workerID
 	now := time.Now()
-	job.StartedAt = &now
-	job.UpdatedAt = now
+	update := jobUpdate{}.
+		set("status", string(types.JobStatusProcessing)).
+		set("worker_id", workerID).
+		set("progress", "").
+		setTime("started_at", &now).
+		setTime("updated_at", &now)
+
+	// The status it was read in tells which stats counter it leaves
+	job, err = r.updateJobFields(ctx, jobID, []types.JobStatus{from}, update)
+	if errors.Is(err, ErrJobConflict) {
+		return nil, from, nil
+	}
+	if err != nil {
+		return nil, from, err
+	}
+	return job, from, nil
+}
 
-	err = r.UpdateJob(ctx, job)
+// MigrateLegacyQueue moves jobs queued by older versions onto the current
+// engine's pending queues: the shared pending list, per-type lists created
+// before the {jobs} hash tag and, when the stream engine is active, the
+// list engine's per-type lists. It is safe to call on every startup.
+//
+// Each ID is queued again before it is removed from the old list, so an
+// interrupted migration can duplicate a queued ID but never lose one. Jobs
+// still listed as processing are left alone; drain workers before upgrading
+// or switching engines.
+func (r *RedisQueue) MigrateLegacyQueue(ctx context.Context, jobTypes []types.JobType) (int, error) {
+	moved, err := r.migrateList(ctx, legacyJobQueueKey, func(jobID string) (*types.Job, bool) {
+		job, err := r.GetJob(ctx, jobID)
+		if err != nil {
+			// Job data expired; drop the ID
+			return nil, false
+		}
+		return job, true
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to update job status: %w", err)
+		return moved, err
 	}
 
-	// Update stats
-	pipe := r.client.Pipeline()
-	pipe.HIncrBy(ctx, StatsKey, "pending", -1)
-	pipe.HIncrBy(ctx, StatsKey, "processing", 1)
-	pipe.Exec(ctx)
+	_, listEngine := r.engine.(*listEngine)
+	for _, jobType := range jobTypes {
+		srcs := []string{legacyJobQueueKey + ":" + string(jobType)}
+		if !listEngine {
+			srcs = append(srcs, PendingQueueKey(jobType))
+		}
 
-	return job, nil
+		for _, src := range srcs {
+			jobType := jobType
+			n, err := r.migrateList(ctx, src, func(jobID string) (*types.Job, bool) {
+				return &types.Job{ID: jobID, Type: jobType}, true
+			})
+			moved += n
+			if err != nil {
+				return moved, err
+			}
+		}
+	}
+
+	return moved, nil
+}
+
+// migrateList drains src so that the oldest legacy job is claimed first.
+// The list engine queues IDs newest first at the claim end; other engines
+// append them oldest first.
+func (r *RedisQueue) migrateList(ctx context.Context, src string, target func(jobID string) (*types.Job, bool)) (int, error) {
+	_, front := r.engine.(*listEngine)
+	index := int64(-1)
+	if front {
+		index = 0
+	}
+
+	moved := 0
+	for {
+		jobID, err := r.client.LIndex(ctx, src, index).Result()
+		if err == redis.Nil {
+			return moved, nil
+		}
+		if err != nil {
+			return moved, fmt.Errorf("failed to migrate legacy queue: %w", err)
+		}
+
+		if job, ok := target(jobID); ok {
+			pipe := r.client.Pipeline()
+			r.engine.push(ctx, pipe, job, front)
+			if _, err := pipe.Exec(ctx); err != nil {
+				return moved, fmt.Errorf("failed to migrate legacy queue: %w", err)
+			}
+			moved++
+		}
+
+		if err := r.client.LRem(ctx, src, 1, jobID).Err(); err != nil {
+			return moved, fmt.Errorf("failed to migrate legacy queue: %w", err)
+		}
+	}
 }
 
 // GetJob retrieves a job by ID
 func (r *RedisQueue) GetJob(ctx context.Context, jobID string) (*types.Job, error) {
 	jobKey := JobKeyPrefix + jobID
 
-	result := r.client.Get(ctx, jobKey)
-	if result.Err() != nil {
-		if result.Err() == redis.Nil {
-			return nil, fmt.Errorf("job not found: %s", jobID)
-		}
-		return nil, fmt.Errorf("failed to get job: %w", result.Err())
+	fields, err := r.client.HGetAll(ctx, jobKey).Result()
+	if err != nil && strings.HasPrefix(err.Error(), "WRONGTYPE") {
+		return r.getLegacyJob(ctx, jobID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get job: %w", err)
 	}
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("%w: %s", storage.ErrJobNotFound, jobID)
+	}
+
+	return r.decodeJob(ctx, fields)
+}
 
-	var job types.Job
-	err := json.Unmarshal([]byte(result.Val()), &job)
+// getLegacyJob reads a job stored as a JSON string by an older version
+func (r *RedisQueue) getLegacyJob(ctx context.Context, jobID string) (*types.Job, error) {
+	data, err := r.client.Get(ctx, JobKeyPrefix+jobID).Bytes()
+	if err == redis.Nil {
+		return nil, fmt.Errorf("%w: %s", storage.ErrJobNotFound, jobID)
+	}
 	if err != nil {
-		return nil, fmt.Errorf("failed to unmarshal job: %w", err)
+		return nil, fmt.Errorf("failed to get job: %w", err)
 	}
 
-	return &job, nil
+	return unmarshalLegacyJob(data)
 }
 
-// UpdateJob updates a job's data in Redis
+// UpdateJob replaces a job's data in Redis. Prefer field-level updates
+// where the caller knows which fields changed.
 func (r *RedisQueue) UpdateJob(ctx context.Context, job *types.Job) error {
-	jobData, err := json.Marshal(job)
-	if err != nil {
-		return fmt.Errorf("failed to marshal job: %w", err)
+	// Deleting first drops fields the job no longer has
+	pipe := r.client.TxPipeline()
+	pipe.Del(ctx, JobKeyPrefix+job.ID)
+	if err := r.setJob(ctx, pipe, job); err != nil {
+		return err
 	}
 
-	jobKey := JobKeyPrefix + job.ID
-	err = r.client.Set(ctx, jobKey, jobData, 24*time.Hour).Err()
-	if err != nil {
+	if _, err := pipe.Exec(ctx); err != nil {
 		return fmt.Errorf("failed to update job: %w", err)
 	}
 
 	return nil
 }
 
-// CompleteJob marks a job as completed and removes it from processing queue
+// CompleteJob marks a job as completed and removes it from processing queue.
+// It returns ErrJobConflict if the job is no longer processing, for example
+// because it was cancelled.
 func (r *RedisQueue) CompleteJob(ctx context.Context, jobID string, result json.RawMessage) error {
-	job, err := r.GetJob(ctx, jobID)
+	sealed, err := r.cipher.Seal(ctx, result)
 	if err != nil {
-		return err
+		return fmt.Errorf("failed to marshal job: %w", err)
 	}
 
 	// Update job status
-	job.Status = types.JobStatusCompleted
-	job.Result = result
 	now := time.Now()
-	job.CompletedAt = &now
-	job.UpdatedAt = now
+	update := jobUpdate{}.
+		set("status", string(types.JobStatusCompleted)).
+		set("result", string(sealed)).
+		setTime("completed_at", &now).
+		setTime("updated_at", &now)
+
+	job, err := r.updateJobFields(ctx, jobID, types.StatusesInto(types.JobStatusCompleted), update)
+	if err != nil {
+		return err
+	}
 
 	// Use pipeline for atomic operations
 	pipe := r.client.Pipeline()
 
-	// Update job
-	jobData, _ := json.Marshal(job)
-	jobKey := JobKeyPrefix + job.ID
-	pipe.Set(ctx, jobKey, jobData, 24*time.Hour)
-
 	// Remove from processing queue
-	pipe.LRem(ctx, ProcessingQueueKey, 1, jobID)
+	if err := r.ack(ctx, pipe, job, false); err != nil {
+		return err
+	}
 
 	// Update stats
-	pipe.HIncrBy(ctx, StatsKey, "processing", -1)
-	pipe.HIncrBy(ctx, StatsKey, "completed", 1)
+	incrStats(ctx, pipe, job, "processing", -1)
+	incrStats(ctx, pipe, job, "completed", 1)
+	recordThroughput(ctx, pipe, job, "processed")
 
 	_, err = pipe.Exec(ctx)
 	return err
 }
 
-// FailJob marks a job as failed
-func (r *RedisQueue) FailJob(ctx context.Context, jobID string, errorMsg string) error {
+// FailJob records a failed attempt, requeueing the job if it has attempts
+// left and the failure isn't permanent. It returns ErrJobConflict if the
+// job already finished.
+func (r *RedisQueue) FailJob(ctx context.Context, jobID string, failure types.Failure) error {
 	job, err := r.GetJob(ctx, jobID)
 	if err != nil {
 		return err
 	}
 
-	job.Attempts++
-	job.Error = errorMsg
-	job.UpdatedAt = time.Now()
+	now := time.Now()
+	attempts := job.Attempts + 1
+	update := jobUpdate{}.
+		set("attempts", strconv.Itoa(attempts)).
+		set("error", failure.Message).
+		set("error_code", string(failure.Code)).
+		setTime("updated_at", &now)
 
 	// Check if we should retry
-	if job.Attempts < job.MaxAttempts {
-		job.Status = types.JobStatusRetrying
-		// Re-queue the job with delay
-		return r.requeueJobWithDelay(ctx, job, calculateRetryDelay(job.Attempts))
+	retry := failure.Retry(attempts, job.MaxAttempts)
+	from, to := job.Status, types.JobStatusFailed
+	if retry {
+		to = types.JobStatusRetrying
+	}
+	if err := job.Transition(to); err != nil {
+		return fmt.Errorf("%w: %w", ErrJobConflict, err)
+	}
+	scheduledAt := now
+	if retry {
+		scheduledAt = now.Add(failure.Delay(job.Type, attempts))
+		update = update.
+			set("status", string(types.JobStatusRetrying)).
+			setTime("scheduled_at", &scheduledAt)
 	} else {
-		job.Status = types.JobStatusFailed
-		now := time.Now()
-		job.CompletedAt = &now
+		update = update.
+			set("status", string(types.JobStatusFailed)).
+			setTime("completed_at", &now)
+	}
+
+	// Only apply the update if no one else finished or failed the job since
+	// it was read
+	job, err = r.updateJobFields(ctx, jobID, []types.JobStatus{from}, update)
+	if err != nil {
+		return err
 	}
 
 	// Use pipeline for atomic operations
 	pipe := r.client.Pipeline()
 
-	// Update job
-	jobData, _ := json.Marshal(job)
-	jobKey := JobKeyPrefix + job.ID
-	pipe.Set(ctx, jobKey, jobData, 24*time.Hour)
-
-	// Remove from processing queue
-	pipe.LRem(ctx, ProcessingQueueKey, 1, jobID)
+	// Put retries back on the pending queue, and remove the job from the
+	// processing queue. A retry with a delay waits it out in the parked
+	// set, and is queued by the first dequeue after it is due. A retry goes
+	// back to the head of its affinity key instead, queued before the ack
+	// so that its worker keeps the key, and waits there (see deferAffinity).
+	if retry {
+		if job.AffinityKey == "" && scheduledAt.After(now) {
+			pipe.ZAdd(ctx, ParkedQueueKey, redis.Z{Score: float64(scheduledAt.UnixMilli()), Member: job.ID})
+		} else {
+			r.push(ctx, pipe, job, job.AffinityKey != "")
+		}
+	}
+	if err := r.ack(ctx, pipe, job, false); err != nil {
+		return err
+	}
 
 	// Update stats
-	pipe.HIncrBy(ctx, StatsKey, "processing", -1)
-	if job.Status == types.JobStatusFailed {
-		pipe.HIncrBy(ctx, StatsKey, "failed", 1)
+	incrStats(ctx, pipe, job, "processing", -1)
+	recordThroughput(ctx, pipe, job, "processed")
+	if retry {
+		incrStats(ctx, pipe, job, "pending", 1)
 	} else {
-		pipe.HIncrBy(ctx, StatsKey, "pending", 1)
+		incrStats(ctx, pipe, job, "failed", 1)
+		incrStats(ctx, pipe, job, failedCodeField(failure.Code), 1)
 	}
 
 	_, err = pipe.Exec(ctx)
 	return err
 }
 
-// GetStats returns job processing statistics
-func (r *RedisQueue) GetStats(ctx context.Context) (*types.JobStats, error) {
-	result := r.client.HGetAll(ctx, StatsKey)
-	if result.Err() != nil {
-		return nil, result.Err()
+// RequeueJob returns a job this worker could not finish to the front of the
+// pending queue without counting it as an attempt
+func (r *RedisQueue) RequeueJob(ctx context.Context, jobID string) error {
+	now := time.Now()
+	update := jobUpdate{}.
+		set("status", string(types.JobStatusPending)).
+		set("worker_id", "").
+		setTime("started_at", nil).
+		setTime("updated_at", &now)
+
+	job, err := r.updateJobFields(ctx, jobID, types.StatusesInto(types.JobStatusPending), update)
+	if err != nil {
+		return err
 	}
 
-	stats := &types.JobStats{}
-	data := result.Val()
+	// Use pipeline for atomic operations
+	pipe := r.client.Pipeline()
 
-	if val, ok := data["total"]; ok {
-		fmt.Sscanf(val, "%d", &stats.Total)
+	// Move from processing back to the end the workers pop from. This
+	// worker is giving the job up, so its affinity key goes to any worker.
+	r.push(ctx, pipe, job, true)
+	if err := r.ack(ctx, pipe, job, true); err != nil {
+		return err
 	}
-	if val, ok := data["pending"]; ok {
-		fmt.Sscanf(val, "%d", &stats.Pending)
+
+	// Update stats
+	incrStats(ctx, pipe, job, "processing", -1)
+	incrStats(ctx, pipe, job, "pending", 1)
+
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// ParkJob puts off a job this worker won't run yet, without counting an
+// attempt. The job is scheduled to run at until, and waits out of its
+// queue until then. Jobs with an affinity key must not be parked, since
+// later jobs of their key would overtake them.
+func (r *RedisQueue) ParkJob(ctx context.Context, jobID string, until time.Time) error {
+	now := time.Now()
+	update := jobUpdate{}.
+		set("status", string(types.JobStatusScheduled)).
+		set("worker_id", "").
+		setTime("started_at", nil).
+		setTime("scheduled_at", &until).
+		setTime("updated_at", &now)
+
+	job, err := r.updateJobFields(ctx, jobID, types.StatusesInto(types.JobStatusScheduled), update)
+	if err != nil {
+		return err
 	}
-	if val, ok := data["processing"]; ok {
-		fmt.Sscanf(val, "%d", &stats.Processing)
+
+	pipe := r.client.Pipeline()
+	pipe.ZAdd(ctx, ParkedQueueKey, redis.Z{Score: float64(until.UnixMilli()), Member: job.ID})
+	if err := r.ack(ctx, pipe, job, true); err != nil {
+		return err
 	}
-	if val, ok := data["completed"]; ok {
-		fmt.Sscanf(val, "%d", &stats.Completed)
+
+	incrStats(ctx, pipe, job, "processing", -1)
+	incrStats(ctx, pipe, job, "scheduled", 1)
+
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// unpark queues parked jobs that are due again, at the front of their
+// queues. Each is queued by the dequeue that removes it from the parked
+// set, so that it is queued once.
+func (r *RedisQueue) unpark(ctx context.Context) error {
+	due, err := r.client.ZRangeByScore(ctx, ParkedQueueKey, &redis.ZRangeBy{
+		Min:   "-inf",
+		Max:   strconv.FormatInt(time.Now().UnixMilli(), 10),
+		Count: unparkBatch,
+	}).Result()
+	if err != nil {
+		return fmt.Errorf("failed to read parked jobs: %w", err)
 	}
-	if val, ok := data["failed"]; ok {
-		fmt.Sscanf(val, "%d", &stats.Failed)
+
+	for _, jobID := range due {
+		removed, err := r.client.ZRem(ctx, ParkedQueueKey, jobID).Result()
+		if err != nil {
+			return fmt.Errorf("failed to unpark job %s: %w", jobID, err)
+		}
+		if removed == 0 {
+			continue // Another dequeue got it
+		}
+
+		job, err := r.GetJob(ctx, jobID)
+		if errors.Is(err, storage.ErrJobNotFound) {
+			continue
+		}
+		if err == nil {
+			pipe := r.client.Pipeline()
+			r.push(ctx, pipe, job, true)
+			_, err = pipe.Exec(ctx)
+		}
+		if err != nil {
+			// Park it again rather than lose it
+			r.client.ZAdd(ctx, ParkedQueueKey, redis.Z{Score: float64(time.Now().UnixMilli()), Member: jobID})
+			return fmt.Errorf("failed to unpark job %s: %w", jobID, err)
+		}
 	}
+	return nil
+}
 
-	return stats, nil
+// CancelJob stops a job for good. A job still waiting is dropped when it
+// reaches the front of its queue; a running job's worker finds out when it
+// tries to finish it. It returns ErrJobConflict if the job already finished.
+func (r *RedisQueue) CancelJob(ctx context.Context, jobID string) error {
+	return r.stop(ctx, jobID, types.JobStatusCancelled)
 }
 
-// requeueJobWithDelay requeues a job after a delay
-func (r *RedisQueue) requeueJobWithDelay(ctx context.Context, job *types.Job, delay time.Duration) error {
-	job.ScheduledAt = time.Now().Add(delay)
+// ExpireJob stops a job that waited past its expiry. It stays queued until
+// it reaches the front of its queue, where it is dropped. It returns
+// ErrJobConflict if the job is no longer waiting.
+func (r *RedisQueue) ExpireJob(ctx context.Context, jobID string) error {
+	return r.stop(ctx, jobID, types.JobStatusExpired)
+}
 
-	jobData, err := json.Marshal(job)
+// stop moves a job to the final status to, cancelled or expired
+func (r *RedisQueue) stop(ctx context.Context, jobID string, to types.JobStatus) error {
+	job, err := r.GetJob(ctx, jobID)
 	if err != nil {
 		return err
 	}
 
-	jobKey := JobKeyPrefix + job.ID
+	from := job.Status
+	if err := job.Transition(to); err != nil {
+		return fmt.Errorf("%w: %w", ErrJobConflict, err)
+	}
+
+	now := time.Now()
+	update := jobUpdate{}.
+		set("status", string(to)).
+		setTime("completed_at", &now).
+		setTime("updated_at", &now)
+
+	job, err = r.updateJobFields(ctx, jobID, []types.JobStatus{from}, update)
+	if err != nil {
+		return err
+	}
 
-	// For now, we'll just put it back in the queue immediately
-	// In a production system, you'd want a delayed job scheduler
 	pipe := r.client.Pipeline()
-	pipe.Set(ctx, jobKey, jobData, 24*time.Hour)
-	pipe.LPush(ctx, JobQueueKey, job.ID)
-	_, err = pipe.Exec(ctx)
+	if from == types.JobStatusProcessing {
+		if err := r.ack(ctx, pipe, job, false); err != nil {
+			return err
+		}
+	}
+	incrStats(ctx, pipe, job, statsField(from), -1)
+	incrStats(ctx, pipe, job, statsField(to), 1)
 
+	_, err = pipe.Exec(ctx)
 	return err
 }
 
-// calculateRetryDelay calculates exponential backoff delay
-func calculateRetryDelay(attempts int) time.Duration {
-	base := time.Second * 5                            // 5 seconds base delay
-	delay := base * time.Duration(1<<uint(attempts-1)) // 2^(attempts-1)
+// UpdateProgress records the progress of a running job. It returns
+// ErrJobConflict if the job is no longer processing.
+func (r *RedisQueue) UpdateProgress(ctx context.Context, jobID string, progress *types.JobProgress) error {
+	data, err := r.encodeValue(progress)
+	if err != nil {
+		return fmt.Errorf("failed to marshal job progress: %w", err)
+	}
+
+	// Moving updated_at changes the job's ETag, which clients poll on
+	now := time.Now()
+	update := jobUpdate{}.set("progress", data).setTime("updated_at", &now)
+	_, err = r.updateJobFields(ctx, jobID, []types.JobStatus{types.JobStatusProcessing}, update)
+	return err
+}
 
-	// Cap at 5 minutes
-	if delay > 5*time.Minute {
-		delay = 5 * time.Minute
+// SaveCheckpoint stores a running job's checkpoint, which later attempts
+// receive with the job. It returns ErrJobConflict if the job is no longer
+// processing.
+func (r *RedisQueue) SaveCheckpoint(ctx context.Context, jobID string, checkpoint json.RawMessage) error {
+	sealed, err := r.cipher.Seal(ctx, checkpoint)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt job checkpoint: %w", err)
 	}
 
-	return delay
+	now := time.Now()
+	update := jobUpdate{}.set("checkpoint", string(sealed)).setTime("updated_at", &now)
+	_, err = r.updateJobFields(ctx, jobID, []types.JobStatus{types.JobStatusProcessing}, update)
+	return err
+}
+
+// Heartbeat tells the queue that workerID is still running a job, so that
+// engines which reclaim idle jobs leave it alone
+func (r *RedisQueue) Heartbeat(ctx context.Context, workerID, jobID string) error {
+	if err := r.renewAffinity(ctx, workerID); err != nil {
+		return err
+	}
+	return r.engine.touch(ctx, workerID, jobID)
 }
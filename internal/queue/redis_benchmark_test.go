@@ -3,23 +3,16 @@ package queue
 import (
 	"context"
 	"encoding/json"
+	"taskflow/internal/testutil"
 	"taskflow/internal/types"
 	"testing"
 	"time"
-
-	"github.com/redis/go-redis/v9"
 )
 
 // BenchmarkConcurrentEnqueue tests concurrent job enqueueing
 func BenchmarkConcurrentEnqueue(b *testing.B) {
-	client := redis.NewClient(&redis.Options{
-		Addr: "localhost:6379",
-		DB:   1,
-	})
-	defer client.Close()
-
-	client.FlushDB(context.Background())
-	queue := &RedisQueue{client: client}
+	client := testutil.Redis(b)
+	queue := &RedisQueue{client: client, engine: &listEngine{client: client}}
 	ctx := context.Background()
 
 	payload := types.WebhookPayload{
@@ -52,13 +45,8 @@ func BenchmarkConcurrentEnqueue(b *testing.B) {
 
 // BenchmarkGetStats tests statistics retrieval performance
 func BenchmarkGetStats(b *testing.B) {
-	client := redis.NewClient(&redis.Options{
-		Addr: "localhost:6379",
-		DB:   1,
-	})
-	defer client.Close()
-
-	queue := &RedisQueue{client: client}
+	client := testutil.Redis(b)
+	queue := &RedisQueue{client: client, engine: &listEngine{client: client}}
 	ctx := context.Background()
 
 	// Pre-populate some stats
@@ -72,7 +60,7 @@ func BenchmarkGetStats(b *testing.B) {
 
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		_, err := queue.GetStats(ctx)
+		_, err := queue.GetStats(ctx, "")
 		if err != nil {
 			b.Fatalf("Failed to get stats: %v", err)
 		}
@@ -81,17 +69,8 @@ func BenchmarkGetStats(b *testing.B) {
 
 // BenchmarkEnqueueJob tests job enqueueing performance
 func BenchmarkEnqueueJob(b *testing.B) {
-	// Setup Redis client for benchmarking
-	client := redis.NewClient(&redis.Options{
-		Addr: "localhost:6379",
-		DB:   1, // Use different DB for benchmarks
-	})
-	defer client.Close()
-
-	// Clear test data
-	client.FlushDB(context.Background())
-
-	queue := &RedisQueue{client: client}
+	client := testutil.Redis(b)
+	queue := &RedisQueue{client: client, engine: &listEngine{client: client}}
 	ctx := context.Background()
 
 	// Create test job
@@ -123,16 +102,48 @@ func BenchmarkEnqueueJob(b *testing.B) {
 	})
 }
 
+// BenchmarkEnqueueJobs tests enqueueing jobs in batches of 100, for
+// comparison with BenchmarkEnqueueJob
+func BenchmarkEnqueueJobs(b *testing.B) {
+	client := testutil.Redis(b)
+	queue := &RedisQueue{client: client, engine: &listEngine{client: client}}
+	ctx := context.Background()
+
+	payload := types.EmailPayload{
+		To:      "benchmark@example.com",
+		Subject: "Benchmark Test",
+		Body:    "This is a benchmark test email",
+	}
+	payloadJSON, _ := json.Marshal(payload)
+
+	const batch = 100
+	jobs := make([]*types.Job, batch)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i += batch {
+		for j := range jobs {
+			jobs[j] = &types.Job{
+				ID:          types.GenerateJobID(),
+				Type:        types.JobTypeEmail,
+				Payload:     payloadJSON,
+				Status:      types.JobStatusPending,
+				MaxAttempts: 3,
+				CreatedAt:   time.Now(),
+				UpdatedAt:   time.Now(),
+				ScheduledAt: time.Now(),
+			}
+		}
+
+		if err := queue.EnqueueJobs(ctx, jobs); err != nil {
+			b.Fatalf("Failed to enqueue jobs: %v", err)
+		}
+	}
+}
+
 // BenchmarkDequeueJob tests job dequeueing performance
 func BenchmarkDequeueJob(b *testing.B) {
-	client := redis.NewClient(&redis.Options{
-		Addr: "localhost:6379",
-		DB:   1,
-	})
-	defer client.Close()
-
-	client.FlushDB(context.Background())
-	queue := &RedisQueue{client: client}
+	client := testutil.Redis(b)
+	queue := &RedisQueue{client: client, engine: &listEngine{client: client}}
 	ctx := context.Background()
 
 	// Pre-populate queue with jobs
@@ -160,7 +171,7 @@ func BenchmarkDequeueJob(b *testing.B) {
 	b.ResetTimer()
 	b.RunParallel(func(pb *testing.PB) {
 		for pb.Next() {
-			job, err := queue.DequeueJob(ctx, "bench-worker", 1*time.Second)
+			job, err := queue.DequeueJob(ctx, "bench-worker", []types.JobType{types.JobTypeEmail}, 1*time.Second)
 			if err != nil {
 				b.Fatalf("Failed to dequeue job: %v", err)
 			}
@@ -173,14 +184,8 @@ func BenchmarkDequeueJob(b *testing.B) {
 
 // BenchmarkJobProcessingCycle tests complete job lifecycle
 func BenchmarkJobProcessingCycle(b *testing.B) {
-	client := redis.NewClient(&redis.Options{
-		Addr: "localhost:6379",
-		DB:   1,
-	})
-	defer client.Close()
-
-	client.FlushDB(context.Background())
-	queue := &RedisQueue{client: client}
+	client := testutil.Redis(b)
+	queue := &RedisQueue{client: client, engine: &listEngine{client: client}}
 	ctx := context.Background()
 
 	payload := types.EmailPayload{
@@ -216,7 +221,7 @@ func BenchmarkJobProcessingCycle(b *testing.B) {
 		}
 
 		// Dequeue
-		dequeuedJob, err := queue.DequeueJob(ctx, "bench-worker", 1*time.Second)
+		dequeuedJob, err := queue.DequeueJob(ctx, "bench-worker", []types.JobType{types.JobTypeEmail}, 1*time.Second)
 		if err != nil {
 			b.Fatalf("Failed to dequeue job: %v", err)
 		}
@@ -229,3 +234,66 @@ func BenchmarkJobProcessingCycle(b *testing.B) {
 }
 
 //
+
+// BenchmarkUpdateJobWhole measures rewriting every field of a job, as the
+// JSON representation required for any change
+func BenchmarkUpdateJobWhole(b *testing.B) {
+	queue, job := setupUpdateBenchmark(b)
+	ctx := context.Background()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		job.UpdatedAt = time.Now()
+		if err := queue.UpdateJob(ctx, job); err != nil {
+			b.Fatalf("Failed to update job: %v", err)
+		}
+	}
+}
+
+// BenchmarkUpdateJobFields measures a guarded update of the fields that
+// change when a job's status moves
+func BenchmarkUpdateJobFields(b *testing.B) {
+	queue, job := setupUpdateBenchmark(b)
+	ctx := context.Background()
+	statuses := []types.JobStatus{types.JobStatusPending}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		now := time.Now()
+		update := jobUpdate{}.
+			set("status", string(types.JobStatusPending)).
+			setTime("updated_at", &now)
+		if _, err := queue.updateJobFields(ctx, job.ID, statuses, update); err != nil {
+			b.Fatalf("Failed to update job: %v", err)
+		}
+	}
+}
+
+// setupUpdateBenchmark enqueues a job with a realistic payload to update
+func setupUpdateBenchmark(b *testing.B) (*RedisQueue, *types.Job) {
+	client := testutil.Redis(b)
+	queue := &RedisQueue{client: client, engine: &listEngine{client: client}}
+
+	payload := types.WebhookPayload{
+		URL:    "https://httpbin.org/post",
+		Method: "POST",
+		Data:   map[string]interface{}{"test": "data", "items": make([]int, 200)},
+	}
+	payloadJSON, _ := json.Marshal(payload)
+
+	job := &types.Job{
+		ID:          types.GenerateJobID(),
+		Type:        types.JobTypeWebhook,
+		Payload:     payloadJSON,
+		Status:      types.JobStatusPending,
+		MaxAttempts: 3,
+		CreatedAt:   time.Now(),
+		UpdatedAt:   time.Now(),
+		ScheduledAt: time.Now(),
+	}
+	if err := queue.EnqueueJob(context.Background(), job); err != nil {
+		b.Fatalf("Failed to enqueue job: %v", err)
+	}
+
+	return queue, job
+}
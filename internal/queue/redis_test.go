@@ -0,0 +1,373 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"taskflow/internal/testutil"
+	"taskflow/internal/types"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func TestMain(m *testing.M) {
+	os.Exit(testutil.Run(m))
+}
+
+// testEngines builds each queue engine on a test Redis client
+var testEngines = map[string]func(client redis.UniversalClient) engine{
+	EngineList:   func(client redis.UniversalClient) engine { return &listEngine{client: client} },
+	EngineStream: func(client redis.UniversalClient) engine { return newStreamEngine(client, time.Minute) },
+}
+
+// forEachEngine runs test as a subtest for each queue engine, with a queue
+// on an empty test Redis
+func forEachEngine(t *testing.T, test func(t *testing.T, q *RedisQueue)) {
+	for name, newEngine := range testEngines {
+		t.Run(name, func(t *testing.T) {
+			client := testutil.Redis(t)
+			test(t, &RedisQueue{client: client, engine: newEngine(client)})
+		})
+	}
+}
+
+func newTestJob(jobType types.JobType) *types.Job {
+	return types.NewJob(&types.JobRequest{
+		Type:    jobType,
+		Payload: json.RawMessage(`{"to": "user@example.com", "subject": "Hi", "body": "Hello"}`),
+	})
+}
+
+func TestRedisQueueLifecycle(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, q *RedisQueue) {
+		ctx := context.Background()
+
+		job := newTestJob(types.JobTypeEmail)
+		if err := q.EnqueueJob(ctx, job); err != nil {
+			t.Fatalf("EnqueueJob: %v", err)
+		}
+
+		claimed, err := q.DequeueJob(ctx, "worker-1", []types.JobType{types.JobTypeEmail}, time.Second)
+		if err != nil || claimed == nil {
+			t.Fatalf("DequeueJob = %v, %v; want the job", claimed, err)
+		}
+		if claimed.ID != job.ID || claimed.Status != types.JobStatusProcessing || claimed.WorkerID != "worker-1" {
+			t.Errorf("claimed job = %+v, want %s processing on worker-1", claimed, job.ID)
+		}
+
+		if err := q.CompleteJob(ctx, job.ID, nil); err != nil {
+			t.Fatalf("CompleteJob: %v", err)
+		}
+		if err := q.CompleteJob(ctx, job.ID, nil); !errors.Is(err, ErrJobConflict) {
+			t.Errorf("CompleteJob twice = %v, want ErrJobConflict", err)
+		}
+
+		stats, err := q.GetStats(ctx, "")
+		if err != nil {
+			t.Fatalf("GetStats: %v", err)
+		}
+		if stats.Total != 1 || stats.Completed != 1 || stats.Pending != 0 || stats.Processing != 0 {
+			t.Errorf("stats = %+v, want 1 completed job", stats)
+		}
+
+		if next, err := q.DequeueJob(ctx, "worker-1", []types.JobType{types.JobTypeEmail}, 100*time.Millisecond); err != nil || next != nil {
+			t.Errorf("DequeueJob of an empty queue = %v, %v; want nothing", next, err)
+		}
+	})
+}
+
+// setRetryPolicy gives failed jobs of every type policy's backoff until t
+// finishes
+func setRetryPolicy(t *testing.T, policy types.RetryPolicy) {
+	t.Helper()
+	if err := types.DefaultJobTypes.Set(types.JobTypeConfigs{Default: types.JobTypeConfig{Retry: policy}}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { types.DefaultJobTypes.Set(types.JobTypeConfigs{}) })
+}
+
+func TestRedisQueueFailJob(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, q *RedisQueue) {
+		ctx := context.Background()
+		delay := types.Duration(200 * time.Millisecond)
+		setRetryPolicy(t, types.RetryPolicy{BaseDelay: delay, MaxDelay: delay})
+
+		job := newTestJob(types.JobTypeEmail)
+		job.MaxAttempts = 2
+		if err := q.EnqueueJob(ctx, job); err != nil {
+			t.Fatalf("EnqueueJob: %v", err)
+		}
+
+		failure := types.Failure{Message: "smtp unavailable", Code: types.ErrorCodeTimeout}
+		for attempt := 1; attempt <= 2; attempt++ {
+			if claimed, err := q.DequeueJob(ctx, "worker-1", []types.JobType{types.JobTypeEmail}, time.Second); err != nil || claimed == nil {
+				t.Fatalf("DequeueJob = %v, %v; want the job", claimed, err)
+			}
+			if err := q.FailJob(ctx, job.ID, failure); err != nil {
+				t.Fatalf("FailJob: %v", err)
+			}
+		}
+
+		failed, err := q.GetJob(ctx, job.ID)
+		if err != nil {
+			t.Fatalf("GetJob: %v", err)
+		}
+		if failed.Status != types.JobStatusFailed || failed.Attempts != 2 || failed.ErrorCode != types.ErrorCodeTimeout {
+			t.Errorf("job = %s after %d attempts with code %s, want failed after 2 with TIMEOUT", failed.Status, failed.Attempts, failed.ErrorCode)
+		}
+
+		stats, err := q.GetStats(ctx, "")
+		if err != nil {
+			t.Fatalf("GetStats: %v", err)
+		}
+		if stats.Failed != 1 || stats.FailedByCode[types.ErrorCodeTimeout] != 1 {
+			t.Errorf("stats = %+v, want 1 failed job with TIMEOUT", stats)
+		}
+	})
+}
+
+// TestRedisQueueRetryDelay checks that a failed job isn't claimed again
+// before its retry is due, with and without an affinity key
+func TestRedisQueueRetryDelay(t *testing.T) {
+	for name, key := range map[string]string{"plain": "", "affinity": "customer-42"} {
+		t.Run(name, func(t *testing.T) {
+			forEachEngine(t, func(t *testing.T, q *RedisQueue) {
+				ctx := context.Background()
+				jobTypes := []types.JobType{types.JobTypeWebhook}
+
+				job := newTestJob(types.JobTypeWebhook)
+				job.AffinityKey = key
+				if err := q.EnqueueJob(ctx, job); err != nil {
+					t.Fatalf("EnqueueJob: %v", err)
+				}
+				if claimed, err := q.DequeueJob(ctx, "worker-1", jobTypes, time.Second); err != nil || claimed == nil {
+					t.Fatalf("DequeueJob = %v, %v; want the job", claimed, err)
+				}
+
+				failure := types.Failure{Message: "rate limited", Code: types.ErrorCodeRateLimited, RetryAfter: 500 * time.Millisecond}
+				if err := q.FailJob(ctx, job.ID, failure); err != nil {
+					t.Fatalf("FailJob: %v", err)
+				}
+				retrying, err := q.GetJob(ctx, job.ID)
+				if err != nil {
+					t.Fatalf("GetJob: %v", err)
+				}
+				if retrying.Status != types.JobStatusRetrying || !retrying.ScheduledAt.After(time.Now()) {
+					t.Fatalf("failed job = %s scheduled at %v, want retrying later", retrying.Status, retrying.ScheduledAt)
+				}
+
+				for _, worker := range []string{"worker-1", "worker-2"} {
+					if next, err := q.DequeueJob(ctx, worker, jobTypes, 100*time.Millisecond); err != nil || next != nil {
+						t.Fatalf("DequeueJob by %s before the retry is due = %v, %v; want nothing", worker, next, err)
+					}
+				}
+
+				time.Sleep(time.Until(retrying.ScheduledAt))
+				next, err := q.DequeueJob(ctx, "worker-1", jobTypes, time.Second)
+				if err != nil || next == nil || next.ID != job.ID {
+					t.Fatalf("DequeueJob once the retry is due = %v, %v; want the job", next, err)
+				}
+			})
+		})
+	}
+}
+
+// TestRedisQueueRetryJitter checks that a retry with full jitter waits
+// until its randomized scheduled_at, and no longer than the backoff
+func TestRedisQueueRetryJitter(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, q *RedisQueue) {
+		ctx := context.Background()
+		jobTypes := []types.JobType{types.JobTypeWebhook}
+		delay := types.Duration(time.Second)
+		setRetryPolicy(t, types.RetryPolicy{BaseDelay: delay, MaxDelay: delay, Jitter: types.JitterFull})
+
+		job := newTestJob(types.JobTypeWebhook)
+		if err := q.EnqueueJob(ctx, job); err != nil {
+			t.Fatalf("EnqueueJob: %v", err)
+		}
+		if claimed, err := q.DequeueJob(ctx, "worker-1", jobTypes, time.Second); err != nil || claimed == nil {
+			t.Fatalf("DequeueJob = %v, %v; want the job", claimed, err)
+		}
+		failed := time.Now()
+		if err := q.FailJob(ctx, job.ID, types.Failure{Message: "connection reset", Code: types.ErrorCodeDownstream5xx}); err != nil {
+			t.Fatalf("FailJob: %v", err)
+		}
+		retrying, err := q.GetJob(ctx, job.ID)
+		if err != nil {
+			t.Fatalf("GetJob: %v", err)
+		}
+		if wait := retrying.ScheduledAt.Sub(failed); wait > time.Duration(delay) {
+			t.Fatalf("retry scheduled %v after the failure, want at most %v", wait, delay)
+		}
+
+		// Retries are due to the millisecond
+		due := retrying.ScheduledAt.Truncate(time.Millisecond)
+		for {
+			next, err := q.DequeueJob(ctx, "worker-1", jobTypes, 50*time.Millisecond)
+			if err != nil {
+				t.Fatalf("DequeueJob: %v", err)
+			}
+			if next == nil {
+				if time.Now().After(due.Add(time.Second)) {
+					t.Fatalf("retry due at %v wasn't claimed", due)
+				}
+				continue
+			}
+			if claimed := time.Now(); claimed.Before(due) {
+				t.Errorf("retry claimed at %v, before it was due at %v", claimed, due)
+			}
+			break
+		}
+	})
+}
+
+func TestRedisQueueParkJob(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, q *RedisQueue) {
+		ctx := context.Background()
+		jobTypes := []types.JobType{types.JobTypeWebhook}
+
+		job := newTestJob(types.JobTypeWebhook)
+		if err := q.EnqueueJob(ctx, job); err != nil {
+			t.Fatalf("EnqueueJob: %v", err)
+		}
+		if _, err := q.DequeueJob(ctx, "worker-1", jobTypes, time.Second); err != nil {
+			t.Fatalf("DequeueJob: %v", err)
+		}
+
+		until := time.Now().Add(500 * time.Millisecond)
+		if err := q.ParkJob(ctx, job.ID, until); err != nil {
+			t.Fatalf("ParkJob: %v", err)
+		}
+		parked, err := q.GetJob(ctx, job.ID)
+		if err != nil {
+			t.Fatalf("GetJob: %v", err)
+		}
+		if parked.Status != types.JobStatusScheduled || parked.Attempts != 0 || parked.WorkerID != "" {
+			t.Errorf("parked job = %+v, want scheduled without an attempt or worker", parked)
+		}
+
+		if next, err := q.DequeueJob(ctx, "worker-1", jobTypes, 100*time.Millisecond); err != nil || next != nil {
+			t.Fatalf("DequeueJob before the job is due = %v, %v; want nothing", next, err)
+		}
+
+		time.Sleep(time.Until(until))
+		next, err := q.DequeueJob(ctx, "worker-1", jobTypes, time.Second)
+		if err != nil || next == nil || next.ID != job.ID {
+			t.Fatalf("DequeueJob once the job is due = %v, %v; want the job", next, err)
+		}
+	})
+}
+
+// TestRedisQueueScheduledJob checks that a job submitted with a future
+// scheduled_at isn't claimed before it is due
+func TestRedisQueueScheduledJob(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, q *RedisQueue) {
+		ctx := context.Background()
+		jobTypes := []types.JobType{types.JobTypeEmail}
+
+		due := time.Now().Add(500 * time.Millisecond)
+		job := types.NewJob(&types.JobRequest{
+			Type:        types.JobTypeEmail,
+			Payload:     json.RawMessage(`{"to": "user@example.com", "subject": "Hi", "body": "Hello"}`),
+			ScheduledAt: &due,
+		})
+		if err := q.EnqueueJob(ctx, job); err != nil {
+			t.Fatalf("EnqueueJob: %v", err)
+		}
+
+		if next, err := q.DequeueJob(ctx, "worker-1", jobTypes, 100*time.Millisecond); err != nil || next != nil {
+			t.Fatalf("DequeueJob before the job is due = %v, %v; want nothing", next, err)
+		}
+		stats, err := q.GetStats(ctx, "")
+		if err != nil {
+			t.Fatalf("GetStats: %v", err)
+		}
+		if stats.Scheduled != 1 || stats.Pending != 0 {
+			t.Errorf("stats = %+v, want 1 scheduled job", stats)
+		}
+
+		time.Sleep(time.Until(due))
+		next, err := q.DequeueJob(ctx, "worker-1", jobTypes, time.Second)
+		if err != nil || next == nil || next.ID != job.ID {
+			t.Fatalf("DequeueJob once the job is due = %v, %v; want the job", next, err)
+		}
+		if stats, err = q.GetStats(ctx, ""); err != nil {
+			t.Fatalf("GetStats: %v", err)
+		}
+		if stats.Scheduled != 0 || stats.Processing != 1 {
+			t.Errorf("stats after the claim = %+v, want 1 processing job", stats)
+		}
+	})
+}
+
+func TestRedisQueueAffinity(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, q *RedisQueue) {
+		ctx := context.Background()
+		jobTypes := []types.JobType{types.JobTypeEmail}
+
+		first, second := newTestJob(types.JobTypeEmail), newTestJob(types.JobTypeEmail)
+		first.AffinityKey, second.AffinityKey = "tenant-a", "tenant-a"
+		if err := q.EnqueueJobs(ctx, []*types.Job{first, second}); err != nil {
+			t.Fatalf("EnqueueJobs: %v", err)
+		}
+
+		claimed, err := q.DequeueJob(ctx, "worker-1", jobTypes, time.Second)
+		if err != nil || claimed == nil || claimed.ID != first.ID {
+			t.Fatalf("DequeueJob = %v, %v; want the first job of the key", claimed, err)
+		}
+
+		// The key is leased to worker-1 until its job finishes
+		if other, err := q.DequeueJob(ctx, "worker-2", jobTypes, 100*time.Millisecond); err != nil || other != nil {
+			t.Fatalf("DequeueJob by another worker = %v, %v; want nothing", other, err)
+		}
+
+		if err := q.CompleteJob(ctx, first.ID, nil); err != nil {
+			t.Fatalf("CompleteJob: %v", err)
+		}
+		claimed, err = q.DequeueJob(ctx, "worker-1", jobTypes, time.Second)
+		if err != nil || claimed == nil || claimed.ID != second.ID {
+			t.Fatalf("DequeueJob after the first job = %v, %v; want the second job", claimed, err)
+		}
+	})
+}
+
+// TestRedisQueueProgressMovesUpdatedAt checks that progress and checkpoints
+// change a job's updated_at, which its ETag is built from
+func TestRedisQueueProgressMovesUpdatedAt(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, q *RedisQueue) {
+		ctx := context.Background()
+
+		job := newTestJob(types.JobTypeEmail)
+		if err := q.EnqueueJob(ctx, job); err != nil {
+			t.Fatalf("EnqueueJob: %v", err)
+		}
+		claimed, err := q.DequeueJob(ctx, "worker-1", []types.JobType{types.JobTypeEmail}, time.Second)
+		if err != nil || claimed == nil {
+			t.Fatalf("DequeueJob = %v, %v; want the job", claimed, err)
+		}
+
+		last := claimed.UpdatedAt
+		writes := map[string]func() error{
+			"UpdateProgress": func() error {
+				return q.UpdateProgress(ctx, job.ID, &types.JobProgress{Percent: 50, Message: "halfway"})
+			},
+			"SaveCheckpoint": func() error { return q.SaveCheckpoint(ctx, job.ID, json.RawMessage(`{"row": 500}`)) },
+		}
+		for name, write := range writes {
+			if err := write(); err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+			updated, err := q.GetJob(ctx, job.ID)
+			if err != nil {
+				t.Fatalf("GetJob: %v", err)
+			}
+			if !updated.UpdatedAt.After(last) {
+				t.Errorf("%s left updated_at at %v", name, updated.UpdatedAt)
+			}
+			last = updated.UpdatedAt
+		}
+	})
+}
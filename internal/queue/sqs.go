@@ -0,0 +1,822 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"sync"
+	"taskflow/internal/storage"
+	"taskflow/internal/types"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	sqstypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+)
+
+// SQS limits
+const (
+	sqsMaxWait       = 20 * time.Second
+	sqsMaxVisibility = 12 * time.Hour
+)
+
+// SQSConfig describes the SQS queues used by SQSQueue
+type SQSConfig struct {
+	QueuePrefix string // each job type is queued on <QueuePrefix><type>
+	Region      string // default: from the AWS environment
+	Endpoint    string // custom endpoint, e.g. LocalStack
+
+	// VisibilityTimeout is how long a received job stays hidden from other
+	// workers. A job whose worker disappears is delivered again after it.
+	VisibilityTimeout time.Duration
+}
+
+// SQSQueue queues jobs on AWS SQS, one standard queue per job type, and
+// keeps job state in PostgreSQL instead of Redis. Messages carry only the
+// job ID. Claims, completions and failures are conditional updates on the
+// job's row, so duplicate deliveries can't run a job twice at once.
+//
+// A received message stays in flight until the job finishes: it is deleted
+// on completion or final failure, and made visible again after the retry
+// delay when the job fails with attempts left. Receipt handles are held in
+// memory, so a job must be finished by the worker process that claimed it;
+// if that process disappears, SQS delivers the job again once the
+// visibility timeout passes.
+//
+// Without Redis, stats are whatever the last reconciliation stored, and
+// worker commands are stored in PostgreSQL and picked up on the next
+// heartbeat.
+type SQSQueue struct {
+	client            *sqs.Client
+	storage           *storage.PostgresStorage
+	prefix            string
+	visibilityTimeout time.Duration
+
+	mu       sync.Mutex
+	urls     map[types.JobType]string
+	inflight map[string]sqsReceipt // job ID to the message holding it
+	stats    map[string]*types.JobStats
+}
+
+// sqsReceipt identifies a received message
+type sqsReceipt struct {
+	queueURL string
+	handle   string
+}
+
+// NewSQSQueue creates a queue using the default AWS credential chain
+func NewSQSQueue(ctx context.Context, cfg SQSConfig, store *storage.PostgresStorage) (*SQSQueue, error) {
+	if store == nil {
+		return nil, fmt.Errorf("sqs queue requires PostgreSQL storage")
+	}
+
+	var opts []func(*awsconfig.LoadOptions) error
+	if cfg.Region != "" {
+		opts = append(opts, awsconfig.WithRegion(cfg.Region))
+	}
+
+	awsCfg, err := awsconfig.LoadDefaultConfig(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS config: %w", err)
+	}
+
+	client := sqs.NewFromConfig(awsCfg, func(o *sqs.Options) {
+		if cfg.Endpoint != "" {
+			o.BaseEndpoint = aws.String(cfg.Endpoint)
+		}
+	})
+
+	visibility := cfg.VisibilityTimeout
+	if visibility <= 0 {
+		visibility = 30 * time.Minute
+	}
+	if visibility > sqsMaxVisibility {
+		visibility = sqsMaxVisibility
+	}
+
+	return &SQSQueue{
+		client:            client,
+		storage:           store,
+		prefix:            cfg.QueuePrefix,
+		visibilityTimeout: visibility,
+		urls:              make(map[types.JobType]string),
+		inflight:          make(map[string]sqsReceipt),
+		stats:             make(map[string]*types.JobStats),
+	}, nil
+}
+
+// Close releases nothing; the storage is closed by its owner
+func (q *SQSQueue) Close() error {
+	return nil
+}
+
+// Ping checks that SQS is reachable with the configured credentials
+func (q *SQSQueue) Ping(ctx context.Context) error {
+	_, err := q.client.ListQueues(ctx, &sqs.ListQueuesInput{
+		QueueNamePrefix: aws.String(q.prefix),
+		MaxResults:      aws.Int32(1),
+	})
+	return err
+}
+
+// MigrateLegacyQueue has nothing to migrate; legacy queues are Redis lists
+func (q *SQSQueue) MigrateLegacyQueue(ctx context.Context, jobTypes []types.JobType) (int, error) {
+	return 0, nil
+}
+
+// QueueName returns the SQS queue holding jobs of a type
+func (q *SQSQueue) QueueName(jobType types.JobType) string {
+	return q.prefix + string(jobType)
+}
+
+// queueURL resolves a job type's queue, creating the queue if needed
+func (q *SQSQueue) queueURL(ctx context.Context, jobType types.JobType) (string, error) {
+	q.mu.Lock()
+	url, ok := q.urls[jobType]
+	q.mu.Unlock()
+	if ok {
+		return url, nil
+	}
+
+	name := aws.String(q.QueueName(jobType))
+	out, err := q.client.GetQueueUrl(ctx, &sqs.GetQueueUrlInput{QueueName: name})
+	var missing *sqstypes.QueueDoesNotExist
+	if errors.As(err, &missing) {
+		created, createErr := q.client.CreateQueue(ctx, &sqs.CreateQueueInput{QueueName: name})
+		if createErr != nil {
+			return "", fmt.Errorf("failed to create queue %s: %w", *name, createErr)
+		}
+		url = aws.ToString(created.QueueUrl)
+	} else if err != nil {
+		return "", fmt.Errorf("failed to resolve queue %s: %w", *name, err)
+	} else {
+		url = aws.ToString(out.QueueUrl)
+	}
+
+	q.mu.Lock()
+	q.urls[jobType] = url
+	q.mu.Unlock()
+	return url, nil
+}
+
+// EnqueueJob sends the job's ID to its type's queue. SQS standard queues
+// don't order messages, so priority and affinity keys are ignored.
+func (q *SQSQueue) EnqueueJob(ctx context.Context, job *types.Job) error {
+	url, err := q.queueURL(ctx, job.Type)
+	if err != nil {
+		return err
+	}
+
+	_, err = q.client.SendMessage(ctx, &sqs.SendMessageInput{
+		QueueUrl:    aws.String(url),
+		MessageBody: aws.String(job.ID),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to enqueue job: %w", err)
+	}
+	return nil
+}
+
+// sqsMaxBatch is the most messages one SendMessageBatch call takes
+const sqsMaxBatch = 10
+
+// EnqueueJobs sends the jobs' IDs to their types' queues, up to ten
+// messages per request. If it fails, jobs of earlier requests stay queued.
+func (q *SQSQueue) EnqueueJobs(ctx context.Context, jobs []*types.Job) error {
+	byURL := make(map[string][]*types.Job)
+	var urls []string
+	for _, job := range jobs {
+		url, err := q.queueURL(ctx, job.Type)
+		if err != nil {
+			return err
+		}
+		if _, ok := byURL[url]; !ok {
+			urls = append(urls, url)
+		}
+		byURL[url] = append(byURL[url], job)
+	}
+
+	for _, url := range urls {
+		queued := byURL[url]
+		for start := 0; start < len(queued); start += sqsMaxBatch {
+			end := min(start+sqsMaxBatch, len(queued))
+
+			entries := make([]sqstypes.SendMessageBatchRequestEntry, 0, end-start)
+			for i, job := range queued[start:end] {
+				entries = append(entries, sqstypes.SendMessageBatchRequestEntry{
+					Id:          aws.String(strconv.Itoa(i)),
+					MessageBody: aws.String(job.ID),
+				})
+			}
+
+			out, err := q.client.SendMessageBatch(ctx, &sqs.SendMessageBatchInput{
+				QueueUrl: aws.String(url),
+				Entries:  entries,
+			})
+			if err != nil {
+				return fmt.Errorf("failed to enqueue jobs: %w", err)
+			}
+			if len(out.Failed) > 0 {
+				failed := out.Failed[0]
+				return fmt.Errorf("failed to enqueue %d jobs: %s", len(out.Failed), aws.ToString(failed.Message))
+			}
+		}
+	}
+	return nil
+}
+
+// DequeueJob receives a job of one of the given types, waiting up to
+// timeout (at most 20 seconds) for one to be available
+func (q *SQSQueue) DequeueJob(ctx context.Context, workerID string, jobTypes []types.JobType, timeout time.Duration) (*types.Job, error) {
+	if len(jobTypes) == 0 {
+		return nil, fmt.Errorf("no job types to dequeue")
+	}
+
+	// Start at a random type so no type is always served last
+	urls := make([]string, len(jobTypes))
+	start := rand.Intn(len(jobTypes))
+	for i := range jobTypes {
+		url, err := q.queueURL(ctx, jobTypes[(start+i)%len(jobTypes)])
+		if err != nil {
+			return nil, err
+		}
+		urls[i] = url
+	}
+
+	// Take a job from the first queue that has one
+	if len(urls) > 1 {
+		for _, url := range urls {
+			msg, err := q.receive(ctx, url, 0)
+			if err != nil {
+				return nil, err
+			}
+			if msg != nil {
+				return q.claim(ctx, workerID, url, msg)
+			}
+		}
+	}
+
+	// Nothing waiting: long-poll one queue
+	msg, err := q.receive(ctx, urls[0], timeout)
+	if err != nil || msg == nil {
+		return nil, err
+	}
+	return q.claim(ctx, workerID, urls[0], msg)
+}
+
+// receive takes up to one message from a queue, waiting up to wait
+func (q *SQSQueue) receive(ctx context.Context, url string, wait time.Duration) (*sqstypes.Message, error) {
+	if wait > sqsMaxWait {
+		wait = sqsMaxWait
+	}
+
+	out, err := q.client.ReceiveMessage(ctx, &sqs.ReceiveMessageInput{
+		QueueUrl:            aws.String(url),
+		MaxNumberOfMessages: 1,
+		WaitTimeSeconds:     int32(wait / time.Second),
+		VisibilityTimeout:   int32(q.visibilityTimeout / time.Second),
+		MessageSystemAttributeNames: []sqstypes.MessageSystemAttributeName{
+			sqstypes.MessageSystemAttributeNameApproximateReceiveCount,
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to dequeue job: %w", err)
+	}
+	if len(out.Messages) == 0 {
+		return nil, nil
+	}
+	return &out.Messages[0], nil
+}
+
+// claim assigns a received job to workerID. A message delivered more than
+// once may take over a job still marked processing, because its previous
+// worker let the visibility timeout pass.
+func (q *SQSQueue) claim(ctx context.Context, workerID, url string, msg *sqstypes.Message) (*types.Job, error) {
+	receipt := sqsReceipt{queueURL: url, handle: aws.ToString(msg.ReceiptHandle)}
+	jobID := aws.ToString(msg.Body)
+
+	job, err := q.storage.GetJob(ctx, jobID)
+	if err != nil {
+		// Left in flight; the message is delivered again later
+		return nil, err
+	}
+
+	statuses := types.StatusesInto(types.JobStatusProcessing)
+	if msg.Attributes[string(sqstypes.MessageSystemAttributeNameApproximateReceiveCount)] != "1" {
+		// A redelivered job is claimed again without changing status
+		statuses = append(statuses, types.JobStatusProcessing)
+	}
+
+	// A job that waited past its expiry expires instead of running late
+	if job.Status != types.JobStatusProcessing && job.Expired(time.Now()) {
+		if err := q.ExpireJob(ctx, jobID); err != nil && !errors.Is(err, ErrJobConflict) {
+			return nil, err
+		}
+		q.deleteMessage(ctx, receipt)
+		return nil, nil
+	}
+
+	if !hasStatus(job, statuses) {
+		if job.Status.IsFinal() {
+			// Finished or cancelled; nothing left to run
+			q.deleteMessage(ctx, receipt)
+		}
+		return nil, nil
+	}
+
+	// SQS hides a message for at most 12 hours, so a retry or parked job
+	// due later than that comes back early; hide it again until it's due
+	now := time.Now()
+	if job.Status != types.JobStatusProcessing && job.ScheduledAt.After(now) {
+		return nil, q.changeVisibility(ctx, receipt, job.ScheduledAt.Sub(now))
+	}
+
+	job.Status = types.JobStatusProcessing
+	job.WorkerID = workerID
+	job.StartedAt = &now
+	job.UpdatedAt = now
+	job.Progress = nil
+
+	claimed, err := q.storage.UpdateJobIf(ctx, job, statuses...)
+	if err != nil || !claimed {
+		// Another delivery of the same message won the claim
+		return nil, err
+	}
+
+	q.mu.Lock()
+	q.inflight[jobID] = receipt
+	q.mu.Unlock()
+
+	return job, nil
+}
+
+// GetJob retrieves a job from PostgreSQL
+func (q *SQSQueue) GetJob(ctx context.Context, jobID string) (*types.Job, error) {
+	return q.storage.GetJob(ctx, jobID)
+}
+
+// CompleteJob marks a job as completed and deletes its message. It returns
+// ErrJobConflict if the job is no longer processing, for example because it
+// was cancelled.
+func (q *SQSQueue) CompleteJob(ctx context.Context, jobID string, result json.RawMessage) error {
+	job, err := q.storage.GetJob(ctx, jobID)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	job.Result = result
+	job.CompletedAt = &now
+	job.UpdatedAt = now
+	if err := q.transition(ctx, job, types.JobStatusCompleted); err != nil {
+		return err
+	}
+
+	return q.ack(ctx, jobID, -1)
+}
+
+// FailJob records a failed attempt. A job with attempts left becomes
+// visible on its queue again after the retry delay, unless the failure is
+// permanent. It returns ErrJobConflict if the job already finished.
+func (q *SQSQueue) FailJob(ctx context.Context, jobID string, failure types.Failure) error {
+	job, err := q.storage.GetJob(ctx, jobID)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	job.Attempts++
+	job.Error = failure.Message
+	job.ErrorCode = failure.Code
+	job.UpdatedAt = now
+
+	// Only apply the update if no one else finished or failed the job since
+	// it was read
+	if failure.Retry(job.Attempts, job.MaxAttempts) {
+		delay := failure.Delay(job.Type, job.Attempts)
+		job.ScheduledAt = now.Add(delay)
+		if err := q.transition(ctx, job, types.JobStatusRetrying); err != nil {
+			return err
+		}
+		return q.ack(ctx, jobID, delay)
+	}
+
+	job.CompletedAt = &now
+	if err := q.transition(ctx, job, types.JobStatusFailed); err != nil {
+		return err
+	}
+	return q.ack(ctx, jobID, -1)
+}
+
+// RequeueJob makes a job this worker could not finish visible again right
+// away without counting it as an attempt
+func (q *SQSQueue) RequeueJob(ctx context.Context, jobID string) error {
+	job, err := q.storage.GetJob(ctx, jobID)
+	if err != nil {
+		return err
+	}
+
+	job.WorkerID = ""
+	job.StartedAt = nil
+	job.UpdatedAt = time.Now()
+	if err := q.transition(ctx, job, types.JobStatusPending); err != nil {
+		return err
+	}
+
+	return q.ack(ctx, jobID, 0)
+}
+
+// ParkJob puts off a job this worker won't run yet, without counting an
+// attempt. The job is scheduled to run at until, when its message becomes
+// visible again.
+func (q *SQSQueue) ParkJob(ctx context.Context, jobID string, until time.Time) error {
+	job, err := q.storage.GetJob(ctx, jobID)
+	if err != nil {
+		return err
+	}
+
+	job.WorkerID = ""
+	job.StartedAt = nil
+	job.ScheduledAt = until
+	job.UpdatedAt = time.Now()
+	if err := q.transition(ctx, job, types.JobStatusScheduled); err != nil {
+		return err
+	}
+
+	return q.ack(ctx, jobID, max(time.Until(until), 0))
+}
+
+// CancelJob stops a job for good. A job still waiting is discarded when
+// its message is next received. It returns ErrJobConflict if the job
+// already finished.
+func (q *SQSQueue) CancelJob(ctx context.Context, jobID string) error {
+	job, err := q.storage.GetJob(ctx, jobID)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	job.CompletedAt = &now
+	job.UpdatedAt = now
+	if err := q.transition(ctx, job, types.JobStatusCancelled); err != nil {
+		return err
+	}
+
+	return q.ack(ctx, jobID, -1)
+}
+
+// ExpireJob stops a job that waited past its expiry. Its message is
+// discarded when it is next received. It returns ErrJobConflict if the job
+// is no longer waiting.
+func (q *SQSQueue) ExpireJob(ctx context.Context, jobID string) error {
+	job, err := q.storage.GetJob(ctx, jobID)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	job.CompletedAt = &now
+	job.UpdatedAt = now
+	return q.transition(ctx, job, types.JobStatusExpired)
+}
+
+// UpdateProgress records the progress of a running job. It returns
+// ErrJobConflict if the job is no longer processing.
+func (q *SQSQueue) UpdateProgress(ctx context.Context, jobID string, progress *types.JobProgress) error {
+	updated, err := q.storage.UpdateJobProgress(ctx, jobID, progress)
+	if err != nil {
+		return err
+	}
+	if !updated {
+		return fmt.Errorf("%w: job is no longer processing", ErrJobConflict)
+	}
+	return nil
+}
+
+// SaveCheckpoint stores a running job's checkpoint, which later attempts
+// receive with the job. It returns ErrJobConflict if the job is no longer
+// processing.
+func (q *SQSQueue) SaveCheckpoint(ctx context.Context, jobID string, checkpoint json.RawMessage) error {
+	updated, err := q.storage.UpdateJobCheckpoint(ctx, jobID, checkpoint)
+	if err != nil {
+		return err
+	}
+	if !updated {
+		return fmt.Errorf("%w: job is no longer processing", ErrJobConflict)
+	}
+	return nil
+}
+
+// Heartbeat restarts the visibility timeout of a job this process holds
+func (q *SQSQueue) Heartbeat(ctx context.Context, workerID, jobID string) error {
+	q.mu.Lock()
+	receipt, ok := q.inflight[jobID]
+	q.mu.Unlock()
+	if !ok {
+		return nil
+	}
+
+	_, err := q.client.ChangeMessageVisibility(ctx, &sqs.ChangeMessageVisibilityInput{
+		QueueUrl:          aws.String(receipt.queueURL),
+		ReceiptHandle:     aws.String(receipt.handle),
+		VisibilityTimeout: int32(q.visibilityTimeout / time.Second),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to extend job visibility: %w", err)
+	}
+	return nil
+}
+
+// ReleaseAffinity does nothing: SQS jobs have no affinity
+func (q *SQSQueue) ReleaseAffinity(ctx context.Context, workerID string) error {
+	return nil
+}
+
+// transition moves job to status to and stores it if it is still in the
+// status it was read in
+func (q *SQSQueue) transition(ctx context.Context, job *types.Job, to types.JobStatus) error {
+	from := job.Status
+	if err := job.Transition(to); err != nil {
+		q.forget(job.ID)
+		return fmt.Errorf("%w: %w", ErrJobConflict, err)
+	}
+
+	updated, err := q.storage.UpdateJobIf(ctx, job, from)
+	if err != nil {
+		return err
+	}
+	if !updated {
+		q.forget(job.ID)
+		return fmt.Errorf("%w: job is no longer %s", ErrJobConflict, from)
+	}
+	return nil
+}
+
+// forget drops the message for a job that changed elsewhere. The message is
+// delivered again after the visibility timeout and discarded if the job has
+// finished.
+func (q *SQSQueue) forget(jobID string) {
+	q.mu.Lock()
+	delete(q.inflight, jobID)
+	q.mu.Unlock()
+}
+
+// ack releases this process's message for a job: a negative delay deletes
+// it, otherwise it becomes visible again after delay. Jobs this process
+// doesn't hold, such as pending jobs cancelled through the API, are left to
+// be discarded when they're next received.
+func (q *SQSQueue) ack(ctx context.Context, jobID string, delay time.Duration) error {
+	q.mu.Lock()
+	receipt, ok := q.inflight[jobID]
+	delete(q.inflight, jobID)
+	q.mu.Unlock()
+	if !ok {
+		return nil
+	}
+
+	if delay < 0 {
+		return q.deleteMessage(ctx, receipt)
+	}
+	return q.changeVisibility(ctx, receipt, delay)
+}
+
+// changeVisibility hides a message for delay. SQS counts whole seconds, so
+// delay is rounded up, and capped at 12 hours; claim hides a job that comes
+// back before it is due again.
+func (q *SQSQueue) changeVisibility(ctx context.Context, receipt sqsReceipt, delay time.Duration) error {
+	delay = min(delay, sqsMaxVisibility)
+	_, err := q.client.ChangeMessageVisibility(ctx, &sqs.ChangeMessageVisibilityInput{
+		QueueUrl:          aws.String(receipt.queueURL),
+		ReceiptHandle:     aws.String(receipt.handle),
+		VisibilityTimeout: int32((delay + time.Second - 1) / time.Second),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to release job message: %w", err)
+	}
+	return nil
+}
+
+func (q *SQSQueue) deleteMessage(ctx context.Context, receipt sqsReceipt) error {
+	_, err := q.client.DeleteMessage(ctx, &sqs.DeleteMessageInput{
+		QueueUrl:      aws.String(receipt.queueURL),
+		ReceiptHandle: aws.String(receipt.handle),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete job message: %w", err)
+	}
+	return nil
+}
+
+// InspectQueues reports SQS's approximate visible and in-flight message
+// counts for each job type. Jobs waiting out a retry delay count as
+// processing.
+func (q *SQSQueue) InspectQueues(ctx context.Context, jobTypes []types.JobType) ([]types.QueueStats, error) {
+	stats := make([]types.QueueStats, len(jobTypes))
+	for i, jobType := range jobTypes {
+		url, err := q.queueURL(ctx, jobType)
+		if err != nil {
+			return nil, err
+		}
+
+		out, err := q.client.GetQueueAttributes(ctx, &sqs.GetQueueAttributesInput{
+			QueueUrl: aws.String(url),
+			AttributeNames: []sqstypes.QueueAttributeName{
+				sqstypes.QueueAttributeNameApproximateNumberOfMessages,
+				sqstypes.QueueAttributeNameApproximateNumberOfMessagesNotVisible,
+			},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to read queue depth: %w", err)
+		}
+
+		stats[i] = types.QueueStats{
+			Name:       q.QueueName(jobType),
+			JobType:    jobType,
+			Pending:    queueAttribute(out.Attributes, sqstypes.QueueAttributeNameApproximateNumberOfMessages),
+			Processing: queueAttribute(out.Attributes, sqstypes.QueueAttributeNameApproximateNumberOfMessagesNotVisible),
+		}
+	}
+	return stats, nil
+}
+
+func queueAttribute(attrs map[string]string, name sqstypes.QueueAttributeName) int {
+	n, _ := strconv.Atoi(attrs[string(name)])
+	return n
+}
+
+// GetQueueMetrics reports depth from SQS, and oldest job age and rates over
+// window from PostgreSQL
+func (q *SQSQueue) GetQueueMetrics(ctx context.Context, jobTypes []types.JobType, window time.Duration) ([]QueueMetrics, error) {
+	if window < time.Minute {
+		window = time.Minute
+	}
+
+	queues, err := q.InspectQueues(ctx, jobTypes)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	buckets, err := q.storage.JobTimeseries(ctx, "", "", now.Add(-window), now, window)
+	if err != nil {
+		return nil, err
+	}
+	oldest, err := q.storage.OldestWaitingJobs(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	totals := make(map[types.JobType]storage.TimeseriesBucket)
+	for _, b := range buckets {
+		if b.Bucket == -1 {
+			totals[b.JobType] = b
+		}
+	}
+
+	seconds := window.Seconds()
+	metrics := make([]QueueMetrics, len(jobTypes))
+	for i, jobType := range jobTypes {
+		total := totals[jobType]
+		m := QueueMetrics{
+			JobType:         jobType,
+			Depth:           int64(queues[i].Pending),
+			EnqueuedPerSec:  float64(total.Created) / seconds,
+			ProcessedPerSec: float64(total.Completed+total.Failed) / seconds,
+		}
+		if at, ok := oldest[jobType]; ok {
+			m.OldestJobAge = now.Sub(at)
+			m.OldestJobSeconds = m.OldestJobAge.Seconds()
+		}
+		metrics[i] = m
+	}
+
+	return metrics, nil
+}
+
+// GetPendingDepth returns the approximate number of visible jobs across the
+// given job types' queues
+func (q *SQSQueue) GetPendingDepth(ctx context.Context, jobTypes []types.JobType) (int64, error) {
+	queues, err := q.InspectQueues(ctx, jobTypes)
+	if err != nil {
+		return 0, err
+	}
+
+	var depth int64
+	for _, s := range queues {
+		depth += int64(s.Pending)
+	}
+	return depth, nil
+}
+
+// GetStats returns the statistics stored by the last SetStats for a tenant,
+// or across all tenants when tenantID is empty
+func (q *SQSQueue) GetStats(ctx context.Context, tenantID string) (*types.JobStats, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	stats, ok := q.stats[tenantID]
+	if !ok {
+		return &types.JobStats{ByType: make(map[types.JobType]*types.TypeStats)}, nil
+	}
+	return copyStats(stats), nil
+}
+
+// SetStats replaces the statistics for a tenant, or across all tenants when
+// tenantID is empty. They're kept in memory until the next reconciliation.
+func (q *SQSQueue) SetStats(ctx context.Context, tenantID string, stats *types.JobStats) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.stats[tenantID] = copyStats(stats)
+	return nil
+}
+
+func copyStats(stats *types.JobStats) *types.JobStats {
+	out := *stats
+	out.Queues = nil
+	out.ByType = make(map[types.JobType]*types.TypeStats, len(stats.ByType))
+	for jobType, ts := range stats.ByType {
+		ts := *ts
+		out.ByType[jobType] = &ts
+	}
+	return &out
+}
+
+// SendWorkerCommand stores a command for a worker to pick up on its next
+// heartbeat
+func (q *SQSQueue) SendWorkerCommand(ctx context.Context, workerID string, cmd types.WorkerCommand) error {
+	if !cmd.IsValid() {
+		return fmt.Errorf("invalid worker command: %s", cmd)
+	}
+	return q.storage.SetWorkerCommand(ctx, workerID, cmd)
+}
+
+// GetWorkerCommand returns the pending command for a worker, or resume if
+// there is none
+func (q *SQSQueue) GetWorkerCommand(ctx context.Context, workerID string) (types.WorkerCommand, error) {
+	return q.storage.GetWorkerCommand(ctx, workerID)
+}
+
+// ClearWorkerCommand removes any pending command for a worker
+func (q *SQSQueue) ClearWorkerCommand(ctx context.Context, workerID string) error {
+	return q.storage.SetWorkerCommand(ctx, workerID, types.WorkerCommandResume)
+}
+
+// SubscribeWorkerCommands delivers nothing; without pub/sub, commands are
+// only picked up by polling. The channel closes when ctx is cancelled.
+func (q *SQSQueue) SubscribeWorkerCommands(ctx context.Context, workerID string) <-chan types.WorkerCommand {
+	commands := make(chan types.WorkerCommand)
+	go func() {
+		<-ctx.Done()
+		close(commands)
+	}()
+	return commands
+}
+
+// PublishJobUpdate does nothing; without pub/sub, cached jobs expire on
+// their own
+func (q *SQSQueue) PublishJobUpdate(ctx context.Context, jobID string) error {
+	return nil
+}
+
+// SubscribeJobUpdates delivers nothing. The channel closes when ctx is
+// cancelled.
+func (q *SQSQueue) SubscribeJobUpdates(ctx context.Context) <-chan string {
+	return idleSubscription(ctx)
+}
+
+// PublishSchemaUpdate does nothing; without pub/sub, API servers pick up
+// registered schemas when they next resync
+func (q *SQSQueue) PublishSchemaUpdate(ctx context.Context, jobType types.JobType) error {
+	return nil
+}
+
+// SubscribeSchemaUpdates delivers nothing. The channel closes when ctx is
+// cancelled.
+func (q *SQSQueue) SubscribeSchemaUpdates(ctx context.Context) <-chan string {
+	return idleSubscription(ctx)
+}
+
+// idleSubscription returns a channel that delivers nothing and closes when
+// ctx is cancelled
+func idleSubscription(ctx context.Context) <-chan string {
+	payloads := make(chan string)
+	go func() {
+		<-ctx.Done()
+		close(payloads)
+	}()
+	return payloads
+}
+
+func hasStatus(job *types.Job, statuses []types.JobStatus) bool {
+	for _, status := range statuses {
+		if job.Status == status {
+			return true
+		}
+	}
+	return false
+}
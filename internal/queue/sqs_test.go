@@ -0,0 +1,253 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"taskflow/internal/storage"
+	"taskflow/internal/testutil"
+	"taskflow/internal/types"
+	"testing"
+	"time"
+)
+
+// newTestSQSStorage returns storage on an empty, migrated test database
+func newTestSQSStorage(t *testing.T) *storage.PostgresStorage {
+	t.Helper()
+	store, err := storage.NewPostgresStorage(testutil.Postgres(t))
+	if err != nil {
+		t.Fatalf("NewPostgresStorage: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+// newTestSQSQueue returns a queue on the test SQS server. Queues that share
+// prefix share messages, like worker processes on the same deployment.
+func newTestSQSQueue(t *testing.T, store *storage.PostgresStorage, prefix string, visibility time.Duration) *SQSQueue {
+	t.Helper()
+	endpoint := testutil.SQS(t)
+	t.Setenv("AWS_ACCESS_KEY_ID", "test")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "test")
+
+	q, err := NewSQSQueue(context.Background(), SQSConfig{
+		QueuePrefix:       prefix,
+		Region:            "us-east-1",
+		Endpoint:          endpoint,
+		VisibilityTimeout: visibility,
+	}, store)
+	if err != nil {
+		t.Fatalf("NewSQSQueue: %v", err)
+	}
+	return q
+}
+
+// testSQSPrefix returns a queue prefix no other test uses
+func testSQSPrefix() string {
+	return fmt.Sprintf("taskflow-test-%d-", time.Now().UnixNano())
+}
+
+// createTestSQSJob stores and queues a new job
+func createTestSQSJob(t *testing.T, q *SQSQueue, store *storage.PostgresStorage, jobType types.JobType) *types.Job {
+	t.Helper()
+	ctx := context.Background()
+	job := newTestJob(jobType)
+	if err := store.CreateJob(ctx, job); err != nil {
+		t.Fatalf("CreateJob: %v", err)
+	}
+	if err := q.EnqueueJob(ctx, job); err != nil {
+		t.Fatalf("EnqueueJob: %v", err)
+	}
+	return job
+}
+
+func TestSQSQueueLifecycle(t *testing.T) {
+	store := newTestSQSStorage(t)
+	q := newTestSQSQueue(t, store, testSQSPrefix(), time.Minute)
+	ctx := context.Background()
+	jobTypes := []types.JobType{types.JobTypeEmail, types.JobTypeWebhook}
+
+	job := createTestSQSJob(t, q, store, types.JobTypeEmail)
+	claimed, err := q.DequeueJob(ctx, "worker-1", jobTypes, time.Second)
+	if err != nil || claimed == nil {
+		t.Fatalf("DequeueJob = %v, %v; want the job", claimed, err)
+	}
+	if claimed.ID != job.ID || claimed.Status != types.JobStatusProcessing || claimed.WorkerID != "worker-1" {
+		t.Errorf("claimed job = %+v, want %s processing on worker-1", claimed, job.ID)
+	}
+
+	queues, err := q.InspectQueues(ctx, jobTypes)
+	if err != nil {
+		t.Fatalf("InspectQueues: %v", err)
+	}
+	if queues[0].Name != q.QueueName(types.JobTypeEmail) || queues[0].Pending != 0 || queues[0].Processing != 1 {
+		t.Errorf("email queue = %+v, want 1 job in flight", queues[0])
+	}
+
+	if err := q.CompleteJob(ctx, job.ID, nil); err != nil {
+		t.Fatalf("CompleteJob: %v", err)
+	}
+	if err := q.CompleteJob(ctx, job.ID, nil); !errors.Is(err, ErrJobConflict) {
+		t.Errorf("CompleteJob twice = %v, want ErrJobConflict", err)
+	}
+	if stored, err := store.GetJob(ctx, job.ID); err != nil || stored.Status != types.JobStatusCompleted {
+		t.Errorf("stored job = %v, %v; want completed", stored, err)
+	}
+
+	// The message is deleted with the completed job
+	if next, err := q.DequeueJob(ctx, "worker-1", jobTypes, time.Second); err != nil || next != nil {
+		t.Errorf("DequeueJob after completion = %v, %v; want nothing", next, err)
+	}
+}
+
+func TestSQSQueueEnqueueJobs(t *testing.T) {
+	store := newTestSQSStorage(t)
+	q := newTestSQSQueue(t, store, testSQSPrefix(), time.Minute)
+	ctx := context.Background()
+
+	// More than one SendMessageBatch request's worth
+	jobs := make([]*types.Job, sqsMaxBatch+2)
+	for i := range jobs {
+		jobs[i] = newTestJob(types.JobTypeWebhook)
+		if err := store.CreateJob(ctx, jobs[i]); err != nil {
+			t.Fatalf("CreateJob: %v", err)
+		}
+	}
+	if err := q.EnqueueJobs(ctx, jobs); err != nil {
+		t.Fatalf("EnqueueJobs: %v", err)
+	}
+
+	claimed := make(map[string]bool)
+	for range jobs {
+		job, err := q.DequeueJob(ctx, "worker-1", []types.JobType{types.JobTypeWebhook}, time.Second)
+		if err != nil || job == nil {
+			t.Fatalf("DequeueJob after %d jobs = %v, %v; want another job", len(claimed), job, err)
+		}
+		claimed[job.ID] = true
+	}
+	for _, job := range jobs {
+		if !claimed[job.ID] {
+			t.Errorf("job %s wasn't claimed", job.ID)
+		}
+	}
+}
+
+// TestSQSQueueVisibilityTimeout checks that a job whose worker goes quiet
+// is delivered to another worker once the visibility timeout passes, and
+// that heartbeats keep it hidden
+func TestSQSQueueVisibilityTimeout(t *testing.T) {
+	store := newTestSQSStorage(t)
+	prefix := testSQSPrefix()
+	visibility := 2 * time.Second
+	q1 := newTestSQSQueue(t, store, prefix, visibility)
+	q2 := newTestSQSQueue(t, store, prefix, visibility)
+	ctx := context.Background()
+	jobTypes := []types.JobType{types.JobTypeWebhook}
+
+	job := createTestSQSJob(t, q1, store, types.JobTypeWebhook)
+	if claimed, err := q1.DequeueJob(ctx, "worker-1", jobTypes, time.Second); err != nil || claimed == nil {
+		t.Fatalf("DequeueJob = %v, %v; want the job", claimed, err)
+	}
+	if other, err := q2.DequeueJob(ctx, "worker-2", jobTypes, time.Second); err != nil || other != nil {
+		t.Fatalf("DequeueJob while the job is in flight = %v, %v; want nothing", other, err)
+	}
+
+	time.Sleep(visibility)
+	reclaimed, err := q2.DequeueJob(ctx, "worker-2", jobTypes, time.Second)
+	if err != nil || reclaimed == nil || reclaimed.ID != job.ID || reclaimed.WorkerID != "worker-2" {
+		t.Fatalf("DequeueJob after the visibility timeout = %v, %v; want the job on worker-2", reclaimed, err)
+	}
+
+	// Heartbeats restart the timeout
+	for i := 0; i < 2; i++ {
+		time.Sleep(visibility * 3 / 4)
+		if err := q2.Heartbeat(ctx, "worker-2", job.ID); err != nil {
+			t.Fatalf("Heartbeat: %v", err)
+		}
+	}
+	if other, err := q1.DequeueJob(ctx, "worker-1", jobTypes, time.Second); err != nil || other != nil {
+		t.Fatalf("DequeueJob of a job kept by heartbeats = %v, %v; want nothing", other, err)
+	}
+
+	if err := q2.CompleteJob(ctx, job.ID, nil); err != nil {
+		t.Fatalf("CompleteJob: %v", err)
+	}
+}
+
+// TestSQSQueueRetryDelay checks that a failed job isn't delivered again
+// before its retry is due, including the part of the delay under a second
+func TestSQSQueueRetryDelay(t *testing.T) {
+	store := newTestSQSStorage(t)
+	q := newTestSQSQueue(t, store, testSQSPrefix(), time.Minute)
+	ctx := context.Background()
+	jobTypes := []types.JobType{types.JobTypeWebhook}
+
+	job := createTestSQSJob(t, q, store, types.JobTypeWebhook)
+	if claimed, err := q.DequeueJob(ctx, "worker-1", jobTypes, time.Second); err != nil || claimed == nil {
+		t.Fatalf("DequeueJob = %v, %v; want the job", claimed, err)
+	}
+
+	failure := types.Failure{Message: "rate limited", Code: types.ErrorCodeRateLimited, RetryAfter: 1500 * time.Millisecond}
+	if err := q.FailJob(ctx, job.ID, failure); err != nil {
+		t.Fatalf("FailJob: %v", err)
+	}
+	retrying, err := store.GetJob(ctx, job.ID)
+	if err != nil {
+		t.Fatalf("GetJob: %v", err)
+	}
+	if retrying.Status != types.JobStatusRetrying || retrying.Attempts != 1 || !retrying.ScheduledAt.After(time.Now()) {
+		t.Fatalf("failed job = %s after %d attempts, scheduled at %v; want retrying later", retrying.Status, retrying.Attempts, retrying.ScheduledAt)
+	}
+
+	waitForSQSJob(t, q, jobTypes, job.ID, retrying.ScheduledAt)
+}
+
+// TestSQSQueueHidesJobsUntilDue checks that a retry delivered before its
+// scheduled_at, as happens when it is due later than SQS can hide a
+// message for, is hidden again until it is due
+func TestSQSQueueHidesJobsUntilDue(t *testing.T) {
+	store := newTestSQSStorage(t)
+	q := newTestSQSQueue(t, store, testSQSPrefix(), time.Minute)
+	ctx := context.Background()
+	jobTypes := []types.JobType{types.JobTypeWebhook}
+
+	job := newTestJob(types.JobTypeWebhook)
+	job.Status = types.JobStatusRetrying
+	job.Attempts = 1
+	job.ScheduledAt = time.Now().Add(1500 * time.Millisecond)
+	if err := store.CreateJob(ctx, job); err != nil {
+		t.Fatalf("CreateJob: %v", err)
+	}
+	if err := q.EnqueueJob(ctx, job); err != nil {
+		t.Fatalf("EnqueueJob: %v", err)
+	}
+
+	waitForSQSJob(t, q, jobTypes, job.ID, job.ScheduledAt)
+}
+
+// waitForSQSJob polls q until it claims jobID, and fails t if that happens
+// before due or long after it
+func waitForSQSJob(t *testing.T, q *SQSQueue, jobTypes []types.JobType, jobID string, due time.Time) {
+	t.Helper()
+	ctx := context.Background()
+	for {
+		next, err := q.DequeueJob(ctx, "worker-1", jobTypes, 0)
+		if err != nil {
+			t.Fatalf("DequeueJob: %v", err)
+		}
+		if next == nil {
+			if time.Now().After(due.Add(3 * time.Second)) {
+				t.Fatalf("job due at %v wasn't claimed", due)
+			}
+			time.Sleep(100 * time.Millisecond)
+			continue
+		}
+		if next.ID != jobID {
+			t.Fatalf("DequeueJob = %s, want %s", next.ID, jobID)
+		}
+		if claimed := time.Now(); claimed.Before(due) {
+			t.Errorf("job claimed at %v, before it was due at %v", claimed, due)
+		}
+		return
+	}
+}
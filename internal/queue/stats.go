@@ -0,0 +1,189 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"taskflow/internal/types"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Stats hashes hold counters named after the JobStats fields, plus
+// "<type>:<field>" counters for the per-type breakdown. Failed jobs are
+// also counted by error code, as "failed.<code>" and
+// "<type>:failed.<code>". The counters are updated as jobs move and
+// corrected by SetStats when they're reconciled.
+
+// GetStats returns job processing statistics for a tenant,
+// or across all tenants when tenantID is empty
+func (r *RedisQueue) GetStats(ctx context.Context, tenantID string) (*types.JobStats, error) {
+	key := StatsKey
+	if tenantID != "" {
+		key = TenantStatsKey(tenantID)
+	}
+
+	data, err := r.client.HGetAll(ctx, key).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	stats := &types.JobStats{ByType: make(map[types.JobType]*types.TypeStats)}
+	for field, val := range data {
+		n, err := strconv.Atoi(val)
+		if err != nil {
+			continue
+		}
+
+		jobType, name, ok := strings.Cut(field, ":")
+		if !ok {
+			if code, ok := strings.CutPrefix(field, failedCodePrefix); ok {
+				stats.FailedByCode = addFailedCode(stats.FailedByCode, code, n)
+			} else if counter := jobStatsCounters(stats)[field]; counter != nil {
+				*counter = n
+			}
+			continue
+		}
+
+		ts, found := stats.ByType[types.JobType(jobType)]
+		if !found {
+			ts = &types.TypeStats{}
+			stats.ByType[types.JobType(jobType)] = ts
+		}
+		if code, ok := strings.CutPrefix(name, failedCodePrefix); ok {
+			ts.FailedByCode = addFailedCode(ts.FailedByCode, code, n)
+		} else if counter := typeStatsCounters(ts)[name]; counter != nil {
+			*counter = n
+		}
+	}
+
+	return stats, nil
+}
+
+// jobStatsCounters maps counter names to the JobStats fields they hold
+func jobStatsCounters(s *types.JobStats) map[string]*int {
+	return map[string]*int{
+		"total":      &s.Total,
+		"scheduled":  &s.Scheduled,
+		"pending":    &s.Pending,
+		"processing": &s.Processing,
+		"completed":  &s.Completed,
+		"failed":     &s.Failed,
+		"cancelled":  &s.Cancelled,
+		"expired":    &s.Expired,
+	}
+}
+
+// typeStatsCounters maps counter names to the TypeStats fields they hold
+func typeStatsCounters(ts *types.TypeStats) map[string]*int {
+	return map[string]*int{
+		"total":      &ts.Total,
+		"scheduled":  &ts.Scheduled,
+		"pending":    &ts.Pending,
+		"processing": &ts.Processing,
+		"completed":  &ts.Completed,
+		"failed":     &ts.Failed,
+		"cancelled":  &ts.Cancelled,
+		"expired":    &ts.Expired,
+	}
+}
+
+// failedCodePrefix starts the counters of failed jobs by error code
+const failedCodePrefix = "failed."
+
+// failedCodeField returns the counter that failed jobs with code are
+// counted under. Jobs failed without a code count as UNKNOWN.
+func failedCodeField(code types.ErrorCode) string {
+	if code == "" {
+		code = types.ErrorCodeUnknown
+	}
+	return failedCodePrefix + string(code)
+}
+
+// addFailedCode sets the count of a non-zero error code counter,
+// creating counts if needed
+func addFailedCode(counts map[types.ErrorCode]int, code string, n int) map[types.ErrorCode]int {
+	if n == 0 {
+		return counts
+	}
+	if counts == nil {
+		counts = make(map[types.ErrorCode]int)
+	}
+	counts[types.ErrorCode(code)] = n
+	return counts
+}
+
+// statsField returns the counter that jobs in a status are counted under.
+// Retrying jobs count as pending.
+func statsField(status types.JobStatus) string {
+	if status == types.JobStatusRetrying {
+		return string(types.JobStatusPending)
+	}
+	return string(status)
+}
+
+// SetStats replaces the counters for a tenant, or the global counters when
+// tenantID is empty. Counter updates made while it runs may be lost until
+// the next reconciliation.
+func (r *RedisQueue) SetStats(ctx context.Context, tenantID string, stats *types.JobStats) error {
+	key := StatsKey
+	if tenantID != "" {
+		key = TenantStatsKey(tenantID)
+	}
+
+	values := make(map[string]interface{})
+	for field, counter := range jobStatsCounters(stats) {
+		values[field] = *counter
+	}
+	for code, n := range stats.FailedByCode {
+		values[failedCodeField(code)] = n
+	}
+	for jobType, ts := range stats.ByType {
+		prefix := string(jobType) + ":"
+		for field, counter := range typeStatsCounters(ts) {
+			values[prefix+field] = *counter
+		}
+		for code, n := range ts.FailedByCode {
+			values[prefix+failedCodeField(code)] = n
+		}
+	}
+
+	pipe := r.client.TxPipeline()
+	pipe.Del(ctx, key)
+	pipe.HSet(ctx, key, values)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to set stats: %w", err)
+	}
+	return nil
+}
+
+// InspectQueues reports the pending and processing jobs of each type as
+// held by the queues themselves
+func (r *RedisQueue) InspectQueues(ctx context.Context, jobTypes []types.JobType) ([]types.QueueStats, error) {
+	queues, err := r.engine.inspect(ctx, jobTypes)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := make([]types.QueueStats, len(queues))
+	for i, q := range queues {
+		stats[i] = types.QueueStats{
+			Name:       q.name,
+			JobType:    jobTypes[i],
+			Pending:    int(q.pending),
+			Processing: int(q.processing),
+		}
+	}
+	return stats, nil
+}
+
+// incrStats updates a stats field both globally and for the job's tenant,
+// in total and for the job's type
+func incrStats(ctx context.Context, pipe redis.Pipeliner, job *types.Job, field string, delta int64) {
+	typeField := string(job.Type) + ":" + field
+	for _, key := range []string{StatsKey, TenantStatsKey(job.Tenant())} {
+		pipe.HIncrBy(ctx, key, field, delta)
+		pipe.HIncrBy(ctx, key, typeField, delta)
+	}
+}
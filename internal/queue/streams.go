@@ -0,0 +1,314 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync"
+	"taskflow/internal/types"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Stream engine keys share the {jobs} hash tag with the list engine
+const (
+	StreamKeyPrefix   = "taskflow:{jobs}:stream:"
+	StreamInflightKey = "taskflow:{jobs}:stream-inflight"
+	StreamGroup       = "taskflow-workers"
+)
+
+// StreamKey returns the stream holding pending jobs of a type
+func StreamKey(jobType types.JobType) string {
+	return StreamKeyPrefix + string(jobType)
+}
+
+// streamEngine queues jobs on one Redis stream per type, read through a
+// consumer group. Redis tracks delivered but unacknowledged messages per
+// consumer, so jobs held by a worker that disappears are reclaimed with
+// XAUTOCLAIM once they've been idle for claimIdle.
+//
+// Messages carry only the job ID. The stream and message ID of each in-flight
+// job are kept in StreamInflightKey so that the job can be acknowledged by ID.
+// Acknowledged messages are deleted; job history lives in PostgreSQL.
+//
+// Each stream is served in arrival order, so job priority has no effect, and
+// retries and parked jobs that come due wait behind the jobs already queued.
+// Jobs with an affinity key never reach the engine: RedisQueue queues and
+// leases them itself, the same way for every engine.
+type streamEngine struct {
+	client    redis.UniversalClient
+	claimIdle time.Duration
+
+	mu          sync.Mutex
+	groups      map[string]bool // streams known to have the consumer group
+	lastReclaim time.Time
+}
+
+func newStreamEngine(client redis.UniversalClient, claimIdle time.Duration) *streamEngine {
+	if claimIdle <= 0 {
+		claimIdle = 30 * time.Minute
+	}
+	return &streamEngine{
+		client:    client,
+		claimIdle: claimIdle,
+		groups:    make(map[string]bool),
+	}
+}
+
+// push appends the job to its stream. Streams are strictly ordered, so
+// front, which high priority jobs and due retries ask for, is ignored.
+func (e *streamEngine) push(ctx context.Context, pipe redis.Pipeliner, job *types.Job, front bool) {
+	pipe.XAdd(ctx, &redis.XAddArgs{
+		Stream: StreamKey(job.Type),
+		Values: map[string]interface{}{"job_id": job.ID},
+	})
+}
+
+func (e *streamEngine) claim(ctx context.Context, consumer string, jobTypes []types.JobType, timeout time.Duration) (string, bool, error) {
+	streams := make([]string, len(jobTypes))
+	start := rand.Intn(len(jobTypes))
+	for i := range jobTypes {
+		streams[i] = StreamKey(jobTypes[(start+i)%len(jobTypes)])
+		if err := e.ensureGroup(ctx, streams[i]); err != nil {
+			return "", false, err
+		}
+	}
+
+	// Abandoned jobs come first, checked at most a few times per idle period
+	if e.reclaimDue() {
+		for _, stream := range streams {
+			jobID, err := e.reclaim(ctx, consumer, stream)
+			if err != nil || jobID != "" {
+				return jobID, jobID != "", err
+			}
+		}
+	}
+
+	// Take a new job from the first stream that has one
+	for _, stream := range streams {
+		msgs, err := e.read(ctx, consumer, []string{stream}, -1)
+		if err != nil {
+			return "", false, err
+		}
+		if len(msgs) > 0 {
+			return e.track(ctx, msgs[0])
+		}
+	}
+
+	// Nothing waiting: block on all streams at once
+	msgs, err := e.read(ctx, consumer, streams, timeout)
+	if err != nil || len(msgs) == 0 {
+		return "", false, err
+	}
+
+	// Several streams may deliver at once; hand back all but the first
+	for _, extra := range msgs[1:] {
+		if err := e.handBack(ctx, extra); err != nil {
+			return "", false, err
+		}
+	}
+
+	return e.track(ctx, msgs[0])
+}
+
+// streamMessage is a message read from a specific stream
+type streamMessage struct {
+	stream string
+	redis.XMessage
+}
+
+// read reads up to one new message from each stream. A negative block
+// doesn't wait.
+func (e *streamEngine) read(ctx context.Context, consumer string, streams []string, block time.Duration) ([]streamMessage, error) {
+	args := make([]string, 0, 2*len(streams))
+	args = append(args, streams...)
+	for range streams {
+		args = append(args, ">")
+	}
+
+	res, err := e.client.XReadGroup(ctx, &redis.XReadGroupArgs{
+		Group:    StreamGroup,
+		Consumer: consumer,
+		Streams:  args,
+		Count:    1,
+		Block:    block,
+	}).Result()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to dequeue job: %w", err)
+	}
+
+	var msgs []streamMessage
+	for _, s := range res {
+		for _, msg := range s.Messages {
+			msgs = append(msgs, streamMessage{stream: s.Stream, XMessage: msg})
+		}
+	}
+	return msgs, nil
+}
+
+// reclaim takes over one message that another consumer left idle
+func (e *streamEngine) reclaim(ctx context.Context, consumer, stream string) (string, error) {
+	msgs, _, err := e.client.XAutoClaim(ctx, &redis.XAutoClaimArgs{
+		Stream:   stream,
+		Group:    StreamGroup,
+		Consumer: consumer,
+		MinIdle:  e.claimIdle,
+		Start:    "0-0",
+		Count:    1,
+	}).Result()
+	if err != nil {
+		return "", fmt.Errorf("failed to reclaim jobs: %w", err)
+	}
+	if len(msgs) == 0 {
+		return "", nil
+	}
+
+	jobID, _, err := e.track(ctx, streamMessage{stream: stream, XMessage: msgs[0]})
+	return jobID, err
+}
+
+// track records where an in-flight job's message lives so it can be acked
+func (e *streamEngine) track(ctx context.Context, msg streamMessage) (string, bool, error) {
+	jobID, _ := msg.Values["job_id"].(string)
+	if jobID == "" {
+		// Entry deleted while pending; nothing left to process
+		e.client.XAck(ctx, msg.stream, StreamGroup, msg.ID)
+		return "", false, nil
+	}
+	if err := e.client.HSet(ctx, StreamInflightKey, jobID, msg.stream+" "+msg.ID).Err(); err != nil {
+		return "", false, fmt.Errorf("failed to track job: %w", err)
+	}
+	return jobID, false, nil
+}
+
+// handBack returns a message this consumer can't take right now by
+// re-adding it at the end of its stream
+func (e *streamEngine) handBack(ctx context.Context, msg streamMessage) error {
+	pipe := e.client.TxPipeline()
+	pipe.XAdd(ctx, &redis.XAddArgs{Stream: msg.stream, Values: msg.Values})
+	pipe.XAck(ctx, msg.stream, StreamGroup, msg.ID)
+	pipe.XDel(ctx, msg.stream, msg.ID)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to hand back job: %w", err)
+	}
+	return nil
+}
+
+func (e *streamEngine) ack(ctx context.Context, pipe redis.Pipeliner, jobID string) error {
+	stream, msgID, err := e.locate(ctx, jobID)
+	if err != nil || msgID == "" {
+		return err
+	}
+
+	pipe.XAck(ctx, stream, StreamGroup, msgID)
+	pipe.XDel(ctx, stream, msgID)
+	pipe.HDel(ctx, StreamInflightKey, jobID)
+	return nil
+}
+
+// touch resets the idle time of a job's message by claiming it again for
+// the same consumer
+func (e *streamEngine) touch(ctx context.Context, consumer, jobID string) error {
+	stream, msgID, err := e.locate(ctx, jobID)
+	if err != nil || msgID == "" {
+		return err
+	}
+
+	err = e.client.XClaimJustID(ctx, &redis.XClaimArgs{
+		Stream:   stream,
+		Group:    StreamGroup,
+		Consumer: consumer,
+		Messages: []string{msgID},
+	}).Err()
+	if err != nil {
+		return fmt.Errorf("failed to extend job claim: %w", err)
+	}
+	return nil
+}
+
+// locate returns the stream and message ID of an in-flight job, or empty
+// strings if the job isn't tracked
+func (e *streamEngine) locate(ctx context.Context, jobID string) (string, string, error) {
+	location, err := e.client.HGet(ctx, StreamInflightKey, jobID).Result()
+	if err == redis.Nil {
+		return "", "", nil
+	}
+	if err != nil {
+		return "", "", fmt.Errorf("failed to look up job message: %w", err)
+	}
+
+	stream, msgID, ok := strings.Cut(location, " ")
+	if !ok {
+		return "", "", fmt.Errorf("invalid job message location: %s", location)
+	}
+	return stream, msgID, nil
+}
+
+func (e *streamEngine) inspect(ctx context.Context, jobTypes []types.JobType) ([]queueState, error) {
+	queues := make([]queueState, len(jobTypes))
+	for i, jobType := range jobTypes {
+		stream := StreamKey(jobType)
+		queues[i].name = stream
+		if err := e.ensureGroup(ctx, stream); err != nil {
+			return nil, err
+		}
+
+		groups, err := e.client.XInfoGroups(ctx, stream).Result()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read queue depth: %w", err)
+		}
+		for _, group := range groups {
+			if group.Name != StreamGroup {
+				continue
+			}
+			queues[i].pending = group.Lag
+			queues[i].processing = group.Pending
+
+			// The oldest undelivered message follows the last delivered one
+			msgs, err := e.client.XRangeN(ctx, stream, "("+group.LastDeliveredID, "+", 1).Result()
+			if err != nil {
+				return nil, fmt.Errorf("failed to read queue depth: %w", err)
+			}
+			if len(msgs) > 0 {
+				queues[i].oldestJobID, _ = msgs[0].Values["job_id"].(string)
+			}
+		}
+	}
+	return queues, nil
+}
+
+// ensureGroup creates the consumer group for a stream once per process
+func (e *streamEngine) ensureGroup(ctx context.Context, stream string) error {
+	e.mu.Lock()
+	known := e.groups[stream]
+	e.mu.Unlock()
+	if known {
+		return nil
+	}
+
+	err := e.client.XGroupCreateMkStream(ctx, stream, StreamGroup, "0").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return fmt.Errorf("failed to create consumer group: %w", err)
+	}
+
+	e.mu.Lock()
+	e.groups[stream] = true
+	e.mu.Unlock()
+	return nil
+}
+
+// reclaimDue rate-limits XAUTOCLAIM scans to a tenth of the idle period
+func (e *streamEngine) reclaimDue() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if time.Since(e.lastReclaim) < e.claimIdle/10 {
+		return false
+	}
+	e.lastReclaim = time.Now()
+	return true
+}
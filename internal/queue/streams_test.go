@@ -0,0 +1,252 @@
+package queue
+
+import (
+	"context"
+	"sort"
+	"taskflow/internal/testutil"
+	"taskflow/internal/types"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// newTestStreamEngine returns a stream engine on an empty test Redis
+func newTestStreamEngine(t *testing.T, claimIdle time.Duration) (*streamEngine, *redis.Client) {
+	t.Helper()
+	client := testutil.Redis(t)
+	return newStreamEngine(client, claimIdle), client
+}
+
+// pushTestJobs queues jobs with the given IDs on the engine
+func pushTestJobs(t *testing.T, e *streamEngine, jobType types.JobType, ids ...string) {
+	t.Helper()
+	ctx := context.Background()
+	pipe := e.client.Pipeline()
+	for _, id := range ids {
+		e.push(ctx, pipe, &types.Job{ID: id, Type: jobType}, false)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		t.Fatalf("push: %v", err)
+	}
+}
+
+func TestStreamEngineClaimAndAck(t *testing.T) {
+	e, client := newTestStreamEngine(t, time.Minute)
+	ctx := context.Background()
+	jobTypes := []types.JobType{types.JobTypeEmail}
+	pushTestJobs(t, e, types.JobTypeEmail, "job-1", "job-2")
+
+	for _, want := range []string{"job-1", "job-2"} {
+		jobID, reclaimed, err := e.claim(ctx, "worker-1", jobTypes, time.Second)
+		if err != nil || jobID != want || reclaimed {
+			t.Fatalf("claim = %q, %v, %v; want new job %s", jobID, reclaimed, err, want)
+		}
+	}
+	if jobID, _, err := e.claim(ctx, "worker-1", jobTypes, 100*time.Millisecond); err != nil || jobID != "" {
+		t.Fatalf("claim of an empty stream = %q, %v; want nothing", jobID, err)
+	}
+
+	pipe := client.Pipeline()
+	if err := e.ack(ctx, pipe, "job-1"); err != nil {
+		t.Fatalf("ack: %v", err)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		t.Fatalf("ack: %v", err)
+	}
+
+	stream := StreamKey(types.JobTypeEmail)
+	if n := client.XLen(ctx, stream).Val(); n != 1 {
+		t.Errorf("stream holds %d messages after one of two jobs was acked, want 1", n)
+	}
+	if pending := client.XPending(ctx, stream, StreamGroup).Val(); pending.Count != 1 {
+		t.Errorf("%d messages pending after one of two jobs was acked, want 1", pending.Count)
+	}
+	if client.HExists(ctx, StreamInflightKey, "job-1").Val() {
+		t.Error("acked job is still tracked as in flight")
+	}
+	if !client.HExists(ctx, StreamInflightKey, "job-2").Val() {
+		t.Error("unacked job isn't tracked as in flight")
+	}
+
+	// Acking an untracked job is a no-op
+	if err := e.ack(ctx, client.Pipeline(), "job-1"); err != nil {
+		t.Errorf("ack of an untracked job: %v", err)
+	}
+}
+
+func TestStreamEngineReclaim(t *testing.T) {
+	idle := 300 * time.Millisecond
+	e, client := newTestStreamEngine(t, idle)
+	ctx := context.Background()
+	jobTypes := []types.JobType{types.JobTypeWebhook}
+	pushTestJobs(t, e, types.JobTypeWebhook, "job-1")
+
+	if jobID, _, err := e.claim(ctx, "worker-1", jobTypes, time.Second); err != nil || jobID != "job-1" {
+		t.Fatalf("claim = %q, %v; want job-1", jobID, err)
+	}
+	if jobID, _, err := e.claim(ctx, "worker-2", jobTypes, 50*time.Millisecond); err != nil || jobID != "" {
+		t.Fatalf("claim before the job is idle = %q, %v; want nothing", jobID, err)
+	}
+
+	// A worker that keeps touching its job keeps it
+	time.Sleep(2 * idle / 3)
+	if err := e.touch(ctx, "worker-1", "job-1"); err != nil {
+		t.Fatalf("touch: %v", err)
+	}
+	time.Sleep(2 * idle / 3)
+	if jobID, _, err := e.claim(ctx, "worker-2", jobTypes, 50*time.Millisecond); err != nil || jobID != "" {
+		t.Fatalf("claim of a touched job = %q, %v; want nothing", jobID, err)
+	}
+
+	time.Sleep(idle)
+	jobID, reclaimed, err := e.claim(ctx, "worker-2", jobTypes, 50*time.Millisecond)
+	if err != nil || jobID != "job-1" || !reclaimed {
+		t.Fatalf("claim of an idle job = %q, %v, %v; want job-1 reclaimed", jobID, reclaimed, err)
+	}
+
+	pending := client.XPendingExt(ctx, &redis.XPendingExtArgs{
+		Stream: StreamKey(types.JobTypeWebhook),
+		Group:  StreamGroup,
+		Start:  "-",
+		End:    "+",
+		Count:  10,
+	}).Val()
+	if len(pending) != 1 || pending[0].Consumer != "worker-2" {
+		t.Errorf("pending messages = %+v, want job-1 held by worker-2", pending)
+	}
+
+	// The reclaimed job is acked by ID like any other
+	pipe := client.Pipeline()
+	if err := e.ack(ctx, pipe, "job-1"); err != nil {
+		t.Fatalf("ack: %v", err)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		t.Fatalf("ack: %v", err)
+	}
+	if n := client.XLen(ctx, StreamKey(types.JobTypeWebhook)).Val(); n != 0 {
+		t.Errorf("stream holds %d messages after the reclaimed job was acked, want 0", n)
+	}
+}
+
+// TestStreamEngineHandBack checks that when a blocking read over several
+// streams delivers more than one message, the consumer takes one job and
+// the others stay claimable
+func TestStreamEngineHandBack(t *testing.T) {
+	e, client := newTestStreamEngine(t, time.Minute)
+	ctx := context.Background()
+	jobTypes := []types.JobType{types.JobTypeEmail, types.JobTypeWebhook, types.JobTypeImageResize}
+
+	// Create the groups first so that worker-1's blocking read sees the
+	// messages pushed below
+	for _, jobType := range jobTypes {
+		if err := e.ensureGroup(ctx, StreamKey(jobType)); err != nil {
+			t.Fatalf("ensureGroup: %v", err)
+		}
+	}
+
+	type result struct {
+		jobID string
+		err   error
+	}
+	claimed := make(chan result, 1)
+	go func() {
+		jobID, _, err := e.claim(ctx, "worker-1", jobTypes, 5*time.Second)
+		claimed <- result{jobID, err}
+	}()
+	time.Sleep(200 * time.Millisecond)
+
+	pipe := client.TxPipeline()
+	for i, jobType := range jobTypes {
+		e.push(ctx, pipe, &types.Job{ID: "job-" + string(rune('a'+i)), Type: jobType}, false)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		t.Fatalf("push: %v", err)
+	}
+
+	first := <-claimed
+	if first.err != nil || first.jobID == "" {
+		t.Fatalf("blocking claim = %q, %v; want a job", first.jobID, first.err)
+	}
+
+	got := []string{first.jobID}
+	for {
+		jobID, _, err := e.claim(ctx, "worker-2", jobTypes, 100*time.Millisecond)
+		if err != nil {
+			t.Fatalf("claim: %v", err)
+		}
+		if jobID == "" {
+			break
+		}
+		got = append(got, jobID)
+	}
+	sort.Strings(got)
+	if len(got) != 3 || got[0] != "job-a" || got[1] != "job-b" || got[2] != "job-c" {
+		t.Errorf("claimed jobs = %v, want each of job-a, job-b and job-c once", got)
+	}
+
+	// Handed back messages aren't left pending on worker-1
+	queues, err := e.inspect(ctx, jobTypes)
+	if err != nil {
+		t.Fatalf("inspect: %v", err)
+	}
+	var processing int64
+	for _, q := range queues {
+		processing += q.processing
+	}
+	if processing != 3 {
+		t.Errorf("%d jobs in flight, want 3", processing)
+	}
+}
+
+func TestStreamEngineInspect(t *testing.T) {
+	e, client := newTestStreamEngine(t, time.Minute)
+	ctx := context.Background()
+	jobTypes := []types.JobType{types.JobTypeEmail, types.JobTypeWebhook}
+
+	queues, err := e.inspect(ctx, jobTypes)
+	if err != nil {
+		t.Fatalf("inspect: %v", err)
+	}
+	for i, q := range queues {
+		if q.name != StreamKey(jobTypes[i]) || q.pending != 0 || q.processing != 0 || q.oldestJobID != "" {
+			t.Errorf("empty queue = %+v, want nothing waiting on %s", q, StreamKey(jobTypes[i]))
+		}
+	}
+
+	pushTestJobs(t, e, types.JobTypeEmail, "job-1", "job-2", "job-3")
+	if jobID, _, err := e.claim(ctx, "worker-1", []types.JobType{types.JobTypeEmail}, time.Second); err != nil || jobID != "job-1" {
+		t.Fatalf("claim = %q, %v; want job-1", jobID, err)
+	}
+
+	queues, err = e.inspect(ctx, jobTypes)
+	if err != nil {
+		t.Fatalf("inspect: %v", err)
+	}
+	if q := queues[0]; q.pending != 2 || q.processing != 1 || q.oldestJobID != "job-2" {
+		t.Errorf("email queue = %+v, want 2 pending from job-2 and 1 processing", q)
+	}
+	if q := queues[1]; q.pending != 0 || q.processing != 0 || q.oldestJobID != "" {
+		t.Errorf("webhook queue = %+v, want nothing waiting", q)
+	}
+
+	// Acked messages are deleted, which mustn't upset the lag
+	pipe := client.Pipeline()
+	if err := e.ack(ctx, pipe, "job-1"); err != nil {
+		t.Fatalf("ack: %v", err)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		t.Fatalf("ack: %v", err)
+	}
+	if jobID, _, err := e.claim(ctx, "worker-1", []types.JobType{types.JobTypeEmail}, time.Second); err != nil || jobID != "job-2" {
+		t.Fatalf("claim = %q, %v; want job-2", jobID, err)
+	}
+
+	queues, err = e.inspect(ctx, jobTypes)
+	if err != nil {
+		t.Fatalf("inspect: %v", err)
+	}
+	if q := queues[0]; q.pending != 1 || q.processing != 1 || q.oldestJobID != "job-3" {
+		t.Errorf("email queue after an ack = %+v, want 1 pending from job-3 and 1 processing", q)
+	}
+}
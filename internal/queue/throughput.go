@@ -0,0 +1,123 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"taskflow/internal/types"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Throughput is counted per job type in one hash per minute, with fields
+// "<type>:enqueued" and "<type>:processed". Buckets expire after
+// throughputRetention.
+const (
+	ThroughputKeyPrefix = "taskflow:throughput:"
+	throughputRetention = 2 * time.Hour
+)
+
+// ThroughputKey returns the bucket hash for the minute containing t
+func ThroughputKey(t time.Time) string {
+	return ThroughputKeyPrefix + strconv.FormatInt(t.Truncate(time.Minute).Unix(), 10)
+}
+
+// recordThroughput counts an enqueued or processed job in the current bucket
+func recordThroughput(ctx context.Context, pipe redis.Pipeliner, job *types.Job, event string) {
+	key := ThroughputKey(time.Now())
+	pipe.HIncrBy(ctx, key, string(job.Type)+":"+event, 1)
+	pipe.Expire(ctx, key, throughputRetention)
+}
+
+// QueueMetrics describes the pending queue for one job type
+type QueueMetrics struct {
+	JobType          types.JobType `json:"job_type"`
+	Depth            int64         `json:"depth"`
+	OldestJobAge     time.Duration `json:"-"`
+	OldestJobSeconds float64       `json:"oldest_job_age_seconds"`
+	EnqueuedPerSec   float64       `json:"enqueued_per_second"`
+	ProcessedPerSec  float64       `json:"processed_per_second"`
+}
+
+// GetQueueMetrics reports depth, oldest job age and rates over window for
+// each job type
+func (r *RedisQueue) GetQueueMetrics(ctx context.Context, jobTypes []types.JobType, window time.Duration) ([]QueueMetrics, error) {
+	if window < time.Minute {
+		window = time.Minute
+	}
+	if window > throughputRetention {
+		window = throughputRetention
+	}
+
+	// Buckets covering the window, including the current partial minute
+	now := time.Now()
+	buckets := int(window / time.Minute)
+	pipe := r.client.Pipeline()
+	bucketCmds := make([]*redis.MapStringStringCmd, 0, buckets)
+	for i := 0; i < buckets; i++ {
+		bucketCmds = append(bucketCmds, pipe.HGetAll(ctx, ThroughputKey(now.Add(-time.Duration(i)*time.Minute))))
+	}
+
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, fmt.Errorf("failed to read queue metrics: %w", err)
+	}
+
+	queues, err := r.engine.inspect(ctx, jobTypes)
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make(map[string]int64)
+	for _, cmd := range bucketCmds {
+		for field, value := range cmd.Val() {
+			n, _ := strconv.ParseInt(value, 10, 64)
+			counts[field] += n
+		}
+	}
+
+	// The current bucket is partial, so rates are over the elapsed time
+	elapsed := time.Duration(buckets-1)*time.Minute + now.Sub(now.Truncate(time.Minute))
+	seconds := elapsed.Seconds()
+	if seconds < 1 {
+		seconds = 1
+	}
+
+	metrics := make([]QueueMetrics, len(jobTypes))
+	for i, jobType := range jobTypes {
+		m := QueueMetrics{
+			JobType:         jobType,
+			Depth:           queues[i].pending,
+			EnqueuedPerSec:  float64(counts[string(jobType)+":enqueued"]) / seconds,
+			ProcessedPerSec: float64(counts[string(jobType)+":processed"]) / seconds,
+		}
+
+		if jobID := queues[i].oldestJobID; jobID != "" {
+			if job, err := r.GetJob(ctx, jobID); err == nil {
+				// UpdatedAt is reset when a job is requeued, so this is the
+				// time it has been waiting rather than its total age
+				m.OldestJobAge = now.Sub(job.UpdatedAt)
+				m.OldestJobSeconds = m.OldestJobAge.Seconds()
+			}
+		}
+
+		metrics[i] = m
+	}
+
+	return metrics, nil
+}
+
+// GetPendingDepth returns the number of jobs waiting across the given job
+// types' pending queues
+func (r *RedisQueue) GetPendingDepth(ctx context.Context, jobTypes []types.JobType) (int64, error) {
+	queues, err := r.engine.inspect(ctx, jobTypes)
+	if err != nil {
+		return 0, err
+	}
+
+	var depth int64
+	for _, q := range queues {
+		depth += q.pending
+	}
+	return depth, nil
+}
@@ -0,0 +1,80 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"taskflow/internal/types"
+)
+
+// API servers announce changes to each other over these channels, so that
+// every server behind a load balancer answers the same way
+const (
+	// JobUpdatesChannel carries the IDs of jobs whose state changed, so
+	// that API servers can drop cached copies of them
+	JobUpdatesChannel = "taskflow:job_updates"
+
+	// SchemaUpdatesChannel carries the job types whose payload schema was
+	// registered, so that API servers reload it
+	SchemaUpdatesChannel = "taskflow:schema_updates"
+)
+
+// PublishJobUpdate announces that a job's state changed
+func (r *RedisQueue) PublishJobUpdate(ctx context.Context, jobID string) error {
+	if err := r.client.Publish(ctx, JobUpdatesChannel, jobID).Err(); err != nil {
+		return fmt.Errorf("failed to publish job update: %w", err)
+	}
+	return nil
+}
+
+// SubscribeJobUpdates delivers the IDs of jobs whose state changed until
+// ctx is cancelled
+func (r *RedisQueue) SubscribeJobUpdates(ctx context.Context) <-chan string {
+	return r.subscribe(ctx, JobUpdatesChannel)
+}
+
+// PublishSchemaUpdate announces that a job type's payload schema was
+// registered
+func (r *RedisQueue) PublishSchemaUpdate(ctx context.Context, jobType types.JobType) error {
+	if err := r.client.Publish(ctx, SchemaUpdatesChannel, string(jobType)).Err(); err != nil {
+		return fmt.Errorf("failed to publish schema update: %w", err)
+	}
+	return nil
+}
+
+// SubscribeSchemaUpdates delivers the job types whose payload schema was
+// registered until ctx is cancelled
+func (r *RedisQueue) SubscribeSchemaUpdates(ctx context.Context) <-chan string {
+	return r.subscribe(ctx, SchemaUpdatesChannel)
+}
+
+// subscribe delivers the messages published on channel until ctx is
+// cancelled. Messages published while the subscription reconnects are
+// lost, so subscribers also resync periodically.
+func (r *RedisQueue) subscribe(ctx context.Context, channel string) <-chan string {
+	pubsub := r.client.Subscribe(ctx, channel)
+	payloads := make(chan string)
+
+	go func() {
+		defer close(payloads)
+		defer pubsub.Close()
+
+		messages := pubsub.Channel()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case msg, ok := <-messages:
+				if !ok {
+					return
+				}
+				select {
+				case payloads <- msg.Payload:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	return payloads
+}
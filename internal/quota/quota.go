@@ -0,0 +1,281 @@
+package quota
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"taskflow/internal/queue"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	keyPrefix = "taskflow:quota:"
+	globalKey = "global"
+	window    = time.Minute
+)
+
+// Limits describes submission limits for a scope. Zero means unlimited.
+type Limits struct {
+	JobsPerMinute int `json:"jobs_per_minute"`
+	MaxQueuedJobs int `json:"max_queued_jobs"`
+}
+
+// Usage reports consumption of a single limit
+type Usage struct {
+	Limit     int        `json:"limit"` // 0 = unlimited
+	Used      int        `json:"used"`
+	Remaining int        `json:"remaining"`
+	ResetsAt  *time.Time `json:"resets_at,omitempty"`
+}
+
+// ScopeStatus reports usage of all limits for a tenant or globally
+type ScopeStatus struct {
+	JobsPerMinute Usage `json:"jobs_per_minute"`
+	QueuedJobs    Usage `json:"queued_jobs"`
+}
+
+// Status is the response body of GET /api/v1/quota
+type Status struct {
+	TenantID string      `json:"tenant_id"`
+	Tenant   ScopeStatus `json:"tenant"`
+	Global   ScopeStatus `json:"global"`
+}
+
+// Violation describes why a submission was rejected
+type Violation struct {
+	Scope      string // "tenant" or "global"
+	Limit      string // "jobs_per_minute" or "max_queued_jobs"
+	Max        int
+	RetryAfter time.Duration
+}
+
+func (v *Violation) Error() string {
+	switch v.Limit {
+	case "jobs_per_minute":
+		return fmt.Sprintf("%s limit of %d jobs per minute exceeded", v.Scope, v.Max)
+	default:
+		return fmt.Sprintf("%s limit of %d queued jobs reached", v.Scope, v.Max)
+	}
+}
+
+// checkAndIncrScript atomically verifies the per-minute counters for the
+// tenant and global scopes and increments both only if neither is exhausted.
+// Returns 0 on success, 1 if the tenant limit is hit, 2 if the global one is.
+var checkAndIncrScript = redis.NewScript(`
+local tenantLimit = tonumber(ARGV[1])
+local globalLimit = tonumber(ARGV[2])
+local ttl = tonumber(ARGV[3])
+
+if tenantLimit > 0 and tonumber(redis.call('GET', KEYS[1]) or '0') >= tenantLimit then
+	return 1
+end
+if globalLimit > 0 and tonumber(redis.call('GET', KEYS[2]) or '0') >= globalLimit then
+	return 2
+end
+
+redis.call('INCR', KEYS[1])
+redis.call('EXPIRE', KEYS[1], ttl)
+redis.call('INCR', KEYS[2])
+redis.call('EXPIRE', KEYS[2], ttl)
+return 0
+`)
+
+// releaseScript gives back one unit of each per-minute counter in KEYS,
+// without taking a counter below zero
+var releaseScript = redis.NewScript(`
+for _, key in ipairs(KEYS) do
+	if tonumber(redis.call('GET', key) or '0') > 0 then
+		redis.call('DECR', key)
+	end
+end
+return 0
+`)
+
+// Reservation is the quota consumed by an allowed submission
+type Reservation struct {
+	keys []string // per-minute counters incremented
+}
+
+// Manager enforces submission quotas using Redis counters
+type Manager struct {
+	client   redis.UniversalClient
+	global   Limits
+	defaults Limits
+}
+
+// NewManager creates a quota manager. Global limits apply across all
+// tenants; defaults apply to tenants that don't configure their own.
+func NewManager(client redis.UniversalClient, global, defaults Limits) *Manager {
+	return &Manager{
+		client:   client,
+		global:   global,
+		defaults: defaults,
+	}
+}
+
+// Resolve fills in unset tenant limits with the configured defaults
+func (m *Manager) Resolve(limits Limits) Limits {
+	if limits.JobsPerMinute == 0 {
+		limits.JobsPerMinute = m.defaults.JobsPerMinute
+	}
+	if limits.MaxQueuedJobs == 0 {
+		limits.MaxQueuedJobs = m.defaults.MaxQueuedJobs
+	}
+	return limits
+}
+
+// Reserve checks the tenant's limits and, if the submission is allowed,
+// consumes one unit of its per-minute quota. A *Violation is returned when
+// the submission must be rejected. If the submission fails after all, the
+// returned reservation should be given back with Release.
+//
+// The queued job limits are soft: a job counts against them once it is
+// queued, not when Reserve allows it, so concurrent submissions can take a
+// tenant a few jobs past its limit.
+func (m *Manager) Reserve(ctx context.Context, tenantID string, limits Limits) (*Reservation, error) {
+	limits = m.Resolve(limits)
+
+	// Queued job limits are checked against the live queue counters
+	if limits.MaxQueuedJobs > 0 || m.global.MaxQueuedJobs > 0 {
+		tenantQueued, globalQueued, err := m.queuedJobs(ctx, tenantID)
+		if err != nil {
+			return nil, err
+		}
+		if limits.MaxQueuedJobs > 0 && tenantQueued >= limits.MaxQueuedJobs {
+			return nil, &Violation{Scope: "tenant", Limit: "max_queued_jobs", Max: limits.MaxQueuedJobs}
+		}
+		if m.global.MaxQueuedJobs > 0 && globalQueued >= m.global.MaxQueuedJobs {
+			return nil, &Violation{Scope: "global", Limit: "max_queued_jobs", Max: m.global.MaxQueuedJobs}
+		}
+	}
+
+	if limits.JobsPerMinute == 0 && m.global.JobsPerMinute == 0 {
+		return &Reservation{}, nil
+	}
+
+	windowStart := currentWindow()
+	keys := []string{
+		rateKey(tenantID, windowStart),
+		rateKey(globalKey, windowStart),
+	}
+
+	res, err := checkAndIncrScript.Run(ctx, m.client, keys,
+		limits.JobsPerMinute, m.global.JobsPerMinute, int(window.Seconds())*2,
+	).Int()
+	if err != nil {
+		return nil, fmt.Errorf("failed to check rate quota: %w", err)
+	}
+
+	retryAfter := time.Until(windowStart.Add(window))
+	switch res {
+	case 1:
+		return nil, &Violation{Scope: "tenant", Limit: "jobs_per_minute", Max: limits.JobsPerMinute, RetryAfter: retryAfter}
+	case 2:
+		return nil, &Violation{Scope: "global", Limit: "jobs_per_minute", Max: m.global.JobsPerMinute, RetryAfter: retryAfter}
+	}
+
+	return &Reservation{keys: keys}, nil
+}
+
+// Release gives back the quota of a submission that failed after Reserve
+// allowed it
+func (m *Manager) Release(ctx context.Context, res *Reservation) error {
+	if res == nil || len(res.keys) == 0 {
+		return nil
+	}
+	if err := releaseScript.Run(ctx, m.client, res.keys).Err(); err != nil {
+		return fmt.Errorf("failed to release rate quota: %w", err)
+	}
+	return nil
+}
+
+// Status reports current quota usage for a tenant
+func (m *Manager) Status(ctx context.Context, tenantID string, limits Limits) (*Status, error) {
+	limits = m.Resolve(limits)
+	windowStart := currentWindow()
+	resetsAt := windowStart.Add(window)
+
+	pipe := m.client.Pipeline()
+	tenantRate := pipe.Get(ctx, rateKey(tenantID, windowStart))
+	globalRate := pipe.Get(ctx, rateKey(globalKey, windowStart))
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, fmt.Errorf("failed to read rate counters: %w", err)
+	}
+
+	tenantQueued, globalQueued, err := m.queuedJobs(ctx, tenantID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Status{
+		TenantID: tenantID,
+		Tenant: ScopeStatus{
+			JobsPerMinute: usage(limits.JobsPerMinute, counterValue(tenantRate), &resetsAt),
+			QueuedJobs:    usage(limits.MaxQueuedJobs, tenantQueued, nil),
+		},
+		Global: ScopeStatus{
+			JobsPerMinute: usage(m.global.JobsPerMinute, counterValue(globalRate), &resetsAt),
+			QueuedJobs:    usage(m.global.MaxQueuedJobs, globalQueued, nil),
+		},
+	}, nil
+}
+
+// queuedFields are the queue's stats counters of jobs that haven't started.
+// Retrying jobs are counted under pending, and jobs waiting for their
+// scheduled_at under scheduled.
+var queuedFields = []string{"pending", "scheduled"}
+
+// queuedJobs reads the counters of jobs waiting to run maintained by the
+// queue
+func (m *Manager) queuedJobs(ctx context.Context, tenantID string) (int, int, error) {
+	pipe := m.client.Pipeline()
+	tenantQueued := pipe.HMGet(ctx, queue.TenantStatsKey(tenantID), queuedFields...)
+	globalQueued := pipe.HMGet(ctx, queue.StatsKey, queuedFields...)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, 0, fmt.Errorf("failed to read queued job counters: %w", err)
+	}
+
+	return counterSum(tenantQueued), counterSum(globalQueued), nil
+}
+
+// counterSum adds up the counters read by an HMGET, treating missing ones
+// as zero
+func counterSum(cmd *redis.SliceCmd) int {
+	sum := 0
+	for _, v := range cmd.Val() {
+		if s, ok := v.(string); ok {
+			n, _ := strconv.Atoi(s)
+			sum += n
+		}
+	}
+	return sum
+}
+
+func usage(limit, used int, resetsAt *time.Time) Usage {
+	u := Usage{Limit: limit, Used: used}
+	if limit > 0 {
+		u.Remaining = limit - used
+		if u.Remaining < 0 {
+			u.Remaining = 0
+		}
+		u.ResetsAt = resetsAt
+	}
+	return u
+}
+
+func counterValue(cmd *redis.StringCmd) int {
+	n, _ := strconv.Atoi(cmd.Val())
+	return n
+}
+
+func currentWindow() time.Time {
+	return time.Now().Truncate(window)
+}
+
+// rateKey returns a per-minute counter. Counters for the same minute share a
+// hash tag so checkAndIncrScript can update them together on Redis Cluster.
+func rateKey(scope string, windowStart time.Time) string {
+	return fmt.Sprintf("%s{%d}:%s", keyPrefix, windowStart.Unix(), scope)
+}
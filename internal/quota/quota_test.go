@@ -0,0 +1,199 @@
+package quota
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync"
+	"taskflow/internal/queue"
+	"taskflow/internal/testutil"
+	"testing"
+	"time"
+)
+
+func TestMain(m *testing.M) {
+	os.Exit(testutil.Run(m))
+}
+
+// reserveViolation returns the violation Reserve rejects a submission with,
+// or nil if it is allowed
+func reserveViolation(t *testing.T, m *Manager, tenantID string, limits Limits) *Violation {
+	t.Helper()
+	_, err := m.Reserve(context.Background(), tenantID, limits)
+	var violation *Violation
+	if err != nil && !errors.As(err, &violation) {
+		t.Fatalf("Reserve: %v", err)
+	}
+	return violation
+}
+
+// awayFromWindowEdge waits out the current window if it is about to end,
+// so that a test's submissions are counted in the same window
+func awayFromWindowEdge() {
+	if rest := time.Until(currentWindow().Add(window)); rest < 5*time.Second {
+		time.Sleep(rest)
+	}
+}
+
+func TestReserveJobsPerMinute(t *testing.T) {
+	m := NewManager(testutil.Redis(t), Limits{JobsPerMinute: 3}, Limits{JobsPerMinute: 2})
+	awayFromWindowEdge()
+
+	for i := 0; i < 2; i++ {
+		if v := reserveViolation(t, m, "acme", Limits{}); v != nil {
+			t.Fatalf("submission %d rejected: %v", i+1, v)
+		}
+	}
+	v := reserveViolation(t, m, "acme", Limits{})
+	if v == nil || v.Scope != "tenant" || v.Limit != "jobs_per_minute" || v.Max != 2 {
+		t.Fatalf("submission over the tenant limit = %+v, want a tenant jobs_per_minute violation", v)
+	}
+	if v.RetryAfter <= 0 || v.RetryAfter > window {
+		t.Errorf("RetryAfter = %v, want the rest of the window", v.RetryAfter)
+	}
+
+	// A rejected submission consumes nothing, so the global count is 2
+	if v := reserveViolation(t, m, "globex", Limits{JobsPerMinute: 10}); v != nil {
+		t.Fatalf("other tenant's submission rejected: %v", v)
+	}
+	v = reserveViolation(t, m, "globex", Limits{JobsPerMinute: 10})
+	if v == nil || v.Scope != "global" || v.Max != 3 {
+		t.Fatalf("submission over the global limit = %+v, want a global jobs_per_minute violation", v)
+	}
+
+	status, err := m.Status(context.Background(), "acme", Limits{})
+	if err != nil {
+		t.Fatalf("Status: %v", err)
+	}
+	if status.Tenant.JobsPerMinute.Used != 2 || status.Global.JobsPerMinute.Used != 3 {
+		t.Errorf("status = %+v, want 2 tenant and 3 global submissions", status)
+	}
+}
+
+func TestReserveWindowRollover(t *testing.T) {
+	client := testutil.Redis(t)
+	m := NewManager(client, Limits{}, Limits{})
+	awayFromWindowEdge()
+	ctx := context.Background()
+	limits := Limits{JobsPerMinute: 2}
+
+	// The previous minute used up the limit
+	previous := currentWindow().Add(-window)
+	client.Set(ctx, rateKey("acme", previous), 2, 2*window)
+
+	if v := reserveViolation(t, m, "acme", limits); v != nil {
+		t.Fatalf("first submission of a new window rejected: %v", v)
+	}
+	key := rateKey("acme", currentWindow())
+	if ttl := client.TTL(ctx, key).Val(); ttl <= window || ttl > 2*window {
+		t.Errorf("counter expires in %v, want within two windows", ttl)
+	}
+	if n, _ := client.Get(ctx, rateKey("acme", previous)).Int(); n != 2 {
+		t.Errorf("previous window's counter = %d, want it untouched at 2", n)
+	}
+}
+
+func TestReserveMaxQueuedJobs(t *testing.T) {
+	client := testutil.Redis(t)
+	m := NewManager(client, Limits{MaxQueuedJobs: 5}, Limits{})
+	ctx := context.Background()
+
+	client.HSet(ctx, queue.TenantStatsKey("acme"), "pending", 3)
+	client.HSet(ctx, queue.StatsKey, "pending", 4)
+	if v := reserveViolation(t, m, "acme", Limits{MaxQueuedJobs: 4}); v != nil {
+		t.Fatalf("submission under the queued limits rejected: %v", v)
+	}
+
+	// Jobs scheduled for later count too
+	client.HSet(ctx, queue.TenantStatsKey("acme"), "scheduled", 1)
+	if v := reserveViolation(t, m, "acme", Limits{MaxQueuedJobs: 4}); v == nil || v.Scope != "tenant" || v.Limit != "max_queued_jobs" {
+		t.Errorf("submission at the tenant's queued limit = %+v, want a tenant max_queued_jobs violation", v)
+	}
+
+	status, err := m.Status(ctx, "acme", Limits{MaxQueuedJobs: 4})
+	if err != nil {
+		t.Fatalf("Status: %v", err)
+	}
+	if status.Tenant.QueuedJobs.Used != 4 {
+		t.Errorf("tenant queued jobs = %d, want 3 pending and 1 scheduled", status.Tenant.QueuedJobs.Used)
+	}
+
+	client.HSet(ctx, queue.StatsKey, "pending", 3, "scheduled", 2)
+	if v := reserveViolation(t, m, "globex", Limits{}); v == nil || v.Scope != "global" || v.Limit != "max_queued_jobs" {
+		t.Errorf("submission at the global queued limit = %+v, want a global max_queued_jobs violation", v)
+	}
+}
+
+// TestReserveConcurrent checks that concurrent submissions never take more
+// than the limit between them
+func TestReserveConcurrent(t *testing.T) {
+	m := NewManager(testutil.Redis(t), Limits{}, Limits{})
+	limits := Limits{JobsPerMinute: 10}
+	awayFromWindowEdge()
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	allowed := 0
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := m.Reserve(context.Background(), "acme", limits)
+			var violation *Violation
+			if err != nil && !errors.As(err, &violation) {
+				t.Errorf("Reserve: %v", err)
+				return
+			}
+			if err == nil {
+				mu.Lock()
+				allowed++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if allowed != limits.JobsPerMinute {
+		t.Errorf("%d of 50 concurrent submissions allowed, want %d", allowed, limits.JobsPerMinute)
+	}
+}
+
+func TestRelease(t *testing.T) {
+	m := NewManager(testutil.Redis(t), Limits{JobsPerMinute: 100}, Limits{})
+	awayFromWindowEdge()
+	ctx := context.Background()
+	limits := Limits{JobsPerMinute: 1}
+
+	reservation, err := m.Reserve(ctx, "acme", limits)
+	if err != nil {
+		t.Fatalf("Reserve: %v", err)
+	}
+	if v := reserveViolation(t, m, "acme", limits); v == nil {
+		t.Fatal("submission over the limit allowed")
+	}
+
+	if err := m.Release(ctx, reservation); err != nil {
+		t.Fatalf("Release: %v", err)
+	}
+	status, err := m.Status(ctx, "acme", limits)
+	if err != nil {
+		t.Fatalf("Status: %v", err)
+	}
+	if status.Tenant.JobsPerMinute.Used != 0 || status.Global.JobsPerMinute.Used != 0 {
+		t.Errorf("status after Release = %+v, want no submissions", status)
+	}
+
+	// Releasing again doesn't take the counters below zero
+	if err := m.Release(ctx, reservation); err != nil {
+		t.Fatalf("Release twice: %v", err)
+	}
+	if err := m.Release(ctx, nil); err != nil {
+		t.Fatalf("Release of nothing: %v", err)
+	}
+	if v := reserveViolation(t, m, "acme", limits); v != nil {
+		t.Fatalf("submission after Release rejected: %v", v)
+	}
+	if v := reserveViolation(t, m, "acme", limits); v == nil {
+		t.Error("second submission after Release allowed; released quota was counted twice")
+	}
+}
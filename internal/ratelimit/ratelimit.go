@@ -0,0 +1,163 @@
+// Package ratelimit counts requests per client in fixed one-minute
+// windows, shared between API servers through Redis.
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	keyPrefix = "taskflow:ratelimit:"
+	window    = time.Minute
+)
+
+// Limits maps a route group to the requests per minute a client may make.
+// Groups without a limit are unlimited.
+type Limits map[string]int
+
+// ParseLimits parses limits in the form "submit=60,read=600"
+func ParseLimits(spec string) (Limits, error) {
+	limits := make(Limits)
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		group, value, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid rate limit %q: expected group=requests", entry)
+		}
+		limit, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil || limit < 0 {
+			return nil, fmt.Errorf("invalid rate limit for %s: %q", group, value)
+		}
+		limits[strings.TrimSpace(group)] = limit
+	}
+	return limits, nil
+}
+
+// Result is the outcome of counting a request
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	ResetAt   time.Time
+}
+
+// counter increments the request count of a key in the current window
+type counter interface {
+	incr(ctx context.Context, key string, now, resetAt time.Time) (int64, error)
+}
+
+// Limiter enforces per-client limits for route groups
+type Limiter struct {
+	mu      sync.RWMutex
+	limits  Limits
+	counter counter
+	now     func() time.Time
+}
+
+// NewLimiter creates a limiter that keeps counts in Redis
+func NewLimiter(client redis.UniversalClient, limits Limits) *Limiter {
+	return &Limiter{limits: limits, counter: &redisCounter{client: client}, now: time.Now}
+}
+
+// NewMemoryLimiter creates a limiter that keeps counts in process, so
+// each API server enforces the limits separately
+func NewMemoryLimiter(limits Limits) *Limiter {
+	return &Limiter{limits: limits, counter: newMemoryCounter(), now: time.Now}
+}
+
+// Allow counts a request by client to a route group. Requests to groups
+// without a limit are always allowed and not counted.
+func (l *Limiter) Allow(ctx context.Context, group, client string) (*Result, error) {
+	if l == nil {
+		return &Result{Allowed: true}, nil
+	}
+	l.mu.RLock()
+	limit := l.limits[group]
+	l.mu.RUnlock()
+	return l.AllowLimit(ctx, group, client, limit)
+}
+
+// SetLimits replaces the limits of every route group. Counts in the
+// current window carry over.
+func (l *Limiter) SetLimits(limits Limits) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.limits = limits
+}
+
+// AllowLimit counts a request by client to a group with the given
+// per-minute limit, for limits configured outside the limiter. A zero
+// limit always allows the request without counting it.
+func (l *Limiter) AllowLimit(ctx context.Context, group, client string, limit int) (*Result, error) {
+	if l == nil || limit == 0 {
+		return &Result{Allowed: true}, nil
+	}
+
+	now := l.now()
+	start := now.Truncate(window)
+	resetAt := start.Add(window)
+	key := fmt.Sprintf("%s%s:%s:%d", keyPrefix, group, client, start.Unix())
+
+	count, err := l.counter.incr(ctx, key, now, resetAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Result{
+		Allowed:   count <= int64(limit),
+		Limit:     limit,
+		Remaining: max(limit-int(count), 0),
+		ResetAt:   resetAt,
+	}, nil
+}
+
+type redisCounter struct {
+	client redis.UniversalClient
+}
+
+func (c *redisCounter) incr(ctx context.Context, key string, now, resetAt time.Time) (int64, error) {
+	pipe := c.client.TxPipeline()
+	incr := pipe.Incr(ctx, key)
+	pipe.ExpireAt(ctx, key, resetAt.Add(window))
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, fmt.Errorf("failed to count request: %w", err)
+	}
+	return incr.Val(), nil
+}
+
+type memoryCounter struct {
+	mu      sync.Mutex
+	counts  map[string]int64
+	expires map[string]time.Time
+}
+
+func newMemoryCounter() *memoryCounter {
+	return &memoryCounter{counts: make(map[string]int64), expires: make(map[string]time.Time)}
+}
+
+func (c *memoryCounter) incr(ctx context.Context, key string, now, resetAt time.Time) (int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for k, expiresAt := range c.expires {
+		if !now.Before(expiresAt) {
+			delete(c.counts, k)
+			delete(c.expires, k)
+		}
+	}
+
+	c.counts[key]++
+	c.expires[key] = resetAt
+	return c.counts[key], nil
+}
@@ -0,0 +1,57 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestParseLimits(t *testing.T) {
+	limits, err := ParseLimits("submit=60, read=600,")
+	if err != nil {
+		t.Fatalf("ParseLimits() error = %v", err)
+	}
+	if limits["submit"] != 60 || limits["read"] != 600 || len(limits) != 2 {
+		t.Errorf("ParseLimits() = %v", limits)
+	}
+
+	for _, spec := range []string{"submit", "submit=fast", "submit=-1"} {
+		if _, err := ParseLimits(spec); err == nil {
+			t.Errorf("ParseLimits(%q) succeeded, want error", spec)
+		}
+	}
+}
+
+func TestLimiterAllow(t *testing.T) {
+	ctx := context.Background()
+	l := NewMemoryLimiter(Limits{"submit": 2})
+	now := time.Date(2024, 6, 1, 12, 0, 30, 0, time.UTC)
+	l.now = func() time.Time { return now }
+
+	for i, want := range []bool{true, true, false} {
+		result, err := l.Allow(ctx, "submit", "client-a")
+		if err != nil {
+			t.Fatalf("Allow() error = %v", err)
+		}
+		if result.Allowed != want {
+			t.Errorf("request %d allowed = %v, want %v", i+1, result.Allowed, want)
+		}
+		if result.ResetAt != time.Date(2024, 6, 1, 12, 1, 0, 0, time.UTC) {
+			t.Errorf("ResetAt = %v, want end of the minute", result.ResetAt)
+		}
+	}
+
+	// Other clients and groups are counted separately
+	if result, _ := l.Allow(ctx, "submit", "client-b"); !result.Allowed || result.Remaining != 1 {
+		t.Errorf("second client: %+v", result)
+	}
+	if result, _ := l.Allow(ctx, "read", "client-a"); !result.Allowed {
+		t.Error("unlimited group was limited")
+	}
+
+	// The count resets with the next window
+	now = now.Add(time.Minute)
+	if result, _ := l.Allow(ctx, "submit", "client-a"); !result.Allowed {
+		t.Error("request in the next window was limited")
+	}
+}
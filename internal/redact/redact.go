@@ -0,0 +1,176 @@
+package redact
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Placeholder replaces redacted values
+const Placeholder = "[REDACTED]"
+
+// Redactor masks the values at a set of JSON paths, so that personal data
+// and secrets in job payloads and results stay out of logs and the
+// database.
+//
+// Paths are written like "$.to" or "$.headers.Authorization". A "*"
+// segment matches any key or array element, and a path passes through
+// arrays, so "$.recipients.email" masks the email of every recipient.
+// Keys match case-insensitively, as header names do.
+type Redactor struct {
+	paths [][]string
+}
+
+// New compiles a Redactor from paths. A Redactor without paths masks
+// nothing.
+func New(paths []string) (*Redactor, error) {
+	r := &Redactor{}
+	for _, path := range paths {
+		path = strings.TrimSpace(path)
+		if path == "" {
+			continue
+		}
+
+		segments, err := parsePath(path)
+		if err != nil {
+			return nil, err
+		}
+		r.paths = append(r.paths, segments)
+	}
+	return r, nil
+}
+
+// Parse compiles a Redactor from a comma-separated list of paths such as
+// "$.to,$.headers.Authorization"
+func Parse(spec string) (*Redactor, error) {
+	return New(strings.Split(spec, ","))
+}
+
+func parsePath(path string) ([]string, error) {
+	rest, ok := strings.CutPrefix(path, "$")
+	if !ok {
+		return nil, fmt.Errorf("invalid redaction path %q: must start with $", path)
+	}
+	if rest == "" {
+		return nil, fmt.Errorf("invalid redaction path %q: the whole document can't be redacted", path)
+	}
+
+	rest, ok = strings.CutPrefix(rest, ".")
+	if !ok {
+		return nil, fmt.Errorf("invalid redaction path %q: expected . after $", path)
+	}
+	segments := strings.Split(rest, ".")
+	for _, segment := range segments {
+		if segment == "" {
+			return nil, fmt.Errorf("invalid redaction path %q: empty segment", path)
+		}
+	}
+	return segments, nil
+}
+
+// Enabled reports whether r masks anything
+func (r *Redactor) Enabled() bool {
+	return r != nil && len(r.paths) > 0
+}
+
+// Matches reports whether r masks the value at path, written like the
+// paths r was built from
+func (r *Redactor) Matches(path string) bool {
+	if !r.Enabled() {
+		return false
+	}
+
+	segments, err := parsePath(path)
+	if err != nil {
+		return false
+	}
+	for _, pattern := range r.paths {
+		if len(pattern) != len(segments) {
+			continue
+		}
+		matched := true
+		for i, segment := range pattern {
+			if segment != "*" && !strings.EqualFold(segment, segments[i]) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return true
+		}
+	}
+	return false
+}
+
+// Value returns value, or the placeholder if r masks path
+func (r *Redactor) Value(path string, value any) any {
+	if r.Matches(path) {
+		return Placeholder
+	}
+	return value
+}
+
+// Redact returns a copy of a JSON document with the values at r's paths
+// replaced by the placeholder. Documents that aren't JSON objects or
+// arrays, or that r doesn't change, are returned as they are.
+func (r *Redactor) Redact(data json.RawMessage) json.RawMessage {
+	if !r.Enabled() || len(data) == 0 {
+		return data
+	}
+
+	// Keep numbers as written rather than rounding them through float64
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var doc any
+	if err := decoder.Decode(&doc); err != nil {
+		return data
+	}
+
+	changed := false
+	for _, path := range r.paths {
+		doc = redactPath(doc, path, &changed)
+	}
+	if !changed {
+		return data
+	}
+
+	redacted, err := json.Marshal(doc)
+	if err != nil {
+		return data
+	}
+	return redacted
+}
+
+// redactPath masks the values at path below v
+func redactPath(v any, path []string, changed *bool) any {
+	switch node := v.(type) {
+	case []any:
+		for i, elem := range node {
+			switch {
+			case path[0] != "*":
+				node[i] = redactPath(elem, path, changed)
+			case len(path) == 1:
+				node[i] = Placeholder
+				*changed = true
+			default:
+				node[i] = redactPath(elem, path[1:], changed)
+			}
+		}
+		return node
+	case map[string]any:
+		for key, child := range node {
+			if path[0] != "*" && !strings.EqualFold(path[0], key) {
+				continue
+			}
+			if len(path) == 1 {
+				node[key] = Placeholder
+				*changed = true
+			} else {
+				node[key] = redactPath(child, path[1:], changed)
+			}
+		}
+		return node
+	}
+	return v
+}
@@ -0,0 +1,78 @@
+package redact
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestRedact(t *testing.T) {
+	r, err := Parse("$.to, $.headers.Authorization, $.recipients.email, $.cc.*")
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+
+	payload := `{"to":"a@example.com","subject":"Hi","size":12345678901234567890,` +
+		`"headers":{"authorization":"Bearer x","X-Trace":"1"},` +
+		`"recipients":[{"email":"b@example.com","name":"B"}],"cc":["c@example.com"]}`
+	got := r.Redact(json.RawMessage(payload))
+
+	var doc struct {
+		To         string
+		Subject    string
+		Size       json.Number
+		Headers    map[string]string
+		Recipients []map[string]string
+		CC         []string
+	}
+	if err := json.Unmarshal(got, &doc); err != nil {
+		t.Fatalf("redacted payload is not JSON: %v", err)
+	}
+
+	if doc.To != Placeholder || doc.Headers["authorization"] != Placeholder ||
+		doc.Recipients[0]["email"] != Placeholder || doc.CC[0] != Placeholder {
+		t.Errorf("sensitive fields were not redacted: %s", got)
+	}
+	if doc.Subject != "Hi" || doc.Headers["X-Trace"] != "1" || doc.Recipients[0]["name"] != "B" {
+		t.Errorf("other fields were changed: %s", got)
+	}
+	if doc.Size != "12345678901234567890" {
+		t.Errorf("size = %s, want it unchanged", doc.Size)
+	}
+
+	unchanged := json.RawMessage(`{"subject": "Hi"}`)
+	if got := r.Redact(unchanged); string(got) != string(unchanged) {
+		t.Errorf("Redact changed a document without matches: %s", got)
+	}
+}
+
+func TestMatches(t *testing.T) {
+	r, err := Parse("$.to,$.headers.*")
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+
+	for path, want := range map[string]bool{
+		"$.to":                    true,
+		"$.TO":                    true,
+		"$.headers.Authorization": true,
+		"$.subject":               false,
+		"$.headers":               false,
+	} {
+		if got := r.Matches(path); got != want {
+			t.Errorf("Matches(%q) = %v, want %v", path, got, want)
+		}
+	}
+
+	var disabled *Redactor
+	if disabled.Value("$.to", "a@example.com") != "a@example.com" {
+		t.Error("a nil Redactor should not redact")
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	for _, spec := range []string{"to", "$", "$to", "$.headers..x"} {
+		if _, err := Parse(spec); err == nil {
+			t.Errorf("Parse(%q) succeeded, want error", spec)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package signing
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const nonceKeyPrefix = "taskflow:signing:nonce:"
+
+// NonceStore remembers used signatures
+type NonceStore interface {
+	// Claim records a signature for ttl and reports whether it was unused
+	Claim(ctx context.Context, signature string, ttl time.Duration) (bool, error)
+}
+
+// RedisNonceStore shares used signatures between API servers
+type RedisNonceStore struct {
+	client redis.UniversalClient
+}
+
+// NewRedisNonceStore creates a nonce store on the given Redis client
+func NewRedisNonceStore(client redis.UniversalClient) *RedisNonceStore {
+	return &RedisNonceStore{client: client}
+}
+
+// Claim records a signature unless it is already recorded
+func (s *RedisNonceStore) Claim(ctx context.Context, signature string, ttl time.Duration) (bool, error) {
+	ok, err := s.client.SetNX(ctx, nonceKeyPrefix+signature, 1, ttl).Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to record request nonce: %w", err)
+	}
+	return ok, nil
+}
+
+// MemoryNonceStore remembers used signatures in process. It only protects
+// against replays to the same API server.
+type MemoryNonceStore struct {
+	mu      sync.Mutex
+	expires map[string]time.Time
+}
+
+// NewMemoryNonceStore creates an empty in-process nonce store
+func NewMemoryNonceStore() *MemoryNonceStore {
+	return &MemoryNonceStore{expires: make(map[string]time.Time)}
+}
+
+// Claim records a signature unless it is already recorded
+func (s *MemoryNonceStore) Claim(ctx context.Context, signature string, ttl time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for key, expiresAt := range s.expires {
+		if now.After(expiresAt) {
+			delete(s.expires, key)
+		}
+	}
+
+	if _, used := s.expires[signature]; used {
+		return false, nil
+	}
+	s.expires[signature] = now.Add(ttl)
+	return true, nil
+}
@@ -0,0 +1,51 @@
+package signing
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func signedHeader(secret string, timestamp time.Time, nonce string, body []byte) http.Header {
+	header := http.Header{}
+	header.Set(TimestampHeader, strconv.FormatInt(timestamp.Unix(), 10))
+	header.Set(NonceHeader, nonce)
+	header.Set(SignatureHeader, Sign(secret, timestamp.Unix(), nonce, body))
+	return header
+}
+
+func TestVerify(t *testing.T) {
+	ctx := context.Background()
+	body := []byte(`{"type":"email"}`)
+	now := time.Now()
+
+	v := NewVerifier(NewMemoryNonceStore())
+	if err := v.Verify(ctx, "secret", signedHeader("secret", now, "n1", body), body); err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		header http.Header
+		body   []byte
+		want   error
+	}{
+		{"replayed", signedHeader("secret", now, "n1", body), body, ErrReplayed},
+		{"wrong secret", signedHeader("other", now, "n2", body), body, ErrInvalidSignature},
+		{"tampered body", signedHeader("secret", now, "n3", body), []byte(`{"type":"webhook"}`), ErrInvalidSignature},
+		{"stale", signedHeader("secret", now.Add(-10*time.Minute), "n4", body), body, ErrStaleTimestamp},
+		{"future", signedHeader("secret", now.Add(10*time.Minute), "n5", body), body, ErrStaleTimestamp},
+		{"unsigned", http.Header{}, body, ErrMissingSignature},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := v.Verify(ctx, "secret", tt.header, tt.body); !errors.Is(err, tt.want) {
+				t.Errorf("Verify() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,53 @@
+package stats
+
+import (
+	"context"
+	"log"
+	"taskflow/internal/metrics"
+	"time"
+)
+
+// CollectMetrics sets the queue depth and worker gauges every interval
+// until ctx is done. Nothing else updates them, because they're read from
+// the queues and the workers table rather than counted as jobs move.
+func (e *Engine) CollectMetrics(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := e.collect(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("Failed to collect queue metrics: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// collect measures the queues and active workers once. Depth is reported
+// per job type as <type>:scheduled, <type>:pending and <type>:processing.
+func (e *Engine) collect(ctx context.Context) error {
+	stats, err := e.Get(ctx, "")
+	if err != nil {
+		return err
+	}
+
+	for jobType, ts := range stats.ByType {
+		metrics.SetQueueDepth(string(jobType)+":scheduled", ts.Scheduled)
+		metrics.SetQueueDepth(string(jobType)+":pending", ts.Pending)
+		metrics.SetQueueDepth(string(jobType)+":processing", ts.Processing)
+	}
+	metrics.SetJobsInQueue(stats.Pending)
+	metrics.SetJobsProcessing(stats.Processing)
+
+	workers, err := e.storage.GetWorkers(ctx)
+	if err != nil {
+		return err
+	}
+	metrics.SetWorkersActive(len(workers))
+
+	return nil
+}
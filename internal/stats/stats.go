@@ -0,0 +1,195 @@
+package stats
+
+import (
+	"context"
+	"log"
+	"taskflow/internal/queue"
+	"taskflow/internal/storage"
+	"taskflow/internal/types"
+	"time"
+)
+
+// Engine serves job statistics. Counters in Redis are updated as jobs move
+// but drift when an operation fails part way, so the engine reads pending and
+// processing jobs from the queues themselves and periodically rewrites the
+// counters from PostgreSQL and the queues.
+type Engine struct {
+	queue   queue.Queue
+	storage storage.Storage
+}
+
+// NewEngine creates a stats engine
+func NewEngine(q queue.Queue, s storage.Storage) *Engine {
+	return &Engine{queue: q, storage: s}
+}
+
+// Get returns statistics for a tenant, or across all tenants when tenantID
+// is empty. Pending and processing counts across all tenants, and the queue
+// breakdown, come from inspecting the queues; tenant counts come from the
+// counters as of the last reconciliation plus changes since.
+func (e *Engine) Get(ctx context.Context, tenantID string) (*types.JobStats, error) {
+	stats, err := e.queue.GetStats(ctx, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	if tenantID != "" {
+		return stats, nil
+	}
+
+	queues, err := e.queue.InspectQueues(ctx, types.DefaultSchemas.JobTypes())
+	if err != nil {
+		return nil, err
+	}
+	ApplyQueues(stats, queues)
+
+	return stats, nil
+}
+
+// Reconcile rewrites the stats counters. Totals and finished jobs are
+// counted in PostgreSQL. Pending and processing jobs are counted from the
+// queues across all tenants, and from PostgreSQL per tenant.
+func (e *Engine) Reconcile(ctx context.Context) error {
+	counts, err := e.storage.CountJobs(ctx)
+	if err != nil {
+		return err
+	}
+	queues, err := e.queue.InspectQueues(ctx, types.DefaultSchemas.JobTypes())
+	if err != nil {
+		return err
+	}
+
+	global, tenants := Aggregate(counts)
+	ApplyQueues(global, queues)
+	global.Queues = nil
+
+	if err := e.queue.SetStats(ctx, "", global); err != nil {
+		return err
+	}
+	for tenantID, stats := range tenants {
+		if err := e.queue.SetStats(ctx, tenantID, stats); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Run reconciles the counters every interval until ctx is cancelled
+func (e *Engine) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := e.Reconcile(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("Failed to reconcile stats: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Aggregate builds statistics from job counts, across all tenants and per
+// tenant. Retrying jobs count as pending.
+func Aggregate(counts []storage.JobCount) (*types.JobStats, map[string]*types.JobStats) {
+	global := newStats()
+	tenants := make(map[string]*types.JobStats)
+
+	for _, c := range counts {
+		tenantStats, ok := tenants[c.TenantID]
+		if !ok {
+			tenantStats = newStats()
+			tenants[c.TenantID] = tenantStats
+		}
+		add(global, c)
+		add(tenantStats, c)
+	}
+
+	return global, tenants
+}
+
+// ApplyQueues replaces pending and processing counts with what the queues
+// hold and adds the per-queue breakdown. Scheduled jobs wait on the same
+// queues, so they're left out of the pending count.
+func ApplyQueues(stats *types.JobStats, queues []types.QueueStats) {
+	if stats.ByType == nil {
+		stats.ByType = make(map[types.JobType]*types.TypeStats)
+	}
+
+	stats.Pending, stats.Processing = 0, 0
+	for _, ts := range stats.ByType {
+		ts.Pending, ts.Processing = 0, 0
+	}
+
+	for _, q := range queues {
+		ts, ok := stats.ByType[q.JobType]
+		if !ok {
+			ts = &types.TypeStats{}
+			stats.ByType[q.JobType] = ts
+		}
+		pending := max(q.Pending-ts.Scheduled, 0)
+		ts.Pending += pending
+		ts.Processing += q.Processing
+		stats.Pending += pending
+		stats.Processing += q.Processing
+	}
+
+	stats.Queues = queues
+}
+
+func newStats() *types.JobStats {
+	return &types.JobStats{ByType: make(map[types.JobType]*types.TypeStats)}
+}
+
+// add counts jobs into stats, in total and for their type
+func add(stats *types.JobStats, c storage.JobCount) {
+	ts, ok := stats.ByType[c.Type]
+	if !ok {
+		ts = &types.TypeStats{}
+		stats.ByType[c.Type] = ts
+	}
+
+	stats.Total += c.Count
+	ts.Total += c.Count
+
+	switch c.Status {
+	case types.JobStatusScheduled:
+		stats.Scheduled += c.Count
+		ts.Scheduled += c.Count
+	case types.JobStatusPending, types.JobStatusRetrying:
+		stats.Pending += c.Count
+		ts.Pending += c.Count
+	case types.JobStatusProcessing:
+		stats.Processing += c.Count
+		ts.Processing += c.Count
+	case types.JobStatusCompleted:
+		stats.Completed += c.Count
+		ts.Completed += c.Count
+	case types.JobStatusFailed:
+		stats.Failed += c.Count
+		ts.Failed += c.Count
+
+		// Jobs failed before error codes were recorded count as UNKNOWN
+		code := c.ErrorCode
+		if code == "" {
+			code = types.ErrorCodeUnknown
+		}
+		if stats.FailedByCode == nil {
+			stats.FailedByCode = make(map[types.ErrorCode]int)
+		}
+		if ts.FailedByCode == nil {
+			ts.FailedByCode = make(map[types.ErrorCode]int)
+		}
+		stats.FailedByCode[code] += c.Count
+		ts.FailedByCode[code] += c.Count
+	case types.JobStatusCancelled:
+		stats.Cancelled += c.Count
+		ts.Cancelled += c.Count
+	case types.JobStatusExpired:
+		stats.Expired += c.Count
+		ts.Expired += c.Count
+	}
+}
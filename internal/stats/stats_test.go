@@ -0,0 +1,159 @@
+package stats
+
+import (
+	"taskflow/internal/storage"
+	"taskflow/internal/types"
+	"testing"
+	"time"
+)
+
+func TestAggregateGroupsByTenantAndType(t *testing.T) {
+	counts := []storage.JobCount{
+		{TenantID: "acme", Type: types.JobTypeEmail, Status: types.JobStatusCompleted, Count: 5},
+		{TenantID: "acme", Type: types.JobTypeEmail, Status: types.JobStatusRetrying, Count: 2},
+		{TenantID: "globex", Type: types.JobTypeWebhook, Status: types.JobStatusFailed, Count: 1},
+		{TenantID: "globex", Type: types.JobTypeEmail, Status: types.JobStatusPending, Count: 3},
+	}
+
+	global, tenants := Aggregate(counts)
+
+	if global.Total != 11 || global.Completed != 5 || global.Failed != 1 || global.Pending != 5 {
+		t.Errorf("Unexpected global stats: %+v", global)
+	}
+	if email := global.ByType[types.JobTypeEmail]; email.Total != 10 || email.Pending != 5 {
+		t.Errorf("Unexpected email stats: %+v", email)
+	}
+	if acme := tenants["acme"]; acme.Total != 7 || acme.Pending != 2 {
+		t.Errorf("Unexpected acme stats: %+v", acme)
+	}
+	if globex := tenants["globex"]; globex.ByType[types.JobTypeWebhook].Failed != 1 {
+		t.Errorf("Unexpected globex webhook stats: %+v", globex.ByType[types.JobTypeWebhook])
+	}
+}
+
+func TestAggregateFailedByCode(t *testing.T) {
+	counts := []storage.JobCount{
+		{TenantID: "acme", Type: types.JobTypeWebhook, Status: types.JobStatusFailed, ErrorCode: types.ErrorCodeDownstream5xx, Count: 4},
+		{TenantID: "acme", Type: types.JobTypeWebhook, Status: types.JobStatusFailed, ErrorCode: types.ErrorCodeTimeout, Count: 1},
+		{TenantID: "globex", Type: types.JobTypeEmail, Status: types.JobStatusFailed, Count: 2}, // failed before codes were recorded
+		{TenantID: "globex", Type: types.JobTypeEmail, Status: types.JobStatusCompleted, Count: 3},
+	}
+
+	global, tenants := Aggregate(counts)
+
+	want := map[types.ErrorCode]int{types.ErrorCodeDownstream5xx: 4, types.ErrorCodeTimeout: 1, types.ErrorCodeUnknown: 2}
+	if len(global.FailedByCode) != len(want) {
+		t.Fatalf("FailedByCode = %v, want %v", global.FailedByCode, want)
+	}
+	for code, n := range want {
+		if global.FailedByCode[code] != n {
+			t.Errorf("FailedByCode[%s] = %d, want %d", code, global.FailedByCode[code], n)
+		}
+	}
+	if webhook := tenants["acme"].ByType[types.JobTypeWebhook]; webhook.FailedByCode[types.ErrorCodeDownstream5xx] != 4 {
+		t.Errorf("Unexpected acme webhook breakdown: %v", webhook.FailedByCode)
+	}
+	if email := tenants["globex"].ByType[types.JobTypeEmail]; email.FailedByCode[types.ErrorCodeUnknown] != 2 {
+		t.Errorf("Unexpected globex email breakdown: %v", email.FailedByCode)
+	}
+}
+
+func TestApplyQueuesReplacesPendingAndProcessing(t *testing.T) {
+	stats := &types.JobStats{
+		Total:      20,
+		Pending:    9, // drifted counters
+		Processing: -1,
+		Completed:  10,
+		ByType: map[types.JobType]*types.TypeStats{
+			types.JobTypeEmail: {Total: 20, Pending: 9, Processing: -1, Completed: 10},
+		},
+	}
+	queues := []types.QueueStats{
+		{Name: "email", JobType: types.JobTypeEmail, Pending: 4, Processing: 2},
+		{Name: "webhook", JobType: types.JobTypeWebhook, Pending: 1},
+	}
+
+	ApplyQueues(stats, queues)
+
+	if stats.Pending != 5 || stats.Processing != 2 {
+		t.Errorf("Expected 5 pending and 2 processing, got %d and %d", stats.Pending, stats.Processing)
+	}
+	if email := stats.ByType[types.JobTypeEmail]; email.Pending != 4 || email.Processing != 2 || email.Completed != 10 {
+		t.Errorf("Unexpected email stats: %+v", email)
+	}
+	if webhook := stats.ByType[types.JobTypeWebhook]; webhook == nil || webhook.Pending != 1 {
+		t.Errorf("Expected webhook queue to be added, got %+v", webhook)
+	}
+	if len(stats.Queues) != 2 {
+		t.Errorf("Expected 2 queues, got %d", len(stats.Queues))
+	}
+}
+
+func TestCancelledAndScheduledAreCountedApart(t *testing.T) {
+	stats, _ := Aggregate([]storage.JobCount{
+		{TenantID: "acme", Type: types.JobTypeEmail, Status: types.JobStatusFailed, Count: 1},
+		{TenantID: "acme", Type: types.JobTypeEmail, Status: types.JobStatusCancelled, Count: 2},
+		{TenantID: "acme", Type: types.JobTypeEmail, Status: types.JobStatusScheduled, Count: 3},
+	})
+	if stats.Failed != 1 || stats.Cancelled != 2 || stats.Scheduled != 3 || stats.Pending != 0 {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+
+	// Scheduled jobs wait on the pending queue too
+	ApplyQueues(stats, []types.QueueStats{{Name: "email", JobType: types.JobTypeEmail, Pending: 4}})
+	if stats.Pending != 1 || stats.Scheduled != 3 {
+		t.Errorf("Expected 1 pending and 3 scheduled, got %d and %d", stats.Pending, stats.Scheduled)
+	}
+}
+
+func TestTimeseriesRangeAlignsToIntervals(t *testing.T) {
+	now := time.Date(2024, 3, 1, 10, 17, 0, 0, time.UTC)
+
+	from, to, err := TimeseriesRange(now, 2*time.Hour, time.Hour)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if !to.Equal(time.Date(2024, 3, 1, 11, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expected range to end at 11:00, got %v", to)
+	}
+	if !from.Equal(time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expected range to start at 09:00, got %v", from)
+	}
+
+	if _, _, err := TimeseriesRange(now, 30*24*time.Hour, time.Minute); err == nil {
+		t.Error("Expected error for too many intervals")
+	}
+}
+
+func TestBuildTimeseriesFillsEmptyIntervals(t *testing.T) {
+	from := time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+	to := from.Add(3 * time.Hour)
+	p50 := 1.5
+
+	buckets := []storage.TimeseriesBucket{
+		{JobType: types.JobTypeWebhook, Bucket: 2, Created: 4, Completed: 3, LatencyP50: &p50},
+		{JobType: types.JobTypeWebhook, Bucket: -1, Created: 4, Completed: 3, LatencyP50: &p50},
+		{JobType: types.JobTypeEmail, Bucket: 0, Failed: 1},
+		{JobType: types.JobTypeEmail, Bucket: -1, Failed: 1},
+	}
+
+	ts := BuildTimeseries(buckets, from, to, time.Hour)
+
+	if len(ts.Series) != 2 || ts.Series[0].JobType != types.JobTypeEmail {
+		t.Fatalf("Expected email and webhook series in order, got %+v", ts.Series)
+	}
+	webhook := ts.Series[1]
+	if len(webhook.Points) != 3 {
+		t.Fatalf("Expected 3 points, got %d", len(webhook.Points))
+	}
+	if webhook.Points[0].Created != 0 || webhook.Points[2].Created != 4 {
+		t.Errorf("Unexpected webhook points: %+v", webhook.Points)
+	}
+	if !webhook.Points[2].Start.Equal(from.Add(2 * time.Hour)) {
+		t.Errorf("Expected last point to start at 11:00, got %v", webhook.Points[2].Start)
+	}
+	if webhook.Completed != 3 || webhook.LatencyP50 == nil || *webhook.LatencyP50 != 1.5 {
+		t.Errorf("Unexpected webhook totals: %+v", webhook)
+	}
+}
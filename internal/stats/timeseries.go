@@ -0,0 +1,95 @@
+package stats
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"taskflow/internal/storage"
+	"taskflow/internal/types"
+	"time"
+)
+
+// MaxTimeseriesPoints bounds the number of intervals in a time series
+const MaxTimeseriesPoints = 1000
+
+// Timeseries returns job activity per interval between from and to, for a
+// tenant (all tenants when empty) and job type (all types when empty). Use
+// TimeseriesRange to pick from and to.
+func (e *Engine) Timeseries(ctx context.Context, tenantID, jobType string, from, to time.Time, interval time.Duration) (*types.StatsTimeseries, error) {
+	buckets, err := e.storage.JobTimeseries(ctx, tenantID, jobType, from, to, interval)
+	if err != nil {
+		return nil, err
+	}
+
+	return BuildTimeseries(buckets, from, to, interval), nil
+}
+
+// TimeseriesRange aligns a window ending at now to whole intervals, so that
+// the last interval contains now
+func TimeseriesRange(now time.Time, window, interval time.Duration) (from, to time.Time, err error) {
+	if interval <= 0 || window <= 0 {
+		return from, to, fmt.Errorf("window and interval must be positive")
+	}
+	if window < interval {
+		return from, to, fmt.Errorf("window must be at least one interval")
+	}
+
+	points := int((window + interval - 1) / interval)
+	if points > MaxTimeseriesPoints {
+		return from, to, fmt.Errorf("window spans %d intervals, more than %d", points, MaxTimeseriesPoints)
+	}
+
+	to = now.Truncate(interval).Add(interval)
+	from = to.Add(-time.Duration(points) * interval)
+	return from, to, nil
+}
+
+// BuildTimeseries turns storage buckets into one series per job type with a
+// point for every interval, including empty ones
+func BuildTimeseries(buckets []storage.TimeseriesBucket, from, to time.Time, interval time.Duration) *types.StatsTimeseries {
+	points := int(to.Sub(from) / interval)
+	series := make(map[types.JobType]*types.StatsSeries)
+
+	get := func(jobType types.JobType) *types.StatsSeries {
+		s, ok := series[jobType]
+		if !ok {
+			s = &types.StatsSeries{JobType: jobType, Points: make([]types.StatsPoint, points)}
+			for i := range s.Points {
+				s.Points[i].Start = from.Add(time.Duration(i) * interval)
+			}
+			series[jobType] = s
+		}
+		return s
+	}
+
+	for _, b := range buckets {
+		s := get(b.JobType)
+		if b.Bucket < 0 {
+			s.Created, s.Completed, s.Failed = b.Created, b.Completed, b.Failed
+			s.LatencyP50, s.LatencyP95 = b.LatencyP50, b.LatencyP95
+			continue
+		}
+		if b.Bucket >= points {
+			continue
+		}
+
+		p := &s.Points[b.Bucket]
+		p.Created, p.Completed, p.Failed = b.Created, b.Completed, b.Failed
+		p.LatencyP50, p.LatencyP95 = b.LatencyP50, b.LatencyP95
+	}
+
+	result := &types.StatsTimeseries{
+		From:            from,
+		To:              to,
+		IntervalSeconds: interval.Seconds(),
+		Series:          make([]types.StatsSeries, 0, len(series)),
+	}
+	for _, s := range series {
+		result.Series = append(result.Series, *s)
+	}
+	sort.Slice(result.Series, func(i, j int) bool {
+		return result.Series[i].JobType < result.Series[j].JobType
+	})
+
+	return result
+}
@@ -0,0 +1,95 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"taskflow/internal/types"
+	"time"
+)
+
+// Each run of a job is recorded in job_attempts when a worker claims it,
+// and completed with its outcome when it ends. A job has at most one open
+// attempt: claiming it again ends the previous one as abandoned.
+
+// StartAttempt records that a worker started running a claimed job
+func (p *PostgresStorage) StartAttempt(ctx context.Context, job *types.Job) error {
+	startedAt := time.Now()
+	if job.StartedAt != nil {
+		startedAt = *job.StartedAt
+	}
+
+	query := `
+		WITH abandoned AS (
+			UPDATE job_attempts
+			SET ended_at = $4, outcome = $5,
+				duration_ms = (EXTRACT(EPOCH FROM $4 - started_at) * 1000)::bigint
+			WHERE job_id = $1 AND ended_at IS NULL
+		)
+		INSERT INTO job_attempts (job_id, attempt, worker_id, started_at)
+		VALUES ($1, $2, $3, $4)
+	`
+
+	_, err := p.exec(ctx, query, job.ID, job.Attempts+1, nullString(job.WorkerID), startedAt, types.AttemptAbandoned)
+	if err != nil {
+		return fmt.Errorf("failed to record job attempt: %w", err)
+	}
+	return nil
+}
+
+// EndAttempt records how a job's open attempt ended. It does nothing if
+// the job has none, e.g. when a job is cancelled before it ran.
+func (p *PostgresStorage) EndAttempt(ctx context.Context, jobID string, outcome types.AttemptOutcome, errorMsg string) error {
+	query := `
+		UPDATE job_attempts
+		SET ended_at = $2, outcome = $3, error = $4,
+			duration_ms = (EXTRACT(EPOCH FROM $2 - started_at) * 1000)::bigint
+		WHERE job_id = $1 AND ended_at IS NULL
+	`
+
+	if _, err := p.exec(ctx, query, jobID, time.Now(), outcome, nullString(errorMsg)); err != nil {
+		return fmt.Errorf("failed to end job attempt: %w", err)
+	}
+	return nil
+}
+
+// JobAttempts returns a job's attempts, oldest first
+func (p *PostgresStorage) JobAttempts(ctx context.Context, jobID string) ([]types.JobAttempt, error) {
+	query := `
+		SELECT attempt, worker_id, started_at, ended_at, outcome, error, duration_ms
+		FROM job_attempts
+		WHERE job_id = $1
+		ORDER BY started_at, id
+	`
+
+	rows, err := p.db.QueryContext(ctx, query, jobID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query job attempts: %w", err)
+	}
+	defer rows.Close()
+
+	attempts := []types.JobAttempt{}
+	for rows.Next() {
+		var a types.JobAttempt
+		var workerID, outcome, errorMsg sql.NullString
+		var endedAt sql.NullTime
+		var duration sql.NullInt64
+		if err := rows.Scan(&a.Attempt, &workerID, &a.StartedAt, &endedAt, &outcome, &errorMsg, &duration); err != nil {
+			return nil, fmt.Errorf("failed to scan job attempt: %w", err)
+		}
+		a.WorkerID = workerID.String
+		a.Outcome = types.AttemptOutcome(outcome.String)
+		a.Error = errorMsg.String
+		a.DurationMs = duration.Int64
+		if endedAt.Valid {
+			a.EndedAt = &endedAt.Time
+		}
+		attempts = append(attempts, a)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating job attempts: %w", err)
+	}
+
+	return attempts, nil
+}
@@ -0,0 +1,103 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"taskflow/internal/types"
+	"time"
+)
+
+// Administrative actions are appended to audit_log and never updated, so
+// the table can be kept for compliance reviews.
+
+// RecordAudit appends an entry to the audit log
+func (p *PostgresStorage) RecordAudit(ctx context.Context, entry *types.AuditEntry) error {
+	if entry.CreatedAt.IsZero() {
+		entry.CreatedAt = time.Now()
+	}
+
+	query := `
+		INSERT INTO audit_log (action, actor, tenant_id, target, before, after, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id
+	`
+
+	err := p.db.QueryRowContext(ctx, query, entry.Action, entry.Actor, nullString(entry.TenantID),
+		entry.Target, nullJSON(entry.Before), nullJSON(entry.After), entry.CreatedAt).Scan(&entry.ID)
+	if err != nil {
+		return fmt.Errorf("failed to record audit entry: %w", err)
+	}
+	return nil
+}
+
+// AuditLog returns the entries matching filter, newest first
+func (p *PostgresStorage) AuditLog(ctx context.Context, filter types.AuditFilter) ([]types.AuditEntry, error) {
+	var conditions []string
+	var args []interface{}
+	add := func(condition string, value interface{}) {
+		args = append(args, value)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+
+	if filter.Action != "" {
+		add("action = $%d", filter.Action)
+	}
+	if filter.Actor != "" {
+		add("actor = $%d", filter.Actor)
+	}
+	if filter.TenantID != "" {
+		add("tenant_id = $%d", filter.TenantID)
+	}
+	if filter.Target != "" {
+		add("target = $%d", filter.Target)
+	}
+	if !filter.Since.IsZero() {
+		add("created_at >= $%d", filter.Since)
+	}
+	if !filter.Until.IsZero() {
+		add("created_at < $%d", filter.Until)
+	}
+	if filter.BeforeID > 0 {
+		add("id < $%d", filter.BeforeID)
+	}
+
+	where := ""
+	if len(conditions) > 0 {
+		where = "WHERE " + strings.Join(conditions, " AND ")
+	}
+	args = append(args, filter.Limit)
+	query := fmt.Sprintf(`
+		SELECT id, action, actor, tenant_id, target, before, after, created_at
+		FROM audit_log
+		%s
+		ORDER BY id DESC
+		LIMIT $%d
+	`, where, len(args))
+
+	rows, err := p.reader(ctx).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query audit log: %w", err)
+	}
+	defer rows.Close()
+
+	entries := []types.AuditEntry{}
+	for rows.Next() {
+		var e types.AuditEntry
+		var tenantID sql.NullString
+		var before, after []byte
+		if err := rows.Scan(&e.ID, &e.Action, &e.Actor, &tenantID, &e.Target, &before, &after, &e.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan audit entry: %w", err)
+		}
+		e.TenantID = tenantID.String
+		e.Before, e.After = before, after
+		entries = append(entries, e)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating audit log: %w", err)
+	}
+
+	return entries, nil
+}
@@ -0,0 +1,149 @@
+package storage
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"taskflow/internal/breaker"
+
+	"github.com/lib/pq"
+)
+
+// WithBreaker sends every database call through b, so that calls fail
+// fast with a *breaker.OpenError while PostgreSQL is down
+func WithBreaker(b *breaker.Breaker) Option {
+	return func(p *PostgresStorage) {
+		p.breaker = b
+	}
+}
+
+// breakerConnector opens pq connections that report the outcome of each
+// call to a circuit breaker
+type breakerConnector struct {
+	connector driver.Connector
+	breaker   *breaker.Breaker
+}
+
+func (c *breakerConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	if err := c.breaker.Allow(); err != nil {
+		return nil, err
+	}
+	conn, err := c.connector.Connect(ctx)
+	report(ctx, c.breaker, err)
+	if err != nil {
+		return nil, err
+	}
+	return &breakerConn{conn: conn, breaker: c.breaker}, nil
+}
+
+func (c *breakerConnector) Driver() driver.Driver {
+	return c.connector.Driver()
+}
+
+// breakerConn wraps a pq connection. pq implements every optional
+// interface used here.
+type breakerConn struct {
+	conn    driver.Conn
+	breaker *breaker.Breaker
+}
+
+// call runs fn unless the breaker is open and reports its outcome
+func (c *breakerConn) call(ctx context.Context, fn func() error) error {
+	if err := c.breaker.Allow(); err != nil {
+		return err
+	}
+	err := fn()
+	report(ctx, c.breaker, err)
+	return err
+}
+
+func (c *breakerConn) Prepare(query string) (driver.Stmt, error) {
+	return c.PrepareContext(context.Background(), query)
+}
+
+func (c *breakerConn) PrepareContext(ctx context.Context, query string) (stmt driver.Stmt, err error) {
+	err = c.call(ctx, func() error {
+		stmt, err = c.conn.(driver.ConnPrepareContext).PrepareContext(ctx, query)
+		return err
+	})
+	return stmt, err
+}
+
+func (c *breakerConn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (c *breakerConn) BeginTx(ctx context.Context, opts driver.TxOptions) (tx driver.Tx, err error) {
+	err = c.call(ctx, func() error {
+		tx, err = c.conn.(driver.ConnBeginTx).BeginTx(ctx, opts)
+		return err
+	})
+	return tx, err
+}
+
+func (c *breakerConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (rows driver.Rows, err error) {
+	err = c.call(ctx, func() error {
+		rows, err = c.conn.(driver.QueryerContext).QueryContext(ctx, query, args)
+		return err
+	})
+	return rows, err
+}
+
+func (c *breakerConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (result driver.Result, err error) {
+	err = c.call(ctx, func() error {
+		result, err = c.conn.(driver.ExecerContext).ExecContext(ctx, query, args)
+		return err
+	})
+	return result, err
+}
+
+func (c *breakerConn) Ping(ctx context.Context) error {
+	return c.call(ctx, func() error {
+		return c.conn.(driver.Pinger).Ping(ctx)
+	})
+}
+
+func (c *breakerConn) ResetSession(ctx context.Context) error {
+	return c.conn.(driver.SessionResetter).ResetSession(ctx)
+}
+
+func (c *breakerConn) IsValid() bool {
+	return c.conn.(driver.Validator).IsValid()
+}
+
+func (c *breakerConn) Close() error {
+	return c.conn.Close()
+}
+
+// report records the outcome of a database call. Errors returned by
+// PostgreSQL for the query itself, such as constraint violations, show
+// that it is up; only connection failures and errors saying it can't serve
+// count against it. Calls abandoned by their caller don't count either way.
+func report(ctx context.Context, b *breaker.Breaker, err error) {
+	var pqErr *pq.Error
+	switch {
+	case err == nil:
+		b.Success()
+	case errors.Is(err, driver.ErrSkip), ctx.Err() != nil:
+	case errors.As(err, &pqErr):
+		if unavailableClass(pqErr.Code.Class()) {
+			b.Failure()
+		} else {
+			b.Success()
+		}
+	default:
+		b.Failure()
+	}
+}
+
+// unavailableClass reports whether a PostgreSQL error class means the
+// server can't serve queries right now: connection exceptions,
+// insufficient resources, operator intervention (e.g. shutting down) and
+// system errors
+func unavailableClass(class pq.ErrorClass) bool {
+	switch class {
+	case "08", "53", "57", "58":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,57 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"taskflow/internal/types"
+)
+
+// SaveEmailTemplate creates or replaces an email template
+func (p *PostgresStorage) SaveEmailTemplate(ctx context.Context, tmpl *types.EmailTemplate) error {
+	query := `
+		INSERT INTO email_templates (name, source, html, updated_at)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (name) DO UPDATE SET
+			source = EXCLUDED.source,
+			html = EXCLUDED.html,
+			updated_at = EXCLUDED.updated_at
+	`
+
+	_, err := p.db.ExecContext(ctx, query, tmpl.Name, tmpl.Source, tmpl.HTML, tmpl.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to save email template: %w", err)
+	}
+
+	return nil
+}
+
+// GetEmailTemplate retrieves an email template by name
+func (p *PostgresStorage) GetEmailTemplate(ctx context.Context, name string) (*types.EmailTemplate, error) {
+	query := `SELECT name, source, html, updated_at FROM email_templates WHERE name = $1`
+
+	var tmpl types.EmailTemplate
+	err := p.db.QueryRowContext(ctx, query, name).Scan(&tmpl.Name, &tmpl.Source, &tmpl.HTML, &tmpl.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("%w: %s", ErrEmailTemplateNotFound, name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get email template: %w", err)
+	}
+
+	return &tmpl, nil
+}
+
+// DeleteEmailTemplate deletes an email template, returning an error
+// wrapping ErrEmailTemplateNotFound if there is none by that name
+func (p *PostgresStorage) DeleteEmailTemplate(ctx context.Context, name string) error {
+	result, err := p.db.ExecContext(ctx, `DELETE FROM email_templates WHERE name = $1`, name)
+	if err != nil {
+		return fmt.Errorf("failed to delete email template: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("%w: %s", ErrEmailTemplateNotFound, name)
+	}
+
+	return nil
+}
@@ -0,0 +1,22 @@
+package storage
+
+import "errors"
+
+// Sentinel errors returned when a record doesn't exist. Errors that wrap
+// them are reported to clients as not found; any other error means storage
+// failed.
+var (
+	ErrJobNotFound      = errors.New("job not found")
+	ErrWorkerNotFound   = errors.New("worker not found")
+	ErrWorkflowNotFound = errors.New("workflow not found")
+
+	ErrEmailTemplateNotFound = errors.New("email template not found")
+
+	// ErrResultNotFound is returned when a job has no stored result,
+	// because it hasn't completed or its result has expired
+	ErrResultNotFound = errors.New("job result not found")
+)
+
+// ErrJobConflict is returned when a job changed before an update could be
+// applied, because another writer updated it since it was read
+var ErrJobConflict = errors.New("job state changed concurrently")
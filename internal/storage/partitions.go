@@ -0,0 +1,351 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// The jobs table can be partitioned by month of created_at, so retention
+// drops whole partitions instead of deleting rows one by one. Partitions
+// are named jobs_pYYYYMM; the table a conversion attaches as the first
+// partition is named jobs_before_YYYYMM after the month it ends at, and
+// jobs_default catches rows outside every other partition. Month
+// boundaries are in UTC.
+//
+// PostgreSQL requires the partition key in every unique constraint, so a
+// partitioned jobs table's primary key is (id, created_at). Job IDs stay
+// unique because TaskFlow generates them and checks for existing ones
+// before creating follow-up and workflow jobs.
+
+// unfinishedJobStatuses are the statuses retention never deletes
+const unfinishedJobStatuses = `'scheduled', 'pending', 'processing', 'retrying'`
+
+// deleteJobsBatch bounds the rows of one retention DELETE, keeping its
+// locks short
+const deleteJobsBatch = 5000
+
+// JobPartition is a monthly partition of the jobs table. Rows created from
+// From up to, not including, To are stored in it; a zero From means no
+// lower bound.
+type JobPartition struct {
+	Name string
+	From time.Time
+	To   time.Time
+}
+
+// monthStart returns the first instant of t's month in UTC
+func monthStart(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+// jobPartitionName returns the name of the partition of month
+func jobPartitionName(month time.Time) string {
+	return "jobs_p" + month.Format("200601")
+}
+
+// parseJobPartition reads a partition's bounds from its name. It returns
+// false for the default partition and names TaskFlow didn't create.
+func parseJobPartition(name string) (JobPartition, bool) {
+	if month, ok := strings.CutPrefix(name, "jobs_p"); ok {
+		from, err := time.Parse("200601", month)
+		if err != nil {
+			return JobPartition{}, false
+		}
+		return JobPartition{Name: name, From: from, To: from.AddDate(0, 1, 0)}, true
+	}
+	if month, ok := strings.CutPrefix(name, "jobs_before_"); ok {
+		to, err := time.Parse("200601", month)
+		if err != nil {
+			return JobPartition{}, false
+		}
+		return JobPartition{Name: name, To: to}, true
+	}
+	return JobPartition{}, false
+}
+
+// JobsPartitioned reports whether the jobs table is partitioned
+func (p *PostgresStorage) JobsPartitioned(ctx context.Context) (bool, error) {
+	var partitioned bool
+	err := p.db.QueryRowContext(ctx,
+		`SELECT EXISTS (SELECT 1 FROM pg_partitioned_table WHERE partrelid = to_regclass('jobs'))`,
+	).Scan(&partitioned)
+	if err != nil {
+		return false, fmt.Errorf("failed to check jobs partitioning: %w", err)
+	}
+	return partitioned, nil
+}
+
+// JobPartitions returns the partitions of the jobs table, oldest first,
+// leaving out the default partition
+func (p *PostgresStorage) JobPartitions(ctx context.Context) ([]JobPartition, error) {
+	rows, err := p.db.QueryContext(ctx, `
+		SELECT c.relname
+		FROM pg_inherits i
+		JOIN pg_class c ON c.oid = i.inhrelid
+		WHERE i.inhparent = to_regclass('jobs')
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list job partitions: %w", err)
+	}
+	defer rows.Close()
+
+	var partitions []JobPartition
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, fmt.Errorf("failed to scan job partition: %w", err)
+		}
+		if partition, ok := parseJobPartition(name); ok {
+			partitions = append(partitions, partition)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list job partitions: %w", err)
+	}
+
+	sort.Slice(partitions, func(i, j int) bool {
+		return partitions[i].To.Before(partitions[j].To)
+	})
+	return partitions, nil
+}
+
+// EnsureJobPartitions creates the partitions of now's month and the ahead
+// months after it that don't exist yet, and returns their names
+func (p *PostgresStorage) EnsureJobPartitions(ctx context.Context, now time.Time, ahead int) ([]string, error) {
+	existing, err := p.JobPartitions(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var created []string
+	month := monthStart(now)
+	for i := 0; i <= ahead; i, month = i+1, month.AddDate(0, 1, 0) {
+		if covered(existing, month) {
+			continue
+		}
+
+		name := jobPartitionName(month)
+		query := fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s PARTITION OF jobs FOR VALUES FROM ('%s') TO ('%s')`,
+			name, month.Format(time.RFC3339), month.AddDate(0, 1, 0).Format(time.RFC3339))
+		if _, err := p.db.ExecContext(ctx, query); err != nil {
+			return created, fmt.Errorf("failed to create job partition %s: %w", name, err)
+		}
+		created = append(created, name)
+	}
+	return created, nil
+}
+
+// covered reports whether one of partitions holds the rows of month
+func covered(partitions []JobPartition, month time.Time) bool {
+	for _, partition := range partitions {
+		if !month.Before(partition.From) && month.Before(partition.To) {
+			return true
+		}
+	}
+	return false
+}
+
+// DropExpiredJobPartitions drops the partitions whose rows were all
+// created before cutoff and returns their names. Partitions that still
+// hold unfinished jobs are kept and returned as kept.
+func (p *PostgresStorage) DropExpiredJobPartitions(ctx context.Context, cutoff time.Time) (dropped, kept []string, err error) {
+	partitions, err := p.JobPartitions(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, partition := range partitions {
+		if partition.To.After(cutoff) {
+			continue
+		}
+
+		var unfinished bool
+		query := fmt.Sprintf(`SELECT EXISTS (SELECT 1 FROM %s WHERE status IN (%s))`,
+			partition.Name, unfinishedJobStatuses)
+		if err := p.db.QueryRowContext(ctx, query).Scan(&unfinished); err != nil {
+			return dropped, kept, fmt.Errorf("failed to check job partition %s: %w", partition.Name, err)
+		}
+		if unfinished {
+			kept = append(kept, partition.Name)
+			continue
+		}
+
+		if _, err := p.db.ExecContext(ctx, fmt.Sprintf(`DROP TABLE %s`, partition.Name)); err != nil {
+			return dropped, kept, fmt.Errorf("failed to drop job partition %s: %w", partition.Name, err)
+		}
+		dropped = append(dropped, partition.Name)
+	}
+	return dropped, kept, nil
+}
+
+// DeleteExpiredJobs deletes finished jobs completed before cutoff, in
+// batches, and returns how many it deleted. It is how an unpartitioned
+// jobs table applies the retention policy.
+func (p *PostgresStorage) DeleteExpiredJobs(ctx context.Context, cutoff time.Time) (int64, error) {
+	query := fmt.Sprintf(`
+		DELETE FROM jobs WHERE id IN (
+			SELECT id FROM jobs
+			WHERE status NOT IN (%s) AND completed_at < $1
+			LIMIT $2
+		)
+	`, unfinishedJobStatuses)
+
+	var deleted int64
+	for {
+		result, err := p.db.ExecContext(ctx, query, cutoff, deleteJobsBatch)
+		if err != nil {
+			return deleted, fmt.Errorf("failed to delete expired jobs: %w", err)
+		}
+		n, _ := result.RowsAffected()
+		deleted += n
+		if n < deleteJobsBatch {
+			return deleted, nil
+		}
+	}
+}
+
+// DeleteExpiredAttempts deletes the attempt history of attempts that ended
+// before cutoff
+func (p *PostgresStorage) DeleteExpiredAttempts(ctx context.Context, cutoff time.Time) (int64, error) {
+	result, err := p.db.ExecContext(ctx, `DELETE FROM job_attempts WHERE ended_at < $1`, cutoff)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete expired job attempts: %w", err)
+	}
+	n, _ := result.RowsAffected()
+	return n, nil
+}
+
+// JobMaintenance reports what MaintainJobs changed
+type JobMaintenance struct {
+	Created []string // partitions created
+	Dropped []string // expired partitions dropped
+	Kept    []string // expired partitions kept for their unfinished jobs
+	Deleted int64    // expired jobs deleted from an unpartitioned table
+}
+
+// MaintainJobs applies the job retention policy and keeps the partitions
+// of the next ahead months ready. A zero retention keeps jobs forever.
+func (p *PostgresStorage) MaintainJobs(ctx context.Context, now time.Time, retention time.Duration, ahead int) (JobMaintenance, error) {
+	var report JobMaintenance
+
+	partitioned, err := p.JobsPartitioned(ctx)
+	if err != nil {
+		return report, err
+	}
+
+	if partitioned {
+		report.Created, err = p.EnsureJobPartitions(ctx, now, ahead)
+		if err != nil {
+			return report, err
+		}
+	}
+
+	if retention <= 0 {
+		return report, nil
+	}
+	cutoff := now.Add(-retention)
+
+	if partitioned {
+		report.Dropped, report.Kept, err = p.DropExpiredJobPartitions(ctx, cutoff)
+	} else {
+		report.Deleted, err = p.DeleteExpiredJobs(ctx, cutoff)
+	}
+	if err != nil {
+		return report, err
+	}
+
+	_, err = p.DeleteExpiredAttempts(ctx, cutoff)
+	return report, err
+}
+
+// PartitionJobs converts an unpartitioned jobs table into one partitioned
+// by month of created_at. The existing table is attached as the partition
+// jobs_before_YYYYMM of everything created before next month, so no rows
+// are copied, but its primary key is rebuilt as (id, created_at) and the
+// table is locked while that runs. It returns the partitions it created;
+// converting a partitioned table is a no-op.
+func (p *PostgresStorage) PartitionJobs(ctx context.Context, now time.Time, ahead int) ([]string, error) {
+	partitioned, err := p.JobsPartitioned(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if partitioned {
+		return nil, nil
+	}
+
+	boundary := monthStart(now).AddDate(0, 1, 0)
+	legacy := "jobs_before_" + boundary.Format("200601")
+
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// The old table's indexes are renamed so migrate can create the
+	// parent's indexes under their usual names; PostgreSQL then attaches
+	// the renamed ones instead of building them again.
+	indexes, err := legacyIndexes(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	statements := []string{
+		`LOCK TABLE jobs IN ACCESS EXCLUSIVE MODE`,
+		fmt.Sprintf(`ALTER TABLE jobs RENAME TO %s`, legacy),
+		fmt.Sprintf(`ALTER TABLE %s DROP CONSTRAINT jobs_pkey`, legacy),
+		fmt.Sprintf(`ALTER TABLE %s ADD PRIMARY KEY (id, created_at)`, legacy),
+	}
+	for _, index := range indexes {
+		statements = append(statements, fmt.Sprintf(`ALTER INDEX %s RENAME TO %s_legacy`, index, index))
+	}
+	statements = append(statements,
+		fmt.Sprintf(`CREATE TABLE jobs (LIKE %s INCLUDING DEFAULTS INCLUDING CONSTRAINTS) PARTITION BY RANGE (created_at)`, legacy),
+		`ALTER TABLE jobs ADD PRIMARY KEY (id, created_at)`,
+		fmt.Sprintf(`ALTER TABLE jobs ATTACH PARTITION %s FOR VALUES FROM (MINVALUE) TO ('%s')`,
+			legacy, boundary.Format(time.RFC3339)),
+		`CREATE TABLE jobs_default PARTITION OF jobs DEFAULT`,
+	)
+
+	for _, statement := range statements {
+		if _, err := tx.ExecContext(ctx, statement); err != nil {
+			return nil, fmt.Errorf("failed to partition jobs table: %w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit jobs partitioning: %w", err)
+	}
+
+	if err := p.migrate(); err != nil {
+		return nil, err
+	}
+
+	created, err := p.EnsureJobPartitions(ctx, now, ahead)
+	return append([]string{legacy}, created...), err
+}
+
+// legacyIndexes returns the names of the jobs table's indexes other than
+// its primary key
+func legacyIndexes(ctx context.Context, tx *sql.Tx) ([]string, error) {
+	rows, err := tx.QueryContext(ctx,
+		`SELECT indexname FROM pg_indexes WHERE schemaname = current_schema() AND tablename = 'jobs' AND indexname <> 'jobs_pkey'`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list jobs indexes: %w", err)
+	}
+	defer rows.Close()
+
+	var indexes []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, fmt.Errorf("failed to scan jobs index: %w", err)
+		}
+		indexes = append(indexes, name)
+	}
+	return indexes, rows.Err()
+}
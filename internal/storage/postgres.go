@@ -3,39 +3,129 @@ package storage
 import (
 	"context"
 	"database/sql"
+	"database/sql/driver"
 	"encoding/json"
 	"fmt"
 	"strings"
+	"taskflow/internal/breaker"
+	"taskflow/internal/encryption"
+	"taskflow/internal/lock"
 	"taskflow/internal/types"
 	"time"
 
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 )
 
 type PostgresStorage struct {
-	db *sql.DB
+	db      *sql.DB
+	cipher  *encryption.Cipher
+	pool    PoolConfig
+	breaker *breaker.Breaker
+	locker  *lock.Locker // serializes migrations across processes
+
+	noPrepare bool
+	stmts     statements
+
+	replicaURL string
+	replica    *sql.DB // nil without WithReplica
+}
+
+// PoolConfig sizes the database connection pool
+type PoolConfig struct {
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration // zero keeps idle connections until ConnMaxLifetime
+}
+
+// Option configures optional PostgresStorage behaviour
+type Option func(*PostgresStorage)
+
+// WithCipher encrypts job payloads and results before they are written to the database
+func WithCipher(c *encryption.Cipher) Option {
+	return func(p *PostgresStorage) {
+		p.cipher = c
+	}
 }
 
-func NewPostgresStorage(databaseURL string) (*PostgresStorage, error) {
-	db, err := sql.Open("postgres", databaseURL)
+// migrationLockTTL bounds how long a process that dies while migrating
+// blocks the others
+const migrationLockTTL = 30 * time.Second
+
+// WithMigrationLock runs the schema migrations under a lock, so that
+// processes starting together don't race to create the same tables
+func WithMigrationLock(l *lock.Locker) Option {
+	return func(p *PostgresStorage) {
+		p.locker = l
+	}
+}
+
+// WithPool sizes the connection pool. Zero fields keep their defaults.
+func WithPool(pool PoolConfig) Option {
+	return func(p *PostgresStorage) {
+		if pool.MaxOpenConns > 0 {
+			p.pool.MaxOpenConns = pool.MaxOpenConns
+		}
+		if pool.MaxIdleConns > 0 {
+			p.pool.MaxIdleConns = pool.MaxIdleConns
+		}
+		if pool.ConnMaxLifetime > 0 {
+			p.pool.ConnMaxLifetime = pool.ConnMaxLifetime
+		}
+		if pool.ConnMaxIdleTime > 0 {
+			p.pool.ConnMaxIdleTime = pool.ConnMaxIdleTime
+		}
+	}
+}
+
+func NewPostgresStorage(databaseURL string, opts ...Option) (*PostgresStorage, error) {
+	storage := &PostgresStorage{
+		pool: PoolConfig{MaxOpenConns: 25, MaxIdleConns: 5, ConnMaxLifetime: 5 * time.Minute},
+	}
+	for _, opt := range opts {
+		opt(storage)
+	}
+
+	var connector driver.Connector
+	connector, err := pq.NewConnector(databaseURL)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
+	if storage.breaker != nil {
+		connector = &breakerConnector{connector: connector, breaker: storage.breaker}
+	}
+	db := sql.OpenDB(connector)
 
 	// Configure connection pool
-	db.SetMaxOpenConns(25)
-	db.SetMaxIdleConns(5)
-	db.SetConnMaxLifetime(5 * time.Minute)
+	db.SetMaxOpenConns(storage.pool.MaxOpenConns)
+	db.SetMaxIdleConns(storage.pool.MaxIdleConns)
+	db.SetConnMaxLifetime(storage.pool.ConnMaxLifetime)
+	db.SetConnMaxIdleTime(storage.pool.ConnMaxIdleTime)
 
 	// Test connection
 	if err := db.Ping(); err != nil {
 		return nil, fmt.Errorf("failed to ping database: %w", err)
 	}
+	storage.db = db
 
-	storage := &PostgresStorage{db: db}
+	if storage.replicaURL != "" {
+		if err := storage.openReplica(); err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
 
 	// Initialize database schema
-	if err := storage.migrate(); err != nil {
+	migrate := func(ctx context.Context, token int64) error {
+		return storage.migrate()
+	}
+	if storage.locker != nil {
+		err = storage.locker.Do(context.Background(), "migrations", migrationLockTTL, migrate)
+	} else {
+		err = migrate(context.Background(), 0)
+	}
+	if err != nil {
+		storage.Close()
 		return nil, fmt.Errorf("failed to migrate database: %w", err)
 	}
 
@@ -43,9 +133,18 @@ func NewPostgresStorage(databaseURL string) (*PostgresStorage, error) {
 }
 
 func (p *PostgresStorage) Close() error {
+	p.closeStatements()
+	if p.replica != nil {
+		p.replica.Close()
+	}
 	return p.db.Close()
 }
 
+// Stats returns the primary's connection pool stats
+func (p *PostgresStorage) Stats() sql.DBStats {
+	return p.db.Stats()
+}
+
 func (p *PostgresStorage) Ping(ctx context.Context) error {
 	return p.db.PingContext(ctx)
 }
@@ -69,8 +168,6 @@ func (p *PostgresStorage) migrate() error {
 			completed_at TIMESTAMP WITH TIME ZONE,
 			worker_id VARCHAR(255)
 		)`,
-		`CREATE INDEX IF NOT EXISTS idx_jobs_status ON jobs(status)`,
-		`CREATE INDEX IF NOT EXISTS idx_jobs_type ON jobs(type)`,
 		`CREATE INDEX IF NOT EXISTS idx_jobs_created_at ON jobs(created_at)`,
 		`CREATE INDEX IF NOT EXISTS idx_jobs_scheduled_at ON jobs(scheduled_at)`,
 		`CREATE TABLE IF NOT EXISTS workers (
@@ -83,6 +180,106 @@ func (p *PostgresStorage) migrate() error {
 		)`,
 		`CREATE INDEX IF NOT EXISTS idx_workers_status ON workers(status)`,
 		`CREATE INDEX IF NOT EXISTS idx_workers_last_seen ON workers(last_seen)`,
+		`ALTER TABLE jobs ADD COLUMN IF NOT EXISTS tenant_id VARCHAR(255) NOT NULL DEFAULT 'default'`,
+		`CREATE TABLE IF NOT EXISTS job_schemas (
+			job_type VARCHAR(50) PRIMARY KEY,
+			schema JSONB NOT NULL,
+			updated_at TIMESTAMP WITH TIME ZONE NOT NULL
+		)`,
+		`ALTER TABLE jobs ADD COLUMN IF NOT EXISTS payload_ref TEXT`,
+		`ALTER TABLE workers ADD COLUMN IF NOT EXISTS concurrency INTEGER NOT NULL DEFAULT 1`,
+		`ALTER TABLE workers ADD COLUMN IF NOT EXISTS current_jobs JSONB`,
+		`ALTER TABLE jobs ADD COLUMN IF NOT EXISTS priority VARCHAR(10) NOT NULL DEFAULT 'normal'`,
+		`CREATE INDEX IF NOT EXISTS idx_jobs_completed_at ON jobs(completed_at)`,
+		`ALTER TABLE workers ADD COLUMN IF NOT EXISTS command VARCHAR(20)`,
+		`ALTER TABLE jobs ADD COLUMN IF NOT EXISTS progress JSONB`,
+		`ALTER TABLE jobs ADD COLUMN IF NOT EXISTS checkpoint JSONB`,
+		`ALTER TABLE jobs ADD COLUMN IF NOT EXISTS parent_id VARCHAR(255)`,
+		`ALTER TABLE jobs ADD COLUMN IF NOT EXISTS on_success JSONB`,
+		`ALTER TABLE jobs ADD COLUMN IF NOT EXISTS on_failure JSONB`,
+		`ALTER TABLE jobs ADD COLUMN IF NOT EXISTS workflow_id VARCHAR(255)`,
+		`ALTER TABLE jobs ADD COLUMN IF NOT EXISTS workflow_step VARCHAR(255)`,
+		`CREATE INDEX IF NOT EXISTS idx_jobs_workflow_id ON jobs(workflow_id)`,
+		`CREATE TABLE IF NOT EXISTS workflows (
+			id VARCHAR(255) PRIMARY KEY,
+			tenant_id VARCHAR(255) NOT NULL,
+			name VARCHAR(255),
+			status VARCHAR(20) NOT NULL,
+			steps JSONB NOT NULL,
+			created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+			updated_at TIMESTAMP WITH TIME ZONE NOT NULL,
+			completed_at TIMESTAMP WITH TIME ZONE
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_workflows_tenant_id ON workflows(tenant_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_workflows_created_at ON workflows(created_at)`,
+		`CREATE TABLE IF NOT EXISTS job_results (
+			job_id VARCHAR(255) PRIMARY KEY,
+			result JSONB,
+			result_ref TEXT,
+			size INTEGER NOT NULL,
+			created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+			expires_at TIMESTAMP WITH TIME ZONE
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_job_results_expires_at ON job_results(expires_at)`,
+		`CREATE TABLE IF NOT EXISTS processed_jobs (
+			job_id VARCHAR(255) NOT NULL,
+			attempt INTEGER NOT NULL,
+			result JSONB,
+			processed_at TIMESTAMP WITH TIME ZONE NOT NULL,
+			PRIMARY KEY (job_id, attempt)
+		)`,
+		`ALTER TABLE jobs ADD COLUMN IF NOT EXISTS version INTEGER NOT NULL DEFAULT 0`,
+		// Reconciliation only reads unfinished jobs, a small part of the table
+		`CREATE INDEX IF NOT EXISTS idx_jobs_unfinished ON jobs(id) WHERE status IN ('scheduled', 'pending', 'processing', 'retrying')`,
+		`CREATE TABLE IF NOT EXISTS job_attempts (
+			id BIGSERIAL PRIMARY KEY,
+			job_id VARCHAR(255) NOT NULL,
+			attempt INTEGER NOT NULL,
+			worker_id VARCHAR(255),
+			started_at TIMESTAMP WITH TIME ZONE NOT NULL,
+			ended_at TIMESTAMP WITH TIME ZONE,
+			outcome VARCHAR(20),
+			error TEXT,
+			duration_ms BIGINT
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_job_attempts_job_id ON job_attempts(job_id, started_at)`,
+		`CREATE TABLE IF NOT EXISTS audit_log (
+			id BIGSERIAL PRIMARY KEY,
+			action VARCHAR(50) NOT NULL,
+			actor VARCHAR(255) NOT NULL,
+			tenant_id VARCHAR(255),
+			target VARCHAR(255) NOT NULL,
+			before JSONB,
+			after JSONB,
+			created_at TIMESTAMP WITH TIME ZONE NOT NULL
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_audit_log_created_at ON audit_log(created_at)`,
+		`CREATE INDEX IF NOT EXISTS idx_audit_log_target ON audit_log(target)`,
+		// Composite and partial indexes for the queries that read jobs
+		// most; docs/adr/003-job-indexes.md lists the plan each serves.
+		// They replace the single-column status, type and tenant_id
+		// indexes, which are their prefixes.
+		`CREATE INDEX IF NOT EXISTS idx_jobs_status_created_at ON jobs(status, created_at DESC)`,
+		`CREATE INDEX IF NOT EXISTS idx_jobs_type_status_created_at ON jobs(type, status, created_at DESC)`,
+		`CREATE INDEX IF NOT EXISTS idx_jobs_tenant_created_at ON jobs(tenant_id, created_at DESC)`,
+		`CREATE INDEX IF NOT EXISTS idx_jobs_waiting ON jobs(type, updated_at) WHERE status IN ('pending', 'retrying')`,
+		`CREATE INDEX IF NOT EXISTS idx_jobs_processing_started_at ON jobs(started_at) WHERE status = 'processing'`,
+		`DROP INDEX IF EXISTS idx_jobs_status`,
+		`DROP INDEX IF EXISTS idx_jobs_type`,
+		`DROP INDEX IF EXISTS idx_jobs_tenant_id`,
+		`ALTER TABLE job_results ADD COLUMN IF NOT EXISTS checksum TEXT`,
+		`ALTER TABLE jobs ADD COLUMN IF NOT EXISTS affinity_key VARCHAR(255)`,
+		`ALTER TABLE jobs ADD COLUMN IF NOT EXISTS start_expires_at TIMESTAMP WITH TIME ZONE`,
+		`CREATE INDEX IF NOT EXISTS idx_jobs_start_expires_at ON jobs(start_expires_at) WHERE status IN ('scheduled', 'pending', 'retrying')`,
+		`CREATE TABLE IF NOT EXISTS email_templates (
+			name VARCHAR(128) PRIMARY KEY,
+			source TEXT NOT NULL,
+			html BOOLEAN NOT NULL DEFAULT FALSE,
+			updated_at TIMESTAMP WITH TIME ZONE NOT NULL
+		)`,
+		`ALTER TABLE workers ADD COLUMN IF NOT EXISTS degraded JSONB`,
+		`ALTER TABLE jobs ADD COLUMN IF NOT EXISTS error_code VARCHAR(32)`,
+		`CREATE INDEX IF NOT EXISTS idx_jobs_error_code ON jobs(error_code) WHERE error_code IS NOT NULL`,
 	}
 
 	for _, query := range queries {
@@ -94,102 +291,342 @@ func (p *PostgresStorage) migrate() error {
 	return nil
 }
 
-// CreateJob inserts a new job into the database
-func (p *PostgresStorage) CreateJob(ctx context.Context, job *types.Job) error {
-	query := `
-		INSERT INTO jobs (
-			id, type, payload, status, result, error, attempts, max_attempts,
-			created_at, updated_at, scheduled_at, started_at, completed_at, worker_id
-		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
-	`
+// jobInsertColumns are the columns CreateJob and CreateJobs write, in the
+// order of jobRow
+const jobInsertColumns = `id, type, payload, status, result, error, attempts, max_attempts,
+	created_at, updated_at, scheduled_at, started_at, completed_at, worker_id,
+	tenant_id, payload_ref, priority, parent_id, on_success, on_failure,
+	workflow_id, workflow_step, affinity_key, start_expires_at, error_code`
 
-	_, err := p.db.ExecContext(ctx, query,
-		job.ID, job.Type, job.Payload, job.Status, job.Result, job.Error,
+// jobInsertParams is the number of jobInsertColumns
+const jobInsertParams = 25
+
+// createJobsBatch bounds the rows of one INSERT, keeping its parameters
+// well under PostgreSQL's limit of 65535
+const createJobsBatch = 1000
+
+var createJobQuery = `INSERT INTO jobs (` + jobInsertColumns + `) VALUES ` + jobInsertPlaceholders(1)
+
+// jobInsertPlaceholders returns the VALUES placeholders of rows rows
+func jobInsertPlaceholders(rows int) string {
+	var b strings.Builder
+	for row := 0; row < rows; row++ {
+		if row > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteByte('(')
+		for col := 1; col <= jobInsertParams; col++ {
+			if col > 1 {
+				b.WriteString(", ")
+			}
+			fmt.Fprintf(&b, "$%d", row*jobInsertParams+col)
+		}
+		b.WriteByte(')')
+	}
+	return b.String()
+}
+
+// jobRow returns the values of jobInsertColumns for job, encrypting its
+// payload, result and follow-ups
+func (p *PostgresStorage) jobRow(ctx context.Context, job *types.Job) ([]interface{}, error) {
+	payload, err := p.cipher.Seal(ctx, job.Payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt job payload: %w", err)
+	}
+	result, err := p.cipher.Seal(ctx, job.Result)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt job result: %w", err)
+	}
+	onSuccess, err := p.sealFollowUp(ctx, job.OnSuccess)
+	if err != nil {
+		return nil, err
+	}
+	onFailure, err := p.sealFollowUp(ctx, job.OnFailure)
+	if err != nil {
+		return nil, err
+	}
+
+	return []interface{}{
+		job.ID, job.Type, payload, job.Status, result, job.Error,
 		job.Attempts, job.MaxAttempts, job.CreatedAt, job.UpdatedAt,
 		job.ScheduledAt, job.StartedAt, job.CompletedAt, job.WorkerID,
-	)
+		job.Tenant(), nullString(job.PayloadRef), job.EffectivePriority(),
+		nullString(job.ParentID), onSuccess, onFailure,
+		nullString(job.WorkflowID), nullString(job.WorkflowStep),
+		nullString(job.AffinityKey), job.ExpiresAt, nullString(string(job.ErrorCode)),
+	}, nil
+}
 
+// CreateJob inserts a new job into the database
+func (p *PostgresStorage) CreateJob(ctx context.Context, job *types.Job) error {
+	row, err := p.jobRow(ctx, job)
 	if err != nil {
+		return err
+	}
+
+	if _, err := p.exec(ctx, createJobQuery, row...); err != nil {
 		return fmt.Errorf("failed to create job: %w", err)
 	}
 
 	return nil
 }
 
-// GetJob retrieves a job by ID
-func (p *PostgresStorage) GetJob(ctx context.Context, jobID string) (*types.Job, error) {
-	query := `
-		SELECT id, type, payload, status, result, error, attempts, max_attempts,
-			   created_at, updated_at, scheduled_at, started_at, completed_at, worker_id
-		FROM jobs WHERE id = $1
-	`
+// CreateJobs inserts new jobs with multi-row INSERTs in one transaction,
+// so that either all of them are stored or none are
+func (p *PostgresStorage) CreateJobs(ctx context.Context, jobs []*types.Job) error {
+	if len(jobs) == 0 {
+		return nil
+	}
 
-	var job types.Job
-	var result, payload sql.NullString
-	var startedAt, completedAt sql.NullTime
-	var workerID sql.NullString
+	args := make([]interface{}, 0, len(jobs)*jobInsertParams)
+	for _, job := range jobs {
+		row, err := p.jobRow(ctx, job)
+		if err != nil {
+			return err
+		}
+		args = append(args, row...)
+	}
 
-	err := p.db.QueryRowContext(ctx, query, jobID).Scan(
-		&job.ID, &job.Type, &payload, &job.Status, &result, &job.Error,
-		&job.Attempts, &job.MaxAttempts, &job.CreatedAt, &job.UpdatedAt,
-		&job.ScheduledAt, &startedAt, &completedAt, &workerID,
-	)
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	for start := 0; start < len(jobs); start += createJobsBatch {
+		rows := min(createJobsBatch, len(jobs)-start)
+		query := `INSERT INTO jobs (` + jobInsertColumns + `) VALUES ` + jobInsertPlaceholders(rows)
+		batch := args[start*jobInsertParams : (start+rows)*jobInsertParams]
+		if _, err := tx.ExecContext(ctx, query, batch...); err != nil {
+			return fmt.Errorf("failed to create jobs: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to create jobs: %w", err)
+	}
+	return nil
+}
 
+// GetJob retrieves a job by ID
+func (p *PostgresStorage) GetJob(ctx context.Context, jobID string) (*types.Job, error) {
+	query := `SELECT ` + jobColumns + ` FROM jobs WHERE id = $1`
+
+	job, err := scanJob(p.queryRow(ctx, query, jobID))
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return nil, fmt.Errorf("job not found: %s", jobID)
+			return nil, fmt.Errorf("%w: %s", ErrJobNotFound, jobID)
 		}
 		return nil, fmt.Errorf("failed to get job: %w", err)
 	}
 
-	// Handle nullable fields
-	if payload.Valid {
-		job.Payload = json.RawMessage(payload.String)
+	if err := p.openJob(ctx, job); err != nil {
+		return nil, err
 	}
-	if result.Valid {
-		job.Result = json.RawMessage(result.String)
+	if err := p.attachResult(ctx, job); err != nil {
+		return nil, err
 	}
-	if startedAt.Valid {
-		job.StartedAt = &startedAt.Time
+
+	return job, nil
+}
+
+// UpdateJob updates a job in the database if it is still at job.Version,
+// and moves job.Version to the stored job's new version. It returns
+// ErrJobConflict if another writer updated the job since it was read; the
+// caller should read it again before deciding whether to retry. Results
+// are stored separately with SaveResult.
+func (p *PostgresStorage) UpdateJob(ctx context.Context, job *types.Job) error {
+	query := `
+		UPDATE jobs SET
+			status = $2, error = $3, attempts = $4,
+			updated_at = $5, started_at = $6, completed_at = $7, worker_id = $8,
+			scheduled_at = $9, progress = $10, checkpoint = $11, error_code = $13,
+			version = version + 1
+		WHERE id = $1 AND version = $12
+		RETURNING version
+	`
+
+	checkpoint, err := p.cipher.Seal(ctx, job.Checkpoint)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt job checkpoint: %w", err)
 	}
-	if completedAt.Valid {
-		job.CompletedAt = &completedAt.Time
+	progress, err := marshalProgress(job.Progress)
+	if err != nil {
+		return err
 	}
-	if workerID.Valid {
-		job.WorkerID = workerID.String
+
+	var version int
+	err = p.queryRow(ctx, query,
+		job.ID, job.Status, job.Error, job.Attempts,
+		job.UpdatedAt, job.StartedAt, job.CompletedAt, job.WorkerID,
+		job.ScheduledAt, progress, checkpoint, job.Version, nullString(string(job.ErrorCode)),
+	).Scan(&version)
+	if err == sql.ErrNoRows {
+		if _, _, err := p.JobVersion(ctx, job.ID); err != nil {
+			return err
+		}
+		return fmt.Errorf("%w: job %s is no longer at version %d", ErrJobConflict, job.ID, job.Version)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update job: %w", err)
 	}
 
-	return &job, nil
+	job.Version = version
+	return nil
 }
 
-// UpdateJob updates a job in the database
-func (p *PostgresStorage) UpdateJob(ctx context.Context, job *types.Job) error {
+// ExistingJobs returns which of ids are stored
+func (p *PostgresStorage) ExistingJobs(ctx context.Context, ids []string) (map[string]bool, error) {
+	rows, err := p.db.QueryContext(ctx, `SELECT id FROM jobs WHERE id = ANY($1)`, pq.Array(ids))
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up jobs: %w", err)
+	}
+	defer rows.Close()
+
+	existing := make(map[string]bool)
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan job ID: %w", err)
+		}
+		existing[id] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating job IDs: %w", err)
+	}
+	return existing, nil
+}
+
+// JobVersion returns the status and version of a stored job, without
+// reading the rest of it
+func (p *PostgresStorage) JobVersion(ctx context.Context, jobID string) (types.JobStatus, int, error) {
+	var status types.JobStatus
+	var version int
+	err := p.queryRow(ctx, `SELECT status, version FROM jobs WHERE id = $1`, jobID).Scan(&status, &version)
+	if err == sql.ErrNoRows {
+		return "", 0, fmt.Errorf("%w: %s", ErrJobNotFound, jobID)
+	}
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to get job version: %w", err)
+	}
+	return status, version, nil
+}
+
+// UpdateJobIf updates a job, including its schedule, only if its status is
+// one of statuses, whatever its version. It reports whether the job was
+// updated, and moves job.Version to the stored job's new version if so.
+func (p *PostgresStorage) UpdateJobIf(ctx context.Context, job *types.Job, statuses ...types.JobStatus) (bool, error) {
 	query := `
 		UPDATE jobs SET
-			status = $2, result = $3, error = $4, attempts = $5,
-			updated_at = $6, started_at = $7, completed_at = $8, worker_id = $9
-		WHERE id = $1
+			status = $2, error = $3, attempts = $4,
+			updated_at = $5, started_at = $6, completed_at = $7, worker_id = $8,
+			scheduled_at = $9, progress = $10, checkpoint = $11, error_code = $13,
+			version = version + 1
+		WHERE id = $1 AND status = ANY($12)
+		RETURNING version
 	`
 
-	_, err := p.db.ExecContext(ctx, query,
-		job.ID, job.Status, job.Result, job.Error, job.Attempts,
+	checkpoint, err := p.cipher.Seal(ctx, job.Checkpoint)
+	if err != nil {
+		return false, fmt.Errorf("failed to encrypt job checkpoint: %w", err)
+	}
+	progress, err := marshalProgress(job.Progress)
+	if err != nil {
+		return false, err
+	}
+
+	allowed := make([]string, len(statuses))
+	for i, status := range statuses {
+		allowed[i] = string(status)
+	}
+
+	var version int
+	err = p.queryRow(ctx, query,
+		job.ID, job.Status, job.Error, job.Attempts,
 		job.UpdatedAt, job.StartedAt, job.CompletedAt, job.WorkerID,
-	)
+		job.ScheduledAt, progress, checkpoint, pq.Array(allowed), nullString(string(job.ErrorCode)),
+	).Scan(&version)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to update job: %w", err)
+	}
+
+	job.Version = version
+	return true, nil
+}
 
+// UpdateJobProgress records the progress of a running job. It reports
+// whether the job was still processing.
+func (p *PostgresStorage) UpdateJobProgress(ctx context.Context, jobID string, progress *types.JobProgress) (bool, error) {
+	data, err := marshalProgress(progress)
 	if err != nil {
-		return fmt.Errorf("failed to update job: %w", err)
+		return false, err
 	}
 
-	return nil
+	query := `UPDATE jobs SET progress = $2, updated_at = $3, version = version + 1 WHERE id = $1 AND status = 'processing'`
+	res, err := p.db.ExecContext(ctx, query, jobID, data, time.Now())
+	if err != nil {
+		return false, fmt.Errorf("failed to update job progress: %w", err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to update job progress: %w", err)
+	}
+	return n > 0, nil
+}
+
+// UpdateJobCheckpoint saves the checkpoint of a running job. It reports
+// whether the job was still processing.
+func (p *PostgresStorage) UpdateJobCheckpoint(ctx context.Context, jobID string, checkpoint json.RawMessage) (bool, error) {
+	sealed, err := p.cipher.Seal(ctx, checkpoint)
+	if err != nil {
+		return false, fmt.Errorf("failed to encrypt job checkpoint: %w", err)
+	}
+
+	query := `UPDATE jobs SET checkpoint = $2, updated_at = $3, version = version + 1 WHERE id = $1 AND status = 'processing'`
+	res, err := p.db.ExecContext(ctx, query, jobID, sealed, time.Now())
+	if err != nil {
+		return false, fmt.Errorf("failed to update job checkpoint: %w", err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to update job checkpoint: %w", err)
+	}
+	return n > 0, nil
+}
+
+// marshalProgress encodes job progress for the progress column, NULL if nil
+func marshalProgress(progress *types.JobProgress) ([]byte, error) {
+	if progress == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(progress)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal job progress: %w", err)
+	}
+	return data, nil
 }
 
-// ListJobs retrieves jobs with pagination and filtering
-func (p *PostgresStorage) ListJobs(ctx context.Context, page, pageSize int, status, jobType string) ([]types.Job, int, error) {
+// ListJobs retrieves jobs with pagination and filtering. Payloads,
+// results and follow-ups are only read if fields selects them, so pages
+// that don't need them stay small. An empty tenantID lists jobs across all
+// tenants.
+func (p *PostgresStorage) ListJobs(ctx context.Context, tenantID string, page, pageSize int, status, jobType, errorCode string, fields types.JobFields) ([]types.Job, int, error) {
 	// Build the WHERE clause
 	var whereConditions []string
 	var args []interface{}
 	argIndex := 1
 
+	if tenantID != "" {
+		whereConditions = append(whereConditions, fmt.Sprintf("tenant_id = $%d", argIndex))
+		args = append(args, tenantID)
+		argIndex++
+	}
+
 	if status != "" {
 		whereConditions = append(whereConditions, fmt.Sprintf("status = $%d", argIndex))
 		args = append(args, status)
@@ -202,15 +639,27 @@ func (p *PostgresStorage) ListJobs(ctx context.Context, page, pageSize int, stat
 		argIndex++
 	}
 
+	if errorCode != "" {
+		condition := fmt.Sprintf("error_code = $%d", argIndex)
+		if types.ErrorCode(errorCode) == types.ErrorCodeUnknown {
+			// Jobs that failed before error codes were recorded have none
+			condition = fmt.Sprintf("(%s OR (error_code IS NULL AND COALESCE(error, '') <> ''))", condition)
+		}
+		whereConditions = append(whereConditions, condition)
+		args = append(args, errorCode)
+		argIndex++
+	}
+
 	whereClause := ""
 	if len(whereConditions) > 0 {
 		whereClause = "WHERE " + strings.Join(whereConditions, " AND ")
 	}
 
 	// Get total count
+	db := p.reader(ctx)
 	countQuery := fmt.Sprintf("SELECT COUNT(*) FROM jobs %s", whereClause)
 	var total int
-	err := p.db.QueryRowContext(ctx, countQuery, args...).Scan(&total)
+	err := db.QueryRowContext(ctx, countQuery, args...).Scan(&total)
 	if err != nil {
 		return nil, 0, fmt.Errorf("failed to count jobs: %w", err)
 	}
@@ -218,16 +667,15 @@ func (p *PostgresStorage) ListJobs(ctx context.Context, page, pageSize int, stat
 	// Get jobs with pagination
 	offset := (page - 1) * pageSize
 	dataQuery := fmt.Sprintf(`
-		SELECT id, type, payload, status, result, error, attempts, max_attempts,
-			   created_at, updated_at, scheduled_at, started_at, completed_at, worker_id
+		SELECT %s
 		FROM jobs %s
 		ORDER BY created_at DESC
 		LIMIT $%d OFFSET $%d
-	`, whereClause, argIndex, argIndex+1)
+	`, selectJobColumns(fields), whereClause, argIndex, argIndex+1)
 
 	args = append(args, pageSize, offset)
 
-	rows, err := p.db.QueryContext(ctx, dataQuery, args...)
+	rows, err := db.QueryContext(ctx, dataQuery, args...)
 	if err != nil {
 		return nil, 0, fmt.Errorf("failed to query jobs: %w", err)
 	}
@@ -235,45 +683,480 @@ func (p *PostgresStorage) ListJobs(ctx context.Context, page, pageSize int, stat
 
 	var jobs []types.Job
 	for rows.Next() {
-		var job types.Job
-		var result, payload sql.NullString
-		var startedAt, completedAt sql.NullTime
-		var workerID sql.NullString
-
-		err := rows.Scan(
-			&job.ID, &job.Type, &payload, &job.Status, &result, &job.Error,
-			&job.Attempts, &job.MaxAttempts, &job.CreatedAt, &job.UpdatedAt,
-			&job.ScheduledAt, &startedAt, &completedAt, &workerID,
-		)
+		job, err := scanJob(rows)
 		if err != nil {
 			return nil, 0, fmt.Errorf("failed to scan job: %w", err)
 		}
+		if err := p.openJob(ctx, job); err != nil {
+			return nil, 0, err
+		}
+
+		jobs = append(jobs, *job)
+	}
 
-		// Handle nullable fields
-		if payload.Valid {
-			job.Payload = json.RawMessage(payload.String)
+	if err := rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("error iterating jobs: %w", err)
+	}
+
+	if fields.Has("result") {
+		if err := p.attachResults(ctx, jobs); err != nil {
+			return nil, 0, err
 		}
-		if result.Valid {
-			job.Result = json.RawMessage(result.String)
+	}
+
+	return jobs, total, nil
+}
+
+// jobColumns lists the columns read by scanJob, in order
+const jobColumns = `id, type, payload, status, result, error, attempts, max_attempts,
+	created_at, updated_at, scheduled_at, started_at, completed_at, worker_id,
+	tenant_id, payload_ref, priority, progress, checkpoint, parent_id,
+	on_success, on_failure, workflow_id, workflow_step, affinity_key,
+	start_expires_at, version, error_code`
+
+// selectJobColumns returns jobColumns with the large columns that fields
+// doesn't select read as NULL. Checkpoints are never listed.
+func selectJobColumns(fields types.JobFields) string {
+	columns := strings.Split(jobColumns, ",")
+	for i, column := range columns {
+		name := strings.TrimSpace(column)
+		switch name {
+		case "payload", "result", "on_success", "on_failure":
+			if fields.Has(name) {
+				continue
+			}
+		case "checkpoint":
+		default:
+			continue
 		}
-		if startedAt.Valid {
-			job.StartedAt = &startedAt.Time
+		columns[i] = " NULL AS " + name
+	}
+	return strings.Join(columns, ",")
+}
+
+// rowScanner is satisfied by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanJob reads a job selected with jobColumns
+func scanJob(row rowScanner) (*types.Job, error) {
+	var job types.Job
+	var result, payload, checkpoint sql.NullString
+	var startedAt, completedAt, expiresAt sql.NullTime
+	var workerID, payloadRef, parentID, workflowID, workflowStep, affinityKey, errorCode sql.NullString
+	var progress, onSuccess, onFailure []byte
+
+	err := row.Scan(
+		&job.ID, &job.Type, &payload, &job.Status, &result, &job.Error,
+		&job.Attempts, &job.MaxAttempts, &job.CreatedAt, &job.UpdatedAt,
+		&job.ScheduledAt, &startedAt, &completedAt, &workerID,
+		&job.TenantID, &payloadRef, &job.Priority, &progress, &checkpoint,
+		&parentID, &onSuccess, &onFailure, &workflowID, &workflowStep,
+		&affinityKey, &expiresAt, &job.Version, &errorCode,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	// Handle nullable fields
+	if payload.Valid {
+		job.Payload = json.RawMessage(payload.String)
+	}
+	if result.Valid {
+		job.Result = json.RawMessage(result.String)
+	}
+	if checkpoint.Valid {
+		job.Checkpoint = json.RawMessage(checkpoint.String)
+	}
+	if startedAt.Valid {
+		job.StartedAt = &startedAt.Time
+	}
+	if completedAt.Valid {
+		job.CompletedAt = &completedAt.Time
+	}
+	if workerID.Valid {
+		job.WorkerID = workerID.String
+	}
+	if payloadRef.Valid {
+		job.PayloadRef = payloadRef.String
+	}
+	if len(progress) > 0 {
+		if err := json.Unmarshal(progress, &job.Progress); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal job progress: %w", err)
 		}
-		if completedAt.Valid {
-			job.CompletedAt = &completedAt.Time
+	}
+	if parentID.Valid {
+		job.ParentID = parentID.String
+	}
+	if workflowID.Valid {
+		job.WorkflowID = workflowID.String
+	}
+	if workflowStep.Valid {
+		job.WorkflowStep = workflowStep.String
+	}
+	if affinityKey.Valid {
+		job.AffinityKey = affinityKey.String
+	}
+	if expiresAt.Valid {
+		job.ExpiresAt = &expiresAt.Time
+	}
+	if errorCode.Valid {
+		job.ErrorCode = types.ErrorCode(errorCode.String)
+	}
+	if len(onSuccess) > 0 {
+		if err := json.Unmarshal(onSuccess, &job.OnSuccess); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal job on_success: %w", err)
 		}
-		if workerID.Valid {
-			job.WorkerID = workerID.String
+	}
+	if len(onFailure) > 0 {
+		if err := json.Unmarshal(onFailure, &job.OnFailure); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal job on_failure: %w", err)
 		}
+	}
+
+	return &job, nil
+}
+
+// nullString maps empty strings to SQL NULL
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+// nullJSON maps empty JSON documents to SQL NULL
+func nullJSON(data json.RawMessage) interface{} {
+	if len(data) == 0 {
+		return nil
+	}
+	return []byte(data)
+}
+
+// JobCount is the number of jobs of one tenant, type and status, and for
+// failed jobs, error code
+type JobCount struct {
+	TenantID  string
+	Type      types.JobType
+	Status    types.JobStatus
+	ErrorCode types.ErrorCode // empty for other statuses and jobs failed without a code
+	Count     int
+}
+
+// CountJobs counts jobs grouped by tenant, type and status, and failed
+// jobs by error code too
+func (p *PostgresStorage) CountJobs(ctx context.Context) ([]JobCount, error) {
+	query := `
+		SELECT tenant_id, type, status,
+			CASE WHEN status = 'failed' THEN COALESCE(error_code, '') ELSE '' END AS code,
+			COUNT(*)
+		FROM jobs
+		GROUP BY tenant_id, type, status, code
+	`
 
-		jobs = append(jobs, job)
+	rows, err := p.reader(ctx).QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count jobs: %w", err)
+	}
+	defer rows.Close()
+
+	var counts []JobCount
+	for rows.Next() {
+		var c JobCount
+		if err := rows.Scan(&c.TenantID, &c.Type, &c.Status, &c.ErrorCode, &c.Count); err != nil {
+			return nil, fmt.Errorf("failed to scan job count: %w", err)
+		}
+		counts = append(counts, c)
 	}
 
 	if err := rows.Err(); err != nil {
-		return nil, 0, fmt.Errorf("error iterating jobs: %w", err)
+		return nil, fmt.Errorf("error iterating job counts: %w", err)
 	}
 
-	return jobs, total, nil
+	return counts, nil
+}
+
+// TimeseriesBucket counts job activity of one type in one interval, or over
+// the whole range when Bucket is -1
+type TimeseriesBucket struct {
+	JobType    types.JobType
+	Bucket     int
+	Created    int
+	Completed  int
+	Failed     int
+	LatencyP50 *float64
+	LatencyP95 *float64
+}
+
+// JobTimeseries counts jobs created, completed and failed in each interval
+// from from, and the p50/p95 processing time of completed jobs. Empty
+// tenantID and jobType match all tenants and types.
+func (p *PostgresStorage) JobTimeseries(ctx context.Context, tenantID, jobType string, from, to time.Time, interval time.Duration) ([]TimeseriesBucket, error) {
+	args := []interface{}{from, to, interval.Seconds()}
+	var filters []string
+	if tenantID != "" {
+		args = append(args, tenantID)
+		filters = append(filters, fmt.Sprintf("tenant_id = $%d", len(args)))
+	}
+	if jobType != "" {
+		args = append(args, jobType)
+		filters = append(filters, fmt.Sprintf("type = $%d", len(args)))
+	}
+	filter := ""
+	if len(filters) > 0 {
+		filter = "AND " + strings.Join(filters, " AND ")
+	}
+
+	// Creations and completions are bucketed by when they happened, so one
+	// job can count in two intervals
+	query := fmt.Sprintf(`
+		WITH events AS (
+			SELECT type, 'created' AS event, created_at AS at, NULL::float8 AS latency
+			FROM jobs
+			WHERE created_at >= $1 AND created_at < $2 %[1]s
+			UNION ALL
+			SELECT type, status, completed_at, EXTRACT(EPOCH FROM completed_at - started_at)
+			FROM jobs
+			WHERE status IN ('completed', 'failed') AND completed_at >= $1 AND completed_at < $2 %[1]s
+		), buckets AS (
+			SELECT type, event, latency, FLOOR(EXTRACT(EPOCH FROM at - $1) / $3)::int AS bucket
+			FROM events
+		)
+		SELECT type, COALESCE(bucket, -1),
+			COUNT(*) FILTER (WHERE event = 'created'),
+			COUNT(*) FILTER (WHERE event = 'completed'),
+			COUNT(*) FILTER (WHERE event = 'failed'),
+			PERCENTILE_CONT(0.5) WITHIN GROUP (ORDER BY latency) FILTER (WHERE event = 'completed'),
+			PERCENTILE_CONT(0.95) WITHIN GROUP (ORDER BY latency) FILTER (WHERE event = 'completed')
+		FROM buckets
+		GROUP BY GROUPING SETS ((type, bucket), (type))
+		ORDER BY type, bucket
+	`, filter)
+
+	rows, err := p.reader(ctx).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query job timeseries: %w", err)
+	}
+	defer rows.Close()
+
+	var buckets []TimeseriesBucket
+	for rows.Next() {
+		var b TimeseriesBucket
+		var p50, p95 sql.NullFloat64
+		if err := rows.Scan(&b.JobType, &b.Bucket, &b.Created, &b.Completed, &b.Failed, &p50, &p95); err != nil {
+			return nil, fmt.Errorf("failed to scan job timeseries: %w", err)
+		}
+		if p50.Valid {
+			b.LatencyP50 = &p50.Float64
+		}
+		if p95.Valid {
+			b.LatencyP95 = &p95.Float64
+		}
+		buckets = append(buckets, b)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating job timeseries: %w", err)
+	}
+
+	return buckets, nil
+}
+
+// OldestWaitingJobs returns, per job type, when the longest-waiting pending
+// or retrying job was last queued
+func (p *PostgresStorage) OldestWaitingJobs(ctx context.Context) (map[types.JobType]time.Time, error) {
+	query := `
+		SELECT type, MIN(updated_at)
+		FROM jobs
+		WHERE status IN ('pending', 'retrying')
+		GROUP BY type
+	`
+
+	rows, err := p.reader(ctx).QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query waiting jobs: %w", err)
+	}
+	defer rows.Close()
+
+	oldest := make(map[types.JobType]time.Time)
+	for rows.Next() {
+		var jobType types.JobType
+		var at time.Time
+		if err := rows.Scan(&jobType, &at); err != nil {
+			return nil, fmt.Errorf("failed to scan waiting jobs: %w", err)
+		}
+		oldest[jobType] = at
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating waiting jobs: %w", err)
+	}
+
+	return oldest, nil
+}
+
+// UnfinishedJobs returns up to limit scheduled, pending, processing or
+// retrying jobs last updated before the given time, in ID order after
+// afterID
+func (p *PostgresStorage) UnfinishedJobs(ctx context.Context, before time.Time, afterID string, limit int) ([]types.Job, error) {
+	query := `SELECT ` + jobColumns + ` FROM jobs
+		WHERE status IN ('scheduled', 'pending', 'processing', 'retrying') AND updated_at < $1 AND id > $2
+		ORDER BY id
+		LIMIT $3`
+
+	rows, err := p.db.QueryContext(ctx, query, before, afterID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query unfinished jobs: %w", err)
+	}
+	defer rows.Close()
+
+	var jobs []types.Job
+	for rows.Next() {
+		job, err := scanJob(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan job: %w", err)
+		}
+		if err := p.openJob(ctx, job); err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, *job)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating unfinished jobs: %w", err)
+	}
+
+	return jobs, nil
+}
+
+// ExpiredJobs returns up to limit scheduled, pending or retrying jobs whose
+// expiry passed before the given time, oldest expiry first
+func (p *PostgresStorage) ExpiredJobs(ctx context.Context, before time.Time, limit int) ([]types.Job, error) {
+	query := `SELECT ` + jobColumns + ` FROM jobs
+		WHERE status IN ('scheduled', 'pending', 'retrying') AND start_expires_at <= $1
+		ORDER BY start_expires_at
+		LIMIT $2`
+
+	rows, err := p.db.QueryContext(ctx, query, before, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query expired jobs: %w", err)
+	}
+	defer rows.Close()
+
+	var jobs []types.Job
+	for rows.Next() {
+		job, err := scanJob(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan job: %w", err)
+		}
+		if err := p.openJob(ctx, job); err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, *job)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating expired jobs: %w", err)
+	}
+
+	return jobs, nil
+}
+
+// The processed-jobs ledger records successful attempts until the queue
+// acknowledges them, so that a job redelivered after a lost acknowledgement
+// isn't run twice. Attempts are counted from 0, as in Job.Attempts.
+
+// MarkProcessed records that an attempt of a job succeeded with result
+func (p *PostgresStorage) MarkProcessed(ctx context.Context, jobID string, attempt int, result json.RawMessage) error {
+	query := `
+		INSERT INTO processed_jobs (job_id, attempt, result, processed_at)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (job_id, attempt) DO NOTHING
+	`
+
+	sealed, err := p.cipher.Seal(ctx, result)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt job result: %w", err)
+	}
+
+	if _, err := p.db.ExecContext(ctx, query, jobID, attempt, sealed, time.Now()); err != nil {
+		return fmt.Errorf("failed to record processed job: %w", err)
+	}
+	return nil
+}
+
+// ProcessedResult returns the recorded result of a successful attempt, and
+// whether the attempt was recorded
+func (p *PostgresStorage) ProcessedResult(ctx context.Context, jobID string, attempt int) (json.RawMessage, bool, error) {
+	query := `SELECT result FROM processed_jobs WHERE job_id = $1 AND attempt = $2`
+
+	var result sql.NullString
+	err := p.db.QueryRowContext(ctx, query, jobID, attempt).Scan(&result)
+	if err == sql.ErrNoRows {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to get processed job: %w", err)
+	}
+	if !result.Valid {
+		return nil, true, nil
+	}
+
+	opened, err := p.cipher.Open(ctx, json.RawMessage(result.String))
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to decrypt job result: %w", err)
+	}
+	return opened, true, nil
+}
+
+// ClearProcessed removes a job's recorded attempts
+func (p *PostgresStorage) ClearProcessed(ctx context.Context, jobID string) error {
+	if _, err := p.db.ExecContext(ctx, `DELETE FROM processed_jobs WHERE job_id = $1`, jobID); err != nil {
+		return fmt.Errorf("failed to clear processed job: %w", err)
+	}
+	return nil
+}
+
+// openJob decrypts a scanned job's payload, result, checkpoint and
+// follow-up payloads in place
+func (p *PostgresStorage) openJob(ctx context.Context, job *types.Job) error {
+	var err error
+	if job.Payload, err = p.cipher.Open(ctx, job.Payload); err != nil {
+		return fmt.Errorf("failed to decrypt job payload: %w", err)
+	}
+	if job.Result, err = p.cipher.Open(ctx, job.Result); err != nil {
+		return fmt.Errorf("failed to decrypt job result: %w", err)
+	}
+	if job.Checkpoint, err = p.cipher.Open(ctx, job.Checkpoint); err != nil {
+		return fmt.Errorf("failed to decrypt job checkpoint: %w", err)
+	}
+	open := func(value json.RawMessage) (json.RawMessage, error) {
+		return p.cipher.Open(ctx, value)
+	}
+	if job.OnSuccess, err = job.OnSuccess.MapPayloads(open); err != nil {
+		return fmt.Errorf("failed to decrypt follow-up payload: %w", err)
+	}
+	if job.OnFailure, err = job.OnFailure.MapPayloads(open); err != nil {
+		return fmt.Errorf("failed to decrypt follow-up payload: %w", err)
+	}
+	return nil
+}
+
+// sealFollowUp encodes a follow-up request for storage with its payloads
+// encrypted
+func (p *PostgresStorage) sealFollowUp(ctx context.Context, req *types.JobRequest) ([]byte, error) {
+	if req == nil {
+		return nil, nil
+	}
+	sealed, err := req.MapPayloads(func(value json.RawMessage) (json.RawMessage, error) {
+		return p.cipher.Seal(ctx, value)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt follow-up payload: %w", err)
+	}
+	data, err := json.Marshal(sealed)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal follow-up job: %w", err)
+	}
+	return data, nil
 }
 
 // RegisterWorker registers or updates a worker
@@ -283,18 +1166,35 @@ func (p *PostgresStorage) RegisterWorker(ctx context.Context, worker *types.Work
 		return fmt.Errorf("failed to marshal job types: %w", err)
 	}
 
+	currentJobsJSON, err := json.Marshal(worker.CurrentJobs)
+	if err != nil {
+		return fmt.Errorf("failed to marshal current jobs: %w", err)
+	}
+
+	var degradedJSON []byte
+	if len(worker.Degraded) > 0 {
+		degradedJSON, err = json.Marshal(worker.Degraded)
+		if err != nil {
+			return fmt.Errorf("failed to marshal degraded job types: %w", err)
+		}
+	}
+
 	query := `
-		INSERT INTO workers (id, status, last_seen, job_types, current_job)
-		VALUES ($1, $2, $3, $4, $5)
+		INSERT INTO workers (id, status, last_seen, job_types, concurrency, current_job, current_jobs, degraded)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
 		ON CONFLICT (id) DO UPDATE SET
 			status = EXCLUDED.status,
 			last_seen = EXCLUDED.last_seen,
 			job_types = EXCLUDED.job_types,
-			current_job = EXCLUDED.current_job
+			concurrency = EXCLUDED.concurrency,
+			current_job = EXCLUDED.current_job,
+			current_jobs = EXCLUDED.current_jobs,
+			degraded = EXCLUDED.degraded
 	`
 
-	_, err = p.db.ExecContext(ctx, query,
-		worker.ID, worker.Status, worker.LastSeen, jobTypesJSON, worker.CurrentJob,
+	_, err = p.exec(ctx, query,
+		worker.ID, worker.Status, worker.LastSeen, jobTypesJSON, worker.Concurrency,
+		nullString(worker.CurrentJob), currentJobsJSON, degradedJSON,
 	)
 
 	if err != nil {
@@ -304,13 +1204,32 @@ func (p *PostgresStorage) RegisterWorker(ctx context.Context, worker *types.Work
 	return nil
 }
 
+// GetWorker retrieves a single worker by ID
+func (p *PostgresStorage) GetWorker(ctx context.Context, workerID string) (*types.Worker, error) {
+	query := `
+		SELECT id, status, last_seen, job_types, concurrency, current_job, current_jobs, degraded
+		FROM workers
+		WHERE id = $1
+	`
+
+	worker, err := scanWorker(p.db.QueryRowContext(ctx, query, workerID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("%w: %s", ErrWorkerNotFound, workerID)
+		}
+		return nil, fmt.Errorf("failed to get worker: %w", err)
+	}
+
+	return worker, nil
+}
+
 // GetWorkers retrieves all active workers
 func (p *PostgresStorage) GetWorkers(ctx context.Context) ([]types.Worker, error) {
 	// Consider workers active if they've been seen in the last 5 minutes
 	query := `
-		SELECT id, status, last_seen, job_types, current_job
+		SELECT id, status, last_seen, job_types, concurrency, current_job, current_jobs, degraded
 		FROM workers
-		WHERE last_seen > $1
+		WHERE last_seen > $1 AND status != 'offline'
 		ORDER BY last_seen DESC
 	`
 
@@ -323,32 +1242,127 @@ func (p *PostgresStorage) GetWorkers(ctx context.Context) ([]types.Worker, error
 
 	var workers []types.Worker
 	for rows.Next() {
-		var worker types.Worker
-		var jobTypesJSON string
-		var currentJob sql.NullString
-
-		err := rows.Scan(
-			&worker.ID, &worker.Status, &worker.LastSeen, &jobTypesJSON, &currentJob,
-		)
+		worker, err := scanWorker(rows)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan worker: %w", err)
 		}
 
-		// Parse job types
-		if err := json.Unmarshal([]byte(jobTypesJSON), &worker.JobTypes); err != nil {
-			return nil, fmt.Errorf("failed to unmarshal job types: %w", err)
+		workers = append(workers, *worker)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating workers: %w", err)
+	}
+
+	return workers, nil
+}
+
+// SetWorkerCommand stores the pending control command for a worker.
+// Resume clears any pending command.
+func (p *PostgresStorage) SetWorkerCommand(ctx context.Context, workerID string, cmd types.WorkerCommand) error {
+	if cmd == types.WorkerCommandResume {
+		cmd = ""
+	}
+
+	query := `UPDATE workers SET command = $2 WHERE id = $1`
+	if _, err := p.db.ExecContext(ctx, query, workerID, nullString(string(cmd))); err != nil {
+		return fmt.Errorf("failed to set worker command: %w", err)
+	}
+	return nil
+}
+
+// GetWorkerCommand returns the pending control command for a worker, or
+// resume if there is none
+func (p *PostgresStorage) GetWorkerCommand(ctx context.Context, workerID string) (types.WorkerCommand, error) {
+	var cmd sql.NullString
+	err := p.db.QueryRowContext(ctx, `SELECT command FROM workers WHERE id = $1`, workerID).Scan(&cmd)
+	if err != nil && err != sql.ErrNoRows {
+		return "", fmt.Errorf("failed to get worker command: %w", err)
+	}
+	if !cmd.Valid {
+		return types.WorkerCommandResume, nil
+	}
+	return types.WorkerCommand(cmd.String), nil
+}
+
+// scanWorker reads a row selected by GetWorker or GetWorkers
+func scanWorker(row rowScanner) (*types.Worker, error) {
+	var worker types.Worker
+	var jobTypesJSON string
+	var currentJob sql.NullString
+	var currentJobsJSON, degradedJSON []byte
+
+	err := row.Scan(
+		&worker.ID, &worker.Status, &worker.LastSeen, &jobTypesJSON, &worker.Concurrency,
+		&currentJob, &currentJobsJSON, &degradedJSON,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	// Parse job types
+	if err := json.Unmarshal([]byte(jobTypesJSON), &worker.JobTypes); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal job types: %w", err)
+	}
+
+	if currentJob.Valid {
+		worker.CurrentJob = currentJob.String
+	}
+
+	if len(currentJobsJSON) > 0 {
+		if err := json.Unmarshal(currentJobsJSON, &worker.CurrentJobs); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal current jobs: %w", err)
 		}
+	}
 
-		if currentJob.Valid {
-			worker.CurrentJob = currentJob.String
+	if len(degradedJSON) > 0 {
+		if err := json.Unmarshal(degradedJSON, &worker.Degraded); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal degraded job types: %w", err)
 		}
+	}
+
+	return &worker, nil
+}
+
+// SaveJobSchema stores the payload schema registered for a job type
+func (p *PostgresStorage) SaveJobSchema(ctx context.Context, jobType types.JobType, schema json.RawMessage) error {
+	query := `
+		INSERT INTO job_schemas (job_type, schema, updated_at)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (job_type) DO UPDATE SET
+			schema = EXCLUDED.schema,
+			updated_at = EXCLUDED.updated_at
+	`
 
-		workers = append(workers, worker)
+	_, err := p.db.ExecContext(ctx, query, jobType, schema, time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to save job schema: %w", err)
+	}
+
+	return nil
+}
+
+// GetJobSchemas retrieves all stored payload schemas
+func (p *PostgresStorage) GetJobSchemas(ctx context.Context) (map[types.JobType]json.RawMessage, error) {
+	rows, err := p.db.QueryContext(ctx, `SELECT job_type, schema FROM job_schemas`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query job schemas: %w", err)
+	}
+	defer rows.Close()
+
+	schemas := make(map[types.JobType]json.RawMessage)
+	for rows.Next() {
+		var jobType types.JobType
+		var schema string
+		if err := rows.Scan(&jobType, &schema); err != nil {
+			return nil, fmt.Errorf("failed to scan job schema: %w", err)
+		}
+		schemas[jobType] = json.RawMessage(schema)
 	}
 
 	if err := rows.Err(); err != nil {
-		return nil, fmt.Errorf("error iterating workers: %w", err)
+		return nil, fmt.Errorf("error iterating job schemas: %w", err)
 	}
 
-	return workers, nil
+	return schemas, nil
 }
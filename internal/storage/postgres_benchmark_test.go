@@ -0,0 +1,221 @@
+//go:build bench
+
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"taskflow/internal/testutil"
+	"taskflow/internal/types"
+	"testing"
+	"time"
+)
+
+// The storage benchmarks mirror the Redis queue benchmarks. They run
+// against the test PostgreSQL server, on a plain jobs table and on one
+// partitioned by month, so that index and partitioning changes can be
+// compared with benchstat. BenchmarkListJobs seeds a million jobs per
+// layout, so they are only built with the bench tag:
+//
+//	go test -tags bench -run '^$' -bench . -benchmem ./internal/storage/
+var benchJobs = flag.Int("bench.jobs", 1_000_000, "jobs seeded for BenchmarkListJobs")
+
+// benchMonths is how far back seeded jobs were created, each month in its
+// own partition
+const benchMonths = 12
+
+// benchLayouts are the jobs table layouts every benchmark runs on
+var benchLayouts = []struct {
+	name        string
+	partitioned bool
+}{
+	{"plain", false},
+	{"partitioned", true},
+}
+
+// newBenchStorage returns storage on an empty test database. A
+// partitioned jobs table has a partition for each of the last benchMonths
+// months and the next one, as after a year of maintenance.
+func newBenchStorage(b *testing.B, partitioned bool) *PostgresStorage {
+	b.Helper()
+	storage, err := NewPostgresStorage(testutil.Postgres(b))
+	if err != nil {
+		b.Fatalf("NewPostgresStorage: %v", err)
+	}
+	b.Cleanup(func() { storage.Close() })
+
+	if partitioned {
+		since := time.Now().AddDate(0, -benchMonths, 0)
+		if _, err := storage.PartitionJobs(context.Background(), since, benchMonths+1); err != nil {
+			b.Fatalf("PartitionJobs: %v", err)
+		}
+	}
+	return storage
+}
+
+func newBenchJob() *types.Job {
+	payload, _ := json.Marshal(types.WebhookPayload{
+		URL:    "https://httpbin.org/post",
+		Method: "POST",
+		Data:   map[string]interface{}{"test": "data"},
+	})
+	return types.NewJob(&types.JobRequest{Type: types.JobTypeWebhook, Payload: payload})
+}
+
+// BenchmarkCreateJob measures concurrent single-job inserts, as the API
+// makes for each submission
+func BenchmarkCreateJob(b *testing.B) {
+	for _, layout := range benchLayouts {
+		b.Run(layout.name, func(b *testing.B) {
+			storage := newBenchStorage(b, layout.partitioned)
+			ctx := context.Background()
+
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					if err := storage.CreateJob(ctx, newBenchJob()); err != nil {
+						b.Fatalf("Failed to create job: %v", err)
+					}
+				}
+			})
+		})
+	}
+}
+
+// BenchmarkCreateJobs measures inserting jobs in batches of 100, as for
+// batch submissions, for comparison with BenchmarkCreateJob
+func BenchmarkCreateJobs(b *testing.B) {
+	for _, layout := range benchLayouts {
+		b.Run(layout.name, func(b *testing.B) {
+			storage := newBenchStorage(b, layout.partitioned)
+			ctx := context.Background()
+
+			const batch = 100
+			jobs := make([]*types.Job, batch)
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i += batch {
+				for j := range jobs {
+					jobs[j] = newBenchJob()
+				}
+				if err := storage.CreateJobs(ctx, jobs); err != nil {
+					b.Fatalf("Failed to create jobs: %v", err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkUpdateJob measures the versioned update of a job moving
+// between statuses, over 1000 jobs so rows aren't always hot
+func BenchmarkUpdateJob(b *testing.B) {
+	for _, layout := range benchLayouts {
+		b.Run(layout.name, func(b *testing.B) {
+			storage := newBenchStorage(b, layout.partitioned)
+			ctx := context.Background()
+
+			jobs := make([]*types.Job, 1000)
+			for i := range jobs {
+				jobs[i] = newBenchJob()
+			}
+			if err := storage.CreateJobs(ctx, jobs); err != nil {
+				b.Fatalf("Failed to create jobs: %v", err)
+			}
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				job := jobs[i%len(jobs)]
+				now := time.Now()
+				if job.Status == types.JobStatusPending {
+					job.Status, job.WorkerID, job.StartedAt = types.JobStatusProcessing, "bench-worker", &now
+				} else {
+					job.Status, job.WorkerID, job.StartedAt = types.JobStatusPending, "", nil
+				}
+				job.UpdatedAt = now
+				if err := storage.UpdateJob(ctx, job); err != nil {
+					b.Fatalf("Failed to update job: %v", err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkListJobs measures the job listings of the API and dashboard
+// over -bench.jobs jobs created during the last benchMonths months
+func BenchmarkListJobs(b *testing.B) {
+	listings := []struct {
+		name            string
+		tenant          string
+		page            int
+		status, jobType string
+		errorCode       string
+	}{
+		{name: "newest", page: 1},
+		{name: "status", page: 1, status: string(types.JobStatusPending)},
+		{name: "type_status", page: 1, status: string(types.JobStatusFailed), jobType: string(types.JobTypeWebhook)},
+		{name: "tenant", page: 1, tenant: "tenant_7"},
+		{name: "error_code", page: 1, errorCode: string(types.ErrorCodeDownstream5xx)},
+		{name: "deep_page", page: 100},
+	}
+
+	for _, layout := range benchLayouts {
+		b.Run(layout.name, func(b *testing.B) {
+			storage := newBenchStorage(b, layout.partitioned)
+			seedBenchJobs(b, storage, *benchJobs)
+
+			for _, listing := range listings {
+				b.Run(listing.name, func(b *testing.B) {
+					ctx := context.Background()
+					fields := types.DefaultListFields()
+					for i := 0; i < b.N; i++ {
+						_, _, err := storage.ListJobs(ctx, listing.tenant, listing.page, 50,
+							listing.status, listing.jobType, listing.errorCode, fields)
+						if err != nil {
+							b.Fatalf("Failed to list jobs: %v", err)
+						}
+					}
+				})
+			}
+		})
+	}
+}
+
+// seedBenchJobs inserts n finished and unfinished jobs of every type,
+// spread over 50 tenants and the last benchMonths months, in one
+// statement rather than through CreateJobs, and analyzes the table
+func seedBenchJobs(b *testing.B, storage *PostgresStorage, n int) {
+	b.Helper()
+	start := time.Now()
+	_, err := storage.db.Exec(`
+		INSERT INTO jobs (id, type, payload, status, error, error_code, attempts, max_attempts,
+			created_at, updated_at, scheduled_at, completed_at, tenant_id)
+		SELECT
+			'bench_' || i,
+			(ARRAY['email', 'webhook', 'image_resize', 'data_export'])[1 + (i / 3) % 4],
+			'{"url": "https://example.com/hook"}',
+			s.status,
+			CASE WHEN s.status = 'failed' THEN 'downstream returned 503' END,
+			CASE WHEN s.status = 'failed' THEN $2 END,
+			CASE WHEN s.status = 'failed' THEN 3 ELSE 0 END,
+			3,
+			t.created_at, t.created_at, t.created_at,
+			CASE WHEN s.status IN ('completed', 'failed') THEN t.created_at + interval '1 second' END,
+			'tenant_' || (i % 50)
+		FROM generate_series(1, $1::int) AS i,
+			LATERAL (SELECT CASE
+				WHEN i % 100 = 0 THEN 'pending'
+				WHEN i % 100 = 1 THEN 'processing'
+				WHEN i % 20 = 2 THEN 'failed'
+				ELSE 'completed'
+			END AS status) AS s,
+			LATERAL (SELECT now() - make_interval(secs => (i::float8 / $1) * $3) AS created_at) AS t
+	`, n, string(types.ErrorCodeDownstream5xx), time.Since(time.Now().AddDate(0, -benchMonths, 0)).Seconds())
+	if err != nil {
+		b.Fatalf("Failed to seed jobs: %v", err)
+	}
+	if _, err := storage.db.Exec(`ANALYZE jobs`); err != nil {
+		b.Fatalf("Failed to analyze jobs: %v", err)
+	}
+	b.Logf("Seeded %d jobs in %v", n, time.Since(start).Round(time.Millisecond))
+}
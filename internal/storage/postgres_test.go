@@ -0,0 +1,152 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"taskflow/internal/testutil"
+	"taskflow/internal/types"
+	"testing"
+	"time"
+)
+
+func TestMain(m *testing.M) {
+	os.Exit(testutil.Run(m))
+}
+
+// newTestStorage returns storage on an empty, migrated test database
+func newTestStorage(t *testing.T) *PostgresStorage {
+	t.Helper()
+	storage, err := NewPostgresStorage(testutil.Postgres(t))
+	if err != nil {
+		t.Fatalf("NewPostgresStorage: %v", err)
+	}
+	t.Cleanup(func() { storage.Close() })
+	return storage
+}
+
+func newTestJob(jobType types.JobType) *types.Job {
+	return types.NewJob(&types.JobRequest{
+		Type:    jobType,
+		Payload: json.RawMessage(`{"url": "https://example.com/hook"}`),
+	})
+}
+
+func TestPostgresStorageJobs(t *testing.T) {
+	storage := newTestStorage(t)
+	ctx := context.Background()
+
+	job := newTestJob(types.JobTypeWebhook)
+	if err := storage.CreateJob(ctx, job); err != nil {
+		t.Fatalf("CreateJob: %v", err)
+	}
+
+	stored, err := storage.GetJob(ctx, job.ID)
+	if err != nil {
+		t.Fatalf("GetJob: %v", err)
+	}
+	if stored.Type != job.Type || stored.Status != types.JobStatusPending || string(stored.Payload) != string(job.Payload) {
+		t.Errorf("stored job = %+v, want the created job", stored)
+	}
+
+	if _, err := storage.GetJob(ctx, "missing"); !errors.Is(err, ErrJobNotFound) {
+		t.Errorf("GetJob of a missing job = %v, want ErrJobNotFound", err)
+	}
+
+	// Claims only apply to jobs still in the expected status
+	stored.Status = types.JobStatusProcessing
+	stored.WorkerID = "worker-1"
+	stored.UpdatedAt = time.Now()
+	if claimed, err := storage.UpdateJobIf(ctx, stored, types.JobStatusPending); err != nil || !claimed {
+		t.Fatalf("UpdateJobIf of a pending job = %v, %v; want claimed", claimed, err)
+	}
+	if claimed, err := storage.UpdateJobIf(ctx, stored, types.JobStatusPending); err != nil || claimed {
+		t.Errorf("UpdateJobIf of a claimed job = %v, %v; want not claimed", claimed, err)
+	}
+}
+
+// TestPostgresStorageUpdateJobConflict checks that of two updates made
+// from the same version of a job, the second fails and leaves the first's
+// changes in place
+func TestPostgresStorageUpdateJobConflict(t *testing.T) {
+	storage := newTestStorage(t)
+	ctx := context.Background()
+
+	job := newTestJob(types.JobTypeWebhook)
+	if err := storage.CreateJob(ctx, job); err != nil {
+		t.Fatalf("CreateJob: %v", err)
+	}
+	first, err := storage.GetJob(ctx, job.ID)
+	if err != nil {
+		t.Fatalf("GetJob: %v", err)
+	}
+	second, err := storage.GetJob(ctx, job.ID)
+	if err != nil {
+		t.Fatalf("GetJob: %v", err)
+	}
+	read := first.Version
+
+	first.Status, first.WorkerID, first.UpdatedAt = types.JobStatusProcessing, "worker-1", time.Now()
+	if err := storage.UpdateJob(ctx, first); err != nil {
+		t.Fatalf("first UpdateJob: %v", err)
+	}
+	if first.Version != read+1 {
+		t.Errorf("version after an update = %d, want %d", first.Version, read+1)
+	}
+
+	second.Status, second.Error, second.UpdatedAt = types.JobStatusCancelled, "cancelled", time.Now()
+	if err := storage.UpdateJob(ctx, second); !errors.Is(err, ErrJobConflict) {
+		t.Fatalf("second UpdateJob from version %d = %v, want ErrJobConflict", read, err)
+	}
+	if second.Version != read {
+		t.Errorf("version of the rejected update = %d, want it left at %d", second.Version, read)
+	}
+
+	stored, err := storage.GetJob(ctx, job.ID)
+	if err != nil {
+		t.Fatalf("GetJob: %v", err)
+	}
+	if stored.Status != types.JobStatusProcessing || stored.WorkerID != "worker-1" || stored.Error != "" || stored.Version != first.Version {
+		t.Errorf("stored job = %s on %q with error %q at version %d, want the first update's processing on worker-1 at version %d",
+			stored.Status, stored.WorkerID, stored.Error, stored.Version, first.Version)
+	}
+
+	missing := newTestJob(types.JobTypeWebhook)
+	if err := storage.UpdateJob(ctx, missing); !errors.Is(err, ErrJobNotFound) {
+		t.Errorf("UpdateJob of a missing job = %v, want ErrJobNotFound", err)
+	}
+}
+
+func TestPostgresStorageListJobsByErrorCode(t *testing.T) {
+	storage := newTestStorage(t)
+	ctx := context.Background()
+
+	timedOut, legacy, ok := newTestJob(types.JobTypeWebhook), newTestJob(types.JobTypeWebhook), newTestJob(types.JobTypeWebhook)
+	timedOut.Status, timedOut.Error, timedOut.ErrorCode = types.JobStatusFailed, "deadline exceeded", types.ErrorCodeTimeout
+	legacy.Status, legacy.Error = types.JobStatusFailed, "failed before codes were recorded"
+	if err := storage.CreateJobs(ctx, []*types.Job{timedOut, legacy, ok}); err != nil {
+		t.Fatalf("CreateJobs: %v", err)
+	}
+
+	tests := map[types.ErrorCode][]string{
+		types.ErrorCodeTimeout: {timedOut.ID},
+		types.ErrorCodeUnknown: {legacy.ID},
+		types.ErrorCodePanic:   nil,
+	}
+	for code, want := range tests {
+		jobs, total, err := storage.ListJobs(ctx, "", 1, 10, "", "", string(code), types.DefaultListFields())
+		if err != nil {
+			t.Fatalf("ListJobs(%s): %v", code, err)
+		}
+		if total != len(want) || len(jobs) != len(want) {
+			t.Errorf("ListJobs(%s) = %d jobs of %d, want %d", code, len(jobs), total, len(want))
+			continue
+		}
+		for i, job := range jobs {
+			if job.ID != want[i] {
+				t.Errorf("ListJobs(%s)[%d] = %s, want %s", code, i, job.ID, want[i])
+			}
+		}
+	}
+}
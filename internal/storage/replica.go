@@ -0,0 +1,82 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// List, stats and audit queries can run on a read-only streaming replica,
+// taking their load off the primary. Before each of them the replica's
+// replayed WAL position is compared with the primary's current one, and
+// the query runs on the primary unless the replica has caught up. A job
+// listed after it was created, by any API server, is never missing, and
+// a lagging or unreachable replica only costs the offload.
+
+// replicaCheckTimeout bounds the replica's position check, so an
+// unreachable replica doesn't hold up queries the primary can answer
+const replicaCheckTimeout = time.Second
+
+// WithReplica sends read-only queries to the replica at databaseURL
+func WithReplica(databaseURL string) Option {
+	return func(p *PostgresStorage) {
+		p.replicaURL = databaseURL
+	}
+}
+
+// openReplica connects to the replica, sized like the primary's pool
+func (p *PostgresStorage) openReplica() error {
+	connector, err := pq.NewConnector(p.replicaURL)
+	if err != nil {
+		return fmt.Errorf("failed to open replica: %w", err)
+	}
+	db := sql.OpenDB(connector)
+	db.SetMaxOpenConns(p.pool.MaxOpenConns)
+	db.SetMaxIdleConns(p.pool.MaxIdleConns)
+	db.SetConnMaxLifetime(p.pool.ConnMaxLifetime)
+	db.SetConnMaxIdleTime(p.pool.ConnMaxIdleTime)
+
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return fmt.Errorf("failed to ping replica: %w", err)
+	}
+	p.replica = db
+	return nil
+}
+
+// ReplicaStats returns the replica's connection pool stats, and false
+// without a replica
+func (p *PostgresStorage) ReplicaStats() (sql.DBStats, bool) {
+	if p.replica == nil {
+		return sql.DBStats{}, false
+	}
+	return p.replica.Stats(), true
+}
+
+// reader returns the replica if it has replayed everything committed on
+// the primary so far, and the primary otherwise
+func (p *PostgresStorage) reader(ctx context.Context) *sql.DB {
+	if p.replica == nil {
+		return p.db
+	}
+
+	var lsn string
+	if err := p.queryRow(ctx, `SELECT pg_current_wal_lsn()::text`).Scan(&lsn); err != nil {
+		return p.db
+	}
+
+	checkCtx, cancel := context.WithTimeout(ctx, replicaCheckTimeout)
+	defer cancel()
+
+	var caughtUp bool
+	err := p.replica.QueryRowContext(checkCtx,
+		`SELECT COALESCE(pg_last_wal_replay_lsn() >= $1::pg_lsn, false)`, lsn,
+	).Scan(&caughtUp)
+	if err != nil || !caughtUp {
+		return p.db
+	}
+	return p.replica
+}
@@ -0,0 +1,208 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"taskflow/internal/types"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// JobResult is a completed job's result, held inline or in blob storage
+type JobResult struct {
+	JobID     string
+	Result    json.RawMessage // Set when held inline
+	Ref       string          // Set when held in blob storage
+	Checksum  string          // Set when streamed to blob storage
+	Size      int
+	CreatedAt time.Time
+	ExpiresAt *time.Time
+}
+
+// SaveResult stores a job's result, replacing any earlier one. Results are
+// kept apart from jobs so that large ones don't bloat job queries, and
+// expire at expiresAt if it is set.
+func (p *PostgresStorage) SaveResult(ctx context.Context, result *JobResult) error {
+	sealed, err := p.cipher.Seal(ctx, result.Result)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt job result: %w", err)
+	}
+
+	_, err = p.db.ExecContext(ctx, `
+		INSERT INTO job_results (job_id, result, result_ref, checksum, size, created_at, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (job_id) DO UPDATE SET
+			result = EXCLUDED.result, result_ref = EXCLUDED.result_ref, checksum = EXCLUDED.checksum,
+			size = EXCLUDED.size, created_at = EXCLUDED.created_at, expires_at = EXCLUDED.expires_at
+	`, result.JobID, sealed, nullString(result.Ref), nullString(result.Checksum), result.Size, result.CreatedAt, result.ExpiresAt)
+	if err != nil {
+		return fmt.Errorf("failed to save job result: %w", err)
+	}
+
+	return nil
+}
+
+// GetResult retrieves a job's unexpired result
+func (p *PostgresStorage) GetResult(ctx context.Context, jobID string) (*JobResult, error) {
+	query := `
+		SELECT job_id, result, result_ref, checksum, size, created_at, expires_at
+		FROM job_results
+		WHERE job_id = $1 AND (expires_at IS NULL OR expires_at > NOW())
+	`
+
+	var result JobResult
+	var data, ref, checksum sql.NullString
+	var expiresAt sql.NullTime
+	err := p.db.QueryRowContext(ctx, query, jobID).Scan(
+		&result.JobID, &data, &ref, &checksum, &result.Size, &result.CreatedAt, &expiresAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, ErrResultNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get job result: %w", err)
+	}
+
+	if data.Valid {
+		if result.Result, err = p.cipher.Open(ctx, json.RawMessage(data.String)); err != nil {
+			return nil, fmt.Errorf("failed to decrypt job result: %w", err)
+		}
+	}
+	if ref.Valid {
+		result.Ref = ref.String
+	}
+	result.Checksum = checksum.String
+	if expiresAt.Valid {
+		result.ExpiresAt = &expiresAt.Time
+	}
+
+	return &result, nil
+}
+
+// DeleteExpiredResults deletes results that expired before now and returns
+// the blob refs of those held in blob storage, which the caller deletes
+func (p *PostgresStorage) DeleteExpiredResults(ctx context.Context, now time.Time) (int, []string, error) {
+	rows, err := p.db.QueryContext(ctx, `
+		DELETE FROM job_results
+		WHERE expires_at <= $1
+		RETURNING result_ref
+	`, now)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to delete expired results: %w", err)
+	}
+	defer rows.Close()
+
+	deleted := 0
+	var refs []string
+	for rows.Next() {
+		var ref sql.NullString
+		if err := rows.Scan(&ref); err != nil {
+			return 0, nil, fmt.Errorf("failed to scan expired result: %w", err)
+		}
+		deleted++
+		if ref.Valid {
+			refs = append(refs, ref.String)
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return 0, nil, fmt.Errorf("error iterating expired results: %w", err)
+	}
+
+	return deleted, refs, nil
+}
+
+// attachResult sets a job's result from the results table. Jobs completed
+// before results were stored separately keep the result read with the job.
+func (p *PostgresStorage) attachResult(ctx context.Context, job *types.Job) error {
+	if job.Status != types.JobStatusCompleted {
+		return nil
+	}
+
+	result, err := p.GetResult(ctx, job.ID)
+	if err == ErrResultNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	job.Result = result.Result
+	job.ResultRef = result.Ref
+	job.ResultChecksum = result.Checksum
+	job.ResultExpiresAt = result.ExpiresAt
+	return nil
+}
+
+// DeleteResult deletes a job's result and returns its blob ref, if it was
+// held in blob storage
+func (p *PostgresStorage) DeleteResult(ctx context.Context, jobID string) (string, error) {
+	var ref sql.NullString
+	err := p.db.QueryRowContext(ctx,
+		`DELETE FROM job_results WHERE job_id = $1 RETURNING result_ref`, jobID,
+	).Scan(&ref)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to delete job result: %w", err)
+	}
+	return ref.String, nil
+}
+
+// attachResults sets the results of the completed jobs among jobs from the
+// results table, in one query
+func (p *PostgresStorage) attachResults(ctx context.Context, jobs []types.Job) error {
+	index := make(map[string]*types.Job)
+	var ids []string
+	for i := range jobs {
+		if jobs[i].Status == types.JobStatusCompleted {
+			index[jobs[i].ID] = &jobs[i]
+			ids = append(ids, jobs[i].ID)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	rows, err := p.db.QueryContext(ctx, `
+		SELECT job_id, result, result_ref, checksum, expires_at
+		FROM job_results
+		WHERE job_id = ANY($1) AND (expires_at IS NULL OR expires_at > NOW())
+	`, pq.Array(ids))
+	if err != nil {
+		return fmt.Errorf("failed to get job results: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var jobID string
+		var data, ref, checksum sql.NullString
+		var expiresAt sql.NullTime
+		if err := rows.Scan(&jobID, &data, &ref, &checksum, &expiresAt); err != nil {
+			return fmt.Errorf("failed to scan job result: %w", err)
+		}
+
+		job := index[jobID]
+		job.Result = nil
+		if data.Valid {
+			if job.Result, err = p.cipher.Open(ctx, json.RawMessage(data.String)); err != nil {
+				return fmt.Errorf("failed to decrypt job result: %w", err)
+			}
+		}
+		job.ResultRef = ref.String
+		job.ResultChecksum = checksum.String
+		if expiresAt.Valid {
+			job.ResultExpiresAt = &expiresAt.Time
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating job results: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,78 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+)
+
+// Hot queries run through prepared statements, so PostgreSQL parses and
+// plans them once per connection instead of on every call. database/sql
+// prepares a cached statement again on each connection it runs on.
+// Poolers that don't keep a session per client, such as PgBouncer in
+// transaction mode, need WithoutPreparedStatements.
+
+// WithoutPreparedStatements sends every query as text
+func WithoutPreparedStatements() Option {
+	return func(p *PostgresStorage) {
+		p.noPrepare = true
+	}
+}
+
+// statements caches prepared statements by query
+type statements struct {
+	mu    sync.Mutex
+	stmts map[string]*sql.Stmt
+}
+
+// prepared returns the cached statement for query, preparing it on first
+// use. It returns nil if statements are disabled or query can't be
+// prepared, and the caller runs the query as text.
+func (p *PostgresStorage) prepared(ctx context.Context, query string) *sql.Stmt {
+	if p.noPrepare {
+		return nil
+	}
+
+	p.stmts.mu.Lock()
+	defer p.stmts.mu.Unlock()
+	if stmt, ok := p.stmts.stmts[query]; ok {
+		return stmt
+	}
+
+	stmt, err := p.db.PrepareContext(ctx, query)
+	if err != nil {
+		// Running the query reports the error
+		return nil
+	}
+	if p.stmts.stmts == nil {
+		p.stmts.stmts = make(map[string]*sql.Stmt)
+	}
+	p.stmts.stmts[query] = stmt
+	return stmt
+}
+
+// exec runs a statement through its prepared statement
+func (p *PostgresStorage) exec(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	if stmt := p.prepared(ctx, query); stmt != nil {
+		return stmt.ExecContext(ctx, args...)
+	}
+	return p.db.ExecContext(ctx, query, args...)
+}
+
+// queryRow runs a query returning one row through its prepared statement
+func (p *PostgresStorage) queryRow(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	if stmt := p.prepared(ctx, query); stmt != nil {
+		return stmt.QueryRowContext(ctx, args...)
+	}
+	return p.db.QueryRowContext(ctx, query, args...)
+}
+
+// closeStatements releases the cached statements
+func (p *PostgresStorage) closeStatements() {
+	p.stmts.mu.Lock()
+	defer p.stmts.mu.Unlock()
+	for query, stmt := range p.stmts.stmts {
+		stmt.Close()
+		delete(p.stmts.stmts, query)
+	}
+}
@@ -0,0 +1,65 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"taskflow/internal/types"
+	"time"
+)
+
+// Storage is the durable record of jobs, workers and workflows that the
+// API, workers and coordinators read and write. PostgresStorage implements
+// it; the fakes in storagetest stand in for it in tests.
+type Storage interface {
+	Ping(ctx context.Context) error
+
+	CreateJob(ctx context.Context, job *types.Job) error
+	CreateJobs(ctx context.Context, jobs []*types.Job) error
+	GetJob(ctx context.Context, jobID string) (*types.Job, error)
+	UpdateJob(ctx context.Context, job *types.Job) error
+	ExistingJobs(ctx context.Context, ids []string) (map[string]bool, error)
+	JobVersion(ctx context.Context, jobID string) (types.JobStatus, int, error)
+	ListJobs(ctx context.Context, tenantID string, page, pageSize int, status, jobType, errorCode string, fields types.JobFields) ([]types.Job, int, error)
+	CountJobs(ctx context.Context) ([]JobCount, error)
+	JobTimeseries(ctx context.Context, tenantID, jobType string, from, to time.Time, interval time.Duration) ([]TimeseriesBucket, error)
+	UnfinishedJobs(ctx context.Context, before time.Time, afterID string, limit int) ([]types.Job, error)
+	ExpiredJobs(ctx context.Context, before time.Time, limit int) ([]types.Job, error)
+	MaintainJobs(ctx context.Context, now time.Time, retention time.Duration, ahead int) (JobMaintenance, error)
+
+	StartAttempt(ctx context.Context, job *types.Job) error
+	EndAttempt(ctx context.Context, jobID string, outcome types.AttemptOutcome, errorMsg string) error
+	JobAttempts(ctx context.Context, jobID string) ([]types.JobAttempt, error)
+
+	// MarkProcessed, ProcessedResult and ClearProcessed keep the
+	// processed-jobs ledger, so that a job redelivered after a lost
+	// acknowledgement isn't run twice
+	MarkProcessed(ctx context.Context, jobID string, attempt int, result json.RawMessage) error
+	ProcessedResult(ctx context.Context, jobID string, attempt int) (json.RawMessage, bool, error)
+	ClearProcessed(ctx context.Context, jobID string) error
+
+	SaveResult(ctx context.Context, result *JobResult) error
+	GetResult(ctx context.Context, jobID string) (*JobResult, error)
+	DeleteResult(ctx context.Context, jobID string) (string, error)
+	DeleteExpiredResults(ctx context.Context, now time.Time) (int, []string, error)
+
+	RegisterWorker(ctx context.Context, worker *types.Worker) error
+	GetWorker(ctx context.Context, workerID string) (*types.Worker, error)
+	GetWorkers(ctx context.Context) ([]types.Worker, error)
+
+	CreateWorkflow(ctx context.Context, wf *types.Workflow) error
+	GetWorkflow(ctx context.Context, workflowID string) (*types.Workflow, error)
+	UpdateWorkflow(ctx context.Context, workflowID string, update func(*types.Workflow) error) (*types.Workflow, error)
+	ListWorkflows(ctx context.Context, tenantID string, page, pageSize int, status string) ([]types.Workflow, int, error)
+
+	SaveJobSchema(ctx context.Context, jobType types.JobType, schema json.RawMessage) error
+	GetJobSchemas(ctx context.Context) (map[types.JobType]json.RawMessage, error)
+
+	SaveEmailTemplate(ctx context.Context, tmpl *types.EmailTemplate) error
+	GetEmailTemplate(ctx context.Context, name string) (*types.EmailTemplate, error)
+	DeleteEmailTemplate(ctx context.Context, name string) error
+
+	RecordAudit(ctx context.Context, entry *types.AuditEntry) error
+	AuditLog(ctx context.Context, filter types.AuditFilter) ([]types.AuditEntry, error)
+}
+
+var _ Storage = (*PostgresStorage)(nil)
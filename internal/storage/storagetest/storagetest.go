@@ -0,0 +1,275 @@
+// Package storagetest provides an in-memory storage.Storage for tests of
+// the packages built on storage, such as the API handlers.
+package storagetest
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"taskflow/internal/storage"
+	"taskflow/internal/types"
+	"time"
+)
+
+// Storage is an in-memory storage.Storage. It keeps jobs, results,
+// workers and the audit log, with the versioning of PostgresStorage.
+// Other methods panic through the embedded nil Storage, so a test that
+// reaches one fails loudly rather than passing by accident.
+type Storage struct {
+	storage.Storage
+
+	mu      sync.Mutex
+	jobs    map[string]*types.Job
+	results map[string]*storage.JobResult
+	workers map[string]*types.Worker
+	audit   []types.AuditEntry
+	errs    map[string]error
+}
+
+// New returns an empty storage
+func New() *Storage {
+	return &Storage{
+		jobs:    make(map[string]*types.Job),
+		results: make(map[string]*storage.JobResult),
+		workers: make(map[string]*types.Worker),
+		errs:    make(map[string]error),
+	}
+}
+
+// FailWith makes the named method, such as "CreateJob", return err until
+// it is called again with a nil err
+func (s *Storage) FailWith(method string, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err == nil {
+		delete(s.errs, method)
+		return
+	}
+	s.errs[method] = err
+}
+
+// Audit returns the audit entries recorded so far
+func (s *Storage) Audit() []types.AuditEntry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]types.AuditEntry(nil), s.audit...)
+}
+
+func (s *Storage) Ping(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.errs["Ping"]
+}
+
+func (s *Storage) CreateJob(ctx context.Context, job *types.Job) error {
+	return s.CreateJobs(ctx, []*types.Job{job})
+}
+
+func (s *Storage) CreateJobs(ctx context.Context, jobs []*types.Job) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.fail("CreateJob", "CreateJobs"); err != nil {
+		return err
+	}
+	for _, job := range jobs {
+		if _, ok := s.jobs[job.ID]; ok {
+			return fmt.Errorf("failed to create job: job %s already exists", job.ID)
+		}
+	}
+	for _, job := range jobs {
+		stored := *job
+		stored.Version = 1
+		s.jobs[job.ID] = &stored
+		job.Version = 1
+	}
+	return nil
+}
+
+func (s *Storage) GetJob(ctx context.Context, jobID string) (*types.Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.fail("GetJob"); err != nil {
+		return nil, err
+	}
+	job, ok := s.jobs[jobID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", storage.ErrJobNotFound, jobID)
+	}
+	found := *job
+	return &found, nil
+}
+
+// UpdateJob stores job if it is still at job.Version, and returns
+// storage.ErrJobConflict if not
+func (s *Storage) UpdateJob(ctx context.Context, job *types.Job) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.fail("UpdateJob"); err != nil {
+		return err
+	}
+	stored, ok := s.jobs[job.ID]
+	if !ok {
+		return fmt.Errorf("%w: %s", storage.ErrJobNotFound, job.ID)
+	}
+	if stored.Version != job.Version {
+		return fmt.Errorf("%w: job %s is no longer at version %d", storage.ErrJobConflict, job.ID, job.Version)
+	}
+
+	updated := *job
+	updated.Version++
+	s.jobs[job.ID] = &updated
+	job.Version = updated.Version
+	return nil
+}
+
+func (s *Storage) JobVersion(ctx context.Context, jobID string) (types.JobStatus, int, error) {
+	job, err := s.GetJob(ctx, jobID)
+	if err != nil {
+		return "", 0, err
+	}
+	return job.Status, job.Version, nil
+}
+
+// UnfinishedJobs returns up to limit unfinished jobs last updated before
+// the given time, in ID order after afterID
+func (s *Storage) UnfinishedJobs(ctx context.Context, before time.Time, afterID string, limit int) ([]types.Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.fail("UnfinishedJobs"); err != nil {
+		return nil, err
+	}
+
+	var unfinished []types.Job
+	for _, job := range s.jobs {
+		if !job.Status.IsFinal() && job.UpdatedAt.Before(before) && job.ID > afterID {
+			unfinished = append(unfinished, *job)
+		}
+	}
+	sort.Slice(unfinished, func(i, j int) bool { return unfinished[i].ID < unfinished[j].ID })
+	return unfinished[:min(limit, len(unfinished))], nil
+}
+
+// ListJobs returns a page of the jobs matching the filters, newest first.
+// Fields are ignored: every field is returned.
+func (s *Storage) ListJobs(ctx context.Context, tenantID string, page, pageSize int, status, jobType, errorCode string, fields types.JobFields) ([]types.Job, int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.fail("ListJobs"); err != nil {
+		return nil, 0, err
+	}
+
+	var matched []types.Job
+	for _, job := range s.jobs {
+		switch {
+		case tenantID != "" && job.TenantID != tenantID,
+			status != "" && string(job.Status) != status,
+			jobType != "" && string(job.Type) != jobType,
+			errorCode != "" && string(job.ErrorCode) != errorCode:
+			continue
+		}
+		matched = append(matched, *job)
+	}
+	sort.Slice(matched, func(i, j int) bool { return matched[i].CreatedAt.After(matched[j].CreatedAt) })
+
+	start := min((page-1)*pageSize, len(matched))
+	end := min(start+pageSize, len(matched))
+	return matched[start:end], len(matched), nil
+}
+
+// StartAttempt and EndAttempt record nothing
+func (s *Storage) StartAttempt(ctx context.Context, job *types.Job) error {
+	return nil
+}
+
+func (s *Storage) EndAttempt(ctx context.Context, jobID string, outcome types.AttemptOutcome, errorMsg string) error {
+	return nil
+}
+
+func (s *Storage) SaveResult(ctx context.Context, result *storage.JobResult) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.fail("SaveResult"); err != nil {
+		return err
+	}
+	saved := *result
+	if saved.CreatedAt.IsZero() {
+		saved.CreatedAt = time.Now()
+	}
+	s.results[result.JobID] = &saved
+	return nil
+}
+
+func (s *Storage) GetResult(ctx context.Context, jobID string) (*storage.JobResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.fail("GetResult"); err != nil {
+		return nil, err
+	}
+	result, ok := s.results[jobID]
+	if !ok || (result.ExpiresAt != nil && !result.ExpiresAt.After(time.Now())) {
+		return nil, fmt.Errorf("%w: %s", storage.ErrResultNotFound, jobID)
+	}
+	found := *result
+	return &found, nil
+}
+
+func (s *Storage) RegisterWorker(ctx context.Context, worker *types.Worker) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.fail("RegisterWorker"); err != nil {
+		return err
+	}
+	registered := *worker
+	s.workers[worker.ID] = &registered
+	return nil
+}
+
+func (s *Storage) GetWorker(ctx context.Context, workerID string) (*types.Worker, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.fail("GetWorker"); err != nil {
+		return nil, err
+	}
+	worker, ok := s.workers[workerID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", storage.ErrWorkerNotFound, workerID)
+	}
+	found := *worker
+	return &found, nil
+}
+
+func (s *Storage) GetWorkers(ctx context.Context) ([]types.Worker, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.fail("GetWorkers"); err != nil {
+		return nil, err
+	}
+	workers := make([]types.Worker, 0, len(s.workers))
+	for _, worker := range s.workers {
+		workers = append(workers, *worker)
+	}
+	sort.Slice(workers, func(i, j int) bool { return workers[i].ID < workers[j].ID })
+	return workers, nil
+}
+
+func (s *Storage) RecordAudit(ctx context.Context, entry *types.AuditEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.fail("RecordAudit"); err != nil {
+		return err
+	}
+	s.audit = append(s.audit, *entry)
+	return nil
+}
+
+// fail returns the error set for the first of methods that has one. The
+// caller holds s.mu.
+func (s *Storage) fail(methods ...string) error {
+	for _, method := range methods {
+		if err := s.errs[method]; err != nil {
+			return err
+		}
+	}
+	return nil
+}
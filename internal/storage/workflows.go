@@ -0,0 +1,236 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"taskflow/internal/types"
+)
+
+// workflowColumns lists the columns read by scanWorkflow, in order
+const workflowColumns = `id, tenant_id, name, status, steps, created_at, updated_at, completed_at`
+
+// CreateWorkflow inserts a new workflow into the database
+func (p *PostgresStorage) CreateWorkflow(ctx context.Context, wf *types.Workflow) error {
+	steps, err := p.sealSteps(ctx, wf.Steps)
+	if err != nil {
+		return err
+	}
+
+	_, err = p.db.ExecContext(ctx, `
+		INSERT INTO workflows (`+workflowColumns+`)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	`, wf.ID, wf.Tenant(), nullString(wf.Name), wf.Status, steps,
+		wf.CreatedAt, wf.UpdatedAt, wf.CompletedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create workflow: %w", err)
+	}
+
+	return nil
+}
+
+// GetWorkflow retrieves a workflow by ID
+func (p *PostgresStorage) GetWorkflow(ctx context.Context, workflowID string) (*types.Workflow, error) {
+	query := `SELECT ` + workflowColumns + ` FROM workflows WHERE id = $1`
+
+	wf, err := p.scanWorkflow(ctx, p.db.QueryRowContext(ctx, query, workflowID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("%w: %s", ErrWorkflowNotFound, workflowID)
+		}
+		return nil, fmt.Errorf("failed to get workflow: %w", err)
+	}
+
+	return wf, nil
+}
+
+// UpdateWorkflow applies update to a workflow while holding its row lock,
+// so concurrent step completions advance it one at a time, and returns the
+// updated workflow
+func (p *PostgresStorage) UpdateWorkflow(ctx context.Context, workflowID string, update func(*types.Workflow) error) (*types.Workflow, error) {
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	query := `SELECT ` + workflowColumns + ` FROM workflows WHERE id = $1 FOR UPDATE`
+	wf, err := p.scanWorkflow(ctx, tx.QueryRowContext(ctx, query, workflowID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("%w: %s", ErrWorkflowNotFound, workflowID)
+		}
+		return nil, fmt.Errorf("failed to get workflow: %w", err)
+	}
+
+	if err := update(wf); err != nil {
+		return nil, err
+	}
+
+	steps, err := p.sealSteps(ctx, wf.Steps)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE workflows
+		SET status = $2, steps = $3, updated_at = $4, completed_at = $5
+		WHERE id = $1
+	`, wf.ID, wf.Status, steps, wf.UpdatedAt, wf.CompletedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update workflow: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit workflow: %w", err)
+	}
+
+	return wf, nil
+}
+
+// ListWorkflows retrieves workflows with pagination, newest first.
+// An empty tenantID lists workflows across all tenants.
+func (p *PostgresStorage) ListWorkflows(ctx context.Context, tenantID string, page, pageSize int, status string) ([]types.Workflow, int, error) {
+	var whereConditions []string
+	var args []interface{}
+	argIndex := 1
+
+	if tenantID != "" {
+		whereConditions = append(whereConditions, fmt.Sprintf("tenant_id = $%d", argIndex))
+		args = append(args, tenantID)
+		argIndex++
+	}
+
+	if status != "" {
+		whereConditions = append(whereConditions, fmt.Sprintf("status = $%d", argIndex))
+		args = append(args, status)
+		argIndex++
+	}
+
+	whereClause := ""
+	if len(whereConditions) > 0 {
+		whereClause = "WHERE " + strings.Join(whereConditions, " AND ")
+	}
+
+	var total int
+	db := p.reader(ctx)
+	err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM workflows "+whereClause, args...).Scan(&total)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to count workflows: %w", err)
+	}
+
+	dataQuery := fmt.Sprintf(`
+		SELECT %s
+		FROM workflows %s
+		ORDER BY created_at DESC
+		LIMIT $%d OFFSET $%d
+	`, workflowColumns, whereClause, argIndex, argIndex+1)
+
+	args = append(args, pageSize, (page-1)*pageSize)
+
+	rows, err := db.QueryContext(ctx, dataQuery, args...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to query workflows: %w", err)
+	}
+	defer rows.Close()
+
+	var workflows []types.Workflow
+	for rows.Next() {
+		wf, err := p.scanWorkflow(ctx, rows)
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to scan workflow: %w", err)
+		}
+		workflows = append(workflows, *wf)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("error iterating workflows: %w", err)
+	}
+
+	return workflows, total, nil
+}
+
+// scanWorkflow reads a workflow selected with workflowColumns, decrypting
+// its step payloads
+func (p *PostgresStorage) scanWorkflow(ctx context.Context, row rowScanner) (*types.Workflow, error) {
+	var wf types.Workflow
+	var name sql.NullString
+	var steps []byte
+	var completedAt sql.NullTime
+
+	err := row.Scan(&wf.ID, &wf.TenantID, &name, &wf.Status, &steps,
+		&wf.CreatedAt, &wf.UpdatedAt, &completedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if name.Valid {
+		wf.Name = name.String
+	}
+	if completedAt.Valid {
+		wf.CompletedAt = &completedAt.Time
+	}
+
+	if err := json.Unmarshal(steps, &wf.Steps); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal workflow steps: %w", err)
+	}
+	for i := range wf.Steps {
+		step := &wf.Steps[i]
+		if step.Payload, err = p.cipher.Open(ctx, step.Payload); err != nil {
+			return nil, fmt.Errorf("failed to decrypt step payload: %w", err)
+		}
+		for j := range step.FanOut {
+			if step.FanOut[j], err = p.cipher.Open(ctx, step.FanOut[j]); err != nil {
+				return nil, fmt.Errorf("failed to decrypt step payload: %w", err)
+			}
+		}
+		step.Compensate, err = step.Compensate.MapPayloads(func(value json.RawMessage) (json.RawMessage, error) {
+			return p.cipher.Open(ctx, value)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt step payload: %w", err)
+		}
+	}
+
+	return &wf, nil
+}
+
+// sealSteps encodes workflow steps for the steps column with their
+// payloads encrypted
+func (p *PostgresStorage) sealSteps(ctx context.Context, steps []types.WorkflowStep) ([]byte, error) {
+	sealed := make([]types.WorkflowStep, len(steps))
+	for i, step := range steps {
+		payload, err := p.cipher.Seal(ctx, step.Payload)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encrypt step payload: %w", err)
+		}
+		step.Payload = payload
+
+		fanOut := make([]json.RawMessage, len(step.FanOut))
+		for j, payload := range step.FanOut {
+			if fanOut[j], err = p.cipher.Seal(ctx, payload); err != nil {
+				return nil, fmt.Errorf("failed to encrypt step payload: %w", err)
+			}
+		}
+		if len(fanOut) > 0 {
+			step.FanOut = fanOut
+		}
+
+		step.Compensate, err = step.Compensate.MapPayloads(func(value json.RawMessage) (json.RawMessage, error) {
+			return p.cipher.Seal(ctx, value)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to encrypt step payload: %w", err)
+		}
+
+		sealed[i] = step
+	}
+
+	data, err := json.Marshal(sealed)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal workflow steps: %w", err)
+	}
+	return data, nil
+}
@@ -0,0 +1,145 @@
+package tenant
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"taskflow/internal/types"
+)
+
+// Tenant represents an isolated namespace of jobs with its own API keys and limits
+type Tenant struct {
+	ID                 string   `json:"id"`
+	Name               string   `json:"name,omitempty"`
+	APIKeys            []string `json:"api_keys"`
+	MaxPendingJobs     int      `json:"max_pending_jobs,omitempty"`      // 0 = unlimited
+	RateLimitPerMinute int      `json:"rate_limit_per_minute,omitempty"` // 0 = unlimited
+	SigningSecret      string   `json:"signing_secret,omitempty"`        // Requires HMAC-signed job submissions
+	ExportTables       []string `json:"export_tables,omitempty"`         // Tables and views data exports may read, "schema.*" for all of a schema
+}
+
+// Default is the tenant used when multi-tenancy is disabled
+var Default = &Tenant{ID: types.DefaultTenantID, Name: "Default"}
+
+// Registry resolves API keys to tenants
+type Registry struct {
+	tenants map[string]*Tenant
+	byKey   map[string]*Tenant
+}
+
+// NewRegistry builds a registry from a list of tenants
+func NewRegistry(tenants []*Tenant) (*Registry, error) {
+	r := &Registry{
+		tenants: make(map[string]*Tenant),
+		byKey:   make(map[string]*Tenant),
+	}
+
+	for _, t := range tenants {
+		if t.ID == "" {
+			return nil, fmt.Errorf("tenant id is required")
+		}
+		if _, exists := r.tenants[t.ID]; exists {
+			return nil, fmt.Errorf("duplicate tenant id: %s", t.ID)
+		}
+		r.tenants[t.ID] = t
+
+		for _, key := range t.APIKeys {
+			if other, exists := r.byKey[key]; exists {
+				return nil, fmt.Errorf("api key shared by tenants %s and %s", other.ID, t.ID)
+			}
+			r.byKey[key] = t
+		}
+	}
+
+	return r, nil
+}
+
+// LoadRegistry reads a JSON array of tenants from path.
+// An empty path returns a nil registry, which disables multi-tenancy.
+func LoadRegistry(path string) (*Registry, error) {
+	if path == "" {
+		return nil, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tenants file: %w", err)
+	}
+
+	var tenants []*Tenant
+	if err := json.Unmarshal(data, &tenants); err != nil {
+		return nil, fmt.Errorf("failed to parse tenants file: %w", err)
+	}
+
+	return NewRegistry(tenants)
+}
+
+// Enabled reports whether requests must be authenticated against tenants
+func (r *Registry) Enabled() bool {
+	return r != nil && len(r.tenants) > 0
+}
+
+// Lookup returns the tenant owning the given API key
+func (r *Registry) Lookup(apiKey string) (*Tenant, bool) {
+	if r == nil || apiKey == "" {
+		return nil, false
+	}
+	t, ok := r.byKey[apiKey]
+	return t, ok
+}
+
+// Get returns a tenant by ID
+func (r *Registry) Get(id string) (*Tenant, bool) {
+	if r == nil {
+		return nil, false
+	}
+	t, ok := r.tenants[id]
+	return t, ok
+}
+
+// ExportTables returns the tables each tenant's data exports may read, by
+// tenant ID. Tenants that list none may not export.
+func (r *Registry) ExportTables() map[string][]string {
+	if r == nil {
+		return nil
+	}
+	tables := make(map[string][]string, len(r.tenants))
+	for id, t := range r.tenants {
+		tables[id] = t.ExportTables
+	}
+	return tables
+}
+
+// CheckExport checks that a data export payload reads only tables in the
+// tenant's ExportTables. The default tenant, used when multi-tenancy is
+// disabled, may export any table.
+func (t *Tenant) CheckExport(payload json.RawMessage) error {
+	if t == Default {
+		return nil
+	}
+	var export types.DataExportPayload
+	if err := json.Unmarshal(payload, &export); err != nil {
+		return fmt.Errorf("invalid data export payload: %w", err)
+	}
+	query, err := types.ParseExportQuery(export.Query, export.Params)
+	if err != nil {
+		return err
+	}
+	return query.AllowTables(t.ExportTables)
+}
+
+type contextKey struct{}
+
+// WithTenant returns a copy of ctx carrying the tenant
+func WithTenant(ctx context.Context, t *Tenant) context.Context {
+	return context.WithValue(ctx, contextKey{}, t)
+}
+
+// FromContext returns the tenant stored in ctx, or the default tenant
+func FromContext(ctx context.Context) *Tenant {
+	if t, ok := ctx.Value(contextKey{}).(*Tenant); ok && t != nil {
+		return t
+	}
+	return Default
+}
@@ -0,0 +1,96 @@
+package tenant
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"taskflow/internal/types"
+	"testing"
+)
+
+func TestRegistryLookup(t *testing.T) {
+	registry, err := NewRegistry([]*Tenant{
+		{ID: "acme", APIKeys: []string{"acme-key-1", "acme-key-2"}},
+		{ID: "globex", APIKeys: []string{"globex-key"}},
+	})
+	if err != nil {
+		t.Fatalf("Expected no error building registry, got %v", err)
+	}
+
+	if !registry.Enabled() {
+		t.Error("Expected registry with tenants to be enabled")
+	}
+
+	tenant, ok := registry.Lookup("acme-key-2")
+	if !ok || tenant.ID != "acme" {
+		t.Errorf("Expected acme-key-2 to resolve to acme, got %v", tenant)
+	}
+
+	if _, ok := registry.Lookup("unknown"); ok {
+		t.Error("Expected unknown key to not resolve")
+	}
+}
+
+func TestRegistryRejectsSharedKeys(t *testing.T) {
+	_, err := NewRegistry([]*Tenant{
+		{ID: "acme", APIKeys: []string{"shared"}},
+		{ID: "globex", APIKeys: []string{"shared"}},
+	})
+	if err == nil {
+		t.Error("Expected error when two tenants share an API key")
+	}
+}
+
+func TestLoadRegistry(t *testing.T) {
+	registry, err := LoadRegistry("")
+	if err != nil || registry.Enabled() {
+		t.Errorf("Expected empty path to disable multi-tenancy, got %v, %v", registry, err)
+	}
+
+	path := filepath.Join(t.TempDir(), "tenants.json")
+	data := `[{"id": "acme", "api_keys": ["k1"], "max_pending_jobs": 10}]`
+	if err := os.WriteFile(path, []byte(data), 0600); err != nil {
+		t.Fatalf("Failed to write tenants file: %v", err)
+	}
+
+	registry, err = LoadRegistry(path)
+	if err != nil {
+		t.Fatalf("Expected no error loading registry, got %v", err)
+	}
+
+	tenant, ok := registry.Get("acme")
+	if !ok || tenant.MaxPendingJobs != 10 {
+		t.Errorf("Expected acme tenant with max_pending_jobs 10, got %v", tenant)
+	}
+}
+
+func TestFromContextDefault(t *testing.T) {
+	if got := FromContext(context.Background()); got.ID != types.DefaultTenantID {
+		t.Errorf("Expected default tenant, got %s", got.ID)
+	}
+
+	ctx := WithTenant(context.Background(), &Tenant{ID: "acme"})
+	if got := FromContext(ctx); got.ID != "acme" {
+		t.Errorf("Expected acme tenant, got %s", got.ID)
+	}
+}
+
+func TestCheckExport(t *testing.T) {
+	acme := &Tenant{ID: "acme", ExportTables: []string{"orders", "reporting.*"}}
+	payload := func(query string) []byte {
+		return []byte(`{"export_type": "csv", "query": "` + query + `", "params": ["eu"]}`)
+	}
+
+	if err := acme.CheckExport(payload("SELECT * FROM orders JOIN reporting.regions r ON r.id = region_id WHERE r.code = $1")); err != nil {
+		t.Errorf("Expected acme to export its tables, got %v", err)
+	}
+	if err := acme.CheckExport(payload("SELECT * FROM users WHERE region = $1")); err == nil {
+		t.Error("Expected acme to be denied the users table")
+	}
+	if err := (&Tenant{ID: "globex"}).CheckExport(payload("SELECT * FROM orders WHERE region = $1")); err == nil {
+		t.Error("Expected a tenant without export tables to be denied")
+	}
+	if err := Default.CheckExport(payload("SELECT * FROM users WHERE region = $1")); err != nil {
+		t.Errorf("Expected the default tenant to export any table, got %v", err)
+	}
+}
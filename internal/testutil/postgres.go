@@ -0,0 +1,73 @@
+package testutil
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"testing"
+
+	"github.com/lib/pq"
+)
+
+const postgresImage = "postgres:15-alpine"
+
+var postgresServer server
+
+// Postgres creates an empty database on the test PostgreSQL server and
+// returns its URL. The database is dropped when t finishes.
+func Postgres(t testing.TB) string {
+	t.Helper()
+	serverURL := postgresServer.get(t, DatabaseURLEnv, startPostgres)
+
+	admin, err := sql.Open("postgres", serverURL)
+	if err != nil {
+		t.Fatalf("failed to open test PostgreSQL: %v", err)
+	}
+	defer admin.Close()
+
+	suffix := make([]byte, 6)
+	rand.Read(suffix)
+	name := "taskflow_test_" + hex.EncodeToString(suffix)
+	if _, err := admin.Exec("CREATE DATABASE " + pq.QuoteIdentifier(name)); err != nil {
+		t.Fatalf("failed to create test database: %v", err)
+	}
+	t.Cleanup(func() {
+		admin, err := sql.Open("postgres", serverURL)
+		if err != nil {
+			return
+		}
+		defer admin.Close()
+		if _, err := admin.Exec("DROP DATABASE IF EXISTS " + pq.QuoteIdentifier(name) + " WITH (FORCE)"); err != nil {
+			t.Logf("failed to drop test database %s: %v", name, err)
+		}
+	})
+
+	u, err := url.Parse(serverURL)
+	if err != nil {
+		t.Fatalf("invalid %s: %v", DatabaseURLEnv, err)
+	}
+	u.Path = "/" + name
+	return u.String()
+}
+
+func startPostgres() (string, string, error) {
+	env := []string{"POSTGRES_PASSWORD=taskflow"}
+	id, addr, err := startContainer(postgresImage, 5432, env, "-c", "fsync=off")
+	if err != nil {
+		return "", "", err
+	}
+	serverURL := fmt.Sprintf("postgres://postgres:taskflow@%s/postgres?sslmode=disable", addr)
+
+	db, err := sql.Open("postgres", serverURL)
+	if err != nil {
+		return "", id, err
+	}
+	defer db.Close()
+	err = waitReady(func(ctx context.Context) error {
+		return db.PingContext(ctx)
+	})
+	return serverURL, id, err
+}
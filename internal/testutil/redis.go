@@ -0,0 +1,40 @@
+package testutil
+
+import (
+	"context"
+	"testing"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const redisImage = "redis:7-alpine"
+
+var redisServer server
+
+// Redis returns a client of the test Redis server, with its database
+// flushed. The client is closed when t finishes.
+func Redis(t testing.TB) *redis.Client {
+	t.Helper()
+	addr := redisServer.get(t, RedisAddrEnv, startRedis)
+
+	client := redis.NewClient(&redis.Options{Addr: addr})
+	t.Cleanup(func() { client.Close() })
+	if err := client.FlushDB(context.Background()).Err(); err != nil {
+		t.Fatalf("failed to flush test Redis: %v", err)
+	}
+	return client
+}
+
+func startRedis() (string, string, error) {
+	id, addr, err := startContainer(redisImage, 6379, nil)
+	if err != nil {
+		return "", "", err
+	}
+
+	client := redis.NewClient(&redis.Options{Addr: addr})
+	defer client.Close()
+	err = waitReady(func(ctx context.Context) error {
+		return client.Ping(ctx).Err()
+	})
+	return addr, id, err
+}
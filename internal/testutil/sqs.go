@@ -0,0 +1,40 @@
+package testutil
+
+import (
+	"context"
+	"net/http"
+	"testing"
+)
+
+const sqsImage = "softwaremill/elasticmq-native"
+
+var sqsServer server
+
+// SQS returns the endpoint URL of the test SQS server, an ElasticMQ
+// container. It accepts any credentials. Queues aren't removed between
+// tests, so tests should name theirs uniquely.
+func SQS(t testing.TB) string {
+	t.Helper()
+	return sqsServer.get(t, SQSEndpointEnv, startSQS)
+}
+
+func startSQS() (string, string, error) {
+	id, addr, err := startContainer(sqsImage, 9324, nil)
+	if err != nil {
+		return "", "", err
+	}
+
+	endpoint := "http://" + addr
+	err = waitReady(func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint+"/?Action=ListQueues", nil)
+		if err != nil {
+			return err
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return err
+		}
+		return resp.Body.Close()
+	})
+	return endpoint, id, err
+}
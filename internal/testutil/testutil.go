@@ -0,0 +1,158 @@
+// Package testutil provides the Redis, PostgreSQL and SQS servers that
+// integration tests run against, so that they run the same on a laptop and
+// in CI without a server already listening on localhost.
+//
+// Each server is started once per test binary, as a throwaway Docker
+// container, and removed by Run when the package's tests finish. Setting
+// TASKFLOW_TEST_REDIS_ADDR, TASKFLOW_TEST_DATABASE_URL or
+// TASKFLOW_TEST_SQS_ENDPOINT uses an existing server instead, such as a CI
+// service container. Tests that need a server
+// are skipped when neither Docker nor the variable is available, and in
+// -short mode.
+//
+// Packages that use it run their tests through Run:
+//
+//	func TestMain(m *testing.M) {
+//		os.Exit(testutil.Run(m))
+//	}
+package testutil
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const (
+	// RedisAddrEnv names a Redis server to use instead of a container. Its
+	// first database is flushed before every test.
+	RedisAddrEnv = "TASKFLOW_TEST_REDIS_ADDR"
+
+	// DatabaseURLEnv names a PostgreSQL server to use instead of a
+	// container. Tests get their own database on it, dropped afterwards;
+	// the URL's user must be allowed to create databases.
+	DatabaseURLEnv = "TASKFLOW_TEST_DATABASE_URL"
+
+	// SQSEndpointEnv names an SQS-compatible endpoint, such as ElasticMQ or
+	// LocalStack, to use instead of a container
+	SQSEndpointEnv = "TASKFLOW_TEST_SQS_ENDPOINT"
+
+	// startTimeout bounds how long a container may take to accept
+	// connections
+	startTimeout = time.Minute
+)
+
+// server is a Redis, PostgreSQL or SQS server shared by a package's tests
+type server struct {
+	once      sync.Once
+	addr      string // host:port or URL
+	container string // ID of the container started for it, if any
+	skip      string // why tests that need it are skipped
+	err       error
+}
+
+// get starts the server on first use with start, and returns its address.
+// It skips or fails t if the server can't be had.
+func (s *server) get(t testing.TB, env string, start func() (addr, container string, err error)) string {
+	t.Helper()
+	if testing.Short() {
+		t.Skip("integration test skipped in -short mode")
+	}
+
+	s.once.Do(func() {
+		if addr := os.Getenv(env); addr != "" {
+			s.addr = addr
+			return
+		}
+		if _, err := exec.LookPath("docker"); err != nil {
+			s.skip = fmt.Sprintf("integration test needs Docker or %s", env)
+			return
+		}
+		s.addr, s.container, s.err = start()
+	})
+
+	switch {
+	case s.skip != "":
+		t.Skip(s.skip)
+	case s.err != nil:
+		t.Fatal(s.err)
+	}
+	return s.addr
+}
+
+// stop removes the server's container, if one was started
+func (s *server) stop() {
+	if s.container != "" {
+		exec.Command("docker", "rm", "-f", "-v", s.container).Run()
+	}
+}
+
+// Run runs a package's tests and removes the containers they started. Call
+// it from TestMain.
+func Run(m *testing.M) int {
+	code := m.Run()
+	redisServer.stop()
+	postgresServer.stop()
+	sqsServer.stop()
+	return code
+}
+
+// startContainer runs image in the background with port published on a
+// free local port, and returns the container's ID and that port's address
+func startContainer(image string, port int, env []string, args ...string) (string, string, error) {
+	run := []string{"run", "-d", "--rm", "-p", fmt.Sprintf("127.0.0.1::%d", port)}
+	for _, e := range env {
+		run = append(run, "-e", e)
+	}
+	run = append(append(run, image), args...)
+
+	id, err := docker(run...)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to start %s: %w", image, err)
+	}
+	addr, err := docker("port", id, fmt.Sprintf("%d/tcp", port))
+	if err != nil {
+		exec.Command("docker", "rm", "-f", "-v", id).Run()
+		return "", "", fmt.Errorf("failed to find the port of %s: %w", image, err)
+	}
+	// Docker may list an IPv6 address too
+	addr, _, _ = strings.Cut(addr, "\n")
+	return id, addr, nil
+}
+
+// docker runs a docker command and returns its trimmed output
+func docker(args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("docker", args...)
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("docker %s: %w: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+// waitReady calls ready until it succeeds or startTimeout passes, while a
+// container starts up
+func waitReady(ready func(ctx context.Context) error) error {
+	ctx, cancel := context.WithTimeout(context.Background(), startTimeout)
+	defer cancel()
+	for {
+		attemptCtx, attemptCancel := context.WithTimeout(ctx, time.Second)
+		err := ready(attemptCtx)
+		attemptCancel()
+		if err == nil {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("not ready after %v: %w", startTimeout, err)
+		case <-time.After(200 * time.Millisecond):
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package types
+
+import "time"
+
+// AttemptOutcome is how an attempt at running a job ended
+type AttemptOutcome string
+
+const (
+	AttemptSucceeded   AttemptOutcome = "succeeded"
+	AttemptFailed      AttemptOutcome = "failed"
+	AttemptInterrupted AttemptOutcome = "interrupted" // Handed back unfinished, e.g. on shutdown
+	AttemptCancelled   AttemptOutcome = "cancelled"
+	AttemptAbandoned   AttemptOutcome = "abandoned" // Its worker disappeared and the job was claimed again
+	AttemptParked      AttemptOutcome = "parked"    // Put off unrun because its downstream target was down
+)
+
+// JobAttempt is one run of a job by a worker. Attempts are numbered from
+// 1; a run that was interrupted doesn't count, so the next run has the same
+// number.
+type JobAttempt struct {
+	Attempt    int            `json:"attempt"`
+	WorkerID   string         `json:"worker_id,omitempty"`
+	StartedAt  time.Time      `json:"started_at"`
+	EndedAt    *time.Time     `json:"ended_at,omitempty"`
+	Outcome    AttemptOutcome `json:"outcome,omitempty"` // Empty while running
+	Error      string         `json:"error,omitempty"`
+	DurationMs int64          `json:"duration_ms,omitempty"`
+}
+
+// JobAttemptsResponse is the response body of GET /api/v1/jobs/{id}/attempts
+type JobAttemptsResponse struct {
+	JobID    string       `json:"job_id"`
+	Attempts []JobAttempt `json:"attempts"`
+}
@@ -0,0 +1,53 @@
+package types
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// AuditAction names an administrative action recorded in the audit log
+type AuditAction string
+
+const (
+	AuditJobCancel      AuditAction = "job.cancel"
+	AuditWorkerPause    AuditAction = "worker.pause"
+	AuditWorkerResume   AuditAction = "worker.resume"
+	AuditWorkerShutdown AuditAction = "worker.shutdown"
+	AuditSchemaUpdate   AuditAction = "schema.update"
+	AuditTemplateUpdate AuditAction = "template.update"
+	AuditTemplateDelete AuditAction = "template.delete"
+	AuditConfigChange   AuditAction = "config.change"
+)
+
+// AuditEntry records who did what to which object, and the object's state
+// before and after
+type AuditEntry struct {
+	ID        int64           `json:"id"`
+	Action    AuditAction     `json:"action"`
+	Actor     string          `json:"actor"`
+	TenantID  string          `json:"tenant_id,omitempty"`
+	Target    string          `json:"target"`
+	Before    json.RawMessage `json:"before,omitempty"`
+	After     json.RawMessage `json:"after,omitempty"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// AuditFilter selects audit entries, newest first. Zero fields match all
+// entries.
+type AuditFilter struct {
+	Action   AuditAction
+	Actor    string
+	TenantID string
+	Target   string
+	Since    time.Time
+	Until    time.Time
+	BeforeID int64 // only entries older than this one, for paging
+	Limit    int
+}
+
+// AuditLogResponse is the body of GET /api/v1/audit
+type AuditLogResponse struct {
+	Entries []AuditEntry `json:"entries"`
+	// NextBefore pages to older entries as ?before=, if there may be more
+	NextBefore int64 `json:"next_before,omitempty"`
+}
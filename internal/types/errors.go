@@ -0,0 +1,113 @@
+package types
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrorCode groups job failures by cause, so that dashboards and filters
+// don't depend on error messages
+type ErrorCode string
+
+const (
+	ErrorCodeTimeout       ErrorCode = "TIMEOUT"        // the attempt ran past its timeout
+	ErrorCodeValidation    ErrorCode = "VALIDATION"     // the payload can't be processed as given
+	ErrorCodeDownstream5xx ErrorCode = "DOWNSTREAM_5XX" // a service the job calls answered with a 5xx
+	ErrorCodeRateLimited   ErrorCode = "RATE_LIMITED"   // a service the job calls throttled it
+	ErrorCodeCancelled     ErrorCode = "CANCELLED"      // the attempt was cancelled before it finished
+	ErrorCodePanic         ErrorCode = "PANIC"          // the processor panicked
+	ErrorCodeUnknown       ErrorCode = "UNKNOWN"        // none of the above
+)
+
+// ErrorCodes lists every error code
+var ErrorCodes = []ErrorCode{
+	ErrorCodeTimeout, ErrorCodeValidation, ErrorCodeDownstream5xx,
+	ErrorCodeRateLimited, ErrorCodeCancelled, ErrorCodePanic, ErrorCodeUnknown,
+}
+
+// IsValid reports whether c is one of ErrorCodes
+func (c ErrorCode) IsValid() bool {
+	for _, code := range ErrorCodes {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+// CodedError gives a failure its error code. It says nothing about
+// whether the job is retried; wrap it with Permanent or Retryable for that.
+type CodedError struct {
+	Code ErrorCode
+	Err  error
+}
+
+func (e *CodedError) Error() string { return e.Err.Error() }
+func (e *CodedError) Unwrap() error { return e.Err }
+
+// WithErrorCode gives err the error code code. It returns nil for nil.
+func WithErrorCode(code ErrorCode, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &CodedError{Code: code, Err: err}
+}
+
+// ErrorCodeOf returns the error code of a failure: that of the first
+// CodedError in its chain, else TIMEOUT for an exceeded deadline and
+// CANCELLED for a cancelled context, else UNKNOWN
+func ErrorCodeOf(err error) ErrorCode {
+	var coded *CodedError
+	switch {
+	case errors.As(err, &coded):
+		return coded.Code
+	case errors.Is(err, context.DeadlineExceeded):
+		return ErrorCodeTimeout
+	case errors.Is(err, context.Canceled):
+		return ErrorCodeCancelled
+	}
+	return ErrorCodeUnknown
+}
+
+// PermanentError is returned by processors for a failure that another
+// attempt can't fix, such as a payload the receiver rejects. The job fails
+// for good, even if it has attempts left.
+type PermanentError struct {
+	Err error
+}
+
+func (e *PermanentError) Error() string { return e.Err.Error() }
+func (e *PermanentError) Unwrap() error { return e.Err }
+
+// RetryableError is returned by processors for a failure that another
+// attempt may get past, such as a timeout or a throttled request. The job
+// is retried while it has attempts left, waiting at least RetryAfter.
+type RetryableError struct {
+	Err error
+
+	// RetryAfter is the least time to wait before the next attempt, as
+	// asked by a Retry-After header. Zero leaves the wait to the job
+	// type's retry policy.
+	RetryAfter time.Duration
+}
+
+func (e *RetryableError) Error() string { return e.Err.Error() }
+func (e *RetryableError) Unwrap() error { return e.Err }
+
+// Permanent marks err as a permanent failure. It returns nil for nil.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &PermanentError{Err: err}
+}
+
+// Retryable marks err as a retryable failure, to be retried no sooner
+// than retryAfter. It returns nil for nil.
+func Retryable(err error, retryAfter time.Duration) error {
+	if err == nil {
+		return nil
+	}
+	return &RetryableError{Err: err, RetryAfter: retryAfter}
+}
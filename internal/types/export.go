@@ -0,0 +1,332 @@
+package types
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ExportSpec is what a data export keeps of its rows and how: the columns
+// and their formatting, from the payload's "format", and the conditions
+// rows must meet, from its "filters"
+type ExportSpec struct {
+	Columns []ExportColumn // empty keeps every column, sorted by name
+	Filters []ExportFilter
+}
+
+// ExportColumn is a column of an export
+type ExportColumn struct {
+	Field string // column of the source rows
+	Name  string // header in the export, Field by default
+
+	DateFormat string // Go layout dates are written in, empty as they are
+	Decimals   *int   // places numbers are rounded to, nil as they are
+}
+
+// ExportFilter keeps rows whose Field compares to Value with Op
+type ExportFilter struct {
+	Field string
+	Op    string // "eq", "ne", "gt", "gte", "lt", "lte", "in" or "contains"
+	Value interface{}
+}
+
+// exportColumnJSON is a column of "format": {"columns": [...]}, which may
+// also be given as just its field
+type exportColumnJSON struct {
+	Field      string `json:"field"`
+	As         string `json:"as"`
+	DateFormat string `json:"date_format"`
+	Decimals   *int   `json:"decimals"`
+}
+
+// maxExportDecimals bounds the decimals of a column
+const maxExportDecimals = 10
+
+// dateTokens turn date formats such as "DD/MM/YYYY HH:mm" into Go layouts
+var dateTokens = strings.NewReplacer("YYYY", "2006", "MM", "01", "DD", "02", "HH", "15", "mm", "04", "ss", "05")
+
+// ParseExportSpec reads and checks the columns and filters of an export.
+// Submissions are checked with it, so workers only fail on payloads
+// stored before it.
+func ParseExportSpec(payload DataExportPayload) (*ExportSpec, error) {
+	spec := &ExportSpec{}
+
+	if raw, ok := payload.Format["columns"]; ok {
+		list, ok := raw.([]interface{})
+		if !ok || len(list) == 0 {
+			return nil, fmt.Errorf("format.columns must be a non-empty array")
+		}
+		names := make(map[string]bool, len(list))
+		for i, item := range list {
+			column, err := parseExportColumn(item)
+			if err != nil {
+				return nil, fmt.Errorf("format.columns[%d]: %w", i, err)
+			}
+			if names[column.Name] {
+				return nil, fmt.Errorf("format.columns[%d]: duplicate column %q", i, column.Name)
+			}
+			names[column.Name] = true
+			spec.Columns = append(spec.Columns, column)
+		}
+	}
+
+	fields := make([]string, 0, len(payload.Filters))
+	for field := range payload.Filters {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	for _, field := range fields {
+		filters, err := parseExportFilters(field, payload.Filters[field])
+		if err != nil {
+			return nil, fmt.Errorf("filters.%s: %w", field, err)
+		}
+		spec.Filters = append(spec.Filters, filters...)
+	}
+
+	return spec, nil
+}
+
+func parseExportColumn(item interface{}) (ExportColumn, error) {
+	var c exportColumnJSON
+	switch v := item.(type) {
+	case string:
+		c.Field = v
+	case map[string]interface{}:
+		data, _ := json.Marshal(v)
+		dec := json.NewDecoder(strings.NewReader(string(data)))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&c); err != nil {
+			return ExportColumn{}, fmt.Errorf("invalid column: %w", err)
+		}
+	default:
+		return ExportColumn{}, fmt.Errorf("column must be a field name or an object")
+	}
+
+	if c.Field == "" {
+		return ExportColumn{}, fmt.Errorf("field is required")
+	}
+	column := ExportColumn{Field: c.Field, Name: c.Field, Decimals: c.Decimals}
+	if c.As != "" {
+		column.Name = c.As
+	}
+	if c.DateFormat != "" {
+		column.DateFormat = dateTokens.Replace(c.DateFormat)
+		if column.DateFormat == c.DateFormat {
+			return ExportColumn{}, fmt.Errorf("date_format %q has none of YYYY, MM, DD, HH, mm and ss", c.DateFormat)
+		}
+	}
+	if c.Decimals != nil && (*c.Decimals < 0 || *c.Decimals > maxExportDecimals) {
+		return ExportColumn{}, fmt.Errorf("decimals must be from 0 to %d", maxExportDecimals)
+	}
+	return column, nil
+}
+
+// parseExportFilters reads the conditions on a field: a value to equal, or
+// an object of operators and their operands, as in {"gte": 10, "lt": 20}
+func parseExportFilters(field string, raw interface{}) ([]ExportFilter, error) {
+	ops, ok := raw.(map[string]interface{})
+	if !ok {
+		if !isExportScalar(raw) {
+			return nil, fmt.Errorf("must be a value or an object of operators")
+		}
+		return []ExportFilter{{Field: field, Op: "eq", Value: raw}}, nil
+	}
+	if len(ops) == 0 {
+		return nil, fmt.Errorf("has no operators")
+	}
+
+	names := make([]string, 0, len(ops))
+	for op := range ops {
+		names = append(names, op)
+	}
+	sort.Strings(names)
+
+	filters := make([]ExportFilter, 0, len(ops))
+	for _, op := range names {
+		value := ops[op]
+		switch op {
+		case "eq", "ne":
+			if !isExportScalar(value) {
+				return nil, fmt.Errorf("%s needs a string, number, boolean or null", op)
+			}
+		case "gt", "gte", "lt", "lte":
+			if _, isNumber := value.(float64); !isNumber {
+				if _, isString := value.(string); !isString {
+					return nil, fmt.Errorf("%s needs a number or string", op)
+				}
+			}
+		case "in":
+			list, ok := value.([]interface{})
+			if !ok || len(list) == 0 {
+				return nil, fmt.Errorf("in needs a non-empty array")
+			}
+			for _, item := range list {
+				if !isExportScalar(item) {
+					return nil, fmt.Errorf("in needs an array of strings, numbers, booleans or nulls")
+				}
+			}
+		case "contains":
+			if _, ok := value.(string); !ok {
+				return nil, fmt.Errorf("contains needs a string")
+			}
+		default:
+			return nil, fmt.Errorf("unknown operator %q", op)
+		}
+		filters = append(filters, ExportFilter{Field: field, Op: op, Value: value})
+	}
+	return filters, nil
+}
+
+func isExportScalar(v interface{}) bool {
+	switch v.(type) {
+	case nil, string, float64, bool:
+		return true
+	}
+	return false
+}
+
+// Match reports whether row meets every filter. Rows without a filtered
+// column don't.
+func (s *ExportSpec) Match(row map[string]interface{}) bool {
+	for _, f := range s.Filters {
+		value, ok := row[f.Field]
+		if !ok || !f.match(value) {
+			return false
+		}
+	}
+	return true
+}
+
+func (f ExportFilter) match(value interface{}) bool {
+	switch f.Op {
+	case "eq":
+		return exportEqual(value, f.Value)
+	case "ne":
+		return !exportEqual(value, f.Value)
+	case "in":
+		for _, item := range f.Value.([]interface{}) {
+			if exportEqual(value, item) {
+				return true
+			}
+		}
+		return false
+	case "contains":
+		s, ok := value.(string)
+		return ok && strings.Contains(s, f.Value.(string))
+	}
+
+	cmp, ok := exportCompare(value, f.Value)
+	if !ok {
+		return false
+	}
+	switch f.Op {
+	case "gt":
+		return cmp > 0
+	case "gte":
+		return cmp >= 0
+	case "lt":
+		return cmp < 0
+	case "lte":
+		return cmp <= 0
+	}
+	return false
+}
+
+// exportNumber returns v as a float64 if it is a number
+func exportNumber(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case float64:
+		return n, true
+	}
+	return 0, false
+}
+
+func exportEqual(a, b interface{}) bool {
+	if x, ok := exportNumber(a); ok {
+		y, ok := exportNumber(b)
+		return ok && x == y
+	}
+	return a == b
+}
+
+// exportCompare compares numbers as numbers and strings, such as ISO
+// dates, as strings. It reports false for anything else.
+func exportCompare(a, b interface{}) (int, bool) {
+	if x, ok := exportNumber(a); ok {
+		y, ok := exportNumber(b)
+		if !ok {
+			return 0, false
+		}
+		switch {
+		case x < y:
+			return -1, true
+		case x > y:
+			return 1, true
+		}
+		return 0, true
+	}
+	x, xok := a.(string)
+	y, yok := b.(string)
+	if !xok || !yok {
+		return 0, false
+	}
+	return strings.Compare(x, y), true
+}
+
+// ColumnsFor returns the export's columns, or every column of row, the
+// first exported, sorted by name
+func (s *ExportSpec) ColumnsFor(row map[string]interface{}) []ExportColumn {
+	if len(s.Columns) > 0 {
+		return s.Columns
+	}
+	fields := make([]string, 0, len(row))
+	for field := range row {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	columns := make([]ExportColumn, len(fields))
+	for i, field := range fields {
+		columns[i] = ExportColumn{Field: field, Name: field}
+	}
+	return columns
+}
+
+// Value returns the column's formatted value in row, nil if row lacks it
+func (c ExportColumn) Value(row map[string]interface{}) interface{} {
+	value := row[c.Field]
+	if c.DateFormat != "" {
+		if t, ok := exportTime(value); ok {
+			return t.Format(c.DateFormat)
+		}
+	}
+	if c.Decimals != nil {
+		if n, ok := exportNumber(value); ok {
+			scale := math.Pow(10, float64(*c.Decimals))
+			return math.Round(n*scale) / scale
+		}
+	}
+	return value
+}
+
+// exportTime returns v as a time if it is one, or an RFC 3339 or
+// YYYY-MM-DD string
+func exportTime(v interface{}) (time.Time, bool) {
+	switch t := v.(type) {
+	case time.Time:
+		return t, true
+	case string:
+		for _, layout := range []string{time.RFC3339Nano, "2006-01-02"} {
+			if parsed, err := time.Parse(layout, t); err == nil {
+				return parsed, true
+			}
+		}
+	}
+	return time.Time{}, false
+}
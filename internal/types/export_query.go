@@ -0,0 +1,458 @@
+package types
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// MaxExportParams bounds the params of an export query
+const MaxExportParams = 100
+
+// ExportQuery is the checked SQL of a data export. Values are passed as
+// Params, bound to the $1, $2, ... placeholders of SQL, never spliced into
+// it.
+type ExportQuery struct {
+	SQL    string
+	Params []interface{}
+	Tables []string // tables and views read, lowercased, as in "public.orders"
+}
+
+// exportQueryWords can't appear in an export query outside strings and
+// quoted identifiers. A single SELECT can only write with them, as in
+// "WITH d AS (DELETE ...)" or "SELECT ... INTO", or lock rows, as in
+// "FOR UPDATE".
+var exportQueryWords = map[string]bool{
+	"insert": true, "update": true, "delete": true, "merge": true, "into": true,
+}
+
+// exportQueryKeywords precede a parenthesis without calling a function,
+// as in "IN (SELECT ...)" or "name AS (SELECT ...)"
+var exportQueryKeywords = map[string]bool{
+	"select": true, "from": true, "join": true, "lateral": true, "where": true,
+	"in": true, "exists": true, "any": true, "all": true, "some": true,
+	"as": true, "materialized": true, "on": true, "and": true, "or": true,
+	"not": true, "union": true, "intersect": true, "except": true, "with": true,
+	"having": true, "by": true, "values": true, "then": true, "else": true,
+	"when": true, "using": true,
+}
+
+// exportQueryFunctions are the functions an export query may call. Any
+// other call is rejected, so that a query can't reach data outside its
+// tables through functions such as query_to_xml, table_to_xml, lo_import
+// or set_config, which run SQL or read tables named in strings. Type names
+// take modifiers, as in numeric(10, 2), and OVER, FILTER and WITHIN GROUP
+// take parentheses, so they are listed too.
+var exportQueryFunctions = setOf(
+	// Aggregates and window functions
+	"count", "sum", "avg", "min", "max", "array_agg", "string_agg", "bool_and", "bool_or", "every",
+	"stddev", "stddev_pop", "stddev_samp", "variance", "var_pop", "var_samp",
+	"percentile_cont", "percentile_disc", "mode", "json_agg", "jsonb_agg", "json_object_agg", "jsonb_object_agg",
+	"row_number", "rank", "dense_rank", "percent_rank", "cume_dist", "ntile",
+	"lag", "lead", "first_value", "last_value", "nth_value", "over", "filter", "group",
+
+	// Conditionals and casts
+	"coalesce", "nullif", "greatest", "least", "cast", "row", "array",
+
+	// Numbers
+	"abs", "ceil", "ceiling", "floor", "round", "trunc", "mod", "div", "power", "sqrt", "sign", "exp", "ln", "log",
+	"width_bucket",
+
+	// Strings
+	"length", "char_length", "character_length", "octet_length", "lower", "upper", "initcap",
+	"trim", "btrim", "ltrim", "rtrim", "lpad", "rpad", "substring", "substr", "position", "strpos",
+	"replace", "concat", "concat_ws", "left", "right", "split_part", "reverse", "repeat", "overlay",
+	"starts_with", "md5", "regexp_replace", "regexp_match", "regexp_split_to_array",
+	"to_char", "to_number", "to_date", "to_timestamp",
+
+	// Dates and times
+	"now", "date_trunc", "date_part", "date_bin", "extract", "age", "make_date", "make_timestamp",
+	"make_interval", "justify_days", "justify_hours", "timezone",
+
+	// JSON and arrays
+	"json_build_object", "jsonb_build_object", "json_build_array", "jsonb_build_array", "to_json", "to_jsonb",
+	"json_extract_path_text", "jsonb_extract_path_text", "json_array_length", "jsonb_array_length",
+	"jsonb_typeof", "array_length", "array_position", "array_to_string", "cardinality", "unnest",
+
+	// Types with modifiers
+	"numeric", "decimal", "varchar", "char", "character", "timestamp", "timestamptz", "time", "timetz",
+	"interval", "bit", "varbit",
+)
+
+func setOf(words ...string) map[string]bool {
+	set := make(map[string]bool, len(words))
+	for _, word := range words {
+		set[word] = true
+	}
+	return set
+}
+
+// sqlToken is a token of an export query
+type sqlToken struct {
+	kind  byte   // 'w' word, 'q' quoted identifier, 's' string, 'p' placeholder, or the punctuation itself
+	value string // lowercased words, unquoted identifiers
+}
+
+// ParseExportQuery checks that query is a single SELECT, or WITH ...
+// SELECT, whose placeholders are all bound by params, and lists the tables
+// it reads. Comments, dollar-quoted strings, writes and row locks are
+// rejected, as are calls to functions other than exportQueryFunctions and
+// to schema-qualified functions.
+func ParseExportQuery(query string, params []interface{}) (*ExportQuery, error) {
+	tokens, err := tokenizeSQL(query)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("query is empty")
+	}
+	if first := tokens[0]; first.kind != 'w' || (first.value != "select" && first.value != "with") {
+		return nil, fmt.Errorf("query must be a SELECT")
+	}
+
+	if len(params) > MaxExportParams {
+		return nil, fmt.Errorf("query has more than %d params", MaxExportParams)
+	}
+	for i, param := range params {
+		if !isExportScalar(param) {
+			return nil, fmt.Errorf("params[%d] must be a string, number, boolean or null", i)
+		}
+	}
+
+	q := &ExportQuery{SQL: strings.TrimSpace(query), Params: params}
+	bound := make([]bool, len(params))
+	tables := make(map[string]bool)
+
+	// Each level of parentheses has its own scope, the first the query
+	// itself. cte is the CTE named before the next parenthesis.
+	levels := []*sqlLevel{{}}
+	cte := ""
+
+	for i := 0; i < len(tokens); i++ {
+		tok := tokens[i]
+		level := levels[len(levels)-1]
+		table := false
+		switch tok.kind {
+		case 'p':
+			n, _ := strconv.Atoi(tok.value)
+			if n < 1 || n > len(params) {
+				return nil, fmt.Errorf("placeholder $%s has no param", tok.value)
+			}
+			bound[n-1] = true
+
+		case '(':
+			call := i > 0 && (tokens[i-1].kind == 'q' ||
+				tokens[i-1].kind == 'w' && !exportQueryKeywords[tokens[i-1].value])
+			if call {
+				if err := checkSQLCall(tokens, i-1); err != nil {
+					return nil, err
+				}
+			}
+			levels = append(levels, &sqlLevel{call: call, cte: cte})
+			cte = ""
+
+		case ')':
+			if len(levels) == 1 {
+				return nil, fmt.Errorf("query has an unbalanced parenthesis")
+			}
+			levels = levels[:len(levels)-1]
+			// A CTE is defined once its body ends, for the rest of its
+			// WITH's level
+			if level.cte != "" {
+				levels[len(levels)-1].define(level.cte)
+			}
+
+		case ',':
+			table = level.from
+
+		case 'w':
+			if exportQueryWords[tok.value] {
+				return nil, fmt.Errorf("query may not use %s", strings.ToUpper(tok.value))
+			}
+			// FOR SHARE, FOR KEY SHARE and FOR NO KEY UPDATE lock rows too
+			if tok.value == "for" && i+1 < len(tokens) && tokens[i+1].kind == 'w' &&
+				(tokens[i+1].value == "share" || tokens[i+1].value == "key" || tokens[i+1].value == "no") {
+				return nil, fmt.Errorf("query may not lock rows")
+			}
+
+			if tok.value == "with" && i+1 < len(tokens) && tokens[i+1].kind == 'w' && tokens[i+1].value == "recursive" {
+				level.recursive = true
+			}
+
+			// "name AS (" and "name AS MATERIALIZED (" define a CTE. Only
+			// a recursive one can read itself; in any other, its own name
+			// is a table.
+			if i+2 < len(tokens) && tokens[i+1].kind == 'w' && tokens[i+1].value == "as" &&
+				(tokens[i+2].kind == '(' || tokens[i+2].kind == 'w' && (tokens[i+2].value == "materialized" || tokens[i+2].value == "not")) {
+				if level.recursive {
+					level.define(tok.value)
+				} else {
+					cte = tok.value
+				}
+			}
+
+			// FROM inside a call, as in EXTRACT(YEAR FROM created_at),
+			// reads no table, but ARRAY(SELECT ...) holds a subquery.
+			// TABLE name is short for SELECT * FROM name.
+			if level.call && (tok.value == "select" || tok.value == "table") {
+				level.call = false
+			}
+			switch {
+			case level.call:
+			case tok.value == "from":
+				level.from, table = true, true
+			case tok.value == "join", tok.value == "table":
+				table = true
+			case isSQLClause(tok.value) && !isSQLJoin(tok.value):
+				level.from = false
+			}
+		}
+
+		if table {
+			next, name, err := readSQLTable(tokens, i+1)
+			if err != nil {
+				return nil, err
+			}
+			if name != "" && !sqlCTEVisible(levels, name) {
+				tables[name] = true
+			}
+			i = next - 1
+		}
+	}
+
+	if len(levels) > 1 {
+		return nil, fmt.Errorf("query has an unbalanced parenthesis")
+	}
+	for i, ok := range bound {
+		if !ok {
+			return nil, fmt.Errorf("params[%d] is not used by $%d", i, i+1)
+		}
+	}
+
+	for name := range tables {
+		q.Tables = append(q.Tables, name)
+	}
+	sort.Strings(q.Tables)
+	return q, nil
+}
+
+// sqlLevel is the scope of a level of parentheses in an export query
+type sqlLevel struct {
+	call      bool            // the parentheses call a function
+	from      bool            // in a FROM list, whose commas separate tables
+	recursive bool            // its WITH is WITH RECURSIVE
+	cte       string          // the CTE whose body the level is
+	ctes      map[string]bool // CTEs defined so far, seen by this level and those within it
+}
+
+func (l *sqlLevel) define(cte string) {
+	if l.ctes == nil {
+		l.ctes = make(map[string]bool)
+	}
+	l.ctes[cte] = true
+}
+
+// sqlCTEVisible reports whether name refers to a CTE defined at one of
+// levels. Schema-qualified names are always tables.
+func sqlCTEVisible(levels []*sqlLevel, name string) bool {
+	if strings.Contains(name, ".") {
+		return false
+	}
+	for _, level := range levels {
+		if level.ctes[name] {
+			return true
+		}
+	}
+	return false
+}
+
+// checkSQLCall checks the function called by tokens[i], the name before
+// an opening parenthesis. A name after AS is not a call but a type, as in
+// CAST(x AS numeric(10, 2)), or a table alias with column names.
+func checkSQLCall(tokens []sqlToken, i int) error {
+	if i > 0 && tokens[i-1].kind == 'w' && tokens[i-1].value == "as" {
+		return nil
+	}
+	if i > 0 && tokens[i-1].kind == '.' {
+		return fmt.Errorf("query may not call schema-qualified functions")
+	}
+	if tokens[i].kind != 'w' || !exportQueryFunctions[tokens[i].value] {
+		return fmt.Errorf("query may not call %s", tokens[i].value)
+	}
+	return nil
+}
+
+// readSQLTable reads the table at tokens[i], after FROM, JOIN or a comma,
+// and skips its alias. It returns the index of the token after them, and
+// no name for subqueries.
+func readSQLTable(tokens []sqlToken, i int) (int, string, error) {
+	if i < len(tokens) && tokens[i].kind == 'w' && (tokens[i].value == "lateral" || tokens[i].value == "only") {
+		i++
+	}
+	if i >= len(tokens) {
+		return i, "", fmt.Errorf("query ends without a table")
+	}
+	if tokens[i].kind == '(' {
+		return i, "", nil
+	}
+
+	var parts []string
+	for {
+		if i >= len(tokens) || (tokens[i].kind != 'w' && tokens[i].kind != 'q') {
+			return i, "", fmt.Errorf("query names no table after FROM or JOIN")
+		}
+		parts = append(parts, tokens[i].value)
+		i++
+		if i >= len(tokens) || tokens[i].kind != '.' {
+			break
+		}
+		i++
+	}
+
+	// Skip "AS alias" or "alias"
+	if i < len(tokens) && tokens[i].kind == 'w' && tokens[i].value == "as" {
+		i++
+	}
+	if i < len(tokens) && (tokens[i].kind == 'q' || tokens[i].kind == 'w' && !isSQLClause(tokens[i].value)) {
+		i++
+	}
+	return i, strings.Join(parts, "."), nil
+}
+
+// isSQLClause reports whether word can follow a table instead of an alias
+func isSQLClause(word string) bool {
+	switch word {
+	case "where", "group", "order", "having", "limit", "offset", "fetch", "for", "window",
+		"union", "intersect", "except", "tablesample":
+		return true
+	}
+	return isSQLJoin(word)
+}
+
+// isSQLJoin reports whether word is part of a join, which continues a
+// FROM list
+func isSQLJoin(word string) bool {
+	switch word {
+	case "join", "inner", "left", "right", "full", "outer", "cross", "natural", "on", "using":
+		return true
+	}
+	return false
+}
+
+// tokenizeSQL splits query into words, quoted identifiers, strings,
+// placeholders and punctuation. Whitespace and a final semicolon are
+// dropped.
+func tokenizeSQL(query string) ([]sqlToken, error) {
+	var tokens []sqlToken
+	s := []rune(query)
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case unicode.IsSpace(c):
+			i++
+
+		case c == '-' && i+1 < len(s) && s[i+1] == '-', c == '/' && i+1 < len(s) && s[i+1] == '*':
+			return nil, fmt.Errorf("query may not contain comments")
+
+		case c == ';':
+			if strings.TrimSpace(string(s[i+1:])) != "" {
+				return nil, fmt.Errorf("query must be a single statement")
+			}
+			i = len(s)
+
+		case c == '\'':
+			// E'...' strings escape quotes with backslashes too
+			escapes := len(tokens) > 0 && tokens[len(tokens)-1].kind == 'w' && tokens[len(tokens)-1].value == "e" &&
+				i > 0 && (s[i-1] == 'e' || s[i-1] == 'E')
+			if escapes {
+				tokens = tokens[:len(tokens)-1]
+			}
+			end, ok := closeSQLQuote(s, i, '\'', escapes)
+			if !ok {
+				return nil, fmt.Errorf("query has an unterminated string")
+			}
+			tokens = append(tokens, sqlToken{kind: 's', value: string(s[i+1 : end])})
+			i = end + 1
+
+		case c == '"':
+			end, ok := closeSQLQuote(s, i, '"', false)
+			if !ok {
+				return nil, fmt.Errorf("query has an unterminated quoted identifier")
+			}
+			tokens = append(tokens, sqlToken{kind: 'q', value: strings.ToLower(strings.ReplaceAll(string(s[i+1:end]), `""`, `"`))})
+			i = end + 1
+
+		case c == '$':
+			j := i + 1
+			for j < len(s) && unicode.IsDigit(s[j]) {
+				j++
+			}
+			if j == i+1 {
+				return nil, fmt.Errorf("query may not contain dollar-quoted strings")
+			}
+			tokens = append(tokens, sqlToken{kind: 'p', value: string(s[i+1 : j])})
+			i = j
+
+		case c == '_' || unicode.IsLetter(c) || unicode.IsDigit(c):
+			j := i
+			for j < len(s) && (s[j] == '_' || s[j] == '$' || unicode.IsLetter(s[j]) || unicode.IsDigit(s[j])) {
+				j++
+			}
+			tokens = append(tokens, sqlToken{kind: 'w', value: strings.ToLower(string(s[i:j]))})
+			i = j
+
+		case c > unicode.MaxASCII:
+			tokens = append(tokens, sqlToken{kind: '?', value: string(c)})
+			i++
+
+		default:
+			tokens = append(tokens, sqlToken{kind: byte(c), value: string(c)})
+			i++
+		}
+	}
+	return tokens, nil
+}
+
+// closeSQLQuote returns the index of the quote closing the one at s[i].
+// Doubled quotes, and backslashed characters if escapes is set, don't
+// close it.
+func closeSQLQuote(s []rune, i int, quote rune, escapes bool) (int, bool) {
+	for j := i + 1; j < len(s); j++ {
+		switch {
+		case escapes && s[j] == '\\':
+			j++
+		case s[j] == quote && j+1 < len(s) && s[j+1] == quote:
+			j++
+		case s[j] == quote:
+			return j, true
+		}
+	}
+	return 0, false
+}
+
+// AllowTables checks that the query reads only tables and views in
+// allowed. Names are compared without regard to case; "sales.*" allows
+// every table of the sales schema.
+func (q *ExportQuery) AllowTables(allowed []string) error {
+	for _, table := range q.Tables {
+		if !exportTableAllowed(table, allowed) {
+			return fmt.Errorf("table %s is not allowed", table)
+		}
+	}
+	return nil
+}
+
+func exportTableAllowed(table string, allowed []string) bool {
+	for _, entry := range allowed {
+		entry = strings.ToLower(entry)
+		if entry == table {
+			return true
+		}
+		if schema, ok := strings.CutSuffix(entry, ".*"); ok && strings.HasPrefix(table, schema+".") && !strings.Contains(table[len(schema)+1:], ".") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,131 @@
+package types
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseExportQuery(t *testing.T) {
+	tests := []struct {
+		query  string
+		params []interface{}
+		tables []string
+	}{
+		{"SELECT * FROM users", nil, []string{"users"}},
+		{"select id, name from Public.Users u where id > $1 and status = $2;", []interface{}{10.0, "active"}, []string{"public.users"}},
+		{`SELECT o.id FROM orders o JOIN "Customers" AS c ON c.id = o.customer_id, regions r`, nil, []string{"customers", "orders", "regions"}},
+		{"WITH recent AS (SELECT * FROM orders WHERE created_at > $1) SELECT * FROM recent", []interface{}{"2024-01-01"}, []string{"orders"}},
+		{"SELECT extract(year FROM created_at), substring(name from 2) FROM users", nil, []string{"users"}},
+		{"SELECT * FROM users WHERE id IN (SELECT user_id FROM orders)", nil, []string{"orders", "users"}},
+		{"SELECT 'DELETE FROM users; --' AS note, $1 FROM events", []interface{}{nil}, []string{"events"}},
+		{`SELECT E'it\'s -- fine' FROM events`, nil, []string{"events"}},
+		{"SELECT date_trunc('month', created_at) AS month, count(*) FILTER (WHERE total > 100), CAST(sum(total) AS numeric(12, 2)) FROM orders GROUP BY 1", nil, []string{"orders"}},
+		{"SELECT id, row_number() OVER (PARTITION BY region ORDER BY total DESC), total::varchar(20) FROM orders", nil, []string{"orders"}},
+		{"SELECT s.n FROM generate_numbers AS s(n)", nil, []string{"generate_numbers"}},
+		{"WITH a AS (SELECT * FROM users), b AS (SELECT * FROM a) SELECT * FROM b JOIN a USING (id)", nil, []string{"users"}},
+		{"WITH RECURSIVE tree AS (SELECT id FROM users UNION ALL SELECT u.id FROM users u JOIN tree ON u.manager_id = tree.id) SELECT * FROM tree", nil, []string{"users"}},
+		{"SELECT id FROM users UNION TABLE admins", nil, []string{"admins", "users"}},
+	}
+	for _, tt := range tests {
+		q, err := ParseExportQuery(tt.query, tt.params)
+		if err != nil {
+			t.Errorf("ParseExportQuery(%q) error = %v", tt.query, err)
+			continue
+		}
+		if !reflect.DeepEqual(q.Tables, tt.tables) {
+			t.Errorf("ParseExportQuery(%q) tables = %v, want %v", tt.query, q.Tables, tt.tables)
+		}
+	}
+}
+
+func TestParseExportQueryInvalid(t *testing.T) {
+	tests := map[string]struct {
+		query  string
+		params []interface{}
+		want   string
+	}{
+		"not a select":        {"DELETE FROM users", nil, "must be a SELECT"},
+		"stacked":             {"SELECT * FROM users; DROP TABLE users", nil, "single statement"},
+		"comment":             {"SELECT * FROM users -- WHERE tenant = 'acme'", nil, "comments"},
+		"block comment":       {"SELECT * FROM users /* x */", nil, "comments"},
+		"writing cte":         {"WITH d AS (DELETE FROM users RETURNING *) SELECT * FROM d", nil, "DELETE"},
+		"select into":         {"SELECT * INTO copy FROM users", nil, "INTO"},
+		"row locks":           {"SELECT * FROM users FOR SHARE", nil, "lock rows"},
+		"admin function":      {"SELECT pg_sleep(60) FROM users", nil, "pg_sleep"},
+		"query_to_xml":        {"select query_to_xml('select * from secrets', true, true, '')", nil, "may not call query_to_xml"},
+		"query in from":       {"SELECT * FROM query_to_xml('select * from secrets', true, true, '') AS x", nil, "may not call query_to_xml"},
+		"table_to_xml":        {"SELECT table_to_xml('secrets', true, true, '') FROM users", nil, "may not call table_to_xml"},
+		"lo_import":           {"SELECT lo_import('/etc/passwd')", nil, "may not call lo_import"},
+		"set_config":          {"SELECT set_config('role', 'postgres', false) FROM users", nil, "may not call set_config"},
+		"quoted function":     {`SELECT "query_to_xml"('select * from secrets', true, true, '')`, nil, "may not call query_to_xml"},
+		"qualified function":  {"SELECT pg_catalog.lower(name) FROM users", nil, "schema-qualified"},
+		"nested call":         {"SELECT lower(query_to_xml('select 1', true, true, '')::text) FROM users", nil, "may not call query_to_xml"},
+		"dollar quotes":       {"SELECT $$x$$ FROM users", nil, "dollar-quoted"},
+		"unterminated":        {"SELECT 'x FROM users", nil, "unterminated"},
+		"missing param":       {"SELECT * FROM users WHERE id = $2", []interface{}{1.0}, "has no param"},
+		"unused param":        {"SELECT * FROM users", []interface{}{1.0}, "params[0] is not used"},
+		"non-scalar param":    {"SELECT * FROM users WHERE id = $1", []interface{}{[]interface{}{1.0}}, "params[0]"},
+		"unbalanced":          {"SELECT count(* FROM users", nil, "unbalanced"},
+		"no table after from": {"SELECT * FROM", nil, "without a table"},
+	}
+	for name, tt := range tests {
+		_, err := ParseExportQuery(tt.query, tt.params)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: ParseExportQuery() = %v, want an error containing %q", name, err, tt.want)
+		}
+	}
+}
+
+func TestExportQueryAllowTables(t *testing.T) {
+	q, err := ParseExportQuery("SELECT * FROM sales.orders JOIN users ON users.id = orders.user_id", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := q.AllowTables([]string{"Users", "sales.*"}); err != nil {
+		t.Errorf("AllowTables() = %v, want the schema wildcard to allow sales.orders", err)
+	}
+	if err := q.AllowTables([]string{"users", "orders"}); err == nil || !strings.Contains(err.Error(), "sales.orders") {
+		t.Errorf("AllowTables() = %v, want sales.orders rejected", err)
+	}
+	if err := q.AllowTables(nil); err == nil {
+		t.Error("AllowTables(nil) allowed the query")
+	}
+}
+
+// TestExportQueryTablesOutsideCTEs checks that a table can't pass the
+// allowlist by sharing a CTE's name outside the CTE's scope, or by being
+// read with TABLE
+func TestExportQueryTablesOutsideCTEs(t *testing.T) {
+	queries := []string{
+		"WITH payroll AS (SELECT * FROM payroll) SELECT * FROM payroll",
+		"SELECT * FROM (WITH payroll AS (SELECT 1) SELECT * FROM payroll) s, payroll",
+		"WITH x AS (TABLE payroll) SELECT * FROM x",
+		"SELECT id FROM users UNION TABLE payroll",
+		"SELECT * FROM users JOIN payroll USING (id), (WITH payroll AS (SELECT 1) SELECT * FROM payroll) s",
+		"WITH a AS (SELECT * FROM payroll), payroll AS (SELECT 1) SELECT * FROM a",
+		"SELECT array(SELECT salary FROM payroll) FROM users",
+	}
+	for _, query := range queries {
+		q, err := ParseExportQuery(query, nil)
+		if err != nil {
+			t.Errorf("ParseExportQuery(%q) error = %v", query, err)
+			continue
+		}
+		if err := q.AllowTables([]string{"users"}); err == nil || !strings.Contains(err.Error(), "payroll") {
+			t.Errorf("AllowTables(users) for %q = %v, want payroll rejected", query, err)
+		}
+	}
+}
+
+func TestValidateJobRequestExportQuery(t *testing.T) {
+	req := &JobRequest{
+		Type:    JobTypeDataExport,
+		Payload: json.RawMessage(`{"export_type": "csv", "query": "SELECT * FROM users WHERE name = '' OR 1=1; DROP TABLE users"}`),
+	}
+	err := ValidateJobRequest(req)
+	if err == nil || !strings.Contains(err.Error(), "single statement") {
+		t.Errorf("ValidateJobRequest() = %v, want the query rejected at submission", err)
+	}
+}
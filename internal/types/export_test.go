@@ -0,0 +1,116 @@
+package types
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func parseSpec(t *testing.T, format, filters string) (*ExportSpec, error) {
+	t.Helper()
+	var payload DataExportPayload
+	raw := `{"export_type": "csv", "query": "SELECT * FROM users", "format": ` + format + `, "filters": ` + filters + `}`
+	if err := json.Unmarshal([]byte(raw), &payload); err != nil {
+		t.Fatalf("invalid test payload: %v", err)
+	}
+	return ParseExportSpec(payload)
+}
+
+func TestExportSpecColumns(t *testing.T) {
+	spec, err := parseSpec(t, `{"columns": ["id",
+		{"field": "created_at", "as": "Signed up", "date_format": "DD/MM/YYYY"},
+		{"field": "value", "as": "Amount", "decimals": 2}]}`, `null`)
+	if err != nil {
+		t.Fatalf("ParseExportSpec() error = %v", err)
+	}
+
+	row := map[string]interface{}{"id": 7, "created_at": "2024-03-01", "value": 12.3456, "status": "active"}
+	columns := spec.ColumnsFor(row)
+	var names []string
+	var values []interface{}
+	for _, column := range columns {
+		names = append(names, column.Name)
+		values = append(values, column.Value(row))
+	}
+	if strings.Join(names, ",") != "id,Signed up,Amount" {
+		t.Errorf("columns = %v", names)
+	}
+	if values[0] != 7 || values[1] != "01/03/2024" || values[2] != 12.35 {
+		t.Errorf("values = %v, want [7 01/03/2024 12.35]", values)
+	}
+
+	// Without columns, every column is kept, sorted
+	all, _ := parseSpec(t, `{}`, `{}`)
+	names = nil
+	for _, column := range all.ColumnsFor(row) {
+		names = append(names, column.Name)
+	}
+	if strings.Join(names, ",") != "created_at,id,status,value" {
+		t.Errorf("default columns = %v", names)
+	}
+}
+
+func TestExportSpecFilters(t *testing.T) {
+	spec, err := parseSpec(t, `null`, `{"status": {"in": ["active", "pending"]}, "value": {"gte": 100, "lt": 500},
+		"created_at": {"gte": "2024-01-01"}, "email": {"contains": "@example.com"}}`)
+	if err != nil {
+		t.Fatalf("ParseExportSpec() error = %v", err)
+	}
+
+	match := map[string]interface{}{"status": "active", "value": 100, "created_at": "2024-02-01", "email": "a@example.com"}
+	if !spec.Match(match) {
+		t.Error("Match() = false for a matching row")
+	}
+	for field, value := range map[string]interface{}{"status": "inactive", "value": 500.0, "created_at": "2023-12-31", "email": "a@other.com"} {
+		row := make(map[string]interface{}, len(match))
+		for k, v := range match {
+			row[k] = v
+		}
+		row[field] = value
+		if spec.Match(row) {
+			t.Errorf("Match() = true with %s = %v", field, value)
+		}
+	}
+	delete(match, "email")
+	if spec.Match(match) {
+		t.Error("Match() = true for a row without a filtered column")
+	}
+
+	eq, _ := parseSpec(t, `null`, `{"age": 30, "status": {"ne": "inactive"}}`)
+	if !eq.Match(map[string]interface{}{"age": 30, "status": "active"}) || eq.Match(map[string]interface{}{"age": 31, "status": "active"}) {
+		t.Error("Expected a plain value to filter on equality")
+	}
+}
+
+func TestExportSpecInvalid(t *testing.T) {
+	tests := map[string][2]string{
+		"columns not an array": {`{"columns": "id"}`, `null`},
+		"empty columns":        {`{"columns": []}`, `null`},
+		"column without field": {`{"columns": [{"as": "ID"}]}`, `null`},
+		"unknown column key":   {`{"columns": [{"field": "id", "rename": "ID"}]}`, `null`},
+		"duplicate column":     {`{"columns": ["id", {"field": "name", "as": "id"}]}`, `null`},
+		"date format":          {`{"columns": [{"field": "created_at", "date_format": "%d/%m"}]}`, `null`},
+		"decimals":             {`{"columns": [{"field": "value", "decimals": 11}]}`, `null`},
+		"unknown operator":     {`null`, `{"value": {"between": [1, 2]}}`},
+		"empty in":             {`null`, `{"status": {"in": []}}`},
+		"gt on a boolean":      {`null`, `{"active": {"gt": true}}`},
+		"contains a number":    {`null`, `{"name": {"contains": 5}}`},
+		"array value":          {`null`, `{"status": ["active"]}`},
+	}
+	for name, tt := range tests {
+		if _, err := parseSpec(t, tt[0], tt[1]); err == nil {
+			t.Errorf("%s: ParseExportSpec() succeeded", name)
+		}
+	}
+}
+
+func TestValidateJobRequestExportSpec(t *testing.T) {
+	req := &JobRequest{
+		Type:    JobTypeDataExport,
+		Payload: json.RawMessage(`{"export_type": "csv", "query": "SELECT * FROM users", "filters": {"value": {"between": [1, 2]}}}`),
+	}
+	err := ValidateJobRequest(req)
+	if err == nil || !strings.Contains(err.Error(), "unknown operator") {
+		t.Errorf("ValidateJobRequest() = %v, want the filter rejected at submission", err)
+	}
+}
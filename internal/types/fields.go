@@ -0,0 +1,96 @@
+package types
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// heavyJobFields can be large and are left out of job listings unless
+// asked for
+var heavyJobFields = []string{"payload", "result"}
+
+// jobFields are the JSON field names of a Job
+var jobFields = func() map[string]bool {
+	fields := make(map[string]bool)
+	t := reflect.TypeOf(Job{})
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if name != "" && name != "-" {
+			fields[name] = true
+		}
+	}
+	return fields
+}()
+
+// JobFields selects which fields of a job are returned. A nil set selects
+// every field.
+type JobFields map[string]bool
+
+// DefaultListFields returns the fields included in job listings: every
+// field except payloads and results
+func DefaultListFields() JobFields {
+	fields := make(JobFields, len(jobFields))
+	for name := range jobFields {
+		fields[name] = true
+	}
+	for _, name := range heavyJobFields {
+		delete(fields, name)
+	}
+	return fields
+}
+
+// ParseJobFields parses a comma-separated list of job field names, such as
+// the fields and include query parameters
+func ParseJobFields(spec string) (JobFields, error) {
+	fields := make(JobFields)
+	for _, name := range strings.Split(spec, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if !jobFields[name] {
+			return nil, fmt.Errorf("unknown job field %q", name)
+		}
+		fields[name] = true
+	}
+	return fields, nil
+}
+
+// Has reports whether a field is selected
+func (f JobFields) Has(name string) bool {
+	return f == nil || f[name]
+}
+
+// Add selects the fields of other as well
+func (f JobFields) Add(other JobFields) {
+	for name := range other {
+		f[name] = true
+	}
+}
+
+// Select returns the JSON representation of a job holding only the
+// selected fields. The job ID is always included.
+func (f JobFields) Select(job *Job) (map[string]json.RawMessage, error) {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return nil, err
+	}
+
+	var all map[string]json.RawMessage
+	if err := json.Unmarshal(data, &all); err != nil {
+		return nil, err
+	}
+	if f == nil {
+		return all, nil
+	}
+
+	selected := make(map[string]json.RawMessage, len(f)+1)
+	for name, value := range all {
+		if name == "id" || f[name] {
+			selected[name] = value
+		}
+	}
+	return selected, nil
+}
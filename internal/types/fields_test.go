@@ -0,0 +1,66 @@
+package types
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestParseJobFields(t *testing.T) {
+	fields, err := ParseJobFields("status, payload,,result_ref")
+	if err != nil {
+		t.Fatalf("ParseJobFields() error = %v", err)
+	}
+	for _, name := range []string{"status", "payload", "result_ref"} {
+		if !fields.Has(name) {
+			t.Errorf("field %s not selected", name)
+		}
+	}
+	if fields.Has("result") {
+		t.Error("field result selected, want not")
+	}
+
+	if _, err := ParseJobFields("status,checkpoint"); err == nil {
+		t.Error("ParseJobFields() accepted a field that isn't returned")
+	}
+}
+
+func TestDefaultListFields(t *testing.T) {
+	fields := DefaultListFields()
+	if fields.Has("payload") || fields.Has("result") {
+		t.Error("default list fields include payload or result")
+	}
+	if !fields.Has("status") || !fields.Has("workflow_id") {
+		t.Error("default list fields are missing job metadata")
+	}
+
+	var nilFields JobFields
+	if !nilFields.Has("payload") {
+		t.Error("nil field set doesn't select every field")
+	}
+}
+
+func TestJobFieldsSelect(t *testing.T) {
+	job := &Job{
+		ID:      "job-1",
+		Type:    JobTypeEmail,
+		Status:  JobStatusCompleted,
+		Payload: json.RawMessage(`{"to":"a@example.com"}`),
+		Result:  json.RawMessage(`{"sent":true}`),
+	}
+
+	fields, _ := ParseJobFields("status,result")
+	selected, err := fields.Select(job)
+	if err != nil {
+		t.Fatalf("Select() error = %v", err)
+	}
+
+	if len(selected) != 3 {
+		t.Errorf("selected %d fields, want id, status and result: %v", len(selected), selected)
+	}
+	if string(selected["id"]) != `"job-1"` || string(selected["result"]) != `{"sent":true}` {
+		t.Errorf("unexpected selection: %v", selected)
+	}
+	if _, ok := selected["payload"]; ok {
+		t.Error("payload selected, want not")
+	}
+}
@@ -9,13 +9,28 @@ import (
 type JobStatus string
 
 const (
+	JobStatusScheduled  JobStatus = "scheduled" // Created to run at a later time
 	JobStatusPending    JobStatus = "pending"
 	JobStatusProcessing JobStatus = "processing"
 	JobStatusCompleted  JobStatus = "completed"
 	JobStatusFailed     JobStatus = "failed"
 	JobStatusRetrying   JobStatus = "retrying"
+	JobStatusCancelled  JobStatus = "cancelled"
+	JobStatusExpired    JobStatus = "expired" // Not started before its expiry
 )
 
+// IsValid reports whether s is a known status
+func (s JobStatus) IsValid() bool {
+	_, known := transitions[s]
+	return known
+}
+
+// IsFinal reports whether a job with this status will not change again
+func (s JobStatus) IsFinal() bool {
+	next, known := transitions[s]
+	return known && len(next) == 0
+}
+
 // JobType represents different types of jobs we can process
 type JobType string
 
@@ -26,14 +41,41 @@ const (
 	JobTypeDataExport  JobType = "data_export"
 )
 
+// JobPriority controls queue order and whether a job is accepted while the
+// queue is under backpressure
+type JobPriority string
+
+const (
+	JobPriorityLow    JobPriority = "low"
+	JobPriorityNormal JobPriority = "normal"
+	JobPriorityHigh   JobPriority = "high"
+)
+
+// IsValid reports whether p is a known priority
+func (p JobPriority) IsValid() bool {
+	switch p {
+	case JobPriorityLow, JobPriorityNormal, JobPriorityHigh:
+		return true
+	}
+	return false
+}
+
+// DefaultTenantID owns all jobs when multi-tenancy is disabled
+const DefaultTenantID = "default"
+
 // Job represents a task to be processed
 type Job struct {
 	ID          string          `json:"id" db:"id"`
+	TenantID    string          `json:"tenant_id,omitempty" db:"tenant_id"`
 	Type        JobType         `json:"type" db:"type"`
+	Priority    JobPriority     `json:"priority,omitempty" db:"priority"`
 	Payload     json.RawMessage `json:"payload" db:"payload"`
+	PayloadRef  string          `json:"payload_ref,omitempty" db:"payload_ref"` // Set when the payload is offloaded to blob storage
 	Status      JobStatus       `json:"status" db:"status"`
 	Result      json.RawMessage `json:"result,omitempty" db:"result"`
+	ResultRef   string          `json:"result_ref,omitempty" db:"result_ref"` // Set when the result is kept in blob storage
 	Error       string          `json:"error,omitempty" db:"error"`
+	ErrorCode   ErrorCode       `json:"error_code,omitempty" db:"error_code"`
 	Attempts    int             `json:"attempts" db:"attempts"`
 	MaxAttempts int             `json:"max_attempts" db:"max_attempts"`
 	CreatedAt   time.Time       `json:"created_at" db:"created_at"`
@@ -42,14 +84,108 @@ type Job struct {
 	StartedAt   *time.Time      `json:"started_at,omitempty" db:"started_at"`
 	CompletedAt *time.Time      `json:"completed_at,omitempty" db:"completed_at"`
 	WorkerID    string          `json:"worker_id,omitempty" db:"worker_id"`
+	Progress    *JobProgress    `json:"progress,omitempty" db:"progress"`
+	Checkpoint  json.RawMessage `json:"-" db:"checkpoint"`                    // Saved by the processor so a retry can resume
+	ParentID    string          `json:"parent_id,omitempty" db:"parent_id"`   // Set on follow-up jobs
+	OnSuccess   *JobRequest     `json:"on_success,omitempty" db:"on_success"` // Enqueued when the job completes
+	OnFailure   *JobRequest     `json:"on_failure,omitempty" db:"on_failure"` // Enqueued when the job fails for good
+
+	ResultExpiresAt *time.Time `json:"result_expires_at,omitempty" db:"expires_at"`
+	ResultChecksum  string     `json:"result_checksum,omitempty" db:"checksum"` // Set when the result was streamed to blob storage
+
+	WorkflowID   string `json:"workflow_id,omitempty" db:"workflow_id"`
+	WorkflowStep string `json:"workflow_step,omitempty" db:"workflow_step"`
+
+	// AffinityKey makes jobs of the same type and key run one at a time, in
+	// order, on the worker that holds the key
+	AffinityKey string `json:"affinity_key,omitempty" db:"affinity_key"`
+
+	// ExpiresAt is when a waiting job stops being worth running. A job
+	// still waiting for its first attempt or a retry by then expires
+	// instead of running late; a running attempt is left to finish.
+	ExpiresAt *time.Time `json:"expires_at,omitempty" db:"start_expires_at"`
+
+	// Version counts the updates to the job in PostgreSQL. Updates only
+	// apply to the version they were based on.
+	Version int `json:"version,omitempty" db:"version"`
+}
+
+// JobProgress is what a processor last reported about a running job
+type JobProgress struct {
+	Percent   int       `json:"percent"`
+	Message   string    `json:"message,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Tenant returns the job's tenant, treating jobs created before
+// multi-tenancy was introduced as belonging to the default tenant
+func (j *Job) Tenant() string {
+	if j.TenantID == "" {
+		return DefaultTenantID
+	}
+	return j.TenantID
+}
+
+// Expired reports whether the job's expiry passed by now
+func (j *Job) Expired(now time.Time) bool {
+	return j.ExpiresAt != nil && !now.Before(*j.ExpiresAt)
+}
+
+// EffectivePriority returns the job's priority, treating jobs created
+// before priorities were introduced as normal
+func (j *Job) EffectivePriority() JobPriority {
+	if j.Priority == "" {
+		return JobPriorityNormal
+	}
+	return j.Priority
 }
 
 // JobRequest represents a request to create a new job
 type JobRequest struct {
 	Type        JobType         `json:"type"`
+	Priority    JobPriority     `json:"priority,omitempty"`
 	Payload     json.RawMessage `json:"payload"`
 	MaxAttempts int             `json:"max_attempts,omitempty"`
 	ScheduledAt *time.Time      `json:"scheduled_at,omitempty"`
+	AffinityKey string          `json:"affinity_key,omitempty"`
+	ExpiresAt   *time.Time      `json:"expires_at,omitempty"`
+
+	// Follow-up jobs created in the same tenant once this job completes or
+	// fails for good
+	OnSuccess *JobRequest `json:"on_success,omitempty"`
+	OnFailure *JobRequest `json:"on_failure,omitempty"`
+}
+
+// MapPayloads returns a copy of the request with fn applied to its payload
+// and the payloads of its follow-ups, such as to encrypt them for storage
+func (r *JobRequest) MapPayloads(fn func(json.RawMessage) (json.RawMessage, error)) (*JobRequest, error) {
+	if r == nil {
+		return nil, nil
+	}
+
+	mapped := *r
+	var err error
+	if mapped.Payload, err = fn(r.Payload); err != nil {
+		return nil, err
+	}
+	if mapped.OnSuccess, err = r.OnSuccess.MapPayloads(fn); err != nil {
+		return nil, err
+	}
+	if mapped.OnFailure, err = r.OnFailure.MapPayloads(fn); err != nil {
+		return nil, err
+	}
+	return &mapped, nil
+}
+
+// Chain returns the request followed by every follow-up nested in it
+func (r *JobRequest) Chain() []*JobRequest {
+	chain := []*JobRequest{r}
+	for _, follow := range []*JobRequest{r.OnSuccess, r.OnFailure} {
+		if follow != nil {
+			chain = append(chain, follow.Chain()...)
+		}
+	}
+	return chain
 }
 
 // JobResponse represents the response when creating or querying a job
@@ -58,20 +194,118 @@ type JobResponse struct {
 	Message string `json:"message,omitempty"`
 }
 
+// Worker statuses reported in the workers table
+const (
+	WorkerStatusStarting   = "starting"
+	WorkerStatusIdle       = "idle"
+	WorkerStatusProcessing = "processing"
+	WorkerStatusPaused     = "paused"
+	WorkerStatusDraining   = "draining"
+	WorkerStatusOffline    = "offline"
+)
+
+// WorkerCommand is a remote control instruction sent to a worker
+type WorkerCommand string
+
+const (
+	WorkerCommandPause    WorkerCommand = "pause"
+	WorkerCommandResume   WorkerCommand = "resume"
+	WorkerCommandShutdown WorkerCommand = "shutdown"
+)
+
+// IsValid reports whether the command is one workers understand
+func (c WorkerCommand) IsValid() bool {
+	switch c {
+	case WorkerCommandPause, WorkerCommandResume, WorkerCommandShutdown:
+		return true
+	}
+	return false
+}
+
 // Worker represents a worker instance
 type Worker struct {
-	ID         string    `json:"id"`
-	Status     string    `json:"status"`
-	LastSeen   time.Time `json:"last_seen"`
-	JobTypes   []JobType `json:"job_types"`
-	CurrentJob string    `json:"current_job,omitempty"`
+	ID          string    `json:"id"`
+	Status      string    `json:"status"`
+	LastSeen    time.Time `json:"last_seen"`
+	JobTypes    []JobType `json:"job_types"`
+	Concurrency int       `json:"concurrency"`
+	CurrentJob  string    `json:"current_job,omitempty"`
+	CurrentJobs []string  `json:"current_jobs,omitempty"`
+
+	// Degraded lists the job types whose processor failed its startup
+	// self-check, with the reason. They are left out of JobTypes.
+	Degraded map[JobType]string `json:"degraded,omitempty"`
 }
 
 // JobStats represents statistics about job processing
 type JobStats struct {
 	Total      int `json:"total"`
+	Scheduled  int `json:"scheduled"`
 	Pending    int `json:"pending"`
 	Processing int `json:"processing"`
 	Completed  int `json:"completed"`
 	Failed     int `json:"failed"`
+	Cancelled  int `json:"cancelled"`
+	Expired    int `json:"expired"`
+
+	// FailedByCode breaks down Failed by the error code of each job's
+	// last attempt
+	FailedByCode map[ErrorCode]int `json:"failed_by_code,omitempty"`
+
+	ByType map[JobType]*TypeStats `json:"by_type,omitempty"`
+	Queues []QueueStats           `json:"queues,omitempty"`
+}
+
+// TypeStats breaks down JobStats for one job type
+type TypeStats struct {
+	Total      int `json:"total"`
+	Scheduled  int `json:"scheduled"`
+	Pending    int `json:"pending"`
+	Processing int `json:"processing"`
+	Completed  int `json:"completed"`
+	Failed     int `json:"failed"`
+	Cancelled  int `json:"cancelled"`
+	Expired    int `json:"expired"`
+
+	FailedByCode map[ErrorCode]int `json:"failed_by_code,omitempty"`
+}
+
+// StatsTimeseries is the response body of GET /api/v1/stats/timeseries
+type StatsTimeseries struct {
+	From            time.Time     `json:"from"`
+	To              time.Time     `json:"to"`
+	IntervalSeconds float64       `json:"interval_seconds"`
+	Series          []StatsSeries `json:"series"`
+}
+
+// StatsSeries holds one job type's activity per interval, with totals and
+// latency percentiles over the whole window. Latency is the processing time
+// of completed jobs, from start to completion; it is omitted when no job
+// completed.
+type StatsSeries struct {
+	JobType    JobType      `json:"job_type"`
+	Created    int          `json:"created"`
+	Completed  int          `json:"completed"`
+	Failed     int          `json:"failed"`
+	LatencyP50 *float64     `json:"latency_p50_seconds,omitempty"`
+	LatencyP95 *float64     `json:"latency_p95_seconds,omitempty"`
+	Points     []StatsPoint `json:"points"`
+}
+
+// StatsPoint is one interval of a StatsSeries
+type StatsPoint struct {
+	Start      time.Time `json:"start"`
+	Created    int       `json:"created"`
+	Completed  int       `json:"completed"`
+	Failed     int       `json:"failed"`
+	LatencyP50 *float64  `json:"latency_p50_seconds,omitempty"`
+	LatencyP95 *float64  `json:"latency_p95_seconds,omitempty"`
+}
+
+// QueueStats reports what a queue holds, read from the queue itself
+type QueueStats struct {
+	Name       string  `json:"name"`
+	JobType    JobType `json:"job_type"`
+	Pending    int     `json:"pending"`
+	Processing int     `json:"processing"`
 }
@@ -0,0 +1,396 @@
+package types
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+)
+
+// ErrJobTypeDisabled is returned when validating a request for a job type
+// that is disabled
+var ErrJobTypeDisabled = errors.New("job type is disabled")
+
+// Duration is a time.Duration written in JSON, YAML and TOML as a string
+// such as "30s"
+type Duration time.Duration
+
+// MarshalText writes the duration as a string
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+// UnmarshalText reads a duration string such as "1m30s"
+func (d *Duration) UnmarshalText(text []byte) error {
+	parsed, err := time.ParseDuration(string(text))
+	if err != nil || parsed < 0 {
+		return fmt.Errorf("invalid duration %q", text)
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// UnmarshalJSON reads a duration string, rejecting bare numbers
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("duration must be a string such as \"30s\"")
+	}
+	return d.UnmarshalText([]byte(s))
+}
+
+// Jitter values of a retry policy
+const (
+	JitterNone = "none" // wait exactly the backoff delay
+	JitterFull = "full" // wait a random time between zero and the backoff delay
+)
+
+// RetryPolicy sets the backoff between attempts of a failed job. The
+// delay doubles after each attempt, starting from BaseDelay, up to MaxDelay.
+type RetryPolicy struct {
+	BaseDelay Duration `json:"base_delay,omitempty" yaml:"base_delay" toml:"base_delay"`
+	MaxDelay  Duration `json:"max_delay,omitempty" yaml:"max_delay" toml:"max_delay"`
+
+	// Jitter spreads out the retries of jobs that failed together, such
+	// as when a downstream service was down. Empty means JitterNone.
+	Jitter string `json:"jitter,omitempty" yaml:"jitter" toml:"jitter"`
+
+	// ByErrorCode overrides the policy for failures with an error code,
+	// for instance to back off longer from RATE_LIMITED. Zero fields of an
+	// override take the values of the policy.
+	ByErrorCode map[ErrorCode]RetryPolicy `json:"by_error_code,omitempty" yaml:"by_error_code" toml:"by_error_code"`
+}
+
+// For returns the policy for failures with the error code code: its
+// override, if there is one, laid over p
+func (p RetryPolicy) For(code ErrorCode) RetryPolicy {
+	override := p.ByErrorCode[code]
+	p.ByErrorCode = nil
+	return override.merge(p)
+}
+
+// merge returns p with its zero fields taken from defaults
+func (p RetryPolicy) merge(defaults RetryPolicy) RetryPolicy {
+	if p.BaseDelay == 0 {
+		p.BaseDelay = defaults.BaseDelay
+	}
+	if p.MaxDelay == 0 {
+		p.MaxDelay = defaults.MaxDelay
+	}
+	if p.Jitter == "" {
+		p.Jitter = defaults.Jitter
+	}
+	if p.ByErrorCode == nil {
+		p.ByErrorCode = defaults.ByErrorCode
+	}
+	return p
+}
+
+func (p RetryPolicy) validate() error {
+	switch p.Jitter {
+	case "", JitterNone, JitterFull:
+	default:
+		return fmt.Errorf("retry jitter must be %q or %q", JitterNone, JitterFull)
+	}
+	if p.MaxDelay != 0 && p.MaxDelay < p.BaseDelay {
+		return fmt.Errorf("retry max_delay is shorter than base_delay")
+	}
+	for code, override := range p.ByErrorCode {
+		if !code.IsValid() {
+			return fmt.Errorf("retry by_error_code has unknown error code %q", code)
+		}
+		if override.ByErrorCode != nil {
+			return fmt.Errorf("retry by_error_code %s can't have its own by_error_code", code)
+		}
+		if err := override.validate(); err != nil {
+			return fmt.Errorf("retry by_error_code %s: %w", code, err)
+		}
+	}
+	return nil
+}
+
+// Delay returns how long to wait before retrying a job that has failed
+// attempts times
+func (p RetryPolicy) Delay(attempts int) time.Duration {
+	delay := time.Duration(p.BaseDelay)
+	for i := 1; i < attempts && delay < time.Duration(p.MaxDelay); i++ {
+		delay *= 2
+	}
+	return min(delay, time.Duration(p.MaxDelay))
+}
+
+// Backoff returns how long to actually wait before retrying a job that has
+// failed attempts times: Delay, or with full jitter a random time up to it
+func (p RetryPolicy) Backoff(attempts int) time.Duration {
+	delay := p.Delay(attempts)
+	if p.Jitter != JitterFull || delay <= 0 {
+		return delay
+	}
+	return rand.N(delay + 1)
+}
+
+// Failure describes a failed attempt of a job
+type Failure struct {
+	Message string
+	Code    ErrorCode
+
+	// Permanent fails the job for good, even if it has attempts left
+	Permanent bool
+
+	// RetryAfter is the least time to wait before the next attempt
+	RetryAfter time.Duration
+}
+
+// FailureFrom describes the failure of an attempt that returned err, with
+// the error code from ErrorCodeOf. A PermanentError anywhere in the chain fails the job for good, and a
+// RetryableError delays its retry by at least its RetryAfter. Other
+// errors are retried while the job has attempts left, since nothing says
+// another attempt can't succeed.
+func FailureFrom(err error) Failure {
+	failure := Failure{Message: err.Error(), Code: ErrorCodeOf(err)}
+
+	var permanent *PermanentError
+	failure.Permanent = errors.As(err, &permanent)
+
+	var retryable *RetryableError
+	if !failure.Permanent && errors.As(err, &retryable) {
+		failure.RetryAfter = retryable.RetryAfter
+	}
+
+	return failure
+}
+
+// Retry reports whether a job of maxAttempts attempts is retried after
+// this failure of its attempts-th attempt
+func (f Failure) Retry(attempts, maxAttempts int) bool {
+	return !f.Permanent && attempts < maxAttempts
+}
+
+// Delay returns how long to wait before retrying a job of type jobType
+// after this failure of its attempts-th attempt: the backoff of the type's
+// retry policy for the failure's error code, or RetryAfter if that is
+// longer. Jitter never brings the wait under RetryAfter.
+func (f Failure) Delay(jobType JobType, attempts int) time.Duration {
+	return max(DefaultJobTypes.For(jobType).Retry.For(f.Code).Backoff(attempts), f.RetryAfter)
+}
+
+// JobTypeConfig holds the settings of a job type. Zero fields take the
+// value of the default configuration.
+type JobTypeConfig struct {
+	// Enabled is false for job types that the API rejects and workers
+	// don't run
+	Enabled *bool `json:"enabled,omitempty" yaml:"enabled" toml:"enabled"`
+
+	// Timeout bounds a single attempt. Zero means no timeout.
+	Timeout Duration `json:"timeout,omitempty" yaml:"timeout" toml:"timeout"`
+
+	// MaxAttempts is used for jobs that don't set their own
+	MaxAttempts int `json:"max_attempts,omitempty" yaml:"max_attempts" toml:"max_attempts"`
+
+	Retry RetryPolicy `json:"retry,omitempty" yaml:"retry" toml:"retry"`
+
+	// Concurrency caps the jobs of this type each worker runs at once.
+	// Zero means the worker's concurrency.
+	Concurrency int `json:"concurrency,omitempty" yaml:"concurrency" toml:"concurrency"`
+
+	// RateLimit caps submissions of this type per minute across all
+	// clients. Zero means unlimited.
+	RateLimit int `json:"rate_limit,omitempty" yaml:"rate_limit" toml:"rate_limit"`
+
+	// NotifyFailure posts a message to chat webhooks when a job of this
+	// type fails for good
+	NotifyFailure FailureNotify `json:"notify_failure,omitempty" yaml:"notify_failure" toml:"notify_failure"`
+
+	// FIFO runs the jobs of this type strictly one at a time, in the order
+	// they were created, with retries keeping their place
+	FIFO *bool `json:"fifo,omitempty" yaml:"fifo" toml:"fifo"`
+}
+
+// FailureNotify holds the incoming webhook URLs that failed jobs are
+// reported to. Both are optional.
+type FailureNotify struct {
+	Slack string `json:"slack,omitempty" yaml:"slack" toml:"slack"`
+	Teams string `json:"teams,omitempty" yaml:"teams" toml:"teams"`
+}
+
+// IsZero reports whether no webhook is set
+func (n FailureNotify) IsZero() bool {
+	return n.Slack == "" && n.Teams == ""
+}
+
+// IsEnabled reports whether jobs of the type may be submitted and run
+func (c JobTypeConfig) IsEnabled() bool {
+	return c.Enabled == nil || *c.Enabled
+}
+
+// IsFIFO reports whether jobs of the type run strictly in order
+func (c JobTypeConfig) IsFIFO() bool {
+	return c.FIFO != nil && *c.FIFO
+}
+
+// merge returns c with its zero fields taken from defaults
+func (c JobTypeConfig) merge(defaults JobTypeConfig) JobTypeConfig {
+	if c.Enabled == nil {
+		c.Enabled = defaults.Enabled
+	}
+	if c.Timeout == 0 {
+		c.Timeout = defaults.Timeout
+	}
+	if c.MaxAttempts == 0 {
+		c.MaxAttempts = defaults.MaxAttempts
+	}
+	c.Retry = c.Retry.merge(defaults.Retry)
+	if c.Concurrency == 0 {
+		c.Concurrency = defaults.Concurrency
+	}
+	if c.RateLimit == 0 {
+		c.RateLimit = defaults.RateLimit
+	}
+	if c.NotifyFailure.IsZero() {
+		c.NotifyFailure = defaults.NotifyFailure
+	}
+	if c.FIFO == nil {
+		c.FIFO = defaults.FIFO
+	}
+	return c
+}
+
+func (c JobTypeConfig) validate() error {
+	switch {
+	case c.MaxAttempts < 0:
+		return fmt.Errorf("max_attempts can't be negative")
+	case c.Concurrency < 0:
+		return fmt.Errorf("concurrency can't be negative")
+	case c.RateLimit < 0:
+		return fmt.Errorf("rate_limit can't be negative")
+	}
+	if err := c.Retry.validate(); err != nil {
+		return err
+	}
+	for _, webhook := range []string{c.NotifyFailure.Slack, c.NotifyFailure.Teams} {
+		if webhook == "" {
+			continue
+		}
+		if u, err := url.Parse(webhook); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("notify_failure webhook %q is not an http(s) URL", webhook)
+		}
+	}
+	return nil
+}
+
+// JobTypeConfigs is the configuration of every job type: a default and
+// per-type overrides
+type JobTypeConfigs struct {
+	Default JobTypeConfig             `json:"default" yaml:"default" toml:"default"`
+	Types   map[JobType]JobTypeConfig `json:"types,omitempty" yaml:"types" toml:"types"`
+}
+
+// Validate checks the default and every job type's settings
+func (c JobTypeConfigs) Validate() error {
+	if err := c.Default.validate(); err != nil {
+		return fmt.Errorf("invalid default job type config: %w", err)
+	}
+	for jobType, config := range c.Types {
+		if err := config.validate(); err != nil {
+			return fmt.Errorf("invalid config for job type %s: %w", jobType, err)
+		}
+	}
+	return nil
+}
+
+// builtinJobTypeConfigs are the settings used when none are configured
+var builtinJobTypeConfigs = JobTypeConfigs{
+	Default: JobTypeConfig{
+		MaxAttempts: 3,
+		Retry:       RetryPolicy{BaseDelay: Duration(5 * time.Second), MaxDelay: Duration(5 * time.Minute)},
+	},
+	Types: map[JobType]JobTypeConfig{
+		JobTypeWebhook: {Timeout: Duration(30 * time.Second)},
+	},
+}
+
+// JobTypeRegistry holds the job type configuration shared by the API
+// server and workers
+type JobTypeRegistry struct {
+	mu      sync.RWMutex
+	configs JobTypeConfigs
+}
+
+// DefaultJobTypes is the registry used by NewJob, the queues and workers.
+// It starts out with the built-in settings.
+var DefaultJobTypes = NewJobTypeRegistry()
+
+// NewJobTypeRegistry creates a registry with the built-in settings
+func NewJobTypeRegistry() *JobTypeRegistry {
+	return &JobTypeRegistry{configs: withBuiltins(JobTypeConfigs{})}
+}
+
+// withBuiltins lays configs over the built-in settings
+func withBuiltins(configs JobTypeConfigs) JobTypeConfigs {
+	merged := JobTypeConfigs{
+		Default: configs.Default.merge(builtinJobTypeConfigs.Default),
+		Types:   make(map[JobType]JobTypeConfig),
+	}
+	for jobType, config := range builtinJobTypeConfigs.Types {
+		merged.Types[jobType] = config
+	}
+	for jobType, config := range configs.Types {
+		merged.Types[jobType] = config.merge(merged.Types[jobType])
+	}
+	return merged
+}
+
+// Set replaces the configuration. Settings it leaves out keep their
+// built-in values.
+func (r *JobTypeRegistry) Set(configs JobTypeConfigs) error {
+	if err := configs.Validate(); err != nil {
+		return err
+	}
+
+	merged := withBuiltins(configs)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.configs = merged
+	return nil
+}
+
+// ReadJobTypeConfigs reads job type settings from a JSON file of the form
+// {"default": {...}, "types": {"email": {...}}}
+func ReadJobTypeConfigs(path string) (JobTypeConfigs, error) {
+	var configs JobTypeConfigs
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return configs, fmt.Errorf("failed to read job type config: %w", err)
+	}
+	if err := json.Unmarshal(data, &configs); err != nil {
+		return configs, fmt.Errorf("invalid job type config %s: %w", path, err)
+	}
+	return configs, nil
+}
+
+// LoadFile replaces the configuration with the settings in a JSON file
+// read by ReadJobTypeConfigs
+func (r *JobTypeRegistry) LoadFile(path string) error {
+	configs, err := ReadJobTypeConfigs(path)
+	if err != nil {
+		return err
+	}
+	return r.Set(configs)
+}
+
+// For returns the settings of a job type
+func (r *JobTypeRegistry) For(jobType JobType) JobTypeConfig {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.configs.Types[jobType].merge(r.configs.Default)
+}
+
+// Enabled reports whether jobs of a type may be submitted and run
+func (r *JobTypeRegistry) Enabled(jobType JobType) bool {
+	return r.For(jobType).IsEnabled()
+}
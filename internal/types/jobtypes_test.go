@@ -0,0 +1,237 @@
+package types
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicyDelay(t *testing.T) {
+	policy := RetryPolicy{BaseDelay: Duration(5 * time.Second), MaxDelay: Duration(time.Minute)}
+
+	tests := map[int]time.Duration{
+		1: 5 * time.Second,
+		2: 10 * time.Second,
+		4: 40 * time.Second,
+		5: time.Minute,
+		9: time.Minute,
+	}
+	for attempts, want := range tests {
+		if got := policy.Delay(attempts); got != want {
+			t.Errorf("Delay(%d) = %v, want %v", attempts, got, want)
+		}
+	}
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	policy := RetryPolicy{BaseDelay: Duration(5 * time.Second), MaxDelay: Duration(time.Minute), Jitter: JitterFull}
+	for i := 0; i < 100; i++ {
+		if got := policy.Backoff(3); got < 0 || got > 20*time.Second {
+			t.Fatalf("Backoff(3) with full jitter = %v, want 0s to 20s", got)
+		}
+	}
+
+	policy.Jitter = JitterNone
+	if got := policy.Backoff(3); got != 20*time.Second {
+		t.Errorf("Backoff(3) without jitter = %v, want 20s", got)
+	}
+}
+
+func TestRetryPolicyByErrorCode(t *testing.T) {
+	policy := RetryPolicy{
+		BaseDelay: Duration(5 * time.Second),
+		MaxDelay:  Duration(time.Minute),
+		Jitter:    JitterFull,
+		ByErrorCode: map[ErrorCode]RetryPolicy{
+			ErrorCodeRateLimited: {BaseDelay: Duration(time.Minute), MaxDelay: Duration(time.Hour), Jitter: JitterNone},
+			ErrorCodeTimeout:     {BaseDelay: Duration(10 * time.Second)},
+		},
+	}
+
+	if got := policy.For(ErrorCodeRateLimited).Backoff(2); got != 2*time.Minute {
+		t.Errorf("RATE_LIMITED backoff = %v, want 2m", got)
+	}
+	timeout := policy.For(ErrorCodeTimeout)
+	if timeout.BaseDelay != Duration(10*time.Second) || timeout.MaxDelay != Duration(time.Minute) || timeout.Jitter != JitterFull {
+		t.Errorf("TIMEOUT policy = %+v, want the override laid over the policy", timeout)
+	}
+	if got := policy.For(ErrorCodeUnknown); got.BaseDelay != policy.BaseDelay || got.ByErrorCode != nil {
+		t.Errorf("UNKNOWN policy = %+v, want the policy itself", got)
+	}
+}
+
+func TestFailureFrom(t *testing.T) {
+	plain := FailureFrom(errors.New("connection reset"))
+	if plain.Permanent || plain.RetryAfter != 0 || !plain.Retry(1, 3) || plain.Retry(3, 3) {
+		t.Errorf("plain error = %+v, want a failure retried while attempts are left", plain)
+	}
+
+	permanent := FailureFrom(fmt.Errorf("webhook call failed: %w", Permanent(errors.New("status 400"))))
+	if !permanent.Permanent || permanent.Retry(1, 3) {
+		t.Errorf("wrapped permanent error = %+v, want it not retried", permanent)
+	}
+	if permanent.Message != "webhook call failed: status 400" {
+		t.Errorf("message = %q, want the full error", permanent.Message)
+	}
+
+	// A permanent error wins over a retryable one around it
+	if inner := FailureFrom(Retryable(Permanent(errors.New("status 400")), time.Hour)); !inner.Permanent || inner.RetryAfter != 0 {
+		t.Errorf("retryable wrapping a permanent error = %+v, want it permanent", inner)
+	}
+	if Permanent(nil) != nil || Retryable(nil, time.Second) != nil {
+		t.Error("Expected nil errors to stay nil")
+	}
+
+	// Retry-After only ever lengthens the job type's delay
+	delayed := FailureFrom(Retryable(errors.New("status 503"), time.Hour))
+	if delayed.Permanent || !delayed.Retry(1, 3) {
+		t.Errorf("retryable error = %+v, want it retried", delayed)
+	}
+	if got := delayed.Delay(JobTypeEmail, 1); got != time.Hour {
+		t.Errorf("Delay with RetryAfter = %v, want 1h", got)
+	}
+	delayed.RetryAfter = time.Millisecond
+	if got, want := delayed.Delay(JobTypeEmail, 1), DefaultJobTypes.For(JobTypeEmail).Retry.Delay(1); got != want {
+		t.Errorf("Delay with short RetryAfter = %v, want the policy's %v", got, want)
+	}
+}
+
+func TestErrorCodeOf(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want ErrorCode
+	}{
+		{"coded", fmt.Errorf("export failed: %w", WithErrorCode(ErrorCodeValidation, errors.New("bad query"))), ErrorCodeValidation},
+		{"coded inside permanent", Permanent(WithErrorCode(ErrorCodeDownstream5xx, errors.New("status 502"))), ErrorCodeDownstream5xx},
+		{"deadline", fmt.Errorf("failed to send email: %w", context.DeadlineExceeded), ErrorCodeTimeout},
+		{"cancelled", context.Canceled, ErrorCodeCancelled},
+		{"plain", errors.New("connection reset"), ErrorCodeUnknown},
+	}
+	for _, tt := range tests {
+		if got := ErrorCodeOf(tt.err); got != tt.want {
+			t.Errorf("%s: ErrorCodeOf = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+
+	if failure := FailureFrom(WithErrorCode(ErrorCodePanic, errors.New("processor panicked"))); failure.Code != ErrorCodePanic {
+		t.Errorf("FailureFrom code = %s, want PANIC", failure.Code)
+	}
+	if !ErrorCodeTimeout.IsValid() || ErrorCode("OOPS").IsValid() {
+		t.Error("Expected only listed error codes to be valid")
+	}
+	if WithErrorCode(ErrorCodeTimeout, nil) != nil {
+		t.Error("Expected a nil error to stay nil")
+	}
+}
+
+func TestJobTypeRegistry(t *testing.T) {
+	r := NewJobTypeRegistry()
+	if got := r.For(JobTypeEmail).MaxAttempts; got != 3 {
+		t.Errorf("built-in max attempts = %d, want 3", got)
+	}
+	if got := r.For(JobTypeWebhook).Timeout; got != Duration(30*time.Second) {
+		t.Errorf("built-in webhook timeout = %v, want 30s", time.Duration(got))
+	}
+
+	path := filepath.Join(t.TempDir(), "job_types.json")
+	config := `{
+		"default": {"max_attempts": 5},
+		"types": {
+			"email": {"concurrency": 2, "rate_limit": 100, "retry": {"base_delay": "1s"}},
+			"webhook": {"max_attempts": 10},
+			"sms": {"enabled": false}
+		}
+	}`
+	if err := os.WriteFile(path, []byte(config), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.LoadFile(path); err != nil {
+		t.Fatalf("LoadFile: %v", err)
+	}
+
+	email := r.For(JobTypeEmail)
+	if email.MaxAttempts != 5 || email.Concurrency != 2 || email.RateLimit != 100 {
+		t.Errorf("email config = %+v", email)
+	}
+	if email.Retry.BaseDelay != Duration(time.Second) || email.Retry.MaxDelay != Duration(5*time.Minute) {
+		t.Errorf("email retry = %+v, want base 1s and the built-in max", email.Retry)
+	}
+
+	webhook := r.For(JobTypeWebhook)
+	if webhook.MaxAttempts != 10 || webhook.Timeout != Duration(30*time.Second) {
+		t.Errorf("webhook config = %+v, want its own max attempts and the built-in timeout", webhook)
+	}
+
+	if r.Enabled("sms") || !r.Enabled(JobTypeEmail) {
+		t.Error("only sms should be disabled")
+	}
+}
+
+func TestJobTypeRegistryInvalid(t *testing.T) {
+	r := NewJobTypeRegistry()
+
+	err := r.Set(JobTypeConfigs{Types: map[JobType]JobTypeConfig{JobTypeEmail: {Concurrency: -1}}})
+	if err == nil {
+		t.Error("Set accepted a negative concurrency")
+	}
+
+	invalid := []RetryPolicy{
+		{Jitter: "half"},
+		{ByErrorCode: map[ErrorCode]RetryPolicy{"THROTTLED": {}}},
+		{ByErrorCode: map[ErrorCode]RetryPolicy{ErrorCodeTimeout: {BaseDelay: Duration(time.Minute), MaxDelay: Duration(time.Second)}}},
+	}
+	for _, retry := range invalid {
+		if err := r.Set(JobTypeConfigs{Default: JobTypeConfig{Retry: retry}}); err == nil {
+			t.Errorf("Set accepted retry policy %+v", retry)
+		}
+	}
+
+	var configs JobTypeConfigs
+	if err := json.Unmarshal([]byte(`{"default": {"timeout": 30}}`), &configs); err == nil {
+		t.Error("a numeric timeout was accepted")
+	}
+}
+
+func TestValidateDisabledJobType(t *testing.T) {
+	disabled := false
+	if err := DefaultJobTypes.Set(JobTypeConfigs{
+		Types: map[JobType]JobTypeConfig{JobTypeEmail: {Enabled: &disabled}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	defer DefaultJobTypes.Set(JobTypeConfigs{})
+
+	req := &JobRequest{
+		Type:    JobTypeEmail,
+		Payload: json.RawMessage(`{"to": "a@example.com", "subject": "Hi", "body": "Hello"}`),
+	}
+	if err := ValidateJobRequest(req); !errors.Is(err, ErrJobTypeDisabled) {
+		t.Errorf("ValidateJobRequest = %v, want ErrJobTypeDisabled", err)
+	}
+}
+
+func TestNewJobOfFIFOType(t *testing.T) {
+	fifo := true
+	if err := DefaultJobTypes.Set(JobTypeConfigs{
+		Types: map[JobType]JobTypeConfig{JobTypeWebhook: {FIFO: &fifo}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	defer DefaultJobTypes.Set(JobTypeConfigs{})
+
+	job := NewJob(&JobRequest{Type: JobTypeWebhook, AffinityKey: "customer-42", Payload: json.RawMessage(`{}`)})
+	if job.AffinityKey != FIFOAffinityKey {
+		t.Errorf("FIFO job affinity key = %q, want %q", job.AffinityKey, FIFOAffinityKey)
+	}
+
+	job = NewJob(&JobRequest{Type: JobTypeEmail, AffinityKey: "customer-42", Payload: json.RawMessage(`{}`)})
+	if job.AffinityKey != "customer-42" {
+		t.Errorf("affinity key = %q, want the requested key", job.AffinityKey)
+	}
+}
@@ -1,5 +1,7 @@
 package types
 
+import "time"
+
 // EmailPayload represents the data needed for email jobs
 type EmailPayload struct {
 	To      string            `json:"to"`
@@ -9,6 +11,20 @@ type EmailPayload struct {
 	Body    string            `json:"body"`
 	HTML    bool              `json:"html,omitempty"`
 	Headers map[string]string `json:"headers,omitempty"`
+
+	// Template names the email template rendered with Variables into the
+	// subject and body. A Subject set alongside it replaces the template's.
+	Template  string                 `json:"template,omitempty"`
+	Variables map[string]interface{} `json:"variables,omitempty"`
+}
+
+// EmailTemplate is a named Go template email jobs can be sent from. Source
+// defines the subject in a "subject" block; the rest renders the body.
+type EmailTemplate struct {
+	Name      string    `json:"name"`
+	Source    string    `json:"source"`
+	HTML      bool      `json:"html,omitempty"`
+	UpdatedAt time.Time `json:"updated_at,omitempty"`
 }
 
 // EmailResult represents the result of an email job
@@ -19,12 +35,32 @@ type EmailResult struct {
 
 // ImageResizePayload represents the data needed for image resize jobs
 type ImageResizePayload struct {
-	ImageURL     string `json:"image_url"`
-	Sizes        []int  `json:"sizes"`       // [100, 300, 500] - widths in pixels
-	Format       string `json:"format"`      // "jpeg", "png", "webp"
-	Quality      int    `json:"quality"`     // 1-100 for JPEG
-	OutputPath   string `json:"output_path"` // S3 bucket path or local path
-	PreserveMeta bool   `json:"preserve_meta,omitempty"`
+	ImageURL     string   `json:"image_url"`
+	Sizes        []int    `json:"sizes"`                   // [100, 300, 500] - widths in pixels
+	Format       string   `json:"format"`                  // "jpeg", "png", "webp", "avif"
+	Formats      []string `json:"formats,omitempty"`       // each size in each format, instead of Format
+	Quality      int      `json:"quality"`                 // 1-100 for lossy formats; 0 uses the format's default
+	OutputPath   string   `json:"output_path"`             // S3 bucket path or local path
+	PreserveMeta bool     `json:"preserve_meta,omitempty"` // keep the original's EXIF data
+
+	// Crop crops images to an aspect ratio before resizing. Without it,
+	// images are resized proportionally.
+	Crop *ImageCrop `json:"crop,omitempty"`
+}
+
+// ImageCrop crops an image to an aspect ratio, keeping the region around
+// its focus
+type ImageCrop struct {
+	AspectRatio string      `json:"aspect_ratio"`          // "16:9", "1:1"
+	Focus       string      `json:"focus,omitempty"`       // "center" (default), "smart" or "focal"
+	FocalPoint  *FocalPoint `json:"focal_point,omitempty"` // required for "focal"
+}
+
+// FocalPoint is a point of an image, as fractions of its width and height
+// from the top left corner
+type FocalPoint struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
 }
 
 // ImageResizeResult represents the result of an image resize job
@@ -36,18 +72,36 @@ type ImageResizeResult struct {
 
 // ResizedImage represents a single resized image
 type ResizedImage struct {
-	Width  int    `json:"width"`
-	Height int    `json:"height"`
-	Size   int64  `json:"size"` // File size in bytes
-	URL    string `json:"url"`  // Final URL where image is stored
+	Width   int         `json:"width"`
+	Height  int         `json:"height"`
+	Size    int64       `json:"size"`              // File size in bytes
+	URL     string      `json:"url"`               // Final URL where image is stored
+	Format  string      `json:"format,omitempty"`  // Format the image was encoded in
+	Quality int         `json:"quality,omitempty"` // Quality it was encoded at; 0 for lossless formats
+	Crop    *CropRegion `json:"crop,omitempty"`    // Region of the original kept, if cropped
+	EXIF    bool        `json:"exif,omitempty"`    // The original's EXIF data was kept
+}
+
+// CropRegion is the region of the original image a resized image shows, in
+// pixels of the original
+type CropRegion struct {
+	X      int `json:"x"`
+	Y      int `json:"y"`
+	Width  int `json:"width"`
+	Height int `json:"height"`
 }
 
 // ImageMetadata represents metadata extracted from the original image
 type ImageMetadata struct {
-	OriginalWidth  int    `json:"original_width"`
+	OriginalWidth  int    `json:"original_width"` // upright, after its orientation is applied
 	OriginalHeight int    `json:"original_height"`
 	OriginalSize   int64  `json:"original_size"`
 	Format         string `json:"format"`
+
+	Orientation  int    `json:"orientation,omitempty"`   // EXIF orientation the image was rotated by, if any
+	Camera       string `json:"camera,omitempty"`        // EXIF make and model
+	HasGPS       bool   `json:"has_gps"`                 // the original's EXIF data has a GPS position
+	ColorProfile string `json:"color_profile,omitempty"` // embedded ICC profile
 }
 
 // WebhookPayload represents the data needed for webhook jobs
@@ -57,29 +111,43 @@ type WebhookPayload struct {
 	Headers map[string]string `json:"headers,omitempty"`
 	Data    interface{}       `json:"data,omitempty"`
 	Timeout int               `json:"timeout,omitempty"` // Timeout in seconds
+
+	// Auth names the configured credentials to authenticate with, and
+	// SigningSecret signs this webhook instead of their secret
+	Auth          string `json:"auth,omitempty"`
+	SigningSecret string `json:"signing_secret,omitempty"`
 }
 
 // WebhookResult represents the result of a webhook job
 type WebhookResult struct {
 	StatusCode   int               `json:"status_code"`
 	ResponseBody string            `json:"response_body,omitempty"`
+	Truncated    bool              `json:"truncated,omitempty"` // the body was cut at the size limit
 	Headers      map[string]string `json:"headers,omitempty"`
 	Duration     int64             `json:"duration_ms"`
 }
 
 // DataExportPayload represents the data needed for data export jobs
 type DataExportPayload struct {
-	ExportType string                 `json:"export_type"` // "csv", "json", "xlsx"
-	Query      string                 `json:"query"`       // SQL query or data source
-	Format     map[string]interface{} `json:"format,omitempty"`
-	OutputPath string                 `json:"output_path"`
-	Filters    map[string]interface{} `json:"filters,omitempty"`
+	ExportType  string                 `json:"export_type"`           // "csv", "json", "ndjson", "xlsx"
+	Query       string                 `json:"query"`                 // a SELECT, see ExportQuery
+	Params      []interface{}          `json:"params,omitempty"`      // values of the query's $1, $2, ... placeholders
+	Format      map[string]interface{} `json:"format,omitempty"`      // columns, and sheet settings of xlsx exports
+	OutputPath  string                 `json:"output_path"`           // local path, or the file name in the export store
+	Filters     map[string]interface{} `json:"filters,omitempty"`     // conditions rows must meet, see ExportSpec
+	Compression string                 `json:"compression,omitempty"` // "gzip" (default) or "none"
 }
 
 // DataExportResult represents the result of a data export job
 type DataExportResult struct {
-	FilePath string `json:"file_path"`
-	FileSize int64  `json:"file_size"`
-	RowCount int    `json:"row_count"`
-	Format   string `json:"format"`
+	FilePath    string `json:"file_path"` // local path, or the export store's file:// or s3:// ref
+	FileSize    int64  `json:"file_size"` // compressed
+	RowCount    int    `json:"row_count"`
+	Format      string `json:"format"`
+	Compression string `json:"compression,omitempty"`
+
+	// DownloadURL is a signed URL of the export, valid until ExpiresAt, if
+	// the export store can sign them
+	DownloadURL string     `json:"download_url,omitempty"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
 }
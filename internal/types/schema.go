@@ -0,0 +1,215 @@
+package types
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+//go:embed schemas/*.json
+var builtinSchemas embed.FS
+
+// SchemaRegistry holds the JSON Schema used to validate each job type's payload.
+// A job type is only accepted if a schema is registered for it.
+type SchemaRegistry struct {
+	mu       sync.RWMutex
+	raw      map[JobType]json.RawMessage
+	compiled map[JobType]*jsonschema.Schema
+}
+
+// DefaultSchemas is the registry used by ValidateJobRequest.
+// It starts out with schemas for the built-in job types.
+var DefaultSchemas = NewSchemaRegistry()
+
+// NewSchemaRegistry creates a registry preloaded with the built-in schemas
+func NewSchemaRegistry() *SchemaRegistry {
+	r := &SchemaRegistry{
+		raw:      make(map[JobType]json.RawMessage),
+		compiled: make(map[JobType]*jsonschema.Schema),
+	}
+
+	entries, _ := builtinSchemas.ReadDir("schemas")
+	for _, entry := range entries {
+		data, err := builtinSchemas.ReadFile("schemas/" + entry.Name())
+		if err != nil {
+			panic(fmt.Sprintf("failed to read built-in schema %s: %v", entry.Name(), err))
+		}
+		jobType := JobType(strings.TrimSuffix(entry.Name(), ".json"))
+		if err := r.Register(jobType, data); err != nil {
+			panic(fmt.Sprintf("invalid built-in schema %s: %v", entry.Name(), err))
+		}
+	}
+
+	return r
+}
+
+// CheckSchema reports whether schema is a valid JSON Schema for jobType
+// without registering it
+func CheckSchema(jobType JobType, schema json.RawMessage) error {
+	_, err := compileSchema(jobType, schema)
+	return err
+}
+
+func compileSchema(jobType JobType, schema json.RawMessage) (*jsonschema.Schema, error) {
+	if jobType == "" {
+		return nil, fmt.Errorf("job type is required")
+	}
+
+	compiler := jsonschema.NewCompiler()
+	url := "taskflow://schemas/" + string(jobType) + ".json"
+	if err := compiler.AddResource(url, bytes.NewReader(schema)); err != nil {
+		return nil, fmt.Errorf("invalid schema for %s: %w", jobType, err)
+	}
+
+	compiled, err := compiler.Compile(url)
+	if err != nil {
+		return nil, fmt.Errorf("invalid schema for %s: %w", jobType, err)
+	}
+
+	return compiled, nil
+}
+
+// Register compiles and stores the schema for a job type, replacing any existing one
+func (r *SchemaRegistry) Register(jobType JobType, schema json.RawMessage) error {
+	compiled, err := compileSchema(jobType, schema)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.raw[jobType] = schema
+	r.compiled[jobType] = compiled
+
+	return nil
+}
+
+// Sync registers the schemas that differ from those already registered,
+// such as schemas another API server stored, and returns their job types.
+// Invalid schemas are skipped and reported in the error.
+func (r *SchemaRegistry) Sync(schemas map[JobType]json.RawMessage) ([]JobType, error) {
+	var changed []JobType
+	var errs []error
+	for jobType, schema := range schemas {
+		if current, ok := r.Get(jobType); ok && bytes.Equal(current, schema) {
+			continue
+		}
+		if err := r.Register(jobType, schema); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		changed = append(changed, jobType)
+	}
+
+	sort.Slice(changed, func(i, j int) bool { return changed[i] < changed[j] })
+	return changed, errors.Join(errs...)
+}
+
+// LoadDir registers every <job_type>.json schema file in dir
+func (r *SchemaRegistry) LoadDir(dir string) error {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return fmt.Errorf("failed to read schema %s: %w", file, err)
+		}
+		jobType := JobType(strings.TrimSuffix(filepath.Base(file), ".json"))
+		if err := r.Register(jobType, data); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Get returns the raw schema registered for a job type
+func (r *SchemaRegistry) Get(jobType JobType) (json.RawMessage, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	schema, ok := r.raw[jobType]
+	return schema, ok
+}
+
+// JobTypes returns the job types with a registered schema, sorted
+func (r *SchemaRegistry) JobTypes() []JobType {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	jobTypes := make([]JobType, 0, len(r.raw))
+	for jobType := range r.raw {
+		jobTypes = append(jobTypes, jobType)
+	}
+	sort.Slice(jobTypes, func(i, j int) bool { return jobTypes[i] < jobTypes[j] })
+
+	return jobTypes
+}
+
+// Has reports whether a schema is registered for the job type
+func (r *SchemaRegistry) Has(jobType JobType) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	_, ok := r.compiled[jobType]
+	return ok
+}
+
+// Validate checks a payload against the schema registered for its job type
+func (r *SchemaRegistry) Validate(jobType JobType, payload json.RawMessage) error {
+	r.mu.RLock()
+	schema, ok := r.compiled[jobType]
+	r.mu.RUnlock()
+	if !ok {
+		return fmt.Errorf("invalid job type: %s", jobType)
+	}
+
+	var doc interface{}
+	if err := json.Unmarshal(payload, &doc); err != nil {
+		return fmt.Errorf("invalid %s payload: %w", jobType, err)
+	}
+
+	if err := schema.Validate(doc); err != nil {
+		return fmt.Errorf("invalid %s payload: %s", jobType, describeValidationError(err))
+	}
+
+	return nil
+}
+
+// describeValidationError flattens a schema validation error into a short message
+func describeValidationError(err error) string {
+	validationErr, ok := err.(*jsonschema.ValidationError)
+	if !ok {
+		return err.Error()
+	}
+
+	// Report the most specific causes rather than the top-level summary
+	var messages []string
+	var walk func(e *jsonschema.ValidationError)
+	walk = func(e *jsonschema.ValidationError) {
+		if len(e.Causes) == 0 {
+			location := e.InstanceLocation
+			if location == "" {
+				location = "/"
+			}
+			messages = append(messages, fmt.Sprintf("%s: %s", location, e.Message))
+			return
+		}
+		for _, cause := range e.Causes {
+			walk(cause)
+		}
+	}
+	walk(validationErr)
+
+	return strings.Join(messages, "; ")
+}
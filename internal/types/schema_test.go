@@ -0,0 +1,121 @@
+package types
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSchemaRegistryBuiltins(t *testing.T) {
+	registry := NewSchemaRegistry()
+
+	for _, jobType := range []JobType{JobTypeEmail, JobTypeImageResize, JobTypeWebhook, JobTypeDataExport} {
+		if _, ok := registry.Get(jobType); !ok {
+			t.Errorf("Expected built-in schema for %s", jobType)
+		}
+	}
+}
+
+func TestImageResizeSchemaCrop(t *testing.T) {
+	registry := NewSchemaRegistry()
+
+	valid := []string{
+		`{"image_url": "a.jpg", "sizes": [100], "formats": ["avif", "webp"], "crop": {"aspect_ratio": "16:9", "focus": "smart"}}`,
+		`{"image_url": "a.jpg", "sizes": [100], "crop": {"aspect_ratio": "1:1", "focus": "focal", "focal_point": {"x": 0.2, "y": 0.8}}}`,
+	}
+	for _, payload := range valid {
+		if err := registry.Validate(JobTypeImageResize, json.RawMessage(payload)); err != nil {
+			t.Errorf("Expected %s to be valid, got %v", payload, err)
+		}
+	}
+
+	invalid := []string{
+		`{"image_url": "a.jpg", "sizes": [100], "formats": ["bmp"]}`,
+		`{"image_url": "a.jpg", "sizes": [100], "crop": {"aspect_ratio": "wide"}}`,
+		`{"image_url": "a.jpg", "sizes": [100], "crop": {"aspect_ratio": "1:1", "focus": "focal"}}`,
+		`{"image_url": "a.jpg", "sizes": [100], "crop": {"aspect_ratio": "1:1", "focus": "focal", "focal_point": {"x": 1.5, "y": 0}}}`,
+	}
+	for _, payload := range invalid {
+		if err := registry.Validate(JobTypeImageResize, json.RawMessage(payload)); err == nil {
+			t.Errorf("Expected %s to be rejected", payload)
+		}
+	}
+}
+
+func TestSchemaRegistryCustomType(t *testing.T) {
+	registry := NewSchemaRegistry()
+	smsType := JobType("sms")
+
+	if err := registry.Validate(smsType, json.RawMessage(`{"phone": "+31612345678"}`)); err == nil {
+		t.Error("Expected unregistered job type to be rejected")
+	}
+
+	schema := json.RawMessage(`{
+		"type": "object",
+		"required": ["phone", "text"],
+		"properties": {"phone": {"type": "string"}, "text": {"type": "string", "maxLength": 160}}
+	}`)
+	if err := registry.Register(smsType, schema); err != nil {
+		t.Fatalf("Expected no error registering schema, got %v", err)
+	}
+
+	if err := registry.Validate(smsType, json.RawMessage(`{"phone": "+31612345678", "text": "hi"}`)); err != nil {
+		t.Errorf("Expected valid sms payload, got %v", err)
+	}
+
+	if err := registry.Validate(smsType, json.RawMessage(`{"phone": "+31612345678"}`)); err == nil {
+		t.Error("Expected sms payload without text to be rejected")
+	}
+}
+
+func TestSchemaRegistryRejectsInvalidSchema(t *testing.T) {
+	registry := NewSchemaRegistry()
+
+	if err := registry.Register(JobType("broken"), json.RawMessage(`{"type": 42}`)); err == nil {
+		t.Error("Expected invalid schema to be rejected")
+	}
+}
+
+func TestSchemaRegistryLoadDir(t *testing.T) {
+	dir := t.TempDir()
+	schema := `{"type": "object", "required": ["name"]}`
+	if err := os.WriteFile(filepath.Join(dir, "report.json"), []byte(schema), 0600); err != nil {
+		t.Fatalf("Failed to write schema: %v", err)
+	}
+
+	registry := NewSchemaRegistry()
+	if err := registry.LoadDir(dir); err != nil {
+		t.Fatalf("Expected no error loading schemas, got %v", err)
+	}
+
+	if err := registry.Validate(JobType("report"), json.RawMessage(`{}`)); err == nil {
+		t.Error("Expected report payload without name to be rejected")
+	}
+}
+
+func TestSchemaRegistrySync(t *testing.T) {
+	registry := NewSchemaRegistry()
+	sms := json.RawMessage(`{"type": "object", "required": ["phone"]}`)
+	email, _ := registry.Get(JobTypeEmail)
+
+	changed, err := registry.Sync(map[JobType]json.RawMessage{
+		"sms":        sms,
+		JobTypeEmail: email,
+		"broken":     json.RawMessage(`{"type": 5}`),
+	})
+	if err == nil {
+		t.Error("Expected an error for the invalid schema")
+	}
+	if len(changed) != 1 || changed[0] != "sms" {
+		t.Errorf("Expected only sms to change, got %v", changed)
+	}
+	if registry.Has("broken") {
+		t.Error("Expected invalid schema to be skipped")
+	}
+
+	changed, err = registry.Sync(map[JobType]json.RawMessage{"sms": sms})
+	if err != nil || len(changed) != 0 {
+		t.Errorf("Expected unchanged schemas to be left alone, got %v, %v", changed, err)
+	}
+}
@@ -0,0 +1,72 @@
+package types
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrInvalidTransition is returned for a status change the job state
+// machine doesn't allow, such as failing a completed job
+var ErrInvalidTransition = errors.New("invalid job status transition")
+
+// jobStatuses lists every status, in lifecycle order
+var jobStatuses = []JobStatus{
+	JobStatusScheduled,
+	JobStatusPending,
+	JobStatusProcessing,
+	JobStatusRetrying,
+	JobStatusCompleted,
+	JobStatusFailed,
+	JobStatusCancelled,
+	JobStatusExpired,
+}
+
+// transitions lists the statuses each status may move to. Scheduled,
+// pending and retrying jobs are claimed by a worker, cancelled, or expire.
+// A processing job completes, fails, is retried, is cancelled, goes back
+// to pending when its worker hands it back unfinished, or back to
+// scheduled when its worker parks it unrun. Completed, failed,
+// cancelled and expired jobs never change again.
+var transitions = map[JobStatus][]JobStatus{
+	JobStatusScheduled:  {JobStatusProcessing, JobStatusCancelled, JobStatusExpired},
+	JobStatusPending:    {JobStatusProcessing, JobStatusCancelled, JobStatusExpired},
+	JobStatusProcessing: {JobStatusCompleted, JobStatusFailed, JobStatusRetrying, JobStatusPending, JobStatusScheduled, JobStatusCancelled},
+	JobStatusRetrying:   {JobStatusProcessing, JobStatusCancelled, JobStatusExpired},
+	JobStatusCompleted:  nil,
+	JobStatusFailed:     nil,
+	JobStatusCancelled:  nil,
+	JobStatusExpired:    nil,
+}
+
+// CanTransition reports whether a job may move from status s to status to
+func (s JobStatus) CanTransition(to JobStatus) bool {
+	for _, next := range transitions[s] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// StatusesInto lists the statuses a job may move to status to from. Stores
+// use it to apply a transition only to jobs still in one of them.
+func StatusesInto(to JobStatus) []JobStatus {
+	var from []JobStatus
+	for _, status := range jobStatuses {
+		if status.CanTransition(to) {
+			from = append(from, status)
+		}
+	}
+	return from
+}
+
+// Transition moves the job to status to. It returns an error wrapping
+// ErrInvalidTransition, and leaves the job unchanged, if the job's current
+// status doesn't allow the move.
+func (j *Job) Transition(to JobStatus) error {
+	if !j.Status.CanTransition(to) {
+		return fmt.Errorf("%w: job %s is %s, cannot become %s", ErrInvalidTransition, j.ID, j.Status, to)
+	}
+	j.Status = to
+	return nil
+}
@@ -0,0 +1,65 @@
+package types
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestTransition(t *testing.T) {
+	tests := []struct {
+		from, to JobStatus
+		allowed  bool
+	}{
+		{JobStatusPending, JobStatusProcessing, true},
+		{JobStatusRetrying, JobStatusProcessing, true},
+		{JobStatusProcessing, JobStatusCompleted, true},
+		{JobStatusProcessing, JobStatusPending, true},
+		{JobStatusScheduled, JobStatusProcessing, true},
+		{JobStatusProcessing, JobStatusScheduled, true},
+		{JobStatusRetrying, JobStatusCancelled, true},
+		{JobStatusProcessing, JobStatusCancelled, true},
+		{JobStatusPending, JobStatusExpired, true},
+		{JobStatusProcessing, JobStatusExpired, false},
+		{JobStatusExpired, JobStatusPending, false},
+		{JobStatusPending, JobStatusFailed, false},
+		{JobStatusPending, JobStatusCompleted, false},
+		{JobStatusCancelled, JobStatusPending, false},
+		{JobStatusCompleted, JobStatusFailed, false},
+		{JobStatusCompleted, JobStatusProcessing, false},
+		{JobStatusFailed, JobStatusRetrying, false},
+	}
+
+	for _, tt := range tests {
+		job := &Job{ID: "job-1", Status: tt.from}
+		err := job.Transition(tt.to)
+		if tt.allowed {
+			if err != nil || job.Status != tt.to {
+				t.Errorf("%s -> %s = %v, status %s; want allowed", tt.from, tt.to, err, job.Status)
+			}
+			continue
+		}
+		if !errors.Is(err, ErrInvalidTransition) || job.Status != tt.from {
+			t.Errorf("%s -> %s = %v, status %s; want ErrInvalidTransition", tt.from, tt.to, err, job.Status)
+		}
+	}
+}
+
+func TestStatusesInto(t *testing.T) {
+	want := []JobStatus{JobStatusScheduled, JobStatusPending, JobStatusRetrying}
+	if got := StatusesInto(JobStatusProcessing); !reflect.DeepEqual(got, want) {
+		t.Errorf("StatusesInto(processing) = %v, want %v", got, want)
+	}
+	if got := StatusesInto(JobStatusCompleted); !reflect.DeepEqual(got, []JobStatus{JobStatusProcessing}) {
+		t.Errorf("StatusesInto(completed) = %v, want [processing]", got)
+	}
+}
+
+func TestIsFinal(t *testing.T) {
+	for _, status := range jobStatuses {
+		final := status == JobStatusCompleted || status == JobStatusFailed || status == JobStatusCancelled || status == JobStatusExpired
+		if status.IsFinal() != final {
+			t.Errorf("%s.IsFinal() = %v, want %v", status, !final, final)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package types
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
@@ -22,10 +23,11 @@ func NewJob(req *JobRequest) *Job {
 	job := &Job{
 		ID:          GenerateJobID(),
 		Type:        req.Type,
+		Priority:    JobPriorityNormal,
 		Payload:     req.Payload,
 		Status:      JobStatusPending,
 		Attempts:    0,
-		MaxAttempts: 3, // Default to 3 attempts
+		MaxAttempts: DefaultJobTypes.For(req.Type).MaxAttempts,
 		CreatedAt:   now,
 		UpdatedAt:   now,
 		ScheduledAt: now,
@@ -36,16 +38,67 @@ func NewJob(req *JobRequest) *Job {
 		job.MaxAttempts = req.MaxAttempts
 	}
 
+	if req.Priority != "" {
+		job.Priority = req.Priority
+	}
+
 	// Override scheduled time if specified
 	if req.ScheduledAt != nil {
 		job.ScheduledAt = *req.ScheduledAt
+		if job.ScheduledAt.After(now) {
+			job.Status = JobStatusScheduled
+		}
 	}
 
+	// All jobs of a FIFO type share one affinity key, which runs them one
+	// at a time in order
+	job.AffinityKey = req.AffinityKey
+	if DefaultJobTypes.For(req.Type).IsFIFO() {
+		job.AffinityKey = FIFOAffinityKey
+	}
+	job.ExpiresAt = req.ExpiresAt
+	job.OnSuccess = req.OnSuccess
+	job.OnFailure = req.OnFailure
+
 	return job
 }
 
-// ValidateJobRequest validates a job request
+// NewFollowUpJob creates the job requested by spec when parent finishes
+// with the given outcome ("on_success" or "on_failure"). Its ID is derived
+// from the parent's, so a parent that finishes twice after a redelivery
+// gets the same follow-up.
+func NewFollowUpJob(parent *Job, outcome string, spec *JobRequest) *Job {
+	job := NewJob(spec)
+	job.ID = derivedJobID(parent.ID, outcome)
+	job.TenantID = parent.TenantID
+	job.ParentID = parent.ID
+	return job
+}
+
+// derivedJobID returns a job ID determined by the ID of whatever creates
+// the job and the reason it does
+func derivedJobID(ownerID, name string) string {
+	sum := sha256.Sum256([]byte(ownerID + "/" + name))
+	return hex.EncodeToString(sum[:16])
+}
+
+// FIFOAffinityKey is the affinity key of every job of a FIFO job type
+const FIFOAffinityKey = "fifo"
+
+// MaxAffinityKeyLength bounds the length of a job's affinity key
+const MaxAffinityKeyLength = 255
+
+// MaxFollowUpDepth bounds how many follow-ups can be chained after a job
+const MaxFollowUpDepth = 5
+
+// ValidateJobRequest validates a job request against the schema
+// registered for its job type in DefaultSchemas, along with any follow-ups
 func ValidateJobRequest(req *JobRequest) error {
+	return validateJobRequest(req, 0)
+}
+
+// validateJobRequest validates a request nested depth follow-ups into a chain
+func validateJobRequest(req *JobRequest, depth int) error {
 	if req.Type == "" {
 		return fmt.Errorf("job type is required")
 	}
@@ -54,115 +107,63 @@ func ValidateJobRequest(req *JobRequest) error {
 		return fmt.Errorf("job payload is required")
 	}
 
-	// Validate job type
-	switch req.Type {
-	case JobTypeEmail, JobTypeImageResize, JobTypeWebhook, JobTypeDataExport:
-		// Valid job types
-	default:
-		return fmt.Errorf("invalid job type: %s", req.Type)
+	if req.Priority != "" && !req.Priority.IsValid() {
+		return fmt.Errorf("invalid priority: %s", req.Priority)
 	}
 
-	// Validate payload structure based on job type
-	return validatePayloadStructure(req.Type, req.Payload)
-}
-
-// validatePayloadStructure validates that the payload matches the expected structure for the job type
-func validatePayloadStructure(jobType JobType, payload json.RawMessage) error {
-	switch jobType {
-	case JobTypeEmail:
-		var emailPayload EmailPayload
-		if err := json.Unmarshal(payload, &emailPayload); err != nil {
-			return fmt.Errorf("invalid email payload: %w", err)
-		}
-		if emailPayload.To == "" {
-			return fmt.Errorf("email 'to' field is required")
-		}
-		if emailPayload.Subject == "" {
-			return fmt.Errorf("email 'subject' field is required")
-		}
+	if len(req.AffinityKey) > MaxAffinityKeyLength {
+		return fmt.Errorf("affinity key is longer than %d characters", MaxAffinityKeyLength)
+	}
 
-	case JobTypeImageResize:
-		var imagePayload ImageResizePayload
-		if err := json.Unmarshal(payload, &imagePayload); err != nil {
-			return fmt.Errorf("invalid image resize payload: %w", err)
-		}
-		if imagePayload.ImageURL == "" {
-			return fmt.Errorf("image_url is required")
+	if req.ExpiresAt != nil {
+		if !req.ExpiresAt.After(time.Now()) {
+			return fmt.Errorf("expires_at is in the past")
 		}
-		if len(imagePayload.Sizes) == 0 {
-			return fmt.Errorf("at least one size is required")
+		if req.ScheduledAt != nil && !req.ExpiresAt.After(*req.ScheduledAt) {
+			return fmt.Errorf("expires_at must be after scheduled_at")
 		}
+	}
 
-	case JobTypeWebhook:
-		var webhookPayload WebhookPayload
-		if err := json.Unmarshal(payload, &webhookPayload); err != nil {
-			return fmt.Errorf("invalid webhook payload: %w", err)
-		}
-		if webhookPayload.URL == "" {
-			return fmt.Errorf("webhook URL is required")
-		}
-		if webhookPayload.Method == "" {
-			webhookPayload.Method = "POST" // Default to POST
-		}
+	if err := DefaultSchemas.Validate(req.Type, req.Payload); err != nil {
+		return err
+	}
 
-	case JobTypeDataExport:
-		var exportPayload DataExportPayload
-		if err := json.Unmarshal(payload, &exportPayload); err != nil {
+	// Check what the schema can't express before the job is queued
+	if req.Type == JobTypeDataExport {
+		var payload DataExportPayload
+		if err := json.Unmarshal(req.Payload, &payload); err != nil {
 			return fmt.Errorf("invalid data export payload: %w", err)
 		}
-		if exportPayload.ExportType == "" {
-			return fmt.Errorf("export_type is required")
+		if _, err := ParseExportQuery(payload.Query, payload.Params); err != nil {
+			return fmt.Errorf("invalid data export payload: %w", err)
 		}
-		if exportPayload.Query == "" {
-			return fmt.Errorf("query is required")
+		if _, err := ParseExportSpec(payload); err != nil {
+			return fmt.Errorf("invalid data export payload: %w", err)
 		}
 	}
 
-	return nil
-}
-
-// IsRetryableError determines if an error should trigger a job retry
-func IsRetryableError(err error) bool {
-	if err == nil {
-		return false
+	if !DefaultJobTypes.Enabled(req.Type) {
+		return fmt.Errorf("%w: %s", ErrJobTypeDisabled, req.Type)
 	}
 
-	errorString := err.Error()
-
-	// Network-related errors are usually retryable
-	retryablePatterns := []string{
-		"connection refused",
-		"timeout",
-		"temporary failure",
-		"network is unreachable",
-		"no route to host",
-		"connection reset",
+	follows := []struct {
+		outcome string
+		req     *JobRequest
+	}{
+		{"on_success", req.OnSuccess},
+		{"on_failure", req.OnFailure},
 	}
-
-	for _, pattern := range retryablePatterns {
-		if contains(errorString, pattern) {
-			return true
+	for _, follow := range follows {
+		if follow.req == nil {
+			continue
 		}
-	}
-
-	return false
-}
-
-// contains checks if a string contains a substring (case-insensitive)
-func contains(s, substr string) bool {
-	return len(s) >= len(substr) &&
-		(s == substr ||
-			(len(s) > len(substr) &&
-				(s[:len(substr)] == substr ||
-					s[len(s)-len(substr):] == substr ||
-					hasSubstring(s, substr))))
-}
-
-func hasSubstring(s, substr string) bool {
-	for i := 0; i <= len(s)-len(substr); i++ {
-		if s[i:i+len(substr)] == substr {
-			return true
+		if depth >= MaxFollowUpDepth {
+			return fmt.Errorf("follow-up jobs can be chained at most %d deep", MaxFollowUpDepth)
+		}
+		if err := validateJobRequest(follow.req, depth+1); err != nil {
+			return fmt.Errorf("%s: %w", follow.outcome, err)
 		}
 	}
-	return false
+
+	return nil
 }
@@ -2,6 +2,7 @@ package types
 
 import (
 	"encoding/json"
+	"strings"
 	"testing"
 	"time"
 )
@@ -25,6 +26,7 @@ func TestNewJob(t *testing.T) {
 		Type:        JobTypeEmail,
 		Payload:     payload,
 		MaxAttempts: 5,
+		AffinityKey: "customer-42",
 	}
 
 	job := NewJob(req)
@@ -48,6 +50,10 @@ func TestNewJob(t *testing.T) {
 	if job.ID == "" {
 		t.Error("Expected non-empty job ID")
 	}
+
+	if job.AffinityKey != "customer-42" {
+		t.Errorf("Expected affinity key customer-42, got %q", job.AffinityKey)
+	}
 }
 
 func TestNewJobWithScheduledTime(t *testing.T) {
@@ -68,6 +74,8 @@ func TestNewJobWithScheduledTime(t *testing.T) {
 }
 
 func TestValidateJobRequest(t *testing.T) {
+	past, soon, later := time.Now().Add(-time.Minute), time.Now().Add(time.Minute), time.Now().Add(time.Hour)
+
 	tests := []struct {
 		name    string
 		request *JobRequest
@@ -81,6 +89,22 @@ func TestValidateJobRequest(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name: "templated email job",
+			request: &JobRequest{
+				Type:    JobTypeEmail,
+				Payload: json.RawMessage(`{"to": "test@example.com", "template": "welcome", "variables": {"name": "Ada"}}`),
+			},
+			wantErr: false,
+		},
+		{
+			name: "email job with neither subject nor template",
+			request: &JobRequest{
+				Type:    JobTypeEmail,
+				Payload: json.RawMessage(`{"to": "test@example.com", "body": "Test body"}`),
+			},
+			wantErr: true,
+		},
 		{
 			name: "missing job type",
 			request: &JobRequest{
@@ -151,66 +175,148 @@ func TestValidateJobRequest(t *testing.T) {
 			},
 			wantErr: true,
 		},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			err := ValidateJobRequest(tt.request)
-			if (err != nil) != tt.wantErr {
-				t.Errorf("ValidateJobRequest() error = %v, wantErr %v", err, tt.wantErr)
-			}
-		})
-	}
-}
-
-func TestIsRetryableError(t *testing.T) {
-	tests := []struct {
-		name     string
-		err      error
-		expected bool
-	}{
 		{
-			name:     "nil error",
-			err:      nil,
-			expected: false,
+			name: "valid high priority job",
+			request: &JobRequest{
+				Type:     JobTypeEmail,
+				Priority: JobPriorityHigh,
+				Payload:  json.RawMessage(`{"to": "test@example.com", "subject": "Test", "body": "Test body"}`),
+			},
+			wantErr: false,
+		},
+		{
+			name: "invalid priority",
+			request: &JobRequest{
+				Type:     JobTypeEmail,
+				Priority: JobPriority("urgent"),
+				Payload:  json.RawMessage(`{"to": "test@example.com", "subject": "Test", "body": "Test body"}`),
+			},
+			wantErr: true,
+		},
+		{
+			name: "affinity key",
+			request: &JobRequest{
+				Type:        JobTypeEmail,
+				AffinityKey: "customer-42",
+				Payload:     json.RawMessage(`{"to": "test@example.com", "subject": "Test", "body": "Test body"}`),
+			},
+			wantErr: false,
+		},
+		{
+			name: "affinity key too long",
+			request: &JobRequest{
+				Type:        JobTypeEmail,
+				AffinityKey: strings.Repeat("k", MaxAffinityKeyLength+1),
+				Payload:     json.RawMessage(`{"to": "test@example.com", "subject": "Test", "body": "Test body"}`),
+			},
+			wantErr: true,
 		},
 		{
-			name:     "connection refused",
-			err:      &MockError{msg: "connection refused"},
-			expected: true,
+			name: "valid follow-up",
+			request: &JobRequest{
+				Type:    JobTypeWebhook,
+				Payload: json.RawMessage(`{"url": "https://example.com/hook"}`),
+				OnSuccess: &JobRequest{
+					Type:    JobTypeEmail,
+					Payload: json.RawMessage(`{"to": "test@example.com", "subject": "Done", "body": "Hook sent"}`),
+				},
+			},
+			wantErr: false,
 		},
 		{
-			name:     "timeout error",
-			err:      &MockError{msg: "timeout occurred"},
-			expected: true,
+			name: "invalid follow-up",
+			request: &JobRequest{
+				Type:    JobTypeWebhook,
+				Payload: json.RawMessage(`{"url": "https://example.com/hook"}`),
+				OnFailure: &JobRequest{
+					Type:    JobTypeEmail,
+					Payload: json.RawMessage(`{"subject": "Failed"}`),
+				},
+			},
+			wantErr: true,
 		},
 		{
-			name:     "network unreachable",
-			err:      &MockError{msg: "network is unreachable"},
-			expected: true,
+			name: "expiry",
+			request: &JobRequest{
+				Type:      JobTypeWebhook,
+				Payload:   json.RawMessage(`{"url": "https://example.com/hook"}`),
+				ExpiresAt: &soon,
+			},
+			wantErr: false,
 		},
 		{
-			name:     "non-retryable error",
-			err:      &MockError{msg: "invalid credentials"},
-			expected: false,
+			name: "expiry in the past",
+			request: &JobRequest{
+				Type:      JobTypeWebhook,
+				Payload:   json.RawMessage(`{"url": "https://example.com/hook"}`),
+				ExpiresAt: &past,
+			},
+			wantErr: true,
+		},
+		{
+			name: "expiry before the scheduled time",
+			request: &JobRequest{
+				Type:        JobTypeWebhook,
+				Payload:     json.RawMessage(`{"url": "https://example.com/hook"}`),
+				ScheduledAt: &later,
+				ExpiresAt:   &soon,
+			},
+			wantErr: true,
+		},
+		{
+			name:    "follow-ups chained too deep",
+			request: chainRequest(MaxFollowUpDepth + 1),
+			wantErr: true,
+		},
+		{
+			name:    "follow-ups chained to the limit",
+			request: chainRequest(MaxFollowUpDepth),
+			wantErr: false,
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result := IsRetryableError(tt.err)
-			if result != tt.expected {
-				t.Errorf("IsRetryableError() = %v, expected %v", result, tt.expected)
+			err := ValidateJobRequest(tt.request)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateJobRequest() error = %v, wantErr %v", err, tt.wantErr)
 			}
 		})
 	}
 }
 
-// MockError is a simple error implementation for testing
-type MockError struct {
-	msg string
+// chainRequest builds a webhook request with depth follow-ups chained after it
+func chainRequest(depth int) *JobRequest {
+	req := &JobRequest{
+		Type:    JobTypeWebhook,
+		Payload: json.RawMessage(`{"url": "https://example.com/hook"}`),
+	}
+	if depth > 0 {
+		req.OnSuccess = chainRequest(depth - 1)
+	}
+	return req
 }
 
-func (e *MockError) Error() string {
-	return e.msg
+func TestNewFollowUpJob(t *testing.T) {
+	parent := NewJob(chainRequest(1))
+	parent.TenantID = "acme"
+
+	job := NewFollowUpJob(parent, "on_success", parent.OnSuccess)
+
+	if job.ParentID != parent.ID {
+		t.Errorf("Expected parent ID %s, got %s", parent.ID, job.ParentID)
+	}
+	if job.TenantID != "acme" {
+		t.Errorf("Expected tenant acme, got %s", job.TenantID)
+	}
+	if len(job.ID) != 32 {
+		t.Errorf("Expected job ID length 32, got %d", len(job.ID))
+	}
+
+	if again := NewFollowUpJob(parent, "on_success", parent.OnSuccess); again.ID != job.ID {
+		t.Errorf("Expected the same follow-up ID, got %s and %s", job.ID, again.ID)
+	}
+	if other := NewFollowUpJob(parent, "on_failure", parent.OnSuccess); other.ID == job.ID {
+		t.Error("Expected different IDs for different outcomes")
+	}
 }
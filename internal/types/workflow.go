@@ -0,0 +1,574 @@
+package types
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// WorkflowStatus represents the current state of a workflow
+type WorkflowStatus string
+
+const (
+	WorkflowStatusRunning      WorkflowStatus = "running"
+	WorkflowStatusCompensating WorkflowStatus = "compensating" // Failed, rolling back completed steps
+	WorkflowStatusCompleted    WorkflowStatus = "completed"
+	WorkflowStatusFailed       WorkflowStatus = "failed"
+)
+
+// StepStatus represents the current state of a workflow step
+type StepStatus string
+
+const (
+	StepStatusPending   StepStatus = "pending"
+	StepStatusRunning   StepStatus = "running"
+	StepStatusCompleted StepStatus = "completed"
+	StepStatusFailed    StepStatus = "failed"
+	StepStatusSkipped   StepStatus = "skipped" // Never ran because the workflow failed
+)
+
+// MaxWorkflowSteps bounds the number of steps in a workflow
+const MaxWorkflowSteps = 100
+
+// MaxFanOut bounds the number of jobs a fan-out step runs
+const MaxFanOut = 1000
+
+// Workflow is a set of jobs run in dependency order. Each step's job is
+// queued once every step it depends on has completed; if a step fails for
+// good the workflow fails and steps that haven't started are skipped.
+//
+// A failing workflow first waits for its running steps, then rolls back:
+// the compensating jobs of completed steps run one at a time, in the
+// reverse of the order the steps completed. If a compensating job fails
+// for good, the remaining ones are skipped.
+type Workflow struct {
+	ID          string         `json:"id"`
+	TenantID    string         `json:"tenant_id,omitempty"`
+	Name        string         `json:"name,omitempty"`
+	Status      WorkflowStatus `json:"status"`
+	Steps       []WorkflowStep `json:"steps"`
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+	CompletedAt *time.Time     `json:"completed_at,omitempty"`
+}
+
+// WorkflowStep is one job of a workflow. The job is described by the
+// embedded request and created when the step starts.
+//
+// A fan-out step instead runs one job per payload in FanOut, all at once.
+// It completes when every job has completed and fails as soon as one fails
+// for good, so a step depending on it acts as a reducer over its results.
+type WorkflowStep struct {
+	Name      string   `json:"name"`
+	DependsOn []string `json:"depends_on,omitempty"`
+	JobRequest
+	FanOut []json.RawMessage `json:"fan_out,omitempty"`
+
+	// Compensate undoes the step's side effects if the workflow fails
+	// after the step completed
+	Compensate *JobRequest `json:"compensate,omitempty"`
+
+	Status       StepStatus `json:"status"`
+	JobID        string     `json:"job_id,omitempty"`
+	Jobs         []StepJob  `json:"jobs,omitempty"` // The jobs of a fan-out step, in payload order
+	CompletedAt  *time.Time `json:"completed_at,omitempty"`
+	Compensation *StepJob   `json:"compensation,omitempty"` // Set once the compensating job starts or is skipped
+}
+
+// StepJob is one job of a fan-out step, or a step's compensating job
+type StepJob struct {
+	ID     string     `json:"id"`
+	Status StepStatus `json:"status"`
+}
+
+// WorkflowRequest represents a request to create a new workflow. Steps
+// that name no dependencies run at once, unless no step names any, in
+// which case the steps run one after another in the order given.
+type WorkflowRequest struct {
+	Name  string         `json:"name,omitempty"`
+	Steps []WorkflowStep `json:"steps"`
+}
+
+// WorkflowProgress counts a workflow's steps, or a fan-out step's jobs, by
+// status
+type WorkflowProgress struct {
+	Total     int `json:"total"`
+	Pending   int `json:"pending"`
+	Running   int `json:"running"`
+	Completed int `json:"completed"`
+	Failed    int `json:"failed"`
+	Skipped   int `json:"skipped"`
+}
+
+// WorkflowResponse represents the response when creating or querying a
+// workflow. FanOut holds the progress of each fan-out step.
+type WorkflowResponse struct {
+	Workflow *Workflow                   `json:"workflow"`
+	Progress WorkflowProgress            `json:"progress"`
+	FanOut   map[string]WorkflowProgress `json:"fan_out,omitempty"`
+	Message  string                      `json:"message,omitempty"`
+}
+
+// NewWorkflowResponse builds the response describing wf
+func NewWorkflowResponse(wf *Workflow, message string) *WorkflowResponse {
+	response := &WorkflowResponse{
+		Workflow: wf,
+		Progress: wf.Progress(),
+		Message:  message,
+	}
+
+	for _, step := range wf.Steps {
+		if len(step.FanOut) == 0 {
+			continue
+		}
+		if response.FanOut == nil {
+			response.FanOut = make(map[string]WorkflowProgress)
+		}
+		response.FanOut[step.Name] = step.Progress()
+	}
+
+	return response
+}
+
+// Tenant returns the workflow's tenant
+func (wf *Workflow) Tenant() string {
+	if wf.TenantID == "" {
+		return DefaultTenantID
+	}
+	return wf.TenantID
+}
+
+// Progress counts the workflow's steps by status
+func (wf *Workflow) Progress() WorkflowProgress {
+	progress := WorkflowProgress{}
+	for _, step := range wf.Steps {
+		progress.count(step.Status)
+	}
+	return progress
+}
+
+// Progress counts a fan-out step's jobs by status. Jobs that haven't been
+// created yet count as pending, or skipped if the step was skipped.
+func (step *WorkflowStep) Progress() WorkflowProgress {
+	progress := WorkflowProgress{}
+	if len(step.Jobs) == 0 {
+		for range step.FanOut {
+			progress.count(step.Status)
+		}
+		return progress
+	}
+
+	for _, job := range step.Jobs {
+		progress.count(job.Status)
+	}
+	return progress
+}
+
+// count adds one step or job with the given status
+func (p *WorkflowProgress) count(status StepStatus) {
+	p.Total++
+	switch status {
+	case StepStatusPending:
+		p.Pending++
+	case StepStatusRunning:
+		p.Running++
+	case StepStatusCompleted:
+		p.Completed++
+	case StepStatusFailed:
+		p.Failed++
+	case StepStatusSkipped:
+		p.Skipped++
+	}
+}
+
+// NewWorkflow creates a new workflow from a validated request
+func NewWorkflow(req *WorkflowRequest) *Workflow {
+	now := time.Now()
+
+	wf := &Workflow{
+		ID:        GenerateJobID(),
+		Name:      req.Name,
+		Status:    WorkflowStatusRunning,
+		Steps:     make([]WorkflowStep, len(req.Steps)),
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	ordered := true
+	for _, step := range req.Steps {
+		if len(step.DependsOn) > 0 {
+			ordered = false
+		}
+	}
+
+	for i, step := range req.Steps {
+		step.Status = StepStatusPending
+		step.JobID = ""
+		step.Jobs = nil
+		step.CompletedAt = nil
+		step.Compensation = nil
+		if ordered && i > 0 {
+			step.DependsOn = []string{req.Steps[i-1].Name}
+		}
+		wf.Steps[i] = step
+	}
+
+	return wf
+}
+
+// StepJobs creates the jobs that run a step: one, or one per payload of a
+// fan-out step. Their IDs are derived from the workflow's, so starting the
+// step again finds the same jobs.
+func (wf *Workflow) StepJobs(step *WorkflowStep) []*Job {
+	if len(step.FanOut) == 0 {
+		return []*Job{wf.stepJob(step, &step.JobRequest, step.Payload, stepJobID(wf, step, -1))}
+	}
+
+	jobs := make([]*Job, len(step.FanOut))
+	for i, payload := range step.FanOut {
+		jobs[i] = wf.stepJob(step, &step.JobRequest, payload, stepJobID(wf, step, i))
+	}
+	return jobs
+}
+
+// CompensationJob creates the compensating job of a step. Its ID is
+// derived from the workflow's like those of StepJobs.
+func (wf *Workflow) CompensationJob(step *WorkflowStep) *Job {
+	return wf.stepJob(step, step.Compensate, step.Compensate.Payload, compensationJobID(wf, step))
+}
+
+// ActiveJobs creates the jobs of every running step and every running
+// compensation, which should all exist
+func (wf *Workflow) ActiveJobs() []*Job {
+	var jobs []*Job
+	for i := range wf.Steps {
+		step := &wf.Steps[i]
+		if step.Status == StepStatusRunning {
+			jobs = append(jobs, wf.StepJobs(step)...)
+		}
+		if step.Compensation != nil && step.Compensation.Status == StepStatusRunning {
+			jobs = append(jobs, wf.CompensationJob(step))
+		}
+	}
+	return jobs
+}
+
+// stepJob creates a job of a step from req with the given payload
+func (wf *Workflow) stepJob(step *WorkflowStep, req *JobRequest, payload json.RawMessage, id string) *Job {
+	spec := *req
+	spec.Payload = payload
+
+	job := NewJob(&spec)
+	job.ID = id
+	job.TenantID = wf.TenantID
+	job.WorkflowID = wf.ID
+	job.WorkflowStep = step.Name
+	return job
+}
+
+// stepJobID returns the ID of a step's job, or of its i-th job for a
+// fan-out step
+func stepJobID(wf *Workflow, step *WorkflowStep, i int) string {
+	if i < 0 {
+		return derivedJobID(wf.ID, step.Name)
+	}
+	return derivedJobID(wf.ID, fmt.Sprintf("%s/%d", step.Name, i))
+}
+
+// compensationJobID returns the ID of a step's compensating job
+func compensationJobID(wf *Workflow, step *WorkflowStep) string {
+	return derivedJobID(wf.ID, step.Name+"/compensate")
+}
+
+// Step returns the step with the given name, or nil
+func (wf *Workflow) Step(name string) *WorkflowStep {
+	for i := range wf.Steps {
+		if wf.Steps[i].Name == name {
+			return &wf.Steps[i]
+		}
+	}
+	return nil
+}
+
+// RecordJob updates the step run, or compensated, by a job that has
+// finished: completed, failed with no attempts left, or cancelled or
+// expired, which fails the step
+func (wf *Workflow) RecordJob(job *Job) {
+	step := wf.Step(job.WorkflowStep)
+	if step == nil {
+		return
+	}
+
+	var status StepStatus
+	switch job.Status {
+	case JobStatusCompleted:
+		status = StepStatusCompleted
+	case JobStatusFailed, JobStatusCancelled, JobStatusExpired:
+		status = StepStatusFailed
+	default:
+		return
+	}
+
+	if step.Compensation != nil && step.Compensation.ID == job.ID {
+		if step.Compensation.Status == StepStatusRunning {
+			step.Compensation.Status = status
+		}
+		return
+	}
+
+	if len(step.Jobs) == 0 {
+		if step.Status == StepStatusRunning {
+			step.setStatus(status)
+		}
+		return
+	}
+
+	// A fan-out step's jobs keep being tracked after the step has failed
+	for i := range step.Jobs {
+		if step.Jobs[i].ID == job.ID && step.Jobs[i].Status == StepStatusRunning {
+			step.Jobs[i].Status = status
+		}
+	}
+	if step.Status != StepStatusRunning {
+		return
+	}
+
+	progress := step.Progress()
+	switch {
+	case progress.Failed > 0:
+		step.setStatus(StepStatusFailed)
+	case progress.Completed == progress.Total:
+		step.setStatus(StepStatusCompleted)
+	}
+}
+
+// setStatus moves a running step to its final status
+func (step *WorkflowStep) setStatus(status StepStatus) {
+	step.Status = status
+	if status == StepStatusCompleted {
+		now := time.Now()
+		step.CompletedAt = &now
+	}
+}
+
+// Advance starts every pending step whose dependencies have completed and
+// settles the workflow's status, returning the steps it started. Once a
+// step has failed no more steps start and pending ones are skipped; when
+// no step is left running, the next compensation starts.
+func (wf *Workflow) Advance(now time.Time) []*WorkflowStep {
+	if wf.Status != WorkflowStatusRunning && wf.Status != WorkflowStatusCompensating {
+		return nil
+	}
+	wf.UpdatedAt = now
+
+	failed := false
+	for _, step := range wf.Steps {
+		if step.Status == StepStatusFailed {
+			failed = true
+		}
+	}
+
+	var started []*WorkflowStep
+	if failed {
+		for i := range wf.Steps {
+			if wf.Steps[i].Status == StepStatusPending {
+				wf.Steps[i].Status = StepStatusSkipped
+			}
+		}
+	} else {
+		for i := range wf.Steps {
+			step := &wf.Steps[i]
+			if step.Status == StepStatusPending && wf.ready(step) {
+				step.Status = StepStatusRunning
+				if len(step.FanOut) == 0 {
+					step.JobID = stepJobID(wf, step, -1)
+				} else {
+					step.Jobs = make([]StepJob, len(step.FanOut))
+					for j := range step.FanOut {
+						step.Jobs[j] = StepJob{ID: stepJobID(wf, step, j), Status: StepStatusRunning}
+					}
+				}
+				started = append(started, step)
+			}
+		}
+	}
+
+	progress := wf.Progress()
+	if progress.Running > 0 || progress.Pending > 0 {
+		return started
+	}
+	if failed {
+		if step := wf.compensate(); step != nil {
+			wf.Status = WorkflowStatusCompensating
+			return append(started, step)
+		}
+		wf.Status = WorkflowStatusFailed
+	} else {
+		wf.Status = WorkflowStatusCompleted
+	}
+	wf.CompletedAt = &now
+	return started
+}
+
+// compensate moves the rollback of a failed workflow along. It returns the
+// step whose compensation is running, starting the next one if none is,
+// or nil once there's nothing left to compensate.
+func (wf *Workflow) compensate() *WorkflowStep {
+	var next *WorkflowStep
+	abandoned := false
+	for _, step := range wf.compensationOrder() {
+		switch {
+		case step.Compensation == nil:
+			if abandoned {
+				step.Compensation = &StepJob{ID: compensationJobID(wf, step), Status: StepStatusSkipped}
+			} else if next == nil {
+				next = step
+			}
+		case step.Compensation.Status == StepStatusRunning:
+			return step
+		case step.Compensation.Status == StepStatusFailed:
+			abandoned = true
+		}
+	}
+
+	if abandoned || next == nil {
+		return nil
+	}
+
+	next.Compensation = &StepJob{ID: compensationJobID(wf, next), Status: StepStatusRunning}
+	return next
+}
+
+// compensationOrder returns the completed steps that have a compensating
+// job, most recently completed first. Steps that completed at the same time
+// are taken last defined first.
+func (wf *Workflow) compensationOrder() []*WorkflowStep {
+	var steps []*WorkflowStep
+	for i := len(wf.Steps) - 1; i >= 0; i-- {
+		step := &wf.Steps[i]
+		if step.Status == StepStatusCompleted && step.Compensate != nil {
+			steps = append(steps, step)
+		}
+	}
+
+	sort.SliceStable(steps, func(i, j int) bool {
+		a, b := steps[i].CompletedAt, steps[j].CompletedAt
+		if a == nil || b == nil {
+			return false
+		}
+		return a.After(*b)
+	})
+	return steps
+}
+
+// ready reports whether every dependency of step has completed
+func (wf *Workflow) ready(step *WorkflowStep) bool {
+	for _, name := range step.DependsOn {
+		if dep := wf.Step(name); dep == nil || dep.Status != StepStatusCompleted {
+			return false
+		}
+	}
+	return true
+}
+
+// ValidateWorkflowRequest checks that a workflow's steps are valid jobs
+// with unique names and that their dependencies form an acyclic graph
+func ValidateWorkflowRequest(req *WorkflowRequest) error {
+	if len(req.Steps) == 0 {
+		return fmt.Errorf("workflow needs at least one step")
+	}
+	if len(req.Steps) > MaxWorkflowSteps {
+		return fmt.Errorf("workflow has %d steps, maximum is %d", len(req.Steps), MaxWorkflowSteps)
+	}
+
+	steps := make(map[string]*WorkflowStep, len(req.Steps))
+	for i := range req.Steps {
+		step := &req.Steps[i]
+		if step.Name == "" {
+			return fmt.Errorf("step %d: name is required", i+1)
+		}
+		if _, ok := steps[step.Name]; ok {
+			return fmt.Errorf("duplicate step name: %s", step.Name)
+		}
+		steps[step.Name] = step
+
+		if step.OnSuccess != nil || step.OnFailure != nil {
+			return fmt.Errorf("step %s: use depends_on instead of follow-up jobs", step.Name)
+		}
+		if err := validateStepJobs(step); err != nil {
+			return fmt.Errorf("step %s: %w", step.Name, err)
+		}
+		if step.Compensate != nil {
+			if step.Compensate.OnSuccess != nil || step.Compensate.OnFailure != nil {
+				return fmt.Errorf("step %s: compensate: compensating jobs can't have follow-up jobs", step.Name)
+			}
+			if err := ValidateJobRequest(step.Compensate); err != nil {
+				return fmt.Errorf("step %s: compensate: %w", step.Name, err)
+			}
+		}
+	}
+
+	for _, step := range req.Steps {
+		for _, dep := range step.DependsOn {
+			if _, ok := steps[dep]; !ok {
+				return fmt.Errorf("step %s depends on unknown step %s", step.Name, dep)
+			}
+		}
+	}
+
+	// Depth-first search for cycles
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	state := make(map[string]int, len(steps))
+	var visit func(name string) error
+	visit = func(name string) error {
+		switch state[name] {
+		case visiting:
+			return fmt.Errorf("steps depend on each other in a cycle through %s", name)
+		case visited:
+			return nil
+		}
+		state[name] = visiting
+		for _, dep := range steps[name].DependsOn {
+			if err := visit(dep); err != nil {
+				return err
+			}
+		}
+		state[name] = visited
+		return nil
+	}
+	for _, step := range req.Steps {
+		if err := visit(step.Name); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// validateStepJobs validates the job request of a step, once per payload
+// for a fan-out step
+func validateStepJobs(step *WorkflowStep) error {
+	if len(step.FanOut) == 0 {
+		return ValidateJobRequest(&step.JobRequest)
+	}
+
+	if len(step.Payload) > 0 {
+		return fmt.Errorf("give either payload or fan_out, not both")
+	}
+	if len(step.FanOut) > MaxFanOut {
+		return fmt.Errorf("fan_out has %d payloads, maximum is %d", len(step.FanOut), MaxFanOut)
+	}
+
+	for i, payload := range step.FanOut {
+		req := step.JobRequest
+		req.Payload = payload
+		if err := ValidateJobRequest(&req); err != nil {
+			return fmt.Errorf("fan_out %d: %w", i, err)
+		}
+	}
+	return nil
+}
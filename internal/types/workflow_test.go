@@ -0,0 +1,291 @@
+package types
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+// workflowStep builds a webhook step depending on the named steps
+func workflowStep(name string, dependsOn ...string) WorkflowStep {
+	return WorkflowStep{
+		Name:      name,
+		DependsOn: dependsOn,
+		JobRequest: JobRequest{
+			Type:    JobTypeWebhook,
+			Payload: json.RawMessage(`{"url": "https://example.com/` + name + `"}`),
+		},
+	}
+}
+
+// stepNames returns the names of steps
+func stepNames(steps []*WorkflowStep) []string {
+	var names []string
+	for _, step := range steps {
+		names = append(names, step.Name)
+	}
+	return names
+}
+
+// finishStep records the outcome of a running step's job
+func finishStep(wf *Workflow, name string, status JobStatus) {
+	wf.RecordJob(&Job{WorkflowID: wf.ID, WorkflowStep: name, Status: status})
+}
+
+func TestWorkflowRunsStepsInOrder(t *testing.T) {
+	wf := NewWorkflow(&WorkflowRequest{
+		Steps: []WorkflowStep{workflowStep("export"), workflowStep("notify"), workflowStep("cleanup")},
+	})
+
+	for _, name := range []string{"export", "notify", "cleanup"} {
+		started := wf.Advance(time.Now())
+		if len(started) != 1 || started[0].Name != name {
+			t.Fatalf("Expected %s to start, got %v", name, stepNames(started))
+		}
+		if started[0].JobID != wf.StepJobs(started[0])[0].ID {
+			t.Errorf("Expected step %s to record its job ID", name)
+		}
+		finishStep(wf, name, JobStatusCompleted)
+	}
+
+	if started := wf.Advance(time.Now()); len(started) != 0 {
+		t.Errorf("Expected no more steps, got %v", stepNames(started))
+	}
+	if wf.Status != WorkflowStatusCompleted {
+		t.Errorf("Expected workflow completed, got %s", wf.Status)
+	}
+	if wf.CompletedAt == nil {
+		t.Error("Expected completion time to be set")
+	}
+}
+
+func TestWorkflowRunsIndependentStepsTogether(t *testing.T) {
+	wf := NewWorkflow(&WorkflowRequest{
+		Steps: []WorkflowStep{
+			workflowStep("small"),
+			workflowStep("large"),
+			workflowStep("publish", "small", "large"),
+		},
+	})
+
+	if started := wf.Advance(time.Now()); len(started) != 2 {
+		t.Fatalf("Expected both resize steps to start, got %v", stepNames(started))
+	}
+
+	finishStep(wf, "small", JobStatusCompleted)
+	if started := wf.Advance(time.Now()); len(started) != 0 {
+		t.Fatalf("Expected publish to wait for large, got %v", stepNames(started))
+	}
+
+	finishStep(wf, "large", JobStatusCompleted)
+	if started := wf.Advance(time.Now()); len(started) != 1 || started[0].Name != "publish" {
+		t.Fatalf("Expected publish to start, got %v", stepNames(started))
+	}
+}
+
+func TestWorkflowFailureSkipsPendingSteps(t *testing.T) {
+	wf := NewWorkflow(&WorkflowRequest{
+		Steps: []WorkflowStep{
+			workflowStep("a"),
+			workflowStep("b"),
+			workflowStep("c", "a"),
+		},
+	})
+	wf.Advance(time.Now())
+
+	finishStep(wf, "a", JobStatusFailed)
+	if started := wf.Advance(time.Now()); len(started) != 0 {
+		t.Fatalf("Expected no steps to start after a failure, got %v", stepNames(started))
+	}
+	if wf.Step("c").Status != StepStatusSkipped {
+		t.Errorf("Expected c to be skipped, got %s", wf.Step("c").Status)
+	}
+	if wf.Status != WorkflowStatusRunning {
+		t.Errorf("Expected workflow to wait for b, got %s", wf.Status)
+	}
+
+	finishStep(wf, "b", JobStatusCompleted)
+	wf.Advance(time.Now())
+	if wf.Status != WorkflowStatusFailed {
+		t.Errorf("Expected workflow failed, got %s", wf.Status)
+	}
+
+	progress := wf.Progress()
+	if progress.Completed != 1 || progress.Failed != 1 || progress.Skipped != 1 {
+		t.Errorf("Unexpected progress: %+v", progress)
+	}
+}
+
+func TestValidateWorkflowRequest(t *testing.T) {
+	tests := []struct {
+		name    string
+		steps   []WorkflowStep
+		wantErr bool
+	}{
+		{"valid graph", []WorkflowStep{workflowStep("a"), workflowStep("b", "a")}, false},
+		{"no steps", nil, true},
+		{"missing name", []WorkflowStep{workflowStep("")}, true},
+		{"duplicate name", []WorkflowStep{workflowStep("a"), workflowStep("a")}, true},
+		{"unknown dependency", []WorkflowStep{workflowStep("a", "missing")}, true},
+		{"cycle", []WorkflowStep{workflowStep("a", "c"), workflowStep("b", "a"), workflowStep("c", "b")}, true},
+		{"invalid job", []WorkflowStep{{Name: "a", JobRequest: JobRequest{Type: JobTypeEmail, Payload: json.RawMessage(`{}`)}}}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateWorkflowRequest(&WorkflowRequest{Steps: tt.steps})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateWorkflowRequest() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestWorkflowFanOut(t *testing.T) {
+	resize := workflowStep("resize")
+	resize.Type = JobTypeImageResize
+	resize.Payload = nil
+	for _, url := range []string{"a", "b", "c"} {
+		resize.FanOut = append(resize.FanOut, json.RawMessage(`{"image_url": "https://example.com/`+url+`.jpg", "sizes": [100]}`))
+	}
+
+	req := &WorkflowRequest{Steps: []WorkflowStep{resize, workflowStep("reduce", "resize")}}
+	if err := ValidateWorkflowRequest(req); err != nil {
+		t.Fatalf("Expected valid fan-out workflow, got %v", err)
+	}
+	wf := NewWorkflow(req)
+
+	started := wf.Advance(time.Now())
+	if len(started) != 1 || started[0].Name != "resize" {
+		t.Fatalf("Expected resize to start, got %v", stepNames(started))
+	}
+
+	jobs := wf.StepJobs(started[0])
+	if len(jobs) != 3 {
+		t.Fatalf("Expected 3 jobs, got %d", len(jobs))
+	}
+	for i, job := range jobs {
+		if job.ID != wf.Step("resize").Jobs[i].ID {
+			t.Errorf("Expected job %d to be tracked by the step", i)
+		}
+		if string(job.Payload) != string(resize.FanOut[i]) {
+			t.Errorf("Expected job %d to get payload %d", i, i)
+		}
+	}
+
+	for _, job := range jobs[:2] {
+		job.Status = JobStatusCompleted
+		wf.RecordJob(job)
+	}
+	if started := wf.Advance(time.Now()); len(started) != 0 {
+		t.Fatalf("Expected reduce to wait for every job, got %v", stepNames(started))
+	}
+	if progress := wf.Step("resize").Progress(); progress.Completed != 2 || progress.Running != 1 {
+		t.Errorf("Unexpected fan-out progress: %+v", progress)
+	}
+
+	jobs[2].Status = JobStatusCompleted
+	wf.RecordJob(jobs[2])
+	if started := wf.Advance(time.Now()); len(started) != 1 || started[0].Name != "reduce" {
+		t.Fatalf("Expected reduce to start, got %v", stepNames(started))
+	}
+}
+
+func TestValidateFanOutStep(t *testing.T) {
+	step := workflowStep("resize")
+	step.FanOut = []json.RawMessage{json.RawMessage(`{"url": "https://example.com/a"}`)}
+	if err := ValidateWorkflowRequest(&WorkflowRequest{Steps: []WorkflowStep{step}}); err == nil {
+		t.Error("Expected payload and fan_out together to be rejected")
+	}
+
+	step.Payload = nil
+	step.FanOut = append(step.FanOut, json.RawMessage(`{"method": "GET"}`))
+	if err := ValidateWorkflowRequest(&WorkflowRequest{Steps: []WorkflowStep{step}}); err == nil {
+		t.Error("Expected invalid fan-out payload to be rejected")
+	}
+}
+
+func TestWorkflowCompensatesInReverseOrder(t *testing.T) {
+	reserve := workflowStep("reserve")
+	reserve.Compensate = &JobRequest{Type: JobTypeWebhook, Payload: json.RawMessage(`{"url": "https://example.com/release"}`)}
+	charge := workflowStep("charge")
+	charge.Compensate = &JobRequest{Type: JobTypeWebhook, Payload: json.RawMessage(`{"url": "https://example.com/refund"}`)}
+
+	req := &WorkflowRequest{Steps: []WorkflowStep{reserve, charge, workflowStep("ship")}}
+	if err := ValidateWorkflowRequest(req); err != nil {
+		t.Fatalf("Expected valid workflow, got %v", err)
+	}
+	wf := NewWorkflow(req)
+
+	wf.Advance(time.Now())
+	finishStep(wf, "reserve", JobStatusCompleted)
+	wf.Advance(time.Now())
+	finishStep(wf, "charge", JobStatusCompleted)
+	wf.Advance(time.Now())
+	finishStep(wf, "ship", JobStatusFailed)
+
+	for _, name := range []string{"charge", "reserve"} {
+		started := wf.Advance(time.Now())
+		if len(started) != 1 || started[0].Name != name {
+			t.Fatalf("Expected %s to be compensated, got %v", name, stepNames(started))
+		}
+		if wf.Status != WorkflowStatusCompensating {
+			t.Errorf("Expected workflow compensating, got %s", wf.Status)
+		}
+
+		jobs := wf.ActiveJobs()
+		if len(jobs) != 1 || jobs[0].ID != started[0].Compensation.ID {
+			t.Fatalf("Expected only the compensating job of %s to be active", name)
+		}
+		jobs[0].Status = JobStatusCompleted
+		wf.RecordJob(jobs[0])
+	}
+
+	wf.Advance(time.Now())
+	if wf.Status != WorkflowStatusFailed {
+		t.Errorf("Expected workflow failed once rolled back, got %s", wf.Status)
+	}
+	for _, name := range []string{"reserve", "charge"} {
+		if c := wf.Step(name).Compensation; c == nil || c.Status != StepStatusCompleted {
+			t.Errorf("Expected %s to be compensated, got %+v", name, c)
+		}
+	}
+}
+
+func TestWorkflowStopsCompensatingAfterFailure(t *testing.T) {
+	var steps []WorkflowStep
+	for _, name := range []string{"a", "b", "c"} {
+		step := workflowStep(name)
+		step.Compensate = &JobRequest{Type: JobTypeWebhook, Payload: json.RawMessage(`{"url": "https://example.com/undo"}`)}
+		steps = append(steps, step)
+	}
+	steps = append(steps, workflowStep("d"))
+	wf := NewWorkflow(&WorkflowRequest{Steps: steps})
+
+	for _, name := range []string{"a", "b", "c"} {
+		wf.Advance(time.Now())
+		finishStep(wf, name, JobStatusCompleted)
+	}
+	wf.Advance(time.Now())
+	finishStep(wf, "d", JobStatusFailed)
+
+	started := wf.Advance(time.Now())
+	if len(started) != 1 || started[0].Name != "c" {
+		t.Fatalf("Expected c to be compensated first, got %v", stepNames(started))
+	}
+	job := wf.CompensationJob(started[0])
+	job.Status = JobStatusFailed
+	wf.RecordJob(job)
+
+	if started := wf.Advance(time.Now()); len(started) != 0 {
+		t.Fatalf("Expected compensation to stop, got %v", stepNames(started))
+	}
+	if wf.Status != WorkflowStatusFailed {
+		t.Errorf("Expected workflow failed, got %s", wf.Status)
+	}
+	for _, name := range []string{"a", "b"} {
+		if c := wf.Step(name).Compensation; c == nil || c.Status != StepStatusSkipped {
+			t.Errorf("Expected compensation of %s to be skipped, got %+v", name, c)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package webhookauth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// tokenTimeout bounds a token request without a TLS client of its own
+	tokenTimeout = 30 * time.Second
+
+	// tokenExpiryMargin renews tokens this long before they expire, so
+	// one doesn't lapse on its way to the receiver
+	tokenExpiryMargin = 30 * time.Second
+
+	// defaultTokenTTL is how long a token is cached when the token
+	// endpoint doesn't say when it expires
+	defaultTokenTTL = 5 * time.Minute
+
+	// maxTokenResponse bounds the token endpoint's response
+	maxTokenResponse = 1 << 20
+)
+
+// tokenSource fetches access tokens with the client credentials grant and
+// caches them until shortly before they expire
+type tokenSource struct {
+	config OAuth2
+	client *http.Client
+
+	mu     sync.Mutex
+	token  string
+	expiry time.Time
+}
+
+// tokenResponse is the token endpoint's answer (RFC 6749, section 5.1)
+type tokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int64  `json:"expires_in"`
+}
+
+// Token returns a cached token, or fetches one. Concurrent callers wait
+// for a single fetch.
+func (t *tokenSource) Token(ctx context.Context) (string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.token != "" && time.Now().Before(t.expiry) {
+		return t.token, nil
+	}
+
+	resp, err := t.fetch(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	ttl := defaultTokenTTL
+	if resp.ExpiresIn > 0 {
+		ttl = time.Duration(resp.ExpiresIn)*time.Second - tokenExpiryMargin
+	}
+	t.token = resp.AccessToken
+	t.expiry = time.Now().Add(ttl)
+	return t.token, nil
+}
+
+func (t *tokenSource) invalidate() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.token = ""
+}
+
+func (t *tokenSource) fetch(ctx context.Context) (*tokenResponse, error) {
+	form := url.Values{"grant_type": {"client_credentials"}}
+	if len(t.config.Scopes) > 0 {
+		form.Set("scope", strings.Join(t.config.Scopes, " "))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.config.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create token request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(t.config.ClientID), url.QueryEscape(t.config.ClientSecret))
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch OAuth2 token: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxTokenResponse))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read OAuth2 token: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch OAuth2 token: token endpoint returned status %d", resp.StatusCode)
+	}
+
+	var token tokenResponse
+	if err := json.Unmarshal(data, &token); err != nil {
+		return nil, fmt.Errorf("invalid OAuth2 token response: %w", err)
+	}
+	if token.AccessToken == "" {
+		return nil, fmt.Errorf("invalid OAuth2 token response: access_token is missing")
+	}
+	if token.TokenType != "" && !strings.EqualFold(token.TokenType, "bearer") {
+		return nil, fmt.Errorf("unsupported OAuth2 token type %q", token.TokenType)
+	}
+	return &token, nil
+}
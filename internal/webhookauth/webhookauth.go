@@ -0,0 +1,236 @@
+// Package webhookauth authenticates webhook jobs to their receivers. It
+// signs request bodies with HMAC-SHA256, in the same format the API
+// verifies signed submissions in (see package signing), fetches OAuth2
+// access tokens with the client credentials grant, and presents TLS client
+// certificates.
+//
+// Credentials are configured by name, and a webhook payload picks them
+// with its "auth" field, so secrets stay out of job payloads.
+package webhookauth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"taskflow/internal/signing"
+	"time"
+)
+
+// ErrUnknownCredentials is returned for credentials that aren't configured
+var ErrUnknownCredentials = errors.New("unknown webhook credentials")
+
+// Credentials authenticate webhooks to one receiver. All parts are
+// optional and combine.
+type Credentials struct {
+	// SigningSecret signs request bodies, instead of the default secret
+	SigningSecret string `yaml:"signing_secret" toml:"signing_secret"`
+
+	OAuth2 *OAuth2 `yaml:"oauth2" toml:"oauth2"`
+	TLS    *TLS    `yaml:"tls" toml:"tls"`
+}
+
+// OAuth2 sends a bearer token fetched with the client credentials grant
+type OAuth2 struct {
+	TokenURL     string   `yaml:"token_url" toml:"token_url"`
+	ClientID     string   `yaml:"client_id" toml:"client_id"`
+	ClientSecret string   `yaml:"client_secret" toml:"client_secret"`
+	Scopes       []string `yaml:"scopes" toml:"scopes"`
+}
+
+// TLS presents a client certificate and optionally trusts a private CA
+type TLS struct {
+	CertFile string `yaml:"cert_file" toml:"cert_file"`
+	KeyFile  string `yaml:"key_file" toml:"key_file"`
+	CAFile   string `yaml:"ca_file" toml:"ca_file"` // empty trusts the system roots
+}
+
+// Validate checks named credentials without reading any files
+func Validate(credentials map[string]Credentials) error {
+	names := make([]string, 0, len(credentials))
+	for name := range credentials {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		creds := credentials[name]
+		if name == "" {
+			return fmt.Errorf("webhook credentials name cannot be empty")
+		}
+		if creds.SigningSecret == "" && creds.OAuth2 == nil && creds.TLS == nil {
+			return fmt.Errorf("webhook credentials %s: set signing_secret, oauth2 or tls", name)
+		}
+		if o := creds.OAuth2; o != nil {
+			if u, err := url.Parse(o.TokenURL); err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+				return fmt.Errorf("webhook credentials %s: oauth2 token_url must be an http or https URL", name)
+			}
+			if o.ClientID == "" {
+				return fmt.Errorf("webhook credentials %s: oauth2 client_id cannot be empty", name)
+			}
+		}
+		if t := creds.TLS; t != nil {
+			if (t.CertFile == "") != (t.KeyFile == "") {
+				return fmt.Errorf("webhook credentials %s: tls cert_file and key_file must be set together", name)
+			}
+			if t.CertFile == "" && t.CAFile == "" {
+				return fmt.Errorf("webhook credentials %s: tls needs cert_file and key_file, or ca_file", name)
+			}
+		}
+	}
+	return nil
+}
+
+// Authenticator applies credentials to webhook requests. A nil
+// Authenticator has no credentials and only signs with secrets passed to
+// Authenticate.
+type Authenticator struct {
+	secret      string
+	credentials map[string]*profile
+}
+
+// profile is a set of credentials ready for use
+type profile struct {
+	secret string
+	tls    *tls.Config  // nil without TLS
+	tokens *tokenSource // nil without OAuth2
+}
+
+// New creates an authenticator that signs with signingSecret by default,
+// which may be empty, and loads the certificates of credentials
+func New(signingSecret string, credentials map[string]Credentials) (*Authenticator, error) {
+	if err := Validate(credentials); err != nil {
+		return nil, err
+	}
+
+	a := &Authenticator{secret: signingSecret, credentials: make(map[string]*profile, len(credentials))}
+	for name, creds := range credentials {
+		p := &profile{secret: creds.SigningSecret}
+		if creds.TLS != nil {
+			config, err := tlsConfig(creds.TLS)
+			if err != nil {
+				return nil, fmt.Errorf("webhook credentials %s: %w", name, err)
+			}
+			p.tls = config
+		}
+		if creds.OAuth2 != nil {
+			// The token endpoint is configured, not user-supplied, so it is
+			// called directly, presenting the certificate if there is one
+			transport := http.DefaultTransport.(*http.Transport).Clone()
+			transport.TLSClientConfig = p.tls
+			client := &http.Client{Transport: transport, Timeout: tokenTimeout}
+			p.tokens = &tokenSource{config: *creds.OAuth2, client: client}
+		}
+		a.credentials[name] = p
+	}
+	return a, nil
+}
+
+// tlsConfig loads the configured certificate and CA
+func tlsConfig(t *TLS) (*tls.Config, error) {
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+	if t.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(t.CertFile, t.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	if t.CAFile != "" {
+		pem, err := os.ReadFile(t.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA file: %w", err)
+		}
+		roots := x509.NewCertPool()
+		if !roots.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in CA file %s", t.CAFile)
+		}
+		config.RootCAs = roots
+	}
+	return config, nil
+}
+
+// lookup returns the named credentials; no name means none
+func (a *Authenticator) lookup(name string) (*profile, error) {
+	if name == "" {
+		return nil, nil
+	}
+	if a != nil {
+		if p, ok := a.credentials[name]; ok {
+			return p, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", ErrUnknownCredentials, name)
+}
+
+// TLSConfig returns the TLS configuration presenting the named
+// credentials' certificate, or nil if they don't have one
+func (a *Authenticator) TLSConfig(name string) (*tls.Config, error) {
+	p, err := a.lookup(name)
+	if err != nil || p == nil {
+		return nil, err
+	}
+	return p.tls, nil
+}
+
+// Authenticate adds the named credentials' bearer token to req and signs
+// body, the request's body. secret, when set, signs instead of the
+// credentials' or the default secret.
+func (a *Authenticator) Authenticate(ctx context.Context, req *http.Request, body []byte, name, secret string) error {
+	p, err := a.lookup(name)
+	if err != nil {
+		return err
+	}
+
+	if p != nil && p.tokens != nil {
+		token, err := p.tokens.Token(ctx)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	if secret == "" && p != nil {
+		secret = p.secret
+	}
+	if secret == "" && a != nil {
+		secret = a.secret
+	}
+	if secret != "" {
+		Sign(req, body, secret, time.Now())
+	}
+	return nil
+}
+
+// Invalidate drops the cached token of the named credentials, so the next
+// request fetches a new one, and reports whether they use tokens. Call it
+// when the receiver rejects a token.
+func (a *Authenticator) Invalidate(name string) bool {
+	p, err := a.lookup(name)
+	if err != nil || p == nil || p.tokens == nil {
+		return false
+	}
+	p.tokens.invalidate()
+	return true
+}
+
+// Sign sets the signature headers of req for body, signed with secret at
+// now and a random nonce
+func Sign(req *http.Request, body []byte, secret string, now time.Time) {
+	random := make([]byte, 12)
+	rand.Read(random)
+	nonce := hex.EncodeToString(random)
+
+	timestamp := now.Unix()
+	req.Header.Set(signing.TimestampHeader, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(signing.NonceHeader, nonce)
+	req.Header.Set(signing.SignatureHeader, signing.Sign(secret, timestamp, nonce, body))
+}
@@ -0,0 +1,168 @@
+package webhookauth
+
+import (
+	"context"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"taskflow/internal/signing"
+	"testing"
+)
+
+func TestAuthenticateSigns(t *testing.T) {
+	ctx := context.Background()
+	body := []byte(`{"event":"paid"}`)
+
+	auth, err := New("default-secret", map[string]Credentials{
+		"billing": {SigningSecret: "billing-secret"},
+	})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	tests := []struct {
+		name, creds, secret, want string
+	}{
+		{"default secret", "", "", "default-secret"},
+		{"credentials' secret", "billing", "", "billing-secret"},
+		{"payload's secret", "billing", "job-secret", "job-secret"},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest(http.MethodPost, "https://example.com/hook", nil)
+		if err := auth.Authenticate(ctx, req, body, tt.creds, tt.secret); err != nil {
+			t.Fatalf("%s: Authenticate() error = %v", tt.name, err)
+		}
+
+		// Receivers can check webhooks as the API checks signed submissions
+		v := signing.NewVerifier(signing.NewMemoryNonceStore())
+		if err := v.Verify(ctx, tt.want, req.Header, body); err != nil {
+			t.Errorf("%s: Verify() error = %v", tt.name, err)
+		}
+	}
+
+	// Without any secret, requests go out unsigned
+	var none *Authenticator
+	req, _ := http.NewRequest(http.MethodPost, "https://example.com/hook", nil)
+	if err := none.Authenticate(ctx, req, body, "", ""); err != nil {
+		t.Fatalf("Authenticate() on nil error = %v", err)
+	}
+	if req.Header.Get(signing.SignatureHeader) != "" {
+		t.Error("request signed without a secret")
+	}
+	if err := none.Authenticate(ctx, req, body, "billing", ""); !errors.Is(err, ErrUnknownCredentials) {
+		t.Errorf("Authenticate() with unknown credentials error = %v, want ErrUnknownCredentials", err)
+	}
+}
+
+func TestOAuth2TokenCaching(t *testing.T) {
+	ctx := context.Background()
+
+	var fetches atomic.Int32
+	tokens := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, secret, _ := r.BasicAuth()
+		if id != "taskflow" || secret != "s3cret" || r.FormValue("grant_type") != "client_credentials" || r.FormValue("scope") != "hooks:write" {
+			http.Error(w, `{"error":"invalid_client"}`, http.StatusUnauthorized)
+			return
+		}
+		fetches.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"access_token":"token-1","token_type":"Bearer","expires_in":3600}`))
+	}))
+	defer tokens.Close()
+
+	auth, err := New("", map[string]Credentials{
+		"crm": {OAuth2: &OAuth2{TokenURL: tokens.URL, ClientID: "taskflow", ClientSecret: "s3cret", Scopes: []string{"hooks:write"}}},
+	})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		req, _ := http.NewRequest(http.MethodPost, "https://example.com/hook", nil)
+		if err := auth.Authenticate(ctx, req, nil, "crm", ""); err != nil {
+			t.Fatalf("Authenticate() error = %v", err)
+		}
+		if got := req.Header.Get("Authorization"); got != "Bearer token-1" {
+			t.Errorf("Authorization = %q, want the fetched token", got)
+		}
+	}
+	if got := fetches.Load(); got != 1 {
+		t.Errorf("token fetched %d times, want once while cached", got)
+	}
+
+	if !auth.Invalidate("crm") {
+		t.Error("Invalidate() = false for OAuth2 credentials")
+	}
+	req, _ := http.NewRequest(http.MethodPost, "https://example.com/hook", nil)
+	if err := auth.Authenticate(ctx, req, nil, "crm", ""); err != nil {
+		t.Fatalf("Authenticate() error = %v", err)
+	}
+	if got := fetches.Load(); got != 2 {
+		t.Errorf("token fetched %d times, want a new fetch after Invalidate", got)
+	}
+}
+
+func TestTLSConfig(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := os.WriteFile(caFile, ca, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	auth, err := New("", map[string]Credentials{"internal": {TLS: &TLS{CAFile: caFile}}})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	config, err := auth.TLSConfig("internal")
+	if err != nil {
+		t.Fatalf("TLSConfig() error = %v", err)
+	}
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: config}}
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("request trusting the private CA failed: %v", err)
+	}
+	resp.Body.Close()
+
+	if config, err := auth.TLSConfig(""); config != nil || err != nil {
+		t.Errorf("TLSConfig() without credentials = %v, %v; want nil", config, err)
+	}
+	if _, err := New("", map[string]Credentials{"broken": {TLS: &TLS{CAFile: filepath.Join(t.TempDir(), "missing.pem")}}}); err == nil {
+		t.Error("New() with a missing CA file succeeded")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := map[string]Credentials{
+		"empty":            {},
+		"no token url":     {OAuth2: &OAuth2{ClientID: "id"}},
+		"relative url":     {OAuth2: &OAuth2{TokenURL: "/token", ClientID: "id"}},
+		"no client id":     {OAuth2: &OAuth2{TokenURL: "https://auth.example.com/token"}},
+		"cert without key": {TLS: &TLS{CertFile: "client.pem"}},
+		"empty tls":        {TLS: &TLS{}},
+	}
+	for name, creds := range tests {
+		if err := Validate(map[string]Credentials{"target": creds}); err == nil {
+			t.Errorf("%s: Validate() succeeded, want an error", name)
+		}
+	}
+
+	valid := map[string]Credentials{
+		"signed": {SigningSecret: "secret"},
+		"oauth":  {OAuth2: &OAuth2{TokenURL: "https://auth.example.com/token", ClientID: "id"}},
+		"mtls":   {TLS: &TLS{CertFile: "client.pem", KeyFile: "client-key.pem"}},
+	}
+	if err := Validate(valid); err != nil {
+		t.Errorf("Validate() error = %v", err)
+	}
+}
@@ -0,0 +1,106 @@
+package worker
+
+import (
+	"context"
+	"log"
+	"taskflow/internal/types"
+)
+
+// watchControl applies commands sent through the remote control API.
+// Commands missed while disconnected are picked up from the control key,
+// which is read once here and again on every heartbeat.
+func (w *Worker) watchControl(ctx context.Context) {
+	w.pollControl(ctx)
+
+	commands := w.queue.SubscribeWorkerCommands(ctx, w.ID)
+	for {
+		select {
+		case <-w.done:
+			return
+		case cmd, ok := <-commands:
+			if !ok {
+				return
+			}
+			w.applyCommand(ctx, cmd)
+		}
+	}
+}
+
+// pollControl applies the worker's pending command, if any
+func (w *Worker) pollControl(ctx context.Context) {
+	cmd, err := w.queue.GetWorkerCommand(ctx, w.ID)
+	if err != nil {
+		log.Printf("Failed to read worker command: %v", err)
+		return
+	}
+	w.applyCommand(ctx, cmd)
+}
+
+// applyCommand carries out a control command. Commands are idempotent, so
+// the same one may safely arrive by pub/sub and by polling.
+func (w *Worker) applyCommand(ctx context.Context, cmd types.WorkerCommand) {
+	switch cmd {
+	case types.WorkerCommandPause:
+		w.Pause(ctx)
+	case types.WorkerCommandResume:
+		w.Resume(ctx)
+	case types.WorkerCommandShutdown:
+		select {
+		case <-w.shutdown:
+			// Already shutting down
+		default:
+			log.Printf("Worker %s received remote shutdown", w.ID)
+			go func() {
+				drainCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), w.drainTimeout)
+				defer cancel()
+				if err := w.Shutdown(drainCtx); err != nil {
+					log.Printf("Worker %s did not drain cleanly: %v", w.ID, err)
+				}
+			}()
+		}
+	default:
+		log.Printf("Worker %s ignoring unknown command %q", w.ID, cmd)
+	}
+}
+
+// Pause stops the worker from dequeueing new jobs. In-flight jobs finish
+// normally and the worker stays registered.
+func (w *Worker) Pause(ctx context.Context) {
+	w.mu.Lock()
+	if w.status != types.WorkerStatusIdle && w.status != types.WorkerStatusProcessing {
+		w.mu.Unlock()
+		return
+	}
+	w.status = types.WorkerStatusPaused
+	w.running = make(chan struct{})
+	w.mu.Unlock()
+
+	log.Printf("Worker %s paused", w.ID)
+	w.updateWorkerStatus(ctx)
+}
+
+// Resume lets a paused worker dequeue jobs again
+func (w *Worker) Resume(ctx context.Context) {
+	w.mu.Lock()
+	if w.status != types.WorkerStatusPaused {
+		w.mu.Unlock()
+		return
+	}
+	if len(w.activeJobs) > 0 {
+		w.status = types.WorkerStatusProcessing
+	} else {
+		w.status = types.WorkerStatusIdle
+	}
+	close(w.running)
+	w.mu.Unlock()
+
+	log.Printf("Worker %s resumed", w.ID)
+	w.updateWorkerStatus(ctx)
+}
+
+// runningGate returns a channel that is closed while the worker is not paused
+func (w *Worker) runningGate() <-chan struct{} {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.running
+}
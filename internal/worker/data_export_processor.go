@@ -1,22 +1,81 @@
 package worker
 
 import (
+	"compress/gzip"
 	"context"
-	"encoding/csv"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"math/rand"
 	"os"
+	"path"
 	"path/filepath"
+	"strings"
+	"taskflow/internal/blobstore"
 	"taskflow/internal/types"
 	"time"
 )
 
-type DataExportProcessor struct{}
+type DataExportProcessor struct {
+	store  blobstore.Store // nil writes exports to the worker's disk
+	urlTTL time.Duration
 
-func NewDataExportProcessor() *DataExportProcessor {
-	return &DataExportProcessor{}
+	tables       map[string][]string // tables each tenant may export, nil for any
+	queryTimeout time.Duration       // 0 for none
+	maxRows      int                 // 0 for any number
+}
+
+// DataExportOption configures a DataExportProcessor
+type DataExportOption func(*DataExportProcessor)
+
+// WithExportStore streams exports to store instead of the worker's disk.
+// If the store can presign URLs, results link to the export with one valid
+// for urlTTL.
+func WithExportStore(store blobstore.Store, urlTTL time.Duration) DataExportOption {
+	return func(d *DataExportProcessor) {
+		d.store = store
+		d.urlTTL = urlTTL
+	}
+}
+
+// WithExportTables limits the tables and views each tenant's exports may
+// read, by tenant ID. Tenants missing from tables may not export.
+func WithExportTables(tables map[string][]string) DataExportOption {
+	return func(d *DataExportProcessor) {
+		d.tables = tables
+	}
+}
+
+// WithExportLimits fails exports whose query runs longer than
+// queryTimeout, or that have more than maxRows rows. Zero lifts a limit.
+func WithExportLimits(queryTimeout time.Duration, maxRows int) DataExportOption {
+	return func(d *DataExportProcessor) {
+		d.queryTimeout = queryTimeout
+		d.maxRows = maxRows
+	}
+}
+
+func NewDataExportProcessor(opts ...DataExportOption) *DataExportProcessor {
+	d := &DataExportProcessor{}
+	for _, opt := range opts {
+		opt(d)
+	}
+	return d
+}
+
+// SelfCheck checks that the export store is reachable, with HeadBucket
+// for S3. Exports written to the worker's disk have nothing to check.
+func (d *DataExportProcessor) SelfCheck(ctx context.Context) error {
+	checker, ok := d.store.(blobstore.Checker)
+	if !ok {
+		return nil
+	}
+	if err := checker.Check(ctx); err != nil {
+		return fmt.Errorf("export store is unavailable: %w", err)
+	}
+	return nil
 }
 
 func (d *DataExportProcessor) SupportedJobTypes() []types.JobType {
@@ -27,13 +86,13 @@ func (d *DataExportProcessor) ProcessJob(ctx context.Context, job *types.Job) (j
 	// Parse the data export payload
 	var payload types.DataExportPayload
 	if err := json.Unmarshal(job.Payload, &payload); err != nil {
-		return nil, fmt.Errorf("invalid data export payload: %w", err)
+		return nil, validationError(fmt.Errorf("invalid data export payload: %w", err))
 	}
 
-	log.Printf("Exporting data with query: %s to format: %s", payload.Query, payload.ExportType)
+	log.Printf("Exporting data with query: %s to format: %s", JobContextFrom(ctx).Redact("$.query", payload.Query), payload.ExportType)
 
 	// Process the export
-	result, err := d.processExport(ctx, payload)
+	result, err := d.processExport(ctx, job, payload)
 	if err != nil {
 		return nil, fmt.Errorf("failed to process export: %w", err)
 	}
@@ -46,67 +105,280 @@ func (d *DataExportProcessor) ProcessJob(ctx context.Context, job *types.Job) (j
 	return resultJSON, nil
 }
 
-func (d *DataExportProcessor) processExport(ctx context.Context, payload types.DataExportPayload) (*types.DataExportResult, error) {
+// exportPlan is a checked data export
+type exportPlan struct {
+	payload types.DataExportPayload
+	query   *types.ExportQuery
+	spec    *types.ExportSpec
+	ext     string
+}
+
+func (d *DataExportProcessor) processExport(ctx context.Context, job *types.Job, payload types.DataExportPayload) (*types.DataExportResult, error) {
+	plan := &exportPlan{payload: payload}
+	var err error
+	if plan.ext, err = exportExtension(payload.ExportType); err != nil {
+		return nil, validationError(err)
+	}
+	if plan.query, err = types.ParseExportQuery(payload.Query, payload.Params); err != nil {
+		return nil, validationError(err)
+	}
+	if d.tables != nil {
+		if err := plan.query.AllowTables(d.tables[job.Tenant()]); err != nil {
+			return nil, validationError(err)
+		}
+	}
+	if plan.spec, err = types.ParseExportSpec(payload); err != nil {
+		return nil, validationError(err)
+	}
+	if payload.ExportType == "xlsx" {
+		if _, err := parseXLSXOptions(payload.Format); err != nil {
+			return nil, validationError(err)
+		}
+	}
+
+	// Workbooks are zip files already, so they aren't compressed again by
+	// default
+	compression := payload.Compression
+	switch {
+	case compression == "" && payload.ExportType == "xlsx":
+		compression = "none"
+	case compression == "":
+		compression = "gzip"
+	case compression == "gzip", compression == "none":
+	default:
+		return nil, validationError(fmt.Errorf("unsupported compression: %s", payload.Compression))
+	}
+
+	// The query runs until its last row is read, so the timeout covers
+	// writing the export too
+	queryCtx := ctx
+	if d.queryTimeout > 0 {
+		var cancel context.CancelFunc
+		queryCtx, cancel = context.WithTimeout(ctx, d.queryTimeout)
+		defer cancel()
+	}
+
 	// Simulate data fetching time
 	select {
 	case <-time.After(3 * time.Second):
-	case <-ctx.Done():
-		return nil, ctx.Err()
+	case <-queryCtx.Done():
+		err = queryCtx.Err()
+	}
+
+	result := &types.DataExportResult{Format: payload.ExportType, Compression: compression}
+	if err == nil {
+		if d.store == nil {
+			err = d.exportFile(queryCtx, plan, result)
+		} else {
+			err = d.exportBlob(queryCtx, job, plan, result)
+		}
+	}
+	if err != nil && ctx.Err() == nil && errors.Is(err, context.DeadlineExceeded) {
+		err = types.Permanent(types.WithErrorCode(types.ErrorCodeTimeout, fmt.Errorf("query ran longer than %s", d.queryTimeout)))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("export failed: %w", err)
 	}
 
-	// Generate mock data based on query
-	data := d.generateMockData(payload.Query)
+	log.Printf("Exported %d rows to %s (%d bytes)", result.RowCount, result.Format, result.FileSize)
+
+	return result, nil
+}
 
+// exportFile writes the export to the worker's disk at the payload's
+// output path
+func (d *DataExportProcessor) exportFile(ctx context.Context, plan *exportPlan, result *types.DataExportResult) error {
 	// Create output directory if it doesn't exist
-	outputDir := filepath.Dir(payload.OutputPath)
+	outputDir := filepath.Dir(plan.payload.OutputPath)
 	if err := os.MkdirAll(outputDir, 0755); err != nil {
-		return nil, fmt.Errorf("failed to create output directory: %w", err)
+		return fmt.Errorf("failed to create output directory: %w", err)
 	}
 
-	// Export data based on format
-	var filePath string
-	var err error
+	filePath := exportPath(plan.payload.OutputPath, plan.ext, result.Compression)
+	file, err := os.Create(filePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
 
-	switch payload.ExportType {
-	case "csv":
-		filePath, err = d.exportCSV(data, payload.OutputPath)
-	case "json":
-		filePath, err = d.exportJSON(data, payload.OutputPath)
-	case "xlsx":
-		// For demo purposes, we'll create a CSV and pretend it's Excel
-		filePath, err = d.exportCSV(data, payload.OutputPath+".csv")
-	default:
-		return nil, fmt.Errorf("unsupported export type: %s", payload.ExportType)
+	if err := d.writeExport(ctx, file, plan, result); err != nil {
+		return err
+	}
+	result.FilePath = filePath
+	return file.Close()
+}
+
+// exportBlob streams the export to the store as its rows are written, so
+// that it is never held in memory or on disk. The S3 store uploads it in
+// parts.
+func (d *DataExportProcessor) exportBlob(ctx context.Context, job *types.Job, plan *exportPlan, result *types.DataExportResult) error {
+	name := path.Base(filepath.ToSlash(plan.payload.OutputPath))
+	if name == "." || name == "/" {
+		name = "export"
 	}
+	key := fmt.Sprintf("exports/%s/%s/%s", job.Tenant(), job.ID, exportPath(name, plan.ext, result.Compression))
 
+	type upload struct {
+		ref string
+		err error
+	}
+	uploaded := make(chan upload, 1)
+	pr, pw := io.Pipe()
+	go func() {
+		ref, err := d.store.Put(ctx, key, pr)
+		// Unblock the writer if the upload stops early
+		pr.CloseWithError(err)
+		uploaded <- upload{ref, err}
+	}()
+
+	// Closing the pipe with an error aborts the upload
+	err := d.writeExport(ctx, pw, plan, result)
+	pw.CloseWithError(err)
+	up := <-uploaded
 	if err != nil {
-		return nil, fmt.Errorf("export failed: %w", err)
+		return err
 	}
+	if up.err != nil {
+		return up.err
+	}
+	result.FilePath = up.ref
+
+	if presigner, ok := d.store.(blobstore.Presigner); ok && d.urlTTL > 0 {
+		url, err := presigner.PresignGet(ctx, up.ref, d.urlTTL)
+		if err != nil {
+			return fmt.Errorf("failed to sign download URL: %w", err)
+		}
+		expiresAt := time.Now().Add(d.urlTTL).UTC()
+		result.DownloadURL = url
+		result.ExpiresAt = &expiresAt
+	}
+	return nil
+}
 
-	// Get file info
-	fileInfo, err := os.Stat(filePath)
+// writeExport writes the rows of the export that match its spec to w,
+// compressed as the result says, and records their count and the bytes
+// written. It fails once more rows match than the processor allows.
+func (d *DataExportProcessor) writeExport(ctx context.Context, w io.Writer, plan *exportPlan, result *types.DataExportResult) error {
+	spec := plan.spec
+	counter := &countingWriter{w: w}
+	out := io.Writer(counter)
+	var gz *gzip.Writer
+	if result.Compression == "gzip" {
+		gz = gzip.NewWriter(counter)
+		out = gz
+	}
+
+	rows, err := newRowWriter(plan.payload, out)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get file info: %w", err)
+		return err
 	}
 
-	result := &types.DataExportResult{
-		FilePath: filePath,
-		FileSize: fileInfo.Size(),
-		RowCount: len(data),
-		Format:   payload.ExportType,
+	// Keep the columns of the spec, or of the first row. With columns to
+	// keep, the header is written even if no row matches.
+	var columns []types.ExportColumn
+	header := func(row map[string]interface{}) error {
+		columns = spec.ColumnsFor(row)
+		names := make([]string, len(columns))
+		for i, column := range columns {
+			names[i] = column.Name
+		}
+		return rows.Header(names)
+	}
+	if len(spec.Columns) > 0 {
+		if err := header(nil); err != nil {
+			return fmt.Errorf("failed to write header: %w", err)
+		}
 	}
 
-	log.Printf("Exported %d rows to %s (%d bytes)", result.RowCount, result.Format, result.FileSize)
+	// Filter and format rows as they are read
+	var values []interface{}
+	err = d.generateMockData(plan.query, func(row map[string]interface{}) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if !spec.Match(row) {
+			return nil
+		}
+		if d.maxRows > 0 && result.RowCount == d.maxRows {
+			return validationError(fmt.Errorf("export has more than %d rows", d.maxRows))
+		}
+		if columns == nil {
+			if err := header(row); err != nil {
+				return fmt.Errorf("failed to write header: %w", err)
+			}
+			values = make([]interface{}, len(columns))
+		}
+		values = values[:0]
+		for _, column := range columns {
+			values = append(values, column.Value(row))
+		}
+		if err := rows.Write(values); err != nil {
+			return fmt.Errorf("failed to write row: %w", err)
+		}
+		result.RowCount++
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if err := rows.Close(); err != nil {
+		return fmt.Errorf("failed to finish export: %w", err)
+	}
+	if gz != nil {
+		if err := gz.Close(); err != nil {
+			return fmt.Errorf("failed to compress export: %w", err)
+		}
+	}
+	result.FileSize = counter.n
+	return nil
+}
 
-	return result, nil
+// exportExtension returns the file extension of an export type
+func exportExtension(exportType string) (string, error) {
+	switch exportType {
+	case "csv":
+		return ".csv", nil
+	case "json":
+		return ".json", nil
+	case "ndjson":
+		return ".ndjson", nil
+	case "xlsx":
+		return ".xlsx", nil
+	}
+	return "", fmt.Errorf("unsupported export type: %s", exportType)
 }
 
-func (d *DataExportProcessor) generateMockData(query string) []map[string]interface{} {
+// exportPath gives name the extensions of the export, unless it has them
+// already, as in "report" or "report.csv" becoming "report.csv.gz"
+func exportPath(name, ext, compression string) string {
+	name = strings.TrimSuffix(name, ".gz")
+	if !strings.HasSuffix(name, ext) {
+		name += ext
+	}
+	if compression == "gzip" {
+		name += ".gz"
+	}
+	return name
+}
+
+// countingWriter counts the bytes written through it
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// generateMockData passes mock rows based on the tables of query to fn, one
+// at a time, as a database cursor running it with its params would
+func (d *DataExportProcessor) generateMockData(query *types.ExportQuery, fn func(row map[string]interface{}) error) error {
 	// Generate mock data based on query keywords
 	rowCount := 100 + rand.Intn(900) // 100-1000 rows
 
-	var data []map[string]interface{}
-
 	for i := 0; i < rowCount; i++ {
 		row := map[string]interface{}{
 			"id":         i + 1,
@@ -117,91 +389,28 @@ func (d *DataExportProcessor) generateMockData(query string) []map[string]interf
 		}
 
 		// Add query-specific fields
-		if contains(query, "user") {
+		if readsTable(query, "user") {
 			row["email"] = fmt.Sprintf("user%d@example.com", i+1)
 			row["age"] = 18 + rand.Intn(50)
 		}
 
-		if contains(query, "order") {
+		if readsTable(query, "order") {
 			row["amount"] = rand.Float64() * 500
 			row["product"] = fmt.Sprintf("Product %d", rand.Intn(10)+1)
 		}
 
-		data = append(data, row)
-	}
-
-	return data
-}
-
-func (d *DataExportProcessor) exportCSV(data []map[string]interface{}, outputPath string) (string, error) {
-	// Ensure CSV extension
-	if filepath.Ext(outputPath) != ".csv" {
-		outputPath += ".csv"
-	}
-
-	file, err := os.Create(outputPath)
-	if err != nil {
-		return "", err
-	}
-	defer file.Close()
-
-	writer := csv.NewWriter(file)
-	defer writer.Flush()
-
-	if len(data) == 0 {
-		return outputPath, nil
-	}
-
-	// Write header
-	var headers []string
-	for key := range data[0] {
-		headers = append(headers, key)
-	}
-	writer.Write(headers)
-
-	// Write data rows
-	for _, row := range data {
-		var values []string
-		for _, header := range headers {
-			values = append(values, fmt.Sprintf("%v", row[header]))
+		if err := fn(row); err != nil {
+			return err
 		}
-		writer.Write(values)
-	}
-
-	return outputPath, nil
-}
-
-func (d *DataExportProcessor) exportJSON(data []map[string]interface{}, outputPath string) (string, error) {
-	// Ensure JSON extension
-	if filepath.Ext(outputPath) != ".json" {
-		outputPath += ".json"
 	}
 
-	file, err := os.Create(outputPath)
-	if err != nil {
-		return "", err
-	}
-	defer file.Close()
-
-	encoder := json.NewEncoder(file)
-	encoder.SetIndent("", "  ")
-
-	err = encoder.Encode(map[string]interface{}{
-		"data":        data,
-		"total":       len(data),
-		"exported_at": time.Now().Format(time.RFC3339),
-	})
-
-	return outputPath, err
-}
-
-func contains(s, substr string) bool {
-	return len(s) >= len(substr) && (s == substr || hasSubstring(s, substr))
+	return nil
 }
 
-func hasSubstring(s, substr string) bool {
-	for i := 0; i <= len(s)-len(substr); i++ {
-		if s[i:i+len(substr)] == substr {
+// readsTable reports whether query reads a table whose name has word in it
+func readsTable(query *types.ExportQuery, word string) bool {
+	for _, table := range query.Tables {
+		if strings.Contains(table, word) {
 			return true
 		}
 	}
@@ -0,0 +1,61 @@
+package worker
+
+import (
+	"taskflow/internal/types"
+	"time"
+)
+
+// inFlightJob is a job the worker is processing
+type inFlightJob struct {
+	ID        string
+	Type      types.JobType
+	Attempt   int
+	StartedAt time.Time
+}
+
+// DebugStatus is a snapshot of a worker for the debug status page
+type DebugStatus struct {
+	ID          string     `json:"id"`
+	Status      string     `json:"status"`
+	Concurrency int        `json:"concurrency"`
+	InFlight    []DebugJob `json:"in_flight"`
+
+	// Degraded lists the job types left out after failing their
+	// self-check, with the reason
+	Degraded map[types.JobType]string `json:"degraded,omitempty"`
+}
+
+// DebugJob is an in-flight job on the debug status page
+type DebugJob struct {
+	ID             string        `json:"id"`
+	Type           types.JobType `json:"type"`
+	Attempt        int           `json:"attempt"`
+	StartedAt      time.Time     `json:"started_at"`
+	RunningSeconds float64       `json:"running_seconds"`
+}
+
+// DebugStatus returns the worker's state and its in-flight jobs, oldest
+// first
+func (w *Worker) DebugStatus() DebugStatus {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	now := time.Now()
+	status := DebugStatus{
+		ID:          w.ID,
+		Status:      w.status,
+		Concurrency: w.concurrency,
+		InFlight:    make([]DebugJob, len(w.activeJobs)),
+		Degraded:    w.degraded,
+	}
+	for i, job := range w.activeJobs {
+		status.InFlight[i] = DebugJob{
+			ID:             job.ID,
+			Type:           job.Type,
+			Attempt:        job.Attempt,
+			StartedAt:      job.StartedAt,
+			RunningSeconds: now.Sub(job.StartedAt).Seconds(),
+		}
+	}
+	return status
+}
@@ -2,17 +2,48 @@ package worker
 
 import (
 	"context"
+	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"log"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"taskflow/internal/emailtemplate"
 	"taskflow/internal/types"
 	"time"
 )
 
-type EmailProcessor struct{}
+type EmailProcessor struct {
+	smtp      EmailSettings
+	templates *emailtemplate.Renderer
+}
+
+// EmailOption configures an EmailProcessor
+type EmailOption func(*EmailProcessor)
+
+// WithTemplateRenderer renders the templates that email payloads name with
+// r. Without it, templated emails fail.
+func WithTemplateRenderer(r *emailtemplate.Renderer) EmailOption {
+	return func(e *EmailProcessor) {
+		e.templates = r
+	}
+}
 
-func NewEmailProcessor() *EmailProcessor {
-	return &EmailProcessor{}
+// WithSMTP sends emails through the SMTP server of s
+func WithSMTP(s EmailSettings) EmailOption {
+	return func(e *EmailProcessor) {
+		e.smtp = s
+	}
+}
+
+func NewEmailProcessor(opts ...EmailOption) *EmailProcessor {
+	e := &EmailProcessor{}
+	for _, opt := range opts {
+		opt(e)
+	}
+	return e
 }
 
 func (e *EmailProcessor) SupportedJobTypes() []types.JobType {
@@ -23,13 +54,19 @@ func (e *EmailProcessor) ProcessJob(ctx context.Context, job *types.Job) (json.R
 	// Parse the email payload
 	var payload types.EmailPayload
 	if err := json.Unmarshal(job.Payload, &payload); err != nil {
-		return nil, fmt.Errorf("invalid email payload: %w", err)
+		return nil, validationError(fmt.Errorf("invalid email payload: %w", err))
+	}
+	if payload.Template != "" {
+		if err := e.render(ctx, &payload); err != nil {
+			return nil, err
+		}
 	}
 
-	log.Printf("Sending email to %s with subject: %s", payload.To, payload.Subject)
+	jc := JobContextFrom(ctx)
+	log.Printf("Sending email to %s with subject: %s", jc.Redact("$.to", payload.To), jc.Redact("$.subject", payload.Subject))
 
 	// Simulate email sending (in real implementation, you'd use SMTP or email service)
-	err := e.sendEmail(ctx, payload)
+	err := e.sendEmail(ctx, payload, jc.Redact("$.to", payload.To))
 	if err != nil {
 		return nil, fmt.Errorf("failed to send email: %w", err)
 	}
@@ -48,13 +85,83 @@ func (e *EmailProcessor) ProcessJob(ctx context.Context, job *types.Job) (json.R
 	return resultJSON, nil
 }
 
+// Target is the SMTP server emails are sent through, as in
+// "smtp:smtp.example.com". Simulated sending has none.
+func (e *EmailProcessor) Target(job *types.Job) string {
+	if e.smtp.SMTPHost == "" {
+		return ""
+	}
+	return "smtp:" + strings.ToLower(e.smtp.SMTPHost)
+}
+
+// SelfCheck logs in to the SMTP server, upgrading to TLS if it offers
+// STARTTLS. Without a host, sending is simulated and there is nothing to
+// check.
+func (e *EmailProcessor) SelfCheck(ctx context.Context) error {
+	if e.smtp.SMTPHost == "" {
+		return nil
+	}
+
+	addr := net.JoinHostPort(e.smtp.SMTPHost, strconv.Itoa(e.smtp.SMTPPort))
+	conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to connect to SMTP server %s: %w", addr, err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	client, err := smtp.NewClient(conn, e.smtp.SMTPHost)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to greet SMTP server %s: %w", addr, err)
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: e.smtp.SMTPHost}); err != nil {
+			return fmt.Errorf("failed to start TLS with SMTP server %s: %w", addr, err)
+		}
+	}
+	if e.smtp.SMTPUsername != "" {
+		auth := smtp.PlainAuth("", e.smtp.SMTPUsername, e.smtp.SMTPPassword, e.smtp.SMTPHost)
+		if err := client.Auth(auth); err != nil {
+			return fmt.Errorf("failed to log in to SMTP server %s: %w", addr, err)
+		}
+	}
+	return client.Quit()
+}
+
+// render fills in the subject and body of a templated email. A subject in
+// the payload replaces the template's.
+func (e *EmailProcessor) render(ctx context.Context, payload *types.EmailPayload) error {
+	if e.templates == nil {
+		return fmt.Errorf("email template %s: templates are not configured on this worker", payload.Template)
+	}
+
+	msg, err := e.templates.Render(ctx, payload.Template, payload.Variables)
+	if err != nil {
+		return err
+	}
+	if payload.Subject == "" {
+		payload.Subject = msg.Subject
+	}
+	payload.Body = msg.Body
+	payload.HTML = msg.HTML
+	return nil
+}
+
 // sendEmail simulates sending an email
-func (e *EmailProcessor) sendEmail(ctx context.Context, payload types.EmailPayload) error {
+func (e *EmailProcessor) sendEmail(ctx context.Context, payload types.EmailPayload, to any) error {
 	// Simulate processing time
 	select {
 	case <-time.After(time.Duration(1+len(payload.Body)/100) * time.Second):
 		// Email "sent" successfully
-		log.Printf("Email sent to %s", payload.To)
+		if e.smtp.SMTPHost != "" {
+			log.Printf("Email sent to %s from %s via %s:%d", to, e.smtp.From, e.smtp.SMTPHost, e.smtp.SMTPPort)
+		} else {
+			log.Printf("Email sent to %s", to)
+		}
 		return nil
 	case <-ctx.Done():
 		return ctx.Err()
@@ -0,0 +1,147 @@
+package worker
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"taskflow/internal/types"
+	"time"
+)
+
+// rowWriter writes export rows in a format as they come, without holding
+// them in memory. Header is called once before any row; an export without
+// rows may not have one.
+type rowWriter interface {
+	Header(columns []string) error
+	Write(values []interface{}) error
+	// Close finishes the export; it doesn't close the underlying writer
+	Close() error
+}
+
+// newRowWriter returns the writer of the payload's export type, checked by
+// exportExtension
+func newRowWriter(payload types.DataExportPayload, w io.Writer) (rowWriter, error) {
+	switch payload.ExportType {
+	case "xlsx":
+		opts, err := parseXLSXOptions(payload.Format)
+		if err != nil {
+			return nil, err
+		}
+		return newXLSXRowWriter(w, opts), nil
+	case "json":
+		return &jsonRowWriter{w: w}, nil
+	case "ndjson":
+		return &ndjsonRowWriter{w: w}, nil
+	default:
+		return &csvRowWriter{w: csv.NewWriter(w)}, nil
+	}
+}
+
+// csvRowWriter writes the header and a line per row
+type csvRowWriter struct {
+	w      *csv.Writer
+	record []string
+}
+
+func (c *csvRowWriter) Header(columns []string) error {
+	c.record = make([]string, len(columns))
+	return c.w.Write(columns)
+}
+
+func (c *csvRowWriter) Write(values []interface{}) error {
+	for i, value := range values {
+		c.record[i] = ""
+		if value != nil {
+			c.record[i] = fmt.Sprintf("%v", value)
+		}
+	}
+	return c.w.Write(c.record)
+}
+
+func (c *csvRowWriter) Close() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+// jsonObject encodes values as a JSON object with keys in column order
+func jsonObject(buf *bytes.Buffer, keys []string, values []interface{}) error {
+	buf.WriteByte('{')
+	for i, key := range keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		k, _ := json.Marshal(key)
+		buf.Write(k)
+		buf.WriteByte(':')
+		v, err := json.Marshal(values[i])
+		if err != nil {
+			return err
+		}
+		buf.Write(v)
+	}
+	buf.WriteString("}\n")
+	return nil
+}
+
+// jsonRowWriter writes a single document of the rows, their total and the
+// export time
+type jsonRowWriter struct {
+	w     io.Writer
+	keys  []string
+	buf   bytes.Buffer
+	total int
+}
+
+func (j *jsonRowWriter) Header(columns []string) error {
+	j.keys = columns
+	return nil
+}
+
+func (j *jsonRowWriter) Write(values []interface{}) error {
+	j.buf.Reset()
+	if j.total == 0 {
+		fmt.Fprintf(&j.buf, `{"exported_at":%q,"data":[`, time.Now().Format(time.RFC3339))
+	} else {
+		j.buf.WriteByte(',')
+	}
+	if err := jsonObject(&j.buf, j.keys, values); err != nil {
+		return err
+	}
+	j.total++
+	_, err := j.w.Write(j.buf.Bytes())
+	return err
+}
+
+func (j *jsonRowWriter) Close() error {
+	if j.total == 0 {
+		_, err := fmt.Fprintf(j.w, `{"exported_at":%q,"data":[],"total":0}`+"\n", time.Now().Format(time.RFC3339))
+		return err
+	}
+	_, err := fmt.Fprintf(j.w, `],"total":%d}`+"\n", j.total)
+	return err
+}
+
+// ndjsonRowWriter writes a JSON object per line
+type ndjsonRowWriter struct {
+	w    io.Writer
+	keys []string
+	buf  bytes.Buffer
+}
+
+func (n *ndjsonRowWriter) Header(columns []string) error {
+	n.keys = columns
+	return nil
+}
+
+func (n *ndjsonRowWriter) Write(values []interface{}) error {
+	n.buf.Reset()
+	if err := jsonObject(&n.buf, n.keys, values); err != nil {
+		return err
+	}
+	_, err := n.w.Write(n.buf.Bytes())
+	return err
+}
+
+func (n *ndjsonRowWriter) Close() error { return nil }
@@ -4,15 +4,83 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"hash/fnv"
 	"log"
+	"math"
+	"os/exec"
+	"strconv"
+	"strings"
 	"taskflow/internal/types"
 	"time"
 )
 
-type ImageResizeProcessor struct{}
+type ImageResizeProcessor struct {
+	settings ImageSettings
 
-func NewImageResizeProcessor() *ImageResizeProcessor {
-	return &ImageResizeProcessor{}
+	// probe downloads an original image and reads its headers
+	probe func(ctx context.Context, imageURL string) (*sourceImage, error)
+}
+
+// sourceImage is what is read from an original image before it is resized
+type sourceImage struct {
+	Width, Height int // as stored, before orientation is applied
+	Size          int64
+	Format        string
+	ColorProfile  string    // embedded ICC profile, e.g. "sRGB" or "Display P3"
+	EXIF          *exifData // nil if the image has none
+}
+
+// exifData is the EXIF data the processor uses
+type exifData struct {
+	Orientation int // 1-8; 5-8 swap width and height
+	Make, Model string
+	GPS         bool // has a GPS position
+}
+
+// ImageOption configures an ImageResizeProcessor
+type ImageOption func(*ImageResizeProcessor)
+
+// WithImageSettings encodes images with the given ffmpeg and limits the
+// size of originals
+func WithImageSettings(s ImageSettings) ImageOption {
+	return func(i *ImageResizeProcessor) {
+		i.settings = s
+	}
+}
+
+func NewImageResizeProcessor(opts ...ImageOption) *ImageResizeProcessor {
+	i := &ImageResizeProcessor{probe: probeImage}
+	for _, opt := range opts {
+		opt(i)
+	}
+	return i
+}
+
+// SelfCheck runs "ffmpeg -version" to check that images can be encoded
+func (i *ImageResizeProcessor) SelfCheck(ctx context.Context) error {
+	if err := exec.CommandContext(ctx, i.settings.ffmpeg(), "-version").Run(); err != nil {
+		return fmt.Errorf("failed to run %s -version: %w", i.settings.ffmpeg(), err)
+	}
+	return nil
+}
+
+// probeImage simulates downloading an image and reading its headers
+func probeImage(ctx context.Context, imageURL string) (*sourceImage, error) {
+	// Simulate download time
+	select {
+	case <-time.After(2 * time.Second):
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	return &sourceImage{
+		Width:        1920,
+		Height:       1080,
+		Size:         2500000, // 2.5MB
+		Format:       "JPEG",
+		ColorProfile: "sRGB",
+		EXIF:         &exifData{Orientation: 1, Make: "Canon", Model: "EOS R6", GPS: true},
+	}, nil
 }
 
 func (i *ImageResizeProcessor) SupportedJobTypes() []types.JobType {
@@ -23,10 +91,10 @@ func (i *ImageResizeProcessor) ProcessJob(ctx context.Context, job *types.Job) (
 	// Parse the image resize payload
 	var payload types.ImageResizePayload
 	if err := json.Unmarshal(job.Payload, &payload); err != nil {
-		return nil, fmt.Errorf("invalid image resize payload: %w", err)
+		return nil, validationError(fmt.Errorf("invalid image resize payload: %w", err))
 	}
 
-	log.Printf("Resizing image %s to sizes: %v", payload.ImageURL, payload.Sizes)
+	log.Printf("Resizing image %s to sizes: %v", JobContextFrom(ctx).Redact("$.image_url", payload.ImageURL), payload.Sizes)
 
 	// Simulate image processing
 	result, err := i.processImage(ctx, payload)
@@ -43,63 +111,137 @@ func (i *ImageResizeProcessor) ProcessJob(ctx context.Context, job *types.Job) (
 }
 
 func (i *ImageResizeProcessor) processImage(ctx context.Context, payload types.ImageResizePayload) (*types.ImageResizeResult, error) {
-	// Simulate download time
-	select {
-	case <-time.After(2 * time.Second):
-	case <-ctx.Done():
-		return nil, ctx.Err()
+	source, err := i.probe(ctx, payload.ImageURL)
+	if err != nil {
+		return nil, err
+	}
+	if limit := i.settings.MaxSourceBytes; limit > 0 && source.Size > limit {
+		return nil, validationError(fmt.Errorf("image is %d bytes, more than the %d allowed", source.Size, limit))
 	}
 
-	// Simulate getting original image metadata
-	originalWidth := 1920
-	originalHeight := 1080
-	originalSize := int64(2500000) // 2.5MB
-
+	// Rotate the image upright as its EXIF orientation says, so sizes and
+	// crops apply to the image as it is viewed
+	originalWidth, originalHeight := source.Width, source.Height
+	originalSize := source.Size
 	metadata := types.ImageMetadata{
-		OriginalWidth:  originalWidth,
-		OriginalHeight: originalHeight,
-		OriginalSize:   originalSize,
-		Format:         "JPEG",
+		OriginalSize: originalSize,
+		Format:       source.Format,
+		ColorProfile: source.ColorProfile,
+	}
+	if exif := source.EXIF; exif != nil {
+		if exif.Orientation >= 5 && exif.Orientation <= 8 {
+			originalWidth, originalHeight = originalHeight, originalWidth
+		}
+		if exif.Orientation > 1 && exif.Orientation <= 8 {
+			metadata.Orientation = exif.Orientation
+		}
+		// Models often repeat the make, as in "Canon" "Canon EOS R6"
+		metadata.Camera = exif.Model
+		if !strings.HasPrefix(exif.Model, exif.Make) {
+			metadata.Camera = strings.TrimSpace(exif.Make + " " + exif.Model)
+		}
+		metadata.HasGPS = exif.GPS
 	}
+	metadata.OriginalWidth = originalWidth
+	metadata.OriginalHeight = originalHeight
 
-	var resizedImages []types.ResizedImage
+	// Variants keep the EXIF data only if asked to, as it can locate and
+	// identify whoever took the picture. The color profile is always kept,
+	// or colors would shift.
+	keepEXIF := payload.PreserveMeta && source.EXIF != nil
 
-	// Process each requested size
-	for _, width := range payload.Sizes {
-		// Calculate proportional height
-		height := (width * originalHeight) / originalWidth
-
-		// Simulate processing time based on image size
-		processingTime := time.Duration(width/100) * time.Millisecond
-		select {
-		case <-time.After(processingTime):
-		case <-ctx.Done():
-			return nil, ctx.Err()
+	formats, err := outputFormats(payload)
+	if err != nil {
+		return nil, validationError(err)
+	}
+	var crop *types.CropRegion
+	aspect := float64(originalWidth) / float64(originalHeight)
+	if payload.Crop != nil {
+		if aspect, err = parseAspectRatio(payload.Crop.AspectRatio); err != nil {
+			return nil, validationError(err)
 		}
+		focus, err := cropFocus(payload.ImageURL, payload.Crop)
+		if err != nil {
+			return nil, validationError(err)
+		}
+		crop = cropRegion(originalWidth, originalHeight, aspect, focus)
+	}
 
-		// Simulate file size (smaller images = smaller files)
-		sizeRatio := float64(width) / float64(originalWidth)
-		newSize := int64(float64(originalSize) * sizeRatio * sizeRatio)
-
-		// Generate mock URL for resized image
-		format := payload.Format
+	// Resume from variants finished by an earlier attempt
+	jc := JobContextFrom(ctx)
+	var resizedImages []types.ResizedImage
+	if checkpoint := jc.LastCheckpoint(); checkpoint != nil {
+		if err := json.Unmarshal(checkpoint, &resizedImages); err != nil {
+			resizedImages = nil
+		}
+	}
+	type variant struct {
+		width  int
+		format string
+	}
+	done := make(map[variant]bool, len(resizedImages))
+	for _, image := range resizedImages {
+		format := image.Format
 		if format == "" {
-			format = "jpeg"
+			format = formats[0] // checkpointed before variants had formats
 		}
+		done[variant{image.Width, format}] = true
+	}
 
-		url := fmt.Sprintf("%s/resized_%dx%d.%s",
-			payload.OutputPath, width, height, format)
+	// Process each requested size in each format
+	total := len(payload.Sizes) * len(formats)
+	for _, width := range payload.Sizes {
+		// Calculate the height from the aspect ratio, cropped or original
+		height := int(math.Round(float64(width) / aspect))
 
-		resizedImage := types.ResizedImage{
-			Width:  width,
-			Height: height,
-			Size:   newSize,
-			URL:    url,
-		}
+		for _, format := range formats {
+			if done[variant{width, format}] {
+				continue
+			}
+
+			// Simulate processing time based on image size
+			processingTime := time.Duration(width/100) * time.Millisecond
+			select {
+			case <-time.After(processingTime):
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+
+			quality := imageQuality(format, payload.Quality)
+
+			// Simulate file size: smaller images and better codecs make
+			// smaller files
+			sizeRatio := float64(width*height) / float64(originalWidth*originalHeight)
+			newSize := int64(float64(originalSize) * sizeRatio * imageEncodings[format].sizeFactor)
+			if quality > 0 {
+				newSize = newSize * int64(quality) / int64(imageEncodings[format].defaultQuality)
+			}
+
+			// Generate mock URL for resized image
+			url := fmt.Sprintf("%s/resized_%dx%d.%s",
+				payload.OutputPath, width, height, format)
+
+			resizedImage := types.ResizedImage{
+				Width:   width,
+				Height:  height,
+				Size:    newSize,
+				URL:     url,
+				Format:  format,
+				Quality: quality,
+				Crop:    crop,
+				EXIF:    keepEXIF,
+			}
+
+			resizedImages = append(resizedImages, resizedImage)
 
-		resizedImages = append(resizedImages, resizedImage)
+			log.Printf("📸 Resized image to %dx%d %s (%d bytes)", width, height, format, newSize)
 
-		log.Printf("📸 Resized image to %dx%d (%d bytes)", width, height, newSize)
+			if checkpoint, err := json.Marshal(resizedImages); err == nil {
+				jc.Checkpoint(checkpoint)
+			}
+			jc.Progress(100*len(resizedImages)/total,
+				fmt.Sprintf("Resized %d of %d variants", len(resizedImages), total))
+		}
 	}
 
 	result := &types.ImageResizeResult{
@@ -110,3 +252,116 @@ func (i *ImageResizeProcessor) processImage(ctx context.Context, payload types.I
 
 	return result, nil
 }
+
+// imageEncoding describes an output format
+type imageEncoding struct {
+	defaultQuality int     // 0 for lossless formats
+	sizeFactor     float64 // file size relative to JPEG at its default quality
+}
+
+var imageEncodings = map[string]imageEncoding{
+	"jpeg": {defaultQuality: 85, sizeFactor: 1},
+	"png":  {sizeFactor: 2.5},
+	"webp": {defaultQuality: 80, sizeFactor: 0.7},
+	"avif": {defaultQuality: 60, sizeFactor: 0.5},
+}
+
+// outputFormats returns the formats each size is encoded in, normalized
+// and without duplicates
+func outputFormats(payload types.ImageResizePayload) ([]string, error) {
+	requested := payload.Formats
+	if len(requested) == 0 {
+		requested = []string{payload.Format}
+	}
+
+	formats := make([]string, 0, len(requested))
+	seen := make(map[string]bool, len(requested))
+	for _, name := range requested {
+		format := strings.ToLower(strings.TrimSpace(name))
+		if format == "" || format == "jpg" {
+			format = "jpeg"
+		}
+		if _, ok := imageEncodings[format]; !ok {
+			return nil, fmt.Errorf("unsupported image format %q", name)
+		}
+		if !seen[format] {
+			seen[format] = true
+			formats = append(formats, format)
+		}
+	}
+	return formats, nil
+}
+
+// imageQuality returns the quality format is encoded at: the requested one,
+// or the format's default. Lossless formats have none.
+func imageQuality(format string, requested int) int {
+	encoding := imageEncodings[format]
+	if encoding.defaultQuality == 0 {
+		return 0
+	}
+	if requested > 0 {
+		return min(requested, 100)
+	}
+	return encoding.defaultQuality
+}
+
+// parseAspectRatio parses an aspect ratio such as "16:9"
+func parseAspectRatio(s string) (float64, error) {
+	w, h, ok := strings.Cut(s, ":")
+	width, werr := strconv.Atoi(w)
+	height, herr := strconv.Atoi(h)
+	if !ok || werr != nil || herr != nil || width < 1 || height < 1 {
+		return 0, fmt.Errorf("invalid aspect ratio %q, want e.g. \"16:9\"", s)
+	}
+	return float64(width) / float64(height), nil
+}
+
+// cropFocus returns the point of the image a crop keeps
+func cropFocus(imageURL string, crop *types.ImageCrop) (types.FocalPoint, error) {
+	switch crop.Focus {
+	case "", "center":
+		return types.FocalPoint{X: 0.5, Y: 0.5}, nil
+	case "focal":
+		p := crop.FocalPoint
+		if p == nil || p.X < 0 || p.X > 1 || p.Y < 0 || p.Y > 1 {
+			return types.FocalPoint{}, fmt.Errorf("focal crop needs a focal_point with x and y between 0 and 1")
+		}
+		return *p, nil
+	case "smart":
+		return detectSalientPoint(imageURL), nil
+	}
+	return types.FocalPoint{}, fmt.Errorf("unsupported crop focus %q", crop.Focus)
+}
+
+// detectSalientPoint simulates saliency detection, which finds the most
+// interesting point of an image. The point is derived from the URL, so
+// every attempt crops alike.
+func detectSalientPoint(imageURL string) types.FocalPoint {
+	h := fnv.New32a()
+	h.Write([]byte(imageURL))
+	sum := h.Sum32()
+	return types.FocalPoint{
+		X: 0.3 + 0.4*float64(sum&0xffff)/0xffff,
+		Y: 0.25 + 0.35*float64(sum>>16)/0xffff,
+	}
+}
+
+// cropRegion returns the largest region of a width x height image with the
+// aspect ratio, centred on focus as far as the edges allow
+func cropRegion(width, height int, aspect float64, focus types.FocalPoint) *types.CropRegion {
+	cropWidth, cropHeight := width, height
+	if float64(width)/float64(height) > aspect {
+		cropWidth = max(int(math.Round(float64(height)*aspect)), 1)
+	} else {
+		cropHeight = max(int(math.Round(float64(width)/aspect)), 1)
+	}
+
+	x := int(math.Round(focus.X*float64(width))) - cropWidth/2
+	y := int(math.Round(focus.Y*float64(height))) - cropHeight/2
+	return &types.CropRegion{
+		X:      min(max(x, 0), width-cropWidth),
+		Y:      min(max(y, 0), height-cropHeight),
+		Width:  cropWidth,
+		Height: cropHeight,
+	}
+}
@@ -0,0 +1,159 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"taskflow/internal/lock"
+	"taskflow/internal/types"
+	"time"
+)
+
+// JobContext lets a processor report progress on the job it is running and
+// keep the job claimed while it works. Processors get it from their context
+// with JobContextFrom.
+type JobContext struct {
+	ctx    context.Context // outlives job cancellation so updates still land
+	worker *Worker
+	job    *types.Job
+	mu     sync.Mutex
+}
+
+// MaxCheckpointBytes bounds the size of a job checkpoint
+const MaxCheckpointBytes = 256 << 10
+
+type jobContextKey struct{}
+
+// localLocks serves JobContext.Lock outside a worker
+var localLocks = lock.NewMemoryLocker()
+
+// withJobContext attaches a JobContext for job to ctx
+func (w *Worker) withJobContext(ctx context.Context, job *types.Job) context.Context {
+	jc := &JobContext{
+		ctx:    context.WithoutCancel(ctx),
+		worker: w,
+		job:    job,
+	}
+	return context.WithValue(ctx, jobContextKey{}, jc)
+}
+
+// JobContextFrom returns the JobContext of the job processed under ctx. It
+// returns nil outside a worker; the methods of a nil JobContext do nothing.
+func JobContextFrom(ctx context.Context) *JobContext {
+	jc, _ := ctx.Value(jobContextKey{}).(*JobContext)
+	return jc
+}
+
+// Progress records how far the job has got, as a percentage from 0 to 100
+// with an optional message. It is returned with the job by the API and also
+// counts as a heartbeat. It returns queue.ErrJobConflict if the job is no
+// longer processing, for example because it was cancelled.
+func (jc *JobContext) Progress(percent int, message string) error {
+	if jc == nil {
+		return nil
+	}
+
+	if percent < 0 {
+		percent = 0
+	}
+	if percent > 100 {
+		percent = 100
+	}
+
+	progress := &types.JobProgress{
+		Percent:   percent,
+		Message:   message,
+		UpdatedAt: time.Now(),
+	}
+
+	jc.mu.Lock()
+	jc.job.Progress = progress
+	jc.mu.Unlock()
+
+	if err := jc.worker.queue.UpdateProgress(jc.ctx, jc.job.ID, progress); err != nil {
+		return err
+	}
+	return jc.Heartbeat()
+}
+
+// Heartbeat tells the queue the job is still being worked on, so that it
+// isn't handed to another worker while a long job runs. Jobs are reclaimed
+// after QUEUE_STREAM_CLAIM_IDLE with the stream engine and
+// SQS_VISIBILITY_TIMEOUT on SQS, so beat more often than that.
+func (jc *JobContext) Heartbeat() error {
+	if jc == nil {
+		return nil
+	}
+	return jc.worker.queue.Heartbeat(jc.ctx, jc.worker.ID, jc.job.ID)
+}
+
+// Checkpoint saves JSON describing the work done so far. If the job is
+// retried or requeued, the next attempt gets it back from LastCheckpoint and
+// can resume instead of starting over. It returns queue.ErrJobConflict if
+// the job is no longer processing.
+func (jc *JobContext) Checkpoint(data json.RawMessage) error {
+	if jc == nil {
+		return nil
+	}
+	if len(data) > MaxCheckpointBytes {
+		return fmt.Errorf("checkpoint is %d bytes, maximum is %d", len(data), MaxCheckpointBytes)
+	}
+	if !json.Valid(data) {
+		return fmt.Errorf("checkpoint is not valid JSON")
+	}
+
+	if err := jc.worker.queue.SaveCheckpoint(jc.ctx, jc.job.ID, data); err != nil {
+		return err
+	}
+
+	jc.mu.Lock()
+	jc.job.Checkpoint = data
+	jc.mu.Unlock()
+	return nil
+}
+
+// LastCheckpoint returns the most recent checkpoint saved for the job by
+// this or an earlier attempt, or nil if there is none
+func (jc *JobContext) LastCheckpoint() json.RawMessage {
+	if jc == nil {
+		return nil
+	}
+
+	jc.mu.Lock()
+	defer jc.mu.Unlock()
+	return jc.job.Checkpoint
+}
+
+// Redact returns value, or a placeholder if the worker's redaction rules
+// cover the payload field at path, such as "$.to". Processors pass payload
+// fields through it before logging them.
+func (jc *JobContext) Redact(path string, value any) any {
+	if jc == nil {
+		return value
+	}
+	return jc.worker.redactor.Value(path, value)
+}
+
+// Inputs returns the results of the workflow steps the job's step depends
+// on, keyed by step name. A fan-out step's results come as a JSON array in
+// payload order, so a step depending on it can reduce them. Jobs outside
+// workflows have no inputs.
+func (jc *JobContext) Inputs() (map[string]json.RawMessage, error) {
+	if jc == nil {
+		return nil, nil
+	}
+	return jc.worker.workflows.Inputs(jc.ctx, jc.job)
+}
+
+// Lock waits until it takes the lock name, shared by every worker
+// configured with the same locker, or until ctx is done. Processors use it
+// to serialize access to an external resource; the lock's fencing token
+// lets that resource reject writes from a holder whose lock expired. The
+// lock expires after ttl unless extended, and must be unlocked when done.
+func (jc *JobContext) Lock(ctx context.Context, name string, ttl time.Duration) (*lock.Lock, error) {
+	if jc == nil {
+		return localLocks.Lock(ctx, name, ttl)
+	}
+	return jc.worker.locker.Lock(ctx, name, ttl)
+}
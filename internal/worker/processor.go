@@ -4,8 +4,12 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"log"
+	"sort"
+	"strings"
 	"taskflow/internal/types"
+	"time"
 )
 
 // JobProcessor defines the interface for processing different job types
@@ -14,27 +18,128 @@ type JobProcessor interface {
 	SupportedJobTypes() []types.JobType
 }
 
+// ResultStreamer is implemented by processors whose results are too large
+// to hold in memory. With a blob store configured, the worker calls
+// StreamJob instead of ProcessJob and copies the returned reader to blob
+// storage, storing only the result's reference and checksum with the job.
+// The reader is closed after it is copied if it is an io.Closer.
+type ResultStreamer interface {
+	StreamJob(ctx context.Context, job *types.Job) (io.Reader, error)
+}
+
+// SelfChecker is implemented by processors that depend on something
+// outside the worker, such as an SMTP server or a binary. The worker calls
+// SelfCheck before it starts dequeueing, and leaves the job types of
+// processors that fail it out of the types it claims.
+type SelfChecker interface {
+	SelfCheck(ctx context.Context) error
+}
+
+// Targeter is implemented by processors whose jobs call a downstream
+// target, such as a webhook host or an SMTP server. The worker tracks the
+// failures of each target and, once one is clearly down, parks its jobs
+// until it may be back instead of letting each use up its attempts.
+type Targeter interface {
+	// Target names the target job calls, or returns "" if it calls none
+	Target(job *types.Job) string
+}
+
+// validationError fails a job for good with the VALIDATION error code, for
+// payloads that can't be processed as given
+func validationError(err error) error {
+	return types.Permanent(types.WithErrorCode(types.ErrorCodeValidation, err))
+}
+
+// selfCheckTimeout bounds each processor's self-check
+const selfCheckTimeout = 10 * time.Second
+
 // ProcessorRegistry holds all available job processors
 type ProcessorRegistry struct {
 	processors map[types.JobType]JobProcessor
+	config     ProcessorConfig
+	enabled    map[types.JobType]bool // nil enables every type
 }
 
-func NewProcessorRegistry() *ProcessorRegistry {
+// defaultProcessors create the processor of each built-in job type
+var defaultProcessors = map[types.JobType]func(cfg ProcessorConfig) JobProcessor{
+	types.JobTypeEmail: func(cfg ProcessorConfig) JobProcessor {
+		return NewEmailProcessor(WithSMTP(cfg.Email))
+	},
+	types.JobTypeImageResize: func(cfg ProcessorConfig) JobProcessor {
+		return NewImageResizeProcessor(WithImageSettings(cfg.Image))
+	},
+	types.JobTypeWebhook: func(cfg ProcessorConfig) JobProcessor {
+		proxy, _ := cfg.Webhook.Proxy()
+		return NewWebhookProcessor(WithProxy(proxy))
+	},
+	types.JobTypeDataExport: func(cfg ProcessorConfig) JobProcessor {
+		return NewDataExportProcessor()
+	},
+}
+
+// NewProcessorRegistry checks cfg and registers the default processors of
+// jobTypes, or of every built-in type if none are given, each configured
+// with its part of cfg. Processors of other types are never created, and
+// RegisterProcessor skips them, so a worker only claims jobs of jobTypes.
+func NewProcessorRegistry(cfg ProcessorConfig, jobTypes ...types.JobType) (*ProcessorRegistry, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
 	registry := &ProcessorRegistry{
 		processors: make(map[types.JobType]JobProcessor),
+		config:     cfg,
+	}
+	if len(jobTypes) > 0 {
+		registry.enabled = make(map[types.JobType]bool, len(jobTypes))
+		for _, jobType := range jobTypes {
+			if defaultProcessors[jobType] == nil {
+				return nil, fmt.Errorf("no processor for job type %s", jobType)
+			}
+			registry.enabled[jobType] = true
+		}
 	}
 
 	// Register default processors
-	registry.RegisterProcessor(NewEmailProcessor())
-	registry.RegisterProcessor(NewImageResizeProcessor())
-	registry.RegisterProcessor(NewWebhookProcessor())
-	registry.RegisterProcessor(NewDataExportProcessor())
+	for _, jobType := range []types.JobType{types.JobTypeEmail, types.JobTypeImageResize, types.JobTypeWebhook, types.JobTypeDataExport} {
+		if registry.Enabled(jobType) {
+			registry.RegisterProcessor(defaultProcessors[jobType](cfg))
+		}
+	}
+
+	return registry, nil
+}
 
-	return registry
+// ParseJobTypes parses a comma separated list of job types, such as
+// "email,webhook"
+func ParseJobTypes(s string) ([]types.JobType, error) {
+	var jobTypes []types.JobType
+	for _, field := range strings.Split(s, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		jobType := types.JobType(field)
+		if defaultProcessors[jobType] == nil {
+			return nil, fmt.Errorf("no processor for job type %s", field)
+		}
+		jobTypes = append(jobTypes, jobType)
+	}
+	return jobTypes, nil
 }
 
+// Enabled reports whether the registry runs jobs of jobType
+func (r *ProcessorRegistry) Enabled(jobType types.JobType) bool {
+	return r.enabled == nil || r.enabled[jobType]
+}
+
+// RegisterProcessor registers processor for each of its job types that
+// the registry runs
 func (r *ProcessorRegistry) RegisterProcessor(processor JobProcessor) {
 	for _, jobType := range processor.SupportedJobTypes() {
+		if !r.Enabled(jobType) {
+			continue
+		}
 		r.processors[jobType] = processor
 		log.Printf("Registered processor for job type: %s", jobType)
 	}
@@ -45,14 +150,60 @@ func (r *ProcessorRegistry) GetProcessor(jobType types.JobType) (JobProcessor, b
 	return processor, exists
 }
 
+// GetStreamer returns the processor of a job type if it streams its results
+func (r *ProcessorRegistry) GetStreamer(jobType types.JobType) (ResultStreamer, bool) {
+	processor, exists := r.processors[jobType]
+	if !exists {
+		return nil, false
+	}
+	streamer, ok := processor.(ResultStreamer)
+	return streamer, ok
+}
+
+// GetTarget returns the downstream target of a job, or "" if its processor
+// doesn't name one
+func (r *ProcessorRegistry) GetTarget(job *types.Job) string {
+	targeter, ok := r.processors[job.Type].(Targeter)
+	if !ok {
+		return ""
+	}
+	return targeter.Target(job)
+}
+
 func (r *ProcessorRegistry) GetSupportedJobTypes() []types.JobType {
 	var jobTypes []types.JobType
 	for jobType := range r.processors {
 		jobTypes = append(jobTypes, jobType)
 	}
+	sort.Slice(jobTypes, func(i, j int) bool { return jobTypes[i] < jobTypes[j] })
 	return jobTypes
 }
 
+// SelfCheck runs the self-check of every registered processor that has
+// one, and unregisters the job types of those that fail. It returns why
+// each unregistered type failed.
+func (r *ProcessorRegistry) SelfCheck(ctx context.Context) map[types.JobType]error {
+	checked := make(map[JobProcessor]error)
+	failed := make(map[types.JobType]error)
+	for _, jobType := range r.GetSupportedJobTypes() {
+		processor := r.processors[jobType]
+		err, done := checked[processor]
+		if !done {
+			if checker, ok := processor.(SelfChecker); ok {
+				checkCtx, cancel := context.WithTimeout(ctx, selfCheckTimeout)
+				err = checker.SelfCheck(checkCtx)
+				cancel()
+			}
+			checked[processor] = err
+		}
+		if err != nil {
+			delete(r.processors, jobType)
+			failed[jobType] = err
+		}
+	}
+	return failed
+}
+
 // ProcessJob processes a job using the appropriate processor
 func (r *ProcessorRegistry) ProcessJob(ctx context.Context, job *types.Job) (json.RawMessage, error) {
 	processor, exists := r.GetProcessor(job.Type)
@@ -0,0 +1,111 @@
+package worker
+
+import (
+	"fmt"
+	"net/mail"
+	"net/url"
+)
+
+// ProcessorConfig holds the settings of the default processors, from the
+// processors section of the config file. NewProcessorRegistry checks it and
+// hands each processor its part.
+type ProcessorConfig struct {
+	Email   EmailSettings   `yaml:"email" toml:"email"`
+	Image   ImageSettings   `yaml:"image" toml:"image"`
+	Webhook WebhookSettings `yaml:"webhook" toml:"webhook"`
+}
+
+// EmailSettings is the SMTP server emails are sent through. Without a
+// host, sending is simulated.
+type EmailSettings struct {
+	SMTPHost     string `yaml:"smtp_host" toml:"smtp_host"`
+	SMTPPort     int    `yaml:"smtp_port" toml:"smtp_port"`
+	SMTPUsername string `yaml:"smtp_username" toml:"smtp_username"`
+	SMTPPassword string `yaml:"smtp_password" toml:"smtp_password"`
+
+	// From is the sender of every email, as in "TaskFlow <noreply@example.com>"
+	From string `yaml:"from" toml:"from"`
+}
+
+// ImageSettings sets how images are encoded and which originals are
+// accepted
+type ImageSettings struct {
+	// FFmpegPath is the ffmpeg binary images are encoded with, looked up
+	// in PATH unless it is a path. Empty means "ffmpeg".
+	FFmpegPath string `yaml:"ffmpeg_path" toml:"ffmpeg_path"`
+
+	// MaxSourceBytes fails images whose original is larger for good. Zero
+	// accepts any size.
+	MaxSourceBytes int64 `yaml:"max_source_bytes" toml:"max_source_bytes"`
+}
+
+// ffmpeg returns the ffmpeg binary to run
+func (s ImageSettings) ffmpeg() string {
+	if s.FFmpegPath == "" {
+		return "ffmpeg"
+	}
+	return s.FFmpegPath
+}
+
+// WebhookSettings sets how webhooks leave the worker
+type WebhookSettings struct {
+	// ProxyURL is an http://, https:// or socks5:// proxy webhooks are
+	// sent through. Empty sends them directly.
+	ProxyURL string `yaml:"proxy_url" toml:"proxy_url"`
+}
+
+// Validate checks the settings of every processor
+func (c ProcessorConfig) Validate() error {
+	if err := c.Email.validate(); err != nil {
+		return fmt.Errorf("email processor: %w", err)
+	}
+	if c.Image.MaxSourceBytes < 0 {
+		return fmt.Errorf("image processor: max source bytes cannot be negative")
+	}
+	if _, err := c.Webhook.Proxy(); err != nil {
+		return fmt.Errorf("webhook processor: %w", err)
+	}
+	return nil
+}
+
+func (s EmailSettings) validate() error {
+	if s.SMTPHost == "" {
+		if s.SMTPUsername != "" || s.SMTPPassword != "" || s.From != "" {
+			return fmt.Errorf("smtp host is required with smtp credentials or a sender")
+		}
+		return nil
+	}
+	if s.SMTPPort < 1 || s.SMTPPort > 65535 {
+		return fmt.Errorf("smtp port must be between 1 and 65535")
+	}
+	if (s.SMTPUsername == "") != (s.SMTPPassword == "") {
+		return fmt.Errorf("smtp username and password must be set together")
+	}
+	if s.From == "" {
+		return fmt.Errorf("sender address is required")
+	}
+	if _, err := mail.ParseAddress(s.From); err != nil {
+		return fmt.Errorf("invalid sender address %q: %w", s.From, err)
+	}
+	return nil
+}
+
+// Proxy parses the proxy URL, returning nil if there is none
+func (s WebhookSettings) Proxy() (*url.URL, error) {
+	if s.ProxyURL == "" {
+		return nil, nil
+	}
+	u, err := url.Parse(s.ProxyURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy url: %w", err)
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5":
+	default:
+		return nil, fmt.Errorf("proxy url must be http://, https:// or socks5://")
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("proxy url has no host")
+	}
+	return u, nil
+}
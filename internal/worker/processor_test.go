@@ -1,14 +1,32 @@
 package worker
 
 import (
+	"bytes"
+	"compress/gzip"
 	"context"
+	"encoding/csv"
 	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"taskflow/internal/blobstore"
+	"taskflow/internal/breaker"
+	"taskflow/internal/signing"
 	"taskflow/internal/types"
+	"taskflow/internal/webhookauth"
 	"testing"
+	"time"
 )
 
 func TestProcessorRegistry(t *testing.T) {
-	registry := NewProcessorRegistry()
+	registry, err := NewProcessorRegistry(ProcessorConfig{})
+	if err != nil {
+		t.Fatalf("Expected the zero config to be valid, got %v", err)
+	}
 
 	// Test that all expected processors are registered
 	expectedTypes := []types.JobType{
@@ -51,6 +69,191 @@ func TestProcessorRegistry(t *testing.T) {
 	}
 }
 
+// streamingProcessor streams a fixed report as its result
+type streamingProcessor struct{}
+
+func (streamingProcessor) ProcessJob(ctx context.Context, job *types.Job) (json.RawMessage, error) {
+	return json.RawMessage(`{"rows": 1}`), nil
+}
+
+func (streamingProcessor) StreamJob(ctx context.Context, job *types.Job) (io.Reader, error) {
+	return strings.NewReader("id,name\n1,Record 1\n"), nil
+}
+
+func (streamingProcessor) SupportedJobTypes() []types.JobType {
+	return []types.JobType{"report"}
+}
+
+func TestProcessorRegistryConfig(t *testing.T) {
+	cfg := ProcessorConfig{
+		Email:   EmailSettings{SMTPHost: "smtp.example.com", SMTPPort: 587, SMTPUsername: "taskflow", SMTPPassword: "secret", From: "TaskFlow <noreply@example.com>"},
+		Image:   ImageSettings{FFmpegPath: "/usr/bin/ffmpeg", MaxSourceBytes: 1 << 20},
+		Webhook: WebhookSettings{ProxyURL: "http://proxy.internal:3128"},
+	}
+	registry, err := NewProcessorRegistry(cfg)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	// Each processor gets its settings
+	email, _ := registry.GetProcessor(types.JobTypeEmail)
+	if got := email.(*EmailProcessor).smtp; got != cfg.Email {
+		t.Errorf("Email processor settings = %+v, want %+v", got, cfg.Email)
+	}
+	image, _ := registry.GetProcessor(types.JobTypeImageResize)
+	if got := image.(*ImageResizeProcessor).settings; got != cfg.Image {
+		t.Errorf("Image processor settings = %+v, want %+v", got, cfg.Image)
+	}
+	webhook, _ := registry.GetProcessor(types.JobTypeWebhook)
+	if proxy := webhook.(*WebhookProcessor).proxy; proxy == nil || proxy.Host != "proxy.internal:3128" {
+		t.Errorf("Webhook processor proxy = %v, want proxy.internal:3128", proxy)
+	}
+
+	invalid := map[string]ProcessorConfig{
+		"smtp port":         {Email: EmailSettings{SMTPHost: "smtp.example.com", From: "noreply@example.com"}},
+		"smtp username":     {Email: EmailSettings{SMTPHost: "smtp.example.com", SMTPPort: 587, SMTPUsername: "taskflow", From: "noreply@example.com"}},
+		"sender":            {Email: EmailSettings{SMTPHost: "smtp.example.com", SMTPPort: 587, From: "not an address"}},
+		"credentials alone": {Email: EmailSettings{SMTPPassword: "secret"}},
+		"max source bytes":  {Image: ImageSettings{MaxSourceBytes: -1}},
+		"proxy scheme":      {Webhook: WebhookSettings{ProxyURL: "ftp://proxy.internal"}},
+		"proxy host":        {Webhook: WebhookSettings{ProxyURL: "http://"}},
+	}
+	for name, cfg := range invalid {
+		if _, err := NewProcessorRegistry(cfg); err == nil {
+			t.Errorf("%s: Expected the settings to be rejected", name)
+		}
+	}
+}
+
+func TestProcessorRegistryJobTypes(t *testing.T) {
+	jobTypes, err := ParseJobTypes(" email, webhook,")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	registry, err := NewProcessorRegistry(ProcessorConfig{}, jobTypes...)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	// Only the listed types are registered, even when registered later
+	registry.RegisterProcessor(NewDataExportProcessor())
+	supported := registry.GetSupportedJobTypes()
+	if len(supported) != 2 || !registry.Enabled(types.JobTypeEmail) || !registry.Enabled(types.JobTypeWebhook) {
+		t.Errorf("Expected email and webhook processors, got %v", supported)
+	}
+	if _, ok := registry.GetProcessor(types.JobTypeDataExport); ok {
+		t.Error("Expected no data export processor on a worker that doesn't run exports")
+	}
+
+	if _, err := ParseJobTypes("email,video"); err == nil {
+		t.Error("Expected a job type without a processor to be rejected")
+	}
+	if _, err := NewProcessorRegistry(ProcessorConfig{}, "video"); err == nil {
+		t.Error("Expected a registry of a job type without a processor to be rejected")
+	}
+}
+
+func TestProcessorRegistrySelfCheck(t *testing.T) {
+	registry, err := NewProcessorRegistry(ProcessorConfig{
+		Email: EmailSettings{SMTPHost: "127.0.0.1", SMTPPort: 1, From: "noreply@example.com"},
+		Image: ImageSettings{FFmpegPath: filepath.Join(t.TempDir(), "ffmpeg")},
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	failed := registry.SelfCheck(context.Background())
+	if len(failed) != 2 || failed[types.JobTypeEmail] == nil || failed[types.JobTypeImageResize] == nil {
+		t.Fatalf("Expected the email and image processors to fail their self-check, got %v", failed)
+	}
+	supported := registry.GetSupportedJobTypes()
+	if len(supported) != 2 || supported[0] != types.JobTypeDataExport || supported[1] != types.JobTypeWebhook {
+		t.Errorf("Expected only data export and webhook processors to remain, got %v", supported)
+	}
+	if _, ok := registry.GetProcessor(types.JobTypeEmail); ok {
+		t.Error("Expected the email processor to be unregistered")
+	}
+}
+
+func TestRecoverPanic(t *testing.T) {
+	job := &types.Job{ID: "test-panic", Type: types.JobTypeEmail}
+	err := recoverPanic(job, func() error {
+		var payload map[string]string
+		payload["to"] = "user@example.com" // nil map
+		return nil
+	})
+	if err == nil || !strings.Contains(err.Error(), "processor panicked") {
+		t.Fatalf("Expected the panic as an error, got %v", err)
+	}
+	if failure := types.FailureFrom(err); failure.Code != types.ErrorCodePanic || failure.Permanent {
+		t.Errorf("Failure = %+v, want a retryable PANIC failure", failure)
+	}
+}
+
+func TestTargetBreakers(t *testing.T) {
+	registry, _ := NewProcessorRegistry(ProcessorConfig{})
+	job := &types.Job{Type: types.JobTypeWebhook, Payload: json.RawMessage(`{"url": "https://API.example.com/hook"}`)}
+	target := registry.GetTarget(job)
+	if target != "webhook:api.example.com" {
+		t.Fatalf("GetTarget = %q, want webhook:api.example.com", target)
+	}
+	if got := registry.GetTarget(&types.Job{Type: types.JobTypeEmail}); got != "" {
+		t.Errorf("GetTarget of simulated email = %q, want none", got)
+	}
+
+	targets := newTargetBreakers(breaker.Config{FailureThreshold: 3, OpenTimeout: time.Minute})
+	down := types.Retryable(types.WithErrorCode(types.ErrorCodeDownstream5xx, errors.New("503")), 0)
+
+	// Invalid payloads and answers that the target is up don't count
+	targets.report(target, down)
+	targets.report(target, down)
+	targets.report(target, validationError(errors.New("bad payload")))
+	if err := targets.allow(target); err != nil {
+		t.Fatalf("allow after 2 failures = %v, want nil", err)
+	}
+	targets.report(target, types.Permanent(errors.New("404")))
+	targets.report(target, down)
+	targets.report(target, down)
+	if err := targets.allow(target); err != nil {
+		t.Fatalf("allow after a 4xx reset the failures = %v, want nil", err)
+	}
+
+	targets.report(target, down)
+	var open *targetDownError
+	if err := targets.allow(target); !errors.As(err, &open) || open.RetryAfter <= 0 {
+		t.Fatalf("allow after 3 failures = %v, want a targetDownError", err)
+	}
+	if err := targets.allow("webhook:other.example.com"); err != nil {
+		t.Errorf("allow of another target = %v, want nil", err)
+	}
+
+	targets.report(target, nil)
+	if err := targets.allow(target); err != nil {
+		t.Errorf("allow after a success = %v, want nil", err)
+	}
+
+	var disabled *targetBreakers
+	disabled.report(target, down)
+	if err := disabled.allow(target); err != nil {
+		t.Errorf("allow without breakers = %v, want nil", err)
+	}
+}
+
+func TestProcessorRegistryStreamers(t *testing.T) {
+	registry, _ := NewProcessorRegistry(ProcessorConfig{})
+	registry.RegisterProcessor(streamingProcessor{})
+
+	if _, ok := registry.GetStreamer("report"); !ok {
+		t.Error("Expected processor with StreamJob to be a streamer")
+	}
+	if _, ok := registry.GetStreamer(types.JobTypeEmail); ok {
+		t.Error("Expected email processor not to be a streamer")
+	}
+	if _, ok := registry.GetStreamer("nonexistent"); ok {
+		t.Error("Expected non-existent processor not to be a streamer")
+	}
+}
+
 func TestEmailProcessor(t *testing.T) {
 	processor := NewEmailProcessor()
 
@@ -151,6 +354,134 @@ func TestWebhookProcessor(t *testing.T) {
 	}
 }
 
+func TestWebhookProcessorStatus(t *testing.T) {
+	processor := NewWebhookProcessor()
+
+	tests := []struct {
+		name       string
+		status     int
+		retryAfter string
+		wantErr    bool
+		permanent  bool
+		wait       time.Duration
+	}{
+		{name: "success", status: http.StatusOK},
+		{name: "server error", status: http.StatusInternalServerError, wantErr: true},
+		{name: "rate limited", status: http.StatusTooManyRequests, retryAfter: "120", wantErr: true, wait: 2 * time.Minute},
+		{name: "unavailable for a day", status: http.StatusServiceUnavailable, retryAfter: "86400", wantErr: true, wait: maxRetryAfter},
+		{name: "not found", status: http.StatusNotFound, wantErr: true, permanent: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tt.retryAfter != "" {
+					w.Header().Set("Retry-After", tt.retryAfter)
+				}
+				w.WriteHeader(tt.status)
+				io.WriteString(w, "receiver says no")
+			}))
+			defer server.Close()
+
+			payloadJSON, _ := json.Marshal(types.WebhookPayload{URL: server.URL, Method: "POST"})
+			job := &types.Job{ID: "test-webhook-status", Type: types.JobTypeWebhook, Payload: payloadJSON}
+
+			_, err := processor.ProcessJob(context.Background(), job)
+			if !tt.wantErr {
+				if err != nil {
+					t.Fatalf("Expected no error for status %d, got %v", tt.status, err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("Expected an error for status %d", tt.status)
+			}
+
+			failure := types.FailureFrom(err)
+			if failure.Permanent != tt.permanent {
+				t.Errorf("Permanent = %v, want %v", failure.Permanent, tt.permanent)
+			}
+			if failure.RetryAfter != tt.wait {
+				t.Errorf("RetryAfter = %v, want %v", failure.RetryAfter, tt.wait)
+			}
+			wantCode := types.ErrorCodeUnknown
+			switch {
+			case tt.status >= 500:
+				wantCode = types.ErrorCodeDownstream5xx
+			case tt.status == http.StatusTooManyRequests:
+				wantCode = types.ErrorCodeRateLimited
+			}
+			if failure.Code != wantCode {
+				t.Errorf("Code = %s, want %s", failure.Code, wantCode)
+			}
+			if !strings.Contains(failure.Message, "receiver says no") {
+				t.Errorf("Expected the response body in the error, got %q", failure.Message)
+			}
+		})
+	}
+}
+
+func TestWebhookProcessorAuth(t *testing.T) {
+	tokens := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"access_token":"revoked","expires_in":3600}`)
+	}))
+	defer tokens.Close()
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(signing.SignatureHeader) == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer receiver.Close()
+
+	auth, err := webhookauth.New("secret", map[string]webhookauth.Credentials{
+		"crm": {OAuth2: &webhookauth.OAuth2{TokenURL: tokens.URL, ClientID: "taskflow"}},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create authenticator: %v", err)
+	}
+	processor := NewWebhookProcessor(WithAuthenticator(auth))
+
+	process := func(creds string) types.Failure {
+		payloadJSON, _ := json.Marshal(types.WebhookPayload{URL: receiver.URL, Method: "POST", Auth: creds})
+		_, err := processor.ProcessJob(context.Background(), &types.Job{ID: "test-webhook-auth", Type: types.JobTypeWebhook, Payload: payloadJSON})
+		if err == nil {
+			t.Fatalf("Expected an error for credentials %q", creds)
+		}
+		return types.FailureFrom(err)
+	}
+
+	// A rejected token is fetched again on the retry
+	if failure := process("crm"); failure.Permanent {
+		t.Errorf("Expected a 401 for an OAuth2 token to be retried, got %+v", failure)
+	}
+	// A 401 without a token to renew won't change on a retry
+	if failure := process(""); !failure.Permanent {
+		t.Errorf("Expected a 401 without credentials to fail for good, got %+v", failure)
+	}
+	if failure := process("missing"); !failure.Permanent {
+		t.Errorf("Expected unknown credentials to fail for good, got %+v", failure)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := map[string]time.Duration{
+		"30":                            30 * time.Second,
+		"Sat, 01 Jun 2024 12:05:00 GMT": 5 * time.Minute,
+		"Sat, 01 Jun 2024 11:00:00 GMT": 0,
+		"soon":                          0,
+		"":                              0,
+	}
+	for header, want := range tests {
+		if got := parseRetryAfter(header, now); got != want {
+			t.Errorf("parseRetryAfter(%q) = %v, want %v", header, got, want)
+		}
+	}
+}
+
 func TestImageResizeProcessor(t *testing.T) {
 	processor := NewImageResizeProcessor()
 
@@ -201,6 +532,146 @@ func TestImageResizeProcessor(t *testing.T) {
 	}
 }
 
+func TestImageResizeFormatsAndCrop(t *testing.T) {
+	processor := NewImageResizeProcessor()
+
+	payload := types.ImageResizePayload{
+		ImageURL:   "https://example.com/team.jpg",
+		Sizes:      []int{400},
+		Formats:    []string{"AVIF", "webp", "jpg"},
+		OutputPath: "/tmp/test",
+		Crop: &types.ImageCrop{
+			AspectRatio: "1:1",
+			Focus:       "focal",
+			FocalPoint:  &types.FocalPoint{X: 0.9, Y: 0.5},
+		},
+	}
+	payloadJSON, _ := json.Marshal(payload)
+	job := &types.Job{ID: "test-image-formats", Type: types.JobTypeImageResize, Payload: payloadJSON}
+
+	result, err := processor.ProcessJob(context.Background(), job)
+	if err != nil {
+		t.Fatalf("Expected no error processing image resize job, got %v", err)
+	}
+	var imageResult types.ImageResizeResult
+	if err := json.Unmarshal(result, &imageResult); err != nil {
+		t.Fatalf("Failed to unmarshal image result: %v", err)
+	}
+
+	want := []struct {
+		format  string
+		quality int
+	}{{"avif", 60}, {"webp", 80}, {"jpeg", 85}}
+	if len(imageResult.Images) != len(want) {
+		t.Fatalf("Expected %d variants, got %d", len(want), len(imageResult.Images))
+	}
+	for i, image := range imageResult.Images {
+		if image.Format != want[i].format || image.Quality != want[i].quality {
+			t.Errorf("Variant %d is %s at %d, want %s at %d", i, image.Format, image.Quality, want[i].format, want[i].quality)
+		}
+		if image.Width != 400 || image.Height != 400 {
+			t.Errorf("Variant %d is %dx%d, want 400x400", i, image.Width, image.Height)
+		}
+		// The square of the 1920x1080 original is pushed against its right
+		// edge, as far towards the focal point as it goes
+		if crop := image.Crop; crop == nil || *crop != (types.CropRegion{X: 840, Y: 0, Width: 1080, Height: 1080}) {
+			t.Errorf("Variant %d cropped to %+v, want the right-hand square", i, image.Crop)
+		}
+	}
+	if avif, jpeg := imageResult.Images[0].Size, imageResult.Images[2].Size; avif >= jpeg {
+		t.Errorf("Expected AVIF (%d bytes) smaller than JPEG (%d bytes)", avif, jpeg)
+	}
+
+	payload.Formats = []string{"bmp"}
+	payloadJSON, _ = json.Marshal(payload)
+	job.Payload = payloadJSON
+	if _, err := processor.ProcessJob(context.Background(), job); err == nil || !types.FailureFrom(err).Permanent {
+		t.Errorf("Expected an unsupported format to fail for good, got %v", err)
+	}
+}
+
+func TestImageResizeMaxSourceBytes(t *testing.T) {
+	processor := NewImageResizeProcessor(WithImageSettings(ImageSettings{MaxSourceBytes: 1 << 20}))
+	processor.probe = func(ctx context.Context, imageURL string) (*sourceImage, error) {
+		return &sourceImage{Width: 8000, Height: 6000, Size: 24 << 20, Format: "JPEG"}, nil
+	}
+
+	payloadJSON, _ := json.Marshal(types.ImageResizePayload{ImageURL: "https://example.com/huge.jpg", Sizes: []int{300}})
+	job := &types.Job{ID: "test-image-huge", Type: types.JobTypeImageResize, Payload: payloadJSON}
+	_, err := processor.ProcessJob(context.Background(), job)
+	if err == nil || !types.FailureFrom(err).Permanent {
+		t.Errorf("Expected an oversized original to fail for good, got %v", err)
+	}
+}
+
+func TestImageResizeEXIF(t *testing.T) {
+	processor := NewImageResizeProcessor()
+	processor.probe = func(ctx context.Context, imageURL string) (*sourceImage, error) {
+		// A portrait photo stored sideways, as phones do
+		return &sourceImage{
+			Width: 4000, Height: 3000, Size: 3000000, Format: "JPEG", ColorProfile: "Display P3",
+			EXIF: &exifData{Orientation: 6, Make: "Apple", Model: "iPhone 15", GPS: true},
+		}, nil
+	}
+
+	resize := func(preserve bool) types.ImageResizeResult {
+		payloadJSON, _ := json.Marshal(types.ImageResizePayload{
+			ImageURL: "https://example.com/portrait.jpg", Sizes: []int{300}, PreserveMeta: preserve,
+		})
+		job := &types.Job{ID: "test-image-exif", Type: types.JobTypeImageResize, Payload: payloadJSON}
+		result, err := processor.ProcessJob(context.Background(), job)
+		if err != nil {
+			t.Fatalf("Expected no error processing image resize job, got %v", err)
+		}
+		var imageResult types.ImageResizeResult
+		if err := json.Unmarshal(result, &imageResult); err != nil {
+			t.Fatalf("Failed to unmarshal image result: %v", err)
+		}
+		return imageResult
+	}
+
+	result := resize(false)
+	want := types.ImageMetadata{
+		OriginalWidth: 3000, OriginalHeight: 4000, OriginalSize: 3000000, Format: "JPEG",
+		Orientation: 6, Camera: "Apple iPhone 15", HasGPS: true, ColorProfile: "Display P3",
+	}
+	if result.Metadata != want {
+		t.Errorf("Metadata = %+v, want %+v", result.Metadata, want)
+	}
+	if image := result.Images[0]; image.Width != 300 || image.Height != 400 || image.EXIF {
+		t.Errorf("Image is %dx%d (EXIF kept: %v), want an upright 300x400 without EXIF", image.Width, image.Height, image.EXIF)
+	}
+
+	if image := resize(true).Images[0]; !image.EXIF {
+		t.Error("Expected EXIF kept with preserve_meta")
+	}
+}
+
+func TestCropRegion(t *testing.T) {
+	tests := []struct {
+		name   string
+		aspect float64
+		focus  types.FocalPoint
+		want   types.CropRegion
+	}{
+		{"centred square", 1, types.FocalPoint{X: 0.5, Y: 0.5}, types.CropRegion{X: 420, Y: 0, Width: 1080, Height: 1080}},
+		{"square at the left edge", 1, types.FocalPoint{X: 0, Y: 0.5}, types.CropRegion{X: 0, Y: 0, Width: 1080, Height: 1080}},
+		{"wide banner near the top", 4, types.FocalPoint{X: 0.5, Y: 0.1}, types.CropRegion{X: 0, Y: 0, Width: 1920, Height: 480}},
+		{"wide banner at the focus", 4, types.FocalPoint{X: 0.5, Y: 0.5}, types.CropRegion{X: 0, Y: 300, Width: 1920, Height: 480}},
+	}
+	for _, tt := range tests {
+		if got := cropRegion(1920, 1080, tt.aspect, tt.focus); *got != tt.want {
+			t.Errorf("%s: cropRegion() = %+v, want %+v", tt.name, *got, tt.want)
+		}
+	}
+
+	for _, ratio := range []string{"", "16", "0:9", "a:b", "16:-9"} {
+		if _, err := parseAspectRatio(ratio); err == nil {
+			t.Errorf("parseAspectRatio(%q) succeeded", ratio)
+		}
+	}
+}
+
 func TestDataExportProcessor(t *testing.T) {
 	processor := NewDataExportProcessor()
 
@@ -253,3 +724,181 @@ func TestDataExportProcessor(t *testing.T) {
 		t.Errorf("Expected format 'csv', got %s", exportResult.Format)
 	}
 }
+
+func TestDataExportColumnsAndFilters(t *testing.T) {
+	processor := NewDataExportProcessor()
+	payload := types.DataExportPayload{
+		ExportType:  "ndjson",
+		Query:       "SELECT * FROM users",
+		OutputPath:  filepath.Join(t.TempDir(), "active"),
+		Compression: "none",
+		Format: map[string]interface{}{"columns": []interface{}{
+			"id",
+			map[string]interface{}{"field": "email", "as": "Email"},
+			map[string]interface{}{"field": "value", "decimals": 1.0},
+		}},
+		Filters: map[string]interface{}{"status": "active"},
+	}
+	payloadJSON, _ := json.Marshal(payload)
+	job := &types.Job{ID: "test-export-spec", Type: types.JobTypeDataExport, Payload: payloadJSON}
+
+	raw, err := processor.ProcessJob(context.Background(), job)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	var result types.DataExportResult
+	json.Unmarshal(raw, &result)
+
+	data, err := os.ReadFile(result.FilePath)
+	if err != nil {
+		t.Fatalf("Failed to read export: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != result.RowCount || result.RowCount == 0 {
+		t.Fatalf("Export has %d lines, result says %d rows", len(lines), result.RowCount)
+	}
+	for _, line := range lines {
+		// Keys keep the order of the columns
+		if !strings.HasPrefix(line, `{"id":`) || !strings.Contains(line, `,"Email":"user`) || !strings.Contains(line, `,"value":`) {
+			t.Fatalf("Unexpected row %s", line)
+		}
+		if strings.Contains(line, "status") {
+			t.Fatalf("Row %s has a column that wasn't selected", line)
+		}
+	}
+
+	// Roughly a third of the mock rows are active
+	if result.RowCount >= 1000 {
+		t.Errorf("Expected the filter to drop rows, kept %d", result.RowCount)
+	}
+}
+
+func TestDataExportQueryGuards(t *testing.T) {
+	tests := map[string]struct {
+		processor *DataExportProcessor
+		query     string
+		params    []interface{}
+		want      string
+	}{
+		"table not allowed": {
+			NewDataExportProcessor(WithExportTables(map[string][]string{"default": {"orders"}})),
+			"SELECT * FROM users WHERE id > $1", []interface{}{10.0}, "table users is not allowed",
+		},
+		"unknown tenant": {
+			NewDataExportProcessor(WithExportTables(map[string][]string{"acme": {"users"}})),
+			"SELECT * FROM users", nil, "table users is not allowed",
+		},
+		"unbound placeholder": {
+			NewDataExportProcessor(), "SELECT * FROM users WHERE id > $1", nil, "has no param",
+		},
+		"too many rows": {
+			NewDataExportProcessor(WithExportLimits(0, 10)), "SELECT * FROM users", nil, "more than 10 rows",
+		},
+		"slow query": {
+			NewDataExportProcessor(WithExportLimits(50*time.Millisecond, 0)), "SELECT * FROM users", nil, "longer than 50ms",
+		},
+	}
+
+	for name, tt := range tests {
+		payloadJSON, _ := json.Marshal(types.DataExportPayload{
+			ExportType: "csv", Query: tt.query, Params: tt.params,
+			OutputPath: filepath.Join(t.TempDir(), "users"),
+		})
+		job := &types.Job{ID: "test-export-guard", Type: types.JobTypeDataExport, Payload: payloadJSON}
+
+		_, err := tt.processor.ProcessJob(context.Background(), job)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: Expected an error containing %q, got %v", name, tt.want, err)
+			continue
+		}
+		if !types.FailureFrom(err).Permanent {
+			t.Errorf("%s: Expected a permanent failure, got %v", name, err)
+		}
+	}
+}
+
+// presigningStore is a file store that signs fake download URLs
+type presigningStore struct {
+	*blobstore.FileStore
+}
+
+func (p presigningStore) PresignGet(ctx context.Context, ref string, ttl time.Duration) (string, error) {
+	return "https://downloads.example.com/export?expires=" + ttl.String(), nil
+}
+
+func TestDataExportToStore(t *testing.T) {
+	files, err := blobstore.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	processor := NewDataExportProcessor(WithExportStore(presigningStore{files}, time.Hour))
+
+	for _, exportType := range []string{"csv", "json", "ndjson"} {
+		payloadJSON, _ := json.Marshal(types.DataExportPayload{
+			ExportType: exportType, Query: "SELECT * FROM users", OutputPath: "/ignored/users",
+		})
+		job := &types.Job{ID: "test-export-" + exportType, Type: types.JobTypeDataExport, Payload: payloadJSON}
+
+		raw, err := processor.ProcessJob(context.Background(), job)
+		if err != nil {
+			t.Fatalf("%s: Expected no error, got %v", exportType, err)
+		}
+		var result types.DataExportResult
+		if err := json.Unmarshal(raw, &result); err != nil {
+			t.Fatalf("%s: Failed to unmarshal export result: %v", exportType, err)
+		}
+
+		if !strings.HasSuffix(result.FilePath, "/exports/default/"+job.ID+"/users."+exportType+".gz") {
+			t.Errorf("%s: Expected the export under exports/, got %s", exportType, result.FilePath)
+		}
+		if result.Compression != "gzip" || result.DownloadURL == "" || result.ExpiresAt == nil {
+			t.Errorf("%s: Expected a gzipped export with a download URL, got %+v", exportType, result)
+		}
+
+		// The stored export decompresses to the rows
+		body, err := files.Get(context.Background(), result.FilePath)
+		if err != nil {
+			t.Fatalf("%s: Failed to open export: %v", exportType, err)
+		}
+		data, _ := io.ReadAll(body)
+		body.Close()
+		if int64(len(data)) != result.FileSize {
+			t.Errorf("%s: file_size = %d, stored %d bytes", exportType, result.FileSize, len(data))
+		}
+		gz, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("%s: Export isn't gzipped: %v", exportType, err)
+		}
+		plain, err := io.ReadAll(gz)
+		if err != nil {
+			t.Fatalf("%s: Failed to decompress export: %v", exportType, err)
+		}
+
+		var rows int
+		switch exportType {
+		case "csv":
+			records, err := csv.NewReader(bytes.NewReader(plain)).ReadAll()
+			if err != nil {
+				t.Fatalf("csv: %v", err)
+			}
+			rows = len(records) - 1
+		case "json":
+			var doc struct {
+				Data  []map[string]interface{} `json:"data"`
+				Total int                      `json:"total"`
+			}
+			if err := json.Unmarshal(plain, &doc); err != nil {
+				t.Fatalf("json: %v", err)
+			}
+			if doc.Total != len(doc.Data) {
+				t.Errorf("json: total = %d, want %d", doc.Total, len(doc.Data))
+			}
+			rows = len(doc.Data)
+		case "ndjson":
+			rows = bytes.Count(plain, []byte("\n"))
+		}
+		if rows != result.RowCount {
+			t.Errorf("%s: Export has %d rows, result says %d", exportType, rows, result.RowCount)
+		}
+	}
+}
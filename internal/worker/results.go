@@ -0,0 +1,154 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"taskflow/internal/blobstore"
+	"taskflow/internal/storage"
+	"taskflow/internal/types"
+	"time"
+)
+
+// ResultTTLs sets how long completed jobs' results are kept. A zero TTL
+// keeps results until the job is deleted.
+type ResultTTLs struct {
+	Default time.Duration
+	ByType  map[types.JobType]time.Duration
+}
+
+// For returns the result TTL of a job type
+func (t ResultTTLs) For(jobType types.JobType) time.Duration {
+	if ttl, ok := t.ByType[jobType]; ok {
+		return ttl
+	}
+	return t.Default
+}
+
+// ParseResultTTLs parses per-type result TTLs in the form
+// "image_resize=24h,data_export=168h"
+func ParseResultTTLs(spec string) (map[types.JobType]time.Duration, error) {
+	ttls := make(map[types.JobType]time.Duration)
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		jobType, value, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid result TTL %q: expected type=duration", entry)
+		}
+		ttl, err := time.ParseDuration(strings.TrimSpace(value))
+		if err != nil || ttl < 0 {
+			return nil, fmt.Errorf("invalid result TTL for %s: %q", jobType, value)
+		}
+		ttls[types.JobType(strings.TrimSpace(jobType))] = ttl
+	}
+	return ttls, nil
+}
+
+// WithResultStore keeps results larger than the offloader's threshold in
+// blob storage instead of the database
+func WithResultStore(results *blobstore.ResultOffloader) Option {
+	return func(w *Worker) {
+		w.results = results
+	}
+}
+
+// WithResultTTLs expires completed jobs' results after the given TTLs
+func WithResultTTLs(ttls ResultTTLs) Option {
+	return func(w *Worker) {
+		w.resultTTLs = ttls
+	}
+}
+
+// saveResult stores a successful job's result apart from the job,
+// offloading it to blob storage if it is large
+func (w *Worker) saveResult(ctx context.Context, job *types.Job, result json.RawMessage) error {
+	if len(result) == 0 {
+		return nil
+	}
+
+	ref, err := w.results.Offload(ctx, job, result)
+	if err != nil {
+		return fmt.Errorf("failed to offload result: %w", err)
+	}
+
+	stored := &storage.JobResult{
+		JobID: job.ID,
+		Ref:   ref,
+		Size:  len(result),
+	}
+	if ref == "" {
+		stored.Result = result
+	}
+	return w.storeResult(ctx, job, stored)
+}
+
+// streamResult runs a processor that streams its result, copying the
+// result to blob storage and saving its reference and checksum. The job
+// then completes without an inline result.
+func (w *Worker) streamResult(ctx context.Context, job *types.Job, streamer ResultStreamer) error {
+	log.Printf("Processing job %s of type %s, streaming its result", job.ID, job.Type)
+
+	body, err := streamer.StreamJob(ctx, job)
+	if err != nil {
+		return err
+	}
+	if closer, ok := body.(io.Closer); ok {
+		defer closer.Close()
+	}
+
+	streamed, err := w.results.Stream(ctx, job, body)
+	if err != nil {
+		return fmt.Errorf("failed to stream result: %w", err)
+	}
+	log.Printf("Streamed result of job %s to %s (%d bytes, %s)", job.ID, streamed.Ref, streamed.Size, streamed.Checksum)
+
+	return w.storeResult(ctx, job, &storage.JobResult{
+		JobID:    job.ID,
+		Ref:      streamed.Ref,
+		Checksum: streamed.Checksum,
+		Size:     streamed.Size,
+	})
+}
+
+// storeResult saves a job's result record with its TTL, deleting the
+// result's blob if the record can't be saved
+func (w *Worker) storeResult(ctx context.Context, job *types.Job, stored *storage.JobResult) error {
+	now := time.Now()
+	stored.CreatedAt = now
+	if ttl := w.resultTTLs.For(job.Type); ttl > 0 {
+		expiresAt := now.Add(ttl)
+		stored.ExpiresAt = &expiresAt
+	}
+
+	if err := w.storage.SaveResult(ctx, stored); err != nil {
+		if stored.Ref != "" {
+			w.results.Delete(ctx, stored.Ref)
+		}
+		return err
+	}
+
+	job.ResultRef = stored.Ref
+	job.ResultChecksum = stored.Checksum
+	job.ResultExpiresAt = stored.ExpiresAt
+	return nil
+}
+
+// discardResult deletes the result saved for a job that was changed while
+// it ran
+func (w *Worker) discardResult(ctx context.Context, job *types.Job) error {
+	ref, err := w.storage.DeleteResult(ctx, job.ID)
+	if err != nil {
+		return err
+	}
+	if ref != "" {
+		return w.results.Delete(ctx, ref)
+	}
+	return nil
+}
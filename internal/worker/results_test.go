@@ -0,0 +1,31 @@
+package worker
+
+import (
+	"taskflow/internal/types"
+	"testing"
+	"time"
+)
+
+func TestParseResultTTLs(t *testing.T) {
+	ttls, err := ParseResultTTLs("image_resize=24h, data_export=168h,")
+	if err != nil {
+		t.Fatalf("ParseResultTTLs() error = %v", err)
+	}
+
+	resultTTLs := ResultTTLs{Default: time.Hour, ByType: ttls}
+	if got := resultTTLs.For(types.JobTypeImageResize); got != 24*time.Hour {
+		t.Errorf("image_resize TTL = %v, want 24h", got)
+	}
+	if got := resultTTLs.For(types.JobTypeDataExport); got != 168*time.Hour {
+		t.Errorf("data_export TTL = %v, want 168h", got)
+	}
+	if got := resultTTLs.For(types.JobTypeEmail); got != time.Hour {
+		t.Errorf("email TTL = %v, want default 1h", got)
+	}
+
+	for _, spec := range []string{"image_resize", "image_resize=soon", "image_resize=-1h"} {
+		if _, err := ParseResultTTLs(spec); err == nil {
+			t.Errorf("ParseResultTTLs(%q) succeeded, want error", spec)
+		}
+	}
+}
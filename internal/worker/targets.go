@@ -0,0 +1,96 @@
+package worker
+
+import (
+	"errors"
+	"log"
+	"sync"
+	"taskflow/internal/breaker"
+	"taskflow/internal/types"
+)
+
+// targetDownError is returned instead of running a job whose target's
+// circuit breaker is open. The worker parks the job rather than fail it.
+type targetDownError struct {
+	*breaker.OpenError
+}
+
+// targetBreakers keeps a circuit breaker per downstream target, so that
+// the jobs of a target that is down wait for it together instead of each
+// using up its attempts against it. Only targets with recent failures
+// have a breaker.
+type targetBreakers struct {
+	config breaker.Config
+
+	mu       sync.Mutex
+	breakers map[string]*breaker.Breaker
+}
+
+func newTargetBreakers(config breaker.Config) *targetBreakers {
+	return &targetBreakers{config: config, breakers: make(map[string]*breaker.Breaker)}
+}
+
+// allow returns a *targetDownError if jobs of target must not run now. A
+// nil targetBreakers allows every job.
+func (t *targetBreakers) allow(target string) error {
+	if t == nil || target == "" {
+		return nil
+	}
+	t.mu.Lock()
+	b := t.breakers[target]
+	t.mu.Unlock()
+
+	var open *breaker.OpenError
+	if err := b.Allow(); errors.As(err, &open) {
+		return &targetDownError{OpenError: open}
+	}
+	return nil
+}
+
+// report records the outcome of a job that ran against target. Failures
+// that another attempt may get past count against it; a success, or a
+// failure the target answered for good, such as a 4xx, shows that it is
+// up. Failures of the job's own making, such as an invalid payload, don't
+// count either way.
+func (t *targetBreakers) report(target string, err error) {
+	if t == nil || target == "" {
+		return
+	}
+
+	if err != nil {
+		failure := types.FailureFrom(err)
+		switch failure.Code {
+		case types.ErrorCodeValidation, types.ErrorCodeCancelled, types.ErrorCodePanic:
+			return
+		}
+		if !failure.Permanent {
+			t.failure(target)
+			return
+		}
+	}
+	t.success(target)
+}
+
+func (t *targetBreakers) failure(target string) {
+	t.mu.Lock()
+	b, ok := t.breakers[target]
+	if !ok {
+		b = breaker.New(target, t.config, breaker.WithOnChange(func(name string, state breaker.State) {
+			log.Printf("⚡ Circuit breaker of %s is now %s", name, state)
+		}))
+		t.breakers[target] = b
+	}
+	t.mu.Unlock()
+	b.Failure()
+}
+
+// success closes the target's breaker and forgets it, since a target
+// without failures needs none
+func (t *targetBreakers) success(target string) {
+	t.mu.Lock()
+	b, ok := t.breakers[target]
+	delete(t.breakers, target)
+	t.mu.Unlock()
+	if ok {
+		b.Success()
+	}
+}
@@ -0,0 +1,173 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"syscall"
+	"taskflow/internal/types"
+	"time"
+)
+
+// WebhookPolicy sets how webhook jobs, whose URLs come from users, are
+// sent: what they can reach, how much of a response they keep and how
+// their connections are pooled
+type WebhookPolicy struct {
+	// MaxResponseBytes caps the response body kept in a webhook's result.
+	// Zero keeps whole responses.
+	MaxResponseBytes int64
+
+	// MaxRedirects is how many redirects a webhook follows. Zero follows
+	// none; negative follows as many as Go's HTTP client does.
+	MaxRedirects int
+
+	// GuardNetworks refuses connections to loopback, private, link-local
+	// and other non-public addresses, except those in AllowedNetworks
+	GuardNetworks   bool
+	AllowedNetworks []netip.Prefix
+
+	// MaxIdleConnsPerHost is how many idle connections to each receiver
+	// are kept for reuse, and IdleConnTimeout how long. Zero keeps Go's
+	// defaults of 2 and 90s.
+	MaxIdleConnsPerHost int
+	IdleConnTimeout     time.Duration
+}
+
+// ParseNetworks parses a comma separated list of CIDRs or single
+// addresses, such as "10.1.0.0/16,192.168.5.10"
+func ParseNetworks(s string) ([]netip.Prefix, error) {
+	var networks []netip.Prefix
+	for _, field := range strings.Split(s, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		if !strings.Contains(field, "/") {
+			addr, err := netip.ParseAddr(field)
+			if err != nil {
+				return nil, fmt.Errorf("invalid network %q", field)
+			}
+			networks = append(networks, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(field)
+		if err != nil {
+			return nil, fmt.Errorf("invalid network %q", field)
+		}
+		networks = append(networks, prefix.Masked())
+	}
+	return networks, nil
+}
+
+// reservedNetworks are non-public ranges that netip.Addr has no method for
+var reservedNetworks = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),     // "this network"
+	netip.MustParsePrefix("100.64.0.0/10"), // carrier-grade NAT
+	netip.MustParsePrefix("192.0.0.0/24"),  // IETF protocol assignments
+	netip.MustParsePrefix("198.18.0.0/15"), // benchmarking
+	netip.MustParsePrefix("240.0.0.0/4"),   // reserved, and broadcast
+}
+
+// isPublic reports whether addr is a public unicast address
+func isPublic(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if addr.IsLoopback() || addr.IsPrivate() || addr.IsUnspecified() ||
+		addr.IsLinkLocalUnicast() || addr.IsMulticast() {
+		return false
+	}
+	for _, network := range reservedNetworks {
+		if network.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// allows reports whether webhooks may connect to addr
+func (p WebhookPolicy) allows(addr netip.Addr) bool {
+	if !p.GuardNetworks || isPublic(addr) {
+		return true
+	}
+	addr = addr.Unmap()
+	for _, network := range p.AllowedNetworks {
+		if network.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// BlockedAddressError is returned for a webhook whose host resolves to an
+// address the policy doesn't allow. It fails the job for good.
+type BlockedAddressError struct {
+	Addr netip.Addr
+}
+
+func (e *BlockedAddressError) Error() string {
+	return fmt.Sprintf("address %s is not allowed for webhooks", e.Addr)
+}
+
+// control checks each address a webhook connects to, after DNS resolution,
+// so a host can't resolve to a public address when checked and a private
+// one when dialled
+func (p WebhookPolicy) control(network, address string, _ syscall.RawConn) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return fmt.Errorf("invalid webhook address %q: %w", address, err)
+	}
+	if !p.allows(addrPort.Addr()) {
+		return types.Permanent(&BlockedAddressError{Addr: addrPort.Addr()})
+	}
+	return nil
+}
+
+// checkRedirect limits the number of redirects and refuses ones from HTTPS
+// to plain HTTP
+func (p WebhookPolicy) checkRedirect(req *http.Request, via []*http.Request) error {
+	if p.MaxRedirects >= 0 && len(via) > p.MaxRedirects {
+		return types.Permanent(fmt.Errorf("stopped after %d redirects", p.MaxRedirects))
+	}
+	if len(via) >= 10 {
+		return types.Permanent(fmt.Errorf("stopped after 10 redirects"))
+	}
+	if via[len(via)-1].URL.Scheme == "https" && req.URL.Scheme != "https" {
+		return types.Permanent(fmt.Errorf("refusing redirect from https to %s", req.URL.Scheme))
+	}
+	return nil
+}
+
+// transport creates the transport webhooks are sent through, which keeps
+// connections for reuse and speaks HTTP/2 to receivers that support it.
+// dial wraps each new connection, e.g. to count it.
+func (p WebhookPolicy) transport(dial func(net.Conn) net.Conn) *http.Transport {
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.ForceAttemptHTTP2 = true
+	if p.MaxIdleConnsPerHost > 0 {
+		transport.MaxIdleConnsPerHost = p.MaxIdleConnsPerHost
+		transport.MaxIdleConns = max(transport.MaxIdleConns, p.MaxIdleConnsPerHost)
+	}
+	if p.IdleConnTimeout > 0 {
+		transport.IdleConnTimeout = p.IdleConnTimeout
+	}
+	if p.GuardNetworks {
+		dialer.Control = p.control
+		// A proxy would be the only address checked, not the webhook's
+		transport.Proxy = nil
+	}
+	transport.DialContext = func(ctx context.Context, network, address string) (net.Conn, error) {
+		conn, err := dialer.DialContext(ctx, network, address)
+		if err != nil {
+			return nil, err
+		}
+		return dial(conn), nil
+	}
+	return transport
+}
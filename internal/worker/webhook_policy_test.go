@@ -0,0 +1,164 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"taskflow/internal/types"
+	"testing"
+	"time"
+)
+
+func TestParseNetworks(t *testing.T) {
+	networks, err := ParseNetworks(" 10.1.2.0/16, 192.168.5.10 ,fd00::/8")
+	if err != nil {
+		t.Fatalf("ParseNetworks: %v", err)
+	}
+	want := []string{"10.1.0.0/16", "192.168.5.10/32", "fd00::/8"}
+	if len(networks) != len(want) {
+		t.Fatalf("networks = %v, want %v", networks, want)
+	}
+	for i, network := range networks {
+		if network.String() != want[i] {
+			t.Errorf("network %d = %s, want %s", i, network, want[i])
+		}
+	}
+
+	if _, err := ParseNetworks("10.0.0.0/33"); err == nil {
+		t.Error("ParseNetworks accepted an invalid prefix")
+	}
+	if networks, err := ParseNetworks(""); err != nil || len(networks) != 0 {
+		t.Errorf("ParseNetworks(\"\") = %v, %v; want none", networks, err)
+	}
+}
+
+func TestWebhookPolicyAllows(t *testing.T) {
+	allowed, _ := ParseNetworks("10.1.0.0/16")
+	policy := WebhookPolicy{GuardNetworks: true, AllowedNetworks: allowed}
+
+	tests := map[string]bool{
+		"93.184.216.34":   true,
+		"2606:4700::1111": true,
+		"10.1.4.5":        true, // allowlisted
+		"10.2.4.5":        false,
+		"127.0.0.1":       false,
+		"::1":             false,
+		"169.254.169.254": false, // cloud metadata
+		"fe80::1":         false,
+		"172.16.0.1":      false,
+		"192.168.1.1":     false,
+		"100.64.0.1":      false,
+		"0.0.0.0":         false,
+		"::ffff:10.2.4.5": false,
+		"::ffff:10.1.4.5": true,
+	}
+	for addr, want := range tests {
+		if got := policy.allows(netip.MustParseAddr(addr)); got != want {
+			t.Errorf("allows(%s) = %v, want %v", addr, got, want)
+		}
+	}
+
+	if !(WebhookPolicy{}).allows(netip.MustParseAddr("127.0.0.1")) {
+		t.Error("policy without the guard refused a loopback address")
+	}
+}
+
+func TestWebhookProcessorPolicy(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/big", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(strings.Repeat("x", 100)))
+	})
+	mux.HandleFunc("/loop", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/loop", http.StatusFound)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	call := func(policy WebhookPolicy, path string) (types.WebhookResult, error) {
+		processor := NewWebhookProcessor(WithPolicy(policy))
+		payloadJSON, _ := json.Marshal(types.WebhookPayload{URL: server.URL + path, Method: "GET"})
+		job := &types.Job{ID: "test-webhook-policy", Type: types.JobTypeWebhook, Payload: payloadJSON}
+
+		var result types.WebhookResult
+		raw, err := processor.ProcessJob(context.Background(), job)
+		if err == nil {
+			json.Unmarshal(raw, &result)
+		}
+		return result, err
+	}
+
+	// The test server listens on loopback, which the guard refuses
+	_, err := call(WebhookPolicy{GuardNetworks: true}, "/big")
+	var blocked *BlockedAddressError
+	if !errors.As(err, &blocked) || !types.FailureFrom(err).Permanent {
+		t.Errorf("Expected a permanent BlockedAddressError, got %v", err)
+	}
+
+	loopback, _ := ParseNetworks("127.0.0.0/8,::1")
+	result, err := call(WebhookPolicy{GuardNetworks: true, AllowedNetworks: loopback, MaxResponseBytes: 10, MaxRedirects: 2}, "/big")
+	if err != nil {
+		t.Fatalf("Expected an allowlisted address to be reached, got %v", err)
+	}
+	if result.ResponseBody != strings.Repeat("x", 10) || !result.Truncated {
+		t.Errorf("Expected the body cut at 10 bytes, got %q (truncated: %v)", result.ResponseBody, result.Truncated)
+	}
+
+	_, err = call(WebhookPolicy{MaxRedirects: 2}, "/loop")
+	if err == nil || !strings.Contains(err.Error(), "stopped after 2 redirects") || !types.FailureFrom(err).Permanent {
+		t.Errorf("Expected a permanent redirect error, got %v", err)
+	}
+}
+
+func TestWebhookProcessorReusesConnections(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ok", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	})
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	processor := NewWebhookProcessor()
+	call := func(payload types.WebhookPayload) error {
+		payloadJSON, _ := json.Marshal(payload)
+		job := &types.Job{ID: "test-webhook-pool", Type: types.JobTypeWebhook, Payload: payloadJSON}
+		_, err := processor.ProcessJob(context.Background(), job)
+		return err
+	}
+
+	for i := 0; i < 3; i++ {
+		if err := call(types.WebhookPayload{URL: server.URL + "/ok", Method: "GET", Timeout: 5}); err != nil {
+			t.Fatalf("call %d: %v", i, err)
+		}
+	}
+	if stats := processor.PoolStats(); stats.Open != 1 || stats.Idle != 1 || stats.InUse != 0 {
+		t.Errorf("PoolStats() = %+v, want one idle connection reused by every call", stats)
+	}
+
+	// The payload's timeout bounds the call without a client of its own
+	start := time.Now()
+	if err := call(types.WebhookPayload{URL: server.URL + "/slow", Method: "GET", Timeout: 1}); err == nil {
+		t.Error("Expected the slow webhook to time out")
+	}
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Errorf("Timed out after %v, want about 1s", elapsed)
+	}
+
+	server.CloseClientConnections()
+	deadline := time.Now().Add(2 * time.Second)
+	for processor.PoolStats().Open != 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if stats := processor.PoolStats(); stats.Open != 0 {
+		t.Errorf("PoolStats() = %+v after the server closed them, want no connections", stats)
+	}
+}
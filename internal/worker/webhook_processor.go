@@ -7,36 +7,191 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"net"
 	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"taskflow/internal/metrics"
 	"taskflow/internal/types"
+	"taskflow/internal/webhookauth"
 	"time"
 )
 
+const (
+	// maxRetryAfter caps how long a Retry-After header can delay a retry
+	maxRetryAfter = time.Hour
+
+	// maxErrorBody bounds the response body quoted in a status error
+	maxErrorBody = 256
+)
+
+// WebhookStatusError is returned when the receiver answers a webhook with
+// an error status. 429 and 5xx responses are retryable, no sooner than
+// their Retry-After header asks, as is a 401 for an OAuth2 token, which is
+// fetched again. Any other 4xx is permanent.
+type WebhookStatusError struct {
+	StatusCode int
+	Body       string // start of the response body
+}
+
+func (e *WebhookStatusError) Error() string {
+	msg := fmt.Sprintf("status %d %s", e.StatusCode, http.StatusText(e.StatusCode))
+	if e.Body != "" {
+		msg += ": " + e.Body
+	}
+	return msg
+}
+
+// parseRetryAfter reads a Retry-After header, given either in seconds or
+// as an HTTP date, capped at maxRetryAfter
+func parseRetryAfter(header string, now time.Time) time.Duration {
+	var wait time.Duration
+	if seconds, err := strconv.Atoi(strings.TrimSpace(header)); err == nil {
+		wait = time.Duration(seconds) * time.Second
+	} else if at, err := http.ParseTime(header); err == nil {
+		wait = at.Sub(now)
+	}
+	return min(max(wait, 0), maxRetryAfter)
+}
+
 type WebhookProcessor struct {
-	client *http.Client
+	auth   *webhookauth.Authenticator
+	policy WebhookPolicy
+	proxy  *url.URL
+
+	mu      sync.Mutex
+	clients map[string]*http.Client // by credentials name
+
+	open     atomic.Int64 // connections open
+	inFlight atomic.Int64 // webhooks being sent
 }
 
-func NewWebhookProcessor() *WebhookProcessor {
-	return &WebhookProcessor{
-		client: &http.Client{
-			Timeout: 30 * time.Second,
-		},
+// countedConn is a webhook connection, counted as open until closed
+type countedConn struct {
+	net.Conn
+	once sync.Once
+	open *atomic.Int64
+}
+
+func (c *countedConn) Close() error {
+	c.once.Do(func() { c.open.Add(-1) })
+	return c.Conn.Close()
+}
+
+// WebhookOption configures a WebhookProcessor
+type WebhookOption func(*WebhookProcessor)
+
+// WithAuthenticator signs webhooks and authenticates them with the
+// credentials payloads name through a. Without it, webhooks are only
+// signed with their payload's own secret.
+func WithAuthenticator(a *webhookauth.Authenticator) WebhookOption {
+	return func(w *WebhookProcessor) {
+		w.auth = a
+	}
+}
+
+// WithPolicy limits what webhooks can reach and how much of a response
+// they keep. Without it, they reach any address, follow Go's default
+// redirects and keep whole responses.
+func WithPolicy(p WebhookPolicy) WebhookOption {
+	return func(w *WebhookProcessor) {
+		w.policy = p
+	}
+}
+
+// WithProxy sends webhooks through the proxy at u. The network policy
+// then only checks the proxy's address, so the proxy must keep webhooks
+// off internal networks.
+func WithProxy(u *url.URL) WebhookOption {
+	return func(w *WebhookProcessor) {
+		w.proxy = u
+	}
+}
+
+func NewWebhookProcessor(opts ...WebhookOption) *WebhookProcessor {
+	w := &WebhookProcessor{
+		policy:  WebhookPolicy{MaxRedirects: -1},
+		clients: make(map[string]*http.Client),
+	}
+	for _, opt := range opts {
+		opt(w)
+	}
+	return w
+}
+
+// PoolStats reports the processor's connections. Connections serving
+// webhooks are estimated as the webhooks in flight, as HTTP/2 sends
+// several over one connection.
+func (w *WebhookProcessor) PoolStats() metrics.PoolStats {
+	open := int(w.open.Load())
+	inUse := min(int(w.inFlight.Load()), open)
+	return metrics.PoolStats{Open: open, InUse: inUse, Idle: open - inUse}
+}
+
+// countConn counts a new connection as open until it is closed
+func (w *WebhookProcessor) countConn(conn net.Conn) net.Conn {
+	w.open.Add(1)
+	return &countedConn{Conn: conn, open: &w.open}
+}
+
+// client returns the HTTP client for webhooks sent with the named
+// credentials, which present their certificate if they have one. Clients
+// share nothing but their settings, as connections presenting different
+// certificates can't be reused for one another.
+func (w *WebhookProcessor) client(creds string) (*http.Client, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if client, ok := w.clients[creds]; ok {
+		return client, nil
+	}
+
+	tlsConfig, err := w.auth.TLSConfig(creds)
+	if err != nil {
+		return nil, err
+	}
+	transport := w.policy.transport(w.countConn)
+	if w.proxy != nil {
+		transport.Proxy = http.ProxyURL(w.proxy)
+	}
+	if tlsConfig != nil {
+		transport.TLSClientConfig = tlsConfig
 	}
+
+	client := &http.Client{Transport: transport, CheckRedirect: w.policy.checkRedirect}
+	w.clients[creds] = client
+	return client, nil
 }
 
 func (w *WebhookProcessor) SupportedJobTypes() []types.JobType {
 	return []types.JobType{types.JobTypeWebhook}
 }
 
+// Target is the host a webhook job calls, as in "webhook:api.example.com"
+func (w *WebhookProcessor) Target(job *types.Job) string {
+	var payload types.WebhookPayload
+	if err := json.Unmarshal(job.Payload, &payload); err != nil {
+		return ""
+	}
+	u, err := url.Parse(payload.URL)
+	if err != nil || u.Hostname() == "" {
+		return ""
+	}
+	return "webhook:" + strings.ToLower(u.Hostname())
+}
+
 func (w *WebhookProcessor) ProcessJob(ctx context.Context, job *types.Job) (json.RawMessage, error) {
 	// Parse the webhook payload
 	var payload types.WebhookPayload
 	if err := json.Unmarshal(job.Payload, &payload); err != nil {
-		return nil, fmt.Errorf("invalid webhook payload: %w", err)
+		return nil, validationError(fmt.Errorf("invalid webhook payload: %w", err))
 	}
 
-	log.Printf("Making webhook call to %s", payload.URL)
+	log.Printf("Making webhook call to %s", JobContextFrom(ctx).Redact("$.url", payload.URL))
 
 	start := time.Now()
 	result, err := w.makeWebhookCall(ctx, payload)
@@ -57,10 +212,24 @@ func (w *WebhookProcessor) ProcessJob(ctx context.Context, job *types.Job) (json
 }
 
 func (w *WebhookProcessor) makeWebhookCall(ctx context.Context, payload types.WebhookPayload) (*types.WebhookResult, error) {
+	// Calls are bounded by the job type's timeout, or the payload's
+	if payload.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(payload.Timeout)*time.Second)
+		defer cancel()
+	}
+	ctx = httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			metrics.IncWebhookConnections(info.Reused)
+		},
+	})
+
 	// Prepare request body
 	var body io.Reader
+	var jsonData []byte
 	if payload.Data != nil {
-		jsonData, err := json.Marshal(payload.Data)
+		var err error
+		jsonData, err = json.Marshal(payload.Data)
 		if err != nil {
 			return nil, fmt.Errorf("failed to marshal request data: %w", err)
 		}
@@ -73,6 +242,12 @@ func (w *WebhookProcessor) makeWebhookCall(ctx context.Context, payload types.We
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
+	// Credentials missing from this worker's config won't appear on a retry
+	client, err := w.client(payload.Auth)
+	if err != nil {
+		return nil, types.Permanent(err)
+	}
+
 	// Set headers
 	if payload.Data != nil {
 		req.Header.Set("Content-Type", "application/json")
@@ -82,26 +257,33 @@ func (w *WebhookProcessor) makeWebhookCall(ctx context.Context, payload types.We
 		req.Header.Set(key, value)
 	}
 
-	// Set custom timeout if specified
-	client := w.client
-	if payload.Timeout > 0 {
-		client = &http.Client{
-			Timeout: time.Duration(payload.Timeout) * time.Second,
-		}
+	// Credentials are applied last, so payload headers can't replace them
+	if err := w.auth.Authenticate(ctx, req, jsonData, payload.Auth, payload.SigningSecret); err != nil {
+		return nil, fmt.Errorf("failed to authenticate request: %w", err)
 	}
 
 	// Make the request
+	w.inFlight.Add(1)
+	defer w.inFlight.Add(-1)
 	resp, err := client.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("request failed: %w", err)
 	}
 	defer resp.Body.Close()
 
-	// Read response body
-	responseBody, err := io.ReadAll(resp.Body)
+	// Read response body, up to the policy's limit
+	var reader io.Reader = resp.Body
+	if w.policy.MaxResponseBytes > 0 {
+		reader = io.LimitReader(resp.Body, w.policy.MaxResponseBytes+1)
+	}
+	responseBody, err := io.ReadAll(reader)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read response body: %w", err)
 	}
+	truncated := w.policy.MaxResponseBytes > 0 && int64(len(responseBody)) > w.policy.MaxResponseBytes
+	if truncated {
+		responseBody = responseBody[:w.policy.MaxResponseBytes]
+	}
 
 	// Extract response headers
 	responseHeaders := make(map[string]string)
@@ -114,10 +296,33 @@ func (w *WebhookProcessor) makeWebhookCall(ctx context.Context, payload types.We
 	result := &types.WebhookResult{
 		StatusCode:   resp.StatusCode,
 		ResponseBody: string(responseBody),
+		Truncated:    truncated,
 		Headers:      responseHeaders,
 	}
 
-	log.Printf("🔗 Webhook call to %s completed with status %d", payload.URL, resp.StatusCode)
+	log.Printf("🔗 Webhook call to %s completed with status %d", JobContextFrom(ctx).Redact("$.url", payload.URL), resp.StatusCode)
+
+	if resp.StatusCode >= 400 {
+		body := string(responseBody)
+		if len(body) > maxErrorBody {
+			body = strings.ToValidUTF8(body[:maxErrorBody], "") + "..."
+		}
+		statusErr := &WebhookStatusError{StatusCode: resp.StatusCode, Body: body}
+
+		// The token may have been revoked; the retry fetches a new one
+		tokenExpired := resp.StatusCode == http.StatusUnauthorized && w.auth.Invalidate(payload.Auth)
+		if !tokenExpired && resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode < 500 {
+			return nil, types.Permanent(statusErr)
+		}
+		var err error = statusErr
+		switch {
+		case resp.StatusCode >= 500:
+			err = types.WithErrorCode(types.ErrorCodeDownstream5xx, statusErr)
+		case resp.StatusCode == http.StatusTooManyRequests:
+			err = types.WithErrorCode(types.ErrorCodeRateLimited, statusErr)
+		}
+		return nil, types.Retryable(err, parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()))
+	}
 
 	return result, nil
 }
@@ -2,11 +2,26 @@ package worker
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"math/rand/v2"
+	"runtime/debug"
+	"sync"
+	"taskflow/internal/blobstore"
+	"taskflow/internal/breaker"
+	"taskflow/internal/emailtemplate"
+	"taskflow/internal/events"
+	"taskflow/internal/jobstate"
+	"taskflow/internal/lock"
+	"taskflow/internal/metrics"
+	"taskflow/internal/notify"
 	"taskflow/internal/queue"
+	"taskflow/internal/redact"
 	"taskflow/internal/storage"
 	"taskflow/internal/types"
+	"taskflow/internal/workflow"
 	"time"
 
 	"github.com/google/uuid"
@@ -14,32 +29,219 @@ import (
 
 type Worker struct {
 	ID             string
-	queue          *queue.RedisQueue
-	storage        *storage.PostgresStorage
+	queue          queue.Queue
+	storage        storage.Storage
 	registry       *ProcessorRegistry
 	pollInterval   time.Duration
+	concurrency    int
+	drainTimeout   time.Duration
+	jobTimeout     time.Duration
 	shutdown       chan struct{}
+	shutdownOnce   sync.Once
+	done           chan struct{}
 	supportedTypes []types.JobType
+	degraded       map[types.JobType]string // job types whose processor failed its self-check
+	events         *events.Bus
+	offloader      *blobstore.PayloadOffloader
+	results        *blobstore.ResultOffloader
+	resultTTLs     ResultTTLs
+	workflows      *workflow.Coordinator
+	states         *jobstate.Manager
+	redactor       *redact.Redactor
+	resultRedactor *redact.Redactor
+	failures       *notify.FailureNotifier
+	locker         *lock.Locker
+	targets        *targetBreakers
+
+	// Processors registered with options, in place of the registry's
+	templates *emailtemplate.Renderer
+	overrides []JobProcessor
+
+	// cancelJobs aborts in-flight jobs once the drain timeout expires
+	cancelJobs context.CancelFunc
+
+	mu         sync.Mutex
+	status     string
+	activeJobs []inFlightJob         // oldest first
+	typeJobs   map[types.JobType]int // in-flight jobs by type
+	typeFreed  chan struct{}         // signalled when a job finishes
+	running    chan struct{}         // closed while the worker is not paused
+}
+
+// Option configures optional Worker dependencies
+type Option func(*Worker)
+
+// WithEventBus publishes job lifecycle events to the given bus
+func WithEventBus(bus *events.Bus) Option {
+	return func(w *Worker) {
+		w.events = bus
+	}
+}
+
+// WithConcurrency sets how many jobs the worker processes at once.
+// All executors share one dequeue loop, heartbeat and registration.
+func WithConcurrency(n int) Option {
+	return func(w *Worker) {
+		if n > 0 {
+			w.concurrency = n
+		}
+	}
+}
+
+// WithDrainTimeout bounds how long a remotely requested shutdown waits for
+// in-flight jobs
+func WithDrainTimeout(d time.Duration) Option {
+	return func(w *Worker) {
+		w.drainTimeout = d
+	}
+}
+
+// WithPollInterval sets how long a dequeue waits for a job before the
+// worker checks for shutdown and polls again
+func WithPollInterval(d time.Duration) Option {
+	return func(w *Worker) {
+		if d > 0 {
+			w.pollInterval = d
+		}
+	}
+}
+
+// WithJobTimeout bounds an attempt of a job whose type sets no timeout of
+// its own. Zero means no timeout.
+func WithJobTimeout(d time.Duration) Option {
+	return func(w *Worker) {
+		w.jobTimeout = d
+	}
+}
+
+// WithPayloadOffloader restores payloads that the API offloaded to blob storage
+func WithPayloadOffloader(offloader *blobstore.PayloadOffloader) Option {
+	return func(w *Worker) {
+		w.offloader = offloader
+	}
+}
+
+// WithRedactor masks the payload fields matched by r in the worker's logs
+func WithRedactor(r *redact.Redactor) Option {
+	return func(w *Worker) {
+		w.redactor = r
+	}
+}
+
+// WithResultRedactor masks the values matched by r in job results before
+// they are stored or published
+func WithResultRedactor(r *redact.Redactor) Option {
+	return func(w *Worker) {
+		w.resultRedactor = r
+	}
+}
+
+// WithFailureNotifier reports jobs that fail for good to the chat webhooks
+// of their type
+func WithFailureNotifier(n *notify.FailureNotifier) Option {
+	return func(w *Worker) {
+		w.failures = n
+	}
+}
+
+// WithLocker shares the locks processors take through JobContext.Lock
+// across workers. Without it, locks only exclude jobs in the same process.
+func WithLocker(l *lock.Locker) Option {
+	return func(w *Worker) {
+		w.locker = l
+	}
+}
+
+// WithTargetBreakers parks the jobs of a downstream target, such as a
+// webhook host, after config.FailureThreshold consecutive failures of its
+// jobs, for config.OpenTimeout, instead of running them and using up their
+// attempts. After that one job is let through as a trial.
+func WithTargetBreakers(config breaker.Config) Option {
+	return func(w *Worker) {
+		if config.FailureThreshold > 0 {
+			w.targets = newTargetBreakers(config)
+		}
+	}
+}
+
+// WithEmailTemplates renders the templates email jobs name with r
+func WithEmailTemplates(r *emailtemplate.Renderer) Option {
+	return func(w *Worker) {
+		w.templates = r
+	}
+}
+
+// WithProcessors runs jobs with the processors of r, configured from the
+// processors section of the config. Without it, the default processors
+// run with their default settings.
+func WithProcessors(r *ProcessorRegistry) Option {
+	return func(w *Worker) {
+		w.registry = r
+	}
+}
+
+// WithProcessor registers p in place of the default processor for its job
+// type, e.g. a webhook processor with credentials and a network policy
+func WithProcessor(p JobProcessor) Option {
+	return func(w *Worker) {
+		w.overrides = append(w.overrides, p)
+	}
 }
 
-func NewWorker(queue *queue.RedisQueue, storage *storage.PostgresStorage) *Worker {
-	registry := NewProcessorRegistry()
+func NewWorker(queue queue.Queue, storage storage.Storage, opts ...Option) *Worker {
+	// The zero config is valid
+	registry, _ := NewProcessorRegistry(ProcessorConfig{})
 	workerID := fmt.Sprintf("worker-%s", uuid.New().String()[:8])
 
-	return &Worker{
-		ID:             workerID,
-		queue:          queue,
-		storage:        storage,
-		registry:       registry,
-		pollInterval:   5 * time.Second,
-		shutdown:       make(chan struct{}),
-		supportedTypes: registry.GetSupportedJobTypes(),
+	w := &Worker{
+		ID:           workerID,
+		queue:        queue,
+		storage:      storage,
+		registry:     registry,
+		pollInterval: 5 * time.Second,
+		concurrency:  1,
+		drainTimeout: 30 * time.Second,
+		shutdown:     make(chan struct{}),
+		done:         make(chan struct{}),
+		status:       types.WorkerStatusStarting,
+		running:      make(chan struct{}),
+		typeJobs:     make(map[types.JobType]int),
+		typeFreed:    make(chan struct{}, 1),
+		locker:       lock.NewMemoryLocker(),
 	}
+	close(w.running)
+
+	for _, opt := range opts {
+		opt(w)
+	}
+	if w.templates != nil {
+		w.registry.RegisterProcessor(NewEmailProcessor(WithSMTP(w.registry.config.Email), WithTemplateRenderer(w.templates)))
+	}
+	for _, p := range w.overrides {
+		w.registry.RegisterProcessor(p)
+	}
+	w.supportedTypes = w.registry.GetSupportedJobTypes()
+
+	w.states = jobstate.NewManager(queue, storage)
+	w.workflows = workflow.NewCoordinator(queue, storage,
+		workflow.WithEventBus(w.events),
+		workflow.WithPayloadOffloader(w.offloader),
+		workflow.WithResultStore(w.results),
+	)
+
+	return w
 }
 
-// Start begins the worker's job processing loop
+// Start runs the worker's dequeue loop and executor pool. It returns once
+// Stop or Shutdown is called and in-flight jobs have finished, or when ctx
+// is cancelled.
 func (w *Worker) Start(ctx context.Context) error {
-	log.Printf("Starting worker %s", w.ID)
+	defer close(w.done)
+
+	log.Printf("Starting worker %s with %d executors", w.ID, w.concurrency)
+	if err := w.selfCheck(ctx); err != nil {
+		return err
+	}
 	log.Printf("Supported job types: %v", w.supportedTypes)
 
 	// Register worker in database
@@ -47,109 +249,515 @@ func (w *Worker) Start(ctx context.Context) error {
 		return fmt.Errorf("failed to register worker: %w", err)
 	}
 
-	// Start heartbeat goroutine
+	// Jobs run under their own context so that stopping the dequeue loop
+	// doesn't interrupt them; only the drain timeout or ctx does
+	jobCtx, cancelJobs := context.WithCancel(ctx)
+	defer cancelJobs()
+	w.mu.Lock()
+	w.cancelJobs = cancelJobs
+	w.mu.Unlock()
+
+	// Dequeueing stops as soon as shutdown begins
+	dequeueCtx, cancelDequeue := context.WithCancel(ctx)
+	defer cancelDequeue()
+	go func() {
+		select {
+		case <-w.shutdown:
+			cancelDequeue()
+		case <-dequeueCtx.Done():
+		}
+	}()
+
+	w.setStatus(ctx, types.WorkerStatusIdle)
+
+	// Start heartbeat and remote control goroutines
 	go w.heartbeat(ctx)
+	go w.watchControl(ctx)
+
+	// slots bounds the number of dequeued jobs to the executor count, so a
+	// job is only taken off the queue once an executor is about to run it
+	slots := make(chan struct{}, w.concurrency)
+	jobs := make(chan *types.Job)
+
+	var executors sync.WaitGroup
+	for i := 0; i < w.concurrency; i++ {
+		executors.Add(1)
+		go func() {
+			defer executors.Done()
+			for job := range jobs {
+				w.executeJob(jobCtx, job)
+				w.typeFinished(job.Type)
+				<-slots
+			}
+		}()
+	}
+
+	err := w.dequeueLoop(ctx, dequeueCtx, slots, jobs)
 
-	// Main processing loop
+	// Wait for in-flight jobs before reporting the worker stopped
+	close(jobs)
+	executors.Wait()
+
+	// Hand the affinity keys this worker held to the others
+	releaseCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+	defer cancel()
+	if releaseErr := w.queue.ReleaseAffinity(releaseCtx, w.ID); releaseErr != nil {
+		log.Printf("Worker %s failed to release affinity keys: %v", w.ID, releaseErr)
+	}
+
+	return err
+}
+
+// dequeueLoop hands jobs to executors until shutdown or ctx cancellation
+func (w *Worker) dequeueLoop(ctx, dequeueCtx context.Context, slots chan struct{}, jobs chan<- *types.Job) error {
 	for {
+		// Hold off while paused, then wait for a free executor
 		select {
 		case <-ctx.Done():
 			log.Printf("Worker %s shutting down due to context cancellation", w.ID)
 			return ctx.Err()
 		case <-w.shutdown:
-			log.Printf("Worker %s shutting down", w.ID)
+			log.Printf("Worker %s stopped dequeueing", w.ID)
 			return nil
-		default:
-			if err := w.processNextJob(ctx); err != nil {
-				log.Printf("Error processing job: %v", err)
-				// Continue processing other jobs even if one fails
+		case <-w.runningGate():
+		}
+
+		select {
+		case <-ctx.Done():
+			log.Printf("Worker %s shutting down due to context cancellation", w.ID)
+			return ctx.Err()
+		case <-w.shutdown:
+			log.Printf("Worker %s stopped dequeueing", w.ID)
+			return nil
+		case slots <- struct{}{}:
+		}
+
+		jobTypes := w.dequeueTypes()
+		if len(jobTypes) == 0 {
+			// Every type is disabled or at its concurrency limit; wait for
+			// a job to finish or the config to change
+			<-slots
+			select {
+			case <-dequeueCtx.Done():
+			case <-w.typeFreed:
+			case <-time.After(w.pollInterval):
+			}
+			continue
+		}
+
+		// Try to dequeue a job (with timeout)
+		job, err := w.queue.DequeueJob(dequeueCtx, w.ID, jobTypes, w.pollInterval)
+		if err != nil || job == nil {
+			<-slots
+			if err != nil && dequeueCtx.Err() == nil {
+				log.Printf("Error processing job: failed to dequeue job: %v", err)
+				// Wait for an open circuit breaker instead of spinning on it
+				var open *breaker.OpenError
+				if errors.As(err, &open) {
+					select {
+					case <-time.After(open.RetryAfter):
+					case <-dequeueCtx.Done():
+					}
+				}
 			}
+			continue
 		}
+
+		w.typeStarted(job.Type)
+		jobs <- job
+	}
+}
+
+// dequeueTypes returns the supported job types the worker may take another
+// job of: those that are enabled and below their concurrency limit
+func (w *Worker) dequeueTypes() []types.JobType {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	jobTypes := make([]types.JobType, 0, len(w.supportedTypes))
+	for _, jobType := range w.supportedTypes {
+		config := types.DefaultJobTypes.For(jobType)
+		if !config.IsEnabled() {
+			continue
+		}
+		if config.Concurrency > 0 && w.typeJobs[jobType] >= config.Concurrency {
+			continue
+		}
+		jobTypes = append(jobTypes, jobType)
 	}
+	return jobTypes
+}
+
+// typeStarted counts a dequeued job against its type's concurrency limit
+func (w *Worker) typeStarted(jobType types.JobType) {
+	w.mu.Lock()
+	w.typeJobs[jobType]++
+	w.mu.Unlock()
 }
 
-// Stop gracefully shuts down the worker
+// typeFinished releases a finished job's place in its type's concurrency
+// limit and wakes the dequeue loop if it is waiting for one
+func (w *Worker) typeFinished(jobType types.JobType) {
+	w.mu.Lock()
+	w.typeJobs[jobType]--
+	w.mu.Unlock()
+
+	select {
+	case w.typeFreed <- struct{}{}:
+	default:
+	}
+}
+
+// Stop makes the worker stop dequeueing new jobs. In-flight jobs keep running.
 func (w *Worker) Stop() {
-	close(w.shutdown)
+	w.shutdownOnce.Do(func() {
+		close(w.shutdown)
+	})
 }
 
-// processNextJob fetches and processes the next available job
-func (w *Worker) processNextJob(ctx context.Context) error {
-	// Try to dequeue a job (with timeout)
-	job, err := w.queue.DequeueJob(ctx, w.ID, w.pollInterval)
-	if err != nil {
-		return fmt.Errorf("failed to dequeue job: %w", err)
+// Shutdown drains the worker: it stops dequeueing, waits for in-flight jobs
+// to finish until ctx expires, then aborts and requeues the rest. The worker
+// is marked draining while this happens and offline once it's done.
+func (w *Worker) Shutdown(ctx context.Context) error {
+	// Status writes must outlive the drain deadline
+	statusCtx := context.WithoutCancel(ctx)
+
+	w.setStatus(statusCtx, types.WorkerStatusDraining)
+	w.Stop()
+
+	var err error
+	select {
+	case <-w.done:
+	case <-ctx.Done():
+		log.Printf("Worker %s drain timeout reached, aborting %d in-flight jobs", w.ID, len(w.CurrentJobs()))
+		w.mu.Lock()
+		if w.cancelJobs != nil {
+			w.cancelJobs()
+		}
+		w.mu.Unlock()
+		<-w.done
+		err = ctx.Err()
 	}
 
-	// No job available
-	if job == nil {
-		return nil
+	w.setStatus(statusCtx, types.WorkerStatusOffline)
+	if err := w.queue.ClearWorkerCommand(statusCtx, w.ID); err != nil {
+		log.Printf("Failed to clear worker command: %v", err)
 	}
+	log.Printf("Worker %s is offline", w.ID)
+
+	return err
+}
+
+// CurrentJobs returns the IDs of the jobs being processed, oldest first
+func (w *Worker) CurrentJobs() []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.currentJobIDs()
+}
+
+// currentJobIDs returns the IDs of the in-flight jobs. w.mu must be held.
+func (w *Worker) currentJobIDs() []string {
+	ids := make([]string, len(w.activeJobs))
+	for i, job := range w.activeJobs {
+		ids[i] = job.ID
+	}
+	return ids
+}
+
+// executeJob processes a dequeued job and records its outcome.
+// jobCtx is cancelled only when the job must be aborted.
+func (w *Worker) executeJob(jobCtx context.Context, job *types.Job) {
+	// Bookkeeping writes must succeed even if the job itself is aborted
+	ctx := context.WithoutCancel(jobCtx)
 
 	log.Printf("Worker %s processing job %s (type: %s)", w.ID, job.ID, job.Type)
+	w.states.Claimed(ctx, job)
+	w.events.PublishJob(ctx, events.EventJobStarted, job)
 
 	// Update worker status
-	w.updateWorkerStatus(ctx, "processing", job.ID)
+	w.jobStarted(ctx, job)
+	defer w.jobFinished(ctx, job.ID)
+
+	// A job redelivered after its result was recorded but never acknowledged
+	// already ran; finish it without running the processor again
+	if result, ok := w.processedResult(ctx, job); ok {
+		log.Printf("Job %s already succeeded on attempt %d, completing without rerunning", job.ID, job.Attempts+1)
+		w.completeJob(ctx, job, result)
+		return
+	}
 
 	// Process the job
 	startTime := time.Now()
-	result, err := w.registry.ProcessJob(ctx, job)
+	result, err := w.processJob(w.withJobContext(jobCtx, job), job)
 	processingDuration := time.Since(startTime)
 
+	if jobCtx.Err() != nil {
+		// Aborted by shutdown: hand the job back without counting an attempt
+		log.Printf("Job %s interrupted after %v, requeueing", job.ID, processingDuration)
+		w.requeueJob(ctx, job)
+		return
+	}
+
+	var down *targetDownError
+	if errors.As(err, &down) {
+		w.parkJob(ctx, job, down)
+		return
+	}
+
 	if err != nil {
 		// Job failed
 		log.Printf("Job %s failed after %v: %v", job.ID, processingDuration, err)
 
-		// Check if error is retryable
-		if types.IsRetryableError(err) && job.Attempts < job.MaxAttempts {
+		failure := types.FailureFrom(err)
+
+		// Processors mark failures permanent or retryable with typed errors
+		if failure.Permanent {
+			log.Printf("Job %s failed permanently, not retrying", job.ID)
+		} else if failure.Retry(job.Attempts, job.MaxAttempts) {
 			log.Printf("Job %s will be retried (attempt %d/%d)", job.ID, job.Attempts+1, job.MaxAttempts)
 		}
 
-		if err := w.queue.FailJob(ctx, job.ID, err.Error()); err != nil {
+		if err := w.states.Fail(ctx, job, failure); errors.Is(err, queue.ErrJobConflict) {
+			// Cancelled or finished elsewhere; keep that outcome
+			log.Printf("Job %s changed while running, discarding failure: %v", job.ID, err)
+			return
+		} else if err != nil {
 			log.Printf("Failed to mark job as failed: %v", err)
+			return
 		}
 
-		// Update job in database
-		job.Status = types.JobStatusFailed
-		job.Error = err.Error()
-		job.Attempts++
-		now := time.Now()
-		job.UpdatedAt = now
-		if job.Attempts >= job.MaxAttempts {
-			job.CompletedAt = &now
+		if job.Status == types.JobStatusFailed {
+			w.events.PublishJob(ctx, events.EventJobFailed, job)
+			w.failures.JobFailed(ctx, job)
+			w.enqueueFollowUp(ctx, job, "on_failure", job.OnFailure)
+			w.advanceWorkflow(ctx, job)
+		} else {
+			w.events.PublishJob(ctx, events.EventJobRetrying, job)
 		}
-		w.storage.UpdateJob(ctx, job)
 	} else {
 		// Job succeeded
 		log.Printf("Job %s completed successfully in %v", job.ID, processingDuration)
 
-		if err := w.queue.CompleteJob(ctx, job.ID, result); err != nil {
-			log.Printf("Failed to mark job as completed: %v", err)
+		result = w.resultRedactor.Redact(result)
+
+		// Record the result before acknowledging the job, so a redelivery
+		// after a lost acknowledgement reuses it
+		if err := w.storage.MarkProcessed(ctx, job.ID, job.Attempts, result); err != nil {
+			log.Printf("Failed to record result of job %s: %v", job.ID, err)
 		}
+		w.completeJob(ctx, job, result)
+	}
+}
+
+// completeJob acknowledges a successful job and records its result. The
+// result is stored apart from the job, so the queue only records the
+// completion.
+func (w *Worker) completeJob(ctx context.Context, job *types.Job, result json.RawMessage) {
+	if err := w.saveResult(ctx, job, result); err != nil {
+		// The recorded result is kept for the job's redelivery
+		log.Printf("Failed to store result of job %s: %v", job.ID, err)
+		return
+	}
+
+	if err := w.states.Complete(ctx, job); errors.Is(err, queue.ErrJobConflict) {
+		log.Printf("Job %s changed while running, discarding result: %v", job.ID, err)
+		if err := w.discardResult(ctx, job); err != nil {
+			log.Printf("Failed to discard result of job %s: %v", job.ID, err)
+		}
+		w.clearProcessed(ctx, job)
+		return
+	} else if err != nil {
+		// The recorded result is kept for the job's redelivery
+		log.Printf("Failed to mark job as completed: %v", err)
+		return
+	}
+	w.clearProcessed(ctx, job)
+
+	job.Result = result
+	w.events.PublishJob(ctx, events.EventJobCompleted, job)
+
+	w.enqueueFollowUp(ctx, job, "on_success", job.OnSuccess)
+	w.advanceWorkflow(ctx, job)
+}
+
+// advanceWorkflow queues the workflow steps unblocked by a finished job
+func (w *Worker) advanceWorkflow(ctx context.Context, job *types.Job) {
+	if err := w.workflows.JobFinished(ctx, job); err != nil {
+		log.Printf("Failed to advance workflow %s after job %s: %v", job.WorkflowID, job.ID, err)
+	}
+}
 
-		// Update job in database
-		job.Status = types.JobStatusCompleted
-		job.Result = result
-		now := time.Now()
-		job.UpdatedAt = now
-		job.CompletedAt = &now
-		w.storage.UpdateJob(ctx, job)
+// enqueueFollowUp creates and queues the job a finished job asked for on
+// this outcome, if any. The follow-up's ID is fixed by its parent, so a
+// parent that finishes again after a redelivery doesn't create it twice.
+func (w *Worker) enqueueFollowUp(ctx context.Context, parent *types.Job, outcome string, spec *types.JobRequest) {
+	if spec == nil {
+		return
 	}
 
-	// Update worker status back to idle
-	w.updateWorkerStatus(ctx, "idle", "")
+	job := types.NewFollowUpJob(parent, outcome, spec)
+	if _, err := w.storage.GetJob(ctx, job.ID); err == nil {
+		log.Printf("Follow-up job %s of job %s already exists", job.ID, parent.ID)
+		return
+	} else if !errors.Is(err, storage.ErrJobNotFound) {
+		log.Printf("Failed to check for follow-up job %s: %v", job.ID, err)
+		return
+	}
+
+	if _, err := w.offloader.Offload(ctx, job); err != nil {
+		log.Printf("Failed to offload payload of follow-up job %s: %v", job.ID, err)
+		return
+	}
+	if err := w.storage.CreateJob(ctx, job); err != nil {
+		log.Printf("Failed to create follow-up job %s: %v", job.ID, err)
+		return
+	}
+	if err := w.queue.EnqueueJob(ctx, job); err != nil {
+		log.Printf("Failed to enqueue follow-up job %s: %v", job.ID, err)
+		return
+	}
+
+	log.Printf("Job %s %s, enqueued follow-up job %s (%s)", parent.ID, parent.Status, job.ID, job.Type)
+	w.events.PublishJob(ctx, events.EventJobCreated, job)
+}
+
+// processedResult returns the recorded result of the job's current attempt,
+// if it already succeeded. If the ledger can't be read the job runs again.
+func (w *Worker) processedResult(ctx context.Context, job *types.Job) (json.RawMessage, bool) {
+	result, ok, err := w.storage.ProcessedResult(ctx, job.ID, job.Attempts)
+	if err != nil {
+		log.Printf("Failed to check whether job %s already ran: %v", job.ID, err)
+		return nil, false
+	}
+	return result, ok
+}
 
+// clearProcessed drops a job's recorded results once it's acknowledged;
+// the job's status then stops it from being claimed again
+func (w *Worker) clearProcessed(ctx context.Context, job *types.Job) {
+	if err := w.storage.ClearProcessed(ctx, job.ID); err != nil {
+		log.Printf("Failed to clear recorded results of job %s: %v", job.ID, err)
+	}
+}
+
+// processJob restores an offloaded payload and runs the job's processor,
+// streaming its result to blob storage if the processor supports it
+func (w *Worker) processJob(ctx context.Context, job *types.Job) (json.RawMessage, error) {
+	if err := w.offloader.Rehydrate(ctx, job); err != nil {
+		return nil, err
+	}
+
+	// Jobs with an affinity key run in order, so they are never parked
+	target := w.registry.GetTarget(job)
+	if job.AffinityKey == "" {
+		if err := w.targets.allow(target); err != nil {
+			return nil, err
+		}
+	}
+
+	timeout := time.Duration(types.DefaultJobTypes.For(job.Type).Timeout)
+	if timeout == 0 {
+		timeout = w.jobTimeout
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	// Streamed results are saved as they are produced, so the job
+	// completes without an inline result
+	var result json.RawMessage
+	var err error
+	err = recoverPanic(job, func() error {
+		var err error
+		if streamer, ok := w.registry.GetStreamer(job.Type); ok && w.results != nil {
+			err = w.streamResult(ctx, job, streamer)
+		} else {
+			result, err = w.registry.ProcessJob(ctx, job)
+		}
+		return err
+	})
+	// An attempt aborted by shutdown says nothing about its target
+	if !errors.Is(ctx.Err(), context.Canceled) {
+		w.targets.report(target, err)
+	}
+	if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return nil, types.WithErrorCode(types.ErrorCodeTimeout, fmt.Errorf("job exceeded its timeout of %v: %w", timeout, err))
+	}
+	return result, err
+}
+
+// recoverPanic runs a job's processor, failing the attempt with the PANIC
+// error code if it panics rather than taking the worker down
+func recoverPanic(job *types.Job, process func() error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("Processor of job %s panicked: %v\n%s", job.ID, r, debug.Stack())
+			err = types.WithErrorCode(types.ErrorCodePanic, fmt.Errorf("processor panicked: %v", r))
+		}
+	}()
+	return process()
+}
+
+// requeueJob returns an unfinished job to the pending queue
+func (w *Worker) requeueJob(ctx context.Context, job *types.Job) {
+	if err := w.states.Requeue(ctx, job); err != nil {
+		log.Printf("Failed to requeue job %s: %v", job.ID, err)
+	}
+}
+
+// parkJob puts off a job whose target is down until its breaker lets a
+// trial job through, plus up to as long again, so that the parked jobs of
+// a target don't all come back at once
+func (w *Worker) parkJob(ctx context.Context, job *types.Job, down *targetDownError) {
+	until := time.Now().Add(down.RetryAfter + rand.N(down.RetryAfter+1))
+	log.Printf("Job %s parked until %s: %v", job.ID, until.Format(time.RFC3339), down)
+	if err := w.states.Park(ctx, job, until, down.Error()); err != nil {
+		log.Printf("Failed to park job %s: %v", job.ID, err)
+		return
+	}
+	metrics.IncJobsParked(string(job.Type))
+}
+
+// selfCheck runs the processors' self-checks and marks the worker
+// degraded for the job types that fail, so that it neither claims nor
+// advertises them. It fails only if no job type is left.
+func (w *Worker) selfCheck(ctx context.Context) error {
+	failed := w.registry.SelfCheck(ctx)
+	if len(failed) == 0 {
+		return nil
+	}
+
+	degraded := make(map[types.JobType]string, len(failed))
+	for jobType, err := range failed {
+		degraded[jobType] = err.Error()
+		log.Printf("Worker %s is degraded: not running %s jobs: %v", w.ID, jobType, err)
+	}
+
+	w.mu.Lock()
+	w.degraded = degraded
+	w.supportedTypes = w.registry.GetSupportedJobTypes()
+	w.mu.Unlock()
+
+	if len(w.supportedTypes) == 0 {
+		return fmt.Errorf("no job type passed its self-check")
+	}
 	return nil
 }
 
 // registerWorker registers this worker in the database
 func (w *Worker) registerWorker(ctx context.Context) error {
+	w.mu.Lock()
 	worker := &types.Worker{
-		ID:       w.ID,
-		Status:   "starting",
-		LastSeen: time.Now(),
-		JobTypes: w.supportedTypes,
+		ID:          w.ID,
+		Status:      types.WorkerStatusStarting,
+		LastSeen:    time.Now(),
+		JobTypes:    w.supportedTypes,
+		Concurrency: w.concurrency,
+		Degraded:    w.degraded,
 	}
+	w.mu.Unlock()
 
 	return w.storage.RegisterWorker(ctx, worker)
 }
@@ -163,22 +771,78 @@ func (w *Worker) heartbeat(ctx context.Context) {
 		select {
 		case <-ctx.Done():
 			return
-		case <-w.shutdown:
+		case <-w.done:
 			return
 		case <-ticker.C:
-			w.updateWorkerStatus(ctx, "idle", "")
+			w.updateWorkerStatus(ctx)
+			w.pollControl(ctx)
+		}
+	}
+}
+
+// setStatus records a lifecycle status locally and in the database.
+// Once draining, the worker only moves to offline.
+func (w *Worker) setStatus(ctx context.Context, status string) {
+	w.mu.Lock()
+	if w.status != types.WorkerStatusOffline &&
+		(w.status != types.WorkerStatusDraining || status == types.WorkerStatusOffline) {
+		w.status = status
+	}
+	w.mu.Unlock()
+
+	w.updateWorkerStatus(ctx)
+}
+
+// jobStarted marks a job as in flight
+func (w *Worker) jobStarted(ctx context.Context, job *types.Job) {
+	w.mu.Lock()
+	w.activeJobs = append(w.activeJobs, inFlightJob{
+		ID:        job.ID,
+		Type:      job.Type,
+		Attempt:   job.Attempts + 1,
+		StartedAt: time.Now(),
+	})
+	if w.status == types.WorkerStatusIdle {
+		w.status = types.WorkerStatusProcessing
+	}
+	w.mu.Unlock()
+
+	w.updateWorkerStatus(ctx)
+}
+
+// jobFinished removes a job from the in-flight set
+func (w *Worker) jobFinished(ctx context.Context, jobID string) {
+	w.mu.Lock()
+	for i, job := range w.activeJobs {
+		if job.ID == jobID {
+			w.activeJobs = append(w.activeJobs[:i], w.activeJobs[i+1:]...)
+			break
 		}
 	}
+	if w.status == types.WorkerStatusProcessing && len(w.activeJobs) == 0 {
+		w.status = types.WorkerStatusIdle
+	}
+	w.mu.Unlock()
+
+	w.updateWorkerStatus(ctx)
 }
 
-// updateWorkerStatus updates the worker's status in the database
-func (w *Worker) updateWorkerStatus(ctx context.Context, status, currentJob string) {
+// updateWorkerStatus writes the worker's current state to the database
+func (w *Worker) updateWorkerStatus(ctx context.Context) {
+	w.mu.Lock()
 	worker := &types.Worker{
-		ID:         w.ID,
-		Status:     status,
-		LastSeen:   time.Now(),
-		JobTypes:   w.supportedTypes,
-		CurrentJob: currentJob,
+		ID:          w.ID,
+		Status:      w.status,
+		LastSeen:    time.Now(),
+		JobTypes:    w.supportedTypes,
+		Concurrency: w.concurrency,
+		CurrentJobs: w.currentJobIDs(),
+		Degraded:    w.degraded,
+	}
+	w.mu.Unlock()
+
+	if len(worker.CurrentJobs) > 0 {
+		worker.CurrentJob = worker.CurrentJobs[0]
 	}
 
 	if err := w.storage.RegisterWorker(ctx, worker); err != nil {
@@ -0,0 +1,289 @@
+package worker
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	// xlsxMaxRows is the most rows a sheet can have, header included
+	xlsxMaxRows = 1048576
+
+	// xlsxMaxSheetName is the longest sheet name Excel accepts
+	xlsxMaxSheetName = 31
+
+	// xlsxMaxCellText is the longest text a cell can hold
+	xlsxMaxCellText = 32767
+)
+
+// Cell styles, indexes into cellXfs of xlsxStyles
+const (
+	xlsxStyleDefault = 0
+	xlsxStyleHeader  = 1
+	xlsxStyleDate    = 2
+)
+
+// xlsxOptions are the settings of an xlsx export, from its payload's
+// "format" object
+type xlsxOptions struct {
+	sheetName    string // "sheet_name", default "Export"
+	rowsPerSheet int    // "rows_per_sheet", excluding the header
+}
+
+// parseXLSXOptions reads the settings of an xlsx export
+func parseXLSXOptions(format map[string]interface{}) (xlsxOptions, error) {
+	opts := xlsxOptions{sheetName: "Export", rowsPerSheet: xlsxMaxRows - 1}
+
+	if v, ok := format["sheet_name"]; ok {
+		name, ok := v.(string)
+		if !ok || strings.TrimSpace(name) == "" {
+			return opts, fmt.Errorf("xlsx sheet_name must be a non-empty string")
+		}
+		opts.sheetName = name
+	}
+	if v, ok := format["rows_per_sheet"]; ok {
+		n, ok := v.(float64)
+		if !ok || n != math.Trunc(n) || n < 1 || n > xlsxMaxRows-1 {
+			return opts, fmt.Errorf("xlsx rows_per_sheet must be a whole number from 1 to %d", xlsxMaxRows-1)
+		}
+		opts.rowsPerSheet = int(n)
+	}
+	return opts, nil
+}
+
+// xlsxSheetName makes name a valid sheet name, numbered from the second
+// sheet on as in "Export (2)"
+func xlsxSheetName(name string, number int) string {
+	name = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`[]:*?/\`, r) {
+			return '_'
+		}
+		return r
+	}, name)
+	name = strings.Trim(name, "'")
+	if name == "" {
+		name = "Export"
+	}
+
+	suffix := ""
+	if number > 1 {
+		suffix = fmt.Sprintf(" (%d)", number)
+	}
+	if limit := xlsxMaxSheetName - len(suffix); utf8.RuneCountInString(name) > limit {
+		name = string([]rune(name)[:limit])
+	}
+	return name + suffix
+}
+
+// xlsxRowWriter writes an Excel workbook. Rows are streamed into the sheet
+// being written, and a new sheet is started every rowsPerSheet rows. As the
+// number of sheets is only known at the end, the workbook parts listing
+// them are written last, which the format allows.
+type xlsxRowWriter struct {
+	opts xlsxOptions
+	zip  *zip.Writer
+
+	sheet   *bufio.Writer // nil before the first sheet
+	sheets  int
+	rows    int // rows in the current sheet, excluding the header
+	columns []string
+}
+
+func newXLSXRowWriter(w io.Writer, opts xlsxOptions) *xlsxRowWriter {
+	return &xlsxRowWriter{opts: opts, zip: zip.NewWriter(w)}
+}
+
+func (x *xlsxRowWriter) Header(columns []string) error {
+	x.columns = columns
+	return nil
+}
+
+func (x *xlsxRowWriter) Write(values []interface{}) error {
+	if x.sheet == nil || x.rows == x.opts.rowsPerSheet {
+		if err := x.startSheet(); err != nil {
+			return err
+		}
+	}
+
+	x.rows++
+	fmt.Fprintf(x.sheet, `<row r="%d">`, x.rows+1)
+	for _, value := range values {
+		writeXLSXCell(x.sheet, value)
+	}
+	_, err := x.sheet.WriteString("</row>")
+	return err
+}
+
+// startSheet finishes the current sheet and starts the next with the
+// header row, frozen so it stays in view
+func (x *xlsxRowWriter) startSheet() error {
+	if err := x.endSheet(); err != nil {
+		return err
+	}
+
+	x.sheets++
+	part, err := x.zip.Create(fmt.Sprintf("xl/worksheets/sheet%d.xml", x.sheets))
+	if err != nil {
+		return err
+	}
+	x.sheet = bufio.NewWriter(part)
+	x.rows = 0
+
+	x.sheet.WriteString(xml.Header)
+	x.sheet.WriteString(`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">`)
+	x.sheet.WriteString(`<sheetViews><sheetView workbookViewId="0"><pane ySplit="1" topLeftCell="A2" activePane="bottomLeft" state="frozen"/></sheetView></sheetViews>`)
+	x.sheet.WriteString(`<sheetData><row r="1">`)
+	for _, column := range x.columns {
+		writeXLSXText(x.sheet, column, xlsxStyleHeader)
+	}
+	_, err = x.sheet.WriteString("</row>")
+	return err
+}
+
+func (x *xlsxRowWriter) endSheet() error {
+	if x.sheet == nil {
+		return nil
+	}
+	x.sheet.WriteString("</sheetData></worksheet>")
+	return x.sheet.Flush()
+}
+
+// Close finishes the last sheet and writes the parts describing the
+// workbook. An export without rows has a single sheet with only the
+// header, if there is one.
+func (x *xlsxRowWriter) Close() error {
+	if x.sheet == nil {
+		if err := x.startSheet(); err != nil {
+			return err
+		}
+	}
+	if err := x.endSheet(); err != nil {
+		return err
+	}
+
+	var workbook, rels, contentTypes strings.Builder
+	workbook.WriteString(xml.Header)
+	workbook.WriteString(`<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets>`)
+	rels.WriteString(xml.Header)
+	rels.WriteString(`<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">`)
+	contentTypes.WriteString(xml.Header)
+	contentTypes.WriteString(`<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">`)
+	contentTypes.WriteString(`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>`)
+	contentTypes.WriteString(`<Default Extension="xml" ContentType="application/xml"/>`)
+	contentTypes.WriteString(`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>`)
+	contentTypes.WriteString(`<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>`)
+	for i := 1; i <= x.sheets; i++ {
+		workbook.WriteString(`<sheet name="`)
+		xml.EscapeText(&workbook, []byte(xlsxSheetName(x.opts.sheetName, i)))
+		fmt.Fprintf(&workbook, `" sheetId="%d" r:id="rId%d"/>`, i, i)
+		fmt.Fprintf(&rels, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet%d.xml"/>`, i, i)
+		fmt.Fprintf(&contentTypes, `<Override PartName="/xl/worksheets/sheet%d.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>`, i)
+	}
+	workbook.WriteString(`</sheets></workbook>`)
+	fmt.Fprintf(&rels, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>`, x.sheets+1)
+	rels.WriteString(`</Relationships>`)
+	contentTypes.WriteString(`</Types>`)
+
+	parts := []struct{ name, content string }{
+		{"xl/workbook.xml", workbook.String()},
+		{"xl/_rels/workbook.xml.rels", rels.String()},
+		{"xl/styles.xml", xlsxStyles},
+		{"_rels/.rels", xlsxRootRels},
+		{"[Content_Types].xml", contentTypes.String()},
+	}
+	for _, p := range parts {
+		part, err := x.zip.Create(p.name)
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(part, p.content); err != nil {
+			return err
+		}
+	}
+	return x.zip.Close()
+}
+
+// writeXLSXCell writes value as a typed cell: numbers and booleans as
+// such, dates as dates and anything else as text
+func writeXLSXCell(w *bufio.Writer, value interface{}) {
+	switch v := value.(type) {
+	case nil:
+		w.WriteString("<c/>")
+	case bool:
+		b := "0"
+		if v {
+			b = "1"
+		}
+		fmt.Fprintf(w, `<c t="b"><v>%s</v></c>`, b)
+	case int:
+		fmt.Fprintf(w, `<c><v>%d</v></c>`, v)
+	case int64:
+		fmt.Fprintf(w, `<c><v>%d</v></c>`, v)
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			writeXLSXText(w, strconv.FormatFloat(v, 'g', -1, 64), xlsxStyleDefault)
+			return
+		}
+		fmt.Fprintf(w, `<c><v>%s</v></c>`, strconv.FormatFloat(v, 'g', -1, 64))
+	case time.Time:
+		writeXLSXDate(w, v)
+	case string:
+		if t, err := time.Parse("2006-01-02", v); err == nil {
+			writeXLSXDate(w, t)
+			return
+		}
+		writeXLSXText(w, v, xlsxStyleDefault)
+	default:
+		writeXLSXText(w, fmt.Sprintf("%v", v), xlsxStyleDefault)
+	}
+}
+
+// xlsxEpoch is day 0 of Excel's date serial numbers
+var xlsxEpoch = time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+
+// writeXLSXDate writes t as a date serial number, in days, shown as a date
+func writeXLSXDate(w *bufio.Writer, t time.Time) {
+	wall := time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.UTC)
+	days := wall.Sub(xlsxEpoch).Hours() / 24
+	fmt.Fprintf(w, `<c s="%d"><v>%s</v></c>`, xlsxStyleDate, strconv.FormatFloat(days, 'f', -1, 64))
+}
+
+// writeXLSXText writes s as an inline string cell, cut at the longest text
+// a cell holds
+func writeXLSXText(w *bufio.Writer, s string, style int) {
+	if len(s) > xlsxMaxCellText && utf8.RuneCountInString(s) > xlsxMaxCellText {
+		s = string([]rune(s)[:xlsxMaxCellText])
+	}
+	if style != xlsxStyleDefault {
+		fmt.Fprintf(w, `<c s="%d" t="inlineStr"><is><t xml:space="preserve">`, style)
+	} else {
+		w.WriteString(`<c t="inlineStr"><is><t xml:space="preserve">`)
+	}
+	xml.EscapeText(w, []byte(s))
+	w.WriteString(`</t></is></c>`)
+}
+
+const xlsxRootRels = xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+	`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+	`</Relationships>`
+
+// xlsxStyles has a default style, a bold, shaded header and a date format
+const xlsxStyles = xml.Header + `<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` +
+	`<fonts count="2"><font><sz val="11"/><name val="Calibri"/></font><font><b/><sz val="11"/><name val="Calibri"/></font></fonts>` +
+	`<fills count="3"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill>` +
+	`<fill><patternFill patternType="solid"><fgColor rgb="FFD9E1F2"/><bgColor indexed="64"/></patternFill></fill></fills>` +
+	`<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>` +
+	`<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>` +
+	`<cellXfs count="3"><xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/>` +
+	`<xf numFmtId="0" fontId="1" fillId="2" borderId="0" xfId="0" applyFont="1" applyFill="1"/>` +
+	`<xf numFmtId="14" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/></cellXfs>` +
+	`<cellStyles count="1"><cellStyle name="Normal" xfId="0" builtinId="0"/></cellStyles>` +
+	`</styleSheet>`
@@ -0,0 +1,115 @@
+package worker
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestXLSXRowWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w := newXLSXRowWriter(&buf, xlsxOptions{sheetName: "Q1 [draft]", rowsPerSheet: 2})
+	if err := w.Header([]string{"active", "created_at", "id", "name", "value"}); err != nil {
+		t.Fatalf("Header() error = %v", err)
+	}
+	for i := 0; i < 5; i++ {
+		if err := w.Write([]interface{}{true, "2024-03-01", i + 1, "<Record & co>", 1.5}); err != nil {
+			t.Fatalf("Write() error = %v", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	archive, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("Workbook isn't a zip file: %v", err)
+	}
+	parts := make(map[string]string)
+	for _, f := range archive.File {
+		r, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := io.ReadAll(r)
+		r.Close()
+		parts[f.Name] = string(data)
+
+		// Every part is well-formed XML
+		dec := xml.NewDecoder(bytes.NewReader(data))
+		for {
+			if _, err := dec.Token(); err == io.EOF {
+				break
+			} else if err != nil {
+				t.Fatalf("%s isn't well-formed: %v", f.Name, err)
+			}
+		}
+	}
+
+	for _, name := range []string{"[Content_Types].xml", "_rels/.rels", "xl/workbook.xml", "xl/_rels/workbook.xml.rels", "xl/styles.xml",
+		"xl/worksheets/sheet1.xml", "xl/worksheets/sheet2.xml", "xl/worksheets/sheet3.xml"} {
+		if _, ok := parts[name]; !ok {
+			t.Errorf("Workbook is missing %s", name)
+		}
+	}
+
+	workbook := parts["xl/workbook.xml"]
+	for _, name := range []string{`name="Q1 _draft_"`, `name="Q1 _draft_ (2)"`, `name="Q1 _draft_ (3)"`} {
+		if !strings.Contains(workbook, name) {
+			t.Errorf("workbook.xml doesn't list the sheet %s: %s", name, workbook)
+		}
+	}
+
+	// Two rows and the header on full sheets, one on the last
+	sheet1, sheet3 := parts["xl/worksheets/sheet1.xml"], parts["xl/worksheets/sheet3.xml"]
+	if got := strings.Count(sheet1, "<row "); got != 3 {
+		t.Errorf("sheet1 has %d rows, want 3", got)
+	}
+	if got := strings.Count(sheet3, "<row "); got != 2 {
+		t.Errorf("sheet3 has %d rows, want 2", got)
+	}
+
+	for _, cell := range []string{
+		`<c s="1" t="inlineStr"><is><t xml:space="preserve">active</t></is></c>`, // styled header
+		`<c t="b"><v>1</v></c>`,     // boolean
+		`<c s="2"><v>45352</v></c>`, // date serial of 2024-03-01
+		`<c><v>1</v></c>`,           // number
+		`&lt;Record &amp; co&gt;`,   // escaped text
+		`<c><v>1.5</v></c>`,
+	} {
+		if !strings.Contains(sheet1, cell) {
+			t.Errorf("sheet1 is missing %s", cell)
+		}
+	}
+}
+
+func TestXLSXOptions(t *testing.T) {
+	opts, err := parseXLSXOptions(map[string]interface{}{"sheet_name": "Users", "rows_per_sheet": float64(1000)})
+	if err != nil || opts.sheetName != "Users" || opts.rowsPerSheet != 1000 {
+		t.Errorf("parseXLSXOptions() = %+v, %v", opts, err)
+	}
+	if opts, _ := parseXLSXOptions(nil); opts.rowsPerSheet != xlsxMaxRows-1 {
+		t.Errorf("Default rows per sheet = %d, want Excel's limit", opts.rowsPerSheet)
+	}
+
+	invalid := []map[string]interface{}{
+		{"sheet_name": ""},
+		{"sheet_name": 5.0},
+		{"rows_per_sheet": 0.0},
+		{"rows_per_sheet": 2.5},
+		{"rows_per_sheet": float64(xlsxMaxRows)},
+	}
+	for _, format := range invalid {
+		if _, err := parseXLSXOptions(format); err == nil {
+			t.Errorf("parseXLSXOptions(%v) succeeded", format)
+		}
+	}
+
+	long := strings.Repeat("x", 40)
+	if got := xlsxSheetName(long, 12); got != strings.Repeat("x", 26)+" (12)" {
+		t.Errorf("xlsxSheetName() = %q, want it cut to 31 characters", got)
+	}
+}
@@ -0,0 +1,231 @@
+package workflow
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"taskflow/internal/blobstore"
+	"taskflow/internal/events"
+	"taskflow/internal/queue"
+	"taskflow/internal/storage"
+	"taskflow/internal/types"
+	"time"
+)
+
+// Coordinator advances workflows: it queues a workflow's first steps when
+// it is created and the steps that become runnable as each step's job
+// finishes. Workflow state lives in PostgreSQL, so the API and any worker
+// can advance any workflow.
+type Coordinator struct {
+	queue     queue.Queue
+	storage   storage.Storage
+	events    *events.Bus
+	offloader *blobstore.PayloadOffloader
+	results   *blobstore.ResultOffloader
+}
+
+// Option configures optional Coordinator dependencies
+type Option func(*Coordinator)
+
+// WithEventBus publishes job.created events for step jobs
+func WithEventBus(bus *events.Bus) Option {
+	return func(c *Coordinator) {
+		c.events = bus
+	}
+}
+
+// WithPayloadOffloader moves large step payloads to blob storage
+func WithPayloadOffloader(offloader *blobstore.PayloadOffloader) Option {
+	return func(c *Coordinator) {
+		c.offloader = offloader
+	}
+}
+
+// WithResultStore loads step results that were offloaded to blob storage
+func WithResultStore(results *blobstore.ResultOffloader) Option {
+	return func(c *Coordinator) {
+		c.results = results
+	}
+}
+
+// NewCoordinator creates a coordinator that queues step jobs on q
+func NewCoordinator(q queue.Queue, s storage.Storage, opts ...Option) *Coordinator {
+	c := &Coordinator{
+		queue:   q,
+		storage: s,
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c
+}
+
+// Start stores a new workflow and queues the steps that can run at once
+func (c *Coordinator) Start(ctx context.Context, wf *types.Workflow) error {
+	if err := c.storage.CreateWorkflow(ctx, wf); err != nil {
+		return err
+	}
+
+	updated, err := c.advance(ctx, wf.ID, nil)
+	if err != nil {
+		return err
+	}
+	*wf = *updated
+	return nil
+}
+
+// JobFinished records the outcome of a job that completed or failed for
+// good and, if it ran a workflow step, queues the steps it unblocks. Jobs
+// outside workflows are ignored.
+func (c *Coordinator) JobFinished(ctx context.Context, job *types.Job) error {
+	if c == nil || job.WorkflowID == "" {
+		return nil
+	}
+
+	_, err := c.advance(ctx, job.WorkflowID, job)
+	return err
+}
+
+// advance records job's outcome, if any, and queues the workflow's newly
+// runnable steps or its next compensation.
+//
+// Steps are marked running before their jobs are created. Every job of a
+// running step or compensation that doesn't exist yet is created here, so
+// one left out by a failure is picked up the next time the workflow
+// advances.
+func (c *Coordinator) advance(ctx context.Context, workflowID string, job *types.Job) (*types.Workflow, error) {
+	wf, err := c.storage.UpdateWorkflow(ctx, workflowID, func(wf *types.Workflow) error {
+		if job != nil {
+			wf.RecordJob(job)
+		}
+		wf.Advance(time.Now())
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if wf.Status != types.WorkflowStatusRunning {
+		log.Printf("Workflow %s %s", wf.ID, wf.Status)
+	}
+
+	if err := c.startJobs(ctx, wf, wf.ActiveJobs()); err != nil {
+		return wf, fmt.Errorf("failed to start steps of workflow %s: %w", wf.ID, err)
+	}
+
+	return wf, nil
+}
+
+// startJobs creates and queues the jobs of ready steps, except those that
+// exist. A fan-out step can start many jobs at once, so they are stored
+// with one batch insert and queued in batches.
+func (c *Coordinator) startJobs(ctx context.Context, wf *types.Workflow, jobs []*types.Job) error {
+	if len(jobs) == 0 {
+		return nil
+	}
+
+	ids := make([]string, len(jobs))
+	for i, job := range jobs {
+		ids[i] = job.ID
+	}
+	existing, err := c.storage.ExistingJobs(ctx, ids)
+	if err != nil {
+		return err
+	}
+
+	var created []*types.Job
+	for _, job := range jobs {
+		if existing[job.ID] {
+			continue
+		}
+		if _, err := c.offloader.Offload(ctx, job); err != nil {
+			return fmt.Errorf("failed to offload payload of step %s: %w", job.WorkflowStep, err)
+		}
+		created = append(created, job)
+	}
+	if err := c.storage.CreateJobs(ctx, created); err != nil {
+		return err
+	}
+
+	// Jobs stored but not queued are queued again by job state
+	// reconciliation
+	if err := c.queue.EnqueueJobs(ctx, created); err != nil {
+		return fmt.Errorf("failed to enqueue jobs of workflow %s: %w", wf.ID, err)
+	}
+
+	for _, job := range created {
+		log.Printf("Workflow %s started step %s as job %s (%s)", wf.ID, job.WorkflowStep, job.ID, job.Type)
+		c.events.PublishJob(ctx, events.EventJobCreated, job)
+	}
+	return nil
+}
+
+// Inputs returns the results of the steps that job's workflow step depends
+// on, keyed by step name. The result of a fan-out step is a JSON array of
+// its jobs' results in payload order. A compensating job gets the result
+// of the step it compensates instead. Jobs outside workflows have no
+// inputs.
+func (c *Coordinator) Inputs(ctx context.Context, job *types.Job) (map[string]json.RawMessage, error) {
+	if c == nil || job.WorkflowID == "" {
+		return nil, nil
+	}
+
+	wf, err := c.storage.GetWorkflow(ctx, job.WorkflowID)
+	if err != nil {
+		return nil, err
+	}
+	step := wf.Step(job.WorkflowStep)
+	if step == nil {
+		return nil, fmt.Errorf("workflow %s has no step %s", wf.ID, job.WorkflowStep)
+	}
+
+	deps := step.DependsOn
+	if step.Compensation != nil && step.Compensation.ID == job.ID {
+		deps = []string{step.Name}
+	}
+
+	inputs := make(map[string]json.RawMessage, len(deps))
+	for _, name := range deps {
+		dep := wf.Step(name)
+		if dep == nil {
+			return nil, fmt.Errorf("workflow %s has no step %s", wf.ID, name)
+		}
+
+		if len(dep.Jobs) == 0 {
+			if inputs[name], err = c.result(ctx, dep.JobID); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		results := make([]json.RawMessage, len(dep.Jobs))
+		for i, depJob := range dep.Jobs {
+			if results[i], err = c.result(ctx, depJob.ID); err != nil {
+				return nil, err
+			}
+		}
+		if inputs[name], err = json.Marshal(results); err != nil {
+			return nil, err
+		}
+	}
+
+	return inputs, nil
+}
+
+// result returns the result of a step job, JSON null if it has none
+func (c *Coordinator) result(ctx context.Context, jobID string) (json.RawMessage, error) {
+	job, err := c.storage.GetJob(ctx, jobID)
+	if err != nil {
+		return nil, err
+	}
+	if job.ResultRef != "" {
+		return c.results.Load(ctx, job.ResultRef)
+	}
+	if len(job.Result) == 0 {
+		return json.RawMessage("null"), nil
+	}
+	return job.Result, nil
+}
@@ -2,11 +2,20 @@ package main
 
 import (
 	"bytes"
+	"context"
+	"encoding/csv"
 	"encoding/json"
 	"flag"
 	"fmt"
+	"io"
+	"math"
+	"math/bits"
 	"math/rand"
 	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -18,17 +27,30 @@ type LoadTestConfig struct {
 	Concurrent int
 	Duration   time.Duration
 	JobTypes   []string
+
+	Scenario string  // traffic mix, a key of scenarios
+	Profile  profile // ramp of concurrent users over time, if any
+
+	Wait       bool          // follow jobs until they finish
+	Pollers    int           // jobs followed at once
+	JobTimeout time.Duration // how long a job may take to finish
+	Report     string        // report file, .json or .csv
 }
 
 type TestResult struct {
-	TotalRequests   int64
-	SuccessfulJobs  int64
-	FailedRequests  int64
-	TotalDuration   time.Duration
-	MinResponseTime time.Duration
-	MaxResponseTime time.Duration
-	AvgResponseTime time.Duration
-	RequestsPerSec  float64
+	TotalRequests  int64
+	SuccessfulJobs int64
+	FailedRequests int64
+	TotalDuration  time.Duration
+	RequestsPerSec float64
+
+	// Outcomes of the submitted jobs, when followed to the end
+	Finished   map[string]int64 // by final status
+	Unfinished int64            // still running after JobTimeout
+	JobsPerSec float64          // jobs finished per second
+
+	Latencies *latencies
+	Traffic   *traffic
 }
 
 type JobRequest struct {
@@ -36,12 +58,38 @@ type JobRequest struct {
 	Payload interface{} `json:"payload"`
 }
 
+// job is the part of a job the load test reads back
+type job struct {
+	ID          string     `json:"id"`
+	Type        string     `json:"type"`
+	Status      string     `json:"status"`
+	CreatedAt   time.Time  `json:"created_at"`
+	ScheduledAt time.Time  `json:"scheduled_at"`
+	StartedAt   *time.Time `json:"started_at"`
+	CompletedAt *time.Time `json:"completed_at"`
+}
+
+type jobResponse struct {
+	Job *job `json:"job"`
+}
+
+// finalStatuses are the statuses jobs end in
+var finalStatuses = []string{"completed", "failed", "cancelled", "expired"}
+
 func main() {
 	var (
 		apiUrl     = flag.String("url", "http://localhost:8080", "API base URL")
 		jobCount   = flag.Int("jobs", 1000, "Number of jobs to create")
 		concurrent = flag.Int("concurrent", 50, "Number of concurrent requests")
 		duration   = flag.Duration("duration", 0, "Test duration (0 = count-based)")
+		scenario   = flag.String("scenario", "submit", "Traffic mix: submit, poll, cancel or mixed")
+		rampUp     = flag.Duration("ramp-up", 0, "Time to ramp up from 1 to -concurrent users")
+		sustain    = flag.Duration("sustain", 0, "Time to hold -concurrent users after ramping up")
+		rampDown   = flag.Duration("ramp-down", 0, "Time to ramp down from -concurrent users to none")
+		wait       = flag.Bool("wait", true, "Follow submitted jobs until they finish and measure their latency")
+		pollers    = flag.Int("pollers", 200, "Number of jobs followed at once")
+		jobTimeout = flag.Duration("job-timeout", 5*time.Minute, "How long a submitted job may take to finish")
+		report     = flag.String("report", "", "Write a report to this file, as CSV if it ends in .csv and JSON otherwise")
 	)
 	flag.Parse()
 
@@ -51,11 +99,31 @@ func main() {
 		Concurrent: *concurrent,
 		Duration:   *duration,
 		JobTypes:   []string{"email", "webhook", "image_resize", "data_export"},
+		Scenario:   *scenario,
+		Profile:    profile{RampUp: *rampUp, Sustain: *sustain, RampDown: *rampDown},
+		Wait:       *wait,
+		Pollers:    *pollers,
+		JobTimeout: *jobTimeout,
+		Report:     *report,
+	}
+
+	if scenarios[config.Scenario] == nil {
+		fmt.Printf("Unknown scenario %q: use submit, poll, cancel or mixed\n", config.Scenario)
+		os.Exit(2)
+	}
+	if config.Profile.enabled() && config.Duration > 0 {
+		fmt.Println("Use either -duration or -ramp-up, -sustain and -ramp-down")
+		os.Exit(2)
 	}
 
 	fmt.Printf("Starting TaskFlow Load Test\n")
 	fmt.Printf("API URL: %s\n", config.APIUrl)
-	fmt.Printf("Jobs: %d\n", config.JobCount)
+	fmt.Printf("Scenario: %s\n", config.Scenario)
+	if config.Profile.enabled() {
+		fmt.Printf("Profile: ramp up %v, sustain %v, ramp down %v\n", config.Profile.RampUp, config.Profile.Sustain, config.Profile.RampDown)
+	} else {
+		fmt.Printf("Jobs: %d\n", config.JobCount)
+	}
 	fmt.Printf("Concurrent: %d\n", config.Concurrent)
 	if config.Duration > 0 {
 		fmt.Printf("Duration: %v\n", config.Duration)
@@ -73,7 +141,15 @@ func main() {
 	result := runLoadTest(config)
 
 	// Print results
-	printResults(result)
+	printResults(config, result)
+
+	if config.Report != "" {
+		if err := writeReport(config, result); err != nil {
+			fmt.Printf("Failed to write report: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Report written to %s\n", config.Report)
+	}
 }
 
 func testConnectivity(apiUrl string) bool {
@@ -86,142 +162,161 @@ func testConnectivity(apiUrl string) bool {
 	return resp.StatusCode == 200
 }
 
+// runLoadTest runs config.Concurrent virtual users, each performing the
+// scenario's operations one after another. With a profile, the users
+// ramp up and down over its phases; otherwise all of them run until
+// config.JobCount jobs are submitted or config.Duration passes.
 func runLoadTest(config LoadTestConfig) TestResult {
+	client := &http.Client{
+		Transport: &http.Transport{MaxIdleConnsPerHost: config.Concurrent + config.Pollers},
+	}
+
 	var (
-		totalRequests   int64
-		successfulJobs  int64
-		failedRequests  int64
-		totalDuration   int64
-		minResponseTime int64 = 999999999999 // Large initial value
-		maxResponseTime int64
+		totalRequests  int64
+		successfulJobs int64
+		failedRequests int64
+		unfinished     int64
+		submitted      int64 // submissions started, in count-based tests
+
+		mu       sync.Mutex
+		finished = make(map[string]int64)
+		lastDone time.Time
 	)
+	lat := newLatencies()
+	tr := newTraffic()
+	recent := &recentJobs{}
+	mix := newMix(scenarios[config.Scenario])
+
+	polling := make(chan struct{}, config.Pollers)
+	var users, followers sync.WaitGroup
+
+	// follow waits for a submitted job to finish and records its latencies
+	follow := func(jobID string) {
+		defer followers.Done()
+		polling <- struct{}{}
+		defer func() { <-polling }()
+
+		j, err := awaitJob(client, config.APIUrl, jobID, config.JobTimeout)
+		if err != nil {
+			atomic.AddInt64(&unfinished, 1)
+			return
+		}
+		lat.recordJob(j)
 
-	// Create semaphore to limit concurrency
-	semaphore := make(chan struct{}, config.Concurrent)
-	var wg sync.WaitGroup
+		mu.Lock()
+		finished[j.Status]++
+		lastDone = time.Now()
+		mu.Unlock()
+	}
 
-	// Start time
-	startTime := time.Now()
+	submit := func() {
+		jobNum := atomic.AddInt64(&submitted, 1)
+		jobType := config.JobTypes[rand.Intn(len(config.JobTypes))]
+		jobID, responseTime := makeJobRequest(client, config.APIUrl, jobType, tr)
+		atomic.AddInt64(&totalRequests, 1)
 
-	// Duration-based or count-based test
-	if config.Duration > 0 {
-		// Duration-based test
-		endTime := startTime.Add(config.Duration)
-
-		for time.Now().Before(endTime) {
-			wg.Add(1)
-			go func() {
-				defer wg.Done()
-				semaphore <- struct{}{}        // Acquire
-				defer func() { <-semaphore }() // Release
-
-				responseTime := makeJobRequest(config.APIUrl, config.JobTypes)
-				atomic.AddInt64(&totalRequests, 1)
-
-				if responseTime > 0 {
-					atomic.AddInt64(&successfulJobs, 1)
-					atomic.AddInt64(&totalDuration, responseTime.Nanoseconds())
-
-					// Update min/max response times
-					for {
-						current := atomic.LoadInt64(&minResponseTime)
-						if responseTime.Nanoseconds() >= current {
-							break
-						}
-						if atomic.CompareAndSwapInt64(&minResponseTime, current, responseTime.Nanoseconds()) {
-							break
-						}
-					}
-
-					for {
-						current := atomic.LoadInt64(&maxResponseTime)
-						if responseTime.Nanoseconds() <= current {
-							break
-						}
-						if atomic.CompareAndSwapInt64(&maxResponseTime, current, responseTime.Nanoseconds()) {
-							break
-						}
-					}
-				} else {
-					atomic.AddInt64(&failedRequests, 1)
-				}
-			}()
+		if jobID == "" {
+			atomic.AddInt64(&failedRequests, 1)
+			return
 		}
-	} else {
-		// Count-based test
-		for i := 0; i < config.JobCount; i++ {
-			wg.Add(1)
-			go func(jobNum int) {
-				defer wg.Done()
-				semaphore <- struct{}{}        // Acquire
-				defer func() { <-semaphore }() // Release
-
-				responseTime := makeJobRequest(config.APIUrl, config.JobTypes)
-				atomic.AddInt64(&totalRequests, 1)
-
-				if responseTime > 0 {
-					atomic.AddInt64(&successfulJobs, 1)
-					atomic.AddInt64(&totalDuration, responseTime.Nanoseconds())
-
-					// Update min/max response times atomically
-					for {
-						current := atomic.LoadInt64(&minResponseTime)
-						if responseTime.Nanoseconds() >= current {
-							break
-						}
-						if atomic.CompareAndSwapInt64(&minResponseTime, current, responseTime.Nanoseconds()) {
-							break
-						}
-					}
-
-					for {
-						current := atomic.LoadInt64(&maxResponseTime)
-						if responseTime.Nanoseconds() <= current {
-							break
-						}
-						if atomic.CompareAndSwapInt64(&maxResponseTime, current, responseTime.Nanoseconds()) {
-							break
-						}
-					}
-				} else {
-					atomic.AddInt64(&failedRequests, 1)
+		atomic.AddInt64(&successfulJobs, 1)
+		lat.record(metricSubmit, jobType, responseTime)
+		recent.add(jobID)
+
+		if config.Wait {
+			followers.Add(1)
+			go follow(jobID)
+		}
+
+		// Progress indicator
+		if !config.Profile.enabled() && config.Duration == 0 && jobNum%100 == 0 {
+			fmt.Printf("Progress: %d/%d jobs submitted\n", jobNum, config.JobCount)
+		}
+	}
+
+	// Start time
+	startTime := time.Now()
+	end := startTime.Add(config.Duration)
+	if config.Profile.enabled() {
+		end = startTime.Add(config.Profile.total())
+		go config.Profile.announce(startTime, config.Concurrent)
+	}
+	timed := config.Duration > 0 || config.Profile.enabled()
+
+	user := func(i int) {
+		defer users.Done()
+		for {
+			if timed && !time.Now().Before(end) {
+				return
+			}
+			if config.Profile.enabled() && i >= config.Profile.users(time.Since(startTime), config.Concurrent) {
+				time.Sleep(100 * time.Millisecond)
+				continue
+			}
+
+			op := mix.pick()
+			jobID := ""
+			if op == opGet || op == opCancel {
+				if jobID = recent.pick(); jobID == "" {
+					op = opSubmit
 				}
+			}
 
-				// Progress indicator
-				if jobNum%100 == 0 {
-					fmt.Printf("Progress: %d/%d jobs submitted\n", jobNum, config.JobCount)
+			switch op {
+			case opSubmit:
+				// Count-based tests stop after config.JobCount submissions
+				if !timed && atomic.LoadInt64(&submitted) >= int64(config.JobCount) {
+					return
 				}
-			}(i)
+				submit()
+			case opGet:
+				tr.call(client, opGet, "GET", config.APIUrl+"/api/v1/jobs/"+jobID, nil)
+			case opList:
+				tr.call(client, opList, "GET", config.APIUrl+"/api/v1/jobs?page_size=20&status="+listStatuses[rand.Intn(len(listStatuses))], nil)
+			case opStats:
+				tr.call(client, opStats, "GET", config.APIUrl+"/api/v1/stats", nil)
+			case opCancel:
+				tr.call(client, opCancel, "POST", config.APIUrl+"/api/v1/jobs/"+jobID+"/cancel", nil)
+			}
 		}
 	}
+	for i := 0; i < config.Concurrent; i++ {
+		users.Add(1)
+		go user(i)
+	}
 
-	// Wait for all requests to complete
-	wg.Wait()
-
-	actualDuration := time.Since(startTime)
+	// Wait for all users to finish
+	users.Wait()
+	submitDuration := time.Since(startTime)
 
-	// Calculate average response time
-	var avgResponseTime time.Duration
-	if successfulJobs > 0 {
-		avgResponseTime = time.Duration(totalDuration / successfulJobs)
+	if config.Wait && successfulJobs > 0 {
+		fmt.Printf("Waiting for %d jobs to finish...\n", successfulJobs)
+		followers.Wait()
 	}
 
-	return TestResult{
-		TotalRequests:   totalRequests,
-		SuccessfulJobs:  successfulJobs,
-		FailedRequests:  failedRequests,
-		TotalDuration:   actualDuration,
-		MinResponseTime: time.Duration(minResponseTime),
-		MaxResponseTime: time.Duration(maxResponseTime),
-		AvgResponseTime: avgResponseTime,
-		RequestsPerSec:  float64(totalRequests) / actualDuration.Seconds(),
+	result := TestResult{
+		TotalRequests:  totalRequests,
+		SuccessfulJobs: successfulJobs,
+		FailedRequests: failedRequests,
+		TotalDuration:  submitDuration,
+		RequestsPerSec: float64(totalRequests) / submitDuration.Seconds(),
+		Finished:       finished,
+		Unfinished:     unfinished,
+		Latencies:      lat,
+		Traffic:        tr,
 	}
+	tr.elapsed = submitDuration
+	if !lastDone.IsZero() {
+		var done int64
+		for _, n := range finished {
+			done += n
+		}
+		result.JobsPerSec = float64(done) / lastDone.Sub(startTime).Seconds()
+	}
+	return result
 }
 
-func makeJobRequest(apiUrl string, jobTypes []string) time.Duration {
-	// Randomly select a job type
-	jobType := jobTypes[rand.Intn(len(jobTypes))]
-
+func makeJobRequest(client *http.Client, apiUrl, jobType string, tr *traffic) (string, time.Duration) {
 	// Create job payload based on type
 	var payload interface{}
 	switch jobType {
@@ -251,7 +346,8 @@ func makeJobRequest(apiUrl string, jobTypes []string) time.Duration {
 	case "data_export":
 		payload = map[string]interface{}{
 			"export_type": "csv",
-			"query":       "SELECT * FROM users WHERE id > " + fmt.Sprintf("%d", rand.Intn(1000)),
+			"query":       "SELECT * FROM users WHERE id > $1",
+			"params":      []interface{}{rand.Intn(1000)},
 			"output_path": fmt.Sprintf("/tmp/export_%d", rand.Intn(10000)),
 		}
 	default:
@@ -268,33 +364,489 @@ func makeJobRequest(apiUrl string, jobTypes []string) time.Duration {
 	// Marshal to JSON
 	jsonData, err := json.Marshal(jobRequest)
 	if err != nil {
-		return 0
+		return "", 0
 	}
 
 	// Make HTTP request
-	client := &http.Client{Timeout: 10 * time.Second}
+	status, body, responseTime := tr.call(client, opSubmit, "POST", apiUrl+"/api/v1/jobs", jsonData)
+	if status != 201 {
+		return "", 0
+	}
+
+	var created jobResponse
+	if err := json.Unmarshal(body, &created); err != nil || created.Job == nil {
+		return "", 0
+	}
+	return created.Job.ID, responseTime
+}
+
+// Operations of virtual users
+const (
+	opSubmit = "submit" // submit a job
+	opGet    = "get"    // read a recently submitted job
+	opList   = "list"   // list a page of jobs in some status
+	opStats  = "stats"  // read the queue statistics
+	opCancel = "cancel" // cancel a recently submitted job
+)
+
+var operations = []string{opSubmit, opGet, opList, opStats, opCancel}
+
+// endpoints names the endpoint each operation calls
+var endpoints = map[string]string{
+	opSubmit: "POST /api/v1/jobs",
+	opGet:    "GET /api/v1/jobs/{id}",
+	opList:   "GET /api/v1/jobs",
+	opStats:  "GET /api/v1/stats",
+	opCancel: "POST /api/v1/jobs/{id}/cancel",
+}
+
+// scenarios weigh the operations of each traffic mix
+var scenarios = map[string]map[string]int{
+	// Submissions only, as clients enqueueing work
+	"submit": {opSubmit: 100},
+	// Clients polling their jobs and dashboards listing them
+	"poll": {opSubmit: 10, opGet: 60, opList: 20, opStats: 10},
+	// Half of the jobs cancelled as soon as they're submitted
+	"cancel": {opSubmit: 50, opCancel: 50},
+	// A bit of everything, as production traffic
+	"mixed": {opSubmit: 40, opGet: 35, opList: 10, opStats: 5, opCancel: 10},
+}
+
+// listStatuses are the statuses list operations filter by
+var listStatuses = []string{"pending", "processing", "completed", "failed"}
+
+// mix picks operations at random in proportion to their weights
+type mix struct {
+	ops     []string
+	weights []int
+	total   int
+}
+
+func newMix(weights map[string]int) *mix {
+	m := &mix{}
+	for _, op := range operations {
+		if w := weights[op]; w > 0 {
+			m.ops = append(m.ops, op)
+			m.weights = append(m.weights, w)
+			m.total += w
+		}
+	}
+	return m
+}
+
+func (m *mix) pick() string {
+	n := rand.Intn(m.total)
+	for i, w := range m.weights {
+		if n < w {
+			return m.ops[i]
+		}
+		n -= w
+	}
+	return m.ops[len(m.ops)-1]
+}
+
+// recentJobs keeps the last submitted job IDs, for operations on existing
+// jobs to pick from
+type recentJobs struct {
+	mu   sync.Mutex
+	ids  [1000]string
+	next int
+	n    int
+}
+
+func (r *recentJobs) add(jobID string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.ids[r.next] = jobID
+	r.next = (r.next + 1) % len(r.ids)
+	r.n = min(r.n+1, len(r.ids))
+}
 
+// pick returns one of the recent job IDs, or "" before any job is
+// submitted
+func (r *recentJobs) pick() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.n == 0 {
+		return ""
+	}
+	return r.ids[rand.Intn(r.n)]
+}
+
+// profile ramps the number of concurrent users up to the peak, holds it,
+// and ramps it back down
+type profile struct {
+	RampUp   time.Duration
+	Sustain  time.Duration
+	RampDown time.Duration
+}
+
+func (p profile) enabled() bool {
+	return p.total() > 0
+}
+
+func (p profile) total() time.Duration {
+	return p.RampUp + p.Sustain + p.RampDown
+}
+
+// users returns how many of peak users run elapsed into the profile
+func (p profile) users(elapsed time.Duration, peak int) int {
+	switch {
+	case elapsed < p.RampUp:
+		return max(1, int(math.Ceil(float64(peak)*float64(elapsed)/float64(p.RampUp))))
+	case elapsed < p.RampUp+p.Sustain:
+		return peak
+	case elapsed < p.total():
+		left := p.total() - elapsed
+		return max(1, int(math.Ceil(float64(peak)*float64(left)/float64(p.RampDown))))
+	}
+	return 0
+}
+
+// announce prints each phase as it starts
+func (p profile) announce(start time.Time, peak int) {
+	phases := []struct {
+		name string
+		at   time.Duration
+		d    time.Duration
+	}{
+		{"ramp up", 0, p.RampUp},
+		{"sustain", p.RampUp, p.Sustain},
+		{"ramp down", p.RampUp + p.Sustain, p.RampDown},
+	}
+	for _, phase := range phases {
+		if phase.d == 0 {
+			continue
+		}
+		time.Sleep(time.Until(start.Add(phase.at)))
+		fmt.Printf("Phase: %s for %v (%d users now, %d at peak)\n", phase.name, phase.d, p.users(phase.at, peak), peak)
+	}
+}
+
+// traffic counts the requests to each endpoint by outcome, with their
+// latencies
+type traffic struct {
+	mu        sync.Mutex
+	endpoints map[string]*endpointStats
+	elapsed   time.Duration // how long traffic ran, set at the end
+}
+
+type endpointStats struct {
+	latency  histogram
+	ok       int64 // 2xx
+	rejected int64 // 4xx, such as cancelling a finished job or a rate limit
+	errors   int64 // 5xx and failed requests
+}
+
+func newTraffic() *traffic {
+	return &traffic{endpoints: make(map[string]*endpointStats)}
+}
+
+// call sends a request for op and records it. It returns the response's
+// status, 0 if the request failed, with its body and latency.
+func (t *traffic) call(client *http.Client, op, method, url string, body []byte) (int, []byte, time.Duration) {
 	start := time.Now()
-	resp, err := client.Post(
-		apiUrl+"/api/v1/jobs",
-		"application/json",
-		bytes.NewBuffer(jsonData),
-	)
-	responseTime := time.Since(start)
+	status, respBody := 0, []byte(nil)
+	req, err := http.NewRequest(method, url, bytes.NewReader(body))
+	if err == nil {
+		if body != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		var resp *http.Response
+		if resp, err = doWithTimeout(client, req, 10*time.Second); err == nil {
+			respBody, err = io.ReadAll(resp.Body)
+			resp.Body.Close()
+			status = resp.StatusCode
+		}
+	}
+	latency := time.Since(start)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	stats := t.endpoints[op]
+	if stats == nil {
+		stats = &endpointStats{}
+		t.endpoints[op] = stats
+	}
+	stats.latency.record(latency)
+	switch {
+	case err != nil || status >= 500:
+		stats.errors++
+	case status >= 400:
+		stats.rejected++
+	default:
+		stats.ok++
+	}
+	return status, respBody, latency
+}
+
+// endpointRow is the traffic to one endpoint
+type endpointRow struct {
+	Endpoint       string  `json:"endpoint"`
+	Requests       int64   `json:"requests"`
+	OK             int64   `json:"ok"`
+	Rejected       int64   `json:"rejected"`
+	Errors         int64   `json:"errors"`
+	RequestsPerSec float64 `json:"requests_per_sec"`
+	P50ms          float64 `json:"p50_ms"`
+	P95ms          float64 `json:"p95_ms"`
+	P99ms          float64 `json:"p99_ms"`
+	MaxMs          float64 `json:"max_ms"`
+}
+
+// rows returns the traffic to each endpoint that was called
+func (t *traffic) rows() []endpointRow {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var rows []endpointRow
+	for _, op := range operations {
+		stats := t.endpoints[op]
+		if stats == nil {
+			continue
+		}
+		h := &stats.latency
+		rows = append(rows, endpointRow{
+			Endpoint:       endpoints[op],
+			Requests:       h.total,
+			OK:             stats.ok,
+			Rejected:       stats.rejected,
+			Errors:         stats.errors,
+			RequestsPerSec: float64(h.total) / t.elapsed.Seconds(),
+			P50ms:          ms(h.percentile(50)),
+			P95ms:          ms(h.percentile(95)),
+			P99ms:          ms(h.percentile(99)),
+			MaxMs:          ms(h.max),
+		})
+	}
+	return rows
+}
+
+// awaitJob long-polls a job until it reaches a final status or timeout
+// passes
+func awaitJob(client *http.Client, apiUrl, jobID string, timeout time.Duration) (*job, error) {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		wait := min(30*time.Second, time.Until(deadline)).Round(time.Second)
+		req, err := http.NewRequest("GET", fmt.Sprintf("%s/api/v1/jobs/%s?wait=%s", apiUrl, jobID, max(wait, time.Second)), nil)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := doWithTimeout(client, req, wait+10*time.Second)
+		if err != nil {
+			// Transient errors are retried until the deadline
+			time.Sleep(time.Second)
+			continue
+		}
+		var got jobResponse
+		err = json.NewDecoder(resp.Body).Decode(&got)
+		resp.Body.Close()
+		if err != nil || got.Job == nil {
+			time.Sleep(time.Second)
+			continue
+		}
+
+		for _, status := range finalStatuses {
+			if got.Job.Status == status {
+				return got.Job, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("job %s did not finish within %v", jobID, timeout)
+}
 
+// doWithTimeout sends a request on the shared client, giving up after
+// timeout
+func doWithTimeout(client *http.Client, req *http.Request, timeout time.Duration) (*http.Response, error) {
+	ctx, cancel := context.WithTimeout(req.Context(), timeout)
+	resp, err := client.Do(req.WithContext(ctx))
 	if err != nil {
-		return 0
+		cancel()
+		return nil, err
 	}
-	defer resp.Body.Close()
+	resp.Body = &timedBody{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+// timedBody releases a request's timeout once its body is closed
+type timedBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *timedBody) Close() error {
+	defer b.cancel()
+	return b.ReadCloser.Close()
+}
+
+// Latency metrics
+const (
+	metricSubmit    = "submit"     // POST /api/v1/jobs round trip
+	metricQueueWait = "queue_wait" // from when the job was due to when its last attempt started
+	metricExecution = "execution"  // from when its last attempt started to when it finished
+	metricEndToEnd  = "end_to_end" // from when the job was created to when it finished
+)
+
+var latencyMetrics = []string{metricSubmit, metricQueueWait, metricExecution, metricEndToEnd}
+
+// latencies keeps a histogram per metric, for all jobs and per job type
+type latencies struct {
+	mu         sync.Mutex
+	histograms map[string]map[string]*histogram // metric, then job type or "all"
+}
+
+func newLatencies() *latencies {
+	return &latencies{histograms: make(map[string]map[string]*histogram)}
+}
+
+func (l *latencies) record(metric, jobType string, d time.Duration) {
+	if d < 0 {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	byType := l.histograms[metric]
+	if byType == nil {
+		byType = make(map[string]*histogram)
+		l.histograms[metric] = byType
+	}
+	for _, key := range []string{"all", jobType} {
+		if byType[key] == nil {
+			byType[key] = &histogram{}
+		}
+		byType[key].record(d)
+	}
+}
+
+// recordJob records the server-side latencies of a finished job, from its
+// timestamps
+func (l *latencies) recordJob(j *job) {
+	if j.CompletedAt == nil {
+		return
+	}
+	l.record(metricEndToEnd, j.Type, j.CompletedAt.Sub(j.CreatedAt))
+	if j.StartedAt == nil {
+		return
+	}
+	due := j.CreatedAt
+	if j.ScheduledAt.After(due) {
+		due = j.ScheduledAt
+	}
+	l.record(metricQueueWait, j.Type, j.StartedAt.Sub(due))
+	l.record(metricExecution, j.Type, j.CompletedAt.Sub(*j.StartedAt))
+}
+
+// latencyRow is a metric's percentiles for one job type
+type latencyRow struct {
+	Metric  string  `json:"metric"`
+	JobType string  `json:"job_type"`
+	Count   int64   `json:"count"`
+	P50ms   float64 `json:"p50_ms"`
+	P95ms   float64 `json:"p95_ms"`
+	P99ms   float64 `json:"p99_ms"`
+	MaxMs   float64 `json:"max_ms"`
+}
 
-	if resp.StatusCode != 201 {
+// rows returns the percentiles of every metric and job type, all jobs
+// first
+func (l *latencies) rows() []latencyRow {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var rows []latencyRow
+	for _, metric := range latencyMetrics {
+		byType := l.histograms[metric]
+		keys := make([]string, 0, len(byType))
+		for key := range byType {
+			if key != "all" {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+		if byType["all"] != nil {
+			keys = append([]string{"all"}, keys...)
+		}
+
+		for _, key := range keys {
+			h := byType[key]
+			rows = append(rows, latencyRow{
+				Metric:  metric,
+				JobType: key,
+				Count:   h.total,
+				P50ms:   ms(h.percentile(50)),
+				P95ms:   ms(h.percentile(95)),
+				P99ms:   ms(h.percentile(99)),
+				MaxMs:   ms(h.max),
+			})
+		}
+	}
+	return rows
+}
+
+func ms(d time.Duration) float64 {
+	return math.Round(float64(d)/float64(time.Millisecond)*100) / 100
+}
+
+// histogram counts durations in the log-linear buckets of an HDR
+// histogram: each power of two is split into subBuckets equal buckets, so
+// percentiles are within 1/subBuckets of the true value at any scale, in
+// fixed memory
+type histogram struct {
+	counts [(64 - subBucketBits + 1) * subBuckets]int64
+	total  int64
+	max    time.Duration
+}
+
+const (
+	subBucketBits = 7
+	subBuckets    = 1 << subBucketBits
+)
+
+func (h *histogram) record(d time.Duration) {
+	h.counts[bucketOf(uint64(d))]++
+	h.total++
+	h.max = max(h.max, d)
+}
+
+// percentile returns the smallest recorded value that p percent of values
+// are at or below, to the histogram's precision
+func (h *histogram) percentile(p float64) time.Duration {
+	if h.total == 0 {
 		return 0
 	}
+	rank := int64(math.Ceil(p / 100 * float64(h.total)))
+	var seen int64
+	for i, count := range h.counts {
+		seen += count
+		if seen >= rank {
+			return min(time.Duration(bucketTop(i)), h.max)
+		}
+	}
+	return h.max
+}
 
-	return responseTime
+// bucketOf returns the bucket of v. Values below 2*subBuckets have a
+// bucket each; above that, v's top subBucketBits+1 bits pick its bucket
+// within its power of two.
+func bucketOf(v uint64) int {
+	if v < 2*subBuckets {
+		return int(v)
+	}
+	shift := bits.Len64(v) - subBucketBits - 1
+	return shift*subBuckets + int(v>>shift)
 }
 
-func printResults(result TestResult) {
+// bucketTop returns the largest value in bucket i
+func bucketTop(i int) uint64 {
+	if i < 2*subBuckets {
+		return uint64(i)
+	}
+	shift := i/subBuckets - 1
+	mantissa := uint64(i - shift*subBuckets)
+	return (mantissa+1)<<shift - 1
+}
+
+func printResults(config LoadTestConfig, result TestResult) {
 	fmt.Println()
 	fmt.Println("Load Test Results")
 	fmt.Printf("Total Requests:    %d\n", result.TotalRequests)
@@ -305,10 +857,31 @@ func printResults(result TestResult) {
 	fmt.Printf("Total Duration:    %v\n", result.TotalDuration)
 	fmt.Printf("Requests/Second:   %.2f\n", result.RequestsPerSec)
 	fmt.Println()
-	fmt.Printf("Response Times:\n")
-	fmt.Printf("  Min:             %v\n", result.MinResponseTime)
-	fmt.Printf("  Max:             %v\n", result.MaxResponseTime)
-	fmt.Printf("  Average:         %v\n", result.AvgResponseTime)
+
+	if config.Wait {
+		fmt.Printf("Job Outcomes:\n")
+		for _, status := range finalStatuses {
+			fmt.Printf("  %-16s %d\n", strings.ToUpper(status[:1])+status[1:]+":", result.Finished[status])
+		}
+		fmt.Printf("  %-16s %d\n", "Unfinished:", result.Unfinished)
+		fmt.Printf("Jobs/Second:       %.2f\n", result.JobsPerSec)
+		fmt.Println()
+	}
+
+	fmt.Printf("Endpoints (latencies in ms):\n")
+	fmt.Printf("  %-30s %8s %8s %8s %8s %8s %9s %9s %9s\n", "Endpoint", "Requests", "OK", "4xx", "Errors", "Req/s", "p50", "p95", "p99")
+	for _, row := range result.Traffic.rows() {
+		fmt.Printf("  %-30s %8d %8d %8d %8d %8.2f %9.2f %9.2f %9.2f\n",
+			row.Endpoint, row.Requests, row.OK, row.Rejected, row.Errors, row.RequestsPerSec, row.P50ms, row.P95ms, row.P99ms)
+	}
+	fmt.Println()
+
+	fmt.Printf("Latencies (ms):\n")
+	fmt.Printf("  %-12s %-14s %8s %10s %10s %10s %10s\n", "Metric", "Job Type", "Count", "p50", "p95", "p99", "Max")
+	for _, row := range result.Latencies.rows() {
+		fmt.Printf("  %-12s %-14s %8d %10.2f %10.2f %10.2f %10.2f\n",
+			row.Metric, row.JobType, row.Count, row.P50ms, row.P95ms, row.P99ms, row.MaxMs)
+	}
 	fmt.Println()
 
 	// Performance assessment
@@ -333,3 +906,75 @@ func printResults(result TestResult) {
 		fmt.Println("Poor reliability")
 	}
 }
+
+// writeReport writes the latency percentiles to config.Report: as CSV, a
+// row per metric and job type; as JSON, with the run's settings and
+// totals too
+func writeReport(config LoadTestConfig, result TestResult) error {
+	file, err := os.Create(config.Report)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	rows := result.Latencies.rows()
+	endpointRows := result.Traffic.rows()
+	if strings.HasSuffix(config.Report, ".csv") {
+		// Endpoint rows have the "request" metric and no job type
+		w := csv.NewWriter(file)
+		w.Write([]string{"metric", "job_type", "endpoint", "count", "rejected", "errors", "p50_ms", "p95_ms", "p99_ms", "max_ms"})
+		for _, row := range endpointRows {
+			w.Write([]string{
+				"request", "", row.Endpoint, strconv.FormatInt(row.Requests, 10),
+				strconv.FormatInt(row.Rejected, 10), strconv.FormatInt(row.Errors, 10),
+				formatMs(row.P50ms), formatMs(row.P95ms), formatMs(row.P99ms), formatMs(row.MaxMs),
+			})
+		}
+		for _, row := range rows {
+			w.Write([]string{
+				row.Metric, row.JobType, "", strconv.FormatInt(row.Count, 10), "", "",
+				formatMs(row.P50ms), formatMs(row.P95ms), formatMs(row.P99ms), formatMs(row.MaxMs),
+			})
+		}
+		w.Flush()
+		if err := w.Error(); err != nil {
+			return err
+		}
+		return file.Close()
+	}
+
+	report := map[string]interface{}{
+		"url":              config.APIUrl,
+		"scenario":         config.Scenario,
+		"concurrent":       config.Concurrent,
+		"total_requests":   result.TotalRequests,
+		"successful_jobs":  result.SuccessfulJobs,
+		"failed_requests":  result.FailedRequests,
+		"duration_seconds": result.TotalDuration.Seconds(),
+		"requests_per_sec": result.RequestsPerSec,
+		"endpoints":        endpointRows,
+		"latencies":        rows,
+	}
+	if config.Profile.enabled() {
+		report["profile"] = map[string]float64{
+			"ramp_up_seconds":   config.Profile.RampUp.Seconds(),
+			"sustain_seconds":   config.Profile.Sustain.Seconds(),
+			"ramp_down_seconds": config.Profile.RampDown.Seconds(),
+		}
+	}
+	if config.Wait {
+		report["finished"] = result.Finished
+		report["unfinished"] = result.Unfinished
+		report["jobs_per_sec"] = result.JobsPerSec
+	}
+	enc := json.NewEncoder(file)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(report); err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+func formatMs(v float64) string {
+	return strconv.FormatFloat(v, 'f', 2, 64)
+}